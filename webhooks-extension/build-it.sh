@@ -40,6 +40,8 @@ newestFileInFolder=$(ls -Art $thePath | tail -n 1)
 echo "Thinking the newest file (your build?) is $newestFileInFolder"
 foundHash=$(echo $thePath/$newestFileInFolder | awk -F "." '{print $2}')
 echo "Thinking the hash to use is $foundHash"
-toUse="web/extension.$foundHash.js"
+# Served with an immutable Cache-Control under the hash of its content, see pkg/endpoints/webassets.go
+contentHash=$(sha256sum $thePath/$newestFileInFolder | cut -c1-16)
+toUse="web/$contentHash/extension.$foundHash.js"
 yq w -i $serviceFile metadata.annotations.tekton-dashboard-bundle-location $toUse
 echo "Done!"
\ No newline at end of file
@@ -33,6 +33,23 @@ func main() {
 	wsContainer := restful.NewContainer()
 	wsContainer.Router(restful.CurlyRouter{})
 
+	// Log API requests, see ACCESS_LOG
+	wsContainer.Filter(endpoints.AccessLogFilter)
+	// Respond to requests whose handler panics with a 500 and an incident ID
+	wsContainer.Filter(endpoints.RecoverFilter)
+	// Refuse request bodies larger than MAX_REQUEST_BODY_BYTES, see bodylimit.go
+	wsContainer.Filter(endpoints.BodyLimitFilter)
+	// Record the requests in flight for GET /webhooks/debug/state
+	wsContainer.Filter(endpoints.TrackRequestsFilter)
+	// Verify requests signed with an API key, see signedrequests.go
+	wsContainer.Filter(r.SignatureFilter)
+	// Verify extension session tokens, see sessiontokens.go
+	wsContainer.Filter(r.SessionTokenFilter)
+	// Record the changes made to each webhook, see history.go
+	wsContainer.Filter(r.HistoryFilter)
+	// Rebuild the webhook indexes once a request has changed the webhooks, see webhookindex.go
+	wsContainer.Filter(r.WebhookIndexFilter)
+
 	// Add web extension
 	r.RegisterWeb(wsContainer)
 	r.RegisterExtensionWebService(wsContainer)
@@ -41,6 +58,12 @@ func main() {
 	r.RegisterLivenessWebService(wsContainer)
 	r.RegisterReadinessWebService(wsContainer)
 
+	// Add PipelineRun metrics
+	r.RegisterMetricsWebService(wsContainer)
+
+	// Add profiling if PPROF_ENABLED is true
+	r.RegisterProfilingHandlers(wsContainer)
+
 	// Serve
 	logging.Log.Info("Creating server and entering wait loop.")
 	port := ":8080"
@@ -49,6 +72,58 @@ func main() {
 		port = ":" + portnum
 		logging.Log.Infof("Port number from config: %s.", portnum)
 	}
+	// Receive and forward provider deliveries if buffering
+	if r.Defaults.DeliveryBuffer {
+		deliveryPort := ":8081"
+		if portnum := os.Getenv("DELIVERY_BUFFER_PORT"); portnum != "" {
+			deliveryPort = ":" + portnum
+		}
+		logging.Log.Infof("Delivery buffering enabled, receiving deliveries on port %s.", deliveryPort)
+		go r.ForwardBufferedDeliveries(make(chan struct{}))
+		go func() {
+			logging.Log.Fatal(http.ListenAndServe(deliveryPort, r.DeliveryBufferHandler()))
+		}()
+	}
+
+	// Keep the index of the webhooks by repository current
+	go r.IndexWebhooks(make(chan struct{}))
+
+	// Disable and delete webhooks created with an expiry
+	go r.ExpireWebhooks(make(chan struct{}))
+
+	// Start the follow-up pipelines of webhooks' succeeded PipelineRuns
+	go r.FollowUpPipelineRuns(make(chan struct{}))
+
+	// Record the outcomes and durations of webhooks' PipelineRuns for the stats endpoint and /metrics
+	go r.RecordPipelineRunStats(make(chan struct{}))
+
+	// Post webhooks' PipelineRuns that couldn't start to their dead letter URLs
+	go r.ReportDeadLetters(make(chan struct{}))
+
+	// Set the repository labels of webhooks' PipelineRuns that their templates don't
+	go r.LabelPipelineRuns(make(chan struct{}))
+
+	// Report on pull requests from the extension if the monitor controller is enabled
+	go r.MonitorPipelineRuns(make(chan struct{}))
+
+	// Delete the payloads the interceptor captured once PAYLOAD_CAPTURE_TTL is over
+	go r.ExpireCapturedPayloads(make(chan struct{}))
+
+	// List the previews whose pull requests were closed for their namespaces to be deleted once their teardown is done
+	go r.CleanUpPreviews(make(chan struct{}))
+
+	// Recreate the eventlistener's ingress, route or TLS secret if they're deleted
+	go r.RepairInfrastructure(make(chan struct{}))
+
+	// Forward the deliveries on a relay channel to the eventlistener, see WEBHOOK_RELAY_URL
+	go r.RelayDeliveries(make(chan struct{}))
+
+	// Migrate the callback to the public URL of a tunnel to the cluster, see WEBHOOK_TUNNEL
+	go r.FollowTunnel(make(chan struct{}))
+
+	// Apply changes to the webhooks-extension-config configmap
+	go r.ReloadConfig(make(chan struct{}))
+
 	server := &http.Server{Addr: port, Handler: wsContainer}
 	logging.Log.Fatal(server.ListenAndServe())
 }
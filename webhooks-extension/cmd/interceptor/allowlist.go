@@ -0,0 +1,202 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Fetched for the ranges GitHub delivers webhooks from when ALLOWED_DELIVERY_SOURCES names github
+	defaultGitHubMetaURL = "https://api.github.com/meta"
+	// Used if ALLOWED_DELIVERY_SOURCES_REFRESH isn't set
+	defaultAllowlistRefresh = time.Hour
+	allowlistFetchTimeout   = 30 * time.Second
+	// The source in ALLOWED_DELIVERY_SOURCES standing for the ranges GitHub publishes
+	githubSource = "github"
+)
+
+// deliveryAllowlist holds the networks deliveries are accepted from, the static ones from ALLOWED_DELIVERY_SOURCES
+// and those fetched from the provider
+type deliveryAllowlist struct {
+	lock    sync.RWMutex
+	enabled bool
+	static  []*net.IPNet
+	fetched []*net.IPNet
+}
+
+var allowedSources = &deliveryAllowlist{}
+
+// setupAllowlist reads ALLOWED_DELIVERY_SOURCES, a comma separated list of github and IP addresses or CIDR
+// ranges, and if it names github fetches the ranges GitHub publishes, refreshing them in the background
+func setupAllowlist() error {
+	sources := os.Getenv("ALLOWED_DELIVERY_SOURCES")
+	if strings.TrimSpace(sources) == "" {
+		return nil
+	}
+	static, fetchGitHub, err := parseAllowedSources(sources)
+	if err != nil {
+		return err
+	}
+	allowedSources.lock.Lock()
+	allowedSources.enabled = true
+	allowedSources.static = static
+	allowedSources.lock.Unlock()
+	if !fetchGitHub {
+		log.Printf("Accepting deliveries from %d allowed networks", len(static))
+		return nil
+	}
+	metaURL := os.Getenv("GITHUB_META_URL")
+	if metaURL == "" {
+		metaURL = defaultGitHubMetaURL
+	}
+	refresh, err := time.ParseDuration(os.Getenv("ALLOWED_DELIVERY_SOURCES_REFRESH"))
+	if err != nil || refresh <= 0 {
+		refresh = defaultAllowlistRefresh
+	}
+	// A failed fetch is retried at the next refresh, deliveries only being accepted from the static networks till then
+	refreshGitHubRanges(metaURL)
+	go func() {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		for range ticker.C {
+			refreshGitHubRanges(metaURL)
+		}
+	}()
+	return nil
+}
+
+// parseAllowedSources returns the networks of a list of sources and whether it names github
+func parseAllowedSources(sources string) ([]*net.IPNet, bool, error) {
+	networks := []*net.IPNet{}
+	fetchGitHub := false
+	for _, source := range strings.Split(sources, ",") {
+		source = strings.TrimSpace(source)
+		switch {
+		case source == "":
+		case strings.ToLower(source) == githubSource:
+			fetchGitHub = true
+		default:
+			network, err := parseNetwork(source)
+			if err != nil {
+				return nil, false, fmt.Errorf("allowed delivery source %q is not github, an IP address or a CIDR range", source)
+			}
+			networks = append(networks, network)
+		}
+	}
+	return networks, fetchGitHub, nil
+}
+
+// parseNetwork reads a CIDR range, or an IP address as the range of that address alone
+func parseNetwork(source string) (*net.IPNet, error) {
+	if !strings.Contains(source, "/") {
+		ip := net.ParseIP(source)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %s", source)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(source)
+	return network, err
+}
+
+// refreshGitHubRanges replaces the fetched networks with the hooks ranges of GitHub's meta API, keeping those
+// fetched before if it fails
+func refreshGitHubRanges(metaURL string) {
+	networks, err := fetchGitHubRanges(metaURL)
+	if err != nil {
+		log.Printf("Error fetching the ranges GitHub delivers webhooks from: %s", err.Error())
+		return
+	}
+	allowedSources.lock.Lock()
+	allowedSources.fetched = networks
+	allowedSources.lock.Unlock()
+	log.Printf("Accepting deliveries from %d ranges GitHub delivers webhooks from", len(networks))
+}
+
+func fetchGitHubRanges(metaURL string) ([]*net.IPNet, error) {
+	client := http.Client{Timeout: allowlistFetchTimeout}
+	resp, err := client.Get(metaURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with status %d", metaURL, resp.StatusCode)
+	}
+	meta := struct {
+		Hooks []string `json:"hooks"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, err
+	}
+	if len(meta.Hooks) == 0 {
+		return nil, fmt.Errorf("%s lists no hooks ranges", metaURL)
+	}
+	networks := []*net.IPNet{}
+	for _, hooks := range meta.Hooks {
+		network, err := parseNetwork(hooks)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// deliverySource is the address a delivery came from: the last X-Forwarded-For address, added by the ingress in
+// front of the eventlistener, as the eventlistener passes the delivery's headers on, else the caller's address
+func deliverySource(request *http.Request) string {
+	if forwarded := request.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addresses := strings.Split(forwarded, ",")
+		return strings.TrimSpace(addresses[len(addresses)-1])
+	}
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		return host
+	}
+	return request.RemoteAddr
+}
+
+// allows is whether deliveries from source are accepted, always true if no allowed sources are set
+func (a *deliveryAllowlist) allows(source string) bool {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	if !a.enabled {
+		return true
+	}
+	ip := net.ParseIP(source)
+	if ip == nil {
+		return false
+	}
+	for _, networks := range [][]*net.IPNet{a.static, a.fetched} {
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAllowedSources(t *testing.T) {
+	networks, fetchGitHub, err := parseAllowedSources("github, 10.0.0.0/8, 192.168.1.5,2001:db8::/32")
+	if err != nil {
+		t.Fatalf("error parsing allowed sources: %s", err.Error())
+	}
+	if !fetchGitHub || len(networks) != 3 {
+		t.Errorf("expected github and 3 networks, got %t and %v", fetchGitHub, networks)
+	}
+	if _, _, err := parseAllowedSources("gitlab.com"); err == nil {
+		t.Error("expected an error for a source that isn't github, an address or a range")
+	}
+}
+
+func TestDeliverySource(t *testing.T) {
+	request := httptest.NewRequest("POST", "/", nil)
+	request.RemoteAddr = "10.1.2.3:41234"
+	if source := deliverySource(request); source != "10.1.2.3" {
+		t.Errorf("source without X-Forwarded-For was %s", source)
+	}
+	// The first address is the caller's to choose, the last the ingress's
+	request.Header.Set("X-Forwarded-For", "140.82.112.1, 203.0.113.9")
+	if source := deliverySource(request); source != "203.0.113.9" {
+		t.Errorf("source with X-Forwarded-For was %s", source)
+	}
+}
+
+func TestAllowlistAllows(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"hooks": ["192.30.252.0/22", "2a0a:a440::/29"]}`))
+	}))
+	defer server.Close()
+	networks, err := fetchGitHubRanges(server.URL)
+	if err != nil {
+		t.Fatalf("error fetching ranges: %s", err.Error())
+	}
+	static, _, _ := parseAllowedSources("10.0.0.1")
+	allowlist := &deliveryAllowlist{enabled: true, static: static, fetched: networks}
+	tests := map[string]bool{
+		"192.30.252.10": true,
+		"2a0a:a440::1":  true,
+		"10.0.0.1":      true,
+		"10.0.0.2":      false,
+		"203.0.113.9":   false,
+		"not an ip":     false,
+	}
+	for source, allowed := range tests {
+		if allowlist.allows(source) != allowed {
+			t.Errorf("expected %s allowed %t", source, allowed)
+		}
+	}
+	if !(&deliveryAllowlist{}).allows("203.0.113.9") {
+		t.Error("deliveries were refused with no allowed sources set")
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Bitbucket Cloud deliveries are signed in X-Hub-Signature as GitHub's are, and name their event in X-Event-Key,
+// e.g. repo:push or pullrequest:created
+const bitbucketEventHeader = "X-Event-Key"
+
+// bitbucketActions are the pull request actions, as the extension names them, of Bitbucket's pull request events
+var bitbucketActions = map[string]string{
+	"pullrequest:created":   "opened",
+	"pullrequest:updated":   "synchronize",
+	"pullrequest:approved":  ApprovedAction,
+	"pullrequest:fulfilled": "merged",
+	"pullrequest:rejected":  "closed",
+}
+
+// bitbucketEvent holds the fields of Bitbucket's push and pull request payloads the interceptor reads
+type bitbucketEvent struct {
+	Repository struct {
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	} `json:"repository"`
+	Push struct {
+		Changes []struct {
+			New *struct {
+				// branch or tag
+				Type   string `json:"type"`
+				Name   string `json:"name"`
+				Target struct {
+					Hash string `json:"hash"`
+				} `json:"target"`
+			} `json:"new"`
+		} `json:"changes"`
+	} `json:"push"`
+	PullRequest struct {
+		ID     int `json:"id"`
+		Source struct {
+			Branch struct {
+				Name string `json:"name"`
+			} `json:"branch"`
+			Commit struct {
+				Hash string `json:"hash"`
+			} `json:"commit"`
+		} `json:"source"`
+	} `json:"pullrequest"`
+	Comment struct {
+		Content struct {
+			Raw string `json:"raw"`
+		} `json:"content"`
+	} `json:"comment"`
+}
+
+// isBitbucketHost returns whether deliveries for a repository on host come from Bitbucket Cloud
+func isBitbucketHost(host string) bool {
+	return strings.EqualFold(host, "bitbucket.org")
+}
+
+func HandleBitbucket(request *http.Request, writer http.ResponseWriter, foundTriggerName string, secret *corev1.Secret) ([]byte, error) {
+	payload, err := github.ValidatePayload(request, secret.Data["secretToken"])
+	if err != nil {
+		log.Printf("[%s] Validation FAIL (error %s validating payload)", foundTriggerName, err.Error())
+		return nil, err
+	}
+
+	eventKey := request.Header.Get(bitbucketEventHeader)
+	event := bitbucketEvent{}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Printf("[%s] Validation FAIL (error %s marshalling payload as JSON)", foundTriggerName, err.Error())
+		return nil, err
+	}
+
+	var id, action, ref, commit string
+	switch {
+	case eventKey == "repo:push":
+		if len(event.Push.Changes) == 0 || event.Push.Changes[0].New == nil {
+			log.Printf("[%s] Validation FAIL (push deletes a branch or tag)", foundTriggerName)
+			return nil, errors.New("Validator failed as the push has no new commits")
+		}
+		change := event.Push.Changes[0].New
+		ref, commit = "refs/heads/"+change.Name, change.Target.Hash
+		if change.Type == "tag" {
+			ref = "refs/tags/" + change.Name
+		}
+		id = commit
+	case eventKey == "pullrequest:comment_created":
+		if !isCommentCommand(event.Comment.Content.Raw) {
+			log.Printf("[%s] Validation FAIL (pull request comment is not a command)", foundTriggerName)
+			return nil, errors.New("Validator failed as comment is not a command")
+		}
+		action = CommentAction
+	case bitbucketActions[eventKey] != "":
+		action = bitbucketActions[eventKey]
+	default:
+		log.Printf("[%s] Validation FAIL (unsupported bitbucket event)", foundTriggerName)
+		return nil, fmt.Errorf("%s did not match any of the supported events", bitbucketEventHeader)
+	}
+	if strings.HasPrefix(eventKey, "pullrequest:") {
+		ref, commit = event.PullRequest.Source.Branch.Name, event.PullRequest.Source.Commit.Hash
+		id = strconv.Itoa(event.PullRequest.ID)
+	}
+
+	cloneURL := event.Repository.Links.HTML.Href
+	log.Printf("[%s] Repository URL coming in as JSON: %s", foundTriggerName, cloneURL)
+	log.Printf("[%s] Handling Bitbucket Event %s for %s", foundTriggerName, request.Header.Get("X-Request-UUID"), id)
+
+	validationPassed, err := Validate(request, cloneURL, bitbucketEventHeader, action, foundTriggerName)
+	if !validationPassed {
+		if err == nil {
+			err = errors.New("Validation Failed")
+		}
+		return nil, err
+	}
+
+	comment := ""
+	if action == CommentAction {
+		comment = event.Comment.Content.Raw
+	}
+	returnPayload, err := addRefBranchAndTag(payload, ref, commit, comment)
+	if err != nil {
+		log.Printf("[%s] Failed to add branch to payload processing Bitbucket event for %s. Error: %s", foundTriggerName, id, err.Error())
+		return nil, err
+	}
+	log.Printf("[%s] Validation PASS so writing response", foundTriggerName)
+	return returnPayload, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func bitbucketRequest(eventKey, payload, events, actions string) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(payload))
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(payload))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	request.Header.Set(bitbucketEventHeader, eventKey)
+	request.Header.Set(RequiredRepositoryHeader, "https://bitbucket.org/workspace/repo")
+	request.Header.Set(RequiredEventHeader, events)
+	if actions != "" {
+		request.Header.Set(RequiredActionsHeader, actions)
+	}
+	return request
+}
+
+func TestHandleBitbucket(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"secretToken": []byte("secret")}}
+	repository := `"repository": {"links": {"html": {"href": "https://bitbucket.org/workspace/repo"}}}`
+	pullRequest := `"pullrequest": {"id": 3, "source": {"branch": {"name": "feature"}, "commit": {"hash": "1234567890ab"}}}`
+	tests := []struct {
+		name     string
+		request  *http.Request
+		branch   string
+		tag      string
+		comment  string
+		rejected bool
+	}{
+		{
+			name: "push",
+			request: bitbucketRequest("repo:push", `{`+repository+`, "push": {"changes": [{"new": {"type": "branch", "name": "master", "target": {"hash": "abcdef0123456"}}}]}}`,
+				"push, repo:push", ""),
+			branch: "master",
+			tag:    "abcdef0",
+		},
+		{
+			name:    "pull request",
+			request: bitbucketRequest("pullrequest:created", `{`+repository+`, `+pullRequest+`}`, "pullrequest:created, pullrequest:updated", "opened, synchronize"),
+			branch:  "feature",
+			tag:     "1234567",
+		},
+		{
+			name: "comment command",
+			request: bitbucketRequest("pullrequest:comment_created", `{`+repository+`, `+pullRequest+`, "comment": {"content": {"raw": "/test"}}}`,
+				"pullrequest:comment_created", CommentAction),
+			branch:  "feature",
+			tag:     "1234567",
+			comment: "/test",
+		},
+		{
+			name:     "branch deleted",
+			request:  bitbucketRequest("repo:push", `{`+repository+`, "push": {"changes": [{"new": null}]}}`, "repo:push", ""),
+			rejected: true,
+		},
+		{
+			name:     "action not wanted",
+			request:  bitbucketRequest("pullrequest:rejected", `{`+repository+`, `+pullRequest+`}`, "pullrequest:rejected", "opened"),
+			rejected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := HandleBitbucket(tt.request, httptest.NewRecorder(), "trigger", secret)
+			if tt.rejected {
+				if err == nil {
+					t.Error("expected the event to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error handling event: %s", err.Error())
+			}
+			fields := make(map[string]interface{})
+			if err := json.Unmarshal(payload, &fields); err != nil {
+				t.Fatalf("error reading %s: %s", string(payload), err.Error())
+			}
+			if fields["webhooks-tekton-git-branch"] != tt.branch || fields["webhooks-tekton-image-tag"] != tt.tag {
+				t.Errorf("unexpected branch %v and tag %v", fields["webhooks-tekton-git-branch"], fields["webhooks-tekton-image-tag"])
+			}
+			if tt.comment != "" && fields[commentField] != tt.comment {
+				t.Errorf("expected the comment %s, got %v", tt.comment, fields[commentField])
+			}
+		})
+	}
+}
+
+func TestHandleBitbucketBadSignature(t *testing.T) {
+	request := bitbucketRequest("repo:push", `{}`, "repo:push", "")
+	request.Header.Set("X-Hub-Signature", "sha256=00")
+	secret := &corev1.Secret{Data: map[string][]byte{"secretToken": []byte("secret")}}
+	if _, err := HandleBitbucket(request, httptest.NewRecorder(), "trigger", secret); err == nil {
+		t.Error("expected the unsigned event to be rejected")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// Set by the extension on the triggers of a webhook with a canary, primary or canary
+	CanaryRouteHeader = "Wext-Canary-Route"
+	// The percentage of events sent to the canary triggers
+	CanaryPercentageHeader = "Wext-Canary-Percentage"
+	// Pull requests with this label are sent to the canary triggers
+	CanaryLabelHeader = "Wext-Canary-Label"
+)
+
+// canaryLabels are where GitHub and GitLab put the labels of a pull or merge request
+type canaryLabels struct {
+	PullRequest struct {
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+	} `json:"pull_request"`
+	Labels []struct {
+		Title string `json:"title"`
+	} `json:"labels"`
+}
+
+// routedHere reports whether a trigger should accept the event. Primary and canary
+// triggers see the same payload so exactly one of them accepts each event.
+func routedHere(header http.Header, payload []byte) bool {
+	route := header.Get(CanaryRouteHeader)
+	if route == "" {
+		return true
+	}
+	return isCanary(header, payload) == (route == "canary")
+}
+
+func otherRoute(route string) string {
+	if route == "canary" {
+		return "primary"
+	}
+	return "canary"
+}
+
+func isCanary(header http.Header, payload []byte) bool {
+	if label := header.Get(CanaryLabelHeader); label != "" && hasLabel(payload, label) {
+		return true
+	}
+	percentage, _ := strconv.Atoi(header.Get(CanaryPercentageHeader))
+	return canaryBucket(payload) < percentage
+}
+
+// canaryBucket places a payload in one of 100 buckets
+func canaryBucket(payload []byte) int {
+	digest := sha256.Sum256(payload)
+	return int(binary.BigEndian.Uint32(digest[:4]) % 100)
+}
+
+func hasLabel(payload []byte, label string) bool {
+	labels := canaryLabels{}
+	if err := json.Unmarshal(payload, &labels); err != nil {
+		return false
+	}
+	for _, l := range labels.PullRequest.Labels {
+		if l.Name == label {
+			return true
+		}
+	}
+	for _, l := range labels.Labels {
+		if l.Title == label {
+			return true
+		}
+	}
+	return false
+}
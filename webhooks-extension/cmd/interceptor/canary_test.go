@@ -0,0 +1,69 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func canaryHeader(route, percentage, label string) http.Header {
+	header := http.Header{}
+	header.Set(CanaryRouteHeader, route)
+	header.Set(CanaryPercentageHeader, percentage)
+	if label != "" {
+		header.Set(CanaryLabelHeader, label)
+	}
+	return header
+}
+
+func TestRoutedHereOnExactlyOneTrigger(t *testing.T) {
+	canaries := 0
+	for i := 0; i < 1000; i++ {
+		payload := []byte(fmt.Sprintf(`{"after":"%d"}`, i))
+		primary := routedHere(canaryHeader("primary", "20", ""), payload)
+		canary := routedHere(canaryHeader("canary", "20", ""), payload)
+		if primary == canary {
+			t.Fatalf("payload %s routed to primary %t and canary %t", payload, primary, canary)
+		}
+		if canary {
+			canaries++
+		}
+	}
+	// Roughly 20% of events should be canaries
+	if canaries < 150 || canaries > 250 {
+		t.Errorf("%d of 1000 events routed to the canary, expected about 200", canaries)
+	}
+}
+
+func TestRoutedHereByLabel(t *testing.T) {
+	github := []byte(`{"action":"opened","pull_request":{"labels":[{"name":"try-new-pipeline"}]}}`)
+	gitlab := []byte(`{"object_kind":"merge_request","labels":[{"title":"try-new-pipeline"}]}`)
+	unlabelled := []byte(`{"action":"opened","pull_request":{"labels":[]}}`)
+	for _, payload := range [][]byte{github, gitlab} {
+		if !routedHere(canaryHeader("canary", "0", "try-new-pipeline"), payload) || routedHere(canaryHeader("primary", "0", "try-new-pipeline"), payload) {
+			t.Errorf("labelled payload %s not routed to the canary", payload)
+		}
+	}
+	if routedHere(canaryHeader("canary", "0", "try-new-pipeline"), unlabelled) {
+		t.Error("unlabelled payload routed to the canary")
+	}
+}
+
+func TestRoutedHereWithoutCanary(t *testing.T) {
+	if !routedHere(http.Header{}, []byte(`{}`)) {
+		t.Error("event rejected by a webhook without a canary")
+	}
+}
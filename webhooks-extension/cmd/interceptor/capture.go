@@ -0,0 +1,130 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Set by the extension on the triggers of a webhook capturing its payloads
+	CaptureHeader = "Wext-Capture-Payload"
+	// Prefix of the Secrets captured payloads are kept in, after RESOURCE_NAME_PREFIX as in the extension
+	capturePrefix = "payload-"
+	// Used if PAYLOAD_CAPTURE_MAX_BYTES isn't set, Secrets holding at most 1MiB
+	defaultCaptureMaxBytes = 256 * 1024
+	captureLabel           = "webhooks.tekton.dev/payload-capture"
+	captureTriggerKey      = "webhooks.tekton.dev/trigger"
+	captureDeliveryKey     = "webhooks.tekton.dev/delivery"
+	captureTimeKey         = "webhooks.tekton.dev/captured-at"
+	captureSizeKey         = "webhooks.tekton.dev/payload-size"
+	capturedPayloadKey     = "payload"
+	capturedHeadersKey     = "headers"
+	redactedHeader         = "[REDACTED]"
+)
+
+// Delivery headers holding the webhook's secret or a signature made with it
+var secretHeaders = []string{"X-Hub-Signature", "X-Hub-Signature-256", "X-Gitlab-Token", "Authorization", "Cookie"}
+
+// captureName names the Secret the payload of a delivery to a trigger is kept in, the extension naming it alike
+func captureName(resourcePrefix, trigger, deliveryID string) string {
+	sum := sha256.Sum256([]byte(trigger + "/" + deliveryID))
+	return resourcePrefix + capturePrefix + hex.EncodeToString(sum[:])[:20]
+}
+
+// capturedHeaders returns the headers the provider sent, without those the extension set on the trigger
+// and with those holding secrets redacted
+func capturedHeaders(header http.Header) map[string]string {
+	captured := map[string]string{}
+	for name := range header {
+		if strings.HasPrefix(name, "Wext-") {
+			continue
+		}
+		captured[name] = header.Get(name)
+	}
+	for _, name := range secretHeaders {
+		if _, found := captured[http.CanonicalHeaderKey(name)]; found {
+			captured[http.CanonicalHeaderKey(name)] = redactedHeader
+		}
+	}
+	return captured
+}
+
+func getCaptureMaxBytes() int {
+	if maxBytes, err := strconv.Atoi(os.Getenv("PAYLOAD_CAPTURE_MAX_BYTES")); err == nil && maxBytes >= 0 {
+		return maxBytes
+	}
+	return defaultCaptureMaxBytes
+}
+
+// capturePayload keeps the payload of an accepted delivery as it was sent, with its headers, in a Secret the
+// extension serves and deletes once PAYLOAD_CAPTURE_TTL is over. Only the headers and size are kept of a
+// payload larger than PAYLOAD_CAPTURE_MAX_BYTES.
+func capturePayload(clientset kubernetes.Interface, namespace, foundTriggerName, deliveryID string, headers map[string]string, payload []byte) {
+	if deliveryID == "" {
+		log.Printf("[%s] Not capturing the payload of a delivery with no delivery ID", foundTriggerName)
+		return
+	}
+	resourcePrefix := os.Getenv("RESOURCE_NAME_PREFIX")
+	if resourcePrefix == "" {
+		resourcePrefix = defaultResourcePrefix
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		log.Printf("[%s] Error marshalling the headers of delivery %s: %s", foundTriggerName, deliveryID, err.Error())
+		return
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      captureName(resourcePrefix, foundTriggerName, deliveryID),
+			Namespace: namespace,
+			Labels:    map[string]string{captureLabel: "true"},
+			Annotations: map[string]string{
+				captureTriggerKey:  foundTriggerName,
+				captureDeliveryKey: deliveryID,
+				captureTimeKey:     time.Now().UTC().Format(time.RFC3339),
+				captureSizeKey:     strconv.Itoa(len(payload)),
+			},
+		},
+		Data: map[string][]byte{capturedHeadersKey: headersJSON},
+	}
+	if len(payload) <= getCaptureMaxBytes() {
+		secret.Data[capturedPayloadKey] = payload
+	} else {
+		log.Printf("[%s] Not capturing the %d byte payload of delivery %s, larger than %d bytes", foundTriggerName, len(payload), deliveryID, getCaptureMaxBytes())
+	}
+	_, err = clientset.CoreV1().Secrets(namespace).Create(secret)
+	if k8serrors.IsAlreadyExists(err) {
+		// Redelivered
+		_, err = clientset.CoreV1().Secrets(namespace).Update(secret)
+	}
+	if err != nil {
+		log.Printf("[%s] Error capturing the payload of delivery %s: %s", foundTriggerName, deliveryID, err.Error())
+		return
+	}
+	log.Printf("[%s] Captured the payload of delivery %s", foundTriggerName, deliveryID)
+}
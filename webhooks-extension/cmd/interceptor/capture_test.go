@@ -0,0 +1,83 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCapturedHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Github-Event", "push")
+	header.Set("X-Hub-Signature", "sha1=abc")
+	header.Set("Wext-Secret-Name", "token")
+	captured := capturedHeaders(header)
+	if captured["X-Github-Event"] != "push" {
+		t.Errorf("X-Github-Event was %q", captured["X-Github-Event"])
+	}
+	if captured["X-Hub-Signature"] != redactedHeader {
+		t.Errorf("X-Hub-Signature was not redacted: %q", captured["X-Hub-Signature"])
+	}
+	if _, found := captured["Wext-Secret-Name"]; found {
+		t.Error("the extension's Wext-Secret-Name header was captured")
+	}
+}
+
+func TestCapturePayload(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset()
+	payload := []byte(`{"ref":"refs/heads/master"}`)
+	headers := map[string]string{"X-Github-Event": "push"}
+	capturePayload(clientset, "tekton-pipelines", "hook-push-event", "1234", headers, payload)
+	// Redelivered
+	capturePayload(clientset, "tekton-pipelines", "hook-push-event", "1234", headers, payload)
+
+	secret, err := clientset.CoreV1().Secrets("tekton-pipelines").Get(captureName(defaultResourcePrefix, "hook-push-event", "1234"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting the captured payload: %s", err.Error())
+	}
+	if string(secret.Data[capturedPayloadKey]) != string(payload) {
+		t.Errorf("payload was %s", string(secret.Data[capturedPayloadKey]))
+	}
+	captured := map[string]string{}
+	if err := json.Unmarshal(secret.Data[capturedHeadersKey], &captured); err != nil || captured["X-Github-Event"] != "push" {
+		t.Errorf("headers were %s", string(secret.Data[capturedHeadersKey]))
+	}
+	if secret.Annotations[captureDeliveryKey] != "1234" || secret.Labels[captureLabel] != "true" {
+		t.Errorf("unexpected metadata %v %v", secret.Labels, secret.Annotations)
+	}
+}
+
+func TestCapturePayloadTooLarge(t *testing.T) {
+	os.Setenv("PAYLOAD_CAPTURE_MAX_BYTES", "10")
+	defer os.Unsetenv("PAYLOAD_CAPTURE_MAX_BYTES")
+	clientset := fakek8sclientset.NewSimpleClientset()
+	capturePayload(clientset, "tekton-pipelines", "hook-push-event", "1234", map[string]string{}, []byte(`{"ref":"refs/heads/master"}`))
+
+	secret, err := clientset.CoreV1().Secrets("tekton-pipelines").Get(captureName(defaultResourcePrefix, "hook-push-event", "1234"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting the captured payload: %s", err.Error())
+	}
+	if _, found := secret.Data[capturedPayloadKey]; found {
+		t.Error("a payload larger than PAYLOAD_CAPTURE_MAX_BYTES was captured")
+	}
+	if secret.Annotations[captureSizeKey] != "27" {
+		t.Errorf("size was %s", secret.Annotations[captureSizeKey])
+	}
+}
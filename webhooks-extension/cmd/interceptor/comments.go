@@ -0,0 +1,315 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Actions the extension sets on pull request triggers for comment commands and approvals
+	CommentAction  = "comment"
+	ApprovedAction = "approved"
+	// Payload field holding the comment that triggered the run
+	commentField = "webhooks-tekton-comment"
+	// Least GitLab access level, developer, that may run comment commands
+	gitLabDeveloperAccess = 30
+)
+
+// Comments starting with one of these rerun the pull request's pipelines
+var commentCommands = []string{"/test", "/retest"}
+
+func isCommentCommand(comment string) bool {
+	fields := strings.Fields(comment)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, command := range commentCommands {
+		if fields[0] == command {
+			return true
+		}
+	}
+	return false
+}
+
+type glMergeComment struct {
+	ObjectAttributes struct {
+		Note string `json:"note"`
+		URL  string `json:"url"`
+	} `json:"object_attributes"`
+	MergeRequest map[string]interface{} `json:"merge_request"`
+}
+
+// mergeCommentPayload returns a GitLab merge request comment payload in the form of a merge
+// request payload, the merge request as object_attributes, so the merge request TriggerBindings
+// work for comment commands too. The comment is added as webhooks-tekton-comment.
+func mergeCommentPayload(payload []byte) ([]byte, error) {
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	comment := glMergeComment{}
+	if err := json.Unmarshal(payload, &comment); err != nil {
+		return nil, err
+	}
+	if comment.MergeRequest == nil {
+		return nil, errors.New("comment is not on a merge request")
+	}
+	if _, found := comment.MergeRequest["url"]; !found {
+		// The comment's url is the merge request's with the note as the fragment
+		comment.MergeRequest["url"] = strings.Split(comment.ObjectAttributes.URL, "#")[0]
+	}
+
+	targetBranch, _ := comment.MergeRequest["target_branch"].(string)
+	lastCommit, _ := comment.MergeRequest["last_commit"].(map[string]interface{})
+	commitID, _ := lastCommit["id"].(string)
+	if len(commitID) < 7 {
+		return nil, errors.New("merge request has no last commit")
+	}
+
+	fields["object_kind"] = "merge_request"
+	fields["object_attributes"] = comment.MergeRequest
+	fields[commentField] = comment.ObjectAttributes.Note
+	fields["webhooks-tekton-git-branch"] = targetBranch
+	fields["webhooks-tekton-image-tag"] = getSuggestedTag(targetBranch, commitID)
+	return json.Marshal(fields)
+}
+
+// pullRequestCommand holds the fields of GitLab and Bitbucket comment and approval payloads read to check them
+type pullRequestCommand struct {
+	// GitLab
+	ObjectKind string `json:"object_kind"`
+	User       struct {
+		ID int64 `json:"id"`
+	} `json:"user"`
+	Project struct {
+		ID int64 `json:"id"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID    int    `json:"iid"`
+		Action string `json:"action"`
+	} `json:"object_attributes"`
+	MergeRequest struct {
+		IID int `json:"iid"`
+	} `json:"merge_request"`
+	// Bitbucket
+	Actor struct {
+		UUID string `json:"uuid"`
+	} `json:"actor"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	PullRequest struct {
+		Destination struct {
+			Branch struct {
+				Name string `json:"name"`
+			} `json:"branch"`
+		} `json:"destination"`
+		Participants []struct {
+			Approved bool `json:"approved"`
+		} `json:"participants"`
+	} `json:"pullrequest"`
+}
+
+// pullRequestCommandAllowed returns whether a comment command or approval may run the trigger, and if not why.
+// Comment commands are only taken from those with at least developer access to a GitLab project or write access
+// to a Bitbucket repository. A trigger that requires approval, its actions starting with approved, only runs on a
+// comment command or approval once the pull request has as many approvals as the provider requires to merge it, and
+// at least one. Other events are allowed.
+func pullRequestCommandAllowed(header http.Header, provider, event string, payload []byte, repoURL *url.URL, secret *corev1.Secret) (bool, string, error) {
+	switch {
+	case provider == "gitlab" && (event == "Note Hook" || event == "Merge Request Hook"):
+	case provider == "bitbucket" && (event == "pullrequest:comment_created" || event == "pullrequest:approved"):
+	default:
+		return true, "", nil
+	}
+	command := pullRequestCommand{}
+	if err := json.Unmarshal(payload, &command); err != nil {
+		return false, "", err
+	}
+	comment := (provider == "gitlab" && event == "Note Hook") || (provider == "bitbucket" && event == "pullrequest:comment_created")
+	approval := (provider == "gitlab" && event == "Merge Request Hook" && command.ObjectAttributes.Action == ApprovedAction) ||
+		(provider == "bitbucket" && event == "pullrequest:approved")
+	if !comment && !approval {
+		return true, "", nil
+	}
+
+	if comment {
+		allowed, err := commenterAllowed(provider, command, repoURL, secret)
+		if err != nil {
+			return false, "", err
+		}
+		if !allowed {
+			return false, "the commenter may not run comment commands on the repository", nil
+		}
+	}
+	if !strings.HasPrefix(header.Get(RequiredActionsHeader), ApprovedAction) {
+		return true, "", nil
+	}
+	approved, err := pullRequestApproved(provider, command, repoURL, secret)
+	if err != nil {
+		return false, "", err
+	}
+	if !approved {
+		return false, "the pull request does not have the approvals required to merge it", nil
+	}
+	return true, "", nil
+}
+
+// commenterAllowed returns whether the commenter has at least developer access to the GitLab project or write access
+// to the Bitbucket repository, looked up with the webhook's access token and remembered as memberships are
+func commenterAllowed(provider string, command pullRequestCommand, repoURL *url.URL, secret *corev1.Secret) (bool, error) {
+	commenter := strconv.FormatInt(command.User.ID, 10)
+	if provider == "bitbucket" {
+		commenter = command.Actor.UUID
+	}
+	key := strings.Join([]string{repoURL.Host, provider, "commenter", repoURL.Path, commenter}, "\n")
+	membershipsLock.Lock()
+	known, found := memberships[key]
+	membershipsLock.Unlock()
+	if found && time.Since(known.checked) <= membershipTTL {
+		return known.member, nil
+	}
+
+	allowed := false
+	if provider == "gitlab" {
+		member := struct {
+			AccessLevel int `json:"access_level"`
+		}{}
+		address := fmt.Sprintf("%s/projects/%d/members/all/%s", gitAPIURL(provider, repoURL), command.Project.ID, commenter)
+		found, err := providerGet(provider, address, secret, &member)
+		if err != nil {
+			return false, fmt.Errorf("error looking up the access of the commenter: %s", err)
+		}
+		allowed = found && member.AccessLevel >= gitLabDeveloperAccess
+	} else {
+		permissions := struct {
+			Values []struct {
+				Permission string `json:"permission"`
+			} `json:"values"`
+		}{}
+		workspace := strings.SplitN(command.Repository.FullName, "/", 2)
+		if len(workspace) != 2 {
+			return false, fmt.Errorf("repository %s is not <workspace>/<repo>", command.Repository.FullName)
+		}
+		address := fmt.Sprintf("%s/workspaces/%s/permissions/repositories/%s?q=%s", gitAPIURL(provider, repoURL), url.PathEscape(workspace[0]),
+			url.PathEscape(workspace[1]), url.QueryEscape(fmt.Sprintf("user.uuid=%q", commenter)))
+		if _, err := providerGet(provider, address, secret, &permissions); err != nil {
+			return false, fmt.Errorf("error looking up the permission of the commenter: %s", err)
+		}
+		for _, value := range permissions.Values {
+			if value.Permission == "write" || value.Permission == "admin" {
+				allowed = true
+			}
+		}
+	}
+
+	membershipsLock.Lock()
+	memberships[key] = membership{member: allowed, checked: time.Now()}
+	membershipsLock.Unlock()
+	return allowed, nil
+}
+
+// pullRequestApproved returns whether a GitLab merge request has no approvals left and at least one, or a Bitbucket
+// pull request as many approvals as the branch restrictions on its destination branch require, and at least one
+func pullRequestApproved(provider string, command pullRequestCommand, repoURL *url.URL, secret *corev1.Secret) (bool, error) {
+	if provider == "gitlab" {
+		iid := command.ObjectAttributes.IID
+		if command.ObjectKind == "note" {
+			iid = command.MergeRequest.IID
+		}
+		approvals := struct {
+			ApprovalsLeft int               `json:"approvals_left"`
+			ApprovedBy    []json.RawMessage `json:"approved_by"`
+		}{}
+		address := fmt.Sprintf("%s/projects/%d/merge_requests/%d/approvals", gitAPIURL(provider, repoURL), command.Project.ID, iid)
+		if found, err := providerGet(provider, address, secret, &approvals); err != nil || !found {
+			return false, fmt.Errorf("error getting the approvals of merge request %d: %v", iid, err)
+		}
+		return approvals.ApprovalsLeft == 0 && len(approvals.ApprovedBy) > 0, nil
+	}
+
+	restrictions := struct {
+		Values []struct {
+			Value           int    `json:"value"`
+			Pattern         string `json:"pattern"`
+			BranchMatchKind string `json:"branch_match_kind"`
+		} `json:"values"`
+	}{}
+	address := fmt.Sprintf("%s/repositories/%s/branch-restrictions?kind=require_approvals_to_merge&pagelen=100", gitAPIURL(provider, repoURL),
+		command.Repository.FullName)
+	if _, err := providerGet(provider, address, secret, &restrictions); err != nil {
+		return false, fmt.Errorf("error getting the branch restrictions of %s: %s", command.Repository.FullName, err)
+	}
+	required := 1
+	branch := command.PullRequest.Destination.Branch.Name
+	for _, restriction := range restrictions.Values {
+		// Restrictions by branch type can't be matched from the payload, so are taken to apply
+		matches := restriction.BranchMatchKind != "glob"
+		if !matches {
+			matches, _ = path.Match(restriction.Pattern, branch)
+		}
+		if matches && restriction.Value > required {
+			required = restriction.Value
+		}
+	}
+	approvals := 0
+	for _, participant := range command.PullRequest.Participants {
+		if participant.Approved {
+			approvals++
+		}
+	}
+	return approvals >= required, nil
+}
+
+// providerGet gets address from the GitLab or Bitbucket API with the webhook's access token, or username and
+// password, decoding the response into result. It returns false if there is nothing at address.
+func providerGet(provider, address string, secret *corev1.Secret, result interface{}) (bool, error) {
+	request, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return false, err
+	}
+	token := string(secret.Data["accessToken"])
+	switch {
+	case provider == "gitlab":
+		request.Header.Set("PRIVATE-TOKEN", token)
+	case len(secret.Data["username"]) > 0:
+		request.SetBasicAuth(string(secret.Data["username"]), string(secret.Data["password"]))
+	default:
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := http.Client{Timeout: membershipTimeout}
+	resp, err := client.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("responded with status %d", resp.StatusCode)
+	}
+	return true, json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,163 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestIsCommentCommand(t *testing.T) {
+	comments := map[string]bool{
+		"/test":                   true,
+		"/retest please":          true,
+		"  /retest\nflaky again":  true,
+		"looks good to me":        false,
+		"please /retest":          false,
+		"/testing something else": false,
+		"":                        false,
+	}
+	for comment, expected := range comments {
+		if isCommentCommand(comment) != expected {
+			t.Errorf("isCommentCommand(%q) was %t, expected %t", comment, !expected, expected)
+		}
+	}
+}
+
+func TestMergeCommentPayload(t *testing.T) {
+	payload := `{
+		"object_kind": "note",
+		"project": {"id": 5, "git_http_url": "https://gitlab.com/foo/bar.git"},
+		"object_attributes": {"note": "/retest", "noteable_type": "MergeRequest", "url": "https://gitlab.com/foo/bar/merge_requests/1#note_42"},
+		"merge_request": {"id": 7, "iid": 1, "target_branch": "master", "last_commit": {"id": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7"}}
+	}`
+	converted, err := mergeCommentPayload([]byte(payload))
+	if err != nil {
+		t.Fatalf("error converting comment payload: %s", err.Error())
+	}
+	result := struct {
+		ObjectKind       string `json:"object_kind"`
+		ObjectAttributes struct {
+			IID        int    `json:"iid"`
+			URL        string `json:"url"`
+			LastCommit struct {
+				ID string `json:"id"`
+			} `json:"last_commit"`
+		} `json:"object_attributes"`
+		Project struct {
+			ID int `json:"id"`
+		} `json:"project"`
+		Comment  string `json:"webhooks-tekton-comment"`
+		Branch   string `json:"webhooks-tekton-git-branch"`
+		ImageTag string `json:"webhooks-tekton-image-tag"`
+	}{}
+	if err := json.Unmarshal(converted, &result); err != nil {
+		t.Fatalf("error reading converted payload: %s", err.Error())
+	}
+	if result.ObjectKind != "merge_request" || result.ObjectAttributes.IID != 1 || result.Project.ID != 5 {
+		t.Errorf("payload was not converted to a merge request payload: %s", string(converted))
+	}
+	if result.ObjectAttributes.URL != "https://gitlab.com/foo/bar/merge_requests/1" {
+		t.Errorf("merge request url was %s", result.ObjectAttributes.URL)
+	}
+	if result.ObjectAttributes.LastCommit.ID != "da1560886d4f094c3e6c9ef40349f7d38b5d27d7" {
+		t.Errorf("last commit was %s", result.ObjectAttributes.LastCommit.ID)
+	}
+	if result.Comment != "/retest" || result.Branch != "master" || result.ImageTag != "da15608" {
+		t.Errorf("comment, branch and image tag were %s, %s and %s", result.Comment, result.Branch, result.ImageTag)
+	}
+
+	if _, err := mergeCommentPayload([]byte(`{"object_attributes": {"note": "/retest"}}`)); err == nil {
+		t.Error("expected an error for a comment that is not on a merge request")
+	}
+}
+
+func TestPullRequestCommandAllowed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/projects/7/members/all/1":
+			w.Write([]byte(`{"access_level": 30}`))
+		case "/api/v4/projects/7/members/all/2":
+			w.Write([]byte(`{"access_level": 20}`))
+		case "/api/v4/projects/7/merge_requests/3/approvals":
+			w.Write([]byte(`{"approvals_left": 1, "approved_by": [{"user": {"id": 1}}]}`))
+		case "/2.0/workspaces/workspace/permissions/repositories/repo":
+			if r.URL.Query().Get("q") == `user.uuid="{writer}"` {
+				w.Write([]byte(`{"values": [{"permission": "write"}]}`))
+				return
+			}
+			w.Write([]byte(`{"values": [{"permission": "read"}]}`))
+		case "/2.0/repositories/workspace/repo/branch-restrictions":
+			w.Write([]byte(`{"values": [{"value": 2, "pattern": "main", "branch_match_kind": "glob"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	repoURL, _ := url.Parse(server.URL + "/owner/repo")
+	secret := &corev1.Secret{Data: map[string][]byte{"accessToken": []byte("access")}}
+	opened := http.Header{RequiredActionsHeader: []string{"opened,reopened,synchronize,comment"}}
+	approval := http.Header{RequiredActionsHeader: []string{"approved,comment"}}
+
+	gitLabComment := func(user string) []byte {
+		return []byte(`{"object_kind": "note", "user": {"id": ` + user + `}, "project": {"id": 7}, "merge_request": {"iid": 3}}`)
+	}
+	bitbucketComment := func(user string, approvals int) []byte {
+		participants := ""
+		for i := 0; i < approvals; i++ {
+			if i > 0 {
+				participants += ","
+			}
+			participants += `{"approved": true}`
+		}
+		return []byte(`{"actor": {"uuid": "` + user + `"}, "repository": {"full_name": "workspace/repo"},
+			"pullrequest": {"destination": {"branch": {"name": "main"}}, "participants": [` + participants + `]}}`)
+	}
+	tests := []struct {
+		name     string
+		header   http.Header
+		provider string
+		event    string
+		payload  []byte
+		allowed  bool
+	}{
+		{"gitlab developer", opened, "gitlab", "Note Hook", gitLabComment("1"), true},
+		{"gitlab reporter", opened, "gitlab", "Note Hook", gitLabComment("2"), false},
+		{"gitlab not a member", opened, "gitlab", "Note Hook", gitLabComment("3"), false},
+		{"gitlab developer, approvals left", approval, "gitlab", "Note Hook", gitLabComment("1"), false},
+		{"gitlab approval, approvals left", approval, "gitlab", "Merge Request Hook",
+			[]byte(`{"object_kind": "merge_request", "project": {"id": 7}, "object_attributes": {"iid": 3, "action": "approved"}}`), false},
+		{"gitlab opened", approval, "gitlab", "Merge Request Hook", []byte(`{"object_attributes": {"action": "open"}}`), true},
+		{"bitbucket writer", opened, "bitbucket", "pullrequest:comment_created", bitbucketComment("{writer}", 0), true},
+		{"bitbucket reader", opened, "bitbucket", "pullrequest:comment_created", bitbucketComment("{reader}", 2), false},
+		{"bitbucket approval, one of two", approval, "bitbucket", "pullrequest:approved", bitbucketComment("{writer}", 1), false},
+		{"bitbucket approval, two of two", approval, "bitbucket", "pullrequest:approved", bitbucketComment("{writer}", 2), true},
+		{"github comment", opened, "github", "issue_comment", []byte(`{}`), true},
+	}
+	for _, tt := range tests {
+		allowed, reason, err := pullRequestCommandAllowed(tt.header, tt.provider, tt.event, tt.payload, repoURL, secret)
+		if err != nil {
+			t.Errorf("%s: error checking the command: %s", tt.name, err.Error())
+			continue
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: allowed was %t (%s), expected %t", tt.name, allowed, reason, tt.allowed)
+		}
+	}
+}
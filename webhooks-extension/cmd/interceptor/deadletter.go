@@ -0,0 +1,139 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Set by the extension on the triggers of a webhook with a dead letter URL
+	DeadLetterHeader = "Wext-Dead-Letter-Url"
+	// Time a failure is remembered for so each trigger failing on the same delivery reports it once
+	deadLetterTTL     = 5 * time.Minute
+	deadLetterTimeout = 10 * time.Second
+)
+
+// deadLetter is posted to a webhook's dead letter URL when the interceptor fails on an event
+type deadLetter struct {
+	Stage      string `json:"stage"`
+	Trigger    string `json:"trigger"`
+	Repository string `json:"repository"`
+	Provider   string `json:"provider,omitempty"`
+	Event      string `json:"event,omitempty"`
+	DeliveryID string `json:"deliveryid,omitempty"`
+	Status     int    `json:"status"`
+	Error      string `json:"error"`
+	Time       string `json:"time"`
+}
+
+var (
+	deadLettersLock sync.Mutex
+	deadLetters     = make(map[string]time.Time)
+)
+
+// failureRecorder keeps the status and message of an error response
+type failureRecorder struct {
+	http.ResponseWriter
+	status  int
+	message bytes.Buffer
+}
+
+func (w *failureRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *failureRecorder) Write(b []byte) (int, error) {
+	if w.status >= http.StatusBadRequest {
+		w.message.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// reportDeadLetter posts the failure to the trigger's dead letter URL, if it has one, when the
+// interceptor responded with an error. Validation failures (417) are how the interceptor turns
+// away events meant for other triggers so are not reported, nor are simulations.
+func reportDeadLetter(writer *failureRecorder, request *http.Request) {
+	deadLetterURL := request.Header.Get(DeadLetterHeader)
+	if deadLetterURL == "" || isDryRun(request.Header) || writer.status < http.StatusBadRequest || writer.status == http.StatusExpectationFailed {
+		return
+	}
+	letter := deadLetter{
+		Stage:      "interceptor",
+		Trigger:    request.Header.Get("Wext-Trigger-Name"),
+		Repository: request.Header.Get(RequiredRepositoryHeader),
+		Status:     writer.status,
+		Error:      strings.TrimSpace(writer.message.String()),
+		Time:       time.Now().UTC().Format(time.RFC3339),
+	}
+	switch {
+	case giteaHeaderPrefix(request.Header) != "":
+		prefix := giteaHeaderPrefix(request.Header)
+		letter.Provider, letter.Event, letter.DeliveryID = "gitea", request.Header.Get(prefix+"-Event"), request.Header.Get(prefix+"-Delivery")
+	case request.Header.Get("X-Github-Event") != "":
+		letter.Provider, letter.Event, letter.DeliveryID = "github", request.Header.Get("X-Github-Event"), request.Header.Get("X-Github-Delivery")
+	case request.Header.Get("X-Gitlab-Event") != "":
+		letter.Provider, letter.Event, letter.DeliveryID = "gitlab", request.Header.Get("X-Gitlab-Event"), request.Header.Get("X-Gitlab-Event-UUID")
+	}
+	if !firstDeadLetter(deadLetterURL, letter) {
+		return
+	}
+	go postDeadLetter(deadLetterURL, letter)
+}
+
+// firstDeadLetter records the failure, returning false if it was already reported recently
+func firstDeadLetter(deadLetterURL string, letter deadLetter) bool {
+	key := strings.Join([]string{deadLetterURL, letter.DeliveryID, letter.Error}, "\n")
+
+	deadLettersLock.Lock()
+	defer deadLettersLock.Unlock()
+	now := time.Now()
+	for k, seen := range deadLetters {
+		if now.Sub(seen) > deadLetterTTL {
+			delete(deadLetters, k)
+		}
+	}
+	if _, ok := deadLetters[key]; ok {
+		return false
+	}
+	deadLetters[key] = now
+	return true
+}
+
+func postDeadLetter(deadLetterURL string, letter deadLetter) {
+	body, err := json.Marshal(letter)
+	if err != nil {
+		log.Printf("[%s] Error marshalling dead letter: %s", letter.Trigger, err.Error())
+		return
+	}
+	client := http.Client{Timeout: deadLetterTimeout}
+	resp, err := client.Post(deadLetterURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[%s] Error posting dead letter to %s: %s", letter.Trigger, deadLetterURL, err.Error())
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[%s] Error posting dead letter to %s: status %d", letter.Trigger, deadLetterURL, resp.StatusCode)
+		return
+	}
+	log.Printf("[%s] Posted dead letter to %s", letter.Trigger, deadLetterURL)
+}
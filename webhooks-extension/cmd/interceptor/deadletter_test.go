@@ -0,0 +1,65 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReportDeadLetter(t *testing.T) {
+	letters := make(chan deadLetter, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		letter := deadLetter{}
+		if err := json.NewDecoder(r.Body).Decode(&letter); err != nil {
+			t.Errorf("dead letter was not JSON: %s", err.Error())
+		}
+		letters <- letter
+	}))
+	defer server.Close()
+
+	respond := func(trigger string, status int, message string) {
+		request := httptest.NewRequest("POST", "/", nil)
+		request.Header.Set(DeadLetterHeader, server.URL)
+		request.Header.Set("Wext-Trigger-Name", trigger)
+		request.Header.Set(RequiredRepositoryHeader, "https://github.com/foo/bar")
+		request.Header.Set("X-Github-Event", "push")
+		request.Header.Set("X-Github-Delivery", "1234")
+		writer := &failureRecorder{ResponseWriter: httptest.NewRecorder()}
+		http.Error(writer, message, status)
+		reportDeadLetter(writer, request)
+	}
+	// Both triggers for the repository fail on the same delivery
+	respond("hook-default-push-event", http.StatusBadRequest, "secrets \"token\" not found")
+	respond("hook-default-pullrequest-event", http.StatusBadRequest, "secrets \"token\" not found")
+	respond("hook-default-push-event", http.StatusExpectationFailed, "Validation Failed")
+
+	select {
+	case letter := <-letters:
+		if letter.Stage != "interceptor" || letter.Status != http.StatusBadRequest || letter.Error != "secrets \"token\" not found" ||
+			letter.Provider != "github" || letter.DeliveryID != "1234" || letter.Repository != "https://github.com/foo/bar" {
+			t.Errorf("unexpected dead letter %+v", letter)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no dead letter posted")
+	}
+	select {
+	case letter := <-letters:
+		t.Errorf("unexpected second dead letter %+v", letter)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
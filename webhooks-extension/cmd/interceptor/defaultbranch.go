@@ -0,0 +1,134 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// The repository's default branch as the extension last found it, set on all of a webhook's triggers
+	DefaultBranchHeader = "Wext-Default-Branch"
+	// Time a default branch change is remembered for so that every trigger for the repository seeing it asks
+	// for one refresh
+	defaultBranchChangeTTL      = 5 * time.Minute
+	defaultBranchRefreshTimeout = 2 * time.Minute
+)
+
+// defaultBranchEvent is the part of a GitHub or GitLab payload naming the repository's default branch
+type defaultBranchEvent struct {
+	Action string `json:"action"`
+	// GitHub
+	Repository struct {
+		DefaultBranch string `json:"default_branch"`
+		CloneURL      string `json:"clone_url"`
+	} `json:"repository"`
+	Changes struct {
+		DefaultBranch *struct {
+			From string `json:"from"`
+		} `json:"default_branch"`
+	} `json:"changes"`
+	// GitLab
+	Project struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+var (
+	defaultBranchChangesLock sync.Mutex
+	defaultBranchChanges     = make(map[string]time.Time)
+)
+
+// eventDefaultBranch is the repository's default branch named by the payload, or "" if it names none
+func eventDefaultBranch(payload []byte) string {
+	event := defaultBranchEvent{}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return ""
+	}
+	if event.Repository.DefaultBranch != "" {
+		return event.Repository.DefaultBranch
+	}
+	return event.Project.DefaultBranch
+}
+
+// firstDefaultBranchChange records the change, returning false if it was already seen recently
+func firstDefaultBranchChange(repoURL, branch string) bool {
+	key := sanitizeGitInput(repoURL) + "@" + branch
+	defaultBranchChangesLock.Lock()
+	defer defaultBranchChangesLock.Unlock()
+	now := time.Now()
+	for change, seen := range defaultBranchChanges {
+		if now.Sub(seen) > defaultBranchChangeTTL {
+			delete(defaultBranchChanges, change)
+		}
+	}
+	if _, ok := defaultBranchChanges[key]; ok {
+		return false
+	}
+	defaultBranchChanges[key] = now
+	return true
+}
+
+// refreshDefaultBranch asks the extension at DEFAULT_BRANCH_REFRESH_URL to look up the repository's default branch
+// again when the event names a different one than the trigger was given
+func refreshDefaultBranch(foundTriggerName string, header http.Header, repoURL string, payload []byte) {
+	refreshURL := os.Getenv("DEFAULT_BRANCH_REFRESH_URL")
+	branch := eventDefaultBranch(payload)
+	if refreshURL == "" || branch == "" || branch == header.Get(DefaultBranchHeader) || !firstDefaultBranchChange(repoURL, branch) {
+		return
+	}
+	body, err := json.Marshal(map[string]string{"gitrepositoryurl": repoURL})
+	if err != nil {
+		log.Printf("[%s] Error marshalling default branch refresh request: %s", foundTriggerName, err.Error())
+		return
+	}
+	client := http.Client{Timeout: defaultBranchRefreshTimeout}
+	resp, err := client.Post(refreshURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[%s] Error asking %s to refresh the default branch of %s: %s", foundTriggerName, refreshURL, repoURL, err.Error())
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[%s] Error asking %s to refresh the default branch of %s: status %d", foundTriggerName, refreshURL, repoURL, resp.StatusCode)
+		return
+	}
+	log.Printf("[%s] Refreshed the default branch of %s, now %s", foundTriggerName, repoURL, branch)
+}
+
+// handleRepository handles GitHub's repository events, asking for a refresh when one changes the default branch.
+// No pipeline runs for them so an error is always returned.
+func handleRepository(request *http.Request, foundTriggerName string, payload []byte) ([]byte, error) {
+	event := defaultBranchEvent{}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Printf("[%s] Validation FAIL (error %s marshalling payload as JSON)", foundTriggerName, err.Error())
+		return nil, err
+	}
+	if sanitizeGitInput(event.Repository.CloneURL) != sanitizeGitInput(request.Header.Get(RequiredRepositoryHeader)) {
+		log.Printf("[%s] Validation FAIL (repository URLs do not match, got %s but wanted %s)", foundTriggerName,
+			sanitizeGitInput(event.Repository.CloneURL), sanitizeGitInput(request.Header.Get(RequiredRepositoryHeader)))
+		return nil, errors.New("Validator failed as repository URLs do not match")
+	}
+	if event.Action == "edited" && event.Changes.DefaultBranch != nil && !isDryRun(request.Header) {
+		go refreshDefaultBranch(foundTriggerName, request.Header, event.Repository.CloneURL, payload)
+	}
+	return nil, errors.New("Repository event handled, no pipeline runs for it")
+}
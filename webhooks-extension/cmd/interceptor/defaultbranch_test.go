@@ -0,0 +1,65 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestRefreshDefaultBranch(t *testing.T) {
+	var lock sync.Mutex
+	requests := []map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		lock.Lock()
+		requests = append(requests, body)
+		lock.Unlock()
+	}))
+	defer server.Close()
+	os.Setenv("DEFAULT_BRANCH_REFRESH_URL", server.URL)
+	defer os.Unsetenv("DEFAULT_BRANCH_REFRESH_URL")
+
+	header := http.Header{}
+	header.Set(DefaultBranchHeader, "master")
+	unchanged := []byte(`{"ref":"refs/heads/master","repository":{"default_branch":"master"}}`)
+	changed := []byte(`{"ref":"refs/heads/main","project":{"default_branch":"main"}}`)
+	refreshDefaultBranch("hook-default-push-event", header, "https://gitlab.com/foo/bar", unchanged)
+	// Both triggers for the repository see the change
+	refreshDefaultBranch("hook-default-push-event", header, "https://gitlab.com/foo/bar", changed)
+	refreshDefaultBranch("hook-default-pullrequest-event", header, "https://gitlab.com/foo/bar", changed)
+	if len(requests) != 1 || requests[0]["gitrepositoryurl"] != "https://gitlab.com/foo/bar" {
+		t.Errorf("expected one refresh of https://gitlab.com/foo/bar, got %+v", requests)
+	}
+}
+
+func TestHandleRepository(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/", nil)
+	request.Header.Set(RequiredRepositoryHeader, "https://github.com/foo/bar")
+	edited := []byte(`{"action":"edited","changes":{"default_branch":{"from":"master"}},"repository":{"default_branch":"main","clone_url":"https://github.com/foo/bar.git"}}`)
+	if payload, err := handleRepository(request, "hook-default-push-event", edited); err == nil || payload != nil {
+		t.Error("expected no pipeline to run for a repository event")
+	}
+	if _, err := handleRepository(request, "hook-default-push-event", []byte(`{"repository":{"clone_url":"https://github.com/foo/other.git"}}`)); err == nil {
+		t.Error("expected an error for another repository's event")
+	}
+	if branch := eventDefaultBranch(edited); branch != "main" {
+		t.Errorf("expected the default branch main, got %s", branch)
+	}
+}
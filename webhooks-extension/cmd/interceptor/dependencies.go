@@ -0,0 +1,62 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Set by the extension on the trigger running a webhook's dependency update pipeline
+	DependencyRouteHeader = "Wext-Dependency-Route"
+	// The bots whose pull requests are dependency updates, set on all of the webhook's pull request triggers
+	DependencySendersHeader = "Wext-Dependency-Senders"
+)
+
+// pullRequestAuthor is who opened the pull request: its user on GitHub, and on GitLab, whose merge request events
+// only name the user acting on it, that user
+func pullRequestAuthor(provider string, payload []byte) string {
+	if provider == "github" {
+		fields := struct {
+			PullRequest struct {
+				User struct {
+					Login string `json:"login"`
+				} `json:"user"`
+			} `json:"pull_request"`
+		}{}
+		if err := json.Unmarshal(payload, &fields); err == nil && fields.PullRequest.User.Login != "" {
+			return fields.PullRequest.User.Login
+		}
+	}
+	return senderOf(provider, payload).Login
+}
+
+// dependencyRoutedHere reports whether a pull request trigger should accept the event: the trigger running the
+// dependency update pipeline accepts the pull requests of the bots, the webhook's other triggers all the others
+func dependencyRoutedHere(header http.Header, provider string, payload []byte) bool {
+	bots := splitSenders(header.Get(DependencySendersHeader))
+	if len(bots) == 0 {
+		return true
+	}
+	author := pullRequestAuthor(provider, payload)
+	isUpdate := false
+	for _, bot := range bots {
+		if strings.EqualFold(bot, author) {
+			isUpdate = true
+		}
+	}
+	return isUpdate == (header.Get(DependencyRouteHeader) == "dependency")
+}
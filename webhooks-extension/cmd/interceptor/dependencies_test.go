@@ -0,0 +1,50 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDependencyRoutedHere(t *testing.T) {
+	update := []byte(`{"sender": {"login": "octocat"}, "pull_request": {"user": {"login": "dependabot[bot]"}}}`)
+	human := []byte(`{"sender": {"login": "dependabot[bot]"}, "pull_request": {"user": {"login": "octocat"}}}`)
+	gitlabUpdate := []byte(`{"user": {"username": "renovate-bot"}}`)
+	tests := []struct {
+		name       string
+		bots       string
+		route      string
+		provider   string
+		payload    []byte
+		routedHere bool
+	}{
+		{"no route", "", "", "github", update, true},
+		{"update on the webhook's trigger", "dependabot[bot],renovate-bot", "", "github", update, false},
+		{"update on the dependency trigger", "dependabot[bot],renovate-bot", "dependency", "github", update, true},
+		{"human pull request on the webhook's trigger", "dependabot[bot],renovate-bot", "", "github", human, true},
+		{"human pull request on the dependency trigger", "dependabot[bot],renovate-bot", "dependency", "github", human, false},
+		{"gitlab update", "dependabot[bot],renovate-bot", "dependency", "gitlab", gitlabUpdate, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(DependencySendersHeader, tt.bots)
+			header.Set(DependencyRouteHeader, tt.route)
+			if got := dependencyRoutedHere(header, tt.provider, tt.payload); got != tt.routedHere {
+				t.Errorf("routed here was %t, expected %t", got, tt.routedHere)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	staleEventsLock sync.Mutex
+	// How many events each trigger has turned away as older than MAX_EVENT_AGE
+	staleEvents = make(map[string]int)
+)
+
+// getMaxEventAge is the age, MAX_EVENT_AGE, past which events are not run, 0 when events of any age are run
+func getMaxEventAge() time.Duration {
+	if age, err := time.ParseDuration(os.Getenv("MAX_EVENT_AGE")); err == nil && age > 0 {
+		return age
+	}
+	return 0
+}
+
+// eventTime is when the event happened according to its payload: when the branch was pushed to, or the pull
+// request or comment updated, falling back to the time of the newest commit. False if the payload has no time.
+func eventTime(provider string, payload []byte) (time.Time, bool) {
+	event := struct {
+		// GitHub
+		Repository struct {
+			PushedAt json.RawMessage `json:"pushed_at"`
+		} `json:"repository"`
+		PullRequest struct {
+			UpdatedAt string `json:"updated_at"`
+		} `json:"pull_request"`
+		Comment struct {
+			UpdatedAt string `json:"updated_at"`
+		} `json:"comment"`
+		HeadCommit struct {
+			Timestamp string `json:"timestamp"`
+		} `json:"head_commit"`
+		// GitLab
+		ObjectAttributes struct {
+			UpdatedAt string `json:"updated_at"`
+		} `json:"object_attributes"`
+		Commits []struct {
+			Timestamp string `json:"timestamp"`
+		} `json:"commits"`
+	}{}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return time.Time{}, false
+	}
+	candidates := []string{}
+	switch provider {
+	case "github":
+		// pushed_at is a Unix time in push events and an RFC 3339 time in other events
+		if pushedAt, err := strconv.ParseInt(string(event.Repository.PushedAt), 10, 64); err == nil && pushedAt > 0 {
+			return time.Unix(pushedAt, 0), true
+		}
+		candidates = append(candidates, event.Comment.UpdatedAt, event.PullRequest.UpdatedAt, event.HeadCommit.Timestamp)
+	case "gitlab":
+		candidates = append(candidates, event.ObjectAttributes.UpdatedAt)
+		if len(event.Commits) > 0 {
+			candidates = append(candidates, event.Commits[len(event.Commits)-1].Timestamp)
+		}
+	}
+	for _, candidate := range candidates {
+		// GitLab writes some times as "2020-06-01 17:23:34 UTC"
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05 MST"} {
+			if t, err := time.Parse(layout, candidate); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// isStaleEvent is whether the event happened longer than MAX_EVENT_AGE ago, as when a provider redelivers events
+// after an outage, returning its age. Events with no time in their payload are never stale.
+func isStaleEvent(provider string, payload []byte) (bool, time.Duration) {
+	maxAge := getMaxEventAge()
+	if maxAge == 0 {
+		return false, 0
+	}
+	happened, found := eventTime(provider, payload)
+	if !found {
+		return false, 0
+	}
+	age := time.Since(happened)
+	return age > maxAge, age
+}
+
+// countStaleEvent counts an event the trigger turned away as stale
+func countStaleEvent(foundTriggerName string) {
+	staleEventsLock.Lock()
+	defer staleEventsLock.Unlock()
+	staleEvents[foundTriggerName]++
+}
+
+// serveMetrics writes the count of stale events turned away by each trigger in the Prometheus text format
+func serveMetrics(writer http.ResponseWriter, request *http.Request) {
+	staleEventsLock.Lock()
+	triggers := []string{}
+	for trigger := range staleEvents {
+		triggers = append(triggers, trigger)
+	}
+	sort.Strings(triggers)
+	var buf bytes.Buffer
+	buf.WriteString("# HELP webhooks_extension_interceptor_stale_events_total Events not run as they were older than MAX_EVENT_AGE.\n")
+	buf.WriteString("# TYPE webhooks_extension_interceptor_stale_events_total counter\n")
+	for _, trigger := range triggers {
+		fmt.Fprintf(&buf, "webhooks_extension_interceptor_stale_events_total{trigger=%q} %d\n", trigger, staleEvents[trigger])
+	}
+	staleEventsLock.Unlock()
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writer.Write(buf.Bytes())
+}
@@ -0,0 +1,79 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		payload  string
+		expected time.Time
+		found    bool
+	}{
+		{"github push", "github", `{"repository": {"pushed_at": 1590000000}, "head_commit": {"timestamp": "2019-01-01T00:00:00Z"}}`, time.Unix(1590000000, 0), true},
+		{"github pull request", "github", `{"repository": {"pushed_at": "2019-01-01T00:00:00Z"}, "pull_request": {"updated_at": "2020-05-20T18:40:00Z"}}`, time.Date(2020, 5, 20, 18, 40, 0, 0, time.UTC), true},
+		{"github comment", "github", `{"comment": {"updated_at": "2020-05-21T09:00:00Z"}, "pull_request": {"updated_at": "2020-05-20T18:40:00Z"}}`, time.Date(2020, 5, 21, 9, 0, 0, 0, time.UTC), true},
+		{"gitlab merge request", "gitlab", `{"object_attributes": {"updated_at": "2020-05-20 18:40:00 UTC"}}`, time.Date(2020, 5, 20, 18, 40, 0, 0, time.UTC), true},
+		{"gitlab push", "gitlab", `{"commits": [{"timestamp": "2020-05-19T10:00:00Z"}, {"timestamp": "2020-05-20T10:00:00Z"}]}`, time.Date(2020, 5, 20, 10, 0, 0, 0, time.UTC), true},
+		{"no time", "github", `{"zen": "Keep it logically awesome."}`, time.Time{}, false},
+		{"invalid", "github", `not json`, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := eventTime(tt.provider, []byte(tt.payload))
+			if found != tt.found || !got.Equal(tt.expected) {
+				t.Errorf("event time was %s (%t), expected %s (%t)", got, found, tt.expected, tt.found)
+			}
+		})
+	}
+}
+
+func TestIsStaleEvent(t *testing.T) {
+	old := []byte(`{"pull_request": {"updated_at": "` + time.Now().Add(-48*time.Hour).UTC().Format(time.RFC3339) + `"}}`)
+	recent := []byte(`{"pull_request": {"updated_at": "` + time.Now().Add(-time.Minute).UTC().Format(time.RFC3339) + `"}}`)
+	if stale, _ := isStaleEvent("github", old); stale {
+		t.Error("an event was stale with no maximum event age set")
+	}
+
+	os.Setenv("MAX_EVENT_AGE", "24h")
+	defer os.Unsetenv("MAX_EVENT_AGE")
+	if stale, age := isStaleEvent("github", old); !stale || age < 47*time.Hour {
+		t.Errorf("expected a two day old event to be stale, got %t with age %s", stale, age)
+	}
+	if stale, _ := isStaleEvent("github", recent); stale {
+		t.Error("a recent event was stale")
+	}
+	if stale, _ := isStaleEvent("github", []byte(`{}`)); stale {
+		t.Error("an event without a time was stale")
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	countStaleEvent("hook-default-push-event")
+	countStaleEvent("hook-default-push-event")
+	recorder := httptest.NewRecorder()
+	serveMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `webhooks_extension_interceptor_stale_events_total{trigger="hook-default-push-event"} 2`
+	if !strings.Contains(recorder.Body.String(), expected) {
+		t.Errorf("metrics were %q, expected them to contain %q", recorder.Body.String(), expected)
+	}
+}
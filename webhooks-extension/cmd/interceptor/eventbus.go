@@ -0,0 +1,173 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// Time an event is remembered for so that it is published once even though
+	// every trigger for the repository passes it through the interceptor
+	publishedEventTTL = 5 * time.Minute
+)
+
+// busEvent is the message published for each accepted git event
+type busEvent struct {
+	Provider   string          `json:"provider"`
+	Event      string          `json:"event"`
+	DeliveryID string          `json:"deliveryid,omitempty"`
+	Repository string          `json:"repository"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// eventPublisher sends a message to a topic (Kafka) or subject (NATS) on the configured bus
+type eventPublisher interface {
+	Publish(topic string, message []byte) error
+}
+
+type natsPublisher struct {
+	conn *nats.Conn
+}
+
+func (p natsPublisher) Publish(topic string, message []byte) error {
+	return p.conn.Publish(topic, message)
+}
+
+type kafkaPublisher struct {
+	producer sarama.SyncProducer
+}
+
+func (p kafkaPublisher) Publish(topic string, message []byte) error {
+	_, _, err := p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(message),
+	})
+	return err
+}
+
+var (
+	publisher      eventPublisher
+	topicPrefix    = "wext"
+	topicSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+	publishedEventsLock sync.Mutex
+	publishedEvents     = make(map[string]time.Time)
+)
+
+// setupEventBus connects to the bus named by EVENT_BUS_TYPE (nats or kafka) at EVENT_BUS_URL,
+// a comma separated broker list for kafka. Nothing is published when EVENT_BUS_TYPE isn't set.
+func setupEventBus() error {
+	busType := strings.ToLower(os.Getenv("EVENT_BUS_TYPE"))
+	busURL := os.Getenv("EVENT_BUS_URL")
+	if prefix := os.Getenv("EVENT_BUS_TOPIC_PREFIX"); prefix != "" {
+		topicPrefix = prefix
+	}
+
+	switch busType {
+	case "":
+		return nil
+	case "nats":
+		conn, err := nats.Connect(busURL, nats.Name("tekton-webhooks-extension-validator"), nats.MaxReconnects(-1))
+		if err != nil {
+			return err
+		}
+		publisher = natsPublisher{conn: conn}
+	case "kafka":
+		config := sarama.NewConfig()
+		config.Producer.Return.Successes = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		producer, err := sarama.NewSyncProducer(strings.Split(busURL, ","), config)
+		if err != nil {
+			return err
+		}
+		publisher = kafkaPublisher{producer: producer}
+	default:
+		return fmt.Errorf("unsupported EVENT_BUS_TYPE %s, expected nats or kafka", busType)
+	}
+	log.Printf("Publishing accepted events to %s at %s with topic prefix %s", busType, busURL, topicPrefix)
+	return nil
+}
+
+// publishAcceptedEvent publishes an event that passed validation, at most once per event
+func publishAcceptedEvent(foundTriggerName, provider, event, deliveryID string, repoURL *url.URL, payload []byte) {
+	if publisher == nil {
+		return
+	}
+	if !firstPublish(event, payload) {
+		return
+	}
+
+	topic := eventTopic(repoURL, event)
+	message, err := json.Marshal(busEvent{
+		Provider:   provider,
+		Event:      event,
+		DeliveryID: deliveryID,
+		Repository: repoURL.String(),
+		Payload:    payload,
+	})
+	if err != nil {
+		log.Printf("[%s] Error marshalling event for publishing: %s", foundTriggerName, err.Error())
+		return
+	}
+	if err := publisher.Publish(topic, message); err != nil {
+		log.Printf("[%s] Error publishing event to %s: %s", foundTriggerName, topic, err.Error())
+		return
+	}
+	log.Printf("[%s] Published event to %s", foundTriggerName, topic)
+}
+
+// eventTopic returns <prefix>.<owner>.<repo>.<event>, e.g. wext.tektoncd.pipeline.pull_request
+func eventTopic(repoURL *url.URL, event string) string {
+	parts := []string{topicPrefix}
+	repoPath := strings.TrimSuffix(strings.ToLower(strings.Trim(repoURL.Path, "/")), ".git")
+	for _, segment := range strings.Split(repoPath, "/") {
+		parts = append(parts, topicSanitizer.ReplaceAllString(segment, "_"))
+	}
+	parts = append(parts, topicSanitizer.ReplaceAllString(strings.ToLower(event), "_"))
+	return strings.Join(parts, ".")
+}
+
+// firstPublish records the event, returning false if it was already seen recently
+func firstPublish(event string, payload []byte) bool {
+	sum := sha256.Sum256(append([]byte(event), payload...))
+	key := hex.EncodeToString(sum[:])
+
+	publishedEventsLock.Lock()
+	defer publishedEventsLock.Unlock()
+	now := time.Now()
+	for k, seen := range publishedEvents {
+		if now.Sub(seen) > publishedEventTTL {
+			delete(publishedEvents, k)
+		}
+	}
+	if _, ok := publishedEvents[key]; ok {
+		return false
+	}
+	publishedEvents[key] = now
+	return true
+}
@@ -0,0 +1,75 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+type recordingPublisher struct {
+	topics   []string
+	messages [][]byte
+}
+
+func (p *recordingPublisher) Publish(topic string, message []byte) error {
+	p.topics = append(p.topics, topic)
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func TestEventTopic(t *testing.T) {
+	// Key = repository URL and event
+	// Value = Expected topic
+	topics := map[[2]string]string{
+		{"https://github.com/foo/bar", "push"}:                 "wext.foo.bar.push",
+		{"https://github.com/Foo/Bar.GIT", "pull_request"}:     "wext.foo.bar.pull_request",
+		{"https://gitlab.com/group/sub/proj.git", "Push Hook"}: "wext.group.sub.proj.push_hook",
+		{"https://github.ibm.com/foo/bar.baz", "pull_request"}: "wext.foo.bar_baz.pull_request",
+		{"https://gitlab.com/foo/bar", "Merge Request Hook"}:   "wext.foo.bar.merge_request_hook",
+	}
+	for input, expected := range topics {
+		repoURL, _ := url.Parse(input[0])
+		if topic := eventTopic(repoURL, input[1]); topic != expected {
+			t.Errorf("topic for %s %s was %s, expected %s", input[0], input[1], topic, expected)
+		}
+	}
+}
+
+func TestPublishAcceptedEventOnce(t *testing.T) {
+	recorder := &recordingPublisher{}
+	publisher = recorder
+	defer func() { publisher = nil }()
+
+	repoURL, _ := url.Parse("https://github.com/foo/bar")
+	payload := []byte(`{"ref":"refs/heads/master"}`)
+	// Each trigger for the repository passes the same event through the interceptor
+	publishAcceptedEvent("trigger1", "github", "push", "1234", repoURL, payload)
+	publishAcceptedEvent("trigger2", "github", "push", "1234", repoURL, payload)
+
+	if len(recorder.messages) != 1 {
+		t.Fatalf("event published %d times, expected once", len(recorder.messages))
+	}
+	if recorder.topics[0] != "wext.foo.bar.push" {
+		t.Errorf("event published to %s, expected wext.foo.bar.push", recorder.topics[0])
+	}
+	event := busEvent{}
+	if err := json.Unmarshal(recorder.messages[0], &event); err != nil {
+		t.Fatalf("published message was not a bus event: %s", err.Error())
+	}
+	if event.DeliveryID != "1234" || event.Provider != "github" || string(event.Payload) != string(payload) {
+		t.Errorf("unexpected published event %+v", event)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Set by the extension on all of the triggers of a webhook with file rules, the rules as JSON
+	FileRulesHeader = "Wext-File-Rules"
+	// Set on the triggers running a file rule's pipeline, the rule's index
+	FileRuleHeader = "Wext-File-Rule"
+	// A rule matching when any changed file matches its paths rather than all of them
+	anyFilesMatch = "any"
+	// How long an event's changed files are remembered, each trigger of the webhook seeing the same delivery
+	changedFilesTTL     = 5 * time.Minute
+	changedFilesTimeout = 10 * time.Second
+)
+
+// A commit before a push creating a branch, which there's nothing to compare with
+var zeroCommit = regexp.MustCompile(`^0+$`)
+
+// fileRule is a webhook's rule sending the events changing the files its paths match to another pipeline
+type fileRule struct {
+	Paths []string `json:"paths"`
+	Match string   `json:"match,omitempty"`
+}
+
+type changedFiles struct {
+	files   []string
+	checked time.Time
+}
+
+var (
+	changedFilesLock  sync.Mutex
+	changedFilesCache = make(map[string]changedFiles)
+)
+
+// fileRuleRoutedHere reports whether a trigger of a webhook with file rules should accept the event: the triggers of
+// the first rule matching the files the event changes do, or if none does, or they can't be compared, the webhook's own.
+// It also returns the rule selected, -1 for the webhook's own pipeline, and why the files couldn't be compared.
+func fileRuleRoutedHere(header http.Header, provider string, payload []byte, repoURL *url.URL, token string) (bool, int, error) {
+	rulesJSON := header.Get(FileRulesHeader)
+	if rulesJSON == "" {
+		return true, -1, nil
+	}
+	here := -1
+	if index := header.Get(FileRuleHeader); index != "" {
+		here, _ = strconv.Atoi(index)
+	}
+	rules := []fileRule{}
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		return here == -1, -1, err
+	}
+	files, err := eventChangedFiles(provider, payload, repoURL, token)
+	if err != nil {
+		return here == -1, -1, err
+	}
+	selected := selectFileRule(rules, files)
+	return selected == here, selected, nil
+}
+
+// selectFileRule returns the index of the first rule matching the changed files, or -1. A rule matches when all of the
+// files, or for match any one of them, match one of its paths.
+func selectFileRule(rules []fileRule, files []string) int {
+	if len(files) == 0 {
+		return -1
+	}
+	for i, rule := range rules {
+		matched := 0
+		for _, file := range files {
+			for _, pattern := range rule.Paths {
+				if matchPath(pattern, file) {
+					matched++
+					break
+				}
+			}
+		}
+		if (rule.Match == anyFilesMatch && matched > 0) || matched == len(files) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchPath matches a file against a path pattern: a pattern ending in / matches the files under that directory, one
+// without a / matches the file's name in any directory, and ** matches across directories
+func matchPath(pattern, file string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(file, strings.TrimPrefix(pattern, "/"))
+	}
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(file))
+		return matched
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "**") {
+		matched, _ := path.Match(pattern, file)
+		return matched
+	}
+	expression := regexp.QuoteMeta(pattern)
+	expression = strings.Replace(expression, `\*\*/`, `(.*/)?`, -1)
+	expression = strings.Replace(expression, `\*\*`, `.*`, -1)
+	expression = strings.Replace(expression, `\*`, `[^/]*`, -1)
+	expression = strings.Replace(expression, `\?`, `[^/]`, -1)
+	matched, _ := regexp.MatchString("^"+expression+"$", file)
+	return matched
+}
+
+// eventChangedFiles returns the files a push or pull request changes, compared by the provider's compare API with
+// the webhook's access token
+func eventChangedFiles(provider string, payload []byte, repoURL *url.URL, token string) ([]string, error) {
+	fields := struct {
+		// GitHub and GitLab pushes
+		Before string `json:"before"`
+		After  string `json:"after"`
+		// GitHub
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		PullRequest struct {
+			Base struct {
+				SHA string `json:"sha"`
+			} `json:"base"`
+			Head struct {
+				SHA string `json:"sha"`
+			} `json:"head"`
+		} `json:"pull_request"`
+		// GitLab
+		Project struct {
+			ID int64 `json:"id"`
+		} `json:"project"`
+		ObjectAttributes struct {
+			TargetBranch string `json:"target_branch"`
+			LastCommit   struct {
+				ID string `json:"id"`
+			} `json:"last_commit"`
+		} `json:"object_attributes"`
+	}{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	base, head := fields.Before, fields.After
+	if provider == "github" && fields.PullRequest.Head.SHA != "" {
+		base, head = fields.PullRequest.Base.SHA, fields.PullRequest.Head.SHA
+	}
+	if provider == "gitlab" && fields.ObjectAttributes.LastCommit.ID != "" {
+		base, head = fields.ObjectAttributes.TargetBranch, fields.ObjectAttributes.LastCommit.ID
+	}
+	if base == "" || head == "" || zeroCommit.MatchString(base) || zeroCommit.MatchString(head) {
+		return nil, errors.New("the event has no changes to compare")
+	}
+
+	key := strings.Join([]string{repoURL.String(), base, head}, "\n")
+	changedFilesLock.Lock()
+	now := time.Now()
+	for k, c := range changedFilesCache {
+		if now.Sub(c.checked) > changedFilesTTL {
+			delete(changedFilesCache, k)
+		}
+	}
+	known, found := changedFilesCache[key]
+	changedFilesLock.Unlock()
+	if found {
+		return known.files, nil
+	}
+
+	var request *http.Request
+	var err error
+	if provider == "github" {
+		request, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/repos/%s/compare/%s...%s", gitAPIURL(provider, repoURL),
+			fields.Repository.FullName, url.PathEscape(base), url.PathEscape(head)), nil)
+		if err == nil && token != "" {
+			request.Header.Set("Authorization", "token "+token)
+		}
+	} else {
+		request, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/projects/%d/repository/compare?from=%s&to=%s", gitAPIURL(provider, repoURL),
+			fields.Project.ID, url.QueryEscape(base), url.QueryEscape(head)), nil)
+		if err == nil && token != "" {
+			request.Header.Set("PRIVATE-TOKEN", token)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	client := http.Client{Timeout: changedFilesTimeout}
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error comparing %s with %s: %s", base, head, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("comparing %s with %s responded with status %d", base, head, resp.StatusCode)
+	}
+	comparison := struct {
+		// GitHub
+		Files []struct {
+			Filename         string `json:"filename"`
+			PreviousFilename string `json:"previous_filename"`
+		} `json:"files"`
+		// GitLab
+		Diffs []struct {
+			OldPath string `json:"old_path"`
+			NewPath string `json:"new_path"`
+		} `json:"diffs"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&comparison); err != nil {
+		return nil, err
+	}
+	files := []string{}
+	add := func(names ...string) {
+		for _, name := range names {
+			if name != "" && (len(files) == 0 || files[len(files)-1] != name) {
+				files = append(files, name)
+			}
+		}
+	}
+	for _, file := range comparison.Files {
+		add(file.PreviousFilename, file.Filename)
+	}
+	for _, diff := range comparison.Diffs {
+		add(diff.OldPath, diff.NewPath)
+	}
+
+	changedFilesLock.Lock()
+	changedFilesCache[key] = changedFiles{files: files, checked: now}
+	changedFilesLock.Unlock()
+	return files, nil
+}
@@ -0,0 +1,126 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		matches bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide/setup.md", true},
+		{"*.md", "main.go", false},
+		{"docs/", "docs/guide/setup.md", true},
+		{"docs/", "src/docs.go", false},
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/pkg/main.go", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/pkg/main.go", true},
+		{"src/**", "src/pkg/main.go", true},
+		{"/cmd/**", "cmd/interceptor/main.go", true},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.file); got != tt.matches {
+			t.Errorf("matching %s against %s was %t, expected %t", tt.file, tt.pattern, got, tt.matches)
+		}
+	}
+}
+
+func TestSelectFileRule(t *testing.T) {
+	rules := []fileRule{
+		{Paths: []string{"docs/", "*.md"}},
+		{Paths: []string{"src/"}, Match: anyFilesMatch},
+	}
+	tests := []struct {
+		name     string
+		files    []string
+		selected int
+	}{
+		{"docs only", []string{"README.md", "docs/setup.md"}, 0},
+		{"source change", []string{"README.md", "src/main.go"}, 1},
+		{"other change", []string{"Makefile"}, -1},
+		{"no changes", []string{}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectFileRule(rules, tt.files); got != tt.selected {
+				t.Errorf("selected rule %d, expected %d", got, tt.selected)
+			}
+		})
+	}
+}
+
+func TestFileRuleRoutedHere(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v3/repos/owner/repo/compare/base1...docs":
+			w.Write([]byte(`{"files": [{"filename": "docs/setup.md"}, {"filename": "README.md", "previous_filename": "README"}]}`))
+		case "/api/v3/repos/owner/repo/compare/base1...src":
+			w.Write([]byte(`{"files": [{"filename": "docs/setup.md"}, {"filename": "main.go"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	repoURL, _ := url.Parse(server.URL + "/owner/repo")
+	rules := `[{"paths": ["docs/", "*.md", "README"]}]`
+	pullRequest := func(head string) []byte {
+		return []byte(`{"repository": {"full_name": "owner/repo"}, "pull_request": {"base": {"sha": "base1"}, "head": {"sha": "` + head + `"}}}`)
+	}
+
+	tests := []struct {
+		name       string
+		rule       string
+		payload    []byte
+		routedHere bool
+		compared   bool
+	}{
+		{"docs change on the webhook's trigger", "", pullRequest("docs"), false, true},
+		{"docs change on the rule's trigger", "0", pullRequest("docs"), true, true},
+		{"source change on the webhook's trigger", "", pullRequest("src"), true, true},
+		{"source change on the rule's trigger", "0", pullRequest("src"), false, true},
+		{"new branch on the webhook's trigger", "", []byte(`{"before": "0000000000000000000000000000000000000000", "after": "abc"}`), true, false},
+		{"unknown commits on the rule's trigger", "0", pullRequest("missing"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(FileRulesHeader, rules)
+			header.Set(FileRuleHeader, tt.rule)
+			routedHere, _, err := fileRuleRoutedHere(header, "github", tt.payload, repoURL, "access")
+			if routedHere != tt.routedHere {
+				t.Errorf("routed here was %t, expected %t", routedHere, tt.routedHere)
+			}
+			if (err == nil) != tt.compared {
+				t.Errorf("unexpected compare error %v", err)
+			}
+		})
+	}
+
+	if routedHere, _, _ := fileRuleRoutedHere(http.Header{}, "github", pullRequest("docs"), repoURL, "access"); !routedHere {
+		t.Error("expected a webhook without file rules to accept the event")
+	}
+}
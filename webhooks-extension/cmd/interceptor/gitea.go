@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Gitea names its events in X-Gitea-Event, and in X-GitHub-Event too so it must be told apart from GitHub by the
+// former, Gogs in X-Gogs-Event. Each signs deliveries with the hex HMAC-SHA256 of the payload in the matching
+// X-Gitea-Signature or X-Gogs-Signature header.
+const (
+	giteaEventHeader = "X-Gitea-Event"
+	gogsEventHeader  = "X-Gogs-Event"
+)
+
+// giteaActions are the pull request actions, as the extension names them, Gitea and Gogs name differently
+var giteaActions = map[string]string{
+	"synchronized": "synchronize",
+}
+
+// giteaEvent holds the fields of Gitea's and Gogs' push and pull request payloads the interceptor reads
+type giteaEvent struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+	} `json:"repository"`
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			Ref string `json:"ref"`
+			Sha string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+}
+
+// giteaHeaderPrefix returns X-Gitea or X-Gogs for a delivery from Gitea or Gogs, empty for other deliveries
+func giteaHeaderPrefix(header http.Header) string {
+	switch {
+	case header.Get(giteaEventHeader) != "":
+		return "X-Gitea"
+	case header.Get(gogsEventHeader) != "":
+		return "X-Gogs"
+	}
+	return ""
+}
+
+func HandleGitea(request *http.Request, writer http.ResponseWriter, foundTriggerName string, secret *corev1.Secret) ([]byte, error) {
+	prefix := giteaHeaderPrefix(request.Header)
+	payload, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		log.Printf("[%s] Validation FAIL (error %s reading payload)", foundTriggerName, err.Error())
+		return nil, err
+	}
+	if err := validateGiteaSignature(request.Header.Get(prefix+"-Signature"), payload, secret.Data["secretToken"]); err != nil {
+		log.Printf("[%s] Validation FAIL (error %s validating payload)", foundTriggerName, err.Error())
+		return nil, err
+	}
+
+	eventHeader := prefix + "-Event"
+	event := giteaEvent{}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Printf("[%s] Validation FAIL (error %s marshalling payload as JSON)", foundTriggerName, err.Error())
+		return nil, err
+	}
+
+	var id, action, ref, commit string
+	switch request.Header.Get(eventHeader) {
+	case "push":
+		ref, commit, id = event.Ref, event.After, event.After
+	case "pull_request":
+		action = event.Action
+		if renamed, found := giteaActions[action]; found {
+			action = renamed
+		}
+		ref, commit, id = event.PullRequest.Head.Ref, event.PullRequest.Head.Sha, strconv.Itoa(event.Number)
+	default:
+		log.Printf("[%s] Validation FAIL (unsupported gitea event)", foundTriggerName)
+		return nil, fmt.Errorf("%s did not match any of the supported events", eventHeader)
+	}
+
+	cloneURL := event.Repository.CloneURL
+	log.Printf("[%s] Clone URL coming in as JSON: %s", foundTriggerName, cloneURL)
+	log.Printf("[%s] Handling Gitea Event %s for %s", foundTriggerName, request.Header.Get(prefix+"-Delivery"), id)
+
+	validationPassed, err := Validate(request, cloneURL, eventHeader, action, foundTriggerName)
+	if !validationPassed {
+		if err == nil {
+			err = errors.New("Validation Failed")
+		}
+		return nil, err
+	}
+
+	returnPayload, err := addRefBranchAndTag(payload, ref, commit, "")
+	if err != nil {
+		log.Printf("[%s] Failed to add branch to payload processing Gitea event for %s. Error: %s", foundTriggerName, id, err.Error())
+		return nil, err
+	}
+	log.Printf("[%s] Validation PASS so writing response", foundTriggerName)
+	return returnPayload, nil
+}
+
+// validateGiteaSignature returns an error unless signature is the hex HMAC-SHA256 of payload keyed with secretToken
+func validateGiteaSignature(signature string, payload, secretToken []byte) error {
+	if signature == "" {
+		return errors.New("missing signature")
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("error decoding signature %q: %s", signature, err.Error())
+	}
+	mac := hmac.New(sha256.New, secretToken)
+	mac.Write(payload)
+	if !hmac.Equal(expected, mac.Sum(nil)) {
+		return errors.New("payload signature check failed")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func giteaRequest(prefix, event, payload, events, actions string) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(payload))
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(payload))
+	request.Header.Set(prefix+"-Signature", hex.EncodeToString(mac.Sum(nil)))
+	request.Header.Set(prefix+"-Event", event)
+	request.Header.Set("X-Github-Event", event)
+	request.Header.Set(RequiredRepositoryHeader, "https://gitea.example.com/owner/repo")
+	request.Header.Set(RequiredEventHeader, events)
+	if actions != "" {
+		request.Header.Set(RequiredActionsHeader, actions)
+	}
+	return request
+}
+
+func TestHandleGitea(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"secretToken": []byte("secret")}}
+	repository := `"repository": {"clone_url": "https://gitea.example.com/owner/repo.git"}`
+	pullRequest := `"number": 4, "pull_request": {"head": {"ref": "feature", "sha": "1234567890ab"}}`
+	tests := []struct {
+		name     string
+		request  *http.Request
+		branch   string
+		tag      string
+		rejected bool
+	}{
+		{
+			name:    "gitea push",
+			request: giteaRequest("X-Gitea", "push", `{"ref": "refs/heads/master", "after": "abcdef0123456", `+repository+`}`, "push, Push Hook", ""),
+			branch:  "master",
+			tag:     "abcdef0",
+		},
+		{
+			name:    "gogs tag push",
+			request: giteaRequest("X-Gogs", "push", `{"ref": "refs/tags/v1.0", "after": "abcdef0123456", `+repository+`}`, "push", ""),
+			branch:  "v1.0",
+			tag:     "v1.0",
+		},
+		{
+			name:    "pull request pushed to",
+			request: giteaRequest("X-Gitea", "pull_request", `{"action": "synchronized", `+pullRequest+`, `+repository+`}`, "pull_request", "opened, synchronize"),
+			branch:  "feature",
+			tag:     "1234567",
+		},
+		{
+			name:     "action not wanted",
+			request:  giteaRequest("X-Gitea", "pull_request", `{"action": "label_updated", `+pullRequest+`, `+repository+`}`, "pull_request", "opened, synchronize"),
+			rejected: true,
+		},
+		{
+			name:     "other repository",
+			request:  giteaRequest("X-Gitea", "push", `{"ref": "refs/heads/master", "after": "abcdef0123456", "repository": {"clone_url": "https://gitea.example.com/owner/other.git"}}`, "push", ""),
+			rejected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if giteaHeaderPrefix(tt.request.Header) == "" {
+				t.Fatal("expected the request to be told apart from GitHub's")
+			}
+			payload, err := HandleGitea(tt.request, httptest.NewRecorder(), "trigger", secret)
+			if tt.rejected {
+				if err == nil {
+					t.Error("expected the event to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error handling event: %s", err.Error())
+			}
+			fields := make(map[string]interface{})
+			if err := json.Unmarshal(payload, &fields); err != nil {
+				t.Fatalf("error reading %s: %s", string(payload), err.Error())
+			}
+			if fields["webhooks-tekton-git-branch"] != tt.branch || fields["webhooks-tekton-image-tag"] != tt.tag {
+				t.Errorf("unexpected branch %v and tag %v", fields["webhooks-tekton-git-branch"], fields["webhooks-tekton-image-tag"])
+			}
+		})
+	}
+}
+
+func TestHandleGiteaBadSignature(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"secretToken": []byte("secret")}}
+	for _, signature := range []string{"", "not hex", "00"} {
+		request := giteaRequest("X-Gitea", "push", `{}`, "push", "")
+		request.Header.Set("X-Gitea-Signature", signature)
+		if _, err := HandleGitea(request, httptest.NewRecorder(), "trigger", secret); err == nil {
+			t.Errorf("expected the event signed %q to be rejected", signature)
+		}
+	}
+}
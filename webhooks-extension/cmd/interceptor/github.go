@@ -32,12 +32,20 @@ func HandleGitHub(request *http.Request, writer http.ResponseWriter, foundTrigge
 	}
 
 	event := request.Header.Get("X-Github-Event")
+	// Parsed as the current payload version, see payloadversion.go
+	payload, _, err = upgradePayload("github", event, payload)
+	if err != nil {
+		log.Printf("[%s] Validation FAIL (error %s marshalling payload as JSON)", foundTriggerName, err.Error())
+		return nil, err
+	}
 	if event != "" {
 		switch {
 		case event == "push":
 			return handlePush(request, writer, foundTriggerName, payload)
 		case event == "pull_request":
 			return handlePull(request, writer, foundTriggerName, payload)
+		case event == "repository":
+			return handleRepository(request, foundTriggerName, payload)
 		}
 	}
 
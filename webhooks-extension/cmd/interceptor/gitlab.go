@@ -39,6 +39,13 @@ func HandleGitLab(request *http.Request, writer http.ResponseWriter, foundTrigge
 		return nil, err
 	}
 
+	// Parsed as the current payload version, see payloadversion.go
+	payload, _, err = upgradePayload("gitlab", request.Header.Get("X-Gitlab-Event"), payload)
+	if err != nil {
+		log.Printf("[%s] Validation FAIL (error %s parsing webhook)", foundTriggerName, err.Error())
+		return nil, err
+	}
+
 	event, err := gitlab.ParseWebhook(gitlab.WebhookEventType(request), payload)
 	if err != nil {
 		log.Printf("[%s] Validation FAIL (error %s parsing webhook)", foundTriggerName, err.Error())
@@ -55,6 +62,17 @@ func HandleGitLab(request *http.Request, writer http.ResponseWriter, foundTrigge
 		projectURL = event.ObjectAttributes.Target.GitHTTPURL
 		id = strconv.Itoa(event.ObjectAttributes.ID) //cannot obtain webhook event id so will log commit
 		action = event.ObjectAttributes.State
+		if event.ObjectAttributes.Action == ApprovedAction {
+			action = ApprovedAction
+		}
+	case *gitlab.MergeCommentEvent:
+		if !isCommentCommand(event.ObjectAttributes.Note) {
+			log.Printf("[%s] Validation FAIL (merge request comment is not a command)", foundTriggerName)
+			return nil, errors.New("Validator failed as comment is not a command")
+		}
+		projectURL = event.Project.GitHTTPURL
+		id = strconv.Itoa(event.MergeRequest.ID) //cannot obtain webhook event id so will log merge request
+		action = CommentAction
 	case *gitlab.TagEvent:
 		projectURL = event.Repository.GitHTTPURL
 		id = event.CheckoutSHA //cannot obtain webhook event id so will log commit
@@ -68,6 +86,15 @@ func HandleGitLab(request *http.Request, writer http.ResponseWriter, foundTrigge
 	validationPassed, err := validateGitlab(request, foundTriggerName, projectURL, id, action)
 
 	if validationPassed {
+		if _, isComment := event.(*gitlab.MergeCommentEvent); isComment {
+			returnPayload, err := mergeCommentPayload(payload)
+			if err != nil {
+				log.Printf("[%s] Failed to convert merge request comment for merge request ID: %s. Error: %s", foundTriggerName, id, err.Error())
+				return nil, err
+			}
+			log.Printf("[%s] Validation PASS so writing response", foundTriggerName)
+			return returnPayload, nil
+		}
 		returnPayload, err := addBranchAndTag(event)
 		if err != nil {
 			log.Printf("[%s] Failed to add branch to payload processing Gitlab event for commit ID: %s. Error: %s", foundTriggerName, id, err.Error())
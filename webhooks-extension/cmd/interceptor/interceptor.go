@@ -14,13 +14,17 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -32,7 +36,17 @@ const (
 
 func main() {
 	log.Print("Interceptor started")
-	http.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+	if err := setupEventBus(); err != nil {
+		log.Fatalf("Error connecting to event bus: %s", err.Error())
+	}
+	if err := setupAllowlist(); err != nil {
+		log.Fatalf("Error reading the allowed delivery sources: %s", err.Error())
+	}
+	http.HandleFunc("/metrics", serveMetrics)
+	http.HandleFunc("/", func(responseWriter http.ResponseWriter, request *http.Request) {
+		writer := &failureRecorder{ResponseWriter: responseWriter}
+		defer reportDeadLetter(writer, request)
+		dryRun := takeDryRun(request.Header)
 
 		// Copy Headers from the request onto the response
 		for k, valueArray := range request.Header {
@@ -42,6 +56,27 @@ func main() {
 		}
 
 		foundTriggerName := request.Header.Get("Wext-Trigger-Name")
+		if reason := request.Header.Get(DisabledHeader); reason != "" {
+			msg := fmt.Sprintf("[%s] Validation FAIL (webhook disabled: %s)", foundTriggerName, reason)
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		if simulatedForOtherWebhook(request.Header, foundTriggerName) {
+			msg := fmt.Sprintf("[%s] Validation FAIL (simulated delivery for webhook %s)", foundTriggerName, request.Header.Get(SimulatedWebhookHeader))
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		if source := deliverySource(request); !allowedSources.allows(source) {
+			msg := fmt.Sprintf("[%s] Validation FAIL (delivery from %s, not an allowed source)", foundTriggerName, source)
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
 		config, err := rest.InClusterConfig()
 		if err != nil {
 			log.Printf("[%s] Error creating in cluster config: %s", foundTriggerName, err.Error())
@@ -73,16 +108,51 @@ func main() {
 			return
 		}
 
+		// Kept as delivered for the provenance record's digest
+		rawPayload, err := readPayload(request)
+		if err != nil {
+			log.Printf("[%s] Error reading the request body: %s", foundTriggerName, err.Error())
+			status := http.StatusBadRequest
+			if _, tooLarge := err.(payloadTooLargeError); tooLarge {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(writer, fmt.Sprint(err), status)
+			return
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(rawPayload))
+
+		if dryRun {
+			if err := acceptDryRun(clientset, foundNamespace, request.Header, rawPayload, time.Now()); err != nil {
+				msg := fmt.Sprintf("[%s] Validation FAIL (dry run refused: %s)", foundTriggerName, err.Error())
+				log.Print(msg)
+				http.Error(writer, msg, http.StatusExpectationFailed)
+				return
+			}
+		}
+
 		var returnPayload []byte
+		var provider, event, deliveryID string
 		switch {
+		// Before GitHub's, as Gitea sends X-Github-Event too
+		case giteaHeaderPrefix(request.Header) != "":
+			if !utils.IsGiteaHost(url.Host) {
+				msg := fmt.Sprintf("[%s] Validation FAIL (provider mismatch - webhook is from Gitea)", foundTriggerName)
+				log.Print(msg)
+				http.Error(writer, msg, http.StatusExpectationFailed)
+				return
+			}
+			prefix := giteaHeaderPrefix(request.Header)
+			provider, event, deliveryID = "gitea", request.Header.Get(prefix+"-Event"), request.Header.Get(prefix+"-Delivery")
+			returnPayload, err = HandleGitea(request, writer, foundTriggerName, foundSecret)
 		case request.Header["X-Github-Event"] != nil:
-			expectingGithub := strings.Contains(url.Host, "github")
+			expectingGithub := utils.IsGitHubHost(url.Host)
 			if !expectingGithub {
 				msg := fmt.Sprintf("[%s] Validation FAIL (provider mismatch - webhook is from GitHub)", foundTriggerName)
 				log.Print(msg)
 				http.Error(writer, msg, http.StatusExpectationFailed)
 				return
 			}
+			provider, event, deliveryID = "github", request.Header.Get("X-Github-Event"), request.Header.Get("X-Github-Delivery")
 			returnPayload, err = HandleGitHub(request, writer, foundTriggerName, foundSecret)
 		case request.Header["X-Gitlab-Event"] != nil:
 			expectingGitlab := strings.Contains(url.Host, "gitlab")
@@ -92,9 +162,19 @@ func main() {
 				http.Error(writer, msg, http.StatusExpectationFailed)
 				return
 			}
+			provider, event, deliveryID = "gitlab", request.Header.Get("X-Gitlab-Event"), request.Header.Get("X-Gitlab-Event-UUID")
 			returnPayload, err = HandleGitLab(request, writer, foundTriggerName, foundSecret)
+		case request.Header[bitbucketEventHeader] != nil:
+			if !isBitbucketHost(url.Host) {
+				msg := fmt.Sprintf("[%s] Validation FAIL (provider mismatch - webhook is from Bitbucket)", foundTriggerName)
+				log.Print(msg)
+				http.Error(writer, msg, http.StatusExpectationFailed)
+				return
+			}
+			provider, event, deliveryID = "bitbucket", request.Header.Get(bitbucketEventHeader), request.Header.Get("X-Request-UUID")
+			returnPayload, err = HandleBitbucket(request, writer, foundTriggerName, foundSecret)
 		default:
-			log.Print("Webhook did not contain either `X-Github-Event` or `X-Gitlab-Event` headers")
+			log.Print("Webhook did not contain any of the `X-Github-Event`, `X-Gitlab-Event`, `X-Event-Key`, `X-Gitea-Event` or `X-Gogs-Event` headers")
 			http.Error(writer, fmt.Sprint(err), http.StatusExpectationFailed)
 			return
 		}
@@ -104,12 +184,224 @@ func main() {
 			return
 		}
 
+		// Dry runs are only honoured when the extension signed them, see acceptDryRun
+		if !isDryRun(request.Header) {
+			deliveries := deliveryCache(clientset, foundNamespace)
+			claimed, err := claimDelivery(deliveries, foundTriggerName, rawPayload)
+			if err != nil {
+				log.Printf("[%s] Error recording delivery %s in configmap %s: %s", foundTriggerName, deliveryID, deliveriesConfigMap, err.Error())
+				http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+				return
+			}
+			if !claimed {
+				msg := fmt.Sprintf("[%s] Validation FAIL (delivery %s was already accepted)", foundTriggerName, deliveryID)
+				log.Print(msg)
+				http.Error(writer, msg, http.StatusExpectationFailed)
+				return
+			}
+			defer func() {
+				if writer.status < http.StatusBadRequest {
+					return
+				}
+				if err := releaseDelivery(deliveries, foundTriggerName, rawPayload); err != nil {
+					log.Printf("[%s] Error forgetting failed delivery %s in configmap %s: %s", foundTriggerName, deliveryID, deliveriesConfigMap, err.Error())
+				}
+			}()
+		}
+
+		// Filters read the payload as the current provider API versions send it, see payloadversion.go
+		payload, versions, err := upgradePayload(provider, event, rawPayload)
+		if err != nil {
+			log.Printf("[%s] Error reading the payload as JSON: %s", foundTriggerName, err.Error())
+			http.Error(writer, fmt.Sprint(err), http.StatusBadRequest)
+			return
+		}
+		if len(versions) > 0 {
+			log.Printf("[%s] Upgraded the %s payload from: %s", foundTriggerName, event, strings.Join(versions, ", "))
+		}
+		if missing := missingFields(provider, event, payload); len(missing) > 0 {
+			log.Printf("[%s] The %s payload is missing %s, filters reading them may turn the event away", foundTriggerName, event, strings.Join(missing, ", "))
+		}
+
+		// Simulations of old events are only let through when the extension signed them, see acceptDryRun
+		if stale, age := isStaleEvent(provider, payload); stale && !isDryRun(request.Header) {
+			countStaleEvent(foundTriggerName)
+			msg := fmt.Sprintf("[%s] Validation FAIL (%s event %s is %s old, older than the maximum event age)", foundTriggerName, event, deliveryID, age.Round(time.Second))
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		allowed, reason, err := senderAllowed(request.Header, provider, payload, url, string(foundSecret.Data["accessToken"]))
+		if err != nil {
+			log.Printf("[%s] Error checking the sender of the event: %s", foundTriggerName, err.Error())
+			http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			msg := fmt.Sprintf("[%s] Validation FAIL (%s)", foundTriggerName, reason)
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		allowed, reason, err = pullRequestCommandAllowed(request.Header, provider, event, payload, url, foundSecret)
+		if err != nil {
+			log.Printf("[%s] Error checking the comment command or approval: %s", foundTriggerName, err.Error())
+			http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			msg := fmt.Sprintf("[%s] Validation FAIL (%s)", foundTriggerName, reason)
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		if !routedHere(request.Header, payload) {
+			msg := fmt.Sprintf("[%s] Validation FAIL (event routed to the webhook's other %s triggers)", foundTriggerName, otherRoute(request.Header.Get(CanaryRouteHeader)))
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		if !mainBranchRoutedHere(request.Header, payload) {
+			route := "main branch"
+			if request.Header.Get(MainRouteHeader) == "main" {
+				route = "push"
+			}
+			msg := fmt.Sprintf("[%s] Validation FAIL (event routed to the webhook's %s trigger)", foundTriggerName, route)
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		if !dependencyRoutedHere(request.Header, provider, payload) {
+			route := "dependency update"
+			if request.Header.Get(DependencyRouteHeader) == "dependency" {
+				route = "pull request"
+			}
+			msg := fmt.Sprintf("[%s] Validation FAIL (event routed to the webhook's %s trigger)", foundTriggerName, route)
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		fileRouted, fileRule, err := fileRuleRoutedHere(request.Header, provider, payload, url, string(foundSecret.Data["accessToken"]))
+		if err != nil {
+			log.Printf("[%s] Changed files not compared, routing the event to the webhook's pipeline: %s", foundTriggerName, err.Error())
+		}
+		if !fileRouted {
+			route := fmt.Sprintf("file rule %d", fileRule)
+			if fileRule == -1 {
+				route = "own"
+			}
+			msg := fmt.Sprintf("[%s] Validation FAIL (event routed to the webhook's %s trigger)", foundTriggerName, route)
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		if !labelRoutedHere(request.Header, provider, payload) {
+			msg := fmt.Sprintf("[%s] Validation FAIL (pull request not labelled %s)", foundTriggerName, request.Header.Get(RouteLabelHeader))
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		if !closedHere(request.Header, provider, payload) {
+			msg := fmt.Sprintf("[%s] Validation FAIL (merge request was not closed or merged by this event)", foundTriggerName)
+			log.Print(msg)
+			http.Error(writer, msg, http.StatusExpectationFailed)
+			return
+		}
+
+		if !isDryRun(request.Header) {
+			go publishAcceptedEvent(foundTriggerName, provider, event, deliveryID, url, returnPayload)
+			go syncManifest(foundTriggerName, event, url.String(), payload)
+			go refreshDefaultBranch(foundTriggerName, request.Header, url.String(), payload)
+			if request.Header.Get(CaptureHeader) == "true" {
+				go capturePayload(clientset, foundNamespace, foundTriggerName, deliveryID, capturedHeaders(request.Header), rawPayload)
+			}
+		}
+
+		if setName := request.Header.Get(VariableSetHeader); setName != "" {
+			variables, err := getVariables(clientset, foundNamespace, setName)
+			if err != nil {
+				log.Printf("[%s] Error getting variable set %s: %s", foundTriggerName, setName, err.Error())
+				http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+				return
+			}
+			returnPayload, err = addVariables(returnPayload, variables)
+			if err != nil {
+				log.Printf("[%s] Error adding variable set %s to the payload: %s", foundTriggerName, setName, err.Error())
+				http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		returnPayload, err = addPullRequest(returnPayload)
+		if err != nil {
+			log.Printf("[%s] Error adding the pull request to the payload: %s", foundTriggerName, err.Error())
+			http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+			return
+		}
+
+		returnPayload, err = addPullRequestMerged(returnPayload)
+		if err != nil {
+			log.Printf("[%s] Error adding whether the pull request was merged to the payload: %s", foundTriggerName, err.Error())
+			http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+			return
+		}
+
+		if prefix := request.Header.Get(PreviewPrefixHeader); prefix != "" {
+			var name string
+			returnPayload, name, err = addPreview(returnPayload, prefix, request.Header.Get(PreviewURLHeader))
+			if err != nil {
+				log.Printf("[%s] Error adding the preview environment to the payload: %s", foundTriggerName, err.Error())
+				http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+				return
+			}
+			if name != "" && !isDryRun(request.Header) {
+				number := strings.TrimPrefix(name, prefix+"-")
+				closed := request.Header.Get(PreviewTeardownHeader) != ""
+				if err := syncPreviewNamespace(clientset, foundNamespace, name, request.Header.Get(PreviewWebhookHeader), number, closed); err != nil {
+					log.Printf("[%s] Error preparing preview namespace %s: %s", foundTriggerName, name, err.Error())
+					http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+					return
+				}
+			}
+			if request.Header.Get(PreviewTeardownHeader) == closePreviewOnly {
+				msg := fmt.Sprintf("[%s] Validation FAIL (preview %s closed, the webhook has no teardown pipeline)", foundTriggerName, name)
+				log.Print(msg)
+				http.Error(writer, msg, http.StatusExpectationFailed)
+				return
+			}
+		}
+
+		record := newProvenance(provider, event, deliveryID, foundTriggerName, rawPayload)
+		if secretName := os.Getenv("PROVENANCE_SIGNING_SECRET"); secretName != "" {
+			key, err := getSigningKey(clientset, foundNamespace, secretName)
+			if err != nil {
+				log.Printf("[%s] Error getting the provenance signing key: %s", foundTriggerName, err.Error())
+				http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+				return
+			}
+			record.sign(key)
+		}
+		returnPayload, err = addProvenance(returnPayload, record)
+		if err != nil {
+			log.Printf("[%s] Error adding the provenance record to the payload: %s", foundTriggerName, err.Error())
+			http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+			return
+		}
+
 		_, err = writer.Write(returnPayload)
 		if err != nil {
 			log.Printf("[%s] Failed to write response. Error: %s", foundTriggerName, err.Error())
 			http.Error(writer, fmt.Sprint(err), http.StatusInternalServerError)
+			return
 		}
-
 	})
 
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", 8080), nil))
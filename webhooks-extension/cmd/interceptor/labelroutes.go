@@ -0,0 +1,70 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Set by the extension on the triggers of a webhook's label routes, the label the pull request needs
+const RouteLabelHeader = "Wext-Route-Label"
+
+// labelChange is the label a GitHub labeled event adds, and the labels before and after a GitLab merge request update
+type labelChange struct {
+	Action string `json:"action"`
+	Label  struct {
+		Name string `json:"name"`
+	} `json:"label"`
+	Changes struct {
+		Labels *struct {
+			Previous []struct {
+				Title string `json:"title"`
+			} `json:"previous"`
+			Current []struct {
+				Title string `json:"title"`
+			} `json:"current"`
+		} `json:"labels"`
+	} `json:"changes"`
+}
+
+// labelRoutedHere reports whether a label route's trigger should accept the event: the pull request must have the
+// label, and an event changing the labels must be the one adding it so other labels don't run the pipeline again
+func labelRoutedHere(header http.Header, provider string, payload []byte) bool {
+	label := header.Get(RouteLabelHeader)
+	if label == "" {
+		return true
+	}
+	change := labelChange{}
+	if err := json.Unmarshal(payload, &change); err != nil {
+		return false
+	}
+	if provider == "github" && change.Action == "labeled" {
+		return change.Label.Name == label
+	}
+	if provider == "gitlab" && change.Changes.Labels != nil {
+		for _, l := range change.Changes.Labels.Previous {
+			if l.Title == label {
+				return false
+			}
+		}
+		for _, l := range change.Changes.Labels.Current {
+			if l.Title == label {
+				return true
+			}
+		}
+		return false
+	}
+	return hasLabel(payload, label)
+}
@@ -0,0 +1,48 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLabelRoutedHere(t *testing.T) {
+	tests := []struct {
+		name       string
+		label      string
+		provider   string
+		payload    string
+		routedHere bool
+	}{
+		{"no route", "", "github", `{"action": "opened"}`, true},
+		{"opened with the label", "e2e", "github", `{"action": "opened", "pull_request": {"labels": [{"name": "e2e"}]}}`, true},
+		{"opened without the label", "e2e", "github", `{"action": "opened", "pull_request": {"labels": [{"name": "docs"}]}}`, false},
+		{"label added", "e2e", "github", `{"action": "labeled", "label": {"name": "e2e"}, "pull_request": {"labels": [{"name": "e2e"}]}}`, true},
+		{"other label added", "e2e", "github", `{"action": "labeled", "label": {"name": "docs"}, "pull_request": {"labels": [{"name": "e2e"}, {"name": "docs"}]}}`, false},
+		{"gitlab push with the label", "e2e", "gitlab", `{"labels": [{"title": "e2e"}]}`, true},
+		{"gitlab label added", "e2e", "gitlab", `{"labels": [{"title": "e2e"}], "changes": {"labels": {"previous": [], "current": [{"title": "e2e"}]}}}`, true},
+		{"gitlab other label added", "e2e", "gitlab", `{"labels": [{"title": "e2e"}, {"title": "docs"}], "changes": {"labels": {"previous": [{"title": "e2e"}], "current": [{"title": "e2e"}, {"title": "docs"}]}}}`, false},
+		{"gitlab label removed", "e2e", "gitlab", `{"labels": [], "changes": {"labels": {"previous": [{"title": "e2e"}], "current": []}}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(RouteLabelHeader, tt.label)
+			if got := labelRoutedHere(header, tt.provider, []byte(tt.payload)); got != tt.routedHere {
+				t.Errorf("routed here was %t, expected %t", got, tt.routedHere)
+			}
+		})
+	}
+}
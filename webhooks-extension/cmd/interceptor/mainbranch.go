@@ -0,0 +1,43 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	// The repository's default branch, set by the extension on all of the push triggers of a webhook with a main
+	// branch pipeline
+	MainBranchHeader = "Wext-Main-Branch"
+	// Set on the trigger running the main branch pipeline
+	MainRouteHeader = "Wext-Main-Route"
+)
+
+// mainBranchRoutedHere reports whether a push trigger should accept the event: the trigger running the main branch
+// pipeline accepts the pushes to the main branch, the webhook's other push triggers all the others
+func mainBranchRoutedHere(header http.Header, payload []byte) bool {
+	branch := header.Get(MainBranchHeader)
+	if branch == "" {
+		return true
+	}
+	push := struct {
+		Ref string `json:"ref"`
+	}{}
+	if err := json.Unmarshal(payload, &push); err != nil {
+		return false
+	}
+	return (push.Ref == "refs/heads/"+branch) == (header.Get(MainRouteHeader) == "main")
+}
@@ -0,0 +1,49 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMainBranchRoutedHere(t *testing.T) {
+	mainPush := []byte(`{"ref": "refs/heads/main", "after": "abc123"}`)
+	featurePush := []byte(`{"ref": "refs/heads/feature", "after": "abc123"}`)
+	tag := []byte(`{"ref": "refs/tags/main", "after": "abc123"}`)
+	tests := []struct {
+		name       string
+		branch     string
+		route      string
+		payload    []byte
+		routedHere bool
+	}{
+		{"no main branch pipeline", "", "", mainPush, true},
+		{"main push on the webhook's trigger", "main", "", mainPush, false},
+		{"main push on the main trigger", "main", "main", mainPush, true},
+		{"feature push on the webhook's trigger", "main", "", featurePush, true},
+		{"feature push on the main trigger", "main", "main", featurePush, false},
+		{"tag on the main trigger", "main", "main", tag, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(MainBranchHeader, tt.branch)
+			header.Set(MainRouteHeader, tt.route)
+			if got := mainBranchRoutedHere(header, tt.payload); got != tt.routedHere {
+				t.Errorf("routed here was %t, expected %t", got, tt.routedHere)
+			}
+		})
+	}
+}
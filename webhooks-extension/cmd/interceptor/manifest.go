@@ -0,0 +1,128 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// The webhook manifest a repository describes its webhooks in, see the extension's manifest.go
+	manifestPath = ".tekton/webhooks.yaml"
+	// Time a push is remembered for so that every trigger for the repository passing it asks for one sync
+	manifestPushTTL     = 5 * time.Minute
+	manifestSyncTimeout = 2 * time.Minute
+)
+
+// manifestPush is the part of a GitHub or GitLab push payload telling whether it changed the manifest
+type manifestPush struct {
+	Ref     string `json:"ref"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
+	} `json:"commits"`
+	// GitHub
+	Repository struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+	// GitLab
+	Project struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+var (
+	manifestPushesLock sync.Mutex
+	manifestPushes     = make(map[[sha256.Size]byte]time.Time)
+)
+
+// changesManifest is whether payload is a push to the default branch that changes the manifest
+func changesManifest(event string, payload []byte) bool {
+	if event != "push" && event != "Push Hook" {
+		return false
+	}
+	push := manifestPush{}
+	if err := json.Unmarshal(payload, &push); err != nil {
+		return false
+	}
+	defaultBranch := push.Repository.DefaultBranch
+	if defaultBranch == "" {
+		defaultBranch = push.Project.DefaultBranch
+	}
+	if defaultBranch == "" || push.Ref != "refs/heads/"+defaultBranch {
+		return false
+	}
+	for _, commit := range push.Commits {
+		for _, files := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range files {
+				if file == manifestPath {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// firstManifestPush records the push, returning false if it was already seen recently
+func firstManifestPush(payload []byte) bool {
+	sum := sha256.Sum256(payload)
+	manifestPushesLock.Lock()
+	defer manifestPushesLock.Unlock()
+	now := time.Now()
+	for key, seen := range manifestPushes {
+		if now.Sub(seen) > manifestPushTTL {
+			delete(manifestPushes, key)
+		}
+	}
+	if _, ok := manifestPushes[sum]; ok {
+		return false
+	}
+	manifestPushes[sum] = now
+	return true
+}
+
+// syncManifest asks the extension at MANIFEST_SYNC_URL to sync the repository's webhooks with its manifest
+// when the event is a push changing it
+func syncManifest(foundTriggerName, event, repoURL string, payload []byte) {
+	syncURL := os.Getenv("MANIFEST_SYNC_URL")
+	if syncURL == "" || !changesManifest(event, payload) || !firstManifestPush(payload) {
+		return
+	}
+	body, err := json.Marshal(map[string]string{"gitrepositoryurl": repoURL})
+	if err != nil {
+		log.Printf("[%s] Error marshalling manifest sync request: %s", foundTriggerName, err.Error())
+		return
+	}
+	client := http.Client{Timeout: manifestSyncTimeout}
+	resp, err := client.Post(syncURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[%s] Error asking %s to sync the manifest of %s: %s", foundTriggerName, syncURL, repoURL, err.Error())
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[%s] Error asking %s to sync the manifest of %s: status %d", foundTriggerName, syncURL, repoURL, resp.StatusCode)
+		return
+	}
+	log.Printf("[%s] Synced the manifest of %s", foundTriggerName, repoURL)
+}
@@ -0,0 +1,67 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestChangesManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    string
+		payload  string
+		expected bool
+	}{
+		{"github push changing the manifest", "push",
+			`{"ref":"refs/heads/main","repository":{"default_branch":"main"},"commits":[{"modified":["README.md"]},{"added":[".tekton/webhooks.yaml"]}]}`, true},
+		{"gitlab push removing the manifest", "Push Hook",
+			`{"ref":"refs/heads/master","project":{"default_branch":"master"},"commits":[{"removed":[".tekton/webhooks.yaml"]}]}`, true},
+		{"push to another branch", "push",
+			`{"ref":"refs/heads/feature","repository":{"default_branch":"main"},"commits":[{"modified":[".tekton/webhooks.yaml"]}]}`, false},
+		{"push not changing the manifest", "push",
+			`{"ref":"refs/heads/main","repository":{"default_branch":"main"},"commits":[{"modified":[".tekton/pipeline.yaml"]}]}`, false},
+		{"pull request", "pull_request",
+			`{"ref":"refs/heads/main","repository":{"default_branch":"main"},"commits":[{"modified":[".tekton/webhooks.yaml"]}]}`, false},
+	}
+	for _, tt := range tests {
+		if changed := changesManifest(tt.event, []byte(tt.payload)); changed != tt.expected {
+			t.Errorf("%s: expected %t, got %t", tt.name, tt.expected, changed)
+		}
+	}
+}
+
+func TestSyncManifest(t *testing.T) {
+	requests := []map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+	}))
+	defer server.Close()
+	os.Setenv("MANIFEST_SYNC_URL", server.URL)
+	defer os.Unsetenv("MANIFEST_SYNC_URL")
+
+	payload := []byte(`{"ref":"refs/heads/main","repository":{"default_branch":"main"},"commits":[{"modified":[".tekton/webhooks.yaml"]}],"after":"abc123"}`)
+	// Both triggers for the repository pass the same push
+	syncManifest("hook-default-push-event", "push", "https://github.com/foo/bar", payload)
+	syncManifest("hook-default-pullrequest-event", "push", "https://github.com/foo/bar", payload)
+	if len(requests) != 1 || requests[0]["gitrepositoryurl"] != "https://github.com/foo/bar" {
+		t.Errorf("expected one sync of https://github.com/foo/bar, got %+v", requests)
+	}
+}
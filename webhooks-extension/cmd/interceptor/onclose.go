@@ -0,0 +1,78 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// Set by the extension on the triggers running when a pull request is closed or merged
+	CloseEventHeader = "Wext-Close-Event"
+	// Payload field the on close pipeline's binding reads whether the pull request was merged from
+	pullRequestMergedField = "webhooks-tekton-pull-request-merged"
+)
+
+// closeEvent reads what the interceptor needs of a closed pull or merge request
+type closeEvent struct {
+	PullRequest struct {
+		Merged bool `json:"merged"`
+	} `json:"pull_request"`
+	ObjectKind       string `json:"object_kind"`
+	ObjectAttributes struct {
+		Action string `json:"action"`
+		State  string `json:"state"`
+	} `json:"object_attributes"`
+	// Bitbucket
+	BitbucketPullRequest struct {
+		State string `json:"state"`
+	} `json:"pullrequest"`
+}
+
+// closedHere reports whether a trigger should accept the event: the triggers running on close accept GitLab merge
+// requests only when they are closed or merged, not updates to merge requests that already are, whose state is
+// the same. GitHub only sends the closed action when a pull request is closed.
+func closedHere(header http.Header, provider string, payload []byte) bool {
+	if header.Get(CloseEventHeader) == "" || provider != "gitlab" {
+		return true
+	}
+	event := closeEvent{}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return false
+	}
+	return event.ObjectAttributes.Action == "close" || event.ObjectAttributes.Action == "merge"
+}
+
+// addPullRequestMerged returns the payload with whether the pull or merge request the event is for was merged,
+// "true" or "false", added under webhooks-tekton-pull-request-merged
+func addPullRequestMerged(payload []byte) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	event := closeEvent{}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	merged := event.PullRequest.Merged || (event.ObjectKind == "merge_request" && event.ObjectAttributes.State == "merged") ||
+		event.BitbucketPullRequest.State == "MERGED"
+	mergedJSON, err := json.Marshal(strconv.FormatBool(merged))
+	if err != nil {
+		return nil, err
+	}
+	fields[pullRequestMergedField] = mergedJSON
+	return json.Marshal(fields)
+}
@@ -0,0 +1,72 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestClosedHere(t *testing.T) {
+	tests := []struct {
+		name       string
+		closeEvent string
+		provider   string
+		payload    string
+		closedHere bool
+	}{
+		{"not a close trigger", "", "gitlab", `{"object_attributes": {"action": "update", "state": "closed"}}`, true},
+		{"github", "true", "github", `{"action": "closed"}`, true},
+		{"gitlab close", "true", "gitlab", `{"object_attributes": {"action": "close", "state": "closed"}}`, true},
+		{"gitlab merge", "true", "gitlab", `{"object_attributes": {"action": "merge", "state": "merged"}}`, true},
+		{"gitlab update to a closed merge request", "true", "gitlab", `{"object_attributes": {"action": "update", "state": "closed"}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(CloseEventHeader, tt.closeEvent)
+			if got := closedHere(header, tt.provider, []byte(tt.payload)); got != tt.closedHere {
+				t.Errorf("closed here was %t, expected %t", got, tt.closedHere)
+			}
+		})
+	}
+}
+
+func TestAddPullRequestMerged(t *testing.T) {
+	tests := []struct {
+		payload, expected string
+	}{
+		{`{"action":"closed","pull_request":{"number":12,"merged":true}}`, "true"},
+		{`{"action":"closed","pull_request":{"number":12,"merged":false}}`, "false"},
+		{`{"object_kind":"merge_request","object_attributes":{"iid":7,"state":"merged"}}`, "true"},
+		{`{"object_kind":"merge_request","object_attributes":{"iid":7,"state":"closed"}}`, "false"},
+		{`{"pullrequest":{"id":3,"state":"MERGED"}}`, "true"},
+		{`{"pullrequest":{"id":3,"state":"DECLINED"}}`, "false"},
+		{`{"ref":"refs/heads/master","after":"abc123"}`, "false"},
+	}
+	for _, test := range tests {
+		result, err := addPullRequestMerged([]byte(test.payload))
+		if err != nil {
+			t.Fatalf("error adding whether the pull request was merged to %s: %s", test.payload, err.Error())
+		}
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal(result, &fields); err != nil {
+			t.Fatalf("error reading %s: %s", string(result), err.Error())
+		}
+		if merged := fields[pullRequestMergedField]; merged != test.expected {
+			t.Errorf("expected merged %q from %s, got %v", test.expected, test.payload, merged)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const (
+	// Used if MAX_PAYLOAD_BYTES isn't set, the largest payload GitHub sends
+	defaultMaxPayloadBytes = 25 * 1024 * 1024
+)
+
+// payloadTooLargeError is returned reading a payload larger than MAX_PAYLOAD_BYTES
+type payloadTooLargeError struct {
+	limit int64
+}
+
+func (e payloadTooLargeError) Error() string {
+	return fmt.Sprintf("the payload is larger than the limit of %d bytes", e.limit)
+}
+
+func getMaxPayloadBytes() int64 {
+	if limit, err := strconv.ParseInt(os.Getenv("MAX_PAYLOAD_BYTES"), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultMaxPayloadBytes
+}
+
+// readPayload reads the request body, refusing one larger than MAX_PAYLOAD_BYTES before reading it when it
+// declares its length and otherwise once more than that has been read
+func readPayload(request *http.Request) ([]byte, error) {
+	limit := getMaxPayloadBytes()
+	if request.ContentLength > limit {
+		return nil, payloadTooLargeError{limit: limit}
+	}
+	payload, err := ioutil.ReadAll(io.LimitReader(request.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(payload)) > limit {
+		return nil, payloadTooLargeError{limit: limit}
+	}
+	return payload, nil
+}
@@ -0,0 +1,48 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadPayload(t *testing.T) {
+	os.Setenv("MAX_PAYLOAD_BYTES", "16")
+	defer os.Unsetenv("MAX_PAYLOAD_BYTES")
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader(`{"ref":"master"}`))
+	if payload, err := readPayload(request); err != nil || string(payload) != `{"ref":"master"}` {
+		t.Errorf("expected a payload at the limit to be read, got %s, %v", string(payload), err)
+	}
+
+	request = httptest.NewRequest("POST", "/", strings.NewReader(`{"ref":"develop"}`))
+	if _, err := readPayload(request); err == nil {
+		t.Error("expected an error for a payload declaring a length over the limit")
+	} else if _, tooLarge := err.(payloadTooLargeError); !tooLarge {
+		t.Errorf("unexpected error %s", err.Error())
+	}
+
+	// Sent in chunks
+	request = httptest.NewRequest("POST", "/", ioutil.NopCloser(strings.NewReader(`{"ref":"develop"}`)))
+	request.ContentLength = -1
+	if _, err := readPayload(request); err == nil {
+		t.Error("expected an error for a payload of unknown length over the limit")
+	} else if _, tooLarge := err.(payloadTooLargeError); !tooLarge {
+		t.Errorf("unexpected error %s", err.Error())
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// payloadUpgrade converts the payloads of one provider API version into the shape the interceptor's validation and
+// filters read, that of the current GitHub and GitLab versions, so that events from older GitHub Enterprise or
+// GitLab instances, or from a provider changing its payloads, are filtered the same way
+type payloadUpgrade struct {
+	provider string
+	// The payload version upgraded from, logged when an event is upgraded
+	version string
+	applies func(event string, fields map[string]interface{}) bool
+	upgrade func(fields map[string]interface{})
+}
+
+// payloadUpgrades are applied in order, each to the payloads of its provider it applies to
+var payloadUpgrades = []payloadUpgrade{
+	{
+		// GitHub Enterprise 2.x names the default branch master_branch in push events
+		provider: "github",
+		version:  "master_branch",
+		applies: func(event string, fields map[string]interface{}) bool {
+			_, hasDefault := lookupField(fields, "repository.default_branch")
+			_, hasMaster := lookupField(fields, "repository.master_branch")
+			return hasMaster && !hasDefault
+		},
+		upgrade: func(fields map[string]interface{}) {
+			repository := fields["repository"].(map[string]interface{})
+			repository["default_branch"] = repository["master_branch"]
+		},
+	},
+	{
+		// GitLab before 8.5 sends push events without the project, only its repository and id
+		provider: "gitlab",
+		version:  "push without project",
+		applies: func(event string, fields map[string]interface{}) bool {
+			_, hasProject := lookupField(fields, "project")
+			_, hasRepository := lookupField(fields, "repository.git_http_url")
+			return (event == "Push Hook" || event == "Tag Push Hook") && !hasProject && hasRepository
+		},
+		upgrade: func(fields map[string]interface{}) {
+			repository := fields["repository"].(map[string]interface{})
+			fields["project"] = map[string]interface{}{
+				"id":           fields["project_id"],
+				"git_http_url": repository["git_http_url"],
+				"git_ssh_url":  repository["git_ssh_url"],
+				"web_url":      repository["homepage"],
+			}
+		},
+	},
+	{
+		// GitLab before 8.x sends merge request events without the action, only the merge request's state
+		provider: "gitlab",
+		version:  "merge request without action",
+		applies: func(event string, fields map[string]interface{}) bool {
+			_, hasAction := lookupField(fields, "object_attributes.action")
+			_, hasState := lookupField(fields, "object_attributes.state")
+			return event == "Merge Request Hook" && !hasAction && hasState
+		},
+		upgrade: func(fields map[string]interface{}) {
+			attributes := fields["object_attributes"].(map[string]interface{})
+			actions := map[string]string{"opened": "open", "reopened": "reopen", "closed": "close", "merged": "merge"}
+			state, _ := attributes["state"].(string)
+			if action, known := actions[state]; known {
+				attributes["action"] = action
+			} else {
+				attributes["action"] = "update"
+			}
+		},
+	},
+	{
+		// GitLab sends merge request labels under object_attributes, and only there in some versions
+		provider: "gitlab",
+		version:  "labels under object_attributes",
+		applies: func(event string, fields map[string]interface{}) bool {
+			_, hasLabels := lookupField(fields, "labels")
+			_, hasAttributeLabels := lookupField(fields, "object_attributes.labels")
+			return event == "Merge Request Hook" && !hasLabels && hasAttributeLabels
+		},
+		upgrade: func(fields map[string]interface{}) {
+			fields["labels"] = fields["object_attributes"].(map[string]interface{})["labels"]
+		},
+	},
+}
+
+// currentFields are the fields, by provider and event, of the current payload versions that the interceptor's
+// validation and filters read
+var currentFields = map[string]map[string][]string{
+	"github": {
+		"push":         {"ref", "repository.clone_url", "repository.default_branch", "sender.login"},
+		"pull_request": {"action", "pull_request.number", "pull_request.head.ref", "repository.clone_url", "sender.login"},
+	},
+	"gitlab": {
+		"Push Hook":          {"ref", "project.id", "repository.git_http_url", "user_username"},
+		"Merge Request Hook": {"object_attributes.action", "object_attributes.iid", "object_attributes.target.git_http_url", "user.username"},
+	},
+}
+
+// lookupField finds a field of the payload by its dotted path, e.g. repository.clone_url
+func lookupField(fields map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = fields
+	for _, name := range strings.Split(path, ".") {
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return nil, false
+		}
+		if value, isObject = object[name]; !isObject || value == nil {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// upgradePayload returns the payload in the shape of the current payload versions, and the versions it was upgraded
+// from. Payloads already in that shape are returned as they are.
+func upgradePayload(provider, event string, payload []byte) ([]byte, []string, error) {
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, nil, err
+	}
+	versions := []string{}
+	for _, upgrade := range payloadUpgrades {
+		if upgrade.provider == provider && upgrade.applies(event, fields) {
+			upgrade.upgrade(fields)
+			versions = append(versions, upgrade.version)
+		}
+	}
+	if len(versions) == 0 {
+		return payload, versions, nil
+	}
+	upgraded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return upgraded, versions, nil
+}
+
+// missingFields are the fields of the current payload version for the event that the payload doesn't have, which
+// the interceptor can't filter on
+func missingFields(provider, event string, payload []byte) []string {
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil
+	}
+	missing := []string{}
+	for _, path := range currentFields[provider][event] {
+		if _, found := lookupField(fields, path); !found {
+			missing = append(missing, path)
+		}
+	}
+	return missing
+}
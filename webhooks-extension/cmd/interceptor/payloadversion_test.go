@@ -0,0 +1,99 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// The same events as sent by different provider API versions
+var payloadFixtures = []struct {
+	name     string
+	provider string
+	event    string
+	payload  string
+	versions []string
+}{
+	{"github push", "github", "push",
+		`{"ref":"refs/heads/main","repository":{"clone_url":"https://github.com/foo/bar.git","default_branch":"main"},"sender":{"login":"foo"}}`,
+		[]string{}},
+	{"github enterprise 2.x push", "github", "push",
+		`{"ref":"refs/heads/main","repository":{"clone_url":"https://github.com/foo/bar.git","master_branch":"main"},"sender":{"login":"foo"}}`,
+		[]string{"master_branch"}},
+	{"gitlab push", "gitlab", "Push Hook",
+		`{"ref":"refs/heads/main","project_id":15,"project":{"id":15,"git_http_url":"https://gitlab.com/foo/bar.git"},"repository":{"git_http_url":"https://gitlab.com/foo/bar.git"},"user_username":"foo"}`,
+		[]string{}},
+	{"gitlab 8.4 push", "gitlab", "Push Hook",
+		`{"ref":"refs/heads/main","project_id":15,"repository":{"git_http_url":"https://gitlab.com/foo/bar.git"},"user_username":"foo"}`,
+		[]string{"push without project"}},
+	{"gitlab merge", "gitlab", "Merge Request Hook",
+		`{"object_kind":"merge_request","user":{"username":"foo"},"labels":[{"title":"canary"}],"object_attributes":{"iid":1,"action":"merge","state":"merged","target":{"git_http_url":"https://gitlab.com/foo/bar.git"}}}`,
+		[]string{}},
+	{"gitlab 8.0 merge", "gitlab", "Merge Request Hook",
+		`{"object_kind":"merge_request","user":{"username":"foo"},"object_attributes":{"iid":1,"state":"merged","labels":[{"title":"canary"}],"target":{"git_http_url":"https://gitlab.com/foo/bar.git"}}}`,
+		[]string{"merge request without action", "labels under object_attributes"}},
+}
+
+func TestUpgradePayload(t *testing.T) {
+	for _, fixture := range payloadFixtures {
+		payload, versions, err := upgradePayload(fixture.provider, fixture.event, []byte(fixture.payload))
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", fixture.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(versions, fixture.versions) {
+			t.Errorf("%s: expected to be upgraded from %v, got %v", fixture.name, fixture.versions, versions)
+		}
+		if len(versions) == 0 && string(payload) != fixture.payload {
+			t.Errorf("%s: expected the current version to be left as it is, got %s", fixture.name, payload)
+		}
+		if missing := missingFields(fixture.provider, fixture.event, payload); len(missing) != 0 {
+			t.Errorf("%s: upgraded payload is missing %v", fixture.name, missing)
+		}
+	}
+}
+
+func TestUpgradedPayloadsFilter(t *testing.T) {
+	header := http.Header{}
+	header.Set(CloseEventHeader, "true")
+	header.Set(RouteLabelHeader, "canary")
+	for _, fixture := range payloadFixtures {
+		payload, _, err := upgradePayload(fixture.provider, fixture.event, []byte(fixture.payload))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", fixture.name, err)
+		}
+		switch fixture.event {
+		case "push":
+			if branch := eventDefaultBranch(payload); branch != "main" {
+				t.Errorf("%s: expected the default branch main, got %q", fixture.name, branch)
+			}
+		case "Merge Request Hook":
+			if !closedHere(header, fixture.provider, payload) || !labelRoutedHere(header, fixture.provider, payload) {
+				t.Errorf("%s: expected the merged and labelled merge request to be accepted", fixture.name)
+			}
+		}
+	}
+}
+
+func TestMissingFields(t *testing.T) {
+	missing := missingFields("github", "pull_request", []byte(`{"action":"opened","pull_request":{"number":1},"sender":{"login":"foo"}}`))
+	if !reflect.DeepEqual(missing, []string{"pull_request.head.ref", "repository.clone_url"}) {
+		t.Errorf("unexpected missing fields %v", missing)
+	}
+	if missing := missingFields("github", "issues", []byte(`{}`)); len(missing) != 0 {
+		t.Errorf("expected no fields to be known for issues events, got %v", missing)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Set by the extension on the triggers of a webhook with preview environments
+	PreviewPrefixHeader  = "Wext-Preview-Prefix"
+	PreviewURLHeader     = "Wext-Preview-Url"
+	PreviewWebhookHeader = "Wext-Preview-Webhook"
+	// Set on the trigger closing previews when a pull request is closed, teardown when it runs the webhook's
+	// teardown pipeline and close when the webhook has none
+	PreviewTeardownHeader = "Wext-Preview-Teardown"
+	closePreviewOnly      = "close"
+	// Payload fields the webhook's TriggerBinding reads the preview's name and URL from
+	previewNameField = "webhooks-tekton-preview-name"
+	previewURLField  = "webhooks-tekton-preview-url"
+	// Labels of a preview namespace
+	previewLabel            = "webhooks.tekton.dev/preview"
+	previewPullRequestLabel = "webhooks.tekton.dev/pullRequest"
+	managedByLabel          = "app.kubernetes.io/managed-by"
+	extensionLabelValue     = "tekton-webhooks-extension"
+	// Configmap in the install namespace listing closed previews with when they were closed, the extension listing
+	// those whose teardown is done for an operator to delete their namespaces. Namespaces aren't marked themselves so
+	// the extension needn't update namespaces.
+	closedPreviewsConfigMap = "webhooks-extension-closed-previews"
+	// Times marking a preview closed is tried when other replicas update the configmap at the same time
+	closedPreviewsAttempts = 5
+)
+
+// addPreview returns the payload with the name of the pull request's preview environment, <prefix>-<number>, and
+// its URL, {name} in the URL template replaced by the name, added. Both are empty for events other than pull
+// requests, as a TriggerBinding fails on a missing field.
+func addPreview(payload []byte, prefix, urlTemplate string) ([]byte, string, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, "", err
+	}
+	number, err := pullRequestNumber(payload)
+	if err != nil {
+		return nil, "", err
+	}
+	name, url := "", ""
+	if number != "" {
+		name = prefix + "-" + number
+		url = strings.Replace(urlTemplate, "{name}", name, -1)
+	}
+	for field, value := range map[string]string{previewNameField: name, previewURLField: url} {
+		valueJSON, err := json.Marshal(value)
+		if err != nil {
+			return nil, "", err
+		}
+		fields[field] = valueJSON
+	}
+	result, err := json.Marshal(fields)
+	return result, name, err
+}
+
+// syncPreviewNamespace creates the namespace of a pull request's preview environment, labelled with the webhook it
+// is a preview of, or when the pull request is closed marks it closed for the extension to list as deletable once
+// the teardown pipeline has run. Reopening the pull request unmarks it.
+func syncPreviewNamespace(clientset kubernetes.Interface, installNamespace, name, webhook, number string, closed bool) error {
+	namespace, err := clientset.CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		if closed {
+			return nil
+		}
+		namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"app.kubernetes.io/part-of": extensionLabelValue,
+				managedByLabel:              extensionLabelValue,
+				previewLabel:                webhook,
+				previewPullRequestLabel:     number,
+			},
+		}}
+		_, err = clientset.CoreV1().Namespaces().Create(namespace)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if namespace.Labels[previewLabel] != webhook || namespace.Labels[managedByLabel] != extensionLabelValue {
+		return fmt.Errorf("namespace %s exists and is not a preview of webhook %s", name, webhook)
+	}
+	return markPreviewClosed(clientset, installNamespace, name, closed)
+}
+
+// markPreviewClosed adds the preview to, or removes it from, the closed previews configmap
+func markPreviewClosed(clientset kubernetes.Interface, installNamespace, name string, closed bool) error {
+	configMaps := clientset.CoreV1().ConfigMaps(installNamespace)
+	for attempt := 1; ; attempt++ {
+		cm, err := configMaps.Get(closedPreviewsConfigMap, metav1.GetOptions{})
+		found := err == nil
+		if k8serrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: closedPreviewsConfigMap, Namespace: installNamespace}}
+		} else if err != nil {
+			return err
+		}
+		if _, marked := cm.Data[name]; marked == closed {
+			return nil
+		}
+		if closed {
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+			cm.Data[name] = time.Now().UTC().Format(time.RFC3339)
+		} else {
+			delete(cm.Data, name)
+		}
+		if found {
+			_, err = configMaps.Update(cm)
+		} else {
+			_, err = configMaps.Create(cm)
+		}
+		// Another replica changed the configmap first, try again with its changes
+		if err == nil || (!k8serrors.IsConflict(err) && !k8serrors.IsAlreadyExists(err)) || attempt == closedPreviewsAttempts {
+			return err
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAddPreview(t *testing.T) {
+	tests := []struct {
+		payload string
+		name    string
+		url     string
+	}{
+		{`{"pull_request": {"number": 123}}`, "pr-123", "https://pr-123.preview.example.com"},
+		{`{"object_kind": "merge_request", "object_attributes": {"iid": 7}}`, "pr-7", "https://pr-7.preview.example.com"},
+		{`{"ref": "refs/heads/master"}`, "", ""},
+	}
+	for _, tt := range tests {
+		result, name, err := addPreview([]byte(tt.payload), "pr", "https://{name}.preview.example.com")
+		if err != nil {
+			t.Fatalf("error adding preview to %s: %s", tt.payload, err)
+		}
+		fields := map[string]interface{}{}
+		json.Unmarshal(result, &fields)
+		if name != tt.name || fields[previewNameField] != tt.name || fields[previewURLField] != tt.url {
+			t.Errorf("preview of %s was %s, %v and %v, expected %s and %s", tt.payload, name, fields[previewNameField], fields[previewURLField], tt.name, tt.url)
+		}
+	}
+}
+
+func TestSyncPreviewNamespace(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset()
+	closedPreviews := func() map[string]string {
+		cm, _ := clientset.CoreV1().ConfigMaps("tekton-pipelines").Get(closedPreviewsConfigMap, metav1.GetOptions{})
+		if cm == nil {
+			return nil
+		}
+		return cm.Data
+	}
+	if err := syncPreviewNamespace(clientset, "tekton-pipelines", "pr-1", "hook-default", "1", false); err != nil {
+		t.Fatalf("error creating preview namespace: %s", err)
+	}
+	namespace, err := clientset.CoreV1().Namespaces().Get("pr-1", metav1.GetOptions{})
+	if err != nil || namespace.Labels[previewLabel] != "hook-default" || namespace.Labels[previewPullRequestLabel] != "1" ||
+		namespace.Labels[managedByLabel] != extensionLabelValue {
+		t.Fatalf("preview namespace was %+v, %v", namespace, err)
+	}
+
+	if err := syncPreviewNamespace(clientset, "tekton-pipelines", "pr-1", "hook-default", "1", true); err != nil {
+		t.Fatalf("error closing preview namespace: %s", err)
+	}
+	if _, marked := closedPreviews()["pr-1"]; !marked {
+		t.Error("expected the closed preview to be marked")
+	}
+
+	if err := syncPreviewNamespace(clientset, "tekton-pipelines", "pr-1", "hook-default", "1", false); err != nil {
+		t.Fatalf("error reopening preview namespace: %s", err)
+	}
+	if _, marked := closedPreviews()["pr-1"]; marked {
+		t.Error("expected the reopened preview to be unmarked")
+	}
+
+	clientset.CoreV1().Namespaces().Create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "pr-2"}})
+	if err := syncPreviewNamespace(clientset, "tekton-pipelines", "pr-2", "hook-default", "2", true); err == nil {
+		t.Error("expected an error for a namespace that isn't a preview")
+	}
+	clientset.CoreV1().Namespaces().Create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "pr-4",
+		Labels: map[string]string{previewLabel: "hook-default"}}})
+	if err := syncPreviewNamespace(clientset, "tekton-pipelines", "pr-4", "hook-default", "4", true); err == nil {
+		t.Error("expected an error for a namespace labelled a preview that the extension didn't create")
+	}
+	if _, marked := closedPreviews()["pr-4"]; marked {
+		t.Error("a namespace the extension didn't create was marked a closed preview")
+	}
+	if err := syncPreviewNamespace(clientset, "tekton-pipelines", "pr-3", "hook-default", "3", true); err != nil {
+		t.Errorf("unexpected error closing a pull request without a preview namespace: %s", err)
+	}
+	if _, err := clientset.CoreV1().Namespaces().Get("pr-3", metav1.GetOptions{}); err == nil {
+		t.Error("closing a pull request created its preview namespace")
+	}
+}
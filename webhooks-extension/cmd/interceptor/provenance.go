@@ -0,0 +1,120 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Payload field the webhook's TriggerBinding reads the provenance record from
+	provenanceField = "webhooks-tekton-provenance"
+	// Key of the HMAC signing key in the secret named by PROVENANCE_SIGNING_SECRET
+	provenanceSigningKey = "signingKey"
+)
+
+// provenance records the delivery a PipelineRun was triggered by. Every field is
+// always present as a TriggerBinding fails on a missing field.
+type provenance struct {
+	DeliveryID    string `json:"deliveryid"`
+	Event         string `json:"event"`
+	Sender        string `json:"sender"`
+	PayloadDigest string `json:"payloaddigest"`
+	Trigger       string `json:"trigger"`
+	Signature     string `json:"signature"`
+}
+
+// newProvenance returns the record of a delivery, raw being the payload as delivered
+func newProvenance(provider, event, deliveryID, trigger string, raw []byte) provenance {
+	digest := sha256.Sum256(raw)
+	return provenance{
+		DeliveryID:    deliveryID,
+		Event:         event,
+		Sender:        getSender(provider, raw),
+		PayloadDigest: "sha256:" + hex.EncodeToString(digest[:]),
+		Trigger:       trigger,
+	}
+}
+
+// getSender returns the login of the user who caused the delivery
+func getSender(provider string, raw []byte) string {
+	payload := struct {
+		Sender struct {
+			Login string `json:"login"`
+		} `json:"sender"`
+		UserUsername string `json:"user_username"`
+		User         struct {
+			Username string `json:"username"`
+		} `json:"user"`
+	}{}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return ""
+	}
+	if provider == "github" {
+		return payload.Sender.Login
+	}
+	// GitLab push events have user_username, merge request events a user object
+	if payload.UserUsername != "" {
+		return payload.UserUsername
+	}
+	return payload.User.Username
+}
+
+// signedContent is what a provenance signature is over, one field per line
+func (p provenance) signedContent() []byte {
+	return []byte(fmt.Sprintf("deliveryid=%s\nevent=%s\nsender=%s\npayloaddigest=%s\ntrigger=%s",
+		p.DeliveryID, p.Event, p.Sender, p.PayloadDigest, p.Trigger))
+}
+
+// sign sets the record's signature, the hex HMAC-SHA256 of its signed content
+func (p *provenance) sign(key []byte) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(p.signedContent())
+	p.Signature = hex.EncodeToString(mac.Sum(nil))
+}
+
+// getSigningKey returns the provenance signing key from the named secret in the install namespace
+func getSigningKey(clientset kubernetes.Interface, namespace, secretName string) ([]byte, error) {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	key := secret.Data[provenanceSigningKey]
+	if len(key) == 0 {
+		return nil, fmt.Errorf("secret %s has no %s", secretName, provenanceSigningKey)
+	}
+	return key, nil
+}
+
+// addProvenance returns the payload with the provenance record added under webhooks-tekton-provenance,
+// other fields are left as they were
+func addProvenance(payload []byte, record provenance) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	fields[provenanceField] = recordJSON
+	return json.Marshal(fields)
+}
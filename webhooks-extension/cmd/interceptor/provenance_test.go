@@ -0,0 +1,87 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewProvenance(t *testing.T) {
+	raw := []byte(`{"ref":"refs/heads/master","sender":{"login":"octocat"}}`)
+	record := newProvenance("github", "push", "72d3162e", "hook-default-push-event", raw)
+
+	digest := sha256.Sum256(raw)
+	expected := provenance{
+		DeliveryID:    "72d3162e",
+		Event:         "push",
+		Sender:        "octocat",
+		PayloadDigest: "sha256:" + hex.EncodeToString(digest[:]),
+		Trigger:       "hook-default-push-event",
+	}
+	if record != expected {
+		t.Errorf("expected provenance %+v, got %+v", expected, record)
+	}
+
+	gitlabPush := newProvenance("gitlab", "Push Hook", "", "t", []byte(`{"user_username":"pusher"}`))
+	gitlabMerge := newProvenance("gitlab", "Merge Request Hook", "", "t", []byte(`{"user":{"username":"merger"}}`))
+	if gitlabPush.Sender != "pusher" || gitlabMerge.Sender != "merger" {
+		t.Errorf("expected GitLab senders pusher and merger, got %s and %s", gitlabPush.Sender, gitlabMerge.Sender)
+	}
+}
+
+func TestSignAndAddProvenance(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "provenance", Namespace: "tekton-pipelines"},
+		Data:       map[string][]byte{"signingKey": []byte("key")},
+	})
+	key, err := getSigningKey(clientset, "tekton-pipelines", "provenance")
+	if err != nil {
+		t.Fatalf("error getting signing key: %s", err.Error())
+	}
+
+	record := newProvenance("github", "push", "72d3162e", "hook-default-push-event", []byte(`{}`))
+	record.sign(key)
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write([]byte("deliveryid=72d3162e\nevent=push\nsender=\npayloaddigest=" + record.PayloadDigest + "\ntrigger=hook-default-push-event"))
+	if record.Signature != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("unexpected signature %s", record.Signature)
+	}
+
+	payload, err := addProvenance([]byte(`{"ref":"refs/heads/master"}`), record)
+	if err != nil {
+		t.Fatalf("error adding provenance: %s", err.Error())
+	}
+	result := struct {
+		Ref        string     `json:"ref"`
+		Provenance provenance `json:"webhooks-tekton-provenance"`
+	}{}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		t.Fatalf("error reading payload: %s", err.Error())
+	}
+	if result.Ref != "refs/heads/master" || result.Provenance != record {
+		t.Errorf("unexpected payload %s", payload)
+	}
+
+	if _, err := getSigningKey(clientset, "tekton-pipelines", "missing"); err == nil {
+		t.Error("expected an error for a missing signing secret")
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Payload field the webhook's TriggerBinding reads the pull or merge request number from
+const pullRequestField = "webhooks-tekton-pull-request"
+
+// addPullRequest returns the payload with the number of the GitHub pull request or GitLab merge
+// request the event is for added under webhooks-tekton-pull-request. The field is empty for other
+// events, such as pushes, as a TriggerBinding fails on a missing field.
+func addPullRequest(payload []byte) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	number, err := pullRequestNumber(payload)
+	if err != nil {
+		return nil, err
+	}
+	numberJSON, err := json.Marshal(number)
+	if err != nil {
+		return nil, err
+	}
+	fields[pullRequestField] = numberJSON
+	return json.Marshal(fields)
+}
+
+// pullRequestNumber returns the number of the pull or merge request the event is for, empty for other events
+func pullRequestNumber(payload []byte) (string, error) {
+	event := struct {
+		PullRequest struct {
+			Number int `json:"number"`
+		} `json:"pull_request"`
+		ObjectKind       string `json:"object_kind"`
+		ObjectAttributes struct {
+			IID int `json:"iid"`
+		} `json:"object_attributes"`
+	}{}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return "", err
+	}
+	if event.PullRequest.Number > 0 {
+		return strconv.Itoa(event.PullRequest.Number), nil
+	}
+	if event.ObjectKind == "merge_request" && event.ObjectAttributes.IID > 0 {
+		return strconv.Itoa(event.ObjectAttributes.IID), nil
+	}
+	return "", nil
+}
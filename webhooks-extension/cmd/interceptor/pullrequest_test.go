@@ -0,0 +1,50 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddPullRequest(t *testing.T) {
+	tests := []struct {
+		payload, expected string
+	}{
+		{`{"action":"opened","number":12,"pull_request":{"number":12}}`, "12"},
+		{`{"object_kind":"merge_request","object_attributes":{"iid":7}}`, "7"},
+		{`{"ref":"refs/heads/master","after":"abc123"}`, ""},
+		{`{"object_kind":"push","ref":"refs/heads/master","object_attributes":{"iid":7}}`, ""},
+	}
+	for _, test := range tests {
+		result, err := addPullRequest([]byte(test.payload))
+		if err != nil {
+			t.Fatalf("error adding the pull request to %s: %s", test.payload, err.Error())
+		}
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal(result, &fields); err != nil {
+			t.Fatalf("error reading %s: %s", string(result), err.Error())
+		}
+		if number, found := fields["webhooks-tekton-pull-request"]; !found || number != test.expected {
+			t.Errorf("expected pull request %q from %s, got %v", test.expected, test.payload, number)
+		}
+		if _, found := fields["ref"]; test.expected == "" && !found {
+			t.Errorf("other fields were lost from %s", test.payload)
+		}
+	}
+
+	if _, err := addPullRequest([]byte("not json")); err == nil {
+		t.Error("expected an error adding the pull request to a payload that isn't JSON")
+	}
+}
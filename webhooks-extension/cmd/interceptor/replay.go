@@ -0,0 +1,69 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Used if DELIVERY_REPLAY_WINDOW isn't set
+	defaultReplayWindow = 24 * time.Hour
+	// Configmap in the install namespace keeping the deliveries accepted, shared by every replica and restart
+	deliveriesConfigMap = "webhooks-extension-deliveries"
+)
+
+// getReplayWindow is how long accepted deliveries are remembered for, 0 turning replay protection off
+func getReplayWindow() time.Duration {
+	if window, err := time.ParseDuration(os.Getenv("DELIVERY_REPLAY_WINDOW")); err == nil && window >= 0 {
+		return window
+	}
+	return defaultReplayWindow
+}
+
+func deliveryCache(clientset kubernetes.Interface, namespace string) utils.ReplayCache {
+	return utils.ReplayCache{Client: clientset, Namespace: namespace, Name: deliveriesConfigMap}
+}
+
+// deliveryKey identifies a delivery to a trigger by the digest of its payload, which the provider's signature
+// covers, unlike the delivery ID header a replay could change
+func deliveryKey(foundTriggerName string, payload []byte) string {
+	digest := sha256.Sum256(payload)
+	return foundTriggerName + "\n" + hex.EncodeToString(digest[:])
+}
+
+// claimDelivery remembers that the trigger is accepting the payload, returning false if it already accepted it
+// within the replay window, a replayed or redelivered event. As the check and the record are one update of the
+// configmap, only one of the replicas a payload is sent to at the same time claims it.
+func claimDelivery(cache utils.ReplayCache, foundTriggerName string, payload []byte) (bool, error) {
+	window := getReplayWindow()
+	if window == 0 {
+		return true, nil
+	}
+	return cache.Remember(deliveryKey(foundTriggerName, payload), window, time.Now())
+}
+
+// releaseDelivery forgets a delivery the trigger claimed but the interceptor failed on, so that it can be redelivered
+func releaseDelivery(cache utils.ReplayCache, foundTriggerName string, payload []byte) error {
+	if getReplayWindow() == 0 {
+		return nil
+	}
+	return cache.Forget(deliveryKey(foundTriggerName, payload))
+}
@@ -0,0 +1,125 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestClaimDelivery(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset()
+	cache := deliveryCache(clientset, "tekton-pipelines")
+	payload := []byte(`{"after": "1234"}`)
+	if claimed, err := claimDelivery(cache, "hook-push-event", payload); !claimed || err != nil {
+		t.Fatalf("a delivery not yet accepted was a replay (error %v)", err)
+	}
+	if claimed, _ := claimDelivery(cache, "hook-push-event", payload); claimed {
+		t.Error("an accepted delivery was not a replay")
+	}
+	// Whatever its delivery ID, and by another replica
+	if claimed, _ := claimDelivery(deliveryCache(clientset, "tekton-pipelines"), "hook-push-event", payload); claimed {
+		t.Error("an accepted delivery was not a replay to another replica")
+	}
+	if claimed, _ := claimDelivery(cache, "hook-pullrequest-event", payload); !claimed {
+		t.Error("a delivery accepted by another trigger was a replay")
+	}
+	if claimed, _ := claimDelivery(cache, "hook-push-event", []byte(`{"after": "5678"}`)); !claimed {
+		t.Error("a different delivery was a replay")
+	}
+
+	// A delivery the interceptor failed on can be redelivered
+	if err := releaseDelivery(cache, "hook-push-event", payload); err != nil {
+		t.Fatalf("error releasing a delivery: %s", err)
+	}
+	if claimed, _ := claimDelivery(cache, "hook-push-event", payload); !claimed {
+		t.Error("a released delivery was a replay")
+	}
+
+	// Forgotten once the window has passed
+	cm, err := clientset.CoreV1().ConfigMaps("tekton-pipelines").Get(deliveriesConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("configmap %s was not created: %s", deliveriesConfigMap, err)
+	}
+	for key := range cm.Data {
+		cm.Data[key] = strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	}
+	clientset.CoreV1().ConfigMaps("tekton-pipelines").Update(cm)
+	if claimed, _ := claimDelivery(cache, "hook-push-event", payload); !claimed {
+		t.Error("a delivery accepted before the replay window was a replay")
+	}
+}
+
+func TestClaimDeliveryConcurrently(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset()
+	cache := deliveryCache(clientset, "tekton-pipelines")
+	payload := []byte(`{"after": "1234"}`)
+	claimDelivery(cache, "hook-pullrequest-event", payload)
+	conflicted := false
+	clientset.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicted {
+			return false, nil, nil
+		}
+		conflicted = true
+		// Another replica claims the payload between this one reading and updating the configmap
+		if claimed, err := claimDelivery(cache, "hook-push-event", payload); !claimed || err != nil {
+			t.Errorf("expected the other replica to claim the payload, got %t (error %v)", claimed, err)
+		}
+		return true, nil, k8serrors.NewConflict(corev1.Resource("configmaps"), deliveriesConfigMap, errors.New("the object has been modified"))
+	})
+	if claimed, err := claimDelivery(cache, "hook-push-event", payload); claimed || err != nil {
+		t.Errorf("expected a payload another replica claimed first to be a replay, got %t (error %v)", claimed, err)
+	}
+}
+
+func TestClaimDeliveryFullCache(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset()
+	cache := deliveryCache(clientset, "tekton-pipelines")
+	payload := []byte(`{"after": "1234"}`)
+	claimDelivery(cache, "hook-push-event", payload)
+	// The most deliveries the cache keeps
+	cm, _ := clientset.CoreV1().ConfigMaps("tekton-pipelines").Get(deliveriesConfigMap, metav1.GetOptions{})
+	until := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	for i := len(cm.Data); i < 10000; i++ {
+		cm.Data[strconv.Itoa(i)] = until
+	}
+	clientset.CoreV1().ConfigMaps("tekton-pipelines").Update(cm)
+
+	if claimed, err := claimDelivery(cache, "hook-push-event", []byte(`{"after": "5678"}`)); claimed || err == nil {
+		t.Errorf("expected a delivery to be refused while the cache is full, got %t (error %v)", claimed, err)
+	}
+	if claimed, _ := claimDelivery(cache, "hook-push-event", payload); claimed {
+		t.Error("an accepted delivery was forgotten to make room for another")
+	}
+}
+
+func TestClaimDeliveryDisabled(t *testing.T) {
+	os.Setenv("DELIVERY_REPLAY_WINDOW", "0")
+	defer os.Unsetenv("DELIVERY_REPLAY_WINDOW")
+	cache := deliveryCache(fakek8sclientset.NewSimpleClientset(), "tekton-pipelines")
+	claimDelivery(cache, "hook-push-event", []byte(`{}`))
+	if claimed, _ := claimDelivery(cache, "hook-push-event", []byte(`{}`)); !claimed {
+		t.Error("a delivery was a replay with replay protection off")
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Set by the extension on the triggers of a webhook with sender filters, comma separated
+	AllowedSendersHeader = "Wext-Allowed-Senders"
+	DeniedSendersHeader  = "Wext-Denied-Senders"
+	// A sender filter entry matching any bot account
+	botsSender = "bots"
+	// Prefixes of sender filter entries matching the members of a GitHub team or GitLab group
+	teamSenderPrefix  = "team:"
+	groupSenderPrefix = "group:"
+	// How long a membership lookup is remembered, each trigger of a repository seeing the same delivery
+	membershipTTL     = 5 * time.Minute
+	membershipTimeout = 10 * time.Second
+)
+
+// GitLab project and group access tokens act as bot users with names like these
+var gitLabBotPattern = regexp.MustCompile(`^(project|group)_\d+_bot`)
+
+// eventSender is the account whose action sent an event
+type eventSender struct {
+	Login string
+	ID    int64
+	Bot   bool
+}
+
+type membership struct {
+	member  bool
+	checked time.Time
+}
+
+var (
+	membershipsLock sync.Mutex
+	memberships     = make(map[string]membership)
+)
+
+// senderOf reads who sent the event from its payload: the sender for GitHub, the user for GitLab, the actor for
+// Bitbucket, which has no numeric user IDs
+func senderOf(provider string, payload []byte) eventSender {
+	fields := struct {
+		// GitHub
+		Sender struct {
+			Login string `json:"login"`
+			ID    int64  `json:"id"`
+			Type  string `json:"type"`
+		} `json:"sender"`
+		// GitLab push events
+		UserUsername string `json:"user_username"`
+		UserID       int64  `json:"user_id"`
+		// GitLab merge request and comment events
+		User struct {
+			Username string `json:"username"`
+			ID       int64  `json:"id"`
+		} `json:"user"`
+		// Bitbucket
+		Actor struct {
+			Nickname string `json:"nickname"`
+			Type     string `json:"type"`
+		} `json:"actor"`
+	}{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return eventSender{}
+	}
+	if provider == "gitlab" {
+		sender := eventSender{Login: fields.User.Username, ID: fields.User.ID}
+		if fields.UserUsername != "" {
+			sender = eventSender{Login: fields.UserUsername, ID: fields.UserID}
+		}
+		sender.Bot = gitLabBotPattern.MatchString(sender.Login)
+		return sender
+	}
+	if provider == "bitbucket" {
+		return eventSender{Login: fields.Actor.Nickname, Bot: fields.Actor.Type == "app_user"}
+	}
+	return eventSender{
+		Login: fields.Sender.Login,
+		ID:    fields.Sender.ID,
+		Bot:   fields.Sender.Type == "Bot" || strings.HasSuffix(fields.Sender.Login, "[bot]"),
+	}
+}
+
+// splitSenders reads a comma separated list of sender filter entries
+func splitSenders(list string) []string {
+	entries := []string{}
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// senderAllowed returns whether the event's sender passes the trigger's sender filters, and if not why. A sender
+// matching the denied list is turned away, as is one not matching the allowed list when it isn't empty.
+func senderAllowed(header http.Header, provider string, payload []byte, repoURL *url.URL, token string) (bool, string, error) {
+	allowed, denied := splitSenders(header.Get(AllowedSendersHeader)), splitSenders(header.Get(DeniedSendersHeader))
+	if len(allowed) == 0 && len(denied) == 0 {
+		return true, "", nil
+	}
+	sender := senderOf(provider, payload)
+	if sender.Login == "" {
+		return false, "the event has no sender", nil
+	}
+	for _, entry := range denied {
+		matches, err := senderMatches(entry, sender, provider, repoURL, token)
+		if err != nil {
+			return false, "", err
+		}
+		if matches {
+			return false, fmt.Sprintf("sender %s is denied by %s", sender.Login, entry), nil
+		}
+	}
+	if len(allowed) == 0 {
+		return true, "", nil
+	}
+	for _, entry := range allowed {
+		matches, err := senderMatches(entry, sender, provider, repoURL, token)
+		if err != nil {
+			return false, "", err
+		}
+		if matches {
+			return true, "", nil
+		}
+	}
+	return false, fmt.Sprintf("sender %s is not an allowed sender", sender.Login), nil
+}
+
+// senderMatches returns whether the sender is the user, a bot for bots, or a member of the team or group an entry names
+func senderMatches(entry string, sender eventSender, provider string, repoURL *url.URL, token string) (bool, error) {
+	switch {
+	case strings.EqualFold(entry, botsSender):
+		return sender.Bot, nil
+	case strings.HasPrefix(entry, teamSenderPrefix) && provider == "github":
+		return isMember(strings.TrimPrefix(entry, teamSenderPrefix), sender, provider, repoURL, token)
+	case strings.HasPrefix(entry, groupSenderPrefix) && provider == "gitlab":
+		return isMember(strings.TrimPrefix(entry, groupSenderPrefix), sender, provider, repoURL, token)
+	case strings.HasPrefix(entry, teamSenderPrefix) || strings.HasPrefix(entry, groupSenderPrefix):
+		// A team of the other provider
+		return false, nil
+	}
+	return strings.EqualFold(entry, sender.Login), nil
+}
+
+// isMember returns whether the sender is an active member of a GitHub team, <org>/<team slug>, or of a GitLab group,
+// by its path, looked up with the webhook's access token
+func isMember(team string, sender eventSender, provider string, repoURL *url.URL, token string) (bool, error) {
+	key := strings.Join([]string{repoURL.Host, provider, team, sender.Login}, "\n")
+	membershipsLock.Lock()
+	now := time.Now()
+	for k, m := range memberships {
+		if now.Sub(m.checked) > membershipTTL {
+			delete(memberships, k)
+		}
+	}
+	known, found := memberships[key]
+	membershipsLock.Unlock()
+	if found {
+		return known.member, nil
+	}
+
+	var request *http.Request
+	var err error
+	if provider == "github" {
+		parts := strings.SplitN(team, "/", 2)
+		if len(parts) != 2 {
+			return false, fmt.Errorf("team %s is not <org>/<team>", team)
+		}
+		request, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/orgs/%s/teams/%s/memberships/%s", gitAPIURL(provider, repoURL),
+			url.PathEscape(parts[0]), url.PathEscape(parts[1]), url.PathEscape(sender.Login)), nil)
+		if err == nil && token != "" {
+			request.Header.Set("Authorization", "token "+token)
+		}
+	} else {
+		request, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/groups/%s/members/all/%s", gitAPIURL(provider, repoURL),
+			url.PathEscape(team), strconv.FormatInt(sender.ID, 10)), nil)
+		if err == nil && token != "" {
+			request.Header.Set("PRIVATE-TOKEN", token)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	client := http.Client{Timeout: membershipTimeout}
+	resp, err := client.Do(request)
+	if err != nil {
+		return false, fmt.Errorf("error looking up the members of %s: %s", team, err)
+	}
+	defer resp.Body.Close()
+	member := false
+	switch resp.StatusCode {
+	case http.StatusOK:
+		member = true
+		if provider == "github" {
+			state := struct {
+				State string `json:"state"`
+			}{}
+			json.NewDecoder(resp.Body).Decode(&state)
+			member = state.State == "active"
+		}
+	case http.StatusNotFound:
+	default:
+		return false, fmt.Errorf("looking up the members of %s responded with status %d", team, resp.StatusCode)
+	}
+
+	membershipsLock.Lock()
+	memberships[key] = membership{member: member, checked: now}
+	membershipsLock.Unlock()
+	return member, nil
+}
+
+// gitAPIURL is the API of the server a repository is on: api.github.com for github.com, /api/v3 on GitHub
+// Enterprise Server, /api/v4 on GitLab and api.bitbucket.org/2.0 for Bitbucket Cloud
+func gitAPIURL(provider string, repoURL *url.URL) string {
+	scheme := repoURL.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	switch {
+	case provider == "gitlab":
+		return scheme + "://" + repoURL.Host + "/api/v4"
+	case provider == "bitbucket" && isBitbucketHost(repoURL.Host):
+		return "https://api.bitbucket.org/2.0"
+	case provider == "bitbucket":
+		return scheme + "://" + repoURL.Host + "/2.0"
+	case strings.EqualFold(repoURL.Host, "github.com"):
+		return "https://api.github.com"
+	}
+	return scheme + "://" + repoURL.Host + "/api/v3"
+}
@@ -0,0 +1,98 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSenderOf(t *testing.T) {
+	tests := []struct {
+		provider string
+		payload  string
+		expected eventSender
+	}{
+		{"github", `{"sender": {"login": "octocat", "id": 1, "type": "User"}}`, eventSender{Login: "octocat", ID: 1}},
+		{"github", `{"sender": {"login": "dependabot[bot]", "id": 2, "type": "Bot"}}`, eventSender{Login: "dependabot[bot]", ID: 2, Bot: true}},
+		{"gitlab", `{"user_username": "jsmith", "user_id": 4}`, eventSender{Login: "jsmith", ID: 4}},
+		{"gitlab", `{"user": {"username": "project_12_bot", "id": 5}}`, eventSender{Login: "project_12_bot", ID: 5, Bot: true}},
+		{"bitbucket", `{"actor": {"nickname": "evzijst", "type": "user"}}`, eventSender{Login: "evzijst"}},
+		{"github", `not json`, eventSender{}},
+	}
+	for _, tt := range tests {
+		if got := senderOf(tt.provider, []byte(tt.payload)); got != tt.expected {
+			t.Errorf("sender of %s was %+v, expected %+v", tt.payload, got, tt.expected)
+		}
+	}
+}
+
+func TestSenderAllowed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/api/v3/orgs/owner/teams/maintainers/memberships/octocat" {
+			w.Write([]byte(`{"state": "active"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	repoURL, _ := url.Parse(server.URL + "/owner/repo")
+
+	user := []byte(`{"sender": {"login": "octocat", "type": "User"}}`)
+	other := []byte(`{"sender": {"login": "someone", "type": "User"}}`)
+	bot := []byte(`{"sender": {"login": "dependabot[bot]", "type": "Bot"}}`)
+	tests := []struct {
+		name    string
+		allow   string
+		deny    string
+		payload []byte
+		allowed bool
+	}{
+		{"no filters", "", "", bot, true},
+		{"bots denied", "", "bots", bot, false},
+		{"user not denied", "", "bots", user, true},
+		{"only dependabot", "dependabot[bot]", "", bot, true},
+		{"not dependabot", "dependabot[bot]", "", user, false},
+		{"team member", "team:owner/maintainers", "", user, true},
+		{"not a team member", "team:owner/maintainers", "", other, false},
+		{"gitlab group on github", "group:owner", "", user, false},
+		{"denied wins", "octocat", "team:owner/maintainers", user, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(AllowedSendersHeader, tt.allow)
+			header.Set(DeniedSendersHeader, tt.deny)
+			allowed, reason, err := senderAllowed(header, "github", tt.payload, repoURL, "access")
+			if err != nil {
+				t.Fatalf("error checking the sender: %s", err)
+			}
+			if allowed != tt.allowed {
+				t.Errorf("sender allowed was %t (%s), expected %t", allowed, reason, tt.allowed)
+			}
+		})
+	}
+
+	header := http.Header{}
+	header.Set(AllowedSendersHeader, "team:owner/maintainers")
+	if _, _, err := senderAllowed(header, "github", []byte(`{"sender": {"login": "newcomer"}}`), repoURL, "wrong"); err == nil {
+		t.Error("expected an error when the team couldn't be looked up")
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Set to dry-run by the extension when it simulates a delivery, the event is validated without side effects.
+	// Only honoured when the extension signed the delivery, see utils.SignSimulation.
+	SimulationHeader = "Wext-Simulation"
+	DryRunSimulation = "dry-run"
+	// Set by the extension on an executed simulation to the triggers prefix of the webhook simulated
+	SimulatedWebhookHeader = "Wext-Simulated-Webhook"
+)
+
+// isDryRun is whether the delivery is a simulation that must not publish, sync or report anything
+func isDryRun(header http.Header) bool {
+	return header.Get(SimulationHeader) == DryRunSimulation
+}
+
+// takeDryRun removes the claim of a delivery to be a dry-run simulation, returning whether it made one. Until
+// acceptDryRun restores it the delivery is handled as any other.
+func takeDryRun(header http.Header) bool {
+	claimed := isDryRun(header)
+	header.Del(SimulationHeader)
+	return claimed
+}
+
+// acceptDryRun marks the delivery as a dry-run simulation if the extension signed its payload, else returns why not
+func acceptDryRun(clientset kubernetes.Interface, namespace string, header http.Header, payload []byte, now time.Time) error {
+	key, err := utils.GetSimulationKey(clientset, namespace, false)
+	if err != nil {
+		return err
+	}
+	if err := utils.VerifySimulation(header, key, payload, now); err != nil {
+		return err
+	}
+	header.Set(SimulationHeader, DryRunSimulation)
+	return nil
+}
+
+// simulatedForOtherWebhook is whether the delivery is an executed simulation of another webhook on the repository
+func simulatedForOtherWebhook(header http.Header, foundTriggerName string) bool {
+	prefix := header.Get(SimulatedWebhookHeader)
+	return prefix != "" && !strings.HasPrefix(foundTriggerName, prefix+"-")
+}
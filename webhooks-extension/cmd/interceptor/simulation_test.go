@@ -0,0 +1,107 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSimulatedForOtherWebhook(t *testing.T) {
+	tests := []struct {
+		simulated string
+		trigger   string
+		expected  bool
+	}{
+		{"", "hook-default-push-event", false},
+		{"hook-default", "hook-default-push-event", false},
+		{"hook-default", "hook-default-pullrequest-canary", false},
+		{"hook-default", "other-default-push-event", true},
+		{"hook-default", "hook-default2-push-event", true},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.simulated != "" {
+			header.Set(SimulatedWebhookHeader, tt.simulated)
+		}
+		if got := simulatedForOtherWebhook(header, tt.trigger); got != tt.expected {
+			t.Errorf("simulation of %q on trigger %s: expected %t, got %t", tt.simulated, tt.trigger, tt.expected, got)
+		}
+	}
+}
+
+func TestDryRunNotReported(t *testing.T) {
+	reported := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reported <- true
+	}))
+	defer server.Close()
+
+	request := httptest.NewRequest("POST", "/", nil)
+	request.Header.Set(DeadLetterHeader, server.URL)
+	request.Header.Set(SimulationHeader, DryRunSimulation)
+	request.Header.Set("Wext-Trigger-Name", "simulated-default-push-event")
+	writer := &failureRecorder{ResponseWriter: httptest.NewRecorder()}
+	http.Error(writer, "secrets \"token\" not found", http.StatusBadRequest)
+	reportDeadLetter(writer, request)
+	select {
+	case <-reported:
+		t.Error("expected a dry run not to be reported")
+	case <-time.After(time.Second):
+	}
+}
+
+func TestAcceptDryRun(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset()
+	now := time.Now()
+	payload := []byte(`{"ref":"refs/heads/master"}`)
+
+	header := http.Header{}
+	header.Set(SimulationHeader, DryRunSimulation)
+	if !takeDryRun(header) || isDryRun(header) {
+		t.Fatalf("expected the dry run claim to be taken from the delivery")
+	}
+	if err := acceptDryRun(clientset, "tekton-pipelines", header, payload, now); err == nil || isDryRun(header) {
+		t.Errorf("expected a dry run to be refused before the extension created its key")
+	}
+
+	key, err := utils.GetSimulationKey(clientset, "tekton-pipelines", true)
+	if err != nil {
+		t.Fatalf("error creating the simulation key: %s", err)
+	}
+	tests := []struct {
+		name     string
+		sign     func(http.Header)
+		accepted bool
+	}{
+		{"signed by the extension", func(h http.Header) { utils.SignSimulation(h, key, payload, now) }, true},
+		{"unsigned", func(h http.Header) {}, false},
+		{"signed with another key", func(h http.Header) { utils.SignSimulation(h, []byte("other"), payload, now) }, false},
+		{"signed for another payload", func(h http.Header) { utils.SignSimulation(h, key, []byte("{}"), now) }, false},
+		{"signed too long ago", func(h http.Header) { utils.SignSimulation(h, key, payload, now.Add(-10*time.Minute)) }, false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		tt.sign(header)
+		err := acceptDryRun(clientset, "tekton-pipelines", header, payload, now)
+		if (err == nil) != tt.accepted || isDryRun(header) != tt.accepted {
+			t.Errorf("dry run %s: expected accepted %t, got error %v", tt.name, tt.accepted, err)
+		}
+	}
+}
@@ -29,6 +29,8 @@ const (
 	RequiredRepositoryHeader = "Wext-Repository-Url"
 	RequiredEventHeader      = "Wext-Incoming-Event"
 	RequiredActionsHeader    = "Wext-Incoming-Actions"
+	// Set by the extension on the triggers of a disabled webhook, e.g. one that has expired
+	DisabledHeader = "Wext-Disabled"
 )
 
 type ghPushPayload struct {
@@ -157,6 +159,24 @@ func addBranchAndTag(webhookEvent interface{}) ([]byte, error) {
 	}
 }
 
+// addRefBranchAndTag returns the payload with the branch of ref and suggested image tag added, as addBranchAndTag
+// does for the GitHub and GitLab events, and the comment of a comment command
+func addRefBranchAndTag(payload []byte, ref, commit, comment string) ([]byte, error) {
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	if len(commit) < 7 {
+		return nil, errors.New("event has no commit")
+	}
+	fields["webhooks-tekton-git-branch"] = ref[strings.LastIndex(ref, "/")+1:]
+	fields["webhooks-tekton-image-tag"] = getSuggestedTag(ref, commit)
+	if comment != "" {
+		fields[commentField] = comment
+	}
+	return json.Marshal(fields)
+}
+
 func getSuggestedTag(ref, commit string) string {
 	var suggestedImageTag string
 	if strings.HasPrefix(ref, "refs/tags/") {
@@ -168,8 +188,9 @@ func getSuggestedTag(ref, commit string) string {
 }
 
 func sanitizeGitInput(input string) string {
-	asLower := strings.ToLower(input)
-	noGitSuffix := strings.TrimSuffix(asLower, ".git")
+	asLower := strings.ToLower(strings.TrimSpace(input))
+	noTrailingSlash := strings.TrimSuffix(asLower, "/")
+	noGitSuffix := strings.TrimSuffix(noTrailingSlash, ".git")
 	noHTTPSPrefix := strings.TrimPrefix(noGitSuffix, "https://")
 	noHTTPrefix := strings.TrimPrefix(noHTTPSPrefix, "http://")
 	return noHTTPrefix
@@ -18,10 +18,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/google/go-github/github"
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
 	gitlab "github.com/xanzy/go-gitlab"
 )
 
@@ -37,6 +39,8 @@ func TestSanitizeGitInput(t *testing.T) {
 	urls["HTTPS://github.com/foo/bar.GIT"] = "github.com/foo/bar"
 	urls["hTtP://GiThUb.CoM/FoO/BaR"] = "github.com/foo/bar"
 	urls["http://something.else/foo/bar/wibble.git"] = "something.else/foo/bar/wibble"
+	urls["https://github.com/foo/bar/"] = "github.com/foo/bar"
+	urls["https://github.com/foo/bar.git/"] = "github.com/foo/bar"
 
 	for url := range urls {
 		sanitized := sanitizeGitInput(url)
@@ -433,3 +437,38 @@ func getGitlabMergeRequest() string {
 		}}`
 	return raw
 }
+
+func TestIsGitHubHost(t *testing.T) {
+	os.Setenv("GITHUB_ENTERPRISE_HOSTS", "git.example.com, code.example.org")
+	defer os.Unsetenv("GITHUB_ENTERPRISE_HOSTS")
+	hosts := map[string]bool{
+		"github.com":         true,
+		"github.example.com": true,
+		"git.example.com":    true,
+		"CODE.example.org":   true,
+		"gitlab.com":         false,
+		"example.com":        false,
+	}
+	for host, expected := range hosts {
+		if utils.IsGitHubHost(host) != expected {
+			t.Errorf("IsGitHubHost(%s) was %t, expected %t", host, !expected, expected)
+		}
+	}
+}
+
+func TestIsGiteaHost(t *testing.T) {
+	os.Setenv("GITEA_HOSTS", "git.example.com")
+	defer os.Unsetenv("GITEA_HOSTS")
+	hosts := map[string]bool{
+		"gitea.example.com": true,
+		"gogs.example.com":  true,
+		"git.example.com":   true,
+		"github.com":        false,
+		"example.com":       false,
+	}
+	for host, expected := range hosts {
+		if utils.IsGiteaHost(host) != expected {
+			t.Errorf("IsGiteaHost(%s) was %t, expected %t", host, !expected, expected)
+		}
+	}
+}
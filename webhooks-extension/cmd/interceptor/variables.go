@@ -0,0 +1,78 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Set by the extension on triggers of webhooks that use a variable set
+	VariableSetHeader = "Wext-Variable-Set"
+	// Prefix of the ConfigMaps variable sets are stored in, after RESOURCE_NAME_PREFIX as in the extension
+	variableSetPrefix = "variables-"
+	// Used if RESOURCE_NAME_PREFIX isn't set
+	defaultResourcePrefix = "wext-"
+	// Payload field the webhook's TriggerBinding reads the variables from
+	variablesField = "webhooks-tekton-variables"
+)
+
+// getVariables returns the variables of the named set from its ConfigMap in the install namespace, or its Secret
+// if the set is secret
+func getVariables(clientset kubernetes.Interface, namespace, setName string) (map[string]string, error) {
+	resourcePrefix := os.Getenv("RESOURCE_NAME_PREFIX")
+	if resourcePrefix == "" {
+		resourcePrefix = defaultResourcePrefix
+	}
+	name := resourcePrefix + variableSetPrefix + setName
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err == nil {
+		if configMap.Data == nil {
+			return map[string]string{}, nil
+		}
+		return configMap.Data, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	variables := make(map[string]string)
+	for key, value := range secret.Data {
+		variables[key] = string(value)
+	}
+	return variables, nil
+}
+
+// addVariables returns the payload with the variables added under webhooks-tekton-variables,
+// other fields are left as they were
+func addVariables(payload []byte, variables map[string]string) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return nil, err
+	}
+	fields[variablesField] = variablesJSON
+	return json.Marshal(fields)
+}
@@ -0,0 +1,74 @@
+/*
+ Copyright 2020 The Tekton Authors
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+     http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAddVariables(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "wext-variables-staging", Namespace: "tekton-pipelines"},
+		Data:       map[string]string{"registry": "staging.example.com", "replicas": "2"},
+	})
+	variables, err := getVariables(clientset, "tekton-pipelines", "staging")
+	if err != nil {
+		t.Fatalf("error getting variables: %s", err.Error())
+	}
+
+	payload, err := addVariables([]byte(`{"ref":"refs/heads/master","webhooks-tekton-git-branch":"master"}`), variables)
+	if err != nil {
+		t.Fatalf("error adding variables: %s", err.Error())
+	}
+	result := struct {
+		Ref       string            `json:"ref"`
+		Branch    string            `json:"webhooks-tekton-git-branch"`
+		Variables map[string]string `json:"webhooks-tekton-variables"`
+	}{}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		t.Fatalf("error reading payload: %s", err.Error())
+	}
+	if result.Ref != "refs/heads/master" || result.Branch != "master" {
+		t.Errorf("payload fields were changed: %s", string(payload))
+	}
+	if result.Variables["registry"] != "staging.example.com" || result.Variables["replicas"] != "2" {
+		t.Errorf("variables were %v", result.Variables)
+	}
+}
+
+func TestGetSecretVariables(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "wext-variables-production", Namespace: "tekton-pipelines"},
+		Data:       map[string][]byte{"apitoken": []byte("s3cret")},
+	})
+	variables, err := getVariables(clientset, "tekton-pipelines", "production")
+	if err != nil {
+		t.Fatalf("error getting variables: %s", err.Error())
+	}
+	if variables["apitoken"] != "s3cret" {
+		t.Errorf("variables were %v", variables)
+	}
+}
+
+func TestGetVariablesMissingSet(t *testing.T) {
+	clientset := fakek8sclientset.NewSimpleClientset()
+	if _, err := getVariables(clientset, "tekton-pipelines", "missing"); err == nil {
+		t.Error("expected an error for a variable set that does not exist")
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+AccessLogFilter logs each API request as a structured "access" entry with
+its method, path, caller, latency and status. ACCESS_LOG sets what is
+logged: on (the default) logs requests without their bodies, bodies logs
+the request and response bodies too and off logs nothing. The caller is
+the user named by the X-Forwarded-User, X-Remote-User or Impersonate-User
+header a proxy in front of the extension sets, the bearer token itself is
+never logged. The values of query parameters and JSON body fields whose
+names look like they hold a credential are redacted, other bodies are
+logged only by size, and bodies are truncated at maxAccessLogBody bytes.
+Probes and metrics scrapes are not logged.
+---------------------------------------*/
+
+const (
+	accessLogOff    = "off"
+	accessLogBodies = "bodies"
+	// Longest request or response body logged, and kept to be redacted
+	maxAccessLogBody    = 4096
+	maxAccessLogCapture = 64 * 1024
+	redacted            = "[REDACTED]"
+)
+
+// Headers a proxy names the caller in, in order of preference
+var callerHeaders = []string{"X-Forwarded-User", "X-Remote-User", "Impersonate-User"}
+
+// Parts of field and query parameter names whose values are redacted
+var sensitiveNames = []string{"token", "secret", "password", "authorization", "credential", "apikey"}
+
+var accessLogSkippedPaths = []string{"/liveness", "/readiness", "/metrics"}
+
+// capturingWriter keeps the response body as it is written, up to maxAccessLogCapture bytes
+type capturingWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+	size int
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.size += len(data)
+	if remaining := maxAccessLogCapture - w.body.Len(); remaining > 0 {
+		if len(data) < remaining {
+			remaining = len(data)
+		}
+		w.body.Write(data[:remaining])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// AccessLogFilter logs the requests served by the container it is added to
+func AccessLogFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	mode := strings.ToLower(os.Getenv("ACCESS_LOG"))
+	path := request.Request.URL.Path
+	if mode == accessLogOff || isSkippedPath(path) {
+		chain.ProcessFilter(request, response)
+		return
+	}
+
+	var requestBody []byte
+	requestSize := 0
+	var captured *capturingWriter
+	if mode == accessLogBodies {
+		if body := request.Request.Body; body != nil {
+			// The handler is given the whole body, only the start of it is kept to be logged
+			requestBody, _ = ioutil.ReadAll(io.LimitReader(body, maxAccessLogCapture+1))
+			request.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(requestBody), body), body}
+			requestSize = len(requestBody)
+			if request.Request.ContentLength > int64(requestSize) {
+				requestSize = int(request.Request.ContentLength)
+			}
+		}
+		captured = &capturingWriter{ResponseWriter: response.ResponseWriter}
+		response.ResponseWriter = captured
+	}
+
+	start := time.Now()
+	chain.ProcessFilter(request, response)
+
+	entry := []interface{}{
+		"method", request.Request.Method,
+		"path", path,
+		"query", redactQuery(request.Request.URL.Query()),
+		"caller", requestCaller(request),
+		"remoteaddr", request.Request.RemoteAddr,
+		"status", response.StatusCode(),
+		"latencyms", int64(time.Since(start) / time.Millisecond),
+	}
+	if captured != nil {
+		entry = append(entry, "requestbody", redactBody(requestBody, requestSize), "responsebody", redactBody(captured.body.Bytes(), captured.size))
+	}
+	logging.Log.Infow("access", entry...)
+}
+
+func isSkippedPath(path string) bool {
+	for _, skipped := range accessLogSkippedPaths {
+		if path == skipped || strings.HasPrefix(path, skipped+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// requestCaller returns the API key a request was signed with, the user of its session token or the user a proxy
+// named as the caller, anonymous if none
+func requestCaller(request *restful.Request) string {
+	if keyID, signed := signedKey(request); signed {
+		return "apikey:" + keyID
+	}
+	if claims, found := sessionOf(request); found {
+		return claims.User
+	}
+	for _, header := range callerHeaders {
+		if user := strings.TrimSpace(request.Request.Header.Get(header)); user != "" {
+			return user
+		}
+	}
+	return "anonymous"
+}
+
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactQuery returns the query string with the values of sensitive parameters redacted
+func redactQuery(query map[string][]string) string {
+	parts := []string{}
+	names := []string{}
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		for _, value := range values {
+			if isSensitive(name) {
+				value = redacted
+			}
+			parts = append(parts, name+"="+value)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// redactBody returns a JSON body of size bytes with the values of sensitive fields redacted,
+// truncated to maxAccessLogBody, or the size of a body that isn't JSON or is too large to redact
+func redactBody(body []byte, size int) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+	if size > maxAccessLogCapture {
+		return fmt.Sprintf("[%d bytes]", size)
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Sprintf("[%d bytes, not JSON]", size)
+	}
+	data, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return fmt.Sprintf("[%d bytes]", size)
+	}
+	if len(data) > maxAccessLogBody {
+		return string(data[:maxAccessLogBody]) + "...[truncated]"
+	}
+	return string(data)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSensitive(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
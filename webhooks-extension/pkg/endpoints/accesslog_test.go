@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		body, expected string
+	}{
+		{``, ``},
+		{`{"name":"hook","accesstoken":"abc","nested":[{"Password":"p","user":"u"}]}`, `{"accesstoken":"[REDACTED]","name":"hook","nested":[{"Password":"[REDACTED]","user":"u"}]}`},
+		{`{"secretToken":{"value":"x"}}`, `{"secretToken":"[REDACTED]"}`},
+		{`token=abc`, `[9 bytes, not JSON]`},
+	}
+	for _, test := range tests {
+		if redactedBody := redactBody([]byte(test.body), len(test.body)); redactedBody != test.expected {
+			t.Errorf("redacted body of %s was %s, expected %s", test.body, redactedBody, test.expected)
+		}
+	}
+	long := `["` + strings.Repeat("a", maxAccessLogBody) + `"]`
+	if redactedBody := redactBody([]byte(long), len(long)); !strings.HasSuffix(redactedBody, "...[truncated]") {
+		t.Errorf("expected a long body to be truncated")
+	}
+	if redactedBody := redactBody([]byte(`{"a":`), maxAccessLogCapture+1); redactedBody != "[65537 bytes]" {
+		t.Errorf("expected a body too large to capture to be logged by size, got %s", redactedBody)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	query, _ := url.ParseQuery("namespace=ns1&access_token=abc&repository=r1&repository=r2")
+	expected := "access_token=[REDACTED]&namespace=ns1&repository=r1&repository=r2"
+	if redactedQuery := redactQuery(query); redactedQuery != expected {
+		t.Errorf("redacted query was %s, expected %s", redactedQuery, expected)
+	}
+}
+
+func TestRequestCaller(t *testing.T) {
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks", nil)
+	req := dummyRestfulRequest(httpReq, "")
+	if caller := requestCaller(req); caller != "anonymous" {
+		t.Errorf("caller without a user header was %s", caller)
+	}
+	httpReq.Header.Set("Impersonate-User", "bob")
+	httpReq.Header.Set("X-Remote-User", "alice")
+	if caller := requestCaller(req); caller != "alice" {
+		t.Errorf("caller was %s, expected alice", caller)
+	}
+	req.SetAttribute(signedKeyAttribute, "ci")
+	if caller := requestCaller(req); caller != "apikey:ci" {
+		t.Errorf("caller of a signed request was %s, expected apikey:ci", caller)
+	}
+}
+
+func TestAccessLogFilterKeepsBodies(t *testing.T) {
+	os.Setenv("ACCESS_LOG", "bodies")
+	defer os.Unsetenv("ACCESS_LOG")
+
+	container := restful.NewContainer()
+	container.Filter(AccessLogFilter)
+	ws := new(restful.WebService)
+	ws.Path("/webhooks")
+	ws.Route(ws.POST("/").To(func(request *restful.Request, response *restful.Response) {
+		body, _ := ioutil.ReadAll(request.Request.Body)
+		response.WriteHeader(http.StatusCreated)
+		response.Write(body)
+	}))
+	container.Add(ws)
+
+	body := `{"name":"hook","accesstoken":"abc"}`
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/", bytes.NewBufferString(body))
+	httpWriter := httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusCreated || httpWriter.Body.String() != body {
+		t.Errorf("expected the handler to get the request body and the response to be written, got %d, %s", httpWriter.Code, httpWriter.Body.String())
+	}
+}
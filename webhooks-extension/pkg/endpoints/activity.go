@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+// activityWindow is the period events are counted over in a webhook's activity
+const activityWindow = 24 * time.Hour
+
+// webhookActivity summarises what a webhook has done recently for the list of
+// webhooks, GET /webhooks/{name}/stats going into more detail
+type webhookActivity struct {
+	// Events in the last 24 hours that started a PipelineRun, by triggers event id
+	Events int `json:"events24h"`
+	// Deliveries for the repository waiting in the delivery buffer, see delivery.go
+	Buffered    int          `json:"buffered,omitempty"`
+	RunsStarted int          `json:"runsstarted"`
+	LastEvent   *metav1.Time `json:"lastevent,omitempty"`
+	LastRun     string       `json:"lastrun,omitempty"`
+	// Succeeded, Failed or Running
+	LastRunStatus string `json:"lastrunstatus,omitempty"`
+}
+
+// withActivity sets the activity of each webhook as of now, listing the
+// PipelineRuns of each namespace and the delivery buffer once
+func (r Resource) withActivity(hooks []webhook, now time.Time) []webhook {
+	pipelineRuns := map[string][]pipelinesv1alpha1.PipelineRun{}
+	buffered := r.bufferedDeliveriesByRepo()
+	for i, hook := range hooks {
+		runs, listed := pipelineRuns[hook.Namespace]
+		if !listed {
+			list, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).List(metav1.ListOptions{})
+			if err != nil {
+				logging.Log.Errorf("error listing PipelineRuns in namespace %s for webhook activity: %s", hook.Namespace, err)
+			} else {
+				runs = list.Items
+			}
+			pipelineRuns[hook.Namespace] = runs
+		}
+		activity := summariseActivity(hook, runs, now)
+		activity.Buffered = buffered[canonicalRepoURL(hook.GitRepositoryURL)]
+		hooks[i].Activity = activity
+	}
+	return hooks
+}
+
+func summariseActivity(hook webhook, pipelineRuns []pipelinesv1alpha1.PipelineRun, now time.Time) *webhookActivity {
+	activity := &webhookActivity{}
+	events := map[string]bool{}
+	var last *pipelinesv1alpha1.PipelineRun
+	for i, pipelineRun := range pipelineRuns {
+		if !isWebhookPipelineRun(pipelineRun, hook.GitRepositoryURL, hook.Pipeline) {
+			continue
+		}
+		activity.RunsStarted++
+		created := pipelineRun.CreationTimestamp
+		if now.Sub(created.Time) <= activityWindow {
+			event := pipelineRun.Labels["triggers.tekton.dev/triggers-eventid"]
+			if event == "" {
+				event = pipelineRun.Name
+			}
+			events[event] = true
+		}
+		if last == nil || last.CreationTimestamp.Before(&created) {
+			last = &pipelineRuns[i]
+		}
+	}
+	activity.Events = len(events)
+	if last == nil {
+		return activity
+	}
+	activity.LastEvent = &last.CreationTimestamp
+	activity.LastRun = last.Name
+	activity.LastRunStatus = "Running"
+	if condition := last.Status.GetCondition(apis.ConditionSucceeded); condition != nil {
+		switch condition.Status {
+		case corev1.ConditionTrue:
+			activity.LastRunStatus = "Succeeded"
+		case corev1.ConditionFalse:
+			activity.LastRunStatus = "Failed"
+		}
+	}
+	return activity
+}
+
+// bufferedDeliveriesByRepo counts the deliveries waiting in the delivery buffer for each repository
+func (r Resource) bufferedDeliveriesByRepo() map[string]int {
+	counts := map[string]int{}
+	if !r.Defaults.DeliveryBuffer {
+		return counts
+	}
+	deliveryBufferLock.Lock()
+	deliveries, _, err := r.loadDeliveryBuffer()
+	deliveryBufferLock.Unlock()
+	if err != nil {
+		logging.Log.Errorf("error loading buffered deliveries for webhook activity: %s", err)
+		return counts
+	}
+	for _, delivery := range deliveries {
+		if repo, _ := deliveryRepoAndCommit(delivery.Body); repo != "" {
+			counts[canonicalRepoURL(repo)]++
+		}
+	}
+	return counts
+}
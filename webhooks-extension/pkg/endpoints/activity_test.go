@@ -0,0 +1,53 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+	"time"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSummariseActivity(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	hook := webhook{Name: "hook", Namespace: "foo", GitRepositoryURL: "https://github.com/owner/repo", Pipeline: "pipeline"}
+	run := func(name string, status corev1.ConditionStatus, created time.Time, event string) pipelinesv1alpha1.PipelineRun {
+		pipelineRun := statsPipelineRun(name, status, 10, created)
+		pipelineRun.CreationTimestamp = metav1.Time{Time: created}
+		pipelineRun.Labels["triggers.tekton.dev/triggers-eventid"] = event
+		return pipelineRun
+	}
+	other := run("other", corev1.ConditionTrue, now, "event4")
+	other.Spec.PipelineRef.Name = "another-pipeline"
+	runs := []pipelinesv1alpha1.PipelineRun{
+		run("old", corev1.ConditionTrue, now.Add(-48*time.Hour), "event1"),
+		run("recent", corev1.ConditionTrue, now.Add(-time.Hour), "event2"),
+		run("recent-retry", corev1.ConditionFalse, now.Add(-time.Hour), "event2"),
+		run("latest", corev1.ConditionFalse, now.Add(-time.Minute), "event3"),
+		other,
+	}
+
+	activity := summariseActivity(hook, runs, now)
+	if activity.RunsStarted != 4 || activity.Events != 2 || activity.LastRun != "latest" || activity.LastRunStatus != "Failed" ||
+		!activity.LastEvent.Time.Equal(now.Add(-time.Minute)) {
+		t.Errorf("unexpected activity %+v", activity)
+	}
+
+	if activity := summariseActivity(hook, nil, now); activity.RunsStarted != 0 || activity.LastEvent != nil {
+		t.Errorf("unexpected activity without PipelineRuns %+v", activity)
+	}
+}
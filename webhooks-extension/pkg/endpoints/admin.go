@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+/*--------------------------------------
+Most endpoints act as the extension and rely on the dashboard to decide who
+may reach them. Admin endpoints, which change many webhooks at once, also
+check who is calling: the request must carry the caller's Kubernetes bearer
+token, which is reviewed with a TokenReview, and the caller must be allowed
+to delete the eventlistener in the install namespace. Requests signed with
+an API key with the admin scope (see signedrequests.go) are allowed without
+a token, as are callers in a group the group policy makes admins (see grouppolicy.go) and
+session tokens with the admin scope (see sessiontokens.go).
+---------------------------------------*/
+
+// authorizeAdmin returns the status to respond with and why if the caller of request is not an admin
+func (r Resource) authorizeAdmin(request *restful.Request) (int, error) {
+	if keyID, signed := signedKey(request); signed {
+		if !signedScopes(request).Admin {
+			return http.StatusForbidden, fmt.Errorf("API key %s may not call admin endpoints, its scopes don't include admin", keyID)
+		}
+		return http.StatusOK, nil
+	}
+	if claims, found := sessionOf(request); found {
+		if !claims.hasScope(scopeAdmin) {
+			return http.StatusForbidden, fmt.Errorf("the session token of %s lacks the %s scope admin endpoints need", claims.User, scopeAdmin)
+		}
+		return http.StatusOK, nil
+	}
+	user, status, err := r.reviewToken(request, "admin endpoints", scopeAdmin)
+	if err != nil {
+		return status, err
+	}
+	policy, err := r.getGroupPolicy()
+	if err != nil {
+		// Admins granted by RBAC can still fix the policy
+		logging.Log.Errorf("ignoring the group policy: %s", err)
+	}
+	if policy.grantsAdmin(user.Groups) {
+		return http.StatusOK, nil
+	}
+
+	allowed, err := r.rbacAdmin(user)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !allowed {
+		return http.StatusForbidden, fmt.Errorf("%s may not delete eventlistener %s in namespace %s, which admin endpoints need",
+			user.Username, r.eventListenerName(), r.Defaults.Namespace)
+	}
+	return http.StatusOK, nil
+}
+
+// rbacAdmin returns whether RBAC makes user an admin, allowing them to delete the eventlistener
+func (r Resource) rbacAdmin(user authenticationv1.UserInfo) (bool, error) {
+	return r.accessAllowed(user, authorizationv1.ResourceAttributes{
+		Namespace: r.Defaults.Namespace,
+		Verb:      "delete",
+		Group:     "triggers.tekton.dev",
+		Resource:  "eventlisteners",
+		Name:      r.eventListenerName(),
+	})
+}
+
+// accessAllowed returns whether RBAC lets user do what attributes describe, checked with a SubjectAccessReview
+func (r Resource) accessAllowed(user authenticationv1.UserInfo, attributes authorizationv1.ResourceAttributes) (bool, error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	access, err := r.K8sClient.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              extra,
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error reviewing the caller's access: %s", err)
+	}
+	return access.Status.Allowed, nil
+}
+
+// reviewToken returns who the bearer token, or session token with any of scopes, of request authenticates, or the
+// status to respond with and why if it has none or it isn't accepted. what is what needs the token, for the error.
+func (r Resource) reviewToken(request *restful.Request, what string, scopes ...string) (authenticationv1.UserInfo, int, error) {
+	if claims, found := sessionOf(request); found {
+		for _, scope := range scopes {
+			if claims.hasScope(scope) {
+				return authenticationv1.UserInfo{Username: claims.User, Groups: claims.Groups}, http.StatusOK, nil
+			}
+		}
+		return authenticationv1.UserInfo{}, http.StatusForbidden,
+			fmt.Errorf("the session token of %s lacks the scope %s need", claims.User, what)
+	}
+	token := bearerToken(request)
+	if token == "" {
+		return authenticationv1.UserInfo{}, http.StatusUnauthorized,
+			fmt.Errorf("%s need the caller's bearer token in the Authorization header or a signed request", what)
+	}
+	review, err := r.K8sClient.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		return authenticationv1.UserInfo{}, http.StatusInternalServerError, fmt.Errorf("error reviewing the caller's token: %s", err)
+	}
+	if !review.Status.Authenticated {
+		return authenticationv1.UserInfo{}, http.StatusUnauthorized, errors.New("the caller's bearer token was not accepted")
+	}
+	return review.Status.User, http.StatusOK, nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Credentials holding a username and password rather than an access token
+need two things before a webhook can use them. The pull request resource
+the monitor uses only sends a token, so the username and password are
+exchanged once for a token the git server issues, kept in the credential
+as monitorToken. Pipelines run in the webhook's namespace, so the username
+and password are copied into a secret of the same name there, unless one
+already exists. Secrets outside the install namespace are only created,
+never read or updated, and only for admins.
+---------------------------------------*/
+
+const (
+	// Key of the token the monitor's pull request resource sends for a username and password credential
+	monitorTokenKey = "monitorToken"
+	// Names the tokens the extension asks git servers for, so they can be told apart and revoked
+	monitorTokenNote = "tekton-webhooks-extension monitor"
+)
+
+// prepareBasicAuth readies webhook's credential for the monitor and the webhook's pipelines if it's a username
+// and password, returning the status to respond with and why if it can't be. Only admins may have it copied
+// outside the install namespace, see authorizeNamespacePowers.
+func (r Resource) prepareBasicAuth(request *restful.Request, webhook webhook) (int, error) {
+	if getProviderMode() == providerModeReplay {
+		// Replaying doesn't read credentials, see offline.go
+		return http.StatusOK, nil
+	}
+	secret, err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Get(webhook.AccessTokenRef, metav1.GetOptions{})
+	if err != nil {
+		// The webhook fails later on for a missing credential as it did before
+		return http.StatusOK, nil
+	}
+	if len(secret.Data["accessToken"]) > 0 || len(secret.Data["username"]) == 0 {
+		return http.StatusOK, nil
+	}
+	if webhook.Namespace != "" && webhook.Namespace != r.Defaults.Namespace {
+		if status, err := r.authorizeNamespacePowers(request); err != nil {
+			return status, fmt.Errorf("credential %s can't be copied to namespace %s: %s", webhook.AccessTokenRef, webhook.Namespace, err)
+		}
+	}
+	if len(secret.Data[monitorTokenKey]) == 0 {
+		token, err := r.exchangeForToken(webhook.GitRepositoryURL, secret)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("credential %s could not be exchanged for a token for the monitor, add an accesstoken to it: %s",
+				webhook.AccessTokenRef, err)
+		}
+		secret.Data[monitorTokenKey] = []byte(token)
+		if _, err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Update(secret); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("error saving the monitor token of credential %s: %s", webhook.AccessTokenRef, err)
+		}
+		logging.Log.Infof("exchanged the username and password of credential %s for a monitor token", webhook.AccessTokenRef)
+	}
+	if err := r.copyBasicAuth(secret, webhook.Namespace); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// copyBasicAuth creates a basic-auth secret with the username and password of credential in namespace, under the
+// credential's name, for the webhook's pipelines. An existing secret is left as it is, it may be the user's own.
+func (r Resource) copyBasicAuth(credential *corev1.Secret, namespace string) error {
+	if namespace == "" || namespace == r.Defaults.Namespace {
+		return nil
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credential.Name,
+			Namespace: namespace,
+			Labels:    managedLabels(),
+		},
+		Type: corev1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			corev1.BasicAuthUsernameKey: credential.Data["username"],
+			corev1.BasicAuthPasswordKey: credential.Data["password"],
+		},
+	}
+	_, err := r.K8sClient.CoreV1().Secrets(namespace).Create(secret)
+	if k8serrors.IsAlreadyExists(err) {
+		logging.Log.Debugf("secret %s already exists in namespace %s, not copying credential %s", credential.Name, namespace, credential.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error copying credential %s to namespace %s: %s", credential.Name, namespace, err)
+	}
+	logging.Log.Infof("copied credential %s to namespace %s", credential.Name, namespace)
+	return nil
+}
+
+// exchangeForToken asks the git server of repoURL for a token for the username and password in credential
+func (r Resource) exchangeForToken(repoURL string, credential *corev1.Secret) (string, error) {
+	provider, apiURL, err := utils.GetGitProviderAndAPIURL(repoURL)
+	if err != nil {
+		return "", err
+	}
+	sslVerify := r.Install.sslVerification()
+	tlsConfig, err := r.gitTLSConfig(sslVerify, apiURL)
+	if err != nil {
+		return "", err
+	}
+	username, password := string(credential.Data["username"]), string(credential.Data["password"])
+	note := fmt.Sprintf("%s %s %s", monitorTokenNote, credential.Name, time.Now().UTC().Format(time.RFC3339))
+	client := withGitAPISettings(utils.CreateBasicAuthClient(username, password, tlsConfig), r.gitAPI(provider))
+
+	token := struct {
+		// GitHub
+		Token string `json:"token"`
+		// Gitea and Gogs
+		SHA1 string `json:"sha1"`
+		// GitLab
+		AccessToken string `json:"access_token"`
+	}{}
+	switch provider {
+	case "github":
+		// The OAuth authorizations API, which GitHub Enterprise Server keeps for basic authentication
+		err = postJSON(client, strings.TrimSuffix(apiURL, "/")+"/authorizations", map[string]interface{}{"scopes": []string{"repo"}, "note": note}, &token)
+	case "gitea":
+		err = postJSON(client, strings.TrimSuffix(apiURL, "/")+"/users/"+url.PathEscape(username)+"/tokens", map[string]string{"name": note}, &token)
+	case "gitlab":
+		// The resource owner password credentials grant, GitLab doesn't accept basic authentication on its API
+		base := strings.Split(apiURL, "/api/")[0]
+		form := url.Values{"grant_type": {"password"}, "username": {username}, "password": {password}}
+		var resp *http.Response
+		resp, err = withGitAPISettings(&http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}, r.gitAPI(provider)).PostForm(base+"/oauth/token", form)
+		if err == nil {
+			err = decodeTokenResponse(resp, &token)
+		}
+	default:
+		return "", fmt.Errorf("%s doesn't issue tokens for a username and password", provider)
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, value := range []string{token.Token, token.SHA1, token.AccessToken} {
+		if value != "" {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%s returned no token", provider)
+}
+
+func postJSON(client *http.Client, target string, body interface{}, into interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(target, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	return decodeTokenResponse(resp, into)
+}
+
+func decodeTokenResponse(resp *http.Response, into interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", resp.Request.URL.Path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(into)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPrepareBasicAuth(t *testing.T) {
+	exchanges := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != "builder" || password != "apassword" || req.URL.Path != "/api/v1/users/builder/tokens" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		exchanges++
+		fmt.Fprint(w, `{"name": "tekton-webhooks-extension monitor", "sha1": "minted"}`)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	os.Setenv("GITEA_HOSTS", serverURL.Host)
+	defer os.Unsetenv("GITEA_HOSTS")
+
+	r := dummyResource()
+	r.K8sClient.CoreV1().Secrets(installNs).Create(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "basic-auth", Namespace: installNs},
+		Data:       map[string][]byte{"username": []byte("builder"), "password": []byte("apassword")},
+	})
+	hook := webhook{Name: "hook", Namespace: "team-a", GitRepositoryURL: server.URL + "/owner/repo", AccessTokenRef: "basic-auth"}
+
+	// Only admins may have credentials copied outside the install namespace
+	user := dummyRestfulRequest(dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks", nil), "")
+	user.SetAttribute(signedKeyAttribute, "ci")
+	user.SetAttribute(signedScopesAttribute, apiKeyScopes{Namespaces: []string{"team-a"}})
+	if status, err := r.prepareBasicAuth(user, hook); status != http.StatusForbidden || err == nil {
+		t.Errorf("preparing the credential for a caller who isn't an admin returned %d, %v, expected 403", status, err)
+	}
+	if _, err := r.K8sClient.CoreV1().Secrets("team-a").Get("basic-auth", metav1.GetOptions{}); err == nil {
+		t.Error("credential was copied for a caller who isn't an admin")
+	}
+
+	admin := dummyRestfulRequest(dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks", nil), "")
+	admin.SetAttribute(signedKeyAttribute, "ci")
+	admin.SetAttribute(signedScopesAttribute, apiKeyScopes{Admin: true})
+	if status, err := r.prepareBasicAuth(admin, hook); err != nil {
+		t.Fatalf("preparing the credential returned %d: %s", status, err)
+	}
+	credential, _ := r.K8sClient.CoreV1().Secrets(installNs).Get("basic-auth", metav1.GetOptions{})
+	if token := string(credential.Data[monitorTokenKey]); token != "minted" {
+		t.Errorf("monitor token was %q, expected minted", token)
+	}
+	copied, err := r.K8sClient.CoreV1().Secrets("team-a").Get("basic-auth", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("credential was not copied to the webhook's namespace: %s", err)
+	}
+	if copied.Type != corev1.SecretTypeBasicAuth || string(copied.Data["username"]) != "builder" || string(copied.Data["password"]) != "apassword" {
+		t.Errorf("unexpected copy %+v", copied)
+	}
+	if _, found := copied.Data[monitorTokenKey]; found {
+		t.Error("the monitor token was copied to the webhook's namespace")
+	}
+
+	// The token is only exchanged once
+	if _, err := r.prepareBasicAuth(admin, webhook{Namespace: "team-b", GitRepositoryURL: hook.GitRepositoryURL, AccessTokenRef: "basic-auth"}); err != nil {
+		t.Fatal(err)
+	}
+	if exchanges != 1 {
+		t.Errorf("the token was exchanged %d times, expected once", exchanges)
+	}
+
+	// Servers that don't issue tokens for a username and password are refused
+	r.K8sClient.CoreV1().Secrets(installNs).Create(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bitbucket", Namespace: installNs},
+		Data:       map[string][]byte{"username": []byte("builder"), "password": []byte("apassword")},
+	})
+	if status, err := r.prepareBasicAuth(user, webhook{Namespace: installNs, GitRepositoryURL: "https://bitbucket.org/owner/repo", AccessTokenRef: "bitbucket"}); status != http.StatusBadRequest || err == nil {
+		t.Errorf("preparing a Bitbucket username and password returned %d, %v, expected 400", status, err)
+	}
+}
+
+func TestBasicAuthNotPreparedForDeniedWebhook(t *testing.T) {
+	policy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"result": false}`)
+	}))
+	defer policy.Close()
+	os.Setenv("WEBHOOK_POLICY_URL", policy.URL)
+	defer os.Unsetenv("WEBHOOK_POLICY_URL")
+	original := defaultBranchOf
+	defer func() { defaultBranchOf = original }()
+	defaultBranchOf = func(r Resource, hook webhook) (string, error) { return "master", nil }
+
+	r := dummyResource()
+	r.K8sClient.CoreV1().Secrets(installNs).Create(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "basic-auth", Namespace: installNs},
+		Data:       map[string][]byte{"username": []byte("builder"), "password": []byte("apassword")},
+	})
+	hook := webhook{Name: "hook", Namespace: "team-a", GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "basic-auth", Pipeline: "pipeline1"}
+	createTriggerResources(hook, r)
+	if response := createWebhook(hook, r); response.StatusCode() != http.StatusForbidden {
+		t.Fatalf("creating a webhook the policy denies returned %d, expected 403", response.StatusCode())
+	}
+	credential, _ := r.K8sClient.CoreV1().Secrets(installNs).Get("basic-auth", metav1.GetOptions{})
+	if _, found := credential.Data[monitorTokenKey]; found {
+		t.Error("the credential was exchanged for a monitor token for a denied webhook")
+	}
+	if _, err := r.K8sClient.CoreV1().Secrets("team-a").Get("basic-auth", metav1.GetOptions{}); err == nil {
+		t.Error("the credential was copied for a denied webhook")
+	}
+}
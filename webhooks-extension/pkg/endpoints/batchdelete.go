@@ -0,0 +1,141 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.DELETE("/").To(r.profiled(Resource.deleteWebhooks)))
+Deletes every webhook matching the namespace, pipeline and repository query
+parameters, at least one of which must be given, while holding the
+eventlistener lock so no webhook is added to a matching repository part
+way through. Admin only, see admin.go. With dryrun=true nothing is deleted
+and the response previews what would be. Protected webhooks are left, with
+an error, unless force=true, see protection.go.
+---------------------------------------*/
+
+type batchDeleteResult struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Repository string `json:"repository"`
+	Pipeline   string `json:"pipeline"`
+	// Whether the repository's provider webhook goes too, being used by no other webhook
+	RemovesProviderWebhook bool   `json:"removesproviderwebhook"`
+	Deleted                bool   `json:"deleted"`
+	Error                  string `json:"error,omitempty"`
+}
+
+type batchDeleteResponse struct {
+	DryRun  bool                `json:"dryrun"`
+	Results []batchDeleteResult `json:"results"`
+}
+
+// DELETE /webhooks?namespace=x&pipeline=y&repository=z&dryrun=true&deletepipelineruns=true&force=true
+func (r Resource) deleteWebhooks(request *restful.Request, response *restful.Response) {
+	if status, err := r.authorizeAdmin(request); err != nil {
+		logging.Log.Error(err)
+		RespondError(response, err, status)
+		return
+	}
+
+	namespace := request.QueryParameter("namespace")
+	pipeline := request.QueryParameter("pipeline")
+	repo := request.QueryParameter("repository")
+	if namespace == "" && pipeline == "" && repo == "" {
+		err := errors.New("bad request information provided, at least one of namespace, pipeline and repository must be specified as query parameters")
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	flags := map[string]bool{}
+	for _, name := range []string{"dryrun", "deletepipelineruns", "force"} {
+		if value := request.QueryParameter(name); value != "" {
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				err := fmt.Errorf("bad request information provided, cannot handle %s query (should be set to true or not provided)", name)
+				logging.Log.Error(err)
+				RespondError(response, err, http.StatusBadRequest)
+				return
+			}
+			flags[name] = flag
+		}
+	}
+
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error trying to get webhooks: %s.", err.Error())
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	hooksOnRepo := map[string]int{}
+	for _, hook := range hooks {
+		hooksOnRepo[canonicalRepoURL(hook.GitRepositoryURL)]++
+	}
+
+	result := batchDeleteResponse{DryRun: flags["dryrun"], Results: []batchDeleteResult{}}
+	for _, hook := range hooks {
+		if (namespace != "" && hook.Namespace != namespace) || (pipeline != "" && hook.Pipeline != pipeline) ||
+			(repo != "" && !sameRepo(hook.GitRepositoryURL, repo)) {
+			continue
+		}
+		deleteResult := batchDeleteResult{
+			Name:                   hook.Name,
+			Namespace:              hook.Namespace,
+			Repository:             hook.GitRepositoryURL,
+			Pipeline:               hook.Pipeline,
+			RemovesProviderWebhook: matchesAllOnRepo(hooks, hook.GitRepositoryURL, namespace, pipeline, flags["force"]),
+		}
+		if hook.Protected && !flags["force"] {
+			deleteResult.RemovesProviderWebhook = false
+			deleteResult.Error = protectedError(hook).Error()
+		} else if !result.DryRun {
+			if err := r.removeHook(hook, hooksOnRepo[canonicalRepoURL(hook.GitRepositoryURL)], flags["deletepipelineruns"]); err != nil {
+				logging.Log.Errorf("error deleting webhook %s in namespace %s: %s", hook.Name, hook.Namespace, err)
+				deleteResult.Error = err.Error()
+			} else {
+				hooksOnRepo[canonicalRepoURL(hook.GitRepositoryURL)]--
+				deleteResult.Deleted = true
+				logging.Log.Infof("deleted webhook %s in namespace %s", hook.Name, hook.Namespace)
+			}
+		}
+		result.Results = append(result.Results, deleteResult)
+	}
+	response.WriteEntity(result)
+}
+
+// matchesAllOnRepo is whether every webhook on repo is in namespace and uses pipeline, where set, and is
+// unprotected unless force
+func matchesAllOnRepo(hooks []webhook, repo, namespace, pipeline string, force bool) bool {
+	for _, hook := range hooks {
+		if !sameRepo(hook.GitRepositoryURL, repo) {
+			continue
+		}
+		if (namespace != "" && hook.Namespace != namespace) || (pipeline != "" && hook.Pipeline != pipeline) || (hook.Protected && !force) {
+			return false
+		}
+	}
+	return true
+}
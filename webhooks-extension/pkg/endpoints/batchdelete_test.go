@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeAdminReviews accepts the tokens admin and user, only admin being allowed to delete the eventlistener
+func fakeAdminReviews(r *Resource) {
+	fake := r.K8sClient.(*fakek8sclientset.Clientset)
+	fake.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		review.Status.Authenticated = review.Spec.Token == "admin" || review.Spec.Token == "user"
+		review.Status.User = authenticationv1.UserInfo{Username: review.Spec.Token}
+		return true, review, nil
+	})
+	fake.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "admin" && review.Spec.ResourceAttributes.Verb == "delete"
+		return true, review, nil
+	})
+}
+
+func batchDelete(r *Resource, query, token string) (int, batchDeleteResponse) {
+	httpReq := dummyHTTPRequest("DELETE", "http://wwww.dummy.com:8383/webhooks?"+query, nil)
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	httpWriter := httptest.NewRecorder()
+	r.deleteWebhooks(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	result := batchDeleteResponse{}
+	json.NewDecoder(httpWriter.Body).Decode(&result)
+	return httpWriter.Code, result
+}
+
+func TestDeleteWebhooks(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	other := webhook{Name: "other", Namespace: installNs, GitRepositoryURL: hook.GitRepositoryURL, AccessTokenRef: "token1", Pipeline: "pipeline2"}
+	createTriggerResources(hook, r)
+	createTriggerResources(other, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	if _, err := r.updateEventListener(el, other, "owner.repo-"); err != nil {
+		t.Fatalf("error adding webhook: %s", err)
+	}
+
+	for _, test := range []struct {
+		query, token string
+		status       int
+	}{
+		{"pipeline=pipeline1", "", http.StatusUnauthorized},
+		{"pipeline=pipeline1", "stranger", http.StatusUnauthorized},
+		{"pipeline=pipeline1", "user", http.StatusForbidden},
+		{"", "admin", http.StatusBadRequest},
+		{"pipeline=pipeline1&dryrun=maybe", "admin", http.StatusBadRequest},
+	} {
+		if status, _ := batchDelete(r, test.query, test.token); status != test.status {
+			t.Errorf("query %q with token %q returned %d, expected %d", test.query, test.token, status, test.status)
+		}
+	}
+
+	// Previewing changes nothing
+	status, result := batchDelete(r, "pipeline=pipeline1&dryrun=true", "admin")
+	if status != http.StatusOK || !result.DryRun || len(result.Results) != 1 {
+		t.Fatalf("unexpected dry run %d, %+v", status, result)
+	}
+	if preview := result.Results[0]; preview.Name != "hook" || preview.Deleted || preview.RemovesProviderWebhook {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+	if hooks, err := r.getWebhooksFromEventListener(); err != nil || len(hooks) != 2 {
+		t.Fatalf("expected the dry run to leave both webhooks, got %+v, %v", hooks, err)
+	}
+
+	status, result = batchDelete(r, "pipeline=pipeline1", "admin")
+	if status != http.StatusOK || len(result.Results) != 1 || !result.Results[0].Deleted {
+		t.Fatalf("unexpected deletion %d, %+v", status, result)
+	}
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 || hooks[0].Name != "other" {
+		t.Errorf("expected only the other webhook to be left, got %+v, %v", hooks, err)
+	}
+}
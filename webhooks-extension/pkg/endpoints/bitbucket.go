@@ -0,0 +1,382 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	utils "github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+)
+
+/*--------------------------------------
+Repositories on Bitbucket Cloud (https://bitbucket.org/<workspace>/<repo>)
+have their webhooks managed through the Bitbucket 2.0 REST API at
+api.bitbucket.org, called directly as there's no client library for it.
+The access token secret holds a repository, project or workspace access
+token as accessToken, or a Bitbucket username and app password as username
+and password. Webhooks are sent with the secret token, which Bitbucket
+signs deliveries with in the X-Hub-Signature header as GitHub does, and
+subscribe to pushes and to pull requests being created, updated, approved,
+merged, declined and commented on. Bitbucket identifies webhooks by UUID
+rather than by number, GetID being a hash of the UUID.
+---------------------------------------*/
+
+// bitbucketHookEvents are the events Bitbucket webhooks are registered for
+var bitbucketHookEvents = []string{
+	"repo:push",
+	"pullrequest:created",
+	"pullrequest:updated",
+	"pullrequest:approved",
+	"pullrequest:fulfilled",
+	"pullrequest:rejected",
+	"pullrequest:comment_created",
+}
+
+type Bitbucket struct {
+	Client    *http.Client
+	APIURL    string
+	Workspace string
+	Repo      string
+	Secret    string
+	PageSize  int
+	Resource  Resource
+}
+
+type BitbucketWebhook struct {
+	Hook bitbucketHook
+}
+
+// bitbucketHook is a webhook as the Bitbucket API has it
+type bitbucketHook struct {
+	UUID        string   `json:"uuid,omitempty"`
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Active      bool     `json:"active"`
+	Events      []string `json:"events"`
+	Secret      string   `json:"secret,omitempty"`
+}
+
+// bitbucketError is a failed call to the Bitbucket API
+type bitbucketError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *bitbucketError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+func (r Resource) initBitbucket(sslVerify bool, apiURL, secret, workspace, repo string) (*Bitbucket, error) {
+	// Access token is stored as 'accessToken', or 'username' and 'password' for an app password
+	creds, err := utils.GetGitCredentials(r.K8sClient, r.Defaults.Namespace, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := r.gitTLSConfig(sslVerify, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	tc := utils.CreateOAuth2Client(context.Background(), creds.AccessToken, tlsConfig)
+	if creds.Username != "" {
+		tc = utils.CreateBasicAuthClient(creds.Username, creds.Password, tlsConfig)
+	}
+	settings := r.gitAPI("bitbucket")
+	return &Bitbucket{
+		Client:    withGitAPISettings(tc, settings),
+		APIURL:    strings.TrimSuffix(apiURL, "/"),
+		Workspace: workspace,
+		Repo:      repo,
+		Secret:    secret,
+		PageSize:  settings.PageSize,
+		Resource:  r,
+	}, nil
+}
+
+// repoPath is the API path of the repository, followed by path
+func (bb Bitbucket) repoPath(path string) string {
+	return bb.APIURL + "/repositories/" + url.PathEscape(bb.Workspace) + "/" + url.PathEscape(bb.Repo) + path
+}
+
+// do calls the API, decoding the response into result unless it's nil
+func (bb Bitbucket) do(method, address string, body, result interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, address, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := bb.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode >= 300 {
+		message := struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}{}
+		json.Unmarshal(data, &message)
+		if message.Error.Message == "" {
+			message.Error.Message = http.StatusText(resp.StatusCode)
+		}
+		return resp, &bitbucketError{StatusCode: resp.StatusCode, Message: message.Error.Message}
+	}
+	if result == nil {
+		return resp, nil
+	}
+	if raw, ok := result.(*[]byte); ok {
+		*raw = data
+		return resp, nil
+	}
+	return resp, json.Unmarshal(data, result)
+}
+
+// list fetches every page of a listing, calling add with each page's values
+func (bb Bitbucket) list(address string, add func(values json.RawMessage) error) (*http.Response, error) {
+	separator := "?"
+	if strings.Contains(address, "?") {
+		separator = "&"
+	}
+	next := address + separator + "pagelen=" + strconv.Itoa(bb.PageSize)
+	for next != "" {
+		page := struct {
+			Values json.RawMessage `json:"values"`
+			Next   string          `json:"next"`
+		}{}
+		resp, err := bb.do(http.MethodGet, next, nil, &page)
+		if err != nil {
+			return resp, err
+		}
+		if err := add(page.Values); err != nil {
+			return resp, err
+		}
+		next = page.Next
+	}
+	return nil, nil
+}
+
+func (bb Bitbucket) GetAllWebhooks() ([]GitWebhook, error) {
+	webhooks := []GitWebhook{}
+	_, err := bb.list(bb.repoPath("/hooks"), func(values json.RawMessage) error {
+		hooks := []bitbucketHook{}
+		if err := json.Unmarshal(values, &hooks); err != nil {
+			return err
+		}
+		for _, hook := range hooks {
+			webhooks = append(webhooks, BitbucketWebhook{Hook: hook})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, bb.translateError("list", "", err)
+	}
+	return webhooks, nil
+}
+
+func (bb Bitbucket) AddWebhook(hook webhook) error {
+	callback := hookCallbackURL(bb.Resource, hook)
+	hookDefinition, err := bb.hookDefinition(hook, callback)
+	if err != nil {
+		return err
+	}
+	_, err = bb.do(http.MethodPost, bb.repoPath("/hooks"), hookDefinition, nil)
+	return bb.translateError("create", callback, err)
+}
+
+func (bb Bitbucket) UpdateWebhook(existing GitWebhook, hook webhook, callbackURL string) error {
+	uuid, err := bb.hookUUID(existing)
+	if err != nil {
+		return err
+	}
+	hookDefinition, err := bb.hookDefinition(hook, callbackURL)
+	if err != nil {
+		return err
+	}
+	// The whole webhook is replaced on edit, so the secret is sent again
+	_, err = bb.do(http.MethodPut, bb.repoPath("/hooks/"+url.PathEscape(uuid)), hookDefinition, nil)
+	return bb.translateError("update", callbackURL, err)
+}
+
+// hookDefinition builds the Bitbucket webhook pointing at callbackURL, used for both creation and updates
+func (bb Bitbucket) hookDefinition(hook webhook, callbackURL string) (bitbucketHook, error) {
+	_, secretToken, err := utils.GetWebhookSecretTokens(bb.Resource.K8sClient, bb.Resource.Defaults.Namespace, hook.AccessTokenRef)
+	if err != nil {
+		return bitbucketHook{}, err
+	}
+	return bitbucketHook{
+		URL:         callbackURL,
+		Description: "Tekton webhooks extension",
+		Active:      true,
+		Events:      bitbucketHookEvents,
+		Secret:      secretToken,
+	}, nil
+}
+
+func (bb Bitbucket) DeleteWebhook(hook GitWebhook) error {
+	uuid, err := bb.hookUUID(hook)
+	if err != nil {
+		return err
+	}
+	_, err = bb.do(http.MethodDelete, bb.repoPath("/hooks/"+url.PathEscape(uuid)), nil, nil)
+	return bb.translateError("delete", hook.GetURL(), err)
+}
+
+// hookUUID returns the UUID of hook, looking it up by ID for webhooks that aren't Bitbucket's own, e.g. recorded ones
+func (bb Bitbucket) hookUUID(hook GitWebhook) (string, error) {
+	if bbWebhook, ok := hook.(BitbucketWebhook); ok {
+		return bbWebhook.Hook.UUID, nil
+	}
+	hooks, err := bb.GetAllWebhooks()
+	if err != nil {
+		return "", err
+	}
+	for _, existing := range hooks {
+		if existing.GetID() == hook.GetID() {
+			return existing.(BitbucketWebhook).Hook.UUID, nil
+		}
+	}
+	return "", fmt.Errorf("no webhook with ID %d found for %s/%s", hook.GetID(), bb.Workspace, bb.Repo)
+}
+
+// translateError translates the failure of a webhook call, see providererrors.go
+func (bb Bitbucket) translateError(action, callbackURL string, err error) error {
+	if err == nil {
+		return nil
+	}
+	call := providerCall{provider: "Bitbucket", repository: bb.Workspace + "/" + bb.Repo, secret: bb.Secret, action: action, callbackURL: callbackURL}
+	return translateBitbucketError(call, err)
+}
+
+func (bb Bitbucket) SetCommitStatus(sha string, status commitStatus) error {
+	// Bitbucket has no error state and calls pending in progress
+	state := "INPROGRESS"
+	switch status.State {
+	case "success":
+		state = "SUCCESSFUL"
+	case "failure", "error":
+		state = "FAILED"
+	}
+	buildStatus := map[string]string{
+		"state":       state,
+		"key":         boundedName(status.Context, 40),
+		"name":        status.Context,
+		"description": status.Description,
+		"url":         status.TargetURL,
+	}
+	_, err := bb.do(http.MethodPost, bb.repoPath("/commit/"+url.PathEscape(sha)+"/statuses/build"), buildStatus, nil)
+	return err
+}
+
+func (bb Bitbucket) CommentOnPullRequest(number int, body string) error {
+	comment := map[string]interface{}{"content": map[string]string{"raw": body}}
+	_, err := bb.do(http.MethodPost, bb.repoPath("/pullrequests/"+strconv.Itoa(number)+"/comments"), comment, nil)
+	return err
+}
+
+// GetFile reads path from the repository's default branch
+func (bb Bitbucket) GetFile(path string) ([]byte, error) {
+	branch, err := bb.DefaultBranch()
+	if err != nil {
+		return nil, err
+	}
+	content := []byte{}
+	resp, err := bb.do(http.MethodGet, bb.repoPath("/src/"+url.PathEscape(branch)+"/"+strings.TrimPrefix(path, "/")), nil, &content)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, errFileNotFound
+	}
+	return content, err
+}
+
+// DefaultBranch returns the name of the repository's default branch, its main branch as Bitbucket calls it
+func (bb Bitbucket) DefaultBranch() (string, error) {
+	repository := struct {
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}{}
+	if _, err := bb.do(http.MethodGet, bb.repoPath(""), nil, &repository); err != nil {
+		return "", err
+	}
+	return repository.MainBranch.Name, nil
+}
+
+func (bb Bitbucket) ListFiles(dir string) ([]string, error) {
+	branch, err := bb.DefaultBranch()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	dir = strings.Trim(dir, "/")
+	if dir != "" {
+		dir += "/"
+	}
+	resp, err := bb.list(bb.repoPath("/src/"+url.PathEscape(branch)+"/"+dir), func(values json.RawMessage) error {
+		entries := []struct {
+			Type string `json:"type"`
+			Path string `json:"path"`
+		}{}
+		if err := json.Unmarshal(values, &entries); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Type == "commit_file" {
+				files = append(files, entry.Path)
+			}
+		}
+		return nil
+	})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, errFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Bitbucket Webhook -----------------------------------------------------------------------------------------------------
+func (bbWebhook BitbucketWebhook) GetID() int {
+	id := fnv.New32a()
+	id.Write([]byte(bbWebhook.Hook.UUID))
+	return int(id.Sum32() & 0x7fffffff)
+}
+
+func (bbWebhook BitbucketWebhook) GetURL() string {
+	return bbWebhook.Hook.URL
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBitbucketWebhooks(t *testing.T) {
+	hooks := map[string]bitbucketHook{"{existing}": {UUID: "{existing}", URL: "http://old.example.com"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repositories/workspace/repo/hooks":
+			values := []bitbucketHook{}
+			for _, hook := range hooks {
+				values = append(values, hook)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"values": values})
+		case r.Method == http.MethodPost && r.URL.Path == "/repositories/workspace/repo/hooks":
+			hook := bitbucketHook{}
+			json.NewDecoder(r.Body).Decode(&hook)
+			hook.UUID = "{created}"
+			hooks[hook.UUID] = hook
+			json.NewEncoder(w).Encode(hook)
+		case r.Method == http.MethodDelete && r.URL.Path == "/repositories/workspace/repo/hooks/{existing}":
+			delete(hooks, "{existing}")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"type": "error", "error": {"message": "Repository not found"}}`)
+		}
+	}))
+	defer server.Close()
+
+	r := dummyResource()
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bitbucket-token", Namespace: installNs},
+		Data:       map[string][]byte{"accessToken": []byte("access"), "secretToken": []byte("secret")},
+	}
+	if _, err := r.K8sClient.CoreV1().Secrets(installNs).Create(&secret); err != nil {
+		t.Fatalf("error creating secret: %s", err)
+	}
+	bb := Bitbucket{Client: server.Client(), APIURL: server.URL, Workspace: "workspace", Repo: "repo", Secret: "bitbucket-token", PageSize: 10, Resource: *r}
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://bitbucket.org/workspace/repo", AccessTokenRef: "bitbucket-token"}
+
+	if err := bb.AddWebhook(hook); err != nil {
+		t.Fatalf("error adding webhook: %s", err)
+	}
+	created := hooks["{created}"]
+	if created.URL != hookCallbackURL(*r, hook) || created.Secret != "secret" || !created.Active || len(created.Events) != len(bitbucketHookEvents) {
+		t.Errorf("unexpected webhook %+v", created)
+	}
+
+	found, err := bb.GetAllWebhooks()
+	if err != nil || len(found) != 2 {
+		t.Fatalf("expected both webhooks, got %v, %v", found, err)
+	}
+	for _, existing := range found {
+		if existing.GetURL() == "http://old.example.com" {
+			if err := bb.DeleteWebhook(existing); err != nil {
+				t.Fatalf("error deleting webhook: %s", err)
+			}
+		}
+	}
+	if _, ok := hooks["{existing}"]; ok {
+		t.Error("expected the webhook to be deleted")
+	}
+
+	bb.Repo = "missing"
+	err = bb.AddWebhook(hook)
+	if coded, ok := err.(messageError); !ok || coded.code != "BITBUCKET_HOOK_PERMISSION" {
+		t.Errorf("expected a BITBUCKET_HOOK_PERMISSION error, got %v", err)
+	}
+}
+
+func TestBitbucketWebhookID(t *testing.T) {
+	first := BitbucketWebhook{Hook: bitbucketHook{UUID: "{5d3b9a2e-2c4f-4c3b-9a2e-5d3b9a2e2c4f}"}}
+	second := BitbucketWebhook{Hook: bitbucketHook{UUID: "{0a1b2c3d-4e5f-4a1b-8c3d-0a1b2c3d4e5f}"}}
+	again := BitbucketWebhook{Hook: bitbucketHook{UUID: first.Hook.UUID}}
+	if first.GetID() != again.GetID() || first.GetID() == second.GetID() || first.GetID() < 0 {
+		t.Errorf("expected stable, distinct IDs, got %d, %d and %d", first.GetID(), again.GetID(), second.GetID())
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+BodyLimitFilter refuses API requests with a body larger than
+MAX_REQUEST_BODY_BYTES (4MiB by default) with a 413, rather than reading
+them into memory. A request declaring a larger Content-Length is refused
+before its body is read, one sent in chunks once more than the limit has
+been read. Deliveries to the delivery buffer are limited alike by
+MAX_PAYLOAD_BYTES (25MiB by default, the largest payload GitHub sends), as
+they are on the interceptor. Entities are decoded from the body as it is
+read, so only strict decoding, see strict.go, holds a whole body at once.
+The filter is added after AccessLogFilter, so refused requests are logged
+with their 413 status.
+---------------------------------------*/
+
+const (
+	defaultMaxRequestBodyBytes = 4 * 1024 * 1024
+	defaultMaxPayloadBytes     = 25 * 1024 * 1024
+)
+
+// bodyTooLargeError is returned reading a body larger than its limit
+type bodyTooLargeError struct {
+	limit int64
+}
+
+func (e bodyTooLargeError) Error() string {
+	return fmt.Sprintf("the request body is larger than the limit of %d bytes", e.limit)
+}
+
+func getByteLimit(name string, defaultLimit int64) int64 {
+	if limit, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultLimit
+}
+
+// readLimited reads all of body, or returns a bodyTooLargeError once more than limit bytes have been read
+func readLimited(body io.Reader, limit int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, bodyTooLargeError{limit: limit}
+	}
+	return data, nil
+}
+
+// BodyLimitFilter responds with HTTP code 413 to requests with a body larger than MAX_REQUEST_BODY_BYTES
+func BodyLimitFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	body := request.Request.Body
+	if body == nil || body == http.NoBody {
+		chain.ProcessFilter(request, response)
+		return
+	}
+	limit := getByteLimit("MAX_REQUEST_BODY_BYTES", defaultMaxRequestBodyBytes)
+	if request.Request.ContentLength > limit {
+		RespondError(response, bodyTooLargeError{limit: limit}, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if request.Request.ContentLength < 0 {
+		// Sent in chunks, read up to the limit to know its size
+		data, err := readLimited(body, limit)
+		if err != nil {
+			status := http.StatusBadRequest
+			if _, tooLarge := err.(bodyTooLargeError); tooLarge {
+				status = http.StatusRequestEntityTooLarge
+			}
+			logging.Log.Errorf("error reading the request body: %s", err)
+			RespondError(response, err, status)
+			return
+		}
+		request.Request.Body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+	chain.ProcessFilter(request, response)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+func TestBodyLimitFilter(t *testing.T) {
+	os.Setenv("MAX_REQUEST_BODY_BYTES", "16")
+	defer os.Unsetenv("MAX_REQUEST_BODY_BYTES")
+	container := restful.NewContainer()
+	container.Filter(BodyLimitFilter)
+	ws := new(restful.WebService)
+	ws.Path("/webhooks").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	ws.Route(ws.POST("/echo").To(func(request *restful.Request, response *restful.Response) {
+		body := map[string]string{}
+		if err := request.ReadEntity(&body); err != nil {
+			RespondError(response, err, http.StatusBadRequest)
+			return
+		}
+		response.WriteEntity(body)
+	}))
+	container.Add(ws)
+
+	tests := []struct {
+		body     string
+		chunked  bool
+		expected int
+	}{
+		{body: `{"name":"hook"}`, expected: http.StatusOK},
+		{body: `{"name":"hook"}`, chunked: true, expected: http.StatusOK},
+		{body: `{"name":"webhook"}`, expected: http.StatusRequestEntityTooLarge},
+		{body: `{"name":"webhook"}`, chunked: true, expected: http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/echo", ioutil.NopCloser(strings.NewReader(test.body)))
+		httpReq.ContentLength = int64(len(test.body))
+		if test.chunked {
+			httpReq.ContentLength = -1
+		}
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		if httpWriter.Code != test.expected {
+			t.Errorf("body %s (chunked %t): expected status %d, got %d: %s", test.body, test.chunked, test.expected, httpWriter.Code, httpWriter.Body.String())
+		}
+	}
+}
+
+func TestReceiveDeliveryTooLarge(t *testing.T) {
+	os.Setenv("MAX_PAYLOAD_BYTES", "16")
+	defer os.Unsetenv("MAX_PAYLOAD_BYTES")
+	r := dummyResource()
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8081/", strings.NewReader(`{"ref":"refs/heads/master"}`))
+	httpWriter := httptest.NewRecorder()
+	r.receiveDelivery(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a 413 for a delivery over the limit, got %d", httpWriter.Code)
+	}
+}
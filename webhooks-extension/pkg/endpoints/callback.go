@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/migrate-callback").To(r.migrateCallback))
+---------------------------------------*/
+
+// callbackMigration is the request body for migrating to a new callback URL
+type callbackMigration struct {
+	CallbackURL string `json:"callbackurl"`
+}
+
+// callbackMigrationResult reports the outcome of migrating one repository's provider webhook
+type callbackMigrationResult struct {
+	Repository string `json:"repository"`
+	Migrated   bool   `json:"migrated"`
+	Error      string `json:"error,omitempty"`
+}
+
+type callbackMigrationResponse struct {
+	PreviousCallbackURL string                    `json:"previouscallbackurl"`
+	CallbackURL         string                    `json:"callbackurl"`
+	Results             []callbackMigrationResult `json:"results"`
+}
+
+// Moves the eventlistener's ingress/route to a new host and repoints every registered provider webhook at it.
+// This redirects every repository's deliveries, so only admins may call it.
+func (r Resource) migrateCallback(request *restful.Request, response *restful.Response) {
+	if status, err := r.authorizeAdmin(request); err != nil {
+		logging.Log.Error(err)
+		RespondError(response, err, status)
+		return
+	}
+
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	migration := callbackMigration{}
+	if err := readEntity(request, &migration); err != nil {
+		logging.Log.Errorf("error trying to read request entity as callback migration: %s.", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if r.relayed() {
+		err := errors.New("deliveries are relayed from WEBHOOK_RELAY_URL, there is no callback to migrate")
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	newURL := strings.TrimSuffix(migration.CallbackURL, "/")
+	if !strings.HasPrefix(newURL, "http://") && !strings.HasPrefix(newURL, "https://") {
+		err := errors.New("the supplied callbackurl does not specify the protocol http:// or https://")
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	result, err := r.migrateCallbackTo(newURL)
+	if err != nil {
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	response.WriteEntity(result)
+}
+
+// migrateCallbackTo moves the eventlistener's ingress/route to newURL and repoints every registered provider webhook
+// at it, reporting each repository's outcome. The caller holds modifyingEventListenerLock.
+func (r Resource) migrateCallbackTo(newURL string) (callbackMigrationResponse, error) {
+	oldURL := getCallbackURL(r)
+	result := callbackMigrationResponse{
+		PreviousCallbackURL: oldURL,
+		CallbackURL:         newURL,
+		Results:             []callbackMigrationResult{},
+	}
+	if oldURL == newURL {
+		logging.Log.Infof("Callback URL is already %s, nothing to migrate", newURL)
+		return result, nil
+	}
+
+	if err := r.updateCallbackExposure(newURL); err != nil {
+		msg := fmt.Sprintf("error migrating callback URL due to error updating the eventlistener ingress/route: %s", err)
+		logging.Log.Errorf("%s", msg)
+		return result, errors.New(msg)
+	}
+	// Provider code paths read the callback from here, set it before touching any hooks
+	if r.Defaults.Profile != "" {
+		if err := r.setProfileCallbackURL(newURL); err != nil {
+			msg := fmt.Sprintf("error recording the callback URL of profile %s: %s", r.Defaults.Profile, err)
+			logging.Log.Errorf("%s", msg)
+			return result, errors.New(msg)
+		}
+		r.Defaults.CallbackURL = newURL
+	} else {
+		// Saved to the config configmap so the extension still uses it after a restart
+		if err := r.saveCallbackURL(newURL); err != nil {
+			msg := fmt.Sprintf("error recording the callback URL in configmap %s: %s", extensionConfigMap, err)
+			logging.Log.Errorf("%s", msg)
+			return result, errors.New(msg)
+		}
+		os.Setenv("WEBHOOK_CALLBACK_URL", newURL)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error trying to get webhooks: %s.", err.Error())
+		return result, err
+	}
+
+	// One provider webhook is shared by every webhook on a repository
+	migratedRepos := make(map[string]bool)
+	for _, hook := range hooks {
+		_, gitOwner, gitRepo, err := r.getGitValues(hook.GitRepositoryURL)
+		if err != nil {
+			result.Results = append(result.Results, callbackMigrationResult{Repository: hook.GitRepositoryURL, Error: err.Error()})
+			continue
+		}
+		repoKey := canonicalRepoURL(hook.GitRepositoryURL)
+		if migratedRepos[repoKey] {
+			continue
+		}
+		// Webhooks registered against an additional callback, see multicallback.go, stay on it
+		if hook.CallbackURL != "" {
+			continue
+		}
+		migratedRepos[repoKey] = true
+
+		migrationResult := callbackMigrationResult{Repository: hook.GitRepositoryURL, Migrated: true}
+		if err := r.MigrateWebhook(hook, gitOwner, gitRepo, oldURL, newURL); err != nil {
+			logging.Log.Errorf("error migrating webhook for repository %s: %s", hook.GitRepositoryURL, err)
+			migrationResult.Migrated = false
+			migrationResult.Error = err.Error()
+		}
+		result.Results = append(result.Results, migrationResult)
+	}
+
+	logging.Log.Infof("Callback URL migrated from %s to %s", oldURL, newURL)
+	return result, nil
+}
+
+// saveCallbackURL sets callbackurl in the config configmap, creating it if missing, which the extension reads when it
+// starts, see reload.go. As the URL is also applied in place, it isn't reported as pending a restart.
+func (r Resource) saveCallbackURL(callbackURL string) error {
+	configMaps := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace)
+	cm, err := configMaps.Get(extensionConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: extensionConfigMap, Namespace: r.Defaults.Namespace}}
+		cm.Data = map[string]string{"callbackurl": callbackURL}
+		_, err = configMaps.Create(cm)
+	} else if err == nil {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data["callbackurl"] = callbackURL
+		_, err = configMaps.Update(cm)
+	}
+	if err != nil {
+		return err
+	}
+
+	liveConfigLock.Lock()
+	startupConfig["callbackurl"] = callbackURL
+	liveConfigLock.Unlock()
+	return nil
+}
+
+// updateCallbackExposure points the existing ingress, or route on OpenShift, at the host in callbackURL.
+// Nothing is done if the eventlistener has not been exposed yet, it is created with the new host later.
+func (r Resource) updateCallbackExposure(callbackURL string) error {
+	installNs := r.Defaults.Namespace
+	if r.Install.openShift() {
+		route, err := r.RoutesClient.RouteV1().Routes(installNs).Get(r.ingressName(), metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		host := strings.TrimPrefix(callbackURL, "http://")
+		route.Spec.Host = strings.TrimPrefix(host, "https://")
+		_, err = r.RoutesClient.RouteV1().Routes(installNs).Update(route)
+		return err
+	}
+
+	ingress, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Get(r.ingressName(), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	updated := r.newIngress(installNs, callbackURL)
+	ingress.Spec = updated.Spec
+	_, err = r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Update(ingress)
+	return err
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUpdateCallbackExposure(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.CallbackURL = "http://wibble.com"
+
+	// No ingress yet, nothing to update
+	if err := r.updateCallbackExposure("http://wobble.com"); err != nil {
+		t.Errorf("unexpected error updating missing ingress: %s", err.Error())
+	}
+
+	if err := r.createDeleteIngress("create", r.Defaults.Namespace); err != nil {
+		t.Fatalf("error creating ingress: %s", err.Error())
+	}
+	if err := r.updateCallbackExposure("http://wobble.com"); err != nil {
+		t.Errorf("error updating ingress: %s", err.Error())
+	}
+
+	ingress, err := r.K8sClient.ExtensionsV1beta1().Ingresses(r.Defaults.Namespace).Get("el-tekton-webhooks-eventlistener", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting ingress: %s", err.Error())
+	}
+	if ingress.Spec.Rules[0].Host != "wobble.com" {
+		t.Errorf("ingress host was %s, expected wobble.com", ingress.Spec.Rules[0].Host)
+	}
+}
+
+func TestSaveCallbackURL(t *testing.T) {
+	r := dummyResource()
+
+	// Created if missing
+	if err := r.saveCallbackURL("http://wibble.com"); err != nil {
+		t.Fatalf("error saving callback URL: %s", err.Error())
+	}
+	data, err := getConfigData(r.K8sClient, r.Defaults.Namespace)
+	if err != nil || data["callbackurl"] != "http://wibble.com" {
+		t.Errorf("expected callbackurl http://wibble.com, got %v, %v", data, err)
+	}
+
+	// Other settings are kept
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: extensionConfigMap, Namespace: r.Defaults.Namespace},
+		Data:       map[string]string{"loglevel": "info", "callbackurl": "http://wibble.com"},
+	}
+	if _, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Update(cm); err != nil {
+		t.Fatalf("error updating configmap: %s", err.Error())
+	}
+	if err := r.saveCallbackURL("http://wobble.com"); err != nil {
+		t.Fatalf("error saving callback URL: %s", err.Error())
+	}
+	data, err = getConfigData(r.K8sClient, r.Defaults.Namespace)
+	if err != nil || data["callbackurl"] != "http://wobble.com" || data["loglevel"] != "info" {
+		t.Errorf("expected callbackurl http://wobble.com and loglevel info, got %v, %v", data, err)
+	}
+	if startupConfig["callbackurl"] != "http://wobble.com" {
+		t.Error("expected the saved callback URL not to be pending a restart")
+	}
+}
+
+func TestMigrateCallbackNeedsAdmin(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+	r.Defaults.CallbackURL = "http://wibble.com"
+	for token, expected := range map[string]int{"": http.StatusUnauthorized, "user": http.StatusForbidden} {
+		httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/migrate-callback",
+			bytes.NewBufferString(`{"callbackurl": "http://wobble.com"}`))
+		if token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+		httpWriter := httptest.NewRecorder()
+		r.migrateCallback(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+		if httpWriter.Code != expected {
+			t.Errorf("migrating the callback with token %q returned %d, expected %d", token, httpWriter.Code, expected)
+		}
+	}
+	if url := getCallbackURL(*r); url != "http://wibble.com" {
+		t.Errorf("callback URL was changed to %s by a caller who isn't an admin", url)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+A webhook with a canary sends a percentage of its events, and pull requests
+with the canary label, to another pipeline so a new version of a pipeline
+can be trialled. The webhook gets a second pair of triggers using the canary
+pipeline's template and bindings, named <webhook>-<namespace>-push-canary
+and -pullrequest-canary. Both pairs carry the split as headers and the
+interceptor accepts each event on exactly one of them: it is a canary event
+if the pull request has the label, or if a hash of the payload falls within
+the percentage. The split is kept as a binding param.
+---------------------------------------*/
+
+const (
+	// Which of the webhook's triggers this is, primary or canary
+	canaryRouteHeader      = "Wext-Canary-Route"
+	canaryPercentageHeader = "Wext-Canary-Percentage"
+	canaryLabelHeader      = "Wext-Canary-Label"
+)
+
+// canaryRoute is the share of a webhook's events sent to another pipeline
+type canaryRoute struct {
+	Pipeline   string `json:"pipeline"`
+	Percentage int    `json:"percentage,omitempty"`
+	Label      string `json:"label,omitempty"`
+}
+
+// validateCanary checks the split and that the canary pipeline has its template and bindings
+func (r Resource) validateCanary(webhook webhook) error {
+	canary := webhook.Canary
+	if canary == nil {
+		return nil
+	}
+	if canary.Pipeline == "" {
+		return errors.New("canary requires a pipeline")
+	}
+	if canary.Pipeline == webhook.Pipeline {
+		return fmt.Errorf("canary pipeline %s is the webhook's pipeline", canary.Pipeline)
+	}
+	if canary.Percentage < 0 || canary.Percentage > 100 {
+		return fmt.Errorf("canary percentage %d is not between 0 and 100", canary.Percentage)
+	}
+	if canary.Percentage == 0 && canary.Label == "" {
+		return errors.New("canary requires a percentage or a label")
+	}
+	installNs := r.Defaults.Namespace
+	for _, name := range []string{canary.Pipeline + "-push-binding", canary.Pipeline + "-pullrequest-binding"} {
+		if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(name, metav1.GetOptions{}); err != nil {
+			return fmt.Errorf("canary triggerbinding %s could not be found: %s", name, err)
+		}
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(canary.Pipeline+"-template", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("canary triggertemplate %s could not be found: %s", canary.Pipeline+"-template", err)
+	}
+	return nil
+}
+
+// canaryParams is the binding param recording the webhook's canary
+func canaryParams(webhook webhook) []v1alpha1.Param {
+	if webhook.Canary == nil {
+		return []v1alpha1.Param{}
+	}
+	canaryJSON, err := json.Marshal(webhook.Canary)
+	if err != nil {
+		logging.Log.Errorf("error marshalling canary: %s", err)
+	}
+	return []v1alpha1.Param{{Name: "webhooks-tekton-canary", Value: string(canaryJSON)}}
+}
+
+// withCanary returns the webhook's push and pull request triggers, followed by their canaries if it has one
+func withCanary(webhook webhook, push, pullRequest v1alpha1.EventListenerTrigger) []v1alpha1.EventListenerTrigger {
+	canary := webhook.Canary
+	if canary == nil {
+		return []v1alpha1.EventListenerTrigger{push, pullRequest}
+	}
+	prefix := triggerPrefix(webhook)
+	canaryPush := canaryTrigger(push, prefix+"-push-canary", canary.Pipeline+"-push-binding", canary.Pipeline+"-template")
+	canaryPullRequest := canaryTrigger(pullRequest, prefix+"-pullrequest-canary", canary.Pipeline+"-pullrequest-binding", canary.Pipeline+"-template")
+
+	triggers := []v1alpha1.EventListenerTrigger{push, pullRequest, canaryPush, canaryPullRequest}
+	for i := range triggers {
+		route := "primary"
+		if i > 1 {
+			route = "canary"
+		}
+		triggers[i].Interceptors[0].Webhook.Header = append(triggers[i].Interceptors[0].Webhook.Header,
+			pipelinesv1alpha1.Param{Name: canaryRouteHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: route}},
+			pipelinesv1alpha1.Param{Name: canaryPercentageHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: strconv.Itoa(canary.Percentage)}})
+		if canary.Label != "" {
+			triggers[i].Interceptors[0].Webhook.Header = append(triggers[i].Interceptors[0].Webhook.Header,
+				pipelinesv1alpha1.Param{Name: canaryLabelHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: canary.Label}})
+		}
+	}
+	return triggers
+}
+
+// canaryTrigger copies a trigger, running the canary pipeline instead
+func canaryTrigger(trigger v1alpha1.EventListenerTrigger, name, bindingName, templateName string) v1alpha1.EventListenerTrigger {
+	canary := *trigger.DeepCopy()
+	canary.Name = name
+	canary.Bindings[0].Ref = bindingName
+	canary.Template.Name = templateName
+	for i, header := range canary.Interceptors[0].Webhook.Header {
+		if header.Name == "Wext-Trigger-Name" {
+			canary.Interceptors[0].Webhook.Header[i].Value.StringVal = name
+		}
+	}
+	return canary
+}
+
+// withoutHeaders removes the named interceptor headers from a trigger
+func withoutHeaders(trigger v1alpha1.EventListenerTrigger, names ...string) v1alpha1.EventListenerTrigger {
+	headers := []pipelinesv1alpha1.Param{}
+	for _, header := range trigger.Interceptors[0].Webhook.Header {
+		removed := false
+		for _, name := range names {
+			removed = removed || header.Name == name
+		}
+		if !removed {
+			headers = append(headers, header)
+		}
+	}
+	trigger.Interceptors[0].Webhook.Header = headers
+	return trigger
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func triggerHeader(trigger v1alpha1.EventListenerTrigger, name string) string {
+	for _, header := range trigger.Interceptors[0].Webhook.Header {
+		if header.Name == name {
+			return header.Value.StringVal
+		}
+	}
+	return ""
+}
+
+func TestValidateCanary(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, Pipeline: "pipeline1"}
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+
+	valid := []*canaryRoute{
+		nil,
+		{Pipeline: "pipeline2", Percentage: 10},
+		{Pipeline: "pipeline2", Label: "canary"},
+	}
+	for _, canary := range valid {
+		hook.Canary = canary
+		if err := r.validateCanary(hook); err != nil {
+			t.Errorf("unexpected error for canary %+v: %s", canary, err)
+		}
+	}
+	invalid := []*canaryRoute{
+		{Percentage: 10},
+		{Pipeline: "pipeline1", Percentage: 10},
+		{Pipeline: "pipeline2"},
+		{Pipeline: "pipeline2", Percentage: 101},
+		{Pipeline: "pipeline3", Percentage: 10},
+	}
+	for _, canary := range invalid {
+		hook.Canary = canary
+		if err := r.validateCanary(hook); err == nil {
+			t.Errorf("expected an error for canary %+v", canary)
+		}
+	}
+}
+
+func TestCreateEventListenerWithCanary(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		Canary:           &canaryRoute{Pipeline: "pipeline2", Percentage: 10, Label: "canary"},
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	if len(el.Spec.Triggers) != 5 {
+		t.Fatalf("expected push, pull request, their canaries and the monitor, got %d triggers", len(el.Spec.Triggers))
+	}
+	expected := []struct{ name, template, binding, route string }{
+		{"hook-default-push-event", "pipeline1-template", "pipeline1-push-binding", "primary"},
+		{"hook-default-pullrequest-event", "pipeline1-template", "pipeline1-pullrequest-binding", "primary"},
+		{"hook-default-push-canary", "pipeline2-template", "pipeline2-push-binding", "canary"},
+		{"hook-default-pullrequest-canary", "pipeline2-template", "pipeline2-pullrequest-binding", "canary"},
+	}
+	for i, e := range expected {
+		trigger := el.Spec.Triggers[i]
+		if trigger.Name != e.name || trigger.Template.Name != e.template || trigger.Bindings[0].Ref != e.binding {
+			t.Errorf("unexpected trigger %s using %s and %s", trigger.Name, trigger.Template.Name, trigger.Bindings[0].Ref)
+		}
+		if route := triggerHeader(trigger, canaryRouteHeader); route != e.route {
+			t.Errorf("trigger %s route was %s, expected %s", trigger.Name, route, e.route)
+		}
+		if triggerHeader(trigger, canaryPercentageHeader) != "10" || triggerHeader(trigger, canaryLabelHeader) != "canary" {
+			t.Errorf("trigger %s missing the canary split", trigger.Name)
+		}
+		if name := triggerHeader(trigger, "Wext-Trigger-Name"); name != e.name {
+			t.Errorf("trigger %s has Wext-Trigger-Name %s", trigger.Name, name)
+		}
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	if hooks[0].Pipeline != "pipeline1" || !reflect.DeepEqual(hooks[0].Canary, hook.Canary) {
+		t.Errorf("unexpected webhook %+v", hooks[0])
+	}
+
+	// Deleting the webhook removes its canaries, leaving another webhook on the repository
+	other := webhook{Name: "other", Namespace: installNs, GitRepositoryURL: hook.GitRepositoryURL, AccessTokenRef: "token1", Pipeline: "pipeline3"}
+	createTriggerResources(other, r)
+	if el, err = r.updateEventListener(el, other, "owner.repo-"); err != nil {
+		t.Fatalf("error adding webhook: %s", err)
+	}
+	if err := r.deleteFromEventListener("hook-"+installNs, installNs, "owner.repo-", hook); err != nil {
+		t.Fatalf("error deleting webhook: %s", err)
+	}
+	el, err = r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting eventlistener: %s", err)
+	}
+	for _, trigger := range el.Spec.Triggers {
+		if strings.HasPrefix(trigger.Name, "hook-") {
+			t.Errorf("trigger %s left behind", trigger.Name)
+		}
+	}
+	if len(el.Spec.Triggers) != 3 {
+		t.Errorf("expected the other webhook's triggers and the monitor, got %d triggers", len(el.Spec.Triggers))
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/{name}/deliveries/{id}/payload").To(r.profiled(Resource.getDeliveryPayload)))
+A webhook with capturepayloads set has the Wext-Capture-Payload header on
+its triggers: the interceptor keeps the payload of each delivery it accepts
+for them, exactly as the provider sent it, in a secret in the install
+namespace with the delivery's headers. Headers holding the webhook secret
+or a signature made with it are redacted and those the extension sets on
+the trigger are left out. Payloads larger than PAYLOAD_CAPTURE_MAX_BYTES on
+the interceptor deployment (256KiB by default) only have their headers and
+size kept. The extension deletes captures older than PAYLOAD_CAPTURE_TTL
+(24h by default), checking every captureExpiryInterval.
+
+The endpoint serves the payload of a delivery, by the ID the provider gave
+it (X-GitHub-Delivery or X-Gitlab-Event-UUID), as the response body with
+its headers as JSON in the Wext-Delivery-Headers header. Values of fields
+whose names look like they hold a credential are redacted, as for the
+access log, the payload being served byte for byte when it has none.
+---------------------------------------*/
+
+const (
+	captureHeader = "Wext-Capture-Payload"
+	// The delivery's captured headers, as JSON, on a payload response
+	deliveryHeadersHeader = "Wext-Delivery-Headers"
+	// Set on the secrets the interceptor captures payloads in
+	captureLabel          = "webhooks.tekton.dev/payload-capture"
+	captureTimeAnnotation = "webhooks.tekton.dev/captured-at"
+	captureSizeAnnotation = "webhooks.tekton.dev/payload-size"
+	capturedPayloadKey    = "payload"
+	capturedHeadersKey    = "headers"
+	defaultCaptureTTL     = 24 * time.Hour
+	captureExpiryInterval = 10 * time.Minute
+)
+
+// withCapture adds the header asking the interceptor to capture payloads to a trigger's interceptor
+func withCapture(trigger v1alpha1.EventListenerTrigger, webhook webhook) v1alpha1.EventListenerTrigger {
+	if webhook.CapturePayloads {
+		trigger.Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header,
+			pipelinesv1alpha1.Param{Name: captureHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "true"}})
+	}
+	return trigger
+}
+
+func getCaptureTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("PAYLOAD_CAPTURE_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultCaptureTTL
+}
+
+// GET /webhooks/{name}/deliveries/{id}/payload?namespace=<namespace>
+func (r Resource) getDeliveryPayload(request *restful.Request, response *restful.Response) {
+	name, namespace, ok := webhookRef(request, response)
+	if !ok {
+		return
+	}
+	deliveryID := request.PathParameter("id")
+	triggers := webhookTriggerNames(r.triggerPrefixOf(name, namespace))
+	for _, trigger := range triggers {
+		secret, err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Get(r.capturedPayloadSecretName(trigger, deliveryID), metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			logging.Log.Errorf("error: %s", err)
+			RespondError(response, err, http.StatusInternalServerError)
+			return
+		}
+		payload, captured := secret.Data[capturedPayloadKey]
+		if !captured {
+			err := fmt.Errorf("the %s byte payload of delivery %s to webhook %s was too large to capture", secret.Annotations[captureSizeAnnotation], deliveryID, name)
+			logging.Log.Error(err)
+			RespondError(response, err, http.StatusNotFound)
+			return
+		}
+		response.AddHeader(deliveryHeadersHeader, string(secret.Data[capturedHeadersKey]))
+		response.AddHeader("Content-Type", restful.MIME_JSON)
+		response.AddHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", deliveryID+".json"))
+		response.WriteHeader(http.StatusOK)
+		response.Write(redactPayload(payload))
+		return
+	}
+	err := fmt.Errorf("no captured payload found for delivery %s to webhook %s in namespace %s", deliveryID, name, namespace)
+	logging.Log.Error(err)
+	RespondError(response, err, http.StatusNotFound)
+}
+
+// redactPayload returns the payload with the values of sensitive fields redacted, as it is if it has none
+func redactPayload(payload []byte) []byte {
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return payload
+	}
+	before, _ := json.Marshal(value)
+	after, err := json.Marshal(redactValue(value))
+	if err != nil || bytes.Equal(before, after) {
+		return payload
+	}
+	return after
+}
+
+// ExpireCapturedPayloads deletes captured payloads older than PAYLOAD_CAPTURE_TTL until stopCh is closed
+func (r Resource) ExpireCapturedPayloads(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(captureExpiryInterval)
+	defer ticker.Stop()
+	for {
+		for _, profiled := range r.allProfiles() {
+			profiled.expireCapturedPayloads(time.Now())
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireCapturedPayloads deletes the payloads captured more than PAYLOAD_CAPTURE_TTL before now
+func (r Resource) expireCapturedPayloads(now time.Time) {
+	secrets, err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).List(metav1.ListOptions{LabelSelector: captureLabel + "=true"})
+	if err != nil {
+		logging.Log.Errorf("error listing captured payloads: %s", err)
+		return
+	}
+	ttl := getCaptureTTL()
+	for _, secret := range secrets.Items {
+		capturedAt, err := time.Parse(time.RFC3339, secret.Annotations[captureTimeAnnotation])
+		if err != nil {
+			// Captured by hand or damaged, go by when the secret was created
+			capturedAt = secret.CreationTimestamp.Time
+		}
+		if now.Sub(capturedAt) < ttl {
+			continue
+		}
+		if err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Delete(secret.Name, &metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			logging.Log.Errorf("error deleting captured payload %s: %s", secret.Name, err)
+			continue
+		}
+		logging.Log.Debugf("deleted captured payload %s", secret.Name)
+	}
+}
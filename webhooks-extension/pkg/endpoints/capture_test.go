@@ -0,0 +1,138 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func capturedPayload(r *Resource, trigger, deliveryID, payload string, capturedAt time.Time) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        r.capturedPayloadSecretName(trigger, deliveryID),
+			Namespace:   installNs,
+			Labels:      map[string]string{captureLabel: "true"},
+			Annotations: map[string]string{captureTimeAnnotation: capturedAt.UTC().Format(time.RFC3339), captureSizeAnnotation: "100"},
+		},
+		Data: map[string][]byte{capturedHeadersKey: []byte(`{"X-Github-Event":"push","X-Hub-Signature":"[REDACTED]"}`)},
+	}
+	if payload != "" {
+		secret.Data[capturedPayloadKey] = []byte(payload)
+	}
+	r.K8sClient.CoreV1().Secrets(installNs).Create(secret)
+}
+
+func TestCaptureHeaderKeptOnWebhook(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+		CapturePayloads:  true,
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	for _, trigger := range el.Spec.Triggers[:2] {
+		if triggerHeader(trigger, captureHeader) != "true" {
+			t.Errorf("trigger %s missing the capture header", trigger.Name)
+		}
+	}
+	if hooks, err := r.getWebhooksFromEventListener(); err != nil || len(hooks) != 1 || !hooks[0].CapturePayloads {
+		t.Fatalf("capturepayloads not kept on the webhook, got %+v, %v", hooks, err)
+	}
+}
+
+func TestGetDeliveryPayload(t *testing.T) {
+	r := dummyResource()
+	payload := `{"ref": "refs/heads/master",  "after": "abc"}`
+	capturedPayload(r, "hook-"+installNs+"-pullrequest-event", "1234", payload, time.Now())
+
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/hook/deliveries/1234/payload?namespace="+installNs, nil)
+	req := dummyRestfulRequest(httpReq, "hook")
+	req.PathParameters()["id"] = "1234"
+	httpWriter := httptest.NewRecorder()
+	r.getDeliveryPayload(req, dummyRestfulResponse(httpWriter))
+
+	if httpWriter.Code != http.StatusOK {
+		t.Fatalf("status was %d: %s", httpWriter.Code, httpWriter.Body.String())
+	}
+	if httpWriter.Body.String() != payload {
+		t.Errorf("payload was not served as captured: %s", httpWriter.Body.String())
+	}
+	if headers := httpWriter.Header().Get(deliveryHeadersHeader); headers != `{"X-Github-Event":"push","X-Hub-Signature":"[REDACTED]"}` {
+		t.Errorf("headers were %s", headers)
+	}
+
+	req = dummyRestfulRequest(dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/hook/deliveries/5678/payload?namespace="+installNs, nil), "hook")
+	req.PathParameters()["id"] = "5678"
+	httpWriter = httptest.NewRecorder()
+	r.getDeliveryPayload(req, dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusNotFound {
+		t.Errorf("status for a delivery not captured was %d", httpWriter.Code)
+	}
+}
+
+func TestGetDeliveryPayloadTooLarge(t *testing.T) {
+	r := dummyResource()
+	capturedPayload(r, "hook-"+installNs+"-push-event", "1234", "", time.Now())
+
+	req := dummyRestfulRequest(dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/hook/deliveries/1234/payload?namespace="+installNs, nil), "hook")
+	req.PathParameters()["id"] = "1234"
+	httpWriter := httptest.NewRecorder()
+	r.getDeliveryPayload(req, dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusNotFound {
+		t.Errorf("status for a payload too large to capture was %d", httpWriter.Code)
+	}
+}
+
+func TestRedactPayload(t *testing.T) {
+	tests := map[string]string{
+		`{"ref":  "refs/heads/master"}`:                         `{"ref":  "refs/heads/master"}`,
+		`{"hook":{"config":{"secret":"s3cret","url":"https"}}}`: `{"hook":{"config":{"secret":"[REDACTED]","url":"https"}}}`,
+		`not json`: `not json`,
+	}
+	for payload, expected := range tests {
+		if redacted := string(redactPayload([]byte(payload))); redacted != expected {
+			t.Errorf("payload %s redacted to %s, expected %s", payload, redacted, expected)
+		}
+	}
+}
+
+func TestExpireCapturedPayloads(t *testing.T) {
+	r := dummyResource()
+	now := time.Now()
+	capturedPayload(r, "hook-"+installNs+"-push-event", "old", "{}", now.Add(-2*defaultCaptureTTL))
+	capturedPayload(r, "hook-"+installNs+"-push-event", "new", "{}", now.Add(-time.Minute))
+
+	r.expireCapturedPayloads(now)
+
+	if _, err := r.K8sClient.CoreV1().Secrets(installNs).Get(r.capturedPayloadSecretName("hook-"+installNs+"-push-event", "old"), metav1.GetOptions{}); err == nil {
+		t.Error("payload captured before the TTL was not deleted")
+	}
+	if _, err := r.K8sClient.CoreV1().Secrets(installNs).Get(r.capturedPayloadSecretName("hook-"+installNs+"-push-event", "new"), metav1.GetOptions{}); err != nil {
+		t.Errorf("payload captured within the TTL was deleted: %s", err)
+	}
+}
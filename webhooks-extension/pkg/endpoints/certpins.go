@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	utils "github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+)
+
+/*--------------------------------------
+Calls to a git server's API carry the access token, so an install that
+can't trust every CA, or a corporate proxy re-signing traffic, can pin the
+certificates its git servers are expected to present. GIT_CERT_PINS lists,
+separated by spaces or semicolons, <host>=<pin>[,<pin>...] where host is
+the API's host (api.github.com for github.com) and each pin is
+sha256/<base64 SHA-256 of a certificate's SubjectPublicKeyInfo>, as in
+HTTP public key pinning. The provider clients check the pins of a pinned
+host during the TLS handshake, before a request is sent: with
+SSL_VERIFICATION_ENABLED one of the certificates of the verified chain has
+to match, the server's own certificate otherwise. Pinned hosts can't be
+called over http. Listing a second pin for the next key lets a server's
+key be rotated without downtime. Pins that can't be read are ignored, a
+host none of whose pins can be read having every call refused rather than
+being left unpinned.
+---------------------------------------*/
+
+const certPinPrefix = "sha256/"
+
+// setCertPinDefaults reads the git servers' certificate pins from the environment
+func setCertPinDefaults(defaults *EnvDefaults) {
+	defaults.GitCertPins = parseCertPins(os.Getenv("GIT_CERT_PINS"))
+}
+
+// parseCertPins parses GIT_CERT_PINS into the pins of each host, ignoring those that can't be read
+func parseCertPins(value string) map[string][]string {
+	var pins map[string][]string
+	for _, entry := range strings.FieldsFunc(value, func(c rune) bool { return c == ';' || unicode.IsSpace(c) }) {
+		parts := strings.SplitN(entry, "=", 2)
+		host := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(parts) != 2 || host == "" {
+			logging.Log.Errorf("ignoring %s in GIT_CERT_PINS, expected <host>=<pin>[,<pin>...]", entry)
+			continue
+		}
+		if pins == nil {
+			pins = map[string][]string{}
+		}
+		if _, found := pins[host]; !found {
+			pins[host] = []string{}
+		}
+		for _, pin := range strings.Split(parts[1], ",") {
+			pin = strings.TrimSpace(pin)
+			if err := validateCertPin(pin); err != nil {
+				logging.Log.Errorf("ignoring pin %s of %s in GIT_CERT_PINS: %s", pin, host, err)
+				continue
+			}
+			pins[host] = append(pins[host], pin)
+		}
+	}
+	return pins
+}
+
+func validateCertPin(pin string) error {
+	if !strings.HasPrefix(pin, certPinPrefix) {
+		return fmt.Errorf("pins must start with %s", certPinPrefix)
+	}
+	hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, certPinPrefix))
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("pins must be a base64 SHA-256 hash")
+	}
+	return nil
+}
+
+// certPin is the pin of cert's public key
+func certPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return certPinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// gitTLSConfig returns the TLS config for calls to the git API at apiURL, checking its certificate pins if it
+// has any
+func (r Resource) gitTLSConfig(sslVerify bool, apiURL string) (*tls.Config, error) {
+	config := utils.GitTLSConfig(sslVerify)
+	parsed, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	host := strings.ToLower(parsed.Hostname())
+	pins, pinned := r.Defaults.GitCertPins[host]
+	if !pinned {
+		return config, nil
+	}
+	if parsed.Scheme != "https" {
+		return nil, fmt.Errorf("%s has certificate pins so its API can't be called over %s", host, parsed.Scheme)
+	}
+	config.VerifyPeerCertificate = verifyCertPins(host, pins)
+	return config, nil
+}
+
+// verifyCertPins returns a check that host's certificates match one of pins
+func verifyCertPins(host string, pins []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		certs := []*x509.Certificate{}
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(verifiedChains) == 0 && len(rawCerts) > 0 {
+			// Unverified, only the server's own certificate is known to be the server's
+			leaf, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			certs = append(certs, leaf)
+		}
+		for _, cert := range certs {
+			presented := certPin(cert)
+			for _, pin := range pins {
+				if presented == pin {
+					return nil
+				}
+			}
+		}
+		logging.Log.Errorf("refusing the certificate of %s, it matches none of its pins", host)
+		return fmt.Errorf("the certificate of %s matches none of its pins in GIT_CERT_PINS", host)
+	}
+}
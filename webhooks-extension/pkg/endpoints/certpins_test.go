@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testPin1 = "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	testPin2 = "sha256/LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+)
+
+func TestParseCertPins(t *testing.T) {
+	pins := parseCertPins("GHE.example.com=" + testPin1 + "," + testPin2 + "; gitlab.example.com=" + testPin1 + ",sha1/abc\nbroken=md5/x nohost")
+	expected := map[string][]string{
+		"ghe.example.com":    {testPin1, testPin2},
+		"gitlab.example.com": {testPin1},
+		"broken":             {},
+	}
+	if !reflect.DeepEqual(pins, expected) {
+		t.Errorf("pins were %v, expected %v", pins, expected)
+	}
+	if pins := parseCertPins(""); pins != nil {
+		t.Errorf("expected no pins, got %v", pins)
+	}
+}
+
+func TestGitTLSConfigChecksPins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+	plain, _ := url.Parse(server.URL)
+	host := plain.Hostname()
+	serverPin := certPin(server.Certificate())
+
+	r := dummyResource()
+	get := func(pins []string) error {
+		r.Defaults.GitCertPins = map[string][]string{host: pins}
+		config, err := r.gitTLSConfig(false, server.URL+"/api/v3/")
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := get([]string{testPin1, serverPin}); err != nil {
+		t.Errorf("expected the pinned certificate to be accepted, got %s", err)
+	}
+	if err := get([]string{testPin1}); err == nil || !strings.Contains(err.Error(), "matches none of its pins") {
+		t.Errorf("expected the certificate to be refused, got %v", err)
+	}
+	if err := get([]string{}); err == nil {
+		t.Error("expected a host without readable pins to be refused")
+	}
+
+	plain.Scheme = "http"
+	if _, err := r.gitTLSConfig(false, plain.String()); err == nil {
+		t.Error("expected a pinned host to be refused over http")
+	}
+	r.Defaults.GitCertPins = nil
+	if config, err := r.gitTLSConfig(false, plain.String()); err != nil || config.VerifyPeerCertificate != nil {
+		t.Errorf("expected an unpinned host not to be checked, got %v", err)
+	}
+}
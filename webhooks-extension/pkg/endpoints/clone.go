@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/{name}/clone").To(r.profiled(Resource.cloneWebhook)))
+Creates a webhook with the configuration of an existing one, changing only
+what is given in the request body, e.g. to set up the same pipeline on a
+similar repository. The clone is validated and created exactly as POST
+/webhooks would, using the source's credential unless another is given. A
+release name that defaulted to the source's repository name defaults to
+the clone's.
+---------------------------------------*/
+
+// webhookClone holds what is changed from the source webhook, empty values being copied
+type webhookClone struct {
+	Name             string `json:"name"`
+	Namespace        string `json:"namespace"`
+	GitRepositoryURL string `json:"gitrepositoryurl"`
+	Pipeline         string `json:"pipeline"`
+	AccessTokenRef   string `json:"accesstoken"`
+}
+
+// POST /webhooks/{name}/clone?namespace=x
+func (r Resource) cloneWebhook(request *restful.Request, response *restful.Response) {
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	name := request.PathParameter("name")
+	namespace := request.QueryParameter("namespace")
+	if namespace == "" {
+		RespondError(response, errors.New("namespace query parameter is required"), http.StatusBadRequest)
+		return
+	}
+	changes := webhookClone{}
+	if err := readEntity(request, &changes); err != nil {
+		logging.Log.Errorf("error trying to read request entity as webhook clone: %s.", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	for _, source := range hooks {
+		if source.Name == name && source.Namespace == namespace {
+			clone := cloneOf(source, changes)
+			logging.Log.Infof("cloning webhook %s in namespace %s as %s in namespace %s for %s",
+				name, namespace, clone.Name, clone.Namespace, clone.GitRepositoryURL)
+			r.createWebhookFrom(request, clone, response)
+			return
+		}
+	}
+	RespondError(response, newMessageError("WEBHOOK_NOT_FOUND", map[string]string{"name": name, "namespace": namespace}), http.StatusNotFound)
+}
+
+// cloneOf is source with changes applied
+func cloneOf(source webhook, changes webhookClone) webhook {
+	clone := source
+	clone.Health = nil
+	if changes.Name != "" {
+		clone.Name = changes.Name
+	}
+	if changes.Namespace != "" {
+		clone.Namespace = changes.Namespace
+	}
+	if changes.Pipeline != "" {
+		clone.Pipeline = changes.Pipeline
+	}
+	if changes.AccessTokenRef != "" {
+		clone.AccessTokenRef = changes.AccessTokenRef
+	}
+	if changes.GitRepositoryURL != "" && !sameRepo(changes.GitRepositoryURL, source.GitRepositoryURL) {
+		clone.GitRepositoryURL = changes.GitRepositoryURL
+		sourceRepo := source.GitRepositoryURL[strings.LastIndex(source.GitRepositoryURL, "/")+1:]
+		if source.ReleaseName == sourceRepo {
+			clone.ReleaseName = ""
+		}
+	}
+	return clone
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func cloneWebhook(r *Resource, name string, changes webhookClone) int {
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(changes)
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/"+name+"/clone?namespace="+installNs, body)
+	httpWriter := httptest.NewRecorder()
+	resp := dummyRestfulResponse(httpWriter)
+	r.cloneWebhook(dummyRestfulRequest(httpReq, name), resp)
+	return resp.StatusCode()
+}
+
+func TestCloneOf(t *testing.T) {
+	source := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		ReleaseName:      "repo",
+		Owner:            "alice@example.com",
+		Health:           &webhookHealth{Healthy: true},
+	}
+	clone := cloneOf(source, webhookClone{Name: "other", GitRepositoryURL: "https://github.com/owner/other"})
+	if clone.Name != "other" || clone.GitRepositoryURL != "https://github.com/owner/other" || clone.ReleaseName != "" ||
+		clone.AccessTokenRef != "token1" || clone.Pipeline != "pipeline1" || clone.Owner != source.Owner || clone.Health != nil {
+		t.Errorf("unexpected clone %+v", clone)
+	}
+
+	source.ReleaseName = "release1"
+	if clone := cloneOf(source, webhookClone{GitRepositoryURL: "https://github.com/owner/other"}); clone.ReleaseName != "release1" {
+		t.Errorf("expected a release name that was set to be kept, got %s", clone.ReleaseName)
+	}
+}
+
+func TestCloneWebhook(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		CostCenter:       "cc1",
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	if status := cloneWebhook(r, "missing", webhookClone{Name: "clone"}); status != http.StatusNotFound {
+		t.Errorf("cloning a missing webhook returned %d", status)
+	}
+	// Validated as a fresh create, the same pipeline in the same namespace is already set up on the repository
+	if status := cloneWebhook(r, "hook", webhookClone{Name: "clone"}); status != http.StatusBadRequest {
+		t.Errorf("cloning a duplicate returned %d", status)
+	}
+	if status := cloneWebhook(r, "hook", webhookClone{Name: "clone", Pipeline: "pipeline2"}); status != http.StatusCreated {
+		t.Fatalf("cloning returned %d", status)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 2 {
+		t.Fatalf("expected two webhooks, got %+v, %v", hooks, err)
+	}
+	clone := hooks[0]
+	if clone.Name != "clone" {
+		clone = hooks[1]
+	}
+	if clone.Name != "clone" || clone.Pipeline != "pipeline2" || clone.AccessTokenRef != "token1" ||
+		clone.GitRepositoryURL != hook.GitRepositoryURL || clone.CostCenter != "cc1" {
+		t.Errorf("unexpected clone %+v", clone)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+)
+
+/*--------------------------------------
+A webhook's onsuccesscomment, onfailurecomment, ontimeoutcomment and
+onmissingcomment may be Go templates, e.g.
+
+	{{.Pipeline}} passed, see [{{.PipelineRun}}]({{.Link}})
+
+in which case the monitor controller comments the rendered template rather
+than the comment followed by a link to the PipelineRun. The fields are those
+of commentData. Templates are parsed and run against sample data when the
+webhook is created, so a typo is refused then with where it is, rather than
+found when the first pull request's PipelineRun completes. The monitor task
+can't render templates and reports the default comments instead.
+---------------------------------------*/
+
+// commentData is what a comment template is rendered with
+type commentData struct {
+	Repository  string
+	PullRequest int
+	Namespace   string
+	Pipeline    string
+	PipelineRun string
+	Link        string
+	// success, failure or error
+	State string
+}
+
+var sampleCommentData = commentData{
+	Repository:  "https://github.com/owner/repo",
+	PullRequest: 1,
+	Namespace:   "default",
+	Pipeline:    "pipeline",
+	PipelineRun: "pipeline-run-1",
+	Link:        "https://dashboard.example.com/#/namespaces/default/pipelineruns/pipeline-run-1",
+	State:       "success",
+}
+
+const commentFields = ".Repository, .PullRequest, .Namespace, .Pipeline, .PipelineRun, .Link and .State"
+
+// isCommentTemplate is whether comment has template actions
+func isCommentTemplate(comment string) bool {
+	return strings.Contains(comment, "{{")
+}
+
+// validateCommentTemplates returns why a comment of webhook that is a template can't be rendered
+func validateCommentTemplates(webhook webhook) error {
+	comments := []struct{ name, comment string }{
+		{"onsuccesscomment", webhook.OnSuccessComment},
+		{"onfailurecomment", webhook.OnFailureComment},
+		{"ontimeoutcomment", webhook.OnTimeoutComment},
+		{"onmissingcomment", webhook.OnMissingComment},
+	}
+	for _, c := range comments {
+		if !isCommentTemplate(c.comment) {
+			continue
+		}
+		tmpl, err := parseCommentTemplate(c.name, c.comment)
+		if err != nil {
+			return fmt.Errorf("%s is not a valid template: %s", c.name, err)
+		}
+		if err := tmpl.Execute(ioutil.Discard, sampleCommentData); err != nil {
+			return fmt.Errorf("%s can't be rendered: %s, the fields are %s", c.name, err, commentFields)
+		}
+	}
+	return nil
+}
+
+func parseCommentTemplate(name, comment string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(comment)
+}
+
+// renderComment renders the comment template with data
+func renderComment(name, comment string, data commentData) (string, error) {
+	tmpl, err := parseCommentTemplate(name, comment)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
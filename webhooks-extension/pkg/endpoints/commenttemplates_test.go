@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCommentTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		hook     webhook
+		expected string
+	}{
+		{name: "plain comments", hook: webhook{OnSuccessComment: "Erfolg", OnFailureComment: "Fehler"}},
+		{name: "template", hook: webhook{OnSuccessComment: "{{.Pipeline}} passed, see [{{.PipelineRun}}]({{.Link}})"}},
+		{name: "unclosed action", hook: webhook{OnFailureComment: "Failed\n{{.Pipeline"},
+			expected: "onfailurecomment is not a valid template: template: onfailurecomment:2: unclosed action"},
+		{name: "unknown field", hook: webhook{OnTimeoutComment: "{{.PipelineRun}} of {{.Pipelin}} timed out"},
+			expected: `ontimeoutcomment can't be rendered: template: ontimeoutcomment:1:22: executing "ontimeoutcomment" at <.Pipelin>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCommentTemplates(tt.hook)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+				t.Errorf("expected an error starting %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestRenderComment(t *testing.T) {
+	data := commentData{Pipeline: "build", PipelineRun: "build-run-1", Link: "https://dashboard.example.com/run", PullRequest: 7}
+	rendered, err := renderComment("success", "{{.Pipeline}} passed on #{{.PullRequest}}, see [{{.PipelineRun}}]({{.Link}})", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "build passed on #7, see [build-run-1](https://dashboard.example.com/run)"; rendered != expected {
+		t.Errorf("comment was %q, expected %q", rendered, expected)
+	}
+}
+
+func TestMonitorTaskGetsDefaultForTemplates(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+		OnSuccessComment: "{{.Pipeline}} passed",
+		OnFailureComment: "Fehler",
+	}
+	_, monitorParams, err := r.getParams(hook)
+	if err != nil {
+		t.Fatalf("getParams: %s", err)
+	}
+	comments := map[string]string{}
+	for _, param := range monitorParams {
+		comments[param.Name] = param.Value
+	}
+	if comments["commentsuccess"] != "Success" || comments["commentfailure"] != "Fehler" {
+		t.Errorf("unexpected monitor comments %v", comments)
+	}
+}
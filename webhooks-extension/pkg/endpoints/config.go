@@ -0,0 +1,337 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	routesv1 "github.com/openshift/api/route/v1"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/defaults/effective").To(r.profiled(Resource.getEffectiveConfig)))
+GET /webhooks/defaults returns the settings the UI needs. The effective
+configuration adds what the extension worked out from them and found on
+the cluster, so support can see why webhooks aren't firing from one page:
+how the eventlistener is exposed and its certificate, the credentials, how
+the interceptor and eventlistener are running and which features are on.
+Problems looking anything up are reported in place rather than failing
+the request.
+---------------------------------------*/
+
+const interceptorDeploymentName = "tekton-webhooks-extension-validator"
+
+type effectiveConfig struct {
+	Defaults      EnvDefaults         `json:"defaults"`
+	CallbackURL   string              `json:"callbackurl"`
+	Exposure      exposureStatus      `json:"exposure"`
+	Credentials   []credentialStatus  `json:"credentials"`
+	Git           gitConfig           `json:"git"`
+	Install       InstallConfig       `json:"install"`
+	Interceptor   interceptorStatus   `json:"interceptor"`
+	EventListener eventListenerStatus `json:"eventlistener"`
+	Features      map[string]bool     `json:"features"`
+}
+
+// exposureStatus is the ingress, or route on OpenShift, the git providers deliver to
+type exposureStatus struct {
+	Mode   string `json:"mode"`
+	Name   string `json:"name"`
+	Exists bool   `json:"exists"`
+	Host   string `json:"host,omitempty"`
+	// The load balancer address of the ingress, or the host a router admitted the route with
+	Address    string `json:"address,omitempty"`
+	TLS        bool   `json:"tls"`
+	CertSecret string `json:"certsecret,omitempty"`
+	CertExpiry string `json:"certexpiry,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type credentialStatus struct {
+	Name string `json:"name"`
+	// token or basic
+	Type     string `json:"type"`
+	Webhooks int    `json:"webhooks"`
+}
+
+type gitConfig struct {
+	// live, record or replay, see offline.go
+	ProviderMode          string   `json:"providermode"`
+	SSLVerification       bool     `json:"sslverification"`
+	CustomCA              bool     `json:"customca"`
+	GitHubEnterpriseHosts []string `json:"githubenterprisehosts,omitempty"`
+}
+
+type interceptorStatus struct {
+	ReadyReplicas     int32  `json:"readyreplicas"`
+	EventBus          string `json:"eventbus,omitempty"`
+	ProvenanceSigning bool   `json:"provenancesigning"`
+	Error             string `json:"error,omitempty"`
+}
+
+type eventListenerStatus struct {
+	Name          string `json:"name"`
+	Exists        bool   `json:"exists"`
+	Replicas      int32  `json:"replicas"`
+	ReadyReplicas int32  `json:"readyreplicas"`
+	Address       string `json:"address,omitempty"`
+	Triggers      int    `json:"triggers"`
+	Webhooks      int    `json:"webhooks"`
+	Error         string `json:"error,omitempty"`
+}
+
+// GET /webhooks/defaults/effective
+func (r Resource) getEffectiveConfig(request *restful.Request, response *restful.Response) {
+	response.WriteEntity(r.effectiveConfig())
+}
+
+func (r Resource) effectiveConfig() effectiveConfig {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error getting webhooks for the effective configuration: %s", err)
+	}
+	config := effectiveConfig{
+		Defaults:      r.defaultsResponse().EnvDefaults,
+		CallbackURL:   getCallbackURL(r),
+		Exposure:      r.exposureStatus(),
+		Credentials:   r.credentialStatuses(hooks),
+		Git:           r.getGitConfig(),
+		Install:       r.Install,
+		Interceptor:   r.interceptorStatus(),
+		EventListener: r.eventListenerStatus(len(hooks)),
+		Features: map[string]bool{
+			"deliverybuffer":    r.Defaults.DeliveryBuffer,
+			"monitorcontroller": r.Defaults.MonitorController,
+			"pprof":             pprofEnabled(),
+			"policy":            os.Getenv("WEBHOOK_POLICY_URL") != "",
+			"expirynotify":      os.Getenv("EXPIRY_NOTIFY_URL") != "",
+			"profiles":          r.Defaults.Profile != "" || len(r.allProfiles()) > 1,
+			"tunnel":            os.Getenv("WEBHOOK_TUNNEL") != "",
+			"relay":             r.relayed(),
+			"impersonation":     impersonationEnabled(),
+		},
+	}
+	return config
+}
+
+func (r Resource) exposureStatus() exposureStatus {
+	installNs := r.Defaults.Namespace
+	status := exposureStatus{Mode: "ingress", Name: r.ingressName()}
+	if r.Install.openShift() {
+		status.Mode = "route"
+		route, err := r.RoutesClient.RouteV1().Routes(installNs).Get(status.Name, metav1.GetOptions{})
+		if err != nil {
+			status.Error = lookupError(err)
+			return status
+		}
+		status.Exists = true
+		status.Host = route.Spec.Host
+		status.TLS = route.Spec.TLS != nil
+		for _, ingress := range route.Status.Ingress {
+			for _, condition := range ingress.Conditions {
+				if condition.Type == routesv1.RouteAdmitted && condition.Status == corev1.ConditionTrue {
+					status.Address = ingress.Host
+				}
+			}
+		}
+		return status
+	}
+
+	ingress, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Get(status.Name, metav1.GetOptions{})
+	if err != nil {
+		status.Error = lookupError(err)
+		return status
+	}
+	status.Exists = true
+	if len(ingress.Spec.Rules) > 0 {
+		status.Host = ingress.Spec.Rules[0].Host
+	}
+	for _, balancer := range ingress.Status.LoadBalancer.Ingress {
+		if status.Address = balancer.IP; status.Address == "" {
+			status.Address = balancer.Hostname
+		}
+	}
+	if len(ingress.Spec.TLS) == 0 {
+		return status
+	}
+	status.TLS = true
+	status.CertSecret = ingress.Spec.TLS[0].SecretName
+	secret, err := r.K8sClient.CoreV1().Secrets(installNs).Get(status.CertSecret, metav1.GetOptions{})
+	if err != nil {
+		status.Error = lookupError(err)
+		return status
+	}
+	expiry, err := certificateExpiry(secret.Data["tls.crt"])
+	if err != nil {
+		status.Error = "error reading certificate " + status.CertSecret + ": " + err.Error()
+		return status
+	}
+	status.CertExpiry = expiry.UTC().Format(time.RFC3339)
+	if expiry.Before(time.Now()) {
+		status.Error = "certificate " + status.CertSecret + " has expired"
+	}
+	return status
+}
+
+// certificateExpiry is when the first certificate in PEM encoded data expires
+func certificateExpiry(data []byte) (time.Time, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, errors.New("no PEM encoded certificate found")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return certificate.NotAfter, nil
+}
+
+// credentialStatuses lists the credentials in the install namespace and how many webhooks use each
+func (r Resource) credentialStatuses(hooks []webhook) []credentialStatus {
+	statuses := []credentialStatus{}
+	secrets, err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		logging.Log.Errorf("error listing secrets for the effective configuration: %s", err)
+		return statuses
+	}
+	for _, secret := range secrets.Items {
+		cred := secretToCredential(&secret, true)
+		if cred.Name == "" {
+			continue
+		}
+		status := credentialStatus{Name: cred.Name, Type: "token"}
+		if cred.Username != "" {
+			status.Type = "basic"
+		}
+		for _, hook := range hooks {
+			if hook.AccessTokenRef == cred.Name {
+				status.Webhooks++
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func (r Resource) getGitConfig() gitConfig {
+	config := gitConfig{
+		ProviderMode:    getProviderMode(),
+		SSLVerification: r.Install.sslVerification(),
+	}
+	if config.ProviderMode == "" {
+		config.ProviderMode = "live"
+	}
+	if _, err := os.Stat(utils.GitCACertPath); err == nil {
+		config.CustomCA = true
+	}
+	for _, host := range strings.Split(os.Getenv("GITHUB_ENTERPRISE_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			config.GitHubEnterpriseHosts = append(config.GitHubEnterpriseHosts, host)
+		}
+	}
+	return config
+}
+
+// interceptorStatus reads how the interceptor runs from its deployment's environment
+func (r Resource) interceptorStatus() interceptorStatus {
+	status := interceptorStatus{}
+	deployment, err := r.K8sClient.AppsV1().Deployments(r.Defaults.Namespace).Get(interceptorDeploymentName, metav1.GetOptions{})
+	if err != nil {
+		status.Error = lookupError(err)
+		return status
+	}
+	status.ReadyReplicas = deployment.Status.ReadyReplicas
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			switch env.Name {
+			case "EVENT_BUS_TYPE":
+				status.EventBus = env.Value
+			case "PROVENANCE_SIGNING_SECRET":
+				status.ProvenanceSigning = env.Value != ""
+			}
+		}
+	}
+	return status
+}
+
+func (r Resource) eventListenerStatus(webhooks int) eventListenerStatus {
+	status := eventListenerStatus{Name: r.eventListenerName(), Webhooks: webhooks}
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(r.Defaults.Namespace).Get(status.Name, metav1.GetOptions{})
+	if err != nil {
+		status.Error = lookupError(err)
+		return status
+	}
+	status.Exists = true
+	status.Triggers = len(el.Spec.Triggers)
+	if el.Status.Address != nil && el.Status.Address.URL != nil {
+		status.Address = el.Status.Address.URL.String()
+	}
+	// Replicas are informational, readiness is the eventlistener's own
+	if deployment, err := r.K8sClient.AppsV1().Deployments(r.Defaults.Namespace).Get(listenerServiceName(status.Name), metav1.GetOptions{}); err == nil {
+		status.ReadyReplicas = deployment.Status.ReadyReplicas
+		if deployment.Spec.Replicas != nil {
+			status.Replicas = *deployment.Spec.Replicas
+		}
+	}
+	if ready, reason := r.eventListenerReady(el); !ready {
+		status.Error = reason
+	}
+	return status
+}
+
+// eventListenerReady is whether the eventlistener can take deliveries, and if not why, by the Ready condition Triggers
+// sets on it once its deployment is available and it has an address. Eventlisteners of Triggers releases that don't
+// set the condition are ready when their deployment has a ready replica.
+func (r Resource) eventListenerReady(el *v1alpha1.EventListener) (bool, string) {
+	if condition := el.Status.GetCondition(apis.ConditionReady); condition != nil {
+		if condition.IsTrue() {
+			return true, ""
+		}
+		if condition.Message != "" {
+			return false, "eventlistener is not ready: " + condition.Message
+		}
+		return false, "eventlistener is not ready"
+	}
+	deployment, err := r.K8sClient.AppsV1().Deployments(el.Namespace).Get(listenerServiceName(el.Name), metav1.GetOptions{})
+	if err != nil {
+		return false, lookupError(err)
+	}
+	if deployment.Status.ReadyReplicas == 0 {
+		return false, "eventlistener has no ready replicas"
+	}
+	return true, ""
+}
+
+func lookupError(err error) string {
+	if k8serrors.IsNotFound(err) {
+		return "not found"
+	}
+	return err.Error()
+}
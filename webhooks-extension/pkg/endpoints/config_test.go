@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func selfSignedCertificate(t *testing.T, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mywebhooks.example.com"},
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	r := dummyResource()
+	os.Setenv("WEBHOOK_CALLBACK_URL", "https://mywebhooks.example.com")
+	defer os.Unsetenv("WEBHOOK_CALLBACK_URL")
+
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	expiry := time.Now().Add(90 * 24 * time.Hour).UTC().Truncate(time.Second)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: r.certSecretName(), Namespace: installNs},
+		Data:       map[string][]byte{"tls.crt": selfSignedCertificate(t, expiry)},
+	}
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: r.ingressName(), Namespace: installNs},
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{{Host: "mywebhooks.example.com"}},
+			TLS:   []v1beta1.IngressTLS{{Hosts: []string{"mywebhooks.example.com"}, SecretName: r.certSecretName()}},
+		},
+	}
+	interceptor := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: interceptorDeploymentName, Namespace: installNs},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "validate",
+			Env:  []corev1.EnvVar{{Name: "EVENT_BUS_TYPE", Value: "nats"}, {Name: "PROVENANCE_SIGNING_SECRET", Value: ""}},
+		}}}}},
+		Status: appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	listener := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: listenerServiceName(r.eventListenerName()), Namespace: installNs},
+	}
+	if _, err := r.K8sClient.CoreV1().Secrets(installNs).Create(secret); err != nil {
+		t.Fatalf("error creating secret: %s", err)
+	}
+	if _, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Create(ingress); err != nil {
+		t.Fatalf("error creating ingress: %s", err)
+	}
+	for _, deployment := range []*appsv1.Deployment{interceptor, listener} {
+		if _, err := r.K8sClient.AppsV1().Deployments(installNs).Create(deployment); err != nil {
+			t.Fatalf("error creating deployment: %s", err)
+		}
+	}
+
+	config := r.effectiveConfig()
+	if config.CallbackURL != "https://mywebhooks.example.com" {
+		t.Errorf("callback was %s", config.CallbackURL)
+	}
+	exposure := config.Exposure
+	if exposure.Mode != "ingress" || !exposure.Exists || !exposure.TLS || exposure.Host != "mywebhooks.example.com" ||
+		exposure.CertExpiry != expiry.Format(time.RFC3339) || exposure.Error != "" {
+		t.Errorf("unexpected exposure %+v", exposure)
+	}
+	if len(config.Credentials) != 1 || config.Credentials[0] != (credentialStatus{Name: "token1", Type: "token", Webhooks: 1}) {
+		t.Errorf("unexpected credentials %+v", config.Credentials)
+	}
+	if config.Interceptor != (interceptorStatus{ReadyReplicas: 1, EventBus: "nats"}) {
+		t.Errorf("unexpected interceptor %+v", config.Interceptor)
+	}
+	el := config.EventListener
+	if !el.Exists || el.Triggers != 3 || el.Webhooks != 1 || el.Error != "eventlistener has no ready replicas" {
+		t.Errorf("unexpected eventlistener %+v", el)
+	}
+	if config.Git.ProviderMode != "live" || config.Features["deliverybuffer"] {
+		t.Errorf("unexpected git %+v or features %+v", config.Git, config.Features)
+	}
+}
+
+func TestEffectiveConfigWithoutEventListener(t *testing.T) {
+	r := dummyResource()
+	config := r.effectiveConfig()
+	if config.Exposure.Exists || config.Exposure.Error != "not found" {
+		t.Errorf("unexpected exposure %+v", config.Exposure)
+	}
+	if config.EventListener.Exists || config.EventListener.Error != "not found" {
+		t.Errorf("unexpected eventlistener %+v", config.EventListener)
+	}
+	if config.Interceptor.Error != "not found" {
+		t.Errorf("unexpected interceptor %+v", config.Interceptor)
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	found, err := certificateExpiry(selfSignedCertificate(t, expiry))
+	if err != nil || !found.Equal(expiry) {
+		t.Errorf("expiry was %s, %v, expected %s", found, err, expiry)
+	}
+	if _, err := certificateExpiry([]byte("not a certificate")); err == nil {
+		t.Error("expected an error for data that isn't a certificate")
+	}
+}
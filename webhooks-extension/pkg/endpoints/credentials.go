@@ -22,14 +22,18 @@ import (
 	restful "github.com/emicklei/go-restful"
 	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
 	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// 'credentials' from the webhooks-extension's point of view, are access tokens. That's the only sort we handle right now.
+// 'credentials' from the webhooks-extension's point of view, are access tokens, or a username and
+// password for git servers that require basic authentication.
 type credential struct {
 	Name        string `json:"name"`
-	AccessToken string `json:"accesstoken"`
+	AccessToken string `json:"accesstoken,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
 	SecretToken string `json:"secrettoken,omitempty"`
 }
 
@@ -128,8 +132,15 @@ func (r Resource) credentialToSecret(cred credential, response *restful.Response
 	secret.Type = corev1.SecretTypeOpaque
 	secret.ObjectMeta.Namespace = r.Defaults.Namespace
 	secret.ObjectMeta.Name = cred.Name
+	secret.ObjectMeta.Labels = managedLabels()
 	secret.Data = make(map[string][]byte)
-	secret.Data["accessToken"] = []byte(cred.AccessToken)
+	if cred.AccessToken != "" {
+		secret.Data["accessToken"] = []byte(cred.AccessToken)
+	}
+	if cred.Username != "" {
+		secret.Data["username"] = []byte(cred.Username)
+		secret.Data["password"] = []byte(cred.Password)
+	}
 	if cred.SecretToken != "" {
 		secret.Data["secretToken"] = []byte(cred.SecretToken)
 	} else {
@@ -165,23 +176,55 @@ func getRandomSecretToken() []byte {
 // Convert K8s secret struct into credential struct
 func secretToCredential(secret *corev1.Secret, mask bool) credential {
 	var cred credential
-	if secret.Data["accessToken"] != nil {
+	if secret.Data["accessToken"] != nil || secret.Data["username"] != nil {
 		cred = credential{
 			Name:        secret.ObjectMeta.Name,
 			AccessToken: string(secret.Data["accessToken"]),
+			Username:    string(secret.Data["username"]),
+			Password:    string(secret.Data["password"]),
 			SecretToken: string(secret.Data["secretToken"]),
 		}
 		if mask {
-			cred.AccessToken = "********"
+			if cred.AccessToken != "" {
+				cred.AccessToken = "********"
+			}
+			if cred.Password != "" {
+				cred.Password = "********"
+			}
 			cred.SecretToken = "********"
 		}
 	}
 	return cred
 }
 
+// credentialParams are the binding params naming a webhook's basic authentication credential and its
+// keys, so that pipelines can clone with the same username and password used to register the webhook.
+// The secret named is the copy in the webhook's namespace, see basicauth.go.
+func (r Resource) credentialParams(webhook webhook) []v1alpha1.Param {
+	creds, err := utils.GetGitCredentials(r.K8sClient, r.Defaults.Namespace, webhook.AccessTokenRef)
+	if err != nil || creds.Username == "" {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{
+		{Name: "webhooks-tekton-git-secret", Value: webhook.AccessTokenRef},
+		{Name: "webhooks-tekton-git-secret-username-key", Value: "username"},
+		{Name: "webhooks-tekton-git-secret-password-key", Value: "password"},
+	}
+}
+
+// monitorSecretKey is the key of a webhook's credential the monitor authenticates with, the access
+// token, or the token the username and password were exchanged for if the credential only holds those
+func (r Resource) monitorSecretKey(webhook webhook) string {
+	creds, err := utils.GetGitCredentials(r.K8sClient, r.Defaults.Namespace, webhook.AccessTokenRef)
+	if err == nil && creds.AccessToken == "" && creds.Username != "" {
+		return monitorTokenKey
+	}
+	return "accessToken"
+}
+
 // Checks the Accept header and reads the content into the entityPointer.
 func getQueryEntity(entityPointer interface{}, request *restful.Request, response *restful.Response) (err error) {
-	if err := request.ReadEntity(entityPointer); err != nil {
+	if err := readEntity(request, entityPointer); err != nil {
 		errorMessage := "error parsing request body."
 		utils.RespondMessageAndLogError(response, err, errorMessage, http.StatusBadRequest)
 		return err
@@ -193,8 +236,10 @@ func (r Resource) verifyCredentialParameters(cred credential, response *restful.
 	errorMessage := ""
 	if cred.Name == "" {
 		errorMessage = fmt.Sprintf("error: Name must be specified")
-	} else if cred.AccessToken == "" {
-		errorMessage = fmt.Sprintf("error: AccessToken must be specified")
+	} else if cred.AccessToken == "" && cred.Username == "" {
+		errorMessage = fmt.Sprintf("error: AccessToken or Username and Password must be specified")
+	} else if (cred.Username == "") != (cred.Password == "") {
+		errorMessage = fmt.Sprintf("error: Username and Password must be specified together")
 	}
 	if errorMessage != "" {
 		utils.RespondErrorMessage(response, errorMessage, http.StatusBadRequest)
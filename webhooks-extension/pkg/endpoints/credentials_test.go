@@ -31,7 +31,7 @@ func TestCreateBadAccessToken(t *testing.T) {
 	badAccessToken := credential{
 		Name: "badToken",
 	}
-	expectedError := fmt.Sprintf("error: AccessToken must be specified")
+	expectedError := fmt.Sprintf("error: AccessToken or Username and Password must be specified")
 	createAndCheckCredential(badAccessToken, expectedError, r, t)
 
 	// Verify no credentials have been created
@@ -49,6 +49,33 @@ func TestAccessTokenWithSecret(t *testing.T) {
 	createAndCheckCredential(accessTokenWithSecret, "", r, t)
 }
 
+func TestBasicAuthCredential(t *testing.T) {
+	r := dummyResource()
+
+	basicAuth := credential{
+		Name:        "basic-auth",
+		Username:    "builder",
+		Password:    "apassword",
+		SecretToken: "thisIsMySecretToken",
+	}
+	createAndCheckCredential(basicAuth, "", r, t)
+
+	noPassword := credential{
+		Name:     "no-password",
+		Username: "builder",
+	}
+	createAndCheckCredential(noPassword, "error: Username and Password must be specified together", r, t)
+
+	hook := webhook{AccessTokenRef: "basic-auth"}
+	if key := r.monitorSecretKey(hook); key != monitorTokenKey {
+		t.Errorf("monitor secret key was %s, expected %s", key, monitorTokenKey)
+	}
+	params := r.credentialParams(hook)
+	if len(params) != 3 || params[0].Value != "basic-auth" || params[1].Value != "username" || params[2].Value != "password" {
+		t.Errorf("unexpected credential params %+v", params)
+	}
+}
+
 // Should be "default" which is r.dummyResource.namespace's value
 
 func TestAccessTokenWithNoNamespaceUsesDefault(t *testing.T) {
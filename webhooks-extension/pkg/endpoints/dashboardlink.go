@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+Pull request comments and commit statuses link each PipelineRun to the
+dashboard found by getDashboardURL, as <dashboard>/#/namespaces/<namespace>/
+pipelineruns/<name>. Installs with the dashboard behind a custom ingress
+path, or another log viewer, set DASHBOARD_LINK_TEMPLATE to the URL to link
+to instead, e.g.
+	https://ci.example.com/#/namespaces/{{.Namespace}}/pipelineruns/{{.Run}}
+where {{.Namespace}}, {{.Run}} and {{.Pipeline}} are replaced by those of
+the PipelineRun, {{.Run}} being empty for links to a namespace's runs. The
+monitor task is passed the template as its dashboardlinktemplate param and
+replaces the placeholders the same way.
+---------------------------------------*/
+
+// The placeholders a dashboard link template may contain
+var dashboardLinkPlaceholders = []string{"{{.Namespace}}", "{{.Run}}", "{{.Pipeline}}"}
+
+// setDashboardLinkDefaults sets the dashboard link template from the environment, ignoring one that isn't valid
+func setDashboardLinkDefaults(defaults *EnvDefaults) {
+	template := strings.TrimSpace(os.Getenv("DASHBOARD_LINK_TEMPLATE"))
+	if err := validateDashboardLinkTemplate(template); err != nil {
+		logging.Log.Errorf("ignoring DASHBOARD_LINK_TEMPLATE: %s", err)
+		return
+	}
+	defaults.DashboardLinkTemplate = template
+}
+
+func validateDashboardLinkTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	if !strings.HasPrefix(template, "http://") && !strings.HasPrefix(template, "https://") {
+		return fmt.Errorf("dashboard link template %s must start with http:// or https://", template)
+	}
+	rest := template
+	for _, placeholder := range dashboardLinkPlaceholders {
+		rest = strings.Replace(rest, placeholder, "", -1)
+	}
+	if strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return fmt.Errorf("dashboard link template %s may only contain the placeholders %s", template, strings.Join(dashboardLinkPlaceholders, ", "))
+	}
+	return nil
+}
+
+// pipelineRunLink returns the link to a PipelineRun, from the dashboard link template if one is set
+func (r Resource) pipelineRunLink(dashboardURL, namespace, run, pipeline string) string {
+	if r.Defaults.DashboardLinkTemplate == "" {
+		return strings.TrimSuffix(dashboardURL, "/") + "/#/namespaces/" + namespace + "/pipelineruns/" + run
+	}
+	return strings.NewReplacer("{{.Namespace}}", namespace, "{{.Run}}", run, "{{.Pipeline}}", pipeline).Replace(r.Defaults.DashboardLinkTemplate)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"os"
+	"testing"
+)
+
+func TestValidateDashboardLinkTemplate(t *testing.T) {
+	valid := []string{
+		"",
+		"https://ci.example.com/#/namespaces/{{.Namespace}}/pipelineruns/{{.Run}}",
+		"http://logs.example.com/{{.Namespace}}/{{.Pipeline}}/{{.Run}}",
+	}
+	for _, template := range valid {
+		if err := validateDashboardLinkTemplate(template); err != nil {
+			t.Errorf("unexpected error for %s: %s", template, err)
+		}
+	}
+	invalid := []string{
+		"ci.example.com/{{.Run}}",
+		"https://ci.example.com/{{.Commit}}",
+		"https://ci.example.com/{{ .Run }}",
+	}
+	for _, template := range invalid {
+		if err := validateDashboardLinkTemplate(template); err == nil {
+			t.Errorf("expected an error for %s", template)
+		}
+	}
+}
+
+func TestPipelineRunLink(t *testing.T) {
+	r := dummyResource()
+	if link := r.pipelineRunLink("http://dashboard:9097/", "ns", "run1", "pipeline"); link != "http://dashboard:9097/#/namespaces/ns/pipelineruns/run1" {
+		t.Errorf("unexpected default link %s", link)
+	}
+
+	os.Setenv("DASHBOARD_LINK_TEMPLATE", "https://ci.example.com/{{.Pipeline}}/#/namespaces/{{.Namespace}}/pipelineruns/{{.Run}}")
+	defer os.Unsetenv("DASHBOARD_LINK_TEMPLATE")
+	setDashboardLinkDefaults(&r.Defaults)
+	if link := r.pipelineRunLink("http://dashboard:9097/", "ns", "run1", "pipeline"); link != "https://ci.example.com/pipeline/#/namespaces/ns/pipelineruns/run1" {
+		t.Errorf("unexpected templated link %s", link)
+	}
+
+	os.Setenv("DASHBOARD_LINK_TEMPLATE", "https://ci.example.com/{{.Commit}}")
+	r.Defaults.DashboardLinkTemplate = ""
+	setDashboardLinkDefaults(&r.Defaults)
+	if r.Defaults.DashboardLinkTemplate != "" {
+		t.Errorf("expected an invalid template to be ignored, got %s", r.Defaults.DashboardLinkTemplate)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+/*--------------------------------------
+Events for a webhook with a dead letter URL that fail to run are posted to
+that URL rather than only being logged. The URL is set on the webhook's
+triggers as the Wext-Dead-Letter-Url header: the interceptor posts the
+events it fails on with an error (a 417, turning away an event meant for
+another trigger, is not a failure). The extension posts the webhook's
+PipelineRuns that were created but could not start, e.g. as the pipeline
+is missing or a param has the wrong type, checking every
+deadLetterCheckInterval. Templates the EventListener fails to render never
+reach either so are only in the EventListener's log.
+---------------------------------------*/
+
+const (
+	deadLetterHeader = "Wext-Dead-Letter-Url"
+	// Set on a PipelineRun once posted to the dead letter URL
+	deadLetteredAnnotation  = "webhooks.tekton.dev/deadLettered"
+	deadLetterCheckInterval = time.Minute
+	deadLetterWindow        = time.Hour
+	deadLetterTimeout       = 10 * time.Second
+)
+
+// startFailureReasons are the Succeeded reasons of PipelineRuns that failed before running any task
+var startFailureReasons = map[string]bool{
+	"CouldntGetPipeline":              true,
+	"CouldntGetTask":                  true,
+	"CouldntGetResource":              true,
+	"InvalidPipelineResourceBindings": true,
+	"InvalidWorkspaceBindings":        true,
+	"ParameterTypeMismatch":           true,
+	"ParameterMissing":                true,
+	"PipelineValidationFailed":        true,
+	"PipelineInvalidGraph":            true,
+}
+
+// pipelineRunDeadLetter is posted to a webhook's dead letter URL for a PipelineRun that couldn't start
+type pipelineRunDeadLetter struct {
+	Stage       string `json:"stage"`
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace"`
+	Repository  string `json:"repository"`
+	PipelineRun string `json:"pipelinerun"`
+	EventID     string `json:"eventid,omitempty"`
+	Reason      string `json:"reason"`
+	Error       string `json:"error"`
+	Time        string `json:"time"`
+}
+
+func validateDeadLetterURL(deadLetterURL string) error {
+	if deadLetterURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(deadLetterURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("deadletterurl %s must be an http or https URL", deadLetterURL)
+	}
+	return nil
+}
+
+// withDeadLetter adds the header with the webhook's dead letter URL to a trigger's interceptor
+func withDeadLetter(trigger v1alpha1.EventListenerTrigger, webhook webhook) v1alpha1.EventListenerTrigger {
+	if webhook.DeadLetterURL != "" {
+		trigger.Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header,
+			pipelinesv1alpha1.Param{Name: deadLetterHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.DeadLetterURL}})
+	}
+	return trigger
+}
+
+// ReportDeadLetters posts the PipelineRuns of webhooks that couldn't start until stopCh is closed
+func (r Resource) ReportDeadLetters(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(deadLetterCheckInterval)
+	defer ticker.Stop()
+	for {
+		for _, profiled := range r.allProfiles() {
+			profiled.reportDeadLetters(time.Now())
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reportDeadLetters posts the runs that failed to start within deadLetterWindow of now
+func (r Resource) reportDeadLetters(now time.Time) {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error getting webhooks to report dead letters for: %s", err)
+		return
+	}
+	for _, hook := range hooks {
+		if hook.DeadLetterURL == "" {
+			continue
+		}
+		pipelineRuns, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			logging.Log.Errorf("error listing PipelineRuns in namespace %s to report dead letters: %s", hook.Namespace, err)
+			continue
+		}
+		for i := range pipelineRuns.Items {
+			pipelineRun := &pipelineRuns.Items[i]
+			if !isWebhookPipelineRun(*pipelineRun, hook.GitRepositoryURL, hook.Pipeline) || !failedToStart(*pipelineRun, now) {
+				continue
+			}
+			if err := postPipelineRunDeadLetter(hook, *pipelineRun); err != nil {
+				logging.Log.Errorf("error posting dead letter for PipelineRun %s to %s: %s", pipelineRun.Name, hook.DeadLetterURL, err)
+				continue
+			}
+			if pipelineRun.Annotations == nil {
+				pipelineRun.Annotations = map[string]string{}
+			}
+			pipelineRun.Annotations[deadLetteredAnnotation] = "true"
+			if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).Update(pipelineRun); err != nil {
+				logging.Log.Errorf("error marking PipelineRun %s as dead lettered: %s", pipelineRun.Name, err)
+			}
+		}
+	}
+}
+
+func failedToStart(pipelineRun pipelinesv1alpha1.PipelineRun, now time.Time) bool {
+	if pipelineRun.Annotations[deadLetteredAnnotation] == "true" {
+		return false
+	}
+	condition := pipelineRun.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status != corev1.ConditionFalse || !startFailureReasons[condition.Reason] {
+		return false
+	}
+	return now.Sub(pipelineRun.CreationTimestamp.Time) <= deadLetterWindow
+}
+
+func postPipelineRunDeadLetter(hook webhook, pipelineRun pipelinesv1alpha1.PipelineRun) error {
+	condition := pipelineRun.Status.GetCondition(apis.ConditionSucceeded)
+	body, err := json.Marshal(pipelineRunDeadLetter{
+		Stage:       "pipelinerun",
+		Name:        hook.Name,
+		Namespace:   hook.Namespace,
+		Repository:  hook.GitRepositoryURL,
+		PipelineRun: pipelineRun.Name,
+		EventID:     pipelineRun.Labels["triggers.tekton.dev/triggers-eventid"],
+		Reason:      condition.Reason,
+		Error:       condition.Message,
+		Time:        time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: deadLetterTimeout}
+	resp, err := client.Post(hook.DeadLetterURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	logging.Log.Infof("posted dead letter for PipelineRun %s in namespace %s to %s", pipelineRun.Name, hook.Namespace, hook.DeadLetterURL)
+	return nil
+}
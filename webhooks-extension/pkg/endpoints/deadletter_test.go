@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+func TestValidateDeadLetterURL(t *testing.T) {
+	tests := map[string]bool{
+		"":                            true,
+		"https://hooks.example.com/x": true,
+		"http://10.0.0.1:8080":        true,
+		"hooks.example.com":           false,
+		"ftp://hooks.example.com":     false,
+		"https://":                    false,
+	}
+	for deadLetterURL, valid := range tests {
+		if err := validateDeadLetterURL(deadLetterURL); (err == nil) != valid {
+			t.Errorf("deadletterurl %q valid %t, got error %v", deadLetterURL, valid, err)
+		}
+	}
+}
+
+func deadLetterPipelineRun(name, reason string, created time.Time) pipelinesv1alpha1.PipelineRun {
+	pipelineRun := statsPipelineRun(name, corev1.ConditionFalse, 0, created)
+	pipelineRun.Namespace = installNs
+	pipelineRun.CreationTimestamp = metav1.Time{Time: created}
+	pipelineRun.Labels["triggers.tekton.dev/triggers-eventid"] = "event-" + name
+	pipelineRun.Status.SetCondition(&apis.Condition{
+		Type:    apis.ConditionSucceeded,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: name + " failed",
+	})
+	return pipelineRun
+}
+
+func TestReportDeadLetters(t *testing.T) {
+	letters := []pipelineRunDeadLetter{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		letter := pipelineRunDeadLetter{}
+		if err := json.NewDecoder(r.Body).Decode(&letter); err != nil {
+			t.Errorf("dead letter was not JSON: %s", err)
+		}
+		letters = append(letters, letter)
+	}))
+	defer server.Close()
+
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+		DeadLetterURL:    server.URL,
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	for _, trigger := range el.Spec.Triggers[:2] {
+		if triggerHeader(trigger, deadLetterHeader) != server.URL {
+			t.Errorf("trigger %s missing the dead letter header", trigger.Name)
+		}
+	}
+	if hooks, err := r.getWebhooksFromEventListener(); err != nil || len(hooks) != 1 || hooks[0].DeadLetterURL != server.URL {
+		t.Fatalf("deadletterurl not kept on the webhook, got %+v, %v", hooks, err)
+	}
+
+	now := time.Now()
+	runs := []pipelinesv1alpha1.PipelineRun{
+		deadLetterPipelineRun("unstarted", "ParameterMissing", now.Add(-time.Minute)),
+		deadLetterPipelineRun("failed", "Failed", now.Add(-time.Minute)),
+		deadLetterPipelineRun("old", "CouldntGetPipeline", now.Add(-2*deadLetterWindow)),
+	}
+	for _, run := range runs {
+		if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Create(&run); err != nil {
+			t.Fatalf("error creating pipelinerun: %s", err)
+		}
+	}
+
+	r.reportDeadLetters(now)
+	r.reportDeadLetters(now)
+
+	if len(letters) != 1 {
+		t.Fatalf("expected one dead letter, got %+v", letters)
+	}
+	letter := letters[0]
+	if letter.Stage != "pipelinerun" || letter.PipelineRun != "unstarted" || letter.Reason != "ParameterMissing" ||
+		letter.EventID != "event-unstarted" || letter.Name != "hook" || letter.Repository != hook.GitRepositoryURL {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+	run, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Get("unstarted", metav1.GetOptions{})
+	if err != nil || run.Annotations[deadLetteredAnnotation] != "true" {
+		t.Errorf("pipelinerun not marked as dead lettered: %+v, %v", run, err)
+	}
+}
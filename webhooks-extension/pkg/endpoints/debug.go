@@ -0,0 +1,252 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Diagnostics for slow requests and goroutine leaks, only for admins (see
+admin.go):
+
+	GET /webhooks/debug/state         the extension's in-memory state
+	GET /webhooks/debug/pprof/...     net/http/pprof, if PPROF_ENABLED is true
+
+The state holds the goroutine count, memory use, the extension's locks
+with who holds them, for how long and how many are waiting, the API
+requests in flight and how long they have been running, and the delivery
+buffer. Reading it takes none of the extension's locks, so it can be read
+while one is stuck. The locks are trackedMutexes, which record their
+holder, and TrackRequestsFilter records the requests in flight.
+---------------------------------------*/
+
+// trackedMutex is a mutex that records who holds it, for the debug state
+type trackedMutex struct {
+	sync.Mutex
+	name    string
+	waiting int32
+	// Guards holder and since
+	state  sync.Mutex
+	holder string
+	since  time.Time
+}
+
+type lockState struct {
+	Name        string     `json:"name"`
+	Held        bool       `json:"held"`
+	Holder      string     `json:"holder,omitempty"`
+	HeldSince   *time.Time `json:"heldsince,omitempty"`
+	HeldSeconds float64    `json:"heldseconds,omitempty"`
+	Waiting     int32      `json:"waiting"`
+}
+
+type inFlightRequest struct {
+	Method         string    `json:"method"`
+	Path           string    `json:"path"`
+	Started        time.Time `json:"started"`
+	RunningSeconds float64   `json:"runningseconds"`
+}
+
+type memoryState struct {
+	AllocBytes     uint64 `json:"allocbytes"`
+	HeapInuseBytes uint64 `json:"heapinusebytes"`
+	NumGC          uint32 `json:"numgc"`
+}
+
+type deliveryState struct {
+	Enabled  bool   `json:"enabled"`
+	Buffered int    `json:"buffered"`
+	Error    string `json:"error,omitempty"`
+}
+
+type debugState struct {
+	Goroutines    int               `json:"goroutines"`
+	Memory        memoryState       `json:"memory"`
+	Locks         []lockState       `json:"locks"`
+	Requests      []inFlightRequest `json:"requests"`
+	Deliveries    deliveryState     `json:"deliveries"`
+	ProviderMode  string            `json:"providermode,omitempty"`
+	HandlerPanics uint64            `json:"handlerpanics"`
+	Pprof         bool              `json:"pprof"`
+}
+
+// The locks listed in the debug state
+var trackedLocks = []*trackedMutex{&modifyingEventListenerLock, &deliveryBufferLock, &recordingsLock, &historyLock}
+
+var (
+	// Guards inFlightRequests
+	inFlightLock     sync.Mutex
+	inFlightRequests = map[uint64]inFlightRequest{}
+	nextRequestID    uint64
+)
+
+// Lock locks the mutex, recording the function that called Lock as its holder
+func (m *trackedMutex) Lock() {
+	atomic.AddInt32(&m.waiting, 1)
+	m.Mutex.Lock()
+	atomic.AddInt32(&m.waiting, -1)
+	holder := "unknown"
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		holder = runtime.FuncForPC(pc).Name()
+	}
+	m.state.Lock()
+	m.holder = holder
+	m.since = time.Now()
+	m.state.Unlock()
+}
+
+// Unlock unlocks the mutex
+func (m *trackedMutex) Unlock() {
+	m.state.Lock()
+	m.holder = ""
+	m.state.Unlock()
+	m.Mutex.Unlock()
+}
+
+func (m *trackedMutex) lockState() lockState {
+	m.state.Lock()
+	defer m.state.Unlock()
+	state := lockState{Name: m.name, Waiting: atomic.LoadInt32(&m.waiting)}
+	if m.holder != "" {
+		since := m.since
+		state.Held = true
+		state.Holder = m.holder
+		state.HeldSince = &since
+		state.HeldSeconds = time.Since(since).Seconds()
+	}
+	return state
+}
+
+// TrackRequestsFilter records the requests in flight for the debug state
+func TrackRequestsFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	id := atomic.AddUint64(&nextRequestID, 1)
+	inFlightLock.Lock()
+	inFlightRequests[id] = inFlightRequest{Method: request.Request.Method, Path: request.Request.URL.Path, Started: time.Now()}
+	inFlightLock.Unlock()
+	defer func() {
+		inFlightLock.Lock()
+		delete(inFlightRequests, id)
+		inFlightLock.Unlock()
+	}()
+	chain.ProcessFilter(request, response)
+}
+
+func pprofEnabled() bool {
+	return strings.ToLower(os.Getenv("PPROF_ENABLED")) == "true"
+}
+
+// GET /webhooks/debug/state
+func (r Resource) getDebugState(request *restful.Request, response *restful.Response) {
+	if status, err := r.authorizeAdmin(request); err != nil {
+		logging.Log.Error(err)
+		RespondError(response, err, status)
+		return
+	}
+	response.WriteEntity(r.debugState())
+}
+
+func (r Resource) debugState() debugState {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	state := debugState{
+		Goroutines: runtime.NumGoroutine(),
+		Memory: memoryState{
+			AllocBytes:     memory.Alloc,
+			HeapInuseBytes: memory.HeapInuse,
+			NumGC:          memory.NumGC,
+		},
+		Locks:         []lockState{},
+		Requests:      []inFlightRequest{},
+		Deliveries:    r.deliveryState(),
+		ProviderMode:  getProviderMode(),
+		HandlerPanics: atomic.LoadUint64(&handlerPanics),
+		Pprof:         pprofEnabled(),
+	}
+	for _, lock := range trackedLocks {
+		state.Locks = append(state.Locks, lock.lockState())
+	}
+
+	inFlightLock.Lock()
+	for _, inFlight := range inFlightRequests {
+		inFlight.RunningSeconds = time.Since(inFlight.Started).Seconds()
+		state.Requests = append(state.Requests, inFlight)
+	}
+	inFlightLock.Unlock()
+	sort.Slice(state.Requests, func(i, j int) bool { return state.Requests[i].Started.Before(state.Requests[j].Started) })
+	return state
+}
+
+// deliveryState counts the buffered deliveries without taking deliveryBufferLock, so the debug state
+// can be read while a delivery is stuck
+func (r Resource) deliveryState() deliveryState {
+	state := deliveryState{Enabled: r.Defaults.DeliveryBuffer}
+	if !state.Enabled {
+		return state
+	}
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(deliveryBufferConfigMap, metav1.GetOptions{})
+	if err != nil {
+		state.Error = lookupError(err)
+		return state
+	}
+	state.Buffered = len(cm.Data)
+	return state
+}
+
+// RegisterProfilingHandlers serves net/http/pprof at /webhooks/debug/pprof/ to admins if PPROF_ENABLED is true
+func (r Resource) RegisterProfilingHandlers(container *restful.Container) {
+	if !pprofEnabled() {
+		return
+	}
+	logging.Log.Warn("PPROF_ENABLED is true, serving profiles to admins at /webhooks/debug/pprof/")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	container.Handle("/webhooks/debug/pprof/", r.adminOnly(http.StripPrefix("/webhooks", mux)))
+}
+
+// adminOnly serves handler to admins only, for handlers outside the restful web services. The container's
+// filters don't run for them, so signed requests and session tokens are verified here as the filters do.
+func (r Resource) adminOnly(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		request := restful.NewRequest(req)
+		for _, accept := range []func(*restful.Request) error{r.acceptSignature, r.acceptSessionToken} {
+			if err := accept(request); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		if status, err := r.authorizeAdmin(request); err != nil {
+			logging.Log.Error(err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
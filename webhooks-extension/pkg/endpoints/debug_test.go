@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func getDebugState(r *Resource, token string) (int, debugState) {
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/debug/state", nil)
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	httpWriter := httptest.NewRecorder()
+	r.getDebugState(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	state := debugState{}
+	json.NewDecoder(httpWriter.Body).Decode(&state)
+	return httpWriter.Code, state
+}
+
+func TestGetDebugState(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+
+	if status, _ := getDebugState(r, "user"); status != http.StatusForbidden {
+		t.Errorf("expected a user to be refused the debug state, got %d", status)
+	}
+
+	modifyingEventListenerLock.Lock()
+	status, state := getDebugState(r, "admin")
+	modifyingEventListenerLock.Unlock()
+	if status != http.StatusOK || state.Goroutines == 0 || len(state.Locks) != len(trackedLocks) {
+		t.Fatalf("unexpected debug state %d, %+v", status, state)
+	}
+	held := state.Locks[0]
+	if held.Name != "eventlistener" || !held.Held || !strings.HasSuffix(held.Holder, "TestGetDebugState") || held.HeldSince == nil {
+		t.Errorf("expected the eventlistener lock to be held by the test, got %+v", held)
+	}
+	if state.Locks[1].Held {
+		t.Errorf("expected the delivery buffer lock to be free, got %+v", state.Locks[1])
+	}
+	if _, state = getDebugState(r, "admin"); state.Locks[0].Held {
+		t.Errorf("expected the eventlistener lock to be free once unlocked, got %+v", state.Locks[0])
+	}
+}
+
+func TestTrackRequestsFilter(t *testing.T) {
+	r := dummyResource()
+	container := restful.NewContainer()
+	container.Filter(TrackRequestsFilter)
+	ws := new(restful.WebService)
+	ws.Path("/webhooks")
+	var inFlight []inFlightRequest
+	ws.Route(ws.POST("/").To(func(request *restful.Request, response *restful.Response) {
+		inFlight = r.debugState().Requests
+		response.WriteHeader(http.StatusCreated)
+	}))
+	container.Add(ws)
+
+	container.ServeHTTP(httptest.NewRecorder(), dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/", nil))
+	if len(inFlight) != 1 || inFlight[0].Method != "POST" || inFlight[0].Path != "/webhooks/" {
+		t.Errorf("expected the request to be in flight while handled, got %+v", inFlight)
+	}
+	if requests := r.debugState().Requests; len(requests) != 0 {
+		t.Errorf("expected no requests in flight once handled, got %+v", requests)
+	}
+}
+
+func TestRegisterProfilingHandlers(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+	os.Setenv("PPROF_ENABLED", "true")
+	defer os.Unsetenv("PPROF_ENABLED")
+	container := restful.NewContainer()
+	r.RegisterProfilingHandlers(container)
+
+	for token, expected := range map[string]int{"": http.StatusUnauthorized, "user": http.StatusForbidden, "admin": http.StatusOK} {
+		httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/debug/pprof/goroutine?debug=1", nil)
+		if token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		if httpWriter.Code != expected {
+			t.Errorf("profile for %q returned %d, expected %d", token, httpWriter.Code, expected)
+		}
+	}
+	// The container's filters don't run for the profiles, session tokens and signed requests are checked for them
+	_, session := exchangeToken(r, "admin", `{"scopes":["admin"]}`)
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/debug/pprof/goroutine?debug=1", nil)
+	httpReq.Header.Set("Authorization", "Bearer "+session.Token)
+	httpWriter := httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusOK {
+		t.Errorf("profile for an admin session token returned %d, expected 200", httpWriter.Code)
+	}
+
+	r.K8sClient.CoreV1().Secrets(installNs).Create(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: apiKeysSecret, Namespace: installNs},
+		Data:       map[string][]byte{"ops": []byte("s3cret"), "ops.scopes": []byte(`{"admin": true}`)},
+	})
+	for secret, expected := range map[string]int{"s3cret": http.StatusOK, "guess": http.StatusUnauthorized} {
+		httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/debug/pprof/goroutine?debug=1", nil)
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		httpReq.Header.Set(keyIDHeader, "ops")
+		httpReq.Header.Set(timestampHeader, timestamp)
+		httpReq.Header.Set(signatureHeader, signRequest([]byte(secret), timestamp, "GET", "/webhooks/debug/pprof/goroutine?debug=1", nil))
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		if httpWriter.Code != expected {
+			t.Errorf("profile for a request signed with %q returned %d, expected %d", secret, httpWriter.Code, expected)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/defaultbranch/refresh").To(r.refreshDefaultBranchRequest))
+A webhook's defaultbranch is its repository's default branch, looked up
+with the provider's API when the webhook is created unless it's given. It
+is kept as a binding param and set on all of the webhook's triggers as the
+Wext-Default-Branch header, and used for the webhook's mainbranchpipeline,
+see mainbranch.go, and as the ref of simulated pushes that don't have one.
+The interceptor asks for a refresh at DEFAULT_BRANCH_REFRESH_URL when an
+event shows a different default branch: GitHub's repository event for the
+branch being changed, or any push or pull request naming the repository's
+default branch. The refresh looks the branch up again for all of the
+repository's webhooks rather than trusting the event.
+---------------------------------------*/
+
+const (
+	defaultBranchHeader = "Wext-Default-Branch"
+	defaultBranchParam  = "webhooks-tekton-default-branch"
+)
+
+// This is deliberately written as a function such that unittests can override
+// how the default branch of a webhook's repository is found
+var defaultBranchOf = func(r Resource, hook webhook) (string, error) {
+	_, org, repo, err := r.getGitValues(hook.GitRepositoryURL)
+	if err != nil {
+		return "", err
+	}
+	provider, err := r.createGitProviderForWebhook(hook, org, repo)
+	if err != nil {
+		return "", err
+	}
+	return provider.DefaultBranch()
+}
+
+// defaultBranchParams is the binding param recording the webhook's default branch
+func defaultBranchParams(webhook webhook) []v1alpha1.Param {
+	if webhook.DefaultBranch == "" {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: defaultBranchParam, Value: webhook.DefaultBranch}}
+}
+
+// withDefaultBranch adds the header telling the interceptor the webhook's default branch to one of its triggers
+func withDefaultBranch(trigger v1alpha1.EventListenerTrigger, webhook webhook) v1alpha1.EventListenerTrigger {
+	if webhook.DefaultBranch == "" {
+		return trigger
+	}
+	trigger.Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header,
+		pipelinesv1alpha1.Param{Name: defaultBranchHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.DefaultBranch}})
+	return trigger
+}
+
+// triggerDefaultBranch is the default branch of the webhook a trigger belongs to, if it's known
+func triggerDefaultBranch(trigger v1alpha1.EventListenerTrigger) string {
+	for _, header := range trigger.Interceptors[0].Webhook.Header {
+		if header.Name == defaultBranchHeader {
+			return header.Value.StringVal
+		}
+	}
+	return ""
+}
+
+// withDefaultRef returns a simulated push payload with the branch as its ref if it doesn't have one
+func withDefaultRef(header http.Header, payload []byte, branch string) []byte {
+	if branch == "" || (header.Get("X-Github-Event") != "push" && header.Get("X-Gitlab-Event") != "Push Hook") {
+		return payload
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return payload
+	}
+	if _, found := fields["ref"]; found {
+		return payload
+	}
+	fields["ref"], _ = json.Marshal("refs/heads/" + branch)
+	withRef, err := json.Marshal(fields)
+	if err != nil {
+		return payload
+	}
+	return withRef
+}
+
+// refreshDefaultBranch looks up the default branch of the repository again, updating the triggers and bindings
+// of its webhooks whose default branch differs, and returns the webhooks updated. The caller holds
+// modifyingEventListenerLock.
+func (r Resource) refreshDefaultBranch(repoURL string) ([]webhook, int, error) {
+	hooks, err := r.getHooksForRepo(repoURL)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if len(hooks) == 0 {
+		return nil, http.StatusNotFound, fmt.Errorf("no webhooks found for repository %s", repoURL)
+	}
+	branch, err := defaultBranchOf(r, hooks[0])
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error finding the default branch of %s: %s", repoURL, err)
+	}
+	if branch == "" {
+		return nil, http.StatusInternalServerError, fmt.Errorf("the provider gave no default branch for %s", repoURL)
+	}
+
+	installNs := r.Defaults.Namespace
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	branchHeader := pipelinesv1alpha1.Param{Name: defaultBranchHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: branch}}
+	updated := []webhook{}
+	bindings := []string{}
+	for _, hook := range hooks {
+		if hook.DefaultBranch == branch {
+			continue
+		}
+		names := map[string]bool{}
+		for _, name := range webhookTriggerNames(triggerPrefix(hook)) {
+			names[name] = true
+		}
+		for i, trigger := range el.Spec.Triggers {
+			if !names[trigger.Name] {
+				continue
+			}
+			refreshed := withoutHeaders(trigger, defaultBranchHeader)
+			for j, header := range refreshed.Interceptors[0].Webhook.Header {
+				if header.Name == mainBranchHeader {
+					refreshed.Interceptors[0].Webhook.Header[j].Value.StringVal = branch
+				}
+			}
+			refreshed.Interceptors[0].Webhook.Header = append(refreshed.Interceptors[0].Webhook.Header, branchHeader)
+			el.Spec.Triggers[i] = refreshed
+			if trigger.Name == triggerPrefix(hook)+"-push-event" && len(trigger.Bindings) > 1 {
+				bindings = append(bindings, trigger.Bindings[1].Ref)
+			}
+		}
+		hook.DefaultBranch = branch
+		updated = append(updated, hook)
+	}
+	if len(updated) == 0 {
+		return updated, http.StatusOK, nil
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Update(el); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error updating eventlistener: %s", err)
+	}
+	for _, binding := range bindings {
+		if err := r.setBindingParam(binding, defaultBranchParam, branch); err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("error setting the default branch on triggerbinding %s: %s", binding, err)
+		}
+	}
+	logging.Log.Infof("default branch of %s refreshed to %s for %d webhooks", repoURL, branch, len(updated))
+	return updated, http.StatusOK, nil
+}
+
+// POST /webhooks/defaultbranch/refresh
+func (r Resource) refreshDefaultBranchRequest(request *restful.Request, response *restful.Response) {
+	body := struct {
+		GitRepositoryURL string `json:"gitrepositoryurl"`
+	}{}
+	if err := readEntity(request, &body); err != nil {
+		logging.Log.Errorf("error trying to read request entity as a default branch refresh: %s.", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	if body.GitRepositoryURL == "" {
+		err := errors.New("bad request information provided, gitrepositoryurl must be specified")
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+	updated, status, err := r.refreshDefaultBranch(body.GitRepositoryURL)
+	if err != nil {
+		logging.Log.Errorf("error refreshing the default branch of %s: %s", body.GitRepositoryURL, err)
+		RespondError(response, err, status)
+		return
+	}
+	response.WriteEntity(updated)
+}
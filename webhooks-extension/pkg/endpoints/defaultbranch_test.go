@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRefreshDefaultBranch(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		MainPipeline:     "pipeline2",
+		DefaultBranch:    "master",
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	original := defaultBranchOf
+	defer func() { defaultBranchOf = original }()
+	defaultBranchOf = func(r Resource, hook webhook) (string, error) { return "master", nil }
+	if updated, _, err := r.refreshDefaultBranch("https://github.com/owner/repo.git"); err != nil || len(updated) != 0 {
+		t.Errorf("expected no webhooks to change, got %+v, %v", updated, err)
+	}
+
+	defaultBranchOf = func(r Resource, hook webhook) (string, error) { return "main", nil }
+	updated, _, err := r.refreshDefaultBranch("https://github.com/owner/repo")
+	if err != nil || len(updated) != 1 || updated[0].DefaultBranch != "main" {
+		t.Fatalf("expected the webhook's default branch to change to main, got %+v, %v", updated, err)
+	}
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting eventlistener: %s", err)
+	}
+	for _, trigger := range el.Spec.Triggers {
+		if triggerHeader(trigger, defaultBranchHeader) == "" {
+			continue
+		}
+		if triggerHeader(trigger, defaultBranchHeader) != "main" {
+			t.Errorf("trigger %s default branch was %s", trigger.Name, triggerHeader(trigger, defaultBranchHeader))
+		}
+		if branch := triggerHeader(trigger, mainBranchHeader); branch != "" && branch != "main" {
+			t.Errorf("trigger %s main branch was %s", trigger.Name, branch)
+		}
+	}
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 || hooks[0].DefaultBranch != "main" {
+		t.Errorf("expected the webhook's default branch to be main, got %+v, %v", hooks, err)
+	}
+
+	if _, status, err := r.refreshDefaultBranch("https://github.com/owner/other"); err == nil || status != http.StatusNotFound {
+		t.Errorf("expected a 404 for a repository without webhooks, got %d, %v", status, err)
+	}
+}
+
+func TestWithDefaultRef(t *testing.T) {
+	push := http.Header{"X-Github-Event": []string{"push"}}
+	tests := []struct {
+		name     string
+		header   http.Header
+		payload  string
+		expected string
+	}{
+		{"push without a ref", push, `{}`, `{"ref":"refs/heads/main"}`},
+		{"push with a ref", push, `{"ref":"refs/heads/feature"}`, `{"ref":"refs/heads/feature"}`},
+		{"gitlab push", http.Header{"X-Gitlab-Event": []string{"Push Hook"}}, `{}`, `{"ref":"refs/heads/main"}`},
+		{"pull request", http.Header{"X-Github-Event": []string{"pull_request"}}, `{}`, `{}`},
+	}
+	for _, tt := range tests {
+		if payload := string(withDefaultRef(tt.header, []byte(tt.payload), "main")); payload != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, payload)
+		}
+	}
+}
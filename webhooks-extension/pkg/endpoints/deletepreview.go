@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"sort"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/{name}/delete-preview").To(r.profiled(Resource.previewDelete)))
+Lists what DELETE /webhooks/{name} would remove, removing nothing: the
+webhook's triggers, and the monitor's when it is the last webhook on its
+repository, the triggerbindings and triggertemplates deleted with them,
+whether the provider's webhook and the eventlistener go and how many
+PipelineRuns deletepipelineruns=true would delete. The triggers, bindings
+and templates are worked out by planEventListenerDeletion, which the
+delete itself follows.
+---------------------------------------*/
+
+type deletePreview struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Repository string `json:"repository"`
+	// Whether the delete needs force=true from an admin, see protection.go
+	Protected              bool     `json:"protected"`
+	Triggers               []string `json:"triggers"`
+	TriggerBindings        []string `json:"triggerbindings"`
+	TriggerTemplates       []string `json:"triggertemplates"`
+	RemovesMonitor         bool     `json:"removesmonitor"`
+	RemovesProviderWebhook bool     `json:"removesproviderwebhook"`
+	RemovesEventListener   bool     `json:"removeseventlistener"`
+	// The PipelineRuns deletepipelineruns=true deletes
+	PipelineRuns int `json:"pipelineruns"`
+}
+
+// GET /webhooks/{name}/delete-preview?namespace=x
+func (r Resource) previewDelete(request *restful.Request, response *restful.Response) {
+	name, namespace, ok := webhookRef(request, response)
+	if !ok {
+		return
+	}
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error trying to get webhooks: %s.", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	for _, hook := range hooks {
+		if hook.Name == name && hook.Namespace == namespace {
+			preview, err := r.deletePreviewOf(hook, hooks)
+			if err != nil {
+				logging.Log.Errorf("error previewing the deletion of webhook %s in namespace %s: %s", name, namespace, err)
+				RespondError(response, err, http.StatusInternalServerError)
+				return
+			}
+			response.WriteEntity(preview)
+			return
+		}
+	}
+	RespondError(response, newMessageError("WEBHOOK_NOT_FOUND", map[string]string{"name": name, "namespace": namespace}), http.StatusNotFound)
+}
+
+// deletePreviewOf works out what deleting hook, one of hooks, removes
+func (r Resource) deletePreviewOf(hook webhook, hooks []webhook) (deletePreview, error) {
+	_, gitOwner, gitRepo, err := r.getGitValues(hook.GitRepositoryURL)
+	if err != nil {
+		return deletePreview{}, err
+	}
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(r.Defaults.Namespace).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		return deletePreview{}, err
+	}
+	deletion, err := r.planEventListenerDeletion(el, triggerPrefix(hook), monitorTriggerPrefix(gitOwner, gitRepo), hook)
+	if err != nil {
+		return deletePreview{}, err
+	}
+	pipelineRuns, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return deletePreview{}, err
+	}
+
+	preview := deletePreview{
+		Name:                 hook.Name,
+		Namespace:            hook.Namespace,
+		Repository:           hook.GitRepositoryURL,
+		Protected:            hook.Protected,
+		Triggers:             deletion.triggers,
+		TriggerBindings:      []string{},
+		TriggerTemplates:     []string{},
+		RemovesMonitor:       deletion.monitorRemoved,
+		RemovesEventListener: len(deletion.remaining) == 0,
+		// As in removeHook, the provider's webhook goes with the last webhook on the repository
+		RemovesProviderWebhook: len(webhooksOnRepo(hooks, hook.GitRepositoryURL)) == 1,
+	}
+	if preview.Triggers == nil {
+		preview.Triggers = []string{}
+	}
+	for binding := range deletion.bindings {
+		if binding != "" {
+			preview.TriggerBindings = append(preview.TriggerBindings, binding)
+		}
+	}
+	for template := range deletion.templates {
+		preview.TriggerTemplates = append(preview.TriggerTemplates, template)
+	}
+	sort.Strings(preview.Triggers)
+	sort.Strings(preview.TriggerBindings)
+	sort.Strings(preview.TriggerTemplates)
+	for _, pipelineRun := range pipelineRuns.Items {
+		if isWebhookPipelineRun(pipelineRun, hook.GitRepositoryURL, hook.Pipeline) {
+			preview.PipelineRuns++
+		}
+	}
+	return preview, nil
+}
+
+// webhooksOnRepo returns the webhooks of hooks on repo
+func webhooksOnRepo(hooks []webhook, repo string) []webhook {
+	onRepo := []webhook{}
+	for _, hook := range hooks {
+		if sameRepo(hook.GitRepositoryURL, repo) {
+			onRepo = append(onRepo, hook)
+		}
+	}
+	return onRepo
+}
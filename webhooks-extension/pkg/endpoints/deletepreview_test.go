@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func getDeletePreview(r *Resource, name, namespace string) (int, deletePreview) {
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/"+name+"/delete-preview?namespace="+namespace, nil)
+	httpWriter := httptest.NewRecorder()
+	r.previewDelete(dummyRestfulRequest(httpReq, name), dummyRestfulResponse(httpWriter))
+	preview := deletePreview{}
+	json.NewDecoder(httpWriter.Body).Decode(&preview)
+	return httpWriter.Code, preview
+}
+
+func TestPreviewDelete(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	other := webhook{Name: "other", Namespace: installNs, GitRepositoryURL: hook.GitRepositoryURL, AccessTokenRef: "token1", Pipeline: "pipeline2"}
+	createTriggerResources(hook, r)
+	createTriggerResources(other, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	run := pipelinesv1alpha1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: installNs, Labels: map[string]string{
+			"webhooks.tekton.dev/gitServer": "github.com", "webhooks.tekton.dev/gitOrg": "owner", "webhooks.tekton.dev/gitRepo": "repo"}},
+		Spec: pipelinesv1alpha1.PipelineRunSpec{PipelineRef: &pipelinesv1alpha1.PipelineRef{Name: "pipeline1"}},
+	}
+	if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Create(&run); err != nil {
+		t.Fatalf("error creating PipelineRun: %s", err)
+	}
+
+	// The last webhook takes everything with it
+	status, preview := getDeletePreview(r, "hook", installNs)
+	if status != http.StatusOK || !preview.RemovesMonitor || !preview.RemovesProviderWebhook || !preview.RemovesEventListener || preview.PipelineRuns != 1 {
+		t.Fatalf("unexpected preview of deleting the only webhook %d, %+v", status, preview)
+	}
+
+	if _, err := r.updateEventListener(el, other, "owner.repo-"); err != nil {
+		t.Fatalf("error adding webhook: %s", err)
+	}
+	status, preview = getDeletePreview(r, "hook", installNs)
+	if status != http.StatusOK || preview.RemovesMonitor || preview.RemovesProviderWebhook || preview.RemovesEventListener || len(preview.Triggers) == 0 {
+		t.Fatalf("unexpected preview of deleting one of two webhooks %d, %+v", status, preview)
+	}
+	for _, trigger := range preview.Triggers {
+		if trigger != "hook-"+installNs+"-push-event" && trigger != "hook-"+installNs+"-pullrequest-event" {
+			t.Errorf("unexpected trigger %s in preview", trigger)
+		}
+	}
+	if hooks, err := r.getWebhooksFromEventListener(); err != nil || len(hooks) != 2 {
+		t.Fatalf("expected the preview to leave both webhooks, got %+v, %v", hooks, err)
+	}
+
+	// The delete removes the bindings the preview listed
+	if status, result := batchDelete(r, "pipeline=pipeline1", "admin"); status != http.StatusOK || len(result.Results) != 1 || !result.Results[0].Deleted {
+		t.Fatalf("unexpected deletion %d, %+v", status, result)
+	}
+	for _, binding := range preview.TriggerBindings {
+		if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(binding, metav1.GetOptions{}); err == nil {
+			t.Errorf("expected binding %s to be deleted as previewed", binding)
+		}
+	}
+
+	if status, _ := getDeletePreview(r, "hook", installNs); status != http.StatusNotFound {
+		t.Errorf("expected a deleted webhook's preview to be not found, got %d", status)
+	}
+}
@@ -0,0 +1,333 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Optional delivery buffering, enabled with DELIVERY_BUFFERING_ENABLED=true.
+The eventlistener ingress/route is pointed at the extension's deliveries port,
+deliveries are stored in a configmap and forwarded to the eventlistener with
+retries so that short eventlistener outages (e.g. upgrades) lose nothing.
+---------------------------------------*/
+
+const (
+	// Service and port name deliveries are received on when buffering
+	extensionServiceName = "webhooks-extension"
+	deliveriesPortName   = "deliveries"
+	deliveriesPort       = 8081
+	// Configmap in the install namespace holding undelivered deliveries
+	deliveryBufferConfigMap = "webhooks-extension-delivery-buffer"
+	// Configmaps are limited to 1MiB so only a handful of deliveries are held
+	maxBufferedDeliveries = 50
+	// How long a delivery is retried before being dropped
+	deliveryRetention = 15 * time.Minute
+	// Longest wait between forwarding attempts
+	maxDeliveryBackoff = 1 * time.Minute
+)
+
+// bufferedDelivery is a provider delivery waiting to be forwarded to the eventlistener
+type bufferedDelivery struct {
+	ID          string      `json:"id"`
+	Received    time.Time   `json:"received"`
+	Attempts    int         `json:"attempts"`
+	NextAttempt time.Time   `json:"nextattempt"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+var (
+	// Guards the buffer configmap and deliveryForwardService
+	deliveryBufferLock = trackedMutex{name: "deliverybuffer"}
+	// Eventlistener service deliveries are forwarded to when not the main one, switched during upgrades
+	deliveryForwardService = ""
+	// Wakes the forwarder when a delivery arrives
+	deliveryWakeup = make(chan struct{}, 1)
+	// Characters not allowed in a configmap key
+	deliveryIDSanitizer = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+	deliveryClient      = &http.Client{Timeout: 30 * time.Second}
+)
+
+// DeliveryBufferHandler returns the handler receiving provider deliveries when buffering is enabled
+func (r Resource) DeliveryBufferHandler() http.Handler {
+	return http.HandlerFunc(r.receiveDelivery)
+}
+
+// receiveDelivery stores a provider delivery and accepts it, forwarding happens in the background.
+// If the delivery can't be stored it is forwarded straight away and the eventlistener's answer relayed.
+func (r Resource) receiveDelivery(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit := getByteLimit("MAX_PAYLOAD_BYTES", defaultMaxPayloadBytes)
+	if req.ContentLength > limit {
+		logging.Log.Errorf("refusing a delivery of %d bytes, larger than the limit of %d bytes", req.ContentLength, limit)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	body, err := readLimited(req.Body, limit)
+	if err != nil {
+		logging.Log.Errorf("error reading delivery body: %s", err)
+		if _, tooLarge := err.(bodyTooLargeError); tooLarge {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	delivery := bufferedDelivery{
+		ID:          deliveryID(req.Header),
+		Received:    time.Now(),
+		NextAttempt: time.Now(),
+		Header:      req.Header,
+		Body:        body,
+	}
+	recordDeliveryReceived(delivery.Received)
+	if err := r.storeDelivery(delivery); err != nil {
+		logging.Log.Warnf("unable to buffer delivery %s, forwarding directly: %s", delivery.ID, err)
+		status, err := forwardDelivery(r.Defaults.Namespace, r.getDeliveryForwardService(), delivery)
+		if err != nil {
+			logging.Log.Errorf("error forwarding delivery %s: %s", delivery.ID, err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(status)
+		return
+	}
+
+	logging.Log.Debugf("buffered delivery %s", delivery.ID)
+	select {
+	case deliveryWakeup <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ForwardBufferedDeliveries forwards stored deliveries to the eventlistener until stopCh is closed.
+// Anything left over from a previous run is picked up on the first pass.
+func (r Resource) ForwardBufferedDeliveries(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		r.forwardDueDeliveries()
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		case <-deliveryWakeup:
+		}
+	}
+}
+
+// forwardDueDeliveries makes one forwarding attempt for each delivery whose retry time has come
+func (r Resource) forwardDueDeliveries() {
+	installNs := r.Defaults.Namespace
+
+	deliveryBufferLock.Lock()
+	deliveries, _, err := r.loadDeliveryBuffer()
+	deliveryBufferLock.Unlock()
+	service := r.getDeliveryForwardService()
+	if err != nil {
+		logging.Log.Errorf("error reading delivery buffer: %s", err)
+		return
+	}
+
+	now := time.Now()
+	done := make(map[string]bool)
+	retry := make(map[string]bufferedDelivery)
+	for id, delivery := range deliveries {
+		if delivery.NextAttempt.After(now) {
+			continue
+		}
+		status, err := forwardDelivery(installNs, service, delivery)
+		// Anything other than a server error is the eventlistener's final answer
+		if err == nil && status < http.StatusInternalServerError {
+			logging.Log.Debugf("forwarded delivery %s after %d attempt(s), status %d", id, delivery.Attempts+1, status)
+			done[id] = true
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("eventlistener returned status %d", status)
+		}
+		delivery.Attempts = delivery.Attempts + 1
+		if now.Sub(delivery.Received) > deliveryRetention {
+			logging.Log.Errorf("dropping delivery %s after %d attempts over %s: %s", id, delivery.Attempts, deliveryRetention, err)
+			done[id] = true
+			continue
+		}
+		logging.Log.Infof("delivery %s not forwarded (attempt %d), will retry: %s", id, delivery.Attempts, err)
+		delivery.NextAttempt = now.Add(deliveryBackoff(delivery.Attempts))
+		retry[id] = delivery
+	}
+	if len(done) == 0 && len(retry) == 0 {
+		return
+	}
+
+	// Deliveries may have arrived while forwarding, reload before writing back
+	deliveryBufferLock.Lock()
+	defer deliveryBufferLock.Unlock()
+	deliveries, cm, err := r.loadDeliveryBuffer()
+	if err != nil {
+		logging.Log.Errorf("error reading delivery buffer: %s", err)
+		return
+	}
+	for id := range done {
+		delete(deliveries, id)
+	}
+	for id, delivery := range retry {
+		if _, ok := deliveries[id]; ok {
+			deliveries[id] = delivery
+		}
+	}
+	if err := r.saveDeliveryBuffer(cm, deliveries); err != nil {
+		logging.Log.Errorf("error updating delivery buffer: %s", err)
+	}
+}
+
+// forwardDelivery replays a delivery, with its original headers, to the eventlistener service
+func forwardDelivery(installNs, service string, delivery bufferedDelivery) (int, error) {
+	url := fmt.Sprintf("http://%s.%s.svc.cluster.local:8080", service, installNs)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return 0, err
+	}
+	for key, values := range delivery.Header {
+		if key == "Content-Length" || key == "Host" {
+			continue
+		}
+		req.Header[key] = values
+	}
+	resp, err := deliveryClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, nil
+}
+
+// storeDelivery adds a delivery to the buffer configmap
+func (r Resource) storeDelivery(delivery bufferedDelivery) error {
+	deliveryBufferLock.Lock()
+	defer deliveryBufferLock.Unlock()
+	deliveries, cm, err := r.loadDeliveryBuffer()
+	if err != nil {
+		return err
+	}
+	if len(deliveries) >= maxBufferedDeliveries {
+		return fmt.Errorf("delivery buffer is full (%d deliveries)", len(deliveries))
+	}
+	deliveries[delivery.ID] = delivery
+	return r.saveDeliveryBuffer(cm, deliveries)
+}
+
+// loadDeliveryBuffer returns the buffered deliveries keyed by id along with
+// their configmap, creating the configmap if needed. Callers hold deliveryBufferLock.
+func (r Resource) loadDeliveryBuffer() (map[string]bufferedDelivery, *corev1.ConfigMap, error) {
+	installNs := r.Defaults.Namespace
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(installNs).Get(deliveryBufferConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      deliveryBufferConfigMap,
+				Namespace: installNs,
+				Labels:    managedLabels(),
+			},
+		}
+		cm, err = r.K8sClient.CoreV1().ConfigMaps(installNs).Create(cm)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deliveries := make(map[string]bufferedDelivery)
+	for id, data := range cm.Data {
+		delivery := bufferedDelivery{}
+		if err := json.Unmarshal([]byte(data), &delivery); err != nil {
+			logging.Log.Errorf("discarding unreadable buffered delivery %s: %s", id, err)
+			continue
+		}
+		deliveries[id] = delivery
+	}
+	return deliveries, cm, nil
+}
+
+// saveDeliveryBuffer writes deliveries back to the buffer configmap. Callers hold deliveryBufferLock.
+func (r Resource) saveDeliveryBuffer(cm *corev1.ConfigMap, deliveries map[string]bufferedDelivery) error {
+	cm.Data = make(map[string]string)
+	for id, delivery := range deliveries {
+		data, err := json.Marshal(delivery)
+		if err != nil {
+			return err
+		}
+		cm.Data[id] = string(data)
+	}
+	_, err := r.K8sClient.CoreV1().ConfigMaps(cm.Namespace).Update(cm)
+	return err
+}
+
+// deliveryID uses the provider's delivery id where there is one so redeliveries replace, rather than duplicate, an entry
+func deliveryID(header http.Header) string {
+	id := header.Get("X-GitHub-Delivery")
+	if id == "" {
+		id = header.Get("X-Gitlab-Event-UUID")
+	}
+	if id == "" {
+		id = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return deliveryIDSanitizer.ReplaceAllString(id, "-")
+}
+
+// deliveryBackoff doubles the wait between attempts up to maxDeliveryBackoff
+func deliveryBackoff(attempts int) time.Duration {
+	backoff := time.Second
+	for i := 1; i < attempts && backoff < maxDeliveryBackoff; i = i + 1 {
+		backoff = backoff * 2
+	}
+	if backoff > maxDeliveryBackoff {
+		backoff = maxDeliveryBackoff
+	}
+	return backoff
+}
+
+func (r Resource) getDeliveryForwardService() string {
+	deliveryBufferLock.Lock()
+	defer deliveryBufferLock.Unlock()
+	if deliveryForwardService == "" {
+		return listenerServiceName(r.eventListenerName())
+	}
+	return deliveryForwardService
+}
+
+func setDeliveryForwardService(service string) {
+	deliveryBufferLock.Lock()
+	defer deliveryBufferLock.Unlock()
+	deliveryForwardService = service
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReceiveDeliveryBuffers(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.DeliveryBuffer = true
+
+	req := dummyHTTPRequest("POST", "http://wext/", bytes.NewBufferString(`{"ref":"refs/heads/master"}`))
+	req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	req.Header.Set("X-GitHub-Event", "push")
+	recorder := httptest.NewRecorder()
+	r.receiveDelivery(recorder, req)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("delivery status was %d, expected %d", recorder.Code, http.StatusAccepted)
+	}
+
+	deliveries, _, err := r.loadDeliveryBuffer()
+	if err != nil {
+		t.Fatalf("error loading delivery buffer: %s", err.Error())
+	}
+	delivery, ok := deliveries["72d3162e-cc78-11e3-81ab-4c9367dc0958"]
+	if !ok {
+		t.Fatalf("delivery not found in buffer, buffer was %+v", deliveries)
+	}
+	if string(delivery.Body) != `{"ref":"refs/heads/master"}` {
+		t.Errorf("buffered body was %s", string(delivery.Body))
+	}
+	if delivery.Header.Get("X-GitHub-Event") != "push" {
+		t.Errorf("buffered event header was %s, expected push", delivery.Header.Get("X-GitHub-Event"))
+	}
+}
+
+func TestDeliveryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{20, maxDeliveryBackoff},
+	}
+	for _, tt := range tests {
+		if backoff := deliveryBackoff(tt.attempts); backoff != tt.expected {
+			t.Errorf("backoff after %d attempts was %s, expected %s", tt.attempts, backoff, tt.expected)
+		}
+	}
+}
+
+func TestSwitchListenerBackendWhenBuffering(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.DeliveryBuffer = true
+	defer setDeliveryForwardService("")
+
+	if err := r.switchListenerBackend("el-" + r.standbyEventListenerName()); err != nil {
+		t.Fatalf("error switching backend: %s", err.Error())
+	}
+	if service := r.getDeliveryForwardService(); service != "el-"+r.standbyEventListenerName() {
+		t.Errorf("deliveries forwarded to %s, expected el-%s", service, r.standbyEventListenerName())
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+A webhook's dependencyupdates sends the pull requests of dependency update
+bots, dependabot and renovate unless other bots are named, to another
+pipeline, e.g. a cheaper one, so a storm of updates doesn't take up the
+capacity meant for people's pull requests. The webhook gets a third pull
+request trigger, <webhook>-<namespace>-pullrequest-deps, using the update
+pipeline's template and bindings. All of the webhook's pull request
+triggers carry the bots as a header and the interceptor accepts each pull
+request on exactly one of them: the deps trigger if a bot opened it, else
+the webhook's own (or canary) trigger. Pushes aren't routed. The route is
+kept as a binding param.
+---------------------------------------*/
+
+const (
+	// Set on the trigger running the update pipeline
+	dependencyRouteHeader = "Wext-Dependency-Route"
+	// The bots whose pull requests run the update pipeline, comma separated
+	dependencySendersHeader = "Wext-Dependency-Senders"
+	dependencyTriggerSuffix = "-pullrequest-deps"
+)
+
+// Bots whose pull requests are dependency updates when a webhook's dependencyupdates doesn't name any
+var defaultDependencyBots = []string{"dependabot[bot]", "dependabot-preview[bot]", "renovate[bot]", "renovate-bot"}
+
+// dependencyRoute sends the pull requests of dependency update bots to another pipeline
+type dependencyRoute struct {
+	Pipeline string `json:"pipeline"`
+	// The bots' user names, defaultDependencyBots when empty
+	Bots []string `json:"bots,omitempty"`
+}
+
+// validateDependencyRoute checks the route and that its pipeline has a template and pull request binding
+func (r Resource) validateDependencyRoute(webhook webhook) error {
+	route := webhook.DependencyRoute
+	if route == nil {
+		return nil
+	}
+	if route.Pipeline == "" {
+		return errors.New("dependencyupdates requires a pipeline")
+	}
+	if route.Pipeline == webhook.Pipeline {
+		return fmt.Errorf("dependencyupdates pipeline %s is the webhook's pipeline", route.Pipeline)
+	}
+	for _, bot := range route.Bots {
+		if strings.TrimSpace(bot) == "" || strings.ContainsAny(bot, ", \t\n") {
+			return fmt.Errorf("dependencyupdates bot %q is not a user name", bot)
+		}
+	}
+	installNs := r.Defaults.Namespace
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(route.Pipeline+"-pullrequest-binding", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("dependencyupdates triggerbinding %s could not be found: %s", route.Pipeline+"-pullrequest-binding", err)
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(route.Pipeline+"-template", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("dependencyupdates triggertemplate %s could not be found: %s", route.Pipeline+"-template", err)
+	}
+	return nil
+}
+
+// dependencyParams is the binding param recording the webhook's dependency update route
+func dependencyParams(webhook webhook) []v1alpha1.Param {
+	if webhook.DependencyRoute == nil {
+		return []v1alpha1.Param{}
+	}
+	routeJSON, err := json.Marshal(webhook.DependencyRoute)
+	if err != nil {
+		logging.Log.Errorf("error marshalling dependencyupdates: %s", err)
+	}
+	return []v1alpha1.Param{{Name: "webhooks-tekton-dependency-updates", Value: string(routeJSON)}}
+}
+
+// dependencyBots are the bots whose pull requests the route sends to the update pipeline
+func dependencyBots(route *dependencyRoute) []string {
+	if len(route.Bots) == 0 {
+		return defaultDependencyBots
+	}
+	return route.Bots
+}
+
+// withDependencyUpdates returns the webhook's triggers followed, if it has a dependency update route, by the
+// trigger running the update pipeline, its pull request triggers carrying the bots to route on
+func withDependencyUpdates(webhook webhook, triggers []v1alpha1.EventListenerTrigger) []v1alpha1.EventListenerTrigger {
+	route := webhook.DependencyRoute
+	if route == nil {
+		return triggers
+	}
+	prefix := triggerPrefix(webhook)
+	bots := pipelinesv1alpha1.Param{Name: dependencySendersHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: strings.Join(dependencyBots(route), ",")}}
+	updates := []v1alpha1.EventListenerTrigger{}
+	for i, trigger := range triggers {
+		if trigger.Name == prefix+"-pullrequest-event" {
+			// Every pull request of the bots runs the update pipeline, whatever the canary split
+			deps := withoutHeaders(canaryTrigger(trigger, prefix+dependencyTriggerSuffix, route.Pipeline+"-pullrequest-binding", route.Pipeline+"-template"),
+				canaryRouteHeader, canaryPercentageHeader, canaryLabelHeader)
+			deps.Interceptors[0].Webhook.Header = append(deps.Interceptors[0].Webhook.Header, bots,
+				pipelinesv1alpha1.Param{Name: dependencyRouteHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "dependency"}})
+			updates = append(updates, deps)
+		}
+		if trigger.Name == prefix+"-pullrequest-event" || trigger.Name == prefix+"-pullrequest-canary" {
+			triggers[i].Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header, bots)
+		}
+	}
+	return append(triggers, updates...)
+}
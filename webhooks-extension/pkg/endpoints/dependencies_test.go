@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateDependencyRoute(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, Pipeline: "pipeline1"}
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+
+	valid := []*dependencyRoute{
+		nil,
+		{Pipeline: "pipeline2"},
+		{Pipeline: "pipeline2", Bots: []string{"renovate[bot]"}},
+	}
+	for _, route := range valid {
+		hook.DependencyRoute = route
+		if err := r.validateDependencyRoute(hook); err != nil {
+			t.Errorf("unexpected error for dependencyupdates %+v: %s", route, err)
+		}
+	}
+	invalid := []*dependencyRoute{
+		{},
+		{Pipeline: "pipeline1"},
+		{Pipeline: "pipeline2", Bots: []string{"a,b"}},
+		{Pipeline: "pipeline3"},
+	}
+	for _, route := range invalid {
+		hook.DependencyRoute = route
+		if err := r.validateDependencyRoute(hook); err == nil {
+			t.Errorf("expected an error for dependencyupdates %+v", route)
+		}
+	}
+}
+
+func TestCreateEventListenerWithDependencyRoute(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		Canary:           &canaryRoute{Pipeline: "pipeline2", Percentage: 10},
+		DependencyRoute:  &dependencyRoute{Pipeline: "pipeline3"},
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	createTriggerResources(webhook{Pipeline: "pipeline3"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	bots := strings.Join(defaultDependencyBots, ",")
+	expected := map[string]string{
+		"hook-default-push-event":         "",
+		"hook-default-pullrequest-event":  bots,
+		"hook-default-push-canary":        "",
+		"hook-default-pullrequest-canary": bots,
+		"hook-default-pullrequest-deps":   bots,
+	}
+	for _, trigger := range el.Spec.Triggers {
+		senders, found := expected[trigger.Name]
+		if !found {
+			continue
+		}
+		delete(expected, trigger.Name)
+		if got := triggerHeader(trigger, dependencySendersHeader); got != senders {
+			t.Errorf("trigger %s bots were %q, expected %q", trigger.Name, got, senders)
+		}
+		if trigger.Name != "hook-default-pullrequest-deps" {
+			continue
+		}
+		if trigger.Template.Name != "pipeline3-template" || trigger.Bindings[0].Ref != "pipeline3-pullrequest-binding" {
+			t.Errorf("dependency trigger uses %s and %s", trigger.Template.Name, trigger.Bindings[0].Ref)
+		}
+		if triggerHeader(trigger, dependencyRouteHeader) != "dependency" || triggerHeader(trigger, canaryRouteHeader) != "" {
+			t.Error("expected the dependency trigger to be routed dependency updates and not canary events")
+		}
+		if name := triggerHeader(trigger, "Wext-Trigger-Name"); name != trigger.Name {
+			t.Errorf("dependency trigger has Wext-Trigger-Name %s", name)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("triggers %v were not created", expected)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	if !reflect.DeepEqual(hooks[0].DependencyRoute, hook.DependencyRoute) {
+		t.Errorf("dependencyupdates was %+v, expected %+v", hooks[0].DependencyRoute, hook.DependencyRoute)
+	}
+
+	// Deleting the webhook removes its dependency trigger, leaving another webhook on the repository
+	other := webhook{Name: "other", Namespace: installNs, GitRepositoryURL: hook.GitRepositoryURL, AccessTokenRef: "token1", Pipeline: "pipeline4"}
+	createTriggerResources(other, r)
+	if el, err = r.updateEventListener(el, other, "owner.repo-"); err != nil {
+		t.Fatalf("error adding webhook: %s", err)
+	}
+	if err := r.deleteFromEventListener("hook-"+installNs, installNs, "owner.repo-", hook); err != nil {
+		t.Fatalf("error deleting webhook: %s", err)
+	}
+	el, err = r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting eventlistener: %s", err)
+	}
+	for _, trigger := range el.Spec.Triggers {
+		if strings.HasPrefix(trigger.Name, "hook-") {
+			t.Errorf("trigger %s left behind", trigger.Name)
+		}
+	}
+}
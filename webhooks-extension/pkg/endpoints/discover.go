@@ -0,0 +1,263 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/discover").To(r.profiled(Resource.discover)))
+Guides webhook creation by looking at what a repository builds. The
+repository's default branch is read through the git provider with the
+given access token, without cloning it:
+
+	- the Tekton resources in the YAML files of its .tekton directory
+	- the build files at its root, Dockerfile, package.json, pom.xml...
+
+and the pipelines a webhook can run, those with a <pipeline>-template
+TriggerTemplate in the install namespace, are suggested, best first. A
+pipeline the repository defines itself comes before one whose name fits
+a build file, e.g. a maven pipeline for a repository with a pom.xml.
+The starters building the repository's build files are listed too, for a
+repository whose namespace has no pipeline yet.
+---------------------------------------*/
+
+const (
+	tektonDir = ".tekton"
+	// The most .tekton files read, so a repository with many can't make discovery slow
+	maxDiscoveredFiles = 20
+)
+
+// buildFileHints are the words in a pipeline's name suggesting it builds a repository with the build file
+var buildFileHints = map[string][]string{
+	"Dockerfile":       {"docker", "image", "kaniko", "buildah"},
+	"package.json":     {"node", "nodejs", "npm", "yarn", "javascript"},
+	"pom.xml":          {"maven", "mvn", "java"},
+	"build.gradle":     {"gradle", "java"},
+	"go.mod":           {"go", "golang"},
+	"requirements.txt": {"python", "pip"},
+}
+
+// discoveredResource is a Tekton resource defined in the repository
+type discoveredResource struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// For a pipeline, whether a webhook can run it
+	HasTemplate bool `json:"hastemplate,omitempty"`
+}
+
+type pipelineSuggestion struct {
+	Pipeline string `json:"pipeline"`
+	Template string `json:"template"`
+	Reason   string `json:"reason"`
+	// Whether the pipeline exists in the namespace queried, omitted without one
+	Installed *bool `json:"installed,omitempty"`
+}
+
+type discoverResponse struct {
+	Repository  string               `json:"repository"`
+	Resources   []discoveredResource `json:"resources"`
+	BuildFiles  []string             `json:"buildfiles"`
+	Suggestions []pipelineSuggestion `json:"suggestions"`
+	// Starters building the repository's build files, see starters.go
+	Starters []string `json:"starters"`
+	// Files that couldn't be read or parsed
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// GET /webhooks/discover?repository=x&accesstoken=y[&namespace=z]
+func (r Resource) discover(request *restful.Request, response *restful.Response) {
+	repoURL := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(request.QueryParameter("repository")), "/"), ".git")
+	accessToken := request.QueryParameter("accesstoken")
+	if repoURL == "" || accessToken == "" {
+		RespondError(response, errors.New("repository and accesstoken query parameters are required"), http.StatusBadRequest)
+		return
+	}
+	_, gitOwner, gitRepo, err := r.getGitValues(repoURL)
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	provider, err := r.createGitProviderForWebhook(webhook{GitRepositoryURL: repoURL, AccessTokenRef: accessToken}, gitOwner, gitRepo)
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	templates, err := r.webhookPipelines()
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+
+	result, err := discoverRepository(provider, templates)
+	if err != nil {
+		logging.Log.Errorf("error discovering pipelines in %s: %s", repoURL, err)
+		RespondError(response, fmt.Errorf("error reading %s: %s", repoURL, err), http.StatusInternalServerError)
+		return
+	}
+	result.Repository = repoURL
+	starters, err := r.getStarters()
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	result.Starters = startersFor(starters, result.BuildFiles)
+	if namespace := request.QueryParameter("namespace"); namespace != "" {
+		for i := range result.Suggestions {
+			_, err := r.TektonClient.TektonV1alpha1().Pipelines(namespace).Get(result.Suggestions[i].Pipeline, metav1.GetOptions{})
+			installed := err == nil
+			result.Suggestions[i].Installed = &installed
+		}
+	}
+	response.WriteEntity(result)
+}
+
+// webhookPipelines maps the pipelines a webhook can run to their TriggerTemplates
+func (r Resource) webhookPipelines() (map[string]string, error) {
+	list, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pipelines := map[string]string{}
+	for _, template := range list.Items {
+		if strings.HasSuffix(template.Name, "-template") {
+			pipelines[strings.TrimSuffix(template.Name, "-template")] = template.Name
+		}
+	}
+	return pipelines, nil
+}
+
+// discoverRepository reads the repository's Tekton resources and build files and suggests from templates,
+// pipelines mapped to their TriggerTemplates
+func discoverRepository(provider GitProvider, templates map[string]string) (discoverResponse, error) {
+	result := discoverResponse{Resources: []discoveredResource{}, BuildFiles: []string{}, Suggestions: []pipelineSuggestion{}}
+
+	rootFiles, err := provider.ListFiles("")
+	if err != nil && err != errFileNotFound {
+		return result, err
+	}
+	for _, file := range rootFiles {
+		if _, known := buildFileHints[file]; known {
+			result.BuildFiles = append(result.BuildFiles, file)
+		}
+	}
+	sort.Strings(result.BuildFiles)
+
+	tektonFiles, err := provider.ListFiles(tektonDir)
+	if err != nil && err != errFileNotFound {
+		return result, err
+	}
+	sort.Strings(tektonFiles)
+	read := 0
+	for _, file := range tektonFiles {
+		if ext := path.Ext(file); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		if read == maxDiscoveredFiles {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("only the first %d files of %s were read", maxDiscoveredFiles, tektonDir))
+			break
+		}
+		read++
+		data, err := provider.GetFile(file)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("error reading %s: %s", file, err))
+			continue
+		}
+		resources, err := parseTektonResources(file, data)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("error parsing %s: %s", file, err))
+		}
+		result.Resources = append(result.Resources, resources...)
+	}
+
+	suggested := map[string]bool{}
+	for i, resource := range result.Resources {
+		if resource.Kind != "Pipeline" {
+			continue
+		}
+		template, found := templates[resource.Name]
+		result.Resources[i].HasTemplate = found
+		if found && !suggested[resource.Name] {
+			suggested[resource.Name] = true
+			result.Suggestions = append(result.Suggestions, pipelineSuggestion{Pipeline: resource.Name, Template: template,
+				Reason: fmt.Sprintf("defined in %s", resource.Path)})
+		}
+	}
+	pipelines := []string{}
+	for pipeline := range templates {
+		pipelines = append(pipelines, pipeline)
+	}
+	sort.Strings(pipelines)
+	for _, buildFile := range result.BuildFiles {
+		for _, pipeline := range pipelines {
+			if !suggested[pipeline] && nameMatches(pipeline, buildFileHints[buildFile]) {
+				suggested[pipeline] = true
+				result.Suggestions = append(result.Suggestions, pipelineSuggestion{Pipeline: pipeline, Template: templates[pipeline],
+					Reason: fmt.Sprintf("the repository has a %s", buildFile)})
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseTektonResources lists the Tekton resources in the YAML documents of a file
+func parseTektonResources(file string, data []byte) ([]discoveredResource, error) {
+	resources := []discoveredResource{}
+	for _, document := range bytes.Split(data, []byte("\n---")) {
+		resource := struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}{}
+		if err := yaml.Unmarshal(document, &resource); err != nil {
+			return resources, err
+		}
+		if strings.Contains(resource.APIVersion, "tekton.dev/") && resource.Metadata.Name != "" {
+			resources = append(resources, discoveredResource{Path: file, Kind: resource.Kind, Name: resource.Metadata.Name})
+		}
+	}
+	return resources, nil
+}
+
+// nameMatches is whether one of the dash separated words of name is a hint
+func nameMatches(name string, hints []string) bool {
+	for _, word := range strings.Split(strings.ToLower(name), "-") {
+		for _, hint := range hints {
+			if word == hint {
+				return true
+			}
+		}
+	}
+	return false
+}
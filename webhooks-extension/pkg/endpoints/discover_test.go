@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseTektonResources(t *testing.T) {
+	data := []byte(`apiVersion: tekton.dev/v1alpha1
+kind: Pipeline
+metadata:
+  name: build
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: unit-tests
+`)
+	resources, err := parseTektonResources(".tekton/build.yaml", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 2 || resources[0].Kind != "Pipeline" || resources[0].Name != "build" ||
+		resources[1].Kind != "Task" || resources[1].Name != "unit-tests" {
+		t.Errorf("expected the pipeline and task, got %+v", resources)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("GIT_PROVIDER_MODE", "replay")
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", dir)
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+
+	r := dummyResource()
+	for _, pipeline := range []string{"repo-pipeline", "maven-build", "docker-build", "simple"} {
+		createTriggerResources(webhook{Pipeline: pipeline, AccessTokenRef: "token1"}, r)
+	}
+	pipeline := pipelinesv1alpha1.Pipeline{ObjectMeta: metav1.ObjectMeta{Name: "repo-pipeline", Namespace: installNs}}
+	if _, err := r.TektonClient.TektonV1alpha1().Pipelines(installNs).Create(&pipeline); err != nil {
+		t.Fatal(err)
+	}
+	path := testRecordingPath(t, "github", "owner", "repo")
+	if err := saveRecording(path, recording{Files: map[string]string{
+		"pom.xml":               "<project/>",
+		"README.md":             "# repo",
+		".tekton/pipeline.yaml": "apiVersion: tekton.dev/v1alpha1\nkind: Pipeline\nmetadata:\n  name: repo-pipeline\n",
+		".tekton/other.yaml":    "apiVersion: tekton.dev/v1alpha1\nkind: Pipeline\nmetadata:\n  name: no-template\n",
+		".tekton/notes.txt":     "not yaml",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/discover?repository=https://github.com/owner/repo&accesstoken=token1&namespace="+installNs, nil)
+	httpWriter := httptest.NewRecorder()
+	r.discover(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	result := discoverResponse{}
+	json.NewDecoder(httpWriter.Body).Decode(&result)
+	if httpWriter.Code != http.StatusOK {
+		t.Fatalf("expected discovery to succeed, got %d", httpWriter.Code)
+	}
+	if len(result.BuildFiles) != 1 || result.BuildFiles[0] != "pom.xml" {
+		t.Errorf("expected pom.xml to be found, got %v", result.BuildFiles)
+	}
+	if len(result.Resources) != 2 || result.Resources[0].Name != "no-template" || result.Resources[0].HasTemplate ||
+		result.Resources[1].Name != "repo-pipeline" || !result.Resources[1].HasTemplate {
+		t.Errorf("expected both pipelines of .tekton, only repo-pipeline with a template, got %+v", result.Resources)
+	}
+	if len(result.Suggestions) != 2 || result.Suggestions[0].Pipeline != "repo-pipeline" || result.Suggestions[1].Pipeline != "maven-build" {
+		t.Fatalf("expected repo-pipeline then maven-build to be suggested, got %+v", result.Suggestions)
+	}
+	if result.Suggestions[0].Installed == nil || !*result.Suggestions[0].Installed || result.Suggestions[1].Installed == nil || *result.Suggestions[1].Installed {
+		t.Errorf("expected only repo-pipeline to be installed in %s, got %+v", installNs, result.Suggestions)
+	}
+
+	httpReq = dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/discover?repository=https://github.com/owner/repo", nil)
+	httpWriter = httptest.NewRecorder()
+	r.discover(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusBadRequest {
+		t.Errorf("expected discovery without an access token to fail with a 400, got %d", httpWriter.Code)
+	}
+}
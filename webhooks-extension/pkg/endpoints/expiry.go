@@ -0,0 +1,242 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+A webhook created with expiresat, for a hackathon or a spike, is disabled
+once that time passes: its triggers are marked with the Wext-Disabled
+header, which the interceptor rejects deliveries for. After
+EXPIRY_GRACE_PERIOD (24h by default) it is deleted as DELETE /webhooks
+would, the provider webhook included. The owner is notified of both
+steps through EXPIRY_NOTIFY_URL if it is set.
+---------------------------------------*/
+
+const (
+	// Set on the triggers of a disabled webhook, to the reason it was disabled
+	disabledHeader = "Wext-Disabled"
+	// Used if EXPIRY_GRACE_PERIOD isn't set
+	defaultExpiryGracePeriod = 24 * time.Hour
+	expiryCheckInterval      = 5 * time.Minute
+	expiryNotifyTimeout      = 10 * time.Second
+)
+
+// expiryNotification is posted to EXPIRY_NOTIFY_URL when an expired webhook is disabled or deleted
+type expiryNotification struct {
+	Action           string `json:"action"`
+	Name             string `json:"name"`
+	Namespace        string `json:"namespace"`
+	GitRepositoryURL string `json:"gitrepositoryurl"`
+	Owner            string `json:"owner,omitempty"`
+	ExpiresAt        string `json:"expiresat"`
+}
+
+func validateExpiresAt(expiresAt string) error {
+	if expiresAt == "" {
+		return nil
+	}
+	expiry, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return fmt.Errorf("expiresat %s is not an RFC 3339 time, e.g. 2020-06-30T17:00:00Z", expiresAt)
+	}
+	if !expiry.After(time.Now()) {
+		return fmt.Errorf("expiresat %s is in the past", expiresAt)
+	}
+	return nil
+}
+
+// expiryParams are the binding params recording when a webhook expires and who to tell
+func expiryParams(webhook webhook) []v1alpha1.Param {
+	params := []v1alpha1.Param{}
+	if webhook.ExpiresAt != "" {
+		params = append(params, v1alpha1.Param{Name: "webhooks-tekton-expires-at", Value: webhook.ExpiresAt})
+	}
+	if webhook.Owner != "" {
+		params = append(params, v1alpha1.Param{Name: "webhooks-tekton-owner", Value: webhook.Owner})
+	}
+	return params
+}
+
+func getExpiryGracePeriod() time.Duration {
+	if period, err := time.ParseDuration(os.Getenv("EXPIRY_GRACE_PERIOD")); err == nil && period >= 0 {
+		return period
+	}
+	return defaultExpiryGracePeriod
+}
+
+// ExpireWebhooks disables and then deletes expired webhooks until stopCh is closed
+func (r Resource) ExpireWebhooks(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		for _, profiled := range r.allProfiles() {
+			profiled.expireWebhooks(time.Now())
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireWebhooks disables the webhooks expired at now and deletes those whose grace period is over, then notifies
+// their owners. Notifying is left until the lock is released so a slow receiver doesn't hold up webhook changes.
+func (r Resource) expireWebhooks(now time.Time) {
+	for _, notification := range r.expireWebhooksLocked(now) {
+		notifyExpiry(notification)
+	}
+}
+
+// expireWebhooksLocked does the disabling and deleting for expireWebhooks, returning the notifications to send
+func (r Resource) expireWebhooksLocked(now time.Time) []expiryNotification {
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error getting webhooks to check for expiry: %s", err)
+		return nil
+	}
+	notifications := []expiryNotification{}
+	gracePeriod := getExpiryGracePeriod()
+	deleted := map[string]bool{}
+	for _, hook := range hooks {
+		if hook.ExpiresAt == "" {
+			continue
+		}
+		expiry, err := time.Parse(time.RFC3339, hook.ExpiresAt)
+		if err != nil {
+			logging.Log.Errorf("webhook %s in namespace %s has an invalid expiry %s", hook.Name, hook.Namespace, hook.ExpiresAt)
+			continue
+		}
+		if now.Before(expiry) {
+			continue
+		}
+
+		if now.Before(expiry.Add(gracePeriod)) {
+			disabled, err := r.disableWebhook(hook, "expired")
+			if err != nil {
+				logging.Log.Errorf("error disabling expired webhook %s in namespace %s: %s", hook.Name, hook.Namespace, err)
+				continue
+			}
+			if disabled {
+				logging.Log.Infof("disabled webhook %s in namespace %s, it expired at %s", hook.Name, hook.Namespace, hook.ExpiresAt)
+				notifications = append(notifications, newExpiryNotification("disabled", hook))
+			}
+			continue
+		}
+
+		hooksOnRepo := 0
+		for _, other := range hooks {
+			if sameRepo(other.GitRepositoryURL, hook.GitRepositoryURL) && !deleted[other.Name+"/"+other.Namespace] {
+				hooksOnRepo++
+			}
+		}
+		if err := r.removeHook(hook, hooksOnRepo, false); err != nil {
+			logging.Log.Errorf("error deleting expired webhook %s in namespace %s: %s", hook.Name, hook.Namespace, err)
+			continue
+		}
+		deleted[hook.Name+"/"+hook.Namespace] = true
+		logging.Log.Infof("deleted webhook %s in namespace %s, it expired at %s", hook.Name, hook.Namespace, hook.ExpiresAt)
+		notifications = append(notifications, newExpiryNotification("deleted", hook))
+	}
+	return notifications
+}
+
+// disableWebhook marks the webhook's triggers disabled, returning false if they already were
+func (r Resource) disableWebhook(hook webhook, reason string) (bool, error) {
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(r.Defaults.Namespace).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	prefix := triggerPrefix(hook)
+	names := map[string]bool{}
+	for _, name := range webhookTriggerNames(prefix) {
+		names[name] = true
+	}
+	changed := false
+	for i, trigger := range el.Spec.Triggers {
+		if !names[trigger.Name] {
+			continue
+		}
+		if isTriggerDisabled(trigger) {
+			continue
+		}
+		el.Spec.Triggers[i].Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header,
+			pipelinesv1alpha1.Param{Name: disabledHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: reason}})
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	_, err = r.TriggersClient.TriggersV1alpha1().EventListeners(r.Defaults.Namespace).Update(el)
+	return err == nil, err
+}
+
+func isTriggerDisabled(trigger v1alpha1.EventListenerTrigger) bool {
+	for _, header := range trigger.Interceptors[0].Webhook.Header {
+		if header.Name == disabledHeader {
+			return true
+		}
+	}
+	return false
+}
+
+func newExpiryNotification(action string, hook webhook) expiryNotification {
+	return expiryNotification{
+		Action:           action,
+		Name:             hook.Name,
+		Namespace:        hook.Namespace,
+		GitRepositoryURL: hook.GitRepositoryURL,
+		Owner:            hook.Owner,
+		ExpiresAt:        hook.ExpiresAt,
+	}
+}
+
+// notifyExpiry tells the webhook's owner it was disabled or deleted, failures are only logged
+func notifyExpiry(notification expiryNotification) {
+	notifyURL := os.Getenv("EXPIRY_NOTIFY_URL")
+	if notifyURL == "" {
+		return
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		logging.Log.Errorf("error marshalling expiry notification: %s", err)
+		return
+	}
+	client := http.Client{Timeout: expiryNotifyTimeout}
+	resp, err := client.Post(notifyURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logging.Log.Errorf("error notifying %s that webhook %s was %s: %s", notifyURL, notification.Name, notification.Action, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logging.Log.Errorf("error notifying %s that webhook %s was %s: status %d", notifyURL, notification.Name, notification.Action, resp.StatusCode)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateExpiresAt(t *testing.T) {
+	if err := validateExpiresAt(""); err != nil {
+		t.Errorf("unexpected error for no expiry: %s", err)
+	}
+	if err := validateExpiresAt(time.Now().Add(time.Hour).Format(time.RFC3339)); err != nil {
+		t.Errorf("unexpected error for a future expiry: %s", err)
+	}
+	if err := validateExpiresAt("2020-01-01T00:00:00Z"); err == nil {
+		t.Error("expected an error for a past expiry")
+	}
+	if err := validateExpiresAt("next friday"); err == nil {
+		t.Error("expected an error for an invalid expiry")
+	}
+}
+
+func TestExpireWebhooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("GIT_PROVIDER_MODE", "replay")
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", dir)
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+
+	notifications := []expiryNotification{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		notification := expiryNotification{}
+		json.NewDecoder(req.Body).Decode(&notification)
+		notifications = append(notifications, notification)
+		// Owners are notified after the lock is released
+		unlocked := make(chan struct{})
+		go func() {
+			modifyingEventListenerLock.Lock()
+			modifyingEventListenerLock.Unlock()
+			close(unlocked)
+		}()
+		select {
+		case <-unlocked:
+		case <-time.After(5 * time.Second):
+			t.Errorf("the eventlistener lock was held while notifying that webhook %s was %s", notification.Name, notification.Action)
+		}
+	}))
+	defer server.Close()
+	os.Setenv("EXPIRY_NOTIFY_URL", server.URL)
+	defer os.Unsetenv("EXPIRY_NOTIFY_URL")
+
+	r := dummyResource()
+	expiresAt := time.Date(2020, 6, 30, 17, 0, 0, 0, time.UTC)
+	hook := webhook{
+		Name:             "spike",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		ExpiresAt:        expiresAt.Format(time.RFC3339),
+		Owner:            "alice@example.com",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	// Not yet expired
+	r.expireWebhooks(expiresAt.Add(-time.Minute))
+	if len(notifications) != 0 {
+		t.Fatalf("expected no notifications before the webhook expires, got %+v", notifications)
+	}
+
+	// Expired, disabled once
+	r.expireWebhooks(expiresAt.Add(time.Minute))
+	r.expireWebhooks(expiresAt.Add(2 * time.Minute))
+	el, _ := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	for _, trigger := range el.Spec.Triggers {
+		disabled := isTriggerDisabled(trigger)
+		if (trigger.Name == "spike-default-push-event" || trigger.Name == "spike-default-pullrequest-event") != disabled {
+			t.Errorf("trigger %s disabled was %t", trigger.Name, disabled)
+		}
+	}
+	if len(notifications) != 1 || notifications[0].Action != "disabled" || notifications[0].Owner != "alice@example.com" {
+		t.Fatalf("expected one disabled notification to the owner, got %+v", notifications)
+	}
+
+	// Grace period over, deleted
+	r.expireWebhooks(expiresAt.Add(defaultExpiryGracePeriod + time.Minute))
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 0 {
+		t.Errorf("expected the expired webhook to be deleted, got %+v, %v", hooks, err)
+	}
+	if len(notifications) != 2 || notifications[1].Action != "deleted" {
+		t.Errorf("expected a deleted notification, got %+v", notifications)
+	}
+}
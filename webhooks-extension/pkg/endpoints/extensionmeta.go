@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/extension").To(r.getExtensionMetadata))
+Describes the extension to the Tekton dashboard, which otherwise reads the
+tekton-dashboard-* annotations of the extension's service, so a dashboard
+can mount the webhooks UI without the annotations being kept up to date.
+The bundle location is the hashed path, see webassets.go, of the
+extension.<hash>.js the web resources directory holds, falling back to the
+service's annotation, so it is right whichever build is deployed. Version is set at build time with
+-ldflags "-X github.com/tektoncd/experimental/webhooks-extension/pkg/endpoints.Version=v0.6.0".
+---------------------------------------*/
+
+const (
+	extensionName        = "webhooks-extension"
+	extensionDisplayName = "Webhooks"
+	// Path segments, dot separated, of the extension's UI on the dashboard as in tekton-dashboard-endpoints
+	extensionEndpoints = "webhooks.web"
+	// Service the dashboard discovers the extension through
+	extensionService         = "webhooks-extension"
+	bundleLocationAnnotation = "tekton-dashboard-bundle-location"
+	// The UI bundle rollup builds, see rollup.config.js
+	bundlePattern = "extension.*.js"
+)
+
+// Version of the extension, set when it is built
+var Version = "devel"
+
+// Capabilities of every build, GET /webhooks/extension adding those of the install's configuration
+var extensionCapabilities = []string{"history", "messages", "payloadcapture", "preview", "profiles", "shadowmode", "simulate", "strictdecoding", "yaml"}
+
+type extensionMetadata struct {
+	Name           string   `json:"name"`
+	DisplayName    string   `json:"displayname"`
+	BundleLocation string   `json:"bundlelocation"`
+	Endpoints      string   `json:"endpoints"`
+	APIBasePaths   []string `json:"apibasepaths"`
+	Version        string   `json:"version"`
+	Platform       string   `json:"platform"`
+	Capabilities   []string `json:"capabilities"`
+}
+
+// GET /webhooks/extension
+func (r Resource) getExtensionMetadata(request *restful.Request, response *restful.Response) {
+	capabilities := append([]string{}, extensionCapabilities...)
+	if r.Defaults.DeliveryBuffer {
+		capabilities = append(capabilities, "deliverybuffer")
+	}
+	if r.Defaults.MonitorController {
+		capabilities = append(capabilities, "monitorcontroller")
+	}
+	sort.Strings(capabilities)
+	response.WriteEntity(extensionMetadata{
+		Name:           extensionName,
+		DisplayName:    extensionDisplayName,
+		BundleLocation: r.bundleLocation(),
+		Endpoints:      extensionEndpoints,
+		APIBasePaths:   []string{"/webhooks", "/web"},
+		Version:        Version,
+		Platform:       r.Install.Platform,
+		Capabilities:   capabilities,
+	})
+}
+
+// bundleLocation is where the dashboard loads the UI bundle from, relative to the extension, its hashed path
+// when it is in the web resources directory
+func (r Resource) bundleLocation() string {
+	if dir := r.webResourcesDir(); dir != "" {
+		if bundle := newestBundle(dir); bundle != "" {
+			if hash, err := webAssetHash(filepath.Join(dir, bundle)); err == nil {
+				return hashedPath(bundle, hash)
+			}
+			return "web/" + bundle
+		}
+	}
+	service, err := r.K8sClient.CoreV1().Services(r.Defaults.Namespace).Get(extensionService, metav1.GetOptions{})
+	if err != nil {
+		logging.Log.Errorf("error getting the web bundle location from service %s: %s", extensionService, err)
+		return ""
+	}
+	return service.Annotations[bundleLocationAnnotation]
+}
+
+// newestBundle names the UI bundle in dir, the newest should more than one build be left in it
+func newestBundle(dir string) string {
+	bundles, _ := filepath.Glob(filepath.Join(dir, bundlePattern))
+	newest, newestTime := "", time.Time{}
+	for _, bundle := range bundles {
+		if info, err := os.Stat(bundle); err == nil && !info.ModTime().Before(newestTime) {
+			newest, newestTime = bundle, info.ModTime()
+		}
+	}
+	if newest == "" {
+		return ""
+	}
+	return filepath.Base(newest)
+}
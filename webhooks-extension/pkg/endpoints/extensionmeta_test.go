@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func getExtensionMetadataFrom(t *testing.T, r *Resource) extensionMetadata {
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/extension", nil)
+	httpWriter := httptest.NewRecorder()
+	r.getExtensionMetadata(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	metadata := extensionMetadata{}
+	if err := json.NewDecoder(httpWriter.Body).Decode(&metadata); err != nil {
+		t.Fatalf("error decoding the extension metadata: %s", err)
+	}
+	return metadata
+}
+
+func TestGetExtensionMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatalf("error creating web resources directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "extension.0a1b2c3d.js"), []byte("//"), 0644)
+
+	r := dummyResource()
+	r.Install.WebResourcesDir = dir
+	r.Install.Platform = platformKubernetes
+	r.Defaults.DeliveryBuffer = true
+	metadata := getExtensionMetadataFrom(t, r)
+
+	if metadata.Name != extensionName || metadata.DisplayName != "Webhooks" || metadata.Endpoints != "webhooks.web" {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+	hash, _ := webAssetHash(filepath.Join(dir, "extension.0a1b2c3d.js"))
+	if metadata.BundleLocation != "web/"+hash+"/extension.0a1b2c3d.js" {
+		t.Errorf("bundle location was %s", metadata.BundleLocation)
+	}
+	if metadata.Version != Version || metadata.Platform != platformKubernetes {
+		t.Errorf("version %s and platform %s", metadata.Version, metadata.Platform)
+	}
+	expected := []string{"deliverybuffer", "history", "messages", "payloadcapture", "preview", "profiles", "shadowmode", "simulate", "strictdecoding", "yaml"}
+	if !reflect.DeepEqual(metadata.Capabilities, expected) {
+		t.Errorf("capabilities were %v", metadata.Capabilities)
+	}
+}
+
+func TestGetExtensionMetadataBundleFromService(t *testing.T) {
+	r := dummyResource()
+	r.K8sClient.CoreV1().Services(installNs).Create(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        extensionService,
+			Annotations: map[string]string{bundleLocationAnnotation: "web/extension.33e1ae7b.js"},
+		},
+	})
+	if metadata := getExtensionMetadataFrom(t, r); metadata.BundleLocation != "web/extension.33e1ae7b.js" {
+		t.Errorf("bundle location was %s", metadata.BundleLocation)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// The monitor adds the last lines of the logs of each failed TaskRun to its comment, see docs/Monitoring.md.
+// A webhook can change how many, up to maxFailureLogLines, and 0 leaves the logs out.
+const (
+	defaultFailureLogLines = 20
+	maxFailureLogLines     = 100
+)
+
+func validateFailureLogLines(lines *int) error {
+	if lines != nil && (*lines < 0 || *lines > maxFailureLogLines) {
+		return fmt.Errorf("failureloglines %d is not valid, it must be between 0 and %d", *lines, maxFailureLogLines)
+	}
+	return nil
+}
+
+// getFailureLogLines returns the number of log lines the monitor reports for the webhook's failed TaskRuns
+func getFailureLogLines(webhook webhook) string {
+	if webhook.FailureLogLines == nil {
+		return strconv.Itoa(defaultFailureLogLines)
+	}
+	return strconv.Itoa(*webhook.FailureLogLines)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+)
+
+func TestValidateFailureLogLines(t *testing.T) {
+	for _, lines := range []int{0, 20, 100} {
+		if err := validateFailureLogLines(&lines); err != nil {
+			t.Errorf("failure log lines %d was invalid: %s", lines, err.Error())
+		}
+	}
+	for _, lines := range []int{-1, 101} {
+		if err := validateFailureLogLines(&lines); err == nil {
+			t.Errorf("failure log lines %d was valid, expected an error", lines)
+		}
+	}
+	if err := validateFailureLogLines(nil); err != nil {
+		t.Errorf("unset failure log lines was invalid: %s", err.Error())
+	}
+
+	none := 0
+	if lines := getFailureLogLines(webhook{FailureLogLines: &none}); lines != "0" {
+		t.Errorf("failure log lines was %s, expected 0", lines)
+	}
+	if lines := getFailureLogLines(webhook{}); lines != "20" {
+		t.Errorf("default failure log lines was %s, expected 20", lines)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+A webhook's file rules pick the pipeline an event runs by the files it
+changes, e.g. a lint pipeline for changes only to docs and the webhook's
+own full build for the rest. Each rule gets a pair of triggers using its
+pipeline's template and bindings, <webhook>-<namespace>-push-files-<n> and
+-pullrequest-files-<n>. All of the webhook's triggers carry the rules as a
+header and the interceptor, comparing the event's commits with the
+provider's compare API, accepts each event on exactly one of them: the
+triggers of the first rule matching the changed files, or if none does,
+the webhook's own (or canary) triggers. Events whose changes can't be
+compared, such as pushes creating a branch, run the webhook's pipeline.
+The rules are kept as a binding param.
+---------------------------------------*/
+
+const (
+	// The webhook's rules, as JSON, set on all of its triggers
+	fileRulesHeader = "Wext-File-Rules"
+	// The index of the rule a trigger runs the pipeline of
+	fileRuleHeader = "Wext-File-Rule"
+	// Most file rules a webhook may have
+	maxFileRules = 5
+)
+
+// fileRule runs another pipeline for the events changing files its paths match
+type fileRule struct {
+	// File patterns: a pattern ending in / matches the files under a directory, one without a / a file name in
+	// any directory, and ** matches across directories
+	Paths    []string `json:"paths"`
+	Pipeline string   `json:"pipeline,omitempty"`
+	// all, the default, when every changed file must match, any when one is enough
+	Match string `json:"match,omitempty"`
+}
+
+// fileTriggerSuffixes end the names of the triggers of a webhook's file rules after <name>-<namespace>
+func fileTriggerSuffixes() []string {
+	suffixes := []string{}
+	for i := 0; i < maxFileRules; i++ {
+		suffixes = append(suffixes, "-push-files-"+strconv.Itoa(i), "-pullrequest-files-"+strconv.Itoa(i))
+	}
+	return suffixes
+}
+
+// validateFileRules checks the rules and that each rule's pipeline has a template and bindings
+func (r Resource) validateFileRules(webhook webhook) error {
+	if len(webhook.FileRules) > maxFileRules {
+		return fmt.Errorf("filerules may have at most %d rules", maxFileRules)
+	}
+	installNs := r.Defaults.Namespace
+	for _, rule := range webhook.FileRules {
+		if rule.Pipeline == "" || len(rule.Paths) == 0 {
+			return errors.New("each of filerules requires paths and a pipeline")
+		}
+		if rule.Match != "" && rule.Match != "all" && rule.Match != "any" {
+			return fmt.Errorf("filerules match %s is not all or any", rule.Match)
+		}
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(strings.Replace(pattern, "**", "*", -1), ""); pattern == "" || err != nil {
+				return fmt.Errorf("filerules path %q is not a file pattern", pattern)
+			}
+		}
+		for _, name := range []string{rule.Pipeline + "-push-binding", rule.Pipeline + "-pullrequest-binding"} {
+			if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(name, metav1.GetOptions{}); err != nil {
+				return fmt.Errorf("filerules triggerbinding %s could not be found: %s", name, err)
+			}
+		}
+		if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(rule.Pipeline+"-template", metav1.GetOptions{}); err != nil {
+			return fmt.Errorf("filerules triggertemplate %s could not be found: %s", rule.Pipeline+"-template", err)
+		}
+	}
+	return nil
+}
+
+// fileRuleParams is the binding param recording the webhook's file rules
+func fileRuleParams(webhook webhook) []v1alpha1.Param {
+	if len(webhook.FileRules) == 0 {
+		return []v1alpha1.Param{}
+	}
+	rulesJSON, err := json.Marshal(webhook.FileRules)
+	if err != nil {
+		logging.Log.Errorf("error marshalling filerules: %s", err)
+	}
+	return []v1alpha1.Param{{Name: "webhooks-tekton-file-rules", Value: string(rulesJSON)}}
+}
+
+// withFileRules returns the webhook's triggers, carrying its file rules, followed by the triggers of each rule
+func withFileRules(webhook webhook, triggers []v1alpha1.EventListenerTrigger) []v1alpha1.EventListenerTrigger {
+	if len(webhook.FileRules) == 0 {
+		return triggers
+	}
+	prefix := triggerPrefix(webhook)
+	// The interceptor only needs the paths of the rules, in order
+	rules := make([]fileRule, len(webhook.FileRules))
+	for i, rule := range webhook.FileRules {
+		rules[i] = fileRule{Paths: rule.Paths, Match: rule.Match}
+	}
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		logging.Log.Errorf("error marshalling filerules: %s", err)
+	}
+	rulesHeader := pipelinesv1alpha1.Param{Name: fileRulesHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: string(rulesJSON)}}
+	routed := []v1alpha1.EventListenerTrigger{}
+	for i, trigger := range triggers {
+		switch trigger.Name {
+		case prefix + "-push-event", prefix + "-pullrequest-event", prefix + "-push-canary", prefix + "-pullrequest-canary":
+			triggers[i].Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header, rulesHeader)
+		}
+		var event string
+		switch trigger.Name {
+		case prefix + "-push-event":
+			event = "push"
+		case prefix + "-pullrequest-event":
+			event = "pullrequest"
+		default:
+			continue
+		}
+		for j, rule := range webhook.FileRules {
+			// Every event matching the rule runs its pipeline, whatever the canary split
+			ruleTrigger := withoutHeaders(canaryTrigger(triggers[i], prefix+"-"+event+"-files-"+strconv.Itoa(j), rule.Pipeline+"-"+event+"-binding", rule.Pipeline+"-template"),
+				canaryRouteHeader, canaryPercentageHeader, canaryLabelHeader)
+			ruleTrigger.Interceptors[0].Webhook.Header = append(ruleTrigger.Interceptors[0].Webhook.Header,
+				pipelinesv1alpha1.Param{Name: fileRuleHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: strconv.Itoa(j)}})
+			routed = append(routed, ruleTrigger)
+		}
+	}
+	return append(triggers, routed...)
+}
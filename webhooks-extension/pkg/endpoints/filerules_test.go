@@ -0,0 +1,114 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateFileRules(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, Pipeline: "pipeline1"}
+	createTriggerResources(webhook{Pipeline: "lint"}, r)
+
+	valid := [][]fileRule{
+		nil,
+		{{Paths: []string{"docs/", "*.md"}, Pipeline: "lint"}},
+		{{Paths: []string{"src/**/*.go"}, Pipeline: "lint", Match: "any"}},
+	}
+	for _, rules := range valid {
+		hook.FileRules = rules
+		if err := r.validateFileRules(hook); err != nil {
+			t.Errorf("unexpected error for filerules %+v: %s", rules, err)
+		}
+	}
+	invalid := [][]fileRule{
+		{{Pipeline: "lint"}},
+		{{Paths: []string{"docs/"}}},
+		{{Paths: []string{""}, Pipeline: "lint"}},
+		{{Paths: []string{"[docs"}, Pipeline: "lint"}},
+		{{Paths: []string{"docs/"}, Pipeline: "lint", Match: "some"}},
+		{{Paths: []string{"docs/"}, Pipeline: "build"}},
+	}
+	for _, rules := range invalid {
+		hook.FileRules = rules
+		if err := r.validateFileRules(hook); err == nil {
+			t.Errorf("expected an error for filerules %+v", rules)
+		}
+	}
+}
+
+func TestCreateEventListenerWithFileRules(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		FileRules:        []fileRule{{Paths: []string{"docs/", "*.md"}, Pipeline: "lint"}},
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "lint"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	rules := `[{"paths":["docs/","*.md"]}]`
+	expected := map[string]string{
+		"hook-default-push-event":          "",
+		"hook-default-pullrequest-event":   "",
+		"hook-default-push-files-0":        "lint-push-binding",
+		"hook-default-pullrequest-files-0": "lint-pullrequest-binding",
+	}
+	for _, trigger := range el.Spec.Triggers {
+		binding, found := expected[trigger.Name]
+		if !found {
+			continue
+		}
+		delete(expected, trigger.Name)
+		if got := triggerHeader(trigger, fileRulesHeader); got != rules {
+			t.Errorf("trigger %s rules were %s, expected %s", trigger.Name, got, rules)
+		}
+		if binding == "" {
+			if triggerHeader(trigger, fileRuleHeader) != "" {
+				t.Errorf("trigger %s is routed a file rule's events", trigger.Name)
+			}
+			continue
+		}
+		if trigger.Template.Name != "lint-template" || trigger.Bindings[0].Ref != binding {
+			t.Errorf("file rule trigger %s uses %s and %s", trigger.Name, trigger.Template.Name, trigger.Bindings[0].Ref)
+		}
+		if triggerHeader(trigger, fileRuleHeader) != "0" {
+			t.Errorf("trigger %s is not routed the file rule's events", trigger.Name)
+		}
+		if name := triggerHeader(trigger, "Wext-Trigger-Name"); name != trigger.Name {
+			t.Errorf("file rule trigger has Wext-Trigger-Name %s", name)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("triggers %v were not created", expected)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	if !reflect.DeepEqual(hooks[0].FileRules, hook.FileRules) {
+		t.Errorf("filerules was %+v, expected %+v", hooks[0].FileRules, hook.FileRules)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+/*--------------------------------------
+A webhook may list follow-up pipelines, e.g. a deploy after a build, that
+run when one of its PipelineRuns succeeds, for push and pull request events
+alike. The extension looks for succeeded PipelineRuns of webhooks with
+follow-ups every followUpCheckInterval and creates a PipelineRun of each
+follow-up pipeline in the webhook's namespace, passing the results of the
+first run's tasks as params. The first run is annotated with the runs it
+started, so it is only followed up once, and each follow-up with the run it
+followed. Runs that completed more than followUpWindow ago are left alone
+so adding follow-ups to a webhook doesn't rerun its history. The follow-ups
+are kept as a binding param.
+---------------------------------------*/
+
+const (
+	// Set on a PipelineRun once followed up, to the comma separated names of the runs started
+	followUpsAnnotation = "webhooks.tekton.dev/followUps"
+	// Set on a follow-up PipelineRun, naming the run it followed
+	followUpOfAnnotation = "webhooks.tekton.dev/followUpOf"
+	// Most follow-ups a webhook may have
+	maxFollowUps          = 5
+	followUpCheckInterval = 30 * time.Second
+	followUpWindow        = time.Hour
+)
+
+// followUp is a pipeline run after one of a webhook's PipelineRuns succeeds
+type followUp struct {
+	Pipeline string `json:"pipeline"`
+	// Param name to <task>.<result> of the first PipelineRun, every result under its own name when empty
+	Results map[string]string `json:"results,omitempty"`
+}
+
+// followUps is a pointer in webhook as a slice would stop webhooks being comparable
+type followUps []followUp
+
+func validateFollowUps(webhook webhook) error {
+	if webhook.FollowUps == nil {
+		return nil
+	}
+	if len(*webhook.FollowUps) > maxFollowUps {
+		return fmt.Errorf("a webhook may have at most %d followups", maxFollowUps)
+	}
+	for i, next := range *webhook.FollowUps {
+		if next.Pipeline == "" {
+			return fmt.Errorf("followup %d requires a pipeline", i)
+		}
+		if next.Pipeline == webhook.Pipeline {
+			return fmt.Errorf("followup %d can't run the webhook's own pipeline %s", i, webhook.Pipeline)
+		}
+		for param, result := range next.Results {
+			if parts := strings.Split(result, "."); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("followup %d param %s must name a result as <task>.<result>, not %s", i, param, result)
+			}
+		}
+	}
+	return nil
+}
+
+// followUpParams is the binding param recording a webhook's follow-ups
+func followUpParams(webhook webhook) []v1alpha1.Param {
+	if webhook.FollowUps == nil || len(*webhook.FollowUps) == 0 {
+		return []v1alpha1.Param{}
+	}
+	followUpsJSON, err := json.Marshal(webhook.FollowUps)
+	if err != nil {
+		logging.Log.Errorf("error marshalling followups: %s", err)
+	}
+	return []v1alpha1.Param{{Name: "webhooks-tekton-followups", Value: string(followUpsJSON)}}
+}
+
+// FollowUpPipelineRuns starts the follow-ups of webhooks' succeeded PipelineRuns until stopCh is closed
+func (r Resource) FollowUpPipelineRuns(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(followUpCheckInterval)
+	defer ticker.Stop()
+	for {
+		for _, profiled := range r.allProfiles() {
+			profiled.followUpPipelineRuns(time.Now())
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// followUpPipelineRuns starts the follow-ups of the runs that succeeded within followUpWindow of now
+func (r Resource) followUpPipelineRuns(now time.Time) {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error getting webhooks to follow up: %s", err)
+		return
+	}
+	for _, hook := range hooks {
+		if hook.FollowUps == nil || len(*hook.FollowUps) == 0 {
+			continue
+		}
+		pipelineRuns, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			logging.Log.Errorf("error listing PipelineRuns in namespace %s to follow up: %s", hook.Namespace, err)
+			continue
+		}
+		for i := range pipelineRuns.Items {
+			pipelineRun := &pipelineRuns.Items[i]
+			if !isWebhookPipelineRun(*pipelineRun, hook.GitRepositoryURL, hook.Pipeline) || !needsFollowUp(*pipelineRun, now) {
+				continue
+			}
+			if err := r.followUp(pipelineRun, *hook.FollowUps); err != nil {
+				logging.Log.Errorf("error following up PipelineRun %s in namespace %s: %s", pipelineRun.Name, hook.Namespace, err)
+			}
+		}
+	}
+}
+
+func needsFollowUp(pipelineRun pipelinesv1alpha1.PipelineRun, now time.Time) bool {
+	if _, done := pipelineRun.Annotations[followUpsAnnotation]; done {
+		return false
+	}
+	condition := pipelineRun.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status != corev1.ConditionTrue || pipelineRun.Status.CompletionTime == nil {
+		return false
+	}
+	return now.Sub(pipelineRun.Status.CompletionTime.Time) <= followUpWindow
+}
+
+// followUp creates a PipelineRun of each follow-up, then records them on the run followed
+func (r Resource) followUp(pipelineRun *pipelinesv1alpha1.PipelineRun, next followUps) error {
+	started := []string{}
+	for _, f := range next {
+		created, err := r.TektonClient.TektonV1alpha1().PipelineRuns(pipelineRun.Namespace).Create(followUpRun(*pipelineRun, f))
+		if err != nil {
+			return fmt.Errorf("error creating a PipelineRun of follow-up pipeline %s: %s", f.Pipeline, err)
+		}
+		logging.Log.Infof("PipelineRun %s in namespace %s followed up by %s", pipelineRun.Name, pipelineRun.Namespace, created.Name)
+		started = append(started, created.Name)
+	}
+	if pipelineRun.Annotations == nil {
+		pipelineRun.Annotations = map[string]string{}
+	}
+	pipelineRun.Annotations[followUpsAnnotation] = strings.Join(started, ",")
+	_, err := r.TektonClient.TektonV1alpha1().PipelineRuns(pipelineRun.Namespace).Update(pipelineRun)
+	return err
+}
+
+// followUpRun is the PipelineRun of a follow-up pipeline, labelled as the run it follows so it
+// is listed against the same repository, and passed that run's results as params
+func followUpRun(pipelineRun pipelinesv1alpha1.PipelineRun, next followUp) *pipelinesv1alpha1.PipelineRun {
+	results := map[string]string{}
+	for _, taskRun := range pipelineRun.Status.TaskRuns {
+		if taskRun == nil || taskRun.Status == nil {
+			continue
+		}
+		for _, result := range taskRun.Status.TaskRunResults {
+			results[taskRun.PipelineTaskName+"."+result.Name] = result.Value
+		}
+	}
+
+	// Results written with echo end in a newline
+	params := []pipelinesv1alpha1.Param{}
+	addParam := func(name, value string) {
+		params = append(params, pipelinesv1alpha1.Param{Name: name, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: strings.TrimSpace(value)}})
+	}
+	if len(next.Results) == 0 {
+		for key, value := range results {
+			addParam(key[strings.Index(key, ".")+1:], value)
+		}
+	} else {
+		for name, result := range next.Results {
+			if value, ok := results[result]; ok {
+				addParam(name, value)
+			}
+		}
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+
+	labels := map[string]string{}
+	for key, value := range pipelineRun.Labels {
+		if strings.HasPrefix(key, "webhooks.tekton.dev/") || strings.HasPrefix(key, "triggers.tekton.dev/") {
+			labels[key] = value
+		}
+	}
+	return &pipelinesv1alpha1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: next.Pipeline + "-run-",
+			Namespace:    pipelineRun.Namespace,
+			Labels:       labels,
+			Annotations:  map[string]string{followUpOfAnnotation: pipelineRun.Name},
+		},
+		Spec: pipelinesv1alpha1.PipelineRunSpec{
+			PipelineRef:        &pipelinesv1alpha1.PipelineRef{Name: next.Pipeline},
+			Params:             params,
+			ServiceAccountName: pipelineRun.Spec.ServiceAccountName,
+		},
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	pipelinesv1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateFollowUps(t *testing.T) {
+	valid := []*followUps{
+		nil,
+		{{Pipeline: "deploy"}},
+		{{Pipeline: "deploy", Results: map[string]string{"image": "build.image-digest"}}},
+	}
+	for _, next := range valid {
+		if err := validateFollowUps(webhook{Pipeline: "build", FollowUps: next}); err != nil {
+			t.Errorf("unexpected error for followups %+v: %s", next, err)
+		}
+	}
+	invalid := []*followUps{
+		{{}},
+		{{Pipeline: "build"}},
+		{{Pipeline: "deploy", Results: map[string]string{"image": "image-digest"}}},
+		{{Pipeline: "a"}, {Pipeline: "b"}, {Pipeline: "c"}, {Pipeline: "d"}, {Pipeline: "e"}, {Pipeline: "f"}},
+	}
+	for _, next := range invalid {
+		if err := validateFollowUps(webhook{Pipeline: "build", FollowUps: next}); err == nil {
+			t.Errorf("expected an error for followups %+v", next)
+		}
+	}
+}
+
+func followUpPipelineRun(name string, completed time.Time) pipelinesv1alpha1.PipelineRun {
+	pipelineRun := statsPipelineRun(name, corev1.ConditionTrue, 10, completed)
+	pipelineRun.Namespace = installNs
+	pipelineRun.Labels["triggers.tekton.dev/triggers-eventid"] = "event1"
+	pipelineRun.Labels["app"] = "build"
+	pipelineRun.Spec.ServiceAccountName = "builder"
+	pipelineRun.Status.TaskRuns = map[string]*pipelinesv1alpha1.PipelineRunTaskRunStatus{
+		name + "-build": {
+			PipelineTaskName: "build",
+			Status: &pipelinesv1alpha1.TaskRunStatus{
+				TaskRunStatusFields: pipelinesv1beta1.TaskRunStatusFields{
+					TaskRunResults: []pipelinesv1beta1.TaskRunResult{
+						{Name: "image-digest", Value: "sha256:abc\n"},
+						{Name: "tag", Value: "v1"},
+					},
+				},
+			},
+		},
+	}
+	return pipelineRun
+}
+
+func TestFollowUpRun(t *testing.T) {
+	first := followUpPipelineRun("run1", time.Now())
+
+	run := followUpRun(first, followUp{Pipeline: "deploy"})
+	expected := []pipelinesv1alpha1.Param{
+		{Name: "image-digest", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "sha256:abc"}},
+		{Name: "tag", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "v1"}},
+	}
+	if !reflect.DeepEqual(run.Spec.Params, expected) {
+		t.Errorf("params were %+v, expected %+v", run.Spec.Params, expected)
+	}
+	if run.Spec.PipelineRef.Name != "deploy" || run.Spec.ServiceAccountName != "builder" || run.GenerateName != "deploy-run-" {
+		t.Errorf("unexpected follow-up %+v", run)
+	}
+	if run.Annotations[followUpOfAnnotation] != "run1" || run.Labels["webhooks.tekton.dev/gitRepo"] != "repo" ||
+		run.Labels["triggers.tekton.dev/triggers-eventid"] != "event1" || run.Labels["app"] != "" {
+		t.Errorf("unexpected follow-up metadata %+v", run.ObjectMeta)
+	}
+
+	run = followUpRun(first, followUp{Pipeline: "deploy", Results: map[string]string{"image": "build.image-digest", "missing": "test.result"}})
+	expected = []pipelinesv1alpha1.Param{
+		{Name: "image", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "sha256:abc"}},
+	}
+	if !reflect.DeepEqual(run.Spec.Params, expected) {
+		t.Errorf("mapped params were %+v, expected %+v", run.Spec.Params, expected)
+	}
+}
+
+func TestFollowUpPipelineRuns(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+		FollowUps:        &followUps{{Pipeline: "deploy"}},
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 || !reflect.DeepEqual(hooks[0].FollowUps, hook.FollowUps) {
+		t.Fatalf("followups not kept on the webhook, got %+v, %v", hooks, err)
+	}
+
+	now := time.Now()
+	runs := []pipelinesv1alpha1.PipelineRun{
+		followUpPipelineRun("recent", now.Add(-time.Minute)),
+		followUpPipelineRun("old", now.Add(-2*followUpWindow)),
+	}
+	for _, run := range runs {
+		if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Create(&run); err != nil {
+			t.Fatalf("error creating pipelinerun: %s", err)
+		}
+	}
+
+	r.followUpPipelineRuns(now)
+	r.followUpPipelineRuns(now)
+
+	list, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("error listing pipelineruns: %s", err)
+	}
+	followed := 0
+	for _, run := range list.Items {
+		switch {
+		case run.Spec.PipelineRef.Name == "deploy":
+			followed++
+			if run.Annotations[followUpOfAnnotation] != "recent" {
+				t.Errorf("follow-up %+v of the wrong run", run.ObjectMeta)
+			}
+		case run.Name == "recent":
+			if _, ok := run.Annotations[followUpsAnnotation]; !ok {
+				t.Error("recent run not annotated with its follow-ups")
+			}
+		case run.Name == "old":
+			if _, ok := run.Annotations[followUpsAnnotation]; ok {
+				t.Error("old run followed up")
+			}
+		}
+	}
+	if followed != 1 {
+		t.Errorf("expected one follow-up PipelineRun, got %d", followed)
+	}
+}
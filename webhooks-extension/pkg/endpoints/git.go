@@ -29,8 +29,33 @@ type GitWebhook interface {
 
 type GitProvider interface {
 	AddWebhook(hook webhook) error
+	UpdateWebhook(existing GitWebhook, hook webhook, callbackURL string) error
 	DeleteWebhook(hook GitWebhook) error
 	GetAllWebhooks() ([]GitWebhook, error)
+	// Used by the monitor controller, see monitorcontroller.go
+	SetCommitStatus(sha string, status commitStatus) error
+	CommentOnPullRequest(number int, body string) error
+	// Used to read webhook manifests, see manifest.go
+	GetFile(path string) ([]byte, error)
+	// Used to discover pipelines, see discover.go
+	ListFiles(dir string) ([]string, error)
+	// Used to find the branch webhooks run their mainbranchpipeline for, see defaultbranch.go
+	DefaultBranch() (string, error)
+	// Used to check the access token can do an operation before trying it, see tokenscopes.go
+	CheckTokenScope(operation string) error
+}
+
+// errFileNotFound is returned by GetFile for a file the repository's default branch doesn't have,
+// or by ListFiles for a directory it doesn't have
+var errFileNotFound = errors.New("file not found")
+
+// commitStatus is a status reported on a commit
+type commitStatus struct {
+	// pending, success, failure or error
+	State       string
+	Context     string
+	Description string
+	TargetURL   string
 }
 
 // AddWebhook : attempts to add a webhook
@@ -43,15 +68,46 @@ func (r Resource) RemoveWebhook(hook webhook, org, repo string) (err error) {
 	return addOrRemoveWebhook(hook, org, repo, "remove", r)
 }
 
+// MigrateWebhook : points the provider webhook registered against oldURL at newURL instead
+func (r Resource) MigrateWebhook(hook webhook, org, repo, oldURL, newURL string) error {
+	gitProvider, err := r.createGitProviderForWebhook(hook, org, repo)
+	if err != nil {
+		return err
+	}
+	if err := gitProvider.CheckTokenScope(operationHooks); err != nil {
+		return err
+	}
+
+	existing, err := getWebhookWithURL(gitProvider, oldURL)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		migrated, err := getWebhookWithURL(gitProvider, newURL)
+		if err != nil {
+			return err
+		}
+		if migrated != nil {
+			logging.Log.Infof("Webhook for %s/%s already uses callback %s", org, repo, newURL)
+			return nil
+		}
+		return fmt.Errorf("no webhook registered against callback %s found for %s/%s", oldURL, org, repo)
+	}
+	return gitProvider.UpdateWebhook(existing, hook, newURL)
+}
+
 func addOrRemoveWebhook(hook webhook, org, repo, action string, r Resource) (err error) {
 	// Configure the Git Provider
 	gitProvider, err := r.createGitProviderForWebhook(hook, org, repo)
 	if err != nil {
 		return err
 	}
+	if err := gitProvider.CheckTokenScope(operationHooks); err != nil {
+		return err
+	}
 
 	// Get webhook
-	webhook, err := getWebhook(gitProvider)
+	webhook, err := getWebhookWithURL(gitProvider, hookCallbackURL(r, hook))
 	if err != nil {
 		return err
 	}
@@ -77,11 +133,7 @@ func addOrRemoveWebhook(hook webhook, org, repo, action string, r Resource) (err
 // Create the GitProvider for the webhookData
 func (r Resource) createGitProviderForWebhook(hook webhook, org, reponame string) (GitProvider, error) {
 	// Get extra git option to skip ssl verification
-	sslVerify := true
-	ssl := os.Getenv("SSL_VERIFICATION_ENABLED")
-	if strings.ToLower(ssl) == "false" {
-		sslVerify = false
-	}
+	sslVerify := r.Install.sslVerification()
 
 	logging.Log.Debugf("Webhook SSL verification: %v", sslVerify)
 
@@ -90,30 +142,81 @@ func (r Resource) createGitProviderForWebhook(hook webhook, org, reponame string
 		return nil, err
 	}
 
+	// Offline development, see offline.go
+	recordingPath := ""
+	if mode := getProviderMode(); mode == providerModeRecord || mode == providerModeReplay {
+		if recordingPath, err = getRecordingPath(strings.ToLower(gitType), org, reponame); err != nil {
+			return nil, err
+		}
+	}
+	if getProviderMode() == providerModeReplay {
+		logging.Log.Debugf("Replaying webhooks for %s/%s from %s", org, reponame, recordingPath)
+		return replayProvider{Resource: r, Path: recordingPath}, nil
+	}
+
 	// Determine which GitProvider to use
 	switch {
 	// GITHUB
 	case strings.EqualFold(gitType, "github"):
-		return r.initGitHub(sslVerify, api, hook.AccessTokenRef, org, reponame)
+		gitHub, err := r.initGitHub(sslVerify, api, hook.AccessTokenRef, org, reponame)
+		if err != nil {
+			return nil, err
+		}
+		return withRecording(gitHub, recordingPath), nil
 	// GITLAB
 	case strings.EqualFold(gitType, "gitlab"):
-		return r.initGitLab(sslVerify, api, hook.AccessTokenRef, org, reponame)
+		gitLab, err := r.initGitLab(sslVerify, api, hook.AccessTokenRef, org, reponame)
+		if err != nil {
+			return nil, err
+		}
+		return withRecording(gitLab, recordingPath), nil
+	// BITBUCKET CLOUD
+	case strings.EqualFold(gitType, "bitbucket"):
+		bitbucket, err := r.initBitbucket(sslVerify, api, hook.AccessTokenRef, org, reponame)
+		if err != nil {
+			return nil, err
+		}
+		return withRecording(bitbucket, recordingPath), nil
+	// GITEA AND GOGS
+	case strings.EqualFold(gitType, "gitea"):
+		gitea, err := r.initGitea(sslVerify, api, hook.AccessTokenRef, org, reponame)
+		if err != nil {
+			return nil, err
+		}
+		return withRecording(gitea, recordingPath), nil
 	default:
 		msg := fmt.Sprintf("Git Provider for project URL: %s not recognized", hook.GitRepositoryURL)
 		return nil, errors.New(msg)
 	}
 }
 
-// Get the webhook (returns nil, nil if no webhook is found)
-func getWebhook(gitProvider GitProvider) (GitWebhook, error) {
+// Get the webhook registered against callbackURL (returns nil, nil if no webhook is found)
+func getWebhookWithURL(gitProvider GitProvider, callbackURL string) (GitWebhook, error) {
 	hooks, err := gitProvider.GetAllWebhooks()
 	if err != nil {
 		return nil, err
 	}
 	for _, hook := range hooks {
-		if os.Getenv("WEBHOOK_CALLBACK_URL") == hook.GetURL() {
+		if callbackURL == hook.GetURL() {
 			return hook, nil
 		}
 	}
 	return nil, nil
 }
+
+// getCallbackURL returns the URL provider webhooks are registered against.
+// WEBHOOK_CALLBACK_URL takes precedence as it is updated in place when the
+// callback is migrated, Defaults only holds the value seen at startup.
+func getCallbackURL(r Resource) string {
+	if r.Defaults.Profile != "" {
+		return r.Defaults.CallbackURL
+	}
+	// Providers deliver to the relay channel, see relay.go
+	if r.relayed() {
+		return r.Defaults.RelayURL
+	}
+	if callback := os.Getenv("WEBHOOK_CALLBACK_URL"); callback != "" {
+		return callback
+	}
+	return r.Defaults.CallbackURL
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+The clients calling the git providers' APIs are set up the same way for
+each provider, from <PROVIDER>_API_TIMEOUT, <PROVIDER>_API_MAX_RETRIES and
+<PROVIDER>_API_PAGE_SIZE where <PROVIDER> is GITHUB, GITLAB, BITBUCKET or
+GITEA. Listings, such as a repository's webhooks, fetch every page,
+pagesize items at a time. GET and HEAD requests failing with a network
+error, a 429 or a 5xx are retried after gitAPIRetryBackoff, doubling each
+time; other requests may have taken effect so are not.
+---------------------------------------*/
+
+const (
+	defaultGitAPITimeout    = 30 * time.Second
+	defaultGitAPIMaxRetries = 3
+	defaultGitAPIPageSize   = 100
+)
+
+var gitAPIRetryBackoff = time.Second
+
+// gitAPISettings configure the HTTP client for a git provider's API
+type gitAPISettings struct {
+	// A duration, e.g. 30s
+	Timeout    string `json:"timeout"`
+	MaxRetries int    `json:"maxretries"`
+	PageSize   int    `json:"pagesize"`
+}
+
+// getGitAPISettings reads the settings for provider (github, gitlab, bitbucket or gitea) from the environment
+func getGitAPISettings(provider string) gitAPISettings {
+	prefix := strings.ToUpper(provider) + "_API_"
+	settings := gitAPISettings{
+		Timeout:    defaultGitAPITimeout.String(),
+		MaxRetries: defaultGitAPIMaxRetries,
+		PageSize:   defaultGitAPIPageSize,
+	}
+	if value := os.Getenv(prefix + "TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			settings.Timeout = timeout.String()
+		} else {
+			logging.Log.Errorf("ignoring %sTIMEOUT %s, expected a duration such as 30s", prefix, value)
+		}
+	}
+	if value := os.Getenv(prefix + "MAX_RETRIES"); value != "" {
+		if retries, err := strconv.Atoi(value); err == nil && retries >= 0 {
+			settings.MaxRetries = retries
+		} else {
+			logging.Log.Errorf("ignoring %sMAX_RETRIES %s, expected a number", prefix, value)
+		}
+	}
+	if value := os.Getenv(prefix + "PAGE_SIZE"); value != "" {
+		if size, err := strconv.Atoi(value); err == nil && size > 0 {
+			settings.PageSize = size
+		} else {
+			logging.Log.Errorf("ignoring %sPAGE_SIZE %s, expected a number", prefix, value)
+		}
+	}
+	return settings
+}
+
+func setGitAPIDefaults(defaults *EnvDefaults) {
+	defaults.GitHubAPI = getGitAPISettings("github")
+	defaults.GitLabAPI = getGitAPISettings("gitlab")
+	defaults.BitbucketAPI = getGitAPISettings("bitbucket")
+	defaults.GiteaAPI = getGitAPISettings("gitea")
+}
+
+// gitAPI returns the settings for provider, defaulting any not set
+func (r Resource) gitAPI(provider string) gitAPISettings {
+	settings := r.Defaults.GitHubAPI
+	if strings.EqualFold(provider, "gitlab") {
+		settings = r.Defaults.GitLabAPI
+	} else if strings.EqualFold(provider, "bitbucket") {
+		settings = r.Defaults.BitbucketAPI
+	} else if strings.EqualFold(provider, "gitea") {
+		settings = r.Defaults.GiteaAPI
+	}
+	if _, err := time.ParseDuration(settings.Timeout); err != nil {
+		settings.Timeout = defaultGitAPITimeout.String()
+	}
+	if settings.PageSize <= 0 {
+		settings.PageSize = defaultGitAPIPageSize
+	}
+	if settings.MaxRetries < 0 {
+		settings.MaxRetries = 0
+	}
+	return settings
+}
+
+// withGitAPISettings returns a copy of client with the timeout and retries of settings
+func withGitAPISettings(client *http.Client, settings gitAPISettings) *http.Client {
+	configured := &http.Client{}
+	if client != nil {
+		*configured = *client
+	}
+	configured.Timeout, _ = time.ParseDuration(settings.Timeout)
+	base := configured.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	configured.Transport = &retryTransport{Base: base, MaxRetries: settings.MaxRetries}
+	return configured
+}
+
+// retryTransport retries GET and HEAD requests that fail in a way that may be temporary
+type retryTransport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return resp, err
+	}
+	backoff := gitAPIRetryBackoff
+	for attempt := 1; attempt <= t.MaxRetries && shouldRetry(resp, err); attempt++ {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		logging.Log.Debugf("retrying %s %s (attempt %d of %d)", req.Method, req.URL.Path, attempt, t.MaxRetries)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff = backoff * 2
+		resp, err = t.Base.RoundTrip(req)
+	}
+	return resp, err
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	github "github.com/google/go-github/github"
+)
+
+func TestGetGitAPISettings(t *testing.T) {
+	os.Setenv("GITLAB_API_TIMEOUT", "2m")
+	os.Setenv("GITLAB_API_MAX_RETRIES", "0")
+	os.Setenv("GITLAB_API_PAGE_SIZE", "not a number")
+	defer os.Unsetenv("GITLAB_API_TIMEOUT")
+	defer os.Unsetenv("GITLAB_API_MAX_RETRIES")
+	defer os.Unsetenv("GITLAB_API_PAGE_SIZE")
+
+	defaults := EnvDefaults{}
+	setGitAPIDefaults(&defaults)
+	if defaults.GitHubAPI != (gitAPISettings{Timeout: "30s", MaxRetries: 3, PageSize: 100}) {
+		t.Errorf("unexpected github settings %+v", defaults.GitHubAPI)
+	}
+	if defaults.GitLabAPI != (gitAPISettings{Timeout: "2m0s", MaxRetries: 0, PageSize: 100}) {
+		t.Errorf("unexpected gitlab settings %+v", defaults.GitLabAPI)
+	}
+
+	// Settings missing from the defaults, as in tests, are defaulted
+	r := dummyResource()
+	if settings := r.gitAPI("gitlab"); settings.Timeout != "30s" || settings.PageSize != 100 {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	defer func(backoff time.Duration) { gitAPIRetryBackoff = backoff }(gitAPIRetryBackoff)
+	gitAPIRetryBackoff = time.Millisecond
+
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.Method]++
+		if calls[r.Method] < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	client := withGitAPISettings(nil, gitAPISettings{Timeout: "5s", MaxRetries: 3})
+	if client.Timeout != 5*time.Second {
+		t.Errorf("timeout was %s", client.Timeout)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusOK || calls[http.MethodGet] != 3 {
+		t.Errorf("expected the GET to succeed on the third call, got %v, %v after %d calls", resp, err, calls[http.MethodGet])
+	}
+	resp, err = client.Post(server.URL, "application/json", nil)
+	if err != nil || resp.StatusCode != http.StatusBadGateway || calls[http.MethodPost] != 1 {
+		t.Errorf("expected the POST not to be retried, got %v, %v after %d calls", resp, err, calls[http.MethodPost])
+	}
+}
+
+func TestGitHubGetAllWebhooksPages(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("per_page") != "2" {
+			t.Errorf("expected a page size of 2, got %s", r.URL.RawQuery)
+		}
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/owner/repo/hooks?page=2&per_page=2>; rel="next"`, server.URL))
+			fmt.Fprint(w, `[{"id": 1}, {"id": 2}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id": 3}]`)
+		}
+	}))
+	defer server.Close()
+
+	client := github.NewClient(withGitAPISettings(nil, gitAPISettings{Timeout: "5s"}))
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	gh := GitHub{Client: client, Context: context.Background(), Org: "owner", Repo: "repo", PageSize: 2}
+	hooks, err := gh.GetAllWebhooks()
+	if err != nil {
+		t.Fatalf("error listing webhooks: %s", err)
+	}
+	if len(hooks) != 3 || hooks[2].GetID() != 3 {
+		t.Errorf("expected the webhooks from both pages, got %+v", hooks)
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	utils "github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+)
+
+/*--------------------------------------
+Repositories on self-hosted Gitea and Gogs servers, hosts with gitea or
+gogs in their name or listed in GITEA_HOSTS, have their webhooks managed
+through the server's API at https://<host>/api/v1/, the same on both. The
+access token secret holds an access token as accessToken, sent as
+"Authorization: token" as both accept, or a username and password.
+Webhooks are created with the gogs type, which Gitea sends as it sends its
+own, and the secret token, the server signing deliveries with it in the
+X-Gitea-Signature or X-Gogs-Signature header. They subscribe to the push
+and pull_request events, named as on GitHub. Gogs has no commit statuses,
+so the monitor's statuses fail there.
+---------------------------------------*/
+
+// giteaHookEvents are the events Gitea and Gogs webhooks are registered for
+var giteaHookEvents = []string{"push", "pull_request"}
+
+type Gitea struct {
+	Client   *http.Client
+	APIURL   string
+	Owner    string
+	Repo     string
+	Secret   string
+	PageSize int
+	Resource Resource
+}
+
+type GiteaWebhook struct {
+	Hook giteaHook
+}
+
+// giteaHook is a webhook as the Gitea and Gogs APIs have it
+type giteaHook struct {
+	ID     int               `json:"id,omitempty"`
+	Type   string            `json:"type,omitempty"`
+	Config map[string]string `json:"config"`
+	Events []string          `json:"events"`
+	Active bool              `json:"active"`
+}
+
+// giteaError is a failed call to the Gitea or Gogs API
+type giteaError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *giteaError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+func (r Resource) initGitea(sslVerify bool, apiURL, secret, owner, repo string) (*Gitea, error) {
+	// Access token is stored as 'accessToken', or 'username' and 'password' for basic authentication
+	creds, err := utils.GetGitCredentials(r.K8sClient, r.Defaults.Namespace, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := r.gitTLSConfig(sslVerify, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	tc := utils.CreateTokenAuthClient(creds.AccessToken, tlsConfig)
+	if creds.Username != "" {
+		tc = utils.CreateBasicAuthClient(creds.Username, creds.Password, tlsConfig)
+	}
+	settings := r.gitAPI("gitea")
+	return &Gitea{
+		Client:   withGitAPISettings(tc, settings),
+		APIURL:   strings.TrimSuffix(apiURL, "/"),
+		Owner:    owner,
+		Repo:     repo,
+		Secret:   secret,
+		PageSize: settings.PageSize,
+		Resource: r,
+	}, nil
+}
+
+// repoPath is the API path of the repository, followed by path
+func (gt Gitea) repoPath(path string) string {
+	return gt.APIURL + "/repos/" + url.PathEscape(gt.Owner) + "/" + url.PathEscape(gt.Repo) + path
+}
+
+// do calls the API, decoding the response into result unless it's nil
+func (gt Gitea) do(method, address string, body, result interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, address, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := gt.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode >= 300 {
+		message := struct {
+			Message string `json:"message"`
+		}{}
+		json.Unmarshal(data, &message)
+		if message.Message == "" {
+			message.Message = http.StatusText(resp.StatusCode)
+		}
+		return resp, &giteaError{StatusCode: resp.StatusCode, Message: message.Message}
+	}
+	if result == nil {
+		return resp, nil
+	}
+	if raw, ok := result.(*[]byte); ok {
+		*raw = data
+		return resp, nil
+	}
+	return resp, json.Unmarshal(data, result)
+}
+
+func (gt Gitea) GetAllWebhooks() ([]GitWebhook, error) {
+	webhooks := []GitWebhook{}
+	seen := map[int]bool{}
+	// Gogs doesn't page, answering every page with all the webhooks, so paging stops once a page has none new
+	for page := 1; ; page++ {
+		hooks := []giteaHook{}
+		address := gt.repoPath("/hooks") + "?page=" + strconv.Itoa(page) + "&limit=" + strconv.Itoa(gt.PageSize)
+		if _, err := gt.do(http.MethodGet, address, nil, &hooks); err != nil {
+			return nil, gt.translateError("list", "", err)
+		}
+		added := 0
+		for _, hook := range hooks {
+			if !seen[hook.ID] {
+				seen[hook.ID] = true
+				webhooks = append(webhooks, GiteaWebhook{Hook: hook})
+				added++
+			}
+		}
+		if added == 0 || len(hooks) < gt.PageSize {
+			return webhooks, nil
+		}
+	}
+}
+
+func (gt Gitea) AddWebhook(hook webhook) error {
+	callback := hookCallbackURL(gt.Resource, hook)
+	hookDefinition, err := gt.hookDefinition(hook, callback)
+	if err != nil {
+		return err
+	}
+	hookDefinition.Type = "gogs"
+	_, err = gt.do(http.MethodPost, gt.repoPath("/hooks"), hookDefinition, nil)
+	return gt.translateError("create", callback, err)
+}
+
+func (gt Gitea) UpdateWebhook(existing GitWebhook, hook webhook, callbackURL string) error {
+	hookDefinition, err := gt.hookDefinition(hook, callbackURL)
+	if err != nil {
+		return err
+	}
+	_, err = gt.do(http.MethodPatch, gt.repoPath("/hooks/"+strconv.Itoa(existing.GetID())), hookDefinition, nil)
+	return gt.translateError("update", callbackURL, err)
+}
+
+// hookDefinition builds the Gitea webhook pointing at callbackURL, used for both creation and updates
+func (gt Gitea) hookDefinition(hook webhook, callbackURL string) (giteaHook, error) {
+	_, secretToken, err := utils.GetWebhookSecretTokens(gt.Resource.K8sClient, gt.Resource.Defaults.Namespace, hook.AccessTokenRef)
+	if err != nil {
+		return giteaHook{}, err
+	}
+	return giteaHook{
+		Config: map[string]string{
+			"url":          callbackURL,
+			"content_type": "json",
+			"secret":       secretToken,
+		},
+		Events: giteaHookEvents,
+		Active: true,
+	}, nil
+}
+
+func (gt Gitea) DeleteWebhook(hook GitWebhook) error {
+	_, err := gt.do(http.MethodDelete, gt.repoPath("/hooks/"+strconv.Itoa(hook.GetID())), nil, nil)
+	return gt.translateError("delete", hook.GetURL(), err)
+}
+
+// translateError translates the failure of a webhook call, see providererrors.go
+func (gt Gitea) translateError(action, callbackURL string, err error) error {
+	if err == nil {
+		return nil
+	}
+	call := providerCall{provider: "Gitea", repository: gt.Owner + "/" + gt.Repo, secret: gt.Secret, action: action, callbackURL: callbackURL}
+	return translateGiteaError(call, err)
+}
+
+func (gt Gitea) SetCommitStatus(sha string, status commitStatus) error {
+	giteaStatus := map[string]string{
+		"state":       status.State,
+		"context":     status.Context,
+		"description": status.Description,
+		"target_url":  status.TargetURL,
+	}
+	_, err := gt.do(http.MethodPost, gt.repoPath("/statuses/"+url.PathEscape(sha)), giteaStatus, nil)
+	return err
+}
+
+func (gt Gitea) CommentOnPullRequest(number int, body string) error {
+	// Pull requests are commented on as the issues they are
+	comment := map[string]string{"body": body}
+	_, err := gt.do(http.MethodPost, gt.repoPath("/issues/"+strconv.Itoa(number)+"/comments"), comment, nil)
+	return err
+}
+
+// GetFile reads path from the repository's default branch
+func (gt Gitea) GetFile(path string) ([]byte, error) {
+	branch, err := gt.DefaultBranch()
+	if err != nil {
+		return nil, err
+	}
+	content := []byte{}
+	resp, err := gt.do(http.MethodGet, gt.repoPath("/raw/"+url.PathEscape(branch)+"/"+strings.TrimPrefix(path, "/")), nil, &content)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, errFileNotFound
+	}
+	return content, err
+}
+
+// DefaultBranch returns the name of the repository's default branch
+func (gt Gitea) DefaultBranch() (string, error) {
+	repository := struct {
+		DefaultBranch string `json:"default_branch"`
+	}{}
+	if _, err := gt.do(http.MethodGet, gt.repoPath(""), nil, &repository); err != nil {
+		return "", err
+	}
+	return repository.DefaultBranch, nil
+}
+
+func (gt Gitea) ListFiles(dir string) ([]string, error) {
+	branch, err := gt.DefaultBranch()
+	if err != nil {
+		return nil, err
+	}
+	entries := []struct {
+		Type string `json:"type"`
+		Path string `json:"path"`
+	}{}
+	address := gt.repoPath("/contents/"+strings.Trim(dir, "/")) + "?ref=" + url.QueryEscape(branch)
+	resp, err := gt.do(http.MethodGet, address, nil, &entries)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, errFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, entry := range entries {
+		if entry.Type == "file" {
+			files = append(files, entry.Path)
+		}
+	}
+	return files, nil
+}
+
+// Gitea Webhook -----------------------------------------------------------------------------------------------------
+func (gtWebhook GiteaWebhook) GetID() int {
+	return gtWebhook.Hook.ID
+}
+
+func (gtWebhook GiteaWebhook) GetURL() string {
+	return gtWebhook.Hook.Config["url"]
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGiteaWebhooks(t *testing.T) {
+	hooks := map[int]giteaHook{7: {ID: 7, Type: "gitea", Config: map[string]string{"url": "http://old.example.com"}}}
+	var updated giteaHook
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/repos/owner/repo/hooks":
+			// Answers every page with all the webhooks, as Gogs does
+			values := []giteaHook{}
+			for _, hook := range hooks {
+				values = append(values, hook)
+			}
+			json.NewEncoder(w).Encode(values)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/repos/owner/repo/hooks":
+			hook := giteaHook{}
+			json.NewDecoder(r.Body).Decode(&hook)
+			hook.ID = 8
+			hooks[hook.ID] = hook
+			json.NewEncoder(w).Encode(hook)
+		case r.Method == http.MethodPatch && r.URL.Path == "/api/v1/repos/owner/repo/hooks/7":
+			json.NewDecoder(r.Body).Decode(&updated)
+			json.NewEncoder(w).Encode(updated)
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/v1/repos/owner/repo/hooks/7":
+			delete(hooks, 7)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "The target couldn't be found."}`)
+		}
+	}))
+	defer server.Close()
+
+	r := dummyResource()
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "gitea-token", Namespace: installNs},
+		Data:       map[string][]byte{"accessToken": []byte("access"), "secretToken": []byte("secret")},
+	}
+	if _, err := r.K8sClient.CoreV1().Secrets(installNs).Create(&secret); err != nil {
+		t.Fatalf("error creating secret: %s", err)
+	}
+	gt, err := r.initGitea(false, server.URL+"/api/v1/", "gitea-token", "owner", "repo")
+	if err != nil {
+		t.Fatalf("error creating client: %s", err)
+	}
+	gt.PageSize = 1
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://gitea.example.com/owner/repo", AccessTokenRef: "gitea-token"}
+
+	if err := gt.AddWebhook(hook); err != nil {
+		t.Fatalf("error adding webhook: %s", err)
+	}
+	created := hooks[8]
+	if created.Type != "gogs" || created.Config["url"] != hookCallbackURL(*r, hook) || created.Config["secret"] != "secret" || !created.Active {
+		t.Errorf("unexpected webhook %+v", created)
+	}
+
+	found, err := gt.GetAllWebhooks()
+	if err != nil || len(found) != 2 {
+		t.Fatalf("expected both webhooks, got %v, %v", found, err)
+	}
+	for _, existing := range found {
+		if existing.GetID() != 7 {
+			continue
+		}
+		if err := gt.UpdateWebhook(existing, hook, "https://new.example.com"); err != nil {
+			t.Fatalf("error updating webhook: %s", err)
+		}
+		if updated.Config["url"] != "https://new.example.com" || updated.Config["secret"] != "secret" {
+			t.Errorf("unexpected update %+v", updated)
+		}
+		if err := gt.DeleteWebhook(existing); err != nil {
+			t.Fatalf("error deleting webhook: %s", err)
+		}
+	}
+	if _, ok := hooks[7]; ok {
+		t.Error("expected the webhook to be deleted")
+	}
+
+	gt.Repo = "missing"
+	err = gt.AddWebhook(hook)
+	if coded, ok := err.(messageError); !ok || coded.code != "GITEA_HOOK_PERMISSION" {
+		t.Errorf("expected a GITEA_HOOK_PERMISSION error, got %v", err)
+	}
+}
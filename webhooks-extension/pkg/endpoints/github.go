@@ -15,11 +15,12 @@ package endpoints
 
 import (
 	"context"
+	"fmt"
 	github "github.com/google/go-github/github"
 	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
 	utils "github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	"net/http"
 	"net/url"
-	"os"
 )
 
 type GitHub struct {
@@ -27,7 +28,9 @@ type GitHub struct {
 	Context   context.Context
 	Org       string
 	Repo      string
+	Secret    string
 	SSLVerify bool
+	PageSize  int
 	Resource  Resource
 }
 
@@ -37,16 +40,24 @@ type GitHubWebhook struct {
 
 // GitHub GitProvider ----------------------------------------------------------------------------------------------------
 func (r Resource) initGitHub(sslVerify bool, apiURL, secret, org, repo string) (*GitHub, error) {
-	// Access token is stored as 'accessToken' and secret as 'secretToken'
-	accessToken, _, err := utils.GetWebhookSecretTokens(r.K8sClient, r.Defaults.Namespace, secret)
+	// Access token is stored as 'accessToken', or 'username' and 'password' for basic authentication
+	creds, err := utils.GetGitCredentials(r.K8sClient, r.Defaults.Namespace, secret)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create the client
 	ctx := context.Background()
-	tc := utils.CreateOAuth2Client(ctx, accessToken, sslVerify)
-	client := github.NewClient(tc)
+	tlsConfig, err := r.gitTLSConfig(sslVerify, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	tc := utils.CreateOAuth2Client(ctx, creds.AccessToken, tlsConfig)
+	if creds.Username != "" {
+		tc = utils.CreateBasicAuthClient(creds.Username, creds.Password, tlsConfig)
+	}
+	settings := r.gitAPI("github")
+	client := github.NewClient(withGitAPISettings(tc, settings))
 
 	// Set api base url
 	ghURL, err := url.Parse(apiURL)
@@ -55,14 +66,36 @@ func (r Resource) initGitHub(sslVerify bool, apiURL, secret, org, repo string) (
 	}
 	client.BaseURL = ghURL
 
-	return &GitHub{Client: client, Context: ctx, Org: org, Repo: repo, SSLVerify: sslVerify, Resource: r}, nil
+	return &GitHub{Client: client, Context: ctx, Org: org, Repo: repo, Secret: secret, SSLVerify: sslVerify, PageSize: settings.PageSize, Resource: r}, nil
 }
 
 func (gh GitHub) AddWebhook(hook webhook) error {
-	_, secretToken, err := utils.GetWebhookSecretTokens(gh.Resource.K8sClient, gh.Resource.Defaults.Namespace, hook.AccessTokenRef)
+	hookDefinition, err := gh.hookDefinition(hook, hookCallbackURL(gh.Resource, hook))
+	if err != nil {
+		return err
+	}
+	// Create webhook
+	_, _, err = gh.Client.Repositories.CreateHook(gh.Context, gh.Org, gh.Repo, hookDefinition)
+	return gh.translateError("create", hookCallbackURL(gh.Resource, hook), err)
+}
+
+func (gh GitHub) UpdateWebhook(existing GitWebhook, hook webhook, callbackURL string) error {
+	hookDefinition, err := gh.hookDefinition(hook, callbackURL)
 	if err != nil {
 		return err
 	}
+	// The whole config is replaced on edit, so the secret is sent again
+	_, _, err = gh.Client.Repositories.EditHook(gh.Context, gh.Org, gh.Repo, int64(existing.GetID()), hookDefinition)
+	return gh.translateError("update", callbackURL, err)
+}
+
+// hookDefinition builds the GitHub hook pointing at callbackURL, used for both
+// creation and updates
+func (gh GitHub) hookDefinition(hook webhook, callbackURL string) (*github.Hook, error) {
+	_, secretToken, err := utils.GetWebhookSecretTokens(gh.Resource.K8sClient, gh.Resource.Defaults.Namespace, hook.AccessTokenRef)
+	if err != nil {
+		return nil, err
+	}
 	ssl := 0
 	if !gh.SSLVerify {
 		ssl = 1
@@ -70,37 +103,108 @@ func (gh GitHub) AddWebhook(hook webhook) error {
 
 	// Specify webhook options
 	cfg := make(map[string]interface{})
-	cfg["url"] = os.Getenv("WEBHOOK_CALLBACK_URL")
+	cfg["url"] = callbackURL
 	cfg["insecure_ssl"] = ssl
 	cfg["secret"] = secretToken
 	cfg["content_type"] = "json"
-	events := []string{"push", "pull_request"}
+	// Repository events tell the interceptor when the default branch changes, see defaultbranch.go
+	events := []string{"push", "pull_request", "repository"}
 	active := true
-	hookDefinition := &github.Hook{
+	return &github.Hook{
 		Config: cfg,
 		Events: events,
 		Active: &active,
-	}
-	// Create webhook
-	_, _, err = gh.Client.Repositories.CreateHook(gh.Context, gh.Org, gh.Repo, hookDefinition)
-	return err
+	}, nil
 }
 
 func (gh GitHub) DeleteWebhook(hook GitWebhook) error {
 	_, err := gh.Client.Repositories.DeleteHook(gh.Context, gh.Org, gh.Repo, int64(hook.GetID()))
-	return err
+	return gh.translateError("delete", hook.GetURL(), err)
+}
+
+// translateError translates the failure of a webhook call, see providererrors.go
+func (gh GitHub) translateError(action, callbackURL string, err error) error {
+	if err == nil {
+		return nil
+	}
+	call := providerCall{provider: "GitHub", repository: gh.Org + "/" + gh.Repo, secret: gh.Secret, action: action, callbackURL: callbackURL}
+	return translateGitHubError(call, err)
 }
 
 func (gh GitHub) GetAllWebhooks() ([]GitWebhook, error) {
-	hooks, _, err := gh.Client.Repositories.ListHooks(gh.Context, gh.Org, gh.Repo, nil)
+	webhooks := []GitWebhook{}
+	opts := &github.ListOptions{PerPage: gh.PageSize}
+	for {
+		hooks, resp, err := gh.Client.Repositories.ListHooks(gh.Context, gh.Org, gh.Repo, opts)
+		if err != nil {
+			return nil, gh.translateError("list", "", err)
+		}
+		for _, hook := range hooks {
+			webhooks = append(webhooks, GitHubWebhook{Hook: hook})
+		}
+		if resp.NextPage == 0 {
+			return webhooks, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (gh GitHub) SetCommitStatus(sha string, status commitStatus) error {
+	repoStatus := &github.RepoStatus{
+		State:       github.String(status.State),
+		Context:     github.String(status.Context),
+		Description: github.String(status.Description),
+		TargetURL:   github.String(status.TargetURL),
+	}
+	_, _, err := gh.Client.Repositories.CreateStatus(gh.Context, gh.Org, gh.Repo, sha, repoStatus)
+	return err
+}
+
+func (gh GitHub) CommentOnPullRequest(number int, body string) error {
+	_, _, err := gh.Client.Issues.CreateComment(gh.Context, gh.Org, gh.Repo, number, &github.IssueComment{Body: github.String(body)})
+	return err
+}
+
+// GetFile reads path from the repository's default branch
+func (gh GitHub) GetFile(path string) ([]byte, error) {
+	file, _, resp, err := gh.Client.Repositories.GetContents(gh.Context, gh.Org, gh.Repo, path, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, errFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	content, err := file.GetContent()
+	return []byte(content), err
+}
+
+// DefaultBranch returns the name of the repository's default branch
+func (gh GitHub) DefaultBranch() (string, error) {
+	repository, _, err := gh.Client.Repositories.Get(gh.Context, gh.Org, gh.Repo)
+	if err != nil {
+		return "", err
+	}
+	return repository.GetDefaultBranch(), nil
+}
+
+func (gh GitHub) ListFiles(dir string) ([]string, error) {
+	_, contents, resp, err := gh.Client.Repositories.GetContents(gh.Context, gh.Org, gh.Repo, dir, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, errFileNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-	webhooks := make([]GitWebhook, len(hooks))
-	for i, hook := range hooks {
-		webhooks[i] = GitHubWebhook{Hook: hook}
+	files := []string{}
+	for _, content := range contents {
+		if content.GetType() == "file" {
+			files = append(files, content.GetPath())
+		}
 	}
-	return webhooks, err
+	return files, nil
 }
 
 func (ghWebhook GitHubWebhook) GetID() int {
@@ -14,9 +14,10 @@ limitations under the License.
 package endpoints
 
 import (
+	"net/http"
+
 	utils "github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
 	"github.com/xanzy/go-gitlab"
-	"os"
 )
 
 type GitLabWebhook struct {
@@ -26,47 +27,73 @@ type GitLabWebhook struct {
 type GitLab struct {
 	Client    *gitlab.Client
 	ProjectID string
+	Secret    string
 	SSLVerify bool
+	PageSize  int
 	Resource  Resource
 }
 
 func (r Resource) initGitLab(sslVerify bool, apiURL, secret, org, repo string) (*GitLab, error) {
-	// Access token is stored as 'accessToken' and secret as 'secretToken'
-	accessToken, _, err := utils.GetWebhookSecretTokens(r.K8sClient, r.Defaults.Namespace, secret)
+	// Access token is stored as 'accessToken', or 'username' and 'password' for basic authentication
+	creds, err := utils.GetGitCredentials(r.K8sClient, r.Defaults.Namespace, secret)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create the client
+	tlsConfig, err := r.gitTLSConfig(sslVerify, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	var httpClient *http.Client
+	if tlsConfig.VerifyPeerCertificate != nil {
+		// Pinned servers get a transport of their own, see certpins.go
+		httpClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}}
+	} else if !sslVerify {
+		httpClient = utils.GetClientAllowsSelfSigned()
+	}
+	settings := r.gitAPI("gitlab")
+	httpClient = withGitAPISettings(httpClient, settings)
 	var glClient *gitlab.Client
-	if sslVerify {
-		glClient = gitlab.NewClient(nil, accessToken)
+	if creds.Username != "" {
+		// GitLab exchanges the username and password for an OAuth token
+		glClient, err = gitlab.NewBasicAuthClient(httpClient, apiURL, creds.Username, creds.Password)
+		if err != nil {
+			return nil, err
+		}
 	} else {
-		glClient = gitlab.NewClient(utils.GetClientAllowsSelfSigned(), accessToken)
+		glClient = gitlab.NewClient(httpClient, creds.AccessToken)
+		glClient.SetBaseURL(apiURL)
 	}
-	glClient.SetBaseURL(apiURL)
 
-	return &GitLab{Client: glClient, ProjectID: org + "/" + repo, SSLVerify: sslVerify, Resource: r}, nil
+	return &GitLab{Client: glClient, ProjectID: org + "/" + repo, Secret: secret, SSLVerify: sslVerify, PageSize: settings.PageSize, Resource: r}, nil
 }
 
 func (gl GitLab) GetAllWebhooks() ([]GitWebhook, error) {
-	hooks, _, err := gl.Client.Projects.ListProjectHooks(gl.ProjectID, &gitlab.ListProjectHooksOptions{}, nil)
-	if err != nil {
-		return nil, err
+	webhooks := []GitWebhook{}
+	opts := &gitlab.ListProjectHooksOptions{PerPage: gl.PageSize}
+	for {
+		hooks, resp, err := gl.Client.Projects.ListProjectHooks(gl.ProjectID, opts, nil)
+		if err != nil {
+			return nil, gl.translateError("list", "", err)
+		}
+		for _, hook := range hooks {
+			webhooks = append(webhooks, GitLabWebhook{Hook: hook})
+		}
+		if resp.NextPage == 0 {
+			return webhooks, nil
+		}
+		opts.Page = resp.NextPage
 	}
-	webhooks := make([]GitWebhook, len(hooks))
-	for i, hook := range hooks {
-		webhooks[i] = GitLabWebhook{Hook: hook}
-	}
-	return webhooks, err
 }
 
 func (gl GitLab) AddWebhook(hook webhook) error {
 	// Specify webhook options
-	callback := os.Getenv("WEBHOOK_CALLBACK_URL")
+	callback := hookCallbackURL(gl.Resource, hook)
 	pushEvents := true
 	mergeEvents := true
 	tagPushEvents := true
+	noteEvents := true
 	sslverify := gl.SSLVerify
 	_, secretToken, err := utils.GetWebhookSecretTokens(gl.Resource.K8sClient, gl.Resource.Defaults.Namespace, hook.AccessTokenRef)
 	if err != nil {
@@ -78,19 +105,123 @@ func (gl GitLab) AddWebhook(hook webhook) error {
 		PushEvents:            &pushEvents,
 		MergeRequestsEvents:   &mergeEvents,
 		TagPushEvents:         &tagPushEvents,
+		NoteEvents:            &noteEvents,
 		EnableSSLVerification: &sslverify,
 		Token:                 &secretToken,
 	}
 	// Add webhook
 	_, _, err = gl.Client.Projects.AddProjectHook(gl.ProjectID, &webhookOptions)
-	return err
+	return gl.translateError("create", callback, err)
+}
+
+func (gl GitLab) UpdateWebhook(existing GitWebhook, hook webhook, callbackURL string) error {
+	pushEvents := true
+	mergeEvents := true
+	tagPushEvents := true
+	noteEvents := true
+	sslverify := gl.SSLVerify
+	_, secretToken, err := utils.GetWebhookSecretTokens(gl.Resource.K8sClient, gl.Resource.Defaults.Namespace, hook.AccessTokenRef)
+	if err != nil {
+		return err
+	}
+
+	// GitLab resets any event flag not supplied on edit, so send them all again
+	webhookOptions := gitlab.EditProjectHookOptions{
+		URL:                   &callbackURL,
+		PushEvents:            &pushEvents,
+		MergeRequestsEvents:   &mergeEvents,
+		TagPushEvents:         &tagPushEvents,
+		NoteEvents:            &noteEvents,
+		EnableSSLVerification: &sslverify,
+		Token:                 &secretToken,
+	}
+	_, _, err = gl.Client.Projects.EditProjectHook(gl.ProjectID, existing.GetID(), &webhookOptions)
+	return gl.translateError("update", callbackURL, err)
 }
 
 func (gl GitLab) DeleteWebhook(hook GitWebhook) error {
 	_, err := gl.Client.Projects.DeleteProjectHook(gl.ProjectID, hook.GetID())
+	return gl.translateError("delete", hook.GetURL(), err)
+}
+
+// translateError translates the failure of a webhook call, see providererrors.go
+func (gl GitLab) translateError(action, callbackURL string, err error) error {
+	if err == nil {
+		return nil
+	}
+	call := providerCall{provider: "GitLab", repository: gl.ProjectID, secret: gl.Secret, action: action, callbackURL: callbackURL}
+	return translateGitLabError(call, err)
+}
+
+func (gl GitLab) SetCommitStatus(sha string, status commitStatus) error {
+	// GitLab has no error state and reports a status's context as its name
+	state := gitlab.BuildStateValue(status.State)
+	if status.State == "failure" || status.State == "error" {
+		state = gitlab.Failed
+	}
+	opts := &gitlab.SetCommitStatusOptions{
+		State:       state,
+		Name:        gitlab.String(status.Context),
+		Description: gitlab.String(status.Description),
+		TargetURL:   gitlab.String(status.TargetURL),
+	}
+	_, _, err := gl.Client.Commits.SetCommitStatus(gl.ProjectID, sha, opts)
+	return err
+}
+
+func (gl GitLab) CommentOnPullRequest(number int, body string) error {
+	_, _, err := gl.Client.Notes.CreateMergeRequestNote(gl.ProjectID, number, &gitlab.CreateMergeRequestNoteOptions{Body: gitlab.String(body)})
 	return err
 }
 
+// GetFile reads path from the project's default branch
+func (gl GitLab) GetFile(path string) ([]byte, error) {
+	project, _, err := gl.Client.Projects.GetProject(gl.ProjectID, nil)
+	if err != nil {
+		return nil, err
+	}
+	content, resp, err := gl.Client.RepositoryFiles.GetRawFile(gl.ProjectID, path, &gitlab.GetRawFileOptions{Ref: gitlab.String(project.DefaultBranch)})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, errFileNotFound
+	}
+	return content, err
+}
+
+// DefaultBranch returns the name of the project's default branch
+func (gl GitLab) DefaultBranch() (string, error) {
+	project, _, err := gl.Client.Projects.GetProject(gl.ProjectID, nil)
+	if err != nil {
+		return "", err
+	}
+	return project.DefaultBranch, nil
+}
+
+func (gl GitLab) ListFiles(dir string) ([]string, error) {
+	files := []string{}
+	opts := &gitlab.ListTreeOptions{ListOptions: gitlab.ListOptions{PerPage: gl.PageSize}}
+	if dir != "" {
+		opts.Path = gitlab.String(dir)
+	}
+	for {
+		nodes, resp, err := gl.Client.Repositories.ListTree(gl.ProjectID, opts)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, errFileNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			if node.Type == "blob" {
+				files = append(files, node.Path)
+			}
+		}
+		if resp.NextPage == 0 {
+			return files, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
 // GitLab Webhook --------------------------------------------------------------------------------------------------------
 func (glWebhook GitLabWebhook) GetID() int {
 	return glWebhook.Hook.ID
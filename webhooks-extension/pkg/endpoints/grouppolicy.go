@@ -0,0 +1,299 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+/*--------------------------------------
+Enterprises manage who may do what by the groups of their identity
+provider, synced by SCIM or LDAP into the groups claim of the tokens
+Kubernetes authenticates, rather than by a RoleBinding per user. The
+policy.yaml key of the webhooks-extension-group-policy configmap in the
+install namespace grants groups permissions:
+
+	groups:
+	- group: platform-admins
+	  admin: true
+	- group: payments
+	  create: [payments-dev, payments-prod]
+
+A group with admin may call the admin endpoints (see admin.go) and create
+and change webhooks in any namespace, one with create may create and
+change webhooks in the namespaces listed, "*" meaning any. While the
+configmap exists creating a webhook, cloning, renaming, rolling back,
+repairing, completing, executing or deleting one, or onboarding a
+namespace, needs the caller's bearer token, and one of the caller's groups
+must be granted the namespace, the webhook's for requests on one and the
+clone's too for a clone, or the caller be an admin by RBAC. Changing
+credentials, variable sets, the callback or the eventlistener, or syncing
+a repository's manifest or default branch, changes webhooks in any
+namespace and needs every namespace. Requests
+signed with an API key are checked against its scopes instead (see
+signedrequests.go). Without the configmap nothing changes.
+---------------------------------------*/
+
+const (
+	// Configmap in the install namespace holding the group policy
+	groupPolicyConfigMap = "webhooks-extension-group-policy"
+	groupPolicyKey       = "policy.yaml"
+	anyNamespace         = "*"
+)
+
+// groupPolicy maps identity groups to permissions
+type groupPolicy struct {
+	Groups []groupGrant `json:"groups"`
+}
+
+// groupGrant is the permissions of a group
+type groupGrant struct {
+	Group string `json:"group"`
+	// Whether the group may call admin endpoints and create and change webhooks in any namespace
+	Admin bool `json:"admin,omitempty"`
+	// Namespaces the group may create and change webhooks in, * for any
+	Create []string `json:"create,omitempty"`
+}
+
+// getGroupPolicy returns the group policy, nil if the configmap does not exist
+func (r Resource) getGroupPolicy() (*groupPolicy, error) {
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(groupPolicyConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading configmap %s: %s", groupPolicyConfigMap, err)
+	}
+	policy := groupPolicy{}
+	if err := yaml.UnmarshalStrict([]byte(cm.Data[groupPolicyKey]), &policy); err != nil {
+		return nil, fmt.Errorf("invalid %s in configmap %s: %s", groupPolicyKey, groupPolicyConfigMap, err)
+	}
+	for i, grant := range policy.Groups {
+		if strings.TrimSpace(grant.Group) == "" {
+			return nil, fmt.Errorf("invalid %s in configmap %s: entry %d has no group", groupPolicyKey, groupPolicyConfigMap, i)
+		}
+	}
+	return &policy, nil
+}
+
+// grantsAdmin is whether any of groups is granted admin
+func (p *groupPolicy) grantsAdmin(groups []string) bool {
+	if p == nil {
+		return false
+	}
+	for _, grant := range p.grantsOf(groups) {
+		if grant.Admin {
+			return true
+		}
+	}
+	return false
+}
+
+// grantsCreate is whether any of groups may create and change webhooks in namespace, every namespace if it's empty
+func (p *groupPolicy) grantsCreate(groups []string, namespace string) bool {
+	if p == nil {
+		return false
+	}
+	for _, grant := range p.grantsOf(groups) {
+		if grant.Admin {
+			return true
+		}
+		for _, allowed := range grant.Create {
+			if allowed == anyNamespace || allowed == namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *groupPolicy) grantsOf(groups []string) []groupGrant {
+	member := map[string]bool{}
+	for _, group := range groups {
+		member[group] = true
+	}
+	grants := []groupGrant{}
+	for _, grant := range p.Groups {
+		if member[grant.Group] {
+			grants = append(grants, grant)
+		}
+	}
+	return grants
+}
+
+// GroupPolicyFilter refuses requests creating or changing webhooks in a namespace the caller's groups aren't
+// granted while the group policy exists. Routes on /{name} change the webhook in the namespace query parameter,
+// others create webhooks in the request body's namespace, else the query parameter's. A request whose body and
+// query parameter name different namespaces is refused, and one naming no namespace changes webhooks in every
+// namespace.
+func (r Resource) GroupPolicyFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	r.filterChanges(requestNamespaces, request, response, chain)
+}
+
+// CloneGroupPolicyFilter is GroupPolicyFilter for POST /{name}/clone, which reads the source webhook in the
+// namespace query parameter and creates the clone in the request body's namespace, so both are checked
+func (r Resource) CloneGroupPolicyFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	r.filterChanges(cloneNamespaces, request, response, chain)
+}
+
+// SharedGroupPolicyFilter is GroupPolicyFilter for routes changing what webhooks in any namespace share or use:
+// credentials, variable sets, the eventlistener and the webhooks of a repository. These need every namespace
+// whatever the request names.
+func (r Resource) SharedGroupPolicyFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	r.filterChanges(everyNamespace, request, response, chain)
+}
+
+func (r Resource) filterChanges(namespacesOf func(*restful.Request) ([]string, error), request *restful.Request,
+	response *restful.Response, chain *restful.FilterChain) {
+	namespaces, err := namespacesOf(request)
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	if status, err := r.authorizeChangeIn(request, namespaces); err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, status)
+		return
+	}
+	chain.ProcessFilter(request, response)
+}
+
+// authorizeChange returns the status to respond with and why if the caller of request may not create or change
+// webhooks in the namespace it names
+func (r Resource) authorizeChange(request *restful.Request) (int, error) {
+	namespaces, err := requestNamespaces(request)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	return r.authorizeChangeIn(request, namespaces)
+}
+
+// authorizeChangeIn returns the status to respond with and why if the caller of request may not create or change
+// webhooks in all of namespaces. Requests signed with an API key are checked against its scopes whether or not the
+// group policy exists.
+func (r Resource) authorizeChangeIn(request *restful.Request, namespaces []string) (int, error) {
+	if keyID, signed := signedKey(request); signed {
+		for _, namespace := range namespaces {
+			if !signedScopes(request).allowsNamespace(namespace) {
+				return http.StatusForbidden, fmt.Errorf("API key %s may not change webhooks in %s, see its scopes in secret %s",
+					keyID, describeNamespace(namespace), apiKeysSecret)
+			}
+		}
+		return http.StatusOK, nil
+	}
+	policy, err := r.getGroupPolicy()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if policy == nil {
+		return http.StatusOK, nil
+	}
+	user, status, err := r.reviewToken(request, "requests creating or changing webhooks", scopeCreate)
+	if err != nil {
+		return status, err
+	}
+	denied := ""
+	granted := true
+	for _, namespace := range namespaces {
+		if !policy.grantsCreate(user.Groups, namespace) {
+			denied, granted = namespace, false
+			break
+		}
+	}
+	if granted {
+		return http.StatusOK, nil
+	}
+	// Admins by RBAC manage every webhook whatever the policy
+	admin, err := r.rbacAdmin(user)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !admin {
+		return http.StatusForbidden, fmt.Errorf("none of the groups of %s may create or change webhooks in %s, see configmap %s",
+			user.Username, describeNamespace(denied), groupPolicyConfigMap)
+	}
+	return http.StatusOK, nil
+}
+
+func describeNamespace(namespace string) string {
+	if namespace == "" {
+		return "every namespace"
+	}
+	return "namespace " + namespace
+}
+
+// requestNamespaces returns the namespace request creates or changes webhooks in, leaving the body to be read
+// again. Routes on /{name} change the webhook in the namespace query parameter, others name it in the body, else
+// the query parameter.
+func requestNamespaces(request *restful.Request) ([]string, error) {
+	namespace, err := bodyNamespace(request)
+	if err != nil {
+		return nil, err
+	}
+	query := request.QueryParameter("namespace")
+	if namespace != "" && query != "" && namespace != query {
+		return nil, fmt.Errorf("the request body names namespace %s but the namespace query parameter %s", namespace, query)
+	}
+	if namespace == "" || request.PathParameter("name") != "" {
+		return []string{query}, nil
+	}
+	return []string{namespace}, nil
+}
+
+// cloneNamespaces returns the namespace of the webhook a clone request copies, its namespace query parameter, and
+// that of the clone, the body's if it names one
+func cloneNamespaces(request *restful.Request) ([]string, error) {
+	namespace, err := bodyNamespace(request)
+	if err != nil {
+		return nil, err
+	}
+	source := request.QueryParameter("namespace")
+	if namespace == "" || namespace == source {
+		return []string{source}, nil
+	}
+	return []string{source, namespace}, nil
+}
+
+func everyNamespace(request *restful.Request) ([]string, error) {
+	return []string{""}, nil
+}
+
+// bodyNamespace returns the namespace of the body of request, leaving the body to be read again
+func bodyNamespace(request *restful.Request) (string, error) {
+	body := struct {
+		Namespace string `json:"namespace"`
+	}{}
+	if request.Request.Body != nil {
+		read, err := ioutil.ReadAll(request.Request.Body)
+		if err != nil {
+			return "", fmt.Errorf("error reading the request body: %s", err)
+		}
+		request.Request.Body = ioutil.NopCloser(bytes.NewReader(read))
+		// A body that isn't JSON is refused by the handler
+		json.Unmarshal(read, &body)
+	}
+	return body.Namespace, nil
+}
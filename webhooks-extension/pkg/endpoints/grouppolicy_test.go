@@ -0,0 +1,330 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	restful "github.com/emicklei/go-restful"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testGroupPolicy = `
+groups:
+- group: platform-admins
+  admin: true
+- group: payments
+  create: [payments-dev, payments-prod]
+- group: everyone
+  create: ["*"]
+`
+
+// fakeGroupReviews authenticates the tokens alice, in group payments, bob, in group platform-admins, carol,
+// in group other, and dave, in no group but an admin by RBAC
+func fakeGroupReviews(r *Resource) {
+	groups := map[string][]string{"alice": {"payments"}, "bob": {"platform-admins"}, "carol": {"other"}, "dave": {}}
+	fake := r.K8sClient.(*fakek8sclientset.Clientset)
+	fake.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		_, review.Status.Authenticated = groups[review.Spec.Token]
+		review.Status.User = authenticationv1.UserInfo{Username: review.Spec.Token, Groups: groups[review.Spec.Token]}
+		return true, review, nil
+	})
+	fake.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "dave"
+		return true, review, nil
+	})
+}
+
+func setGroupPolicy(t *testing.T, r *Resource, policy string) {
+	_, err := r.K8sClient.CoreV1().ConfigMaps(installNs).Create(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: groupPolicyConfigMap, Namespace: installNs},
+		Data:       map[string]string{groupPolicyKey: policy},
+	})
+	if err != nil {
+		t.Fatalf("error creating configmap %s: %s", groupPolicyConfigMap, err)
+	}
+}
+
+func createRequest(token, body string) *restful.Request {
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/", bytes.NewBufferString(body))
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	return dummyRestfulRequest(httpReq, "")
+}
+
+func TestAuthorizeCreate(t *testing.T) {
+	r := dummyResource()
+	fakeGroupReviews(r)
+
+	if status, err := r.authorizeChange(createRequest("", `{"namespace":"prod"}`)); status != http.StatusOK {
+		t.Fatalf("expected creation to be allowed without a group policy, got %d: %s", status, err)
+	}
+
+	setGroupPolicy(t, r, testGroupPolicy)
+	tests := []struct {
+		token  string
+		body   string
+		status int
+	}{
+		{"alice", `{"namespace":"payments-dev"}`, http.StatusOK},
+		{"alice", `{"namespace":"prod"}`, http.StatusForbidden},
+		{"bob", `{"namespace":"prod"}`, http.StatusOK},
+		{"carol", `{"namespace":"payments-dev"}`, http.StatusForbidden},
+		{"dave", `{"namespace":"prod"}`, http.StatusOK},
+		{"alice", `{}`, http.StatusForbidden},
+		{"bob", `{}`, http.StatusOK},
+		{"mallory", `{"namespace":"payments-dev"}`, http.StatusUnauthorized},
+		{"", `{"namespace":"payments-dev"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if status, err := r.authorizeChange(createRequest(tt.token, tt.body)); status != tt.status {
+			t.Errorf("%s creating with %s: expected %d, got %d: %v", tt.token, tt.body, tt.status, status, err)
+		}
+	}
+
+	signed := createRequest("", `{"namespace":"prod"}`)
+	signed.SetAttribute(signedKeyAttribute, "ci")
+	signed.SetAttribute(signedScopesAttribute, apiKeyScopes{Namespaces: []string{"prod"}})
+	if status, err := r.authorizeChange(signed); status != http.StatusOK {
+		t.Errorf("expected a signed request in the key's namespaces to be allowed, got %d: %s", status, err)
+	}
+	signed = createRequest("", `{"namespace":"payments-dev"}`)
+	signed.SetAttribute(signedKeyAttribute, "ci")
+	signed.SetAttribute(signedScopesAttribute, apiKeyScopes{Namespaces: []string{"prod"}})
+	if status, _ := r.authorizeChange(signed); status != http.StatusForbidden {
+		t.Errorf("expected a signed request outside the key's namespaces to be refused, got %d", status)
+	}
+}
+
+func TestAuthorizeCreateSessionScopes(t *testing.T) {
+	r := dummyResource()
+	fakeGroupReviews(r)
+	setGroupPolicy(t, r, testGroupPolicy)
+
+	tests := []struct {
+		scopes []string
+		status int
+	}{
+		{[]string{scopeCreate}, http.StatusOK},
+		{[]string{scopeAdmin}, http.StatusForbidden},
+		{nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		request := createRequest("", `{"namespace":"payments-dev"}`)
+		request.SetAttribute(sessionClaimsAttribute, sessionClaims{User: "alice", Groups: []string{"payments"}, Scopes: tt.scopes})
+		if status, err := r.authorizeChange(request); status != tt.status {
+			t.Errorf("session token with scopes %v: expected %d, got %d: %v", tt.scopes, tt.status, status, err)
+		}
+	}
+}
+
+func TestAuthorizeCreateInvalidPolicy(t *testing.T) {
+	r := dummyResource()
+	fakeGroupReviews(r)
+	setGroupPolicy(t, r, "groups:\n- group: payments\n  delete: [payments-dev]\n")
+
+	if status, _ := r.authorizeChange(createRequest("alice", `{"namespace":"payments-dev"}`)); status != http.StatusInternalServerError {
+		t.Errorf("expected creation to fail with an invalid group policy, got %d", status)
+	}
+}
+
+func TestAuthorizeAdminGroupPolicy(t *testing.T) {
+	r := dummyResource()
+	fakeGroupReviews(r)
+	setGroupPolicy(t, r, testGroupPolicy)
+
+	request := func(token string) *restful.Request {
+		httpReq := dummyHTTPRequest("DELETE", "http://wwww.dummy.com:8383/webhooks?namespace=default", nil)
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+		return dummyRestfulRequest(httpReq, "")
+	}
+	if status, err := r.authorizeAdmin(request("bob")); status != http.StatusOK {
+		t.Errorf("expected group platform-admins to be admins, got %d: %s", status, err)
+	}
+	if status, _ := r.authorizeAdmin(request("alice")); status != http.StatusForbidden {
+		t.Errorf("expected group payments not to be admins, got %d", status)
+	}
+}
+
+func TestGroupPolicyFilter(t *testing.T) {
+	r := dummyResource()
+	fakeGroupReviews(r)
+	setGroupPolicy(t, r, testGroupPolicy)
+	container := restful.NewContainer()
+	ws := new(restful.WebService)
+	ws.Path("/webhooks")
+	var body string
+	ws.Route(ws.POST("/").Filter(r.GroupPolicyFilter).To(func(request *restful.Request, response *restful.Response) {
+		read, _ := ioutil.ReadAll(request.Request.Body)
+		body = string(read)
+		response.WriteHeader(http.StatusCreated)
+	}))
+	deleted := false
+	ws.Route(ws.DELETE("/{name}").Filter(r.GroupPolicyFilter).To(func(request *restful.Request, response *restful.Response) {
+		deleted = true
+		response.WriteHeader(http.StatusNoContent)
+	}))
+	container.Add(ws)
+
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/", bytes.NewBufferString(`{"namespace":"payments-prod"}`))
+	httpReq.Header.Set("Authorization", "Bearer alice")
+	httpWriter := httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusCreated || body != `{"namespace":"payments-prod"}` {
+		t.Errorf("expected the request to reach the handler with its body, got %d, %q", httpWriter.Code, body)
+	}
+
+	httpReq = dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/?namespace=prod", bytes.NewBufferString(`{}`))
+	httpReq.Header.Set("Authorization", "Bearer alice")
+	httpWriter = httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusForbidden {
+		t.Errorf("expected creating in namespace prod to be refused, got %d", httpWriter.Code)
+	}
+
+	// Changing a webhook is checked against the webhook's namespace
+	httpReq = dummyHTTPRequest("DELETE", "http://wwww.dummy.com:8383/webhooks/hook?namespace=prod&repository=https://github.com/owner/repo", nil)
+	httpReq.Header.Set("Authorization", "Bearer alice")
+	httpWriter = httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusForbidden || deleted {
+		t.Errorf("expected deleting a webhook in namespace prod to be refused, got %d", httpWriter.Code)
+	}
+
+	// A body naming a granted namespace doesn't change what a webhook route is checked against
+	httpReq = dummyHTTPRequest("DELETE", "http://wwww.dummy.com:8383/webhooks/hook?namespace=prod", bytes.NewBufferString(`{"namespace":"payments-dev"}`))
+	httpReq.Header.Set("Authorization", "Bearer alice")
+	httpWriter = httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusBadRequest || deleted {
+		t.Errorf("expected a body and query parameter naming different namespaces to be refused, got %d", httpWriter.Code)
+	}
+
+	httpReq = dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/?namespace=prod", bytes.NewBufferString(`{"namespace":"payments-dev"}`))
+	httpReq.Header.Set("Authorization", "Bearer alice")
+	httpWriter = httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusBadRequest {
+		t.Errorf("expected a body and query parameter naming different namespaces to be refused, got %d", httpWriter.Code)
+	}
+
+	httpReq = dummyHTTPRequest("DELETE", "http://wwww.dummy.com:8383/webhooks/hook?namespace=payments-dev", bytes.NewBufferString(`{"namespace":"payments-dev"}`))
+	httpReq.Header.Set("Authorization", "Bearer alice")
+	httpWriter = httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusNoContent || !deleted {
+		t.Errorf("expected deleting a webhook in namespace payments-dev to be allowed, got %d", httpWriter.Code)
+	}
+}
+
+func TestCloneGroupPolicyFilter(t *testing.T) {
+	r := dummyResource()
+	fakeGroupReviews(r)
+	setGroupPolicy(t, r, testGroupPolicy)
+	container := restful.NewContainer()
+	ws := new(restful.WebService)
+	ws.Path("/webhooks")
+	ws.Route(ws.POST("/{name}/clone").Filter(r.CloneGroupPolicyFilter).To(func(request *restful.Request, response *restful.Response) {
+		response.WriteHeader(http.StatusCreated)
+	}))
+	container.Add(ws)
+
+	tests := []struct {
+		query  string
+		body   string
+		status int
+	}{
+		{"payments-dev", `{"namespace":"payments-prod"}`, http.StatusCreated},
+		{"payments-dev", `{"name":"copy"}`, http.StatusCreated},
+		// The source and the clone must both be granted
+		{"prod", `{"namespace":"payments-prod"}`, http.StatusForbidden},
+		{"payments-dev", `{"namespace":"prod"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/hook/clone?namespace="+tt.query, bytes.NewBufferString(tt.body))
+		httpReq.Header.Set("Authorization", "Bearer alice")
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		if httpWriter.Code != tt.status {
+			t.Errorf("cloning from namespace %s with %s: expected %d, got %d", tt.query, tt.body, tt.status, httpWriter.Code)
+		}
+	}
+}
+
+func TestSharedGroupPolicyFilter(t *testing.T) {
+	r := dummyResource()
+	fakeGroupReviews(r)
+	setGroupPolicy(t, r, testGroupPolicy)
+	container := restful.NewContainer()
+	ws := new(restful.WebService)
+	ws.Path("/webhooks")
+	ws.Route(ws.POST("/credentials").Filter(r.SharedGroupPolicyFilter).To(func(request *restful.Request, response *restful.Response) {
+		response.WriteHeader(http.StatusCreated)
+	}))
+	container.Add(ws)
+
+	tests := []struct {
+		token  string
+		status int
+	}{
+		{"bob", http.StatusCreated},
+		{"dave", http.StatusCreated},
+		// Naming a granted namespace doesn't make a shared change any less shared
+		{"alice", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/credentials?namespace=payments-dev", bytes.NewBufferString(`{"namespace":"payments-dev"}`))
+		httpReq.Header.Set("Authorization", "Bearer "+tt.token)
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		if httpWriter.Code != tt.status {
+			t.Errorf("%s creating a credential: expected %d, got %d", tt.token, tt.status, httpWriter.Code)
+		}
+	}
+}
+
+func TestChangingRoutesAreFiltered(t *testing.T) {
+	r := dummyResource()
+	container := restful.NewContainer()
+	r.RegisterExtensionWebService(container)
+	// Routes that change nothing, or authenticate the caller themselves
+	unfiltered := map[string]bool{
+		"POST /webhooks/{name}/preview": true,
+		"POST /webhooks/session-token":  true,
+	}
+	for _, ws := range container.RegisteredWebServices() {
+		for _, route := range ws.Routes() {
+			key := route.Method + " " + route.Path
+			if route.Method == http.MethodGet || unfiltered[key] {
+				continue
+			}
+			if len(route.Filters) == 0 {
+				t.Errorf("expected route %s to be filtered by the group policy", key)
+			}
+		}
+	}
+}
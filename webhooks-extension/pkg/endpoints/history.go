@@ -0,0 +1,351 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoints from webhook.go:
+	ws.Route(ws.GET("/{name}/history").To(r.profiled(Resource.getWebhookHistory)))
+	ws.Route(ws.GET("/{name}/history/diff").To(r.profiled(Resource.diffWebhookHistory)))
+Every change to a webhook made through the API is kept as a revision in
+the webhooks-extension-history configmap in the install namespace: who
+made it, when, with which request, and the webhook as it was afterwards.
+HistoryFilter reads the webhooks before and after each POST, PUT, PATCH
+and DELETE under /webhooks that succeeds, so every endpoint is covered,
+and serialises those requests so that each change is put down to the
+right one. Only the last maxRevisions revisions of each webhook are kept.
+Revision 0 is the webhook before it was created, so diffing from it lists
+every setting.
+---------------------------------------*/
+
+const (
+	// Configmap in the install namespace holding the revisions of each webhook
+	historyConfigMap = "webhooks-extension-history"
+	maxRevisions     = 10
+)
+
+var historyLock = trackedMutex{name: "history"}
+
+// webhookRevision is a webhook as a request left it
+type webhookRevision struct {
+	Revision int       `json:"revision"`
+	Time     time.Time `json:"time"`
+	Caller   string    `json:"caller"`
+	Request  string    `json:"request"`
+	// created, changed or deleted
+	Action string `json:"action"`
+	// The webhook after the change, not set when it was deleted
+	Webhook *webhook `json:"webhook,omitempty"`
+}
+
+type webhookHistory struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Profile   string            `json:"profile,omitempty"`
+	Revisions []webhookRevision `json:"revisions"`
+}
+
+// fieldChange is a setting that differs between two revisions
+type fieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type revisionDiff struct {
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace"`
+	From      int           `json:"from"`
+	To        int           `json:"to"`
+	Changes   []fieldChange `json:"changes"`
+}
+
+// historyKey is the configmap key of the revisions of a webhook of the profile r serves
+func (r Resource) historyKey(namespace, name string) string {
+	key := namespace + "_" + name
+	if r.Defaults.Profile != "" {
+		key = r.Defaults.Profile + "_" + key
+	}
+	return manifestKeySanitizer.ReplaceAllString(key, ".")
+}
+
+// HistoryFilter records the changes requests under /webhooks make to the webhooks
+func (r Resource) HistoryFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	method := request.Request.Method
+	path := request.Request.URL.Path
+	if (method != http.MethodPost && method != http.MethodPut && method != http.MethodPatch && method != http.MethodDelete) ||
+		(path != "/webhooks" && !strings.HasPrefix(path, "/webhooks/")) {
+		chain.ProcessFilter(request, response)
+		return
+	}
+	scoped := r
+	if name := request.QueryParameter("profile"); name != "" {
+		profiled, err := r.forProfile(name)
+		if err != nil {
+			// The handler responds with the error
+			chain.ProcessFilter(request, response)
+			return
+		}
+		scoped = profiled
+	}
+
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	before, err := scoped.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error reading the webhooks before %s %s, its changes aren't recorded: %s", method, path, err)
+		chain.ProcessFilter(request, response)
+		return
+	}
+	chain.ProcessFilter(request, response)
+	if response.StatusCode() >= 300 {
+		return
+	}
+	after, err := scoped.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error reading the webhooks after %s %s, its changes aren't recorded: %s", method, path, err)
+		return
+	}
+	if err := scoped.recordHistory(before, after, requestCaller(request), method+" "+path); err != nil {
+		logging.Log.Errorf("error recording the changes of %s %s: %s", method, path, err)
+	}
+}
+
+// webhookChanges returns the revisions, by history key, of the webhooks that differ between before and after
+func (r Resource) webhookChanges(before, after []webhook) map[string]webhookRevision {
+	changes := map[string]webhookRevision{}
+	previous := map[string]webhook{}
+	for _, hook := range before {
+		previous[r.historyKey(hook.Namespace, hook.Name)] = hook
+	}
+	for i, hook := range after {
+		key := r.historyKey(hook.Namespace, hook.Name)
+		old, existed := previous[key]
+		delete(previous, key)
+		if !existed {
+			changes[key] = webhookRevision{Action: "created", Webhook: &after[i]}
+		} else if !reflect.DeepEqual(old, hook) {
+			changes[key] = webhookRevision{Action: "changed", Webhook: &after[i]}
+		}
+	}
+	for key := range previous {
+		changes[key] = webhookRevision{Action: "deleted"}
+	}
+	return changes
+}
+
+// recordHistory adds a revision for each webhook the request changed
+func (r Resource) recordHistory(before, after []webhook, caller, request string) error {
+	changes := r.webhookChanges(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+	installNs := r.Defaults.Namespace
+	configMaps := r.K8sClient.CoreV1().ConfigMaps(installNs)
+	cm, err := configMaps.Get(historyConfigMap, metav1.GetOptions{})
+	create := k8serrors.IsNotFound(err)
+	if create {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: historyConfigMap, Namespace: installNs}}
+	} else if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	now := time.Now().UTC()
+	for key, change := range changes {
+		revisions := []webhookRevision{}
+		if value, found := cm.Data[key]; found {
+			if err := json.Unmarshal([]byte(value), &revisions); err != nil {
+				logging.Log.Errorf("discarding the unreadable history %s in configmap %s: %s", key, historyConfigMap, err)
+				revisions = []webhookRevision{}
+			}
+		}
+		change.Revision = 1
+		if len(revisions) > 0 {
+			change.Revision = revisions[len(revisions)-1].Revision + 1
+		}
+		change.Time = now
+		change.Caller = caller
+		change.Request = request
+		revisions = append(revisions, change)
+		if len(revisions) > maxRevisions {
+			revisions = revisions[len(revisions)-maxRevisions:]
+		}
+		data, err := json.Marshal(revisions)
+		if err != nil {
+			return err
+		}
+		cm.Data[key] = string(data)
+		logging.Log.Infof("webhook history %s: revision %d %s by %s with %s", key, change.Revision, change.Action, caller, request)
+	}
+	if create {
+		_, err = configMaps.Create(cm)
+	} else {
+		_, err = configMaps.Update(cm)
+	}
+	return err
+}
+
+// getRevisions returns the kept revisions of a webhook, oldest first
+func (r Resource) getRevisions(namespace, name string) ([]webhookRevision, error) {
+	revisions := []webhookRevision{}
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(historyConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return revisions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, found := cm.Data[r.historyKey(namespace, name)]
+	if !found {
+		return revisions, nil
+	}
+	if err := json.Unmarshal([]byte(value), &revisions); err != nil {
+		return nil, fmt.Errorf("error reading the history of webhook %s in namespace %s: %s", name, namespace, err)
+	}
+	return revisions, nil
+}
+
+// diffWebhooks lists the settings that differ between from and to, either of which is nil for a deleted webhook
+func diffWebhooks(from, to *webhook) []fieldChange {
+	fields := func(hook *webhook) map[string]interface{} {
+		values := map[string]interface{}{}
+		if hook != nil {
+			data, _ := json.Marshal(hook)
+			json.Unmarshal(data, &values)
+		}
+		return values
+	}
+	fromFields, toFields := fields(from), fields(to)
+	names := []string{}
+	for name := range fromFields {
+		names = append(names, name)
+	}
+	for name := range toFields {
+		if _, found := fromFields[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	changes := []fieldChange{}
+	for _, name := range names {
+		if !reflect.DeepEqual(fromFields[name], toFields[name]) {
+			changes = append(changes, fieldChange{Field: name, From: fromFields[name], To: toFields[name]})
+		}
+	}
+	return changes
+}
+
+// webhookRef reads the webhook's name and namespace from a request, responding with a 400 if there is no namespace
+func webhookRef(request *restful.Request, response *restful.Response) (string, string, bool) {
+	namespace := request.QueryParameter("namespace")
+	if namespace == "" {
+		err := newMessageError("NAMESPACE_REQUIRED", nil)
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusBadRequest)
+		return "", "", false
+	}
+	return request.PathParameter("name"), namespace, true
+}
+
+// GET /webhooks/{name}/history?namespace=<namespace>
+func (r Resource) getWebhookHistory(request *restful.Request, response *restful.Response) {
+	name, namespace, ok := webhookRef(request, response)
+	if !ok {
+		return
+	}
+	revisions, err := r.getRevisions(namespace, name)
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	if len(revisions) == 0 {
+		err := fmt.Errorf("no history found for webhook %s in namespace %s", name, namespace)
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusNotFound)
+		return
+	}
+	response.WriteEntity(webhookHistory{Name: name, Namespace: namespace, Profile: r.Defaults.Profile, Revisions: revisions})
+}
+
+// GET /webhooks/{name}/history/diff?namespace=<namespace>[&from=<revision>][&to=<revision>]
+func (r Resource) diffWebhookHistory(request *restful.Request, response *restful.Response) {
+	name, namespace, ok := webhookRef(request, response)
+	if !ok {
+		return
+	}
+	revisions, err := r.getRevisions(namespace, name)
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	if len(revisions) == 0 {
+		err := fmt.Errorf("no history found for webhook %s in namespace %s", name, namespace)
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusNotFound)
+		return
+	}
+
+	to := revisions[len(revisions)-1].Revision
+	if value := request.QueryParameter("to"); value != "" {
+		if to, err = strconv.Atoi(value); err != nil {
+			RespondError(response, fmt.Errorf("to must be a revision number: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	from := to - 1
+	if value := request.QueryParameter("from"); value != "" {
+		if from, err = strconv.Atoi(value); err != nil {
+			RespondError(response, fmt.Errorf("from must be a revision number: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	var fromHook, toHook *webhook
+	foundFrom, foundTo := from == 0, false
+	for i := range revisions {
+		if revisions[i].Revision == from {
+			fromHook, foundFrom = revisions[i].Webhook, true
+		}
+		if revisions[i].Revision == to {
+			toHook, foundTo = revisions[i].Webhook, true
+		}
+	}
+	if !foundFrom || !foundTo {
+		err := fmt.Errorf("webhook %s in namespace %s has revisions %d to %d, not %d and %d",
+			name, namespace, revisions[0].Revision, revisions[len(revisions)-1].Revision, from, to)
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusNotFound)
+		return
+	}
+	response.WriteEntity(revisionDiff{Name: name, Namespace: namespace, From: from, To: to, Changes: diffWebhooks(fromHook, toHook)})
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+func getHistory(r *Resource, query string) (int, webhookHistory) {
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/hook/history?"+query, nil)
+	httpWriter := httptest.NewRecorder()
+	r.getWebhookHistory(dummyRestfulRequest(httpReq, "hook"), dummyRestfulResponse(httpWriter))
+	history := webhookHistory{}
+	json.NewDecoder(httpWriter.Body).Decode(&history)
+	return httpWriter.Code, history
+}
+
+func getDiff(r *Resource, query string) (int, revisionDiff) {
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/hook/history/diff?"+query, nil)
+	httpWriter := httptest.NewRecorder()
+	r.diffWebhookHistory(dummyRestfulRequest(httpReq, "hook"), dummyRestfulResponse(httpWriter))
+	diff := revisionDiff{}
+	json.NewDecoder(httpWriter.Body).Decode(&diff)
+	return httpWriter.Code, diff
+}
+
+func TestWebhookHistory(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	changed := hook
+	changed.Pipeline = "pipeline2"
+	changed.DockerRegistry = "registry.example.com"
+
+	if status, _ := getHistory(r, "namespace="+installNs); status != http.StatusNotFound {
+		t.Errorf("expected no history before any change, got %d", status)
+	}
+	if err := r.recordHistory(nil, []webhook{hook}, "alice", "POST /webhooks"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.recordHistory([]webhook{hook}, []webhook{hook}, "alice", "POST /webhooks/session-token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.recordHistory([]webhook{hook}, []webhook{changed}, "bob", "POST /webhooks/manifests/sync"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.recordHistory([]webhook{changed}, []webhook{}, "carol", "DELETE /webhooks/hook"); err != nil {
+		t.Fatal(err)
+	}
+
+	status, history := getHistory(r, "namespace="+installNs)
+	if status != http.StatusOK || len(history.Revisions) != 3 {
+		t.Fatalf("expected three revisions, got %d, %+v", status, history)
+	}
+	for i, expected := range []struct {
+		action, caller string
+	}{{"created", "alice"}, {"changed", "bob"}, {"deleted", "carol"}} {
+		revision := history.Revisions[i]
+		if revision.Revision != i+1 || revision.Action != expected.action || revision.Caller != expected.caller {
+			t.Errorf("expected revision %d to be %s by %s, got %+v", i+1, expected.action, expected.caller, revision)
+		}
+	}
+	if history.Revisions[2].Webhook != nil {
+		t.Errorf("expected the deleted revision to have no webhook, got %+v", history.Revisions[2].Webhook)
+	}
+
+	status, diff := getDiff(r, "namespace="+installNs+"&from=1&to=2")
+	if status != http.StatusOK || len(diff.Changes) != 2 || diff.Changes[0].Field != "dockerregistry" ||
+		diff.Changes[1].Field != "pipeline" || diff.Changes[1].From != "pipeline1" || diff.Changes[1].To != "pipeline2" {
+		t.Errorf("expected dockerregistry and pipeline to change, got %d, %+v", status, diff)
+	}
+	status, diff = getDiff(r, "namespace="+installNs)
+	if status != http.StatusOK || diff.From != 2 || diff.To != 3 || len(diff.Changes) == 0 || diff.Changes[0].To != nil {
+		t.Errorf("expected every setting to be removed by the latest revision, got %d, %+v", status, diff)
+	}
+	if status, _ := getDiff(r, "namespace="+installNs+"&from=0&to=1"); status != http.StatusOK {
+		t.Errorf("expected a diff from before the webhook was created, got %d", status)
+	}
+	if status, _ := getDiff(r, "namespace="+installNs+"&from=7"); status != http.StatusNotFound {
+		t.Errorf("expected a diff from an unknown revision to fail with a 404, got %d", status)
+	}
+	if status, _ := getDiff(r, "from=1"); status != http.StatusBadRequest {
+		t.Errorf("expected a diff without a namespace to fail with a 400, got %d", status)
+	}
+
+	for i := 0; i < maxRevisions; i++ {
+		r.recordHistory(nil, []webhook{hook}, "alice", "POST /webhooks")
+		r.recordHistory([]webhook{hook}, nil, "alice", "DELETE /webhooks/hook")
+	}
+	_, history = getHistory(r, "namespace="+installNs)
+	if len(history.Revisions) != maxRevisions || history.Revisions[maxRevisions-1].Revision != 3+2*maxRevisions {
+		t.Errorf("expected the last %d revisions to be kept, got %+v", maxRevisions, history.Revisions)
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	container := restful.NewContainer()
+	container.Filter(r.HistoryFilter)
+	ws := new(restful.WebService)
+	ws.Path("/webhooks")
+	ws.Route(ws.POST("/").To(func(request *restful.Request, response *restful.Response) {
+		if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+			RespondError(response, err, http.StatusInternalServerError)
+			return
+		}
+		response.WriteHeader(http.StatusCreated)
+	}))
+	container.Add(ws)
+
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/", nil)
+	httpReq.Header.Set("X-Forwarded-User", "alice")
+	httpWriter := httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, httpReq)
+	if httpWriter.Code != http.StatusCreated {
+		t.Fatalf("expected the webhook to be created, got %d", httpWriter.Code)
+	}
+	_, history := getHistory(r, "namespace="+installNs)
+	if len(history.Revisions) != 1 || history.Revisions[0].Action != "created" || history.Revisions[0].Caller != "alice" ||
+		history.Revisions[0].Request != "POST /webhooks/" || history.Revisions[0].Webhook.Pipeline != "pipeline1" {
+		t.Errorf("expected the creation to be recorded, got %+v", history.Revisions)
+	}
+}
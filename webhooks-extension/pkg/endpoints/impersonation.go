@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	"k8s.io/client-go/rest"
+)
+
+/*--------------------------------------
+The extension otherwise acts in Kubernetes as its own service account, so
+what a caller may create is decided by the extension's checks (see admin.go
+and grouppolicy.go). With IMPERSONATE_CALLERS set to "true", requests that
+change something (POST, PUT, PATCH and DELETE) act as their caller instead,
+sending the Impersonate-User and Impersonate-Group headers of who their
+bearer token or session token authenticates, so the cluster's RBAC has the
+last word on what each caller may create, update and delete, and the audit
+log names them. Requests signed with an API key act as the user
+webhooks-extension:apikey:<id>. Reads and the extension's background work
+stay with the service account, which must be allowed to impersonate, see
+docs/Security.md.
+---------------------------------------*/
+
+// User requests signed with an API key act as when impersonating, followed by the API key ID
+const apiKeyUserPrefix = "webhooks-extension:apikey:"
+
+func impersonationEnabled() bool {
+	return os.Getenv("IMPERSONATE_CALLERS") == "true"
+}
+
+func changesResources(request *restful.Request) bool {
+	switch request.Request.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// asCaller runs handler with the Resource acting as the caller of request, see forCaller
+func (r Resource) asCaller(handler func(Resource, *restful.Request, *restful.Response)) restful.RouteFunction {
+	return func(request *restful.Request, response *restful.Response) {
+		caller, status, err := r.forCaller(request)
+		if err != nil {
+			logging.Log.Errorf("error: %s", err)
+			RespondError(response, err, status)
+			return
+		}
+		handler(caller, request, response)
+	}
+}
+
+// forCaller returns r with clientsets impersonating the caller of request if impersonating and request changes
+// resources, else r, or the status to respond with and why if the caller can't be told
+func (r Resource) forCaller(request *restful.Request) (Resource, int, error) {
+	if !impersonationEnabled() || !changesResources(request) {
+		return r, http.StatusOK, nil
+	}
+	impersonate := rest.ImpersonationConfig{}
+	if keyID, signed := signedKey(request); signed {
+		impersonate.UserName = apiKeyUserPrefix + keyID
+	} else {
+		user, status, err := r.reviewToken(request, "requests changing resources while impersonating callers", scopeCreate, scopeAdmin)
+		if err != nil {
+			return r, status, err
+		}
+		impersonate.UserName = user.Username
+		impersonate.Groups = user.Groups
+		if len(user.Extra) > 0 {
+			impersonate.Extra = map[string][]string{}
+			for key, value := range user.Extra {
+				impersonate.Extra[key] = value
+			}
+		}
+	}
+	caller, err := r.impersonating(impersonate)
+	if err != nil {
+		return r, http.StatusInternalServerError, fmt.Errorf("error acting as %s: %s", impersonate.UserName, err)
+	}
+	logging.Log.Debugf("acting as %s for %s %s", impersonate.UserName, request.Request.Method, request.Request.URL.Path)
+	return caller, http.StatusOK, nil
+}
+
+// impersonating returns r with clientsets that impersonate as impersonate says
+func (r Resource) impersonating(impersonate rest.ImpersonationConfig) (Resource, error) {
+	if r.config == nil {
+		return r, errors.New("no config to build impersonating clientsets with")
+	}
+	config := rest.CopyConfig(r.config)
+	config.Impersonate = impersonate
+	return r.withClients(config)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	restful "github.com/emicklei/go-restful"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// createConfigMap is a handler creating a configmap as the Resource it is given
+func createConfigMap(r Resource, request *restful.Request, response *restful.Response) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "created", Namespace: installNs}}
+	if _, err := r.K8sClient.CoreV1().ConfigMaps(installNs).Create(cm); err != nil {
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	response.WriteHeader(http.StatusCreated)
+}
+
+func TestAsCaller(t *testing.T) {
+	var impersonated http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		impersonated = req.Header
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "created", "namespace": "default"}}`)
+	}))
+	defer server.Close()
+	os.Setenv("IMPERSONATE_CALLERS", "true")
+	defer os.Unsetenv("IMPERSONATE_CALLERS")
+
+	r := dummyResource()
+	r.config = &rest.Config{Host: server.URL}
+
+	session := createRequest("", `{}`)
+	session.SetAttribute(sessionClaimsAttribute, sessionClaims{User: "alice", Groups: []string{"payments"}, Scopes: []string{scopeCreate}})
+	httpWriter := httptest.NewRecorder()
+	r.asCaller(createConfigMap)(session, dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusCreated {
+		t.Fatalf("expected the configmap to be created, got %d: %s", httpWriter.Code, httpWriter.Body.String())
+	}
+	if impersonated.Get("Impersonate-User") != "alice" || !reflect.DeepEqual(impersonated["Impersonate-Group"], []string{"payments"}) {
+		t.Errorf("expected the configmap to be created as alice in payments, headers were %v", impersonated)
+	}
+
+	signed := createRequest("", `{}`)
+	signed.SetAttribute(signedKeyAttribute, "ci")
+	httpWriter = httptest.NewRecorder()
+	r.asCaller(createConfigMap)(signed, dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusCreated || impersonated.Get("Impersonate-User") != "webhooks-extension:apikey:ci" {
+		t.Errorf("expected the configmap to be created as the API key, got %d and headers %v", httpWriter.Code, impersonated)
+	}
+
+	// Without a bearer token there is no one to act as
+	httpWriter = httptest.NewRecorder()
+	r.asCaller(createConfigMap)(createRequest("", `{}`), dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusUnauthorized {
+		t.Errorf("expected a request without a bearer token to be refused, got %d", httpWriter.Code)
+	}
+}
+
+func TestAsCallerNotImpersonating(t *testing.T) {
+	r := dummyResource()
+	httpWriter := httptest.NewRecorder()
+	r.asCaller(createConfigMap)(createRequest("", `{}`), dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusCreated {
+		t.Fatalf("expected the configmap to be created as the extension, got %d: %s", httpWriter.Code, httpWriter.Body.String())
+	}
+	if _, err := r.K8sClient.CoreV1().ConfigMaps(installNs).Get("created", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the configmap to be created with the extension's clientset: %s", err)
+	}
+}
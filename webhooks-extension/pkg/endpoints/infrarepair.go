@@ -0,0 +1,246 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+/*--------------------------------------
+The ingress (or route on OpenShift) exposing the eventlistener and the TLS
+secrets the extension made for it are only created with the first webhook,
+so when one is deleted every webhook silently stops. While the eventlistener
+exists, the extension looks for them among the resources carrying its
+managed labels every minute and creates any that are missing again, as
+webhook creation would, recording a Normal InfrastructureRepaired event on
+the eventlistener and counting the repair in the
+webhooks_extension_infrastructure_repairs_total metric. The hosts of
+callback URLs added since the ingress was made are added to it, and their
+routes made on OpenShift, the same way. A TLS secret given
+as webhooktlscertificate isn't the extension's to create, so its absence is
+only recorded as a Warning event. Annotating the eventlistener
+webhooks.tekton.dev/repairInfrastructure: "false" turns repairs off, e.g.
+when the exposure is managed another way.
+---------------------------------------*/
+
+const (
+	infraRepairInterval = 1 * time.Minute
+	// Set to "false" on the eventlistener to leave missing infrastructure alone
+	repairInfrastructureAnnotation = "webhooks.tekton.dev/repairInfrastructure"
+)
+
+var (
+	infraRepairsLock sync.Mutex
+	// Repairs made since the extension started, by kind of resource
+	infraRepairs = map[string]uint64{}
+)
+
+// RepairInfrastructure recreates deleted managed infrastructure until stopCh is closed
+func (r Resource) RepairInfrastructure(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(infraRepairInterval)
+	defer ticker.Stop()
+	for {
+		for _, profiled := range r.allProfiles() {
+			profiled.repairInfrastructure()
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// repairInfrastructure recreates the ingress or route, and the TLS secret, of the eventlistener if they are missing,
+// returning the kinds of resource recreated
+func (r Resource) repairInfrastructure() []string {
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	installNs := r.Defaults.Namespace
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			logging.Log.Errorf("error getting the eventlistener to check its infrastructure: %s", err)
+		}
+		return nil
+	}
+	// Nothing is exposed when relaying, see relay.go
+	if el.Annotations[repairInfrastructureAnnotation] == "false" || r.relayed() {
+		return nil
+	}
+	selector := metav1.ListOptions{LabelSelector: labels.SelectorFromSet(managedLabels()).String()}
+
+	repaired := []string{}
+	if r.Install.openShift() {
+		routes, err := r.RoutesClient.RouteV1().Routes(installNs).List(selector)
+		if err != nil {
+			logging.Log.Errorf("error listing routes to check the eventlistener's infrastructure: %s", err)
+			return nil
+		}
+		existing := map[string]bool{}
+		for _, route := range routes.Items {
+			existing[route.Name] = true
+		}
+		if !existing[r.ingressName()] {
+			err = r.createOpenshiftRoute(r.ingressName(), listenerServiceName(r.eventListenerName()))
+			if r.recordRepair(el, "route", r.ingressName(), err) {
+				repaired = append(repaired, "route")
+			}
+		}
+		// Those of the additional callback URLs, see multicallback.go
+		for i := range r.Defaults.AdditionalCallbackURLs {
+			if name := r.callbackRouteName(i); !existing[name] && r.recordRepair(el, "route", name, r.createCallbackRoute(i)) {
+				repaired = append(repaired, "route")
+			}
+		}
+		return repaired
+	}
+
+	ingresses, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).List(selector)
+	if err != nil {
+		logging.Log.Errorf("error listing ingresses to check the eventlistener's infrastructure: %s", err)
+		return nil
+	}
+	for _, ingress := range ingresses.Items {
+		if ingress.Name != r.ingressName() {
+			continue
+		}
+		// The ingress is there, but may be missing the host of a callback URL added since, see multicallback.go
+		hosts := map[string]bool{}
+		for _, rule := range ingress.Spec.Rules {
+			hosts[rule.Host] = true
+		}
+		missing := []string{}
+		for _, callback := range r.callbackURLs() {
+			if !hosts[callbackHost(callback)] {
+				missing = append(missing, callbackHost(callback))
+			}
+		}
+		if len(missing) > 0 {
+			ingress.Spec = r.newIngress(installNs, getCallbackURL(r)).Spec
+			_, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Update(&ingress)
+			if r.recordRepair(el, "host", strings.Join(missing, ", "), err) {
+				repaired = append(repaired, "host")
+			}
+			return repaired
+		}
+		// or the secret holding its certificate
+		for _, tls := range ingress.Spec.TLS {
+			if _, err := r.K8sClient.CoreV1().Secrets(installNs).Get(tls.SecretName, metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+				continue
+			}
+			if !r.isCallbackCertSecret(tls.SecretName) {
+				r.recordEvent(el, corev1.EventTypeWarning, "InfrastructureMissing",
+					fmt.Sprintf("TLS secret %s of ingress %s is missing and isn't the extension's to recreate", tls.SecretName, ingress.Name))
+				continue
+			}
+			host := ""
+			if len(tls.Hosts) > 0 {
+				host = tls.Hosts[0]
+			}
+			if created := r.createCertificate(tls.SecretName, installNs, host); created == "" {
+				err = fmt.Errorf("certificate for %s could not be created", host)
+			}
+			if r.recordRepair(el, "secret", tls.SecretName, err) {
+				repaired = append(repaired, "secret")
+			}
+		}
+		return repaired
+	}
+	// The ingress creates its certificates if they're missing too
+	err = r.createDeleteIngress("create", installNs)
+	if r.recordRepair(el, "ingress", r.ingressName(), err) {
+		repaired = append(repaired, "ingress")
+	}
+	return repaired
+}
+
+// recordRepair logs, records an event on the eventlistener for and counts the recreation of a resource, returning
+// whether it was recreated
+func (r Resource) recordRepair(el *v1alpha1.EventListener, kind, name string, err error) bool {
+	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			// There without the managed labels, e.g. replaced by hand
+			return false
+		}
+		logging.Log.Errorf("error recreating the eventlistener's %s %s: %s", kind, name, err)
+		r.recordEvent(el, corev1.EventTypeWarning, "InfrastructureRepairFailed", fmt.Sprintf("Recreating missing %s %s failed: %s", kind, name, err))
+		return false
+	}
+	logging.Log.Infof("recreated the eventlistener's missing %s %s", kind, name)
+	r.recordEvent(el, corev1.EventTypeNormal, "InfrastructureRepaired", fmt.Sprintf("Recreated missing %s %s", kind, name))
+	infraRepairsLock.Lock()
+	infraRepairs[kind]++
+	infraRepairsLock.Unlock()
+	return true
+}
+
+// recordEvent records a Kubernetes event on the eventlistener, failures are only logged
+func (r Resource) recordEvent(el *v1alpha1.EventListener, eventType, reason, message string) {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", el.Name, now.UnixNano()),
+			Namespace: el.Namespace,
+			Labels:    managedLabels(),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "triggers.tekton.dev/v1alpha1",
+			Kind:       "EventListener",
+			Name:       el.Name,
+			Namespace:  el.Namespace,
+			UID:        el.UID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: "webhooks-extension"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := r.K8sClient.CoreV1().Events(el.Namespace).Create(event); err != nil {
+		logging.Log.Errorf("error recording event %s on eventlistener %s: %s", reason, el.Name, err)
+	}
+}
+
+func formatInfraRepairMetrics() []byte {
+	infraRepairsLock.Lock()
+	defer infraRepairsLock.Unlock()
+	var buf bytes.Buffer
+	name := "webhooks_extension_infrastructure_repairs_total"
+	fmt.Fprintf(&buf, "# HELP %s Missing ingresses, ingress hosts, routes and TLS secrets the extension recreated, by kind.\n# TYPE %s counter\n", name, name)
+	kinds := []string{}
+	for kind := range infraRepairs {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(&buf, "%s{kind=%q} %d\n", name, kind, infraRepairs[kind])
+	}
+	return buf.Bytes()
+}
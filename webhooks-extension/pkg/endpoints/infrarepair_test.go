@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRepairInfrastructure(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.CallbackURL = "http://mywebhooks.example.com"
+	if repaired := r.repairInfrastructure(); len(repaired) != 0 {
+		t.Errorf("expected nothing to be repaired without an eventlistener, got %v", repaired)
+	}
+
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	if repaired := r.repairInfrastructure(); !reflect.DeepEqual(repaired, []string{"ingress"}) {
+		t.Errorf("expected the ingress to be recreated, got %v", repaired)
+	}
+	ingress, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Get(r.ingressName(), metav1.GetOptions{})
+	if err != nil || ingress.Spec.Rules[0].Host != "mywebhooks.example.com" {
+		t.Fatalf("expected the ingress to be recreated for the callback's host, got %+v, %v", ingress, err)
+	}
+	events, err := r.K8sClient.CoreV1().Events(installNs).List(metav1.ListOptions{})
+	if err != nil || len(events.Items) != 1 || events.Items[0].Reason != "InfrastructureRepaired" || events.Items[0].InvolvedObject.Name != r.eventListenerName() {
+		t.Errorf("expected an event on the eventlistener, got %+v, %v", events, err)
+	}
+	if !strings.Contains(string(formatInfraRepairMetrics()), `webhooks_extension_infrastructure_repairs_total{kind="ingress"}`) {
+		t.Errorf("expected the repair to be counted, got %s", formatInfraRepairMetrics())
+	}
+	if repaired := r.repairInfrastructure(); len(repaired) != 0 {
+		t.Errorf("expected nothing to be repaired, got %v", repaired)
+	}
+
+	// Opted out
+	if err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Delete(r.ingressName(), &metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting ingress: %s", err)
+	}
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting eventlistener: %s", err)
+	}
+	el.Annotations = map[string]string{repairInfrastructureAnnotation: "false"}
+	if _, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Update(el); err != nil {
+		t.Fatalf("error updating eventlistener: %s", err)
+	}
+	if repaired := r.repairInfrastructure(); len(repaired) != 0 {
+		t.Errorf("expected nothing to be repaired when opted out, got %v", repaired)
+	}
+}
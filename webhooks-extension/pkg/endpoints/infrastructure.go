@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/infrastructure").To(r.getInfrastructure))
+GET /webhooks/infrastructure reports, from one call, whether deliveries
+can reach the webhooks' pipelines: the eventlistener deployment's
+replicas, the endpoints of the service the ingress or route sends to, the
+address the ingress or route was given and its certificate, and when the
+last delivery arrived. The effective configuration, see config.go, shows
+the same eventlistener and exposure alongside how they're configured.
+---------------------------------------*/
+
+// Certificates expiring sooner than this are reported as a problem
+const certExpiryWarning = 14 * 24 * time.Hour
+
+type infrastructureStatus struct {
+	Healthy       bool                `json:"healthy"`
+	Problems      []string            `json:"problems,omitempty"`
+	EventListener eventListenerStatus `json:"eventlistener"`
+	Service       serviceStatus       `json:"service"`
+	Exposure      exposureStatus      `json:"exposure"`
+	// Set when deliveries are relayed rather than the eventlistener exposed, see relay.go
+	Relay *relayStatus `json:"relay,omitempty"`
+	// The newest of the last delivery the delivery buffer received and the last PipelineRun a webhook started
+	LastDelivery *metav1.Time `json:"lastdelivery,omitempty"`
+}
+
+// serviceStatus is the service the ingress or route sends deliveries to
+type serviceStatus struct {
+	Name              string `json:"name"`
+	ReadyEndpoints    int    `json:"readyendpoints"`
+	NotReadyEndpoints int    `json:"notreadyendpoints"`
+	Error             string `json:"error,omitempty"`
+}
+
+var (
+	lastDeliveryReceivedLock sync.Mutex
+	// When the delivery buffer last received a delivery, see delivery.go
+	lastDeliveryReceived time.Time
+)
+
+// recordDeliveryReceived remembers when the delivery buffer last received a delivery
+func recordDeliveryReceived(received time.Time) {
+	lastDeliveryReceivedLock.Lock()
+	defer lastDeliveryReceivedLock.Unlock()
+	if received.After(lastDeliveryReceived) {
+		lastDeliveryReceived = received
+	}
+}
+
+// GET /webhooks/infrastructure
+func (r Resource) getInfrastructure(request *restful.Request, response *restful.Response) {
+	response.WriteEntity(r.infrastructureStatus(time.Now()))
+}
+
+func (r Resource) infrastructureStatus(now time.Time) infrastructureStatus {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error getting webhooks for the infrastructure status: %s", err)
+	}
+	status := infrastructureStatus{
+		EventListener: r.eventListenerStatus(len(hooks)),
+		Service:       r.serviceStatus(r.listenerIngressBackend().ServiceName),
+		Exposure:      r.exposureStatus(),
+		LastDelivery:  r.lastDelivery(hooks, now),
+		Relay:         r.getRelayStatus(),
+	}
+
+	if status.EventListener.Error != "" {
+		status.Problems = append(status.Problems, "eventlistener "+status.EventListener.Name+": "+status.EventListener.Error)
+	} else if status.EventListener.ReadyReplicas < status.EventListener.Replicas {
+		status.Problems = append(status.Problems, fmt.Sprintf("eventlistener %s has %d of %d replicas ready",
+			status.EventListener.Name, status.EventListener.ReadyReplicas, status.EventListener.Replicas))
+	}
+	if status.Service.Error != "" {
+		status.Problems = append(status.Problems, "service "+status.Service.Name+": "+status.Service.Error)
+	} else if status.Service.ReadyEndpoints == 0 {
+		status.Problems = append(status.Problems, "service "+status.Service.Name+" has no ready endpoints")
+	}
+	if status.Relay != nil {
+		// Nothing is exposed, the relay channel is how deliveries arrive
+		if !status.Relay.Connected {
+			problem := "relay channel " + status.Relay.URL + " is not connected"
+			if status.Relay.Error != "" {
+				problem = problem + ": " + status.Relay.Error
+			}
+			status.Problems = append(status.Problems, problem)
+		}
+	} else if status.Exposure.Error != "" {
+		status.Problems = append(status.Problems, status.Exposure.Mode+" "+status.Exposure.Name+": "+status.Exposure.Error)
+	} else if status.Exposure.Address == "" {
+		status.Problems = append(status.Problems, status.Exposure.Mode+" "+status.Exposure.Name+" has no address yet")
+	}
+	if expiry, err := time.Parse(time.RFC3339, status.Exposure.CertExpiry); err == nil && expiry.After(now) && expiry.Sub(now) < certExpiryWarning {
+		status.Problems = append(status.Problems, "certificate "+status.Exposure.CertSecret+" expires at "+status.Exposure.CertExpiry)
+	}
+	status.Healthy = len(status.Problems) == 0
+	return status
+}
+
+// serviceStatus counts the ready and not ready endpoints of the service in the install namespace
+func (r Resource) serviceStatus(name string) serviceStatus {
+	status := serviceStatus{Name: name}
+	endpoints, err := r.K8sClient.CoreV1().Endpoints(r.Defaults.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		status.Error = lookupError(err)
+		return status
+	}
+	for _, subset := range endpoints.Subsets {
+		status.ReadyEndpoints += len(subset.Addresses)
+		status.NotReadyEndpoints += len(subset.NotReadyAddresses)
+	}
+	return status
+}
+
+// lastDelivery is when the last delivery arrived as far as the extension can tell: when the delivery buffer last
+// received one or when the newest of the webhooks' PipelineRuns was created, nil if neither is known
+func (r Resource) lastDelivery(hooks []webhook, now time.Time) *metav1.Time {
+	lastDeliveryReceivedLock.Lock()
+	last := lastDeliveryReceived
+	lastDeliveryReceivedLock.Unlock()
+	for _, hook := range r.withActivity(hooks, now) {
+		if hook.Activity.LastEvent != nil && hook.Activity.LastEvent.Time.After(last) {
+			last = hook.Activity.LastEvent.Time
+		}
+	}
+	if last.IsZero() {
+		return nil
+	}
+	return &metav1.Time{Time: last}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+func TestInfrastructureStatus(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	now := time.Now()
+	expiry := now.Add(7 * 24 * time.Hour).UTC().Truncate(time.Second)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: r.certSecretName(), Namespace: installNs},
+		Data:       map[string][]byte{"tls.crt": selfSignedCertificate(t, expiry)},
+	}
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: r.ingressName(), Namespace: installNs},
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{{Host: "mywebhooks.example.com"}},
+			TLS:   []v1beta1.IngressTLS{{Hosts: []string{"mywebhooks.example.com"}, SecretName: r.certSecretName()}},
+		},
+		Status: v1beta1.IngressStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}}},
+	}
+	replicas := int32(2)
+	listener := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: listenerServiceName(r.eventListenerName()), Namespace: installNs},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: listenerServiceName(r.eventListenerName()), Namespace: installNs},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+			NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+		}},
+	}
+	if _, err := r.K8sClient.CoreV1().Secrets(installNs).Create(secret); err != nil {
+		t.Fatalf("error creating secret: %s", err)
+	}
+	if _, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Create(ingress); err != nil {
+		t.Fatalf("error creating ingress: %s", err)
+	}
+	if _, err := r.K8sClient.AppsV1().Deployments(installNs).Create(listener); err != nil {
+		t.Fatalf("error creating deployment: %s", err)
+	}
+	if _, err := r.K8sClient.CoreV1().Endpoints(installNs).Create(endpoints); err != nil {
+		t.Fatalf("error creating endpoints: %s", err)
+	}
+	received := now.Add(-time.Hour).Truncate(time.Second)
+	lastDeliveryReceived = time.Time{}
+	recordDeliveryReceived(received)
+
+	status := r.infrastructureStatus(now)
+	if status.EventListener.Replicas != 2 || status.EventListener.ReadyReplicas != 1 {
+		t.Errorf("unexpected eventlistener %+v", status.EventListener)
+	}
+	if status.Service.ReadyEndpoints != 1 || status.Service.NotReadyEndpoints != 1 || status.Service.Error != "" {
+		t.Errorf("unexpected service %+v", status.Service)
+	}
+	if status.Exposure.Address != "203.0.113.10" || status.Exposure.CertExpiry != expiry.Format(time.RFC3339) {
+		t.Errorf("unexpected exposure %+v", status.Exposure)
+	}
+	if status.LastDelivery == nil || !status.LastDelivery.Time.Equal(received) {
+		t.Errorf("last delivery was %v, expected %s", status.LastDelivery, received)
+	}
+	// Half the eventlistener's replicas are ready and the certificate expires within 14 days
+	if status.Healthy || len(status.Problems) != 2 {
+		t.Errorf("expected two problems, got %v", status.Problems)
+	}
+}
+
+func TestInfrastructureStatusWithoutEventListener(t *testing.T) {
+	r := dummyResource()
+	status := r.infrastructureStatus(time.Now())
+	if status.Healthy || status.Service.Error != "not found" || status.Exposure.Error != "not found" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestEventListenerReady(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	// Without a Ready condition or a deployment
+	if ready, reason := r.eventListenerReady(el); ready || reason != "not found" {
+		t.Errorf("expected the missing deployment to be reported, got %v, %s", ready, reason)
+	}
+
+	el.Status.Conditions = append(el.Status.Conditions, apis.Condition{
+		Type:    apis.ConditionReady,
+		Status:  corev1.ConditionFalse,
+		Message: "Deployment does not have minimum availability",
+	})
+	if ready, reason := r.eventListenerReady(el); ready || reason != "eventlistener is not ready: Deployment does not have minimum availability" {
+		t.Errorf("expected the Ready condition's message, got %v, %s", ready, reason)
+	}
+
+	el.Status.Conditions[0].Status = corev1.ConditionTrue
+	if _, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Update(el); err != nil {
+		t.Fatalf("error updating eventlistener status: %s", err)
+	}
+	if !r.waitForEventListener(installNs, r.eventListenerName(), 1) {
+		t.Errorf("expected the eventlistener to be ready by its Ready condition")
+	}
+	if status := r.eventListenerStatus(1); status.Error != "" {
+		t.Errorf("unexpected eventlistener %+v", status)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sclientset "k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+/*--------------------------------------
+How the extension is installed is set by the config.yaml key of the
+webhooks-extension-install configmap in the install namespace, e.g.
+
+	platform: openshift
+	sslverification: true
+	webhooktlscertificate: my-listener-cert
+	webresourcesdir: web
+
+The configmap is read when the extension starts, which fails with the
+reason if it holds fields that don't exist or settings that can't be used
+together. Settings it doesn't hold are taken from the environment
+variables that used to set them, PLATFORM, SSL_VERIFICATION_ENABLED,
+WEBHOOK_TLS_CERTIFICATE and WEB_RESOURCES_DIR. See docs/InstallConfig.md.
+---------------------------------------*/
+
+const (
+	// Configmap in the install namespace holding the install configuration
+	installConfigMap = "webhooks-extension-install"
+	installConfigKey = "config.yaml"
+
+	platformKubernetes = "kubernetes"
+	platformOpenShift  = "openshift"
+)
+
+// InstallConfig is how the extension is installed
+type InstallConfig struct {
+	// kubernetes exposes the eventlistener with an ingress, openshift with a route
+	Platform string `json:"platform,omitempty"`
+	// Whether git servers verify the eventlistener's certificate and the extension and monitor verify theirs,
+	// true if not set
+	SSLVerification *bool `json:"sslverification,omitempty"`
+	// Secret holding the certificate of the eventlistener's ingress for an https callback URL, created if missing
+	WebhookTLSCertificate string `json:"webhooktlscertificate,omitempty"`
+	// Directory the dashboard's web bundle is served from
+	WebResourcesDir string `json:"webresourcesdir,omitempty"`
+}
+
+// loadInstallConfig reads the install configuration, from the environment where the configmap doesn't set it,
+// returning an error if it is not valid with the callback URL
+func loadInstallConfig(k8sClient k8sclientset.Interface, namespace, callbackURL string) (InstallConfig, error) {
+	config := InstallConfig{}
+	cm, err := k8sClient.CoreV1().ConfigMaps(namespace).Get(installConfigMap, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return config, fmt.Errorf("error reading configmap %s: %s", installConfigMap, err)
+	}
+	if err == nil {
+		if err := yaml.UnmarshalStrict([]byte(cm.Data[installConfigKey]), &config); err != nil {
+			return config, fmt.Errorf("invalid %s in configmap %s: %s", installConfigKey, installConfigMap, err)
+		}
+	}
+	config.setFromEnv()
+	if err := config.validate(callbackURL); err != nil {
+		return config, fmt.Errorf("invalid install configuration: %s", err)
+	}
+	logging.Log.Infof("install configuration: platform %s, ssl verification %t, web resources from %s",
+		config.Platform, config.sslVerification(), config.WebResourcesDir)
+	return config, nil
+}
+
+// setFromEnv sets the settings the configmap didn't from the environment
+func (c *InstallConfig) setFromEnv() {
+	if c.Platform == "" {
+		c.Platform = platformKubernetes
+		// Any value of PLATFORM has meant OpenShift
+		if _, set := os.LookupEnv("PLATFORM"); set {
+			c.Platform = platformOpenShift
+		}
+	}
+	if c.SSLVerification == nil {
+		if value, set := os.LookupEnv("SSL_VERIFICATION_ENABLED"); set {
+			verify := strings.ToLower(value) != "false"
+			c.SSLVerification = &verify
+		}
+	}
+	if c.WebhookTLSCertificate == "" {
+		c.WebhookTLSCertificate = os.Getenv("WEBHOOK_TLS_CERTIFICATE")
+	}
+	if c.WebResourcesDir == "" {
+		c.WebResourcesDir = os.Getenv("WEB_RESOURCES_DIR")
+	}
+}
+
+func (c InstallConfig) validate(callbackURL string) error {
+	c.Platform = strings.ToLower(c.Platform)
+	if c.Platform != platformKubernetes && c.Platform != platformOpenShift {
+		return fmt.Errorf("platform must be %s or %s, not %s", platformKubernetes, platformOpenShift, c.Platform)
+	}
+	if c.WebhookTLSCertificate != "" {
+		if c.Platform == platformOpenShift {
+			return fmt.Errorf("webhooktlscertificate %s can't be used on %s, whose route terminates TLS itself", c.WebhookTLSCertificate, platformOpenShift)
+		}
+		if callbackURL != "" && !strings.HasPrefix(callbackURL, "https://") {
+			return fmt.Errorf("webhooktlscertificate %s needs an https:// callback URL, not %s", c.WebhookTLSCertificate, callbackURL)
+		}
+	}
+	if c.SSLVerification != nil && *c.SSLVerification && strings.HasPrefix(callbackURL, "http://") {
+		logging.Log.Warnf("sslverification is true but callback URL %s isn't https, git servers won't verify the eventlistener", callbackURL)
+	}
+	return nil
+}
+
+// openShift is whether the eventlistener is exposed with an OpenShift route rather than an ingress
+func (c InstallConfig) openShift() bool {
+	return strings.ToLower(c.Platform) == platformOpenShift
+}
+
+// sslVerification is whether certificates are verified, true unless set to false
+func (c InstallConfig) sslVerification() bool {
+	return c.SSLVerification == nil || *c.SSLVerification
+}
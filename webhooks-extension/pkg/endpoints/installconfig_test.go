@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoadInstallConfig(t *testing.T) {
+	for _, name := range []string{"PLATFORM", "SSL_VERIFICATION_ENABLED", "WEBHOOK_TLS_CERTIFICATE", "WEB_RESOURCES_DIR"} {
+		if value, set := os.LookupEnv(name); set {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Unsetenv(name)
+	}
+	os.Setenv("SSL_VERIFICATION_ENABLED", "false")
+	os.Setenv("WEB_RESOURCES_DIR", "web")
+
+	tests := []struct {
+		name, yaml, callbackURL string
+		valid, openShift, ssl   bool
+		webResourcesDir         string
+	}{
+		{"none set", "", "https://listener.example.com", true, false, false, "web"},
+		{"all set", "platform: openshift\nsslverification: true\nwebresourcesdir: /ko-app/web", "https://listener.example.com", true, true, true, "/ko-app/web"},
+		{"certificate", "webhooktlscertificate: my-cert", "https://listener.example.com", true, false, false, "web"},
+		{"unknown field", "sslverfication: true", "https://listener.example.com", false, false, false, ""},
+		{"unknown platform", "platform: mesos", "https://listener.example.com", false, false, false, ""},
+		{"certificate on openshift", "platform: openshift\nwebhooktlscertificate: my-cert", "https://listener.example.com", false, false, false, ""},
+		{"certificate without https", "webhooktlscertificate: my-cert", "http://listener.example.com", false, false, false, ""},
+	}
+	for _, test := range tests {
+		r := dummyResource()
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: installConfigMap, Namespace: r.Defaults.Namespace},
+			Data:       map[string]string{installConfigKey: test.yaml},
+		}
+		r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Create(cm)
+		config, err := loadInstallConfig(r.K8sClient, r.Defaults.Namespace, test.callbackURL)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", test.name, config)
+			}
+			continue
+		}
+		if err != nil || config.openShift() != test.openShift || config.sslVerification() != test.ssl || config.WebResourcesDir != test.webResourcesDir {
+			t.Errorf("%s: unexpected install configuration %+v, %v", test.name, config, err)
+		}
+	}
+
+	os.Setenv("PLATFORM", "")
+	config, err := loadInstallConfig(dummyResource().K8sClient, installNs, "")
+	if err != nil || !config.openShift() {
+		t.Errorf("expected PLATFORM being set to mean openshift without the configmap, got %+v, %v", config, err)
+	}
+}
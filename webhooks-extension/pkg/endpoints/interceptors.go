@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+)
+
+/*--------------------------------------
+A webhook may chain its own CEL or webhook interceptors, e.g. an org policy
+service, onto its push and pull request triggers. They run after the
+built-in validator, which stays the first interceptor as the rest of the
+extension relies on its headers being at Interceptors[0]. The interceptors
+are kept on the triggers themselves so no binding param is needed to list
+them. The monitor trigger is shared by the webhooks on a repository and
+is left alone.
+---------------------------------------*/
+
+const validatorServiceName = "tekton-webhooks-extension-validator"
+
+// extraInterceptors is a pointer in webhook as a slice would stop webhooks being comparable
+type extraInterceptors []*v1alpha1.EventInterceptor
+
+func validateInterceptors(interceptors *extraInterceptors) error {
+	if interceptors == nil {
+		return nil
+	}
+	for i, interceptor := range *interceptors {
+		if interceptor == nil {
+			return fmt.Errorf("interceptor %d is empty", i)
+		}
+		switch {
+		case interceptor.Webhook != nil && interceptor.CEL != nil:
+			return fmt.Errorf("interceptor %d must be either a webhook or a cel interceptor, not both", i)
+		case interceptor.Webhook != nil:
+			if interceptor.Webhook.ObjectRef == nil || interceptor.Webhook.ObjectRef.Name == "" {
+				return fmt.Errorf("webhook interceptor %d must have an objectRef naming a service", i)
+			}
+			if interceptor.Webhook.ObjectRef.Name == validatorServiceName {
+				return fmt.Errorf("webhook interceptor %d can't be the built-in %s, which always runs first", i, validatorServiceName)
+			}
+		case interceptor.CEL != nil:
+		default:
+			return fmt.Errorf("interceptor %d must be a webhook or a cel interceptor", i)
+		}
+	}
+	return nil
+}
+
+// withInterceptors chains a webhook's interceptors after the built-in one on one of its triggers
+func withInterceptors(trigger v1alpha1.EventListenerTrigger, webhook webhook) v1alpha1.EventListenerTrigger {
+	if webhook.Interceptors == nil {
+		return trigger
+	}
+	for _, interceptor := range *webhook.Interceptors {
+		trigger.Interceptors = append(trigger.Interceptors, interceptor.DeepCopy())
+	}
+	return trigger
+}
+
+// getInterceptorsFromTrigger returns the interceptors chained after the built-in one
+func getInterceptorsFromTrigger(trigger v1alpha1.EventListenerTrigger) *extraInterceptors {
+	if len(trigger.Interceptors) < 2 {
+		return nil
+	}
+	interceptors := extraInterceptors{}
+	for _, interceptor := range trigger.Interceptors[1:] {
+		interceptors = append(interceptors, interceptor.DeepCopy())
+	}
+	return &interceptors
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func policyInterceptor() *v1alpha1.EventInterceptor {
+	return &v1alpha1.EventInterceptor{
+		Webhook: &v1alpha1.WebhookInterceptor{
+			ObjectRef: &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Name: "org-policy", Namespace: "policy"},
+		},
+	}
+}
+
+func TestValidateInterceptors(t *testing.T) {
+	tests := []struct {
+		name         string
+		interceptors *extraInterceptors
+		valid        bool
+	}{
+		{"none", nil, true},
+		{"webhook", &extraInterceptors{policyInterceptor()}, true},
+		{"cel", &extraInterceptors{{CEL: &v1alpha1.CELInterceptor{Filter: "body.ref == 'refs/heads/master'"}}}, true},
+		{"empty", &extraInterceptors{{}}, false},
+		{"no service", &extraInterceptors{{Webhook: &v1alpha1.WebhookInterceptor{}}}, false},
+		{"built-in", &extraInterceptors{{Webhook: &v1alpha1.WebhookInterceptor{ObjectRef: &corev1.ObjectReference{Name: validatorServiceName}}}}, false},
+	}
+	for _, tt := range tests {
+		err := validateInterceptors(tt.interceptors)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error %s", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestInterceptorsChainedOnTriggers(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "chained",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		Interceptors:     &extraInterceptors{policyInterceptor()},
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	for _, trigger := range el.Spec.Triggers {
+		expected := 2
+		if trigger.Name != "chained-default-push-event" && trigger.Name != "chained-default-pullrequest-event" {
+			expected = 1
+		}
+		if len(trigger.Interceptors) != expected {
+			t.Errorf("trigger %s has %d interceptors, expected %d", trigger.Name, len(trigger.Interceptors), expected)
+			continue
+		}
+		if trigger.Interceptors[0].Webhook.ObjectRef.Name != validatorServiceName {
+			t.Errorf("trigger %s doesn't run the built-in interceptor first", trigger.Name)
+		}
+	}
+
+	hooks, err := r.getHooksForRepo(hook.GitRepositoryURL)
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	if !reflect.DeepEqual(hooks[0].Interceptors, hook.Interceptors) {
+		t.Errorf("expected interceptors %+v, got %+v", *hook.Interceptors, hooks[0].Interceptors)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/{name}/complete").To(r.profiled(Resource.completeWebhook)))
+Once a webhook's triggers are on the eventlistener, creating it takes two
+more steps: exposing a new eventlistener with an ingress, or routes on
+OpenShift, and creating the provider's webhook for a repository without
+one. When either fails the webhook is left as far as it got, rather than
+unpicked, and the steps still to do are recorded in the operation journal,
+the webhooks-extension-operations configmap in the install namespace, a
+key per webhook as for its history (see history.go). GET /webhooks shows
+them as the webhook's incomplete field, and the webhook as unhealthy, and
+POST /webhooks/{name}/complete retries just those steps, then syncs the
+repository's monitor as creation does. An entry is removed once its steps
+are done, or when its webhook is deleted or created again.
+---------------------------------------*/
+
+const (
+	// Configmap in the install namespace holding the steps of webhook creations still to do
+	operationsConfigMap = "webhooks-extension-operations"
+	// Steps of webhook creation after the eventlistener is updated
+	stepExposure        = "exposure"
+	stepProviderWebhook = "providerwebhook"
+)
+
+// incompleteCreation is a journal entry, the steps still to do to create a webhook
+type incompleteCreation struct {
+	Steps []string `json:"steps"`
+	// Why the first of them failed
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// journalIncomplete records the steps still to do to create hook, the first of them having failed with err
+func (r Resource) journalIncomplete(hook webhook, steps []string, err error) {
+	entry := incompleteCreation{Steps: steps, Error: err.Error(), Time: time.Now().UTC()}
+	logging.Log.Infof("webhook %s in namespace %s was partially created, still to do: %s", hook.Name, hook.Namespace, strings.Join(steps, ", "))
+	if err := r.updateJournal(hook.Namespace, hook.Name, &entry); err != nil {
+		logging.Log.Errorf("error journalling the steps still to do to create webhook %s in namespace %s: %s", hook.Name, hook.Namespace, err)
+	}
+}
+
+// clearJournal removes the entry of the webhook from the journal, if it has one
+func (r Resource) clearJournal(namespace, name string) {
+	if err := r.updateJournal(namespace, name, nil); err != nil {
+		logging.Log.Errorf("error clearing the journal entry of webhook %s in namespace %s: %s", name, namespace, err)
+	}
+}
+
+// updateJournal sets the journal entry of the webhook, removing it if entry is nil
+func (r Resource) updateJournal(namespace, name string, entry *incompleteCreation) error {
+	installNs := r.Defaults.Namespace
+	configMaps := r.K8sClient.CoreV1().ConfigMaps(installNs)
+	key := r.historyKey(namespace, name)
+	cm, err := configMaps.Get(operationsConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		if entry == nil {
+			return nil
+		}
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: operationsConfigMap, Namespace: installNs, Labels: managedLabels()}}
+		cm.Data = map[string]string{}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		cm.Data[key] = string(data)
+		_, err = configMaps.Create(cm)
+		return err
+	} else if err != nil {
+		return err
+	}
+	if entry == nil {
+		if _, found := cm.Data[key]; !found {
+			return nil
+		}
+		delete(cm.Data, key)
+	} else {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[key] = string(data)
+	}
+	_, err = configMaps.Update(cm)
+	return err
+}
+
+// getJournal returns the journal's entries by history key
+func (r Resource) getJournal() (map[string]incompleteCreation, error) {
+	entries := map[string]incompleteCreation{}
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(operationsConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range cm.Data {
+		entry := incompleteCreation{}
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			logging.Log.Errorf("ignoring the unreadable entry %s of configmap %s: %s", key, operationsConfigMap, err)
+			continue
+		}
+		entries[key] = entry
+	}
+	return entries, nil
+}
+
+// withJournal sets the steps still to do of the hooks whose creation is incomplete, making them unhealthy
+func (r Resource) withJournal(hooks []webhook) []webhook {
+	entries, err := r.getJournal()
+	if err != nil {
+		logging.Log.Errorf("error reading configmap %s, incomplete webhooks aren't shown: %s", operationsConfigMap, err)
+		return hooks
+	}
+	for i, hook := range hooks {
+		entry, found := entries[r.historyKey(hook.Namespace, hook.Name)]
+		if !found {
+			continue
+		}
+		hooks[i].Incomplete = &entry
+		if hooks[i].Health == nil {
+			hooks[i].Health = &webhookHealth{}
+		}
+		hooks[i].Health.Healthy = false
+		hooks[i].Health.Problems = append(hooks[i].Health.Problems,
+			fmt.Sprintf("creation incomplete, %s still to do: %s", strings.Join(entry.Steps, " and "), entry.Error))
+	}
+	return hooks
+}
+
+// POST /webhooks/{name}/complete?namespace=x
+func (r Resource) completeWebhook(request *restful.Request, response *restful.Response) {
+	name, namespace, ok := webhookRef(request, response)
+	if !ok {
+		return
+	}
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error trying to get webhooks: %s.", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	var hook *webhook
+	for i := range hooks {
+		if hooks[i].Name == name && hooks[i].Namespace == namespace {
+			hook = &hooks[i]
+		}
+	}
+	if hook == nil {
+		RespondError(response, newMessageError("WEBHOOK_NOT_FOUND", map[string]string{"name": name, "namespace": namespace}), http.StatusNotFound)
+		return
+	}
+	entries, err := r.getJournal()
+	if err != nil {
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	entry, found := entries[r.historyKey(namespace, name)]
+	if !found {
+		err := fmt.Errorf("webhook %s in namespace %s was created completely, there is nothing to complete", name, namespace)
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusConflict)
+		return
+	}
+
+	_, gitOwner, gitRepo, err := r.getGitValues(hook.GitRepositoryURL)
+	if err != nil {
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	for i, step := range entry.Steps {
+		if err := r.completeStep(*hook, step, gitOwner, gitRepo); err != nil {
+			logging.Log.Errorf("error completing step %s of webhook %s in namespace %s: %s", step, name, namespace, err)
+			r.journalIncomplete(*hook, entry.Steps[i:], err)
+			RespondError(response, err, providerErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		logging.Log.Infof("completed step %s of webhook %s in namespace %s", step, name, namespace)
+	}
+	r.syncMonitor(hook.GitRepositoryURL, monitorTriggerPrefix(gitOwner, gitRepo))
+	r.clearJournal(namespace, name)
+	hook.Incomplete = nil
+	response.WriteEntity(hook)
+}
+
+// completeStep does a step of creating hook
+func (r Resource) completeStep(hook webhook, step, gitOwner, gitRepo string) error {
+	switch step {
+	case stepExposure:
+		if err := r.exposeEventListener(); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+		return nil
+	case stepProviderWebhook:
+		// Give the eventlistener a chance to answer the provider's ping
+		r.waitForEventListener(r.Defaults.Namespace, r.eventListenerName(), 30)
+		// Does nothing if the provider's webhook was made meanwhile
+		return r.AddWebhook(hook, gitOwner, gitRepo)
+	}
+	return fmt.Errorf("unknown step %s", step)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func completeHook(r *Resource, name, namespace string) int {
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/"+name+"/complete?namespace="+namespace, nil)
+	httpWriter := httptest.NewRecorder()
+	r.completeWebhook(dummyRestfulRequest(httpReq, name), dummyRestfulResponse(httpWriter))
+	return httpWriter.Code
+}
+
+func TestCompleteWebhook(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	// Created completely
+	if status := completeHook(r, "hook", installNs); status != http.StatusConflict {
+		t.Errorf("expected 409 completing a complete webhook, got %d", status)
+	}
+	if status := completeHook(r, "missing", installNs); status != http.StatusNotFound {
+		t.Errorf("expected 404 completing an unknown webhook, got %d", status)
+	}
+
+	// The ingress wasn't created
+	r.journalIncomplete(hook, []string{stepExposure}, errors.New("ingress quota exceeded"))
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		t.Fatalf("error getting webhooks: %s", err)
+	}
+	hooks = r.withJournal(r.withHealth(hooks))
+	if len(hooks) != 1 || hooks[0].Incomplete == nil || hooks[0].Health == nil || hooks[0].Health.Healthy {
+		t.Fatalf("expected the webhook to be incomplete and unhealthy, got %+v", hooks)
+	}
+	if steps := hooks[0].Incomplete.Steps; len(steps) != 1 || steps[0] != stepExposure || hooks[0].Incomplete.Error != "ingress quota exceeded" {
+		t.Errorf("unexpected journal entry %+v", hooks[0].Incomplete)
+	}
+
+	if status := completeHook(r, "hook", installNs); status != http.StatusOK {
+		t.Fatalf("expected 200 completing the webhook, got %d", status)
+	}
+	if _, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Get(r.ingressName(), metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the ingress to be created: %s", err)
+	}
+	if entries, err := r.getJournal(); err != nil || len(entries) != 0 {
+		t.Errorf("expected the journal entry to be cleared, got %+v, %v", entries, err)
+	}
+	if status := completeHook(r, "hook", installNs); status != http.StatusConflict {
+		t.Errorf("expected 409 completing the webhook again, got %d", status)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+A webhook's label routes run other pipelines, as well as its own, for pull
+requests with a label, e.g. the long end to end suite for pull requests
+labelled e2e. Each route gets a pull request trigger named
+<webhook>-<namespace>-pullrequest-label-<n> using the route's pipeline's
+template and bindings, with the label as the Wext-Route-Label header. The
+interceptor accepts an event on it when the pull request has the label,
+and also runs it when the label is added, the labeled action on GitHub or
+a merge request update adding it on GitLab, but not for other labels being
+added. Removing the label runs nothing. The routes are kept as a binding
+param.
+---------------------------------------*/
+
+const (
+	routeLabelHeader = "Wext-Route-Label"
+	// Pull request action of a label being added on GitHub
+	labeledAction = "labeled"
+	// Most label routes a webhook may have
+	maxLabelRoutes = 5
+)
+
+// labelRoute runs another pipeline for pull requests with a label
+type labelRoute struct {
+	Label    string `json:"label"`
+	Pipeline string `json:"pipeline"`
+}
+
+// labelTriggerSuffixes end the names of the triggers of a webhook's label routes after <name>-<namespace>
+func labelTriggerSuffixes() []string {
+	suffixes := []string{}
+	for i := 0; i < maxLabelRoutes; i++ {
+		suffixes = append(suffixes, "-pullrequest-label-"+strconv.Itoa(i))
+	}
+	return suffixes
+}
+
+// validateLabelRoutes checks the routes and that each route's pipeline has a template and pull request binding
+func (r Resource) validateLabelRoutes(webhook webhook) error {
+	if len(webhook.LabelRoutes) > maxLabelRoutes {
+		return fmt.Errorf("labelroutes may have at most %d routes", maxLabelRoutes)
+	}
+	labels := map[string]bool{}
+	installNs := r.Defaults.Namespace
+	for _, route := range webhook.LabelRoutes {
+		if route.Label == "" || route.Pipeline == "" {
+			return errors.New("each of labelroutes requires a label and a pipeline")
+		}
+		if route.Pipeline == webhook.Pipeline {
+			return fmt.Errorf("labelroutes pipeline %s is the webhook's pipeline", route.Pipeline)
+		}
+		if labels[route.Label] {
+			return fmt.Errorf("labelroutes has more than one route for label %s", route.Label)
+		}
+		labels[route.Label] = true
+		if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(route.Pipeline+"-pullrequest-binding", metav1.GetOptions{}); err != nil {
+			return fmt.Errorf("labelroutes triggerbinding %s could not be found: %s", route.Pipeline+"-pullrequest-binding", err)
+		}
+		if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(route.Pipeline+"-template", metav1.GetOptions{}); err != nil {
+			return fmt.Errorf("labelroutes triggertemplate %s could not be found: %s", route.Pipeline+"-template", err)
+		}
+	}
+	return nil
+}
+
+// labelRouteParams is the binding param recording the webhook's label routes
+func labelRouteParams(webhook webhook) []v1alpha1.Param {
+	if len(webhook.LabelRoutes) == 0 {
+		return []v1alpha1.Param{}
+	}
+	routesJSON, err := json.Marshal(webhook.LabelRoutes)
+	if err != nil {
+		logging.Log.Errorf("error marshalling labelroutes: %s", err)
+	}
+	return []v1alpha1.Param{{Name: "webhooks-tekton-label-routes", Value: string(routesJSON)}}
+}
+
+// withLabelRoutes returns the webhook's triggers followed by the triggers of its label routes
+func withLabelRoutes(webhook webhook, triggers []v1alpha1.EventListenerTrigger) []v1alpha1.EventListenerTrigger {
+	prefix := triggerPrefix(webhook)
+	var pullRequest *v1alpha1.EventListenerTrigger
+	for i := range triggers {
+		if triggers[i].Name == prefix+"-pullrequest-event" {
+			pullRequest = &triggers[i]
+		}
+	}
+	if pullRequest == nil {
+		return triggers
+	}
+	suffixes := labelTriggerSuffixes()
+	for i, route := range webhook.LabelRoutes {
+		// Every pull request with the label runs the route's pipeline, whoever opened it
+		routed := withoutHeaders(canaryTrigger(*pullRequest, prefix+suffixes[i], route.Pipeline+"-pullrequest-binding", route.Pipeline+"-template"),
+			canaryRouteHeader, canaryPercentageHeader, canaryLabelHeader, dependencyRouteHeader, dependencySendersHeader, fileRulesHeader)
+		for j, header := range routed.Interceptors[0].Webhook.Header {
+			if header.Name == "Wext-Incoming-Actions" {
+				routed.Interceptors[0].Webhook.Header[j].Value.StringVal += "," + labeledAction
+			}
+		}
+		routed.Interceptors[0].Webhook.Header = append(routed.Interceptors[0].Webhook.Header,
+			pipelinesv1alpha1.Param{Name: routeLabelHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: route.Label}})
+		triggers = append(triggers, routed)
+	}
+	return triggers
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateLabelRoutes(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, Pipeline: "pipeline1"}
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+
+	valid := [][]labelRoute{
+		nil,
+		{{Label: "e2e", Pipeline: "pipeline2"}},
+		{{Label: "e2e", Pipeline: "pipeline2"}, {Label: "perf", Pipeline: "pipeline2"}},
+	}
+	for _, routes := range valid {
+		hook.LabelRoutes = routes
+		if err := r.validateLabelRoutes(hook); err != nil {
+			t.Errorf("unexpected error for labelroutes %+v: %s", routes, err)
+		}
+	}
+	tooMany := []labelRoute{}
+	for _, label := range []string{"a", "b", "c", "d", "e", "f"} {
+		tooMany = append(tooMany, labelRoute{Label: label, Pipeline: "pipeline2"})
+	}
+	invalid := [][]labelRoute{
+		{{Label: "e2e"}},
+		{{Pipeline: "pipeline2"}},
+		{{Label: "e2e", Pipeline: "pipeline1"}},
+		{{Label: "e2e", Pipeline: "pipeline2"}, {Label: "e2e", Pipeline: "pipeline2"}},
+		{{Label: "e2e", Pipeline: "pipeline3"}},
+		tooMany,
+	}
+	for _, routes := range invalid {
+		hook.LabelRoutes = routes
+		if err := r.validateLabelRoutes(hook); err == nil {
+			t.Errorf("expected an error for labelroutes %+v", routes)
+		}
+	}
+}
+
+func TestCreateEventListenerWithLabelRoutes(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		Canary:           &canaryRoute{Pipeline: "pipeline2", Percentage: 10},
+		LabelRoutes:      []labelRoute{{Label: "e2e", Pipeline: "pipeline3"}},
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	createTriggerResources(webhook{Pipeline: "pipeline3"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	found := false
+	for _, trigger := range el.Spec.Triggers {
+		if trigger.Name != "hook-default-pullrequest-label-0" {
+			if triggerHeader(trigger, routeLabelHeader) != "" {
+				t.Errorf("trigger %s has the route label header", trigger.Name)
+			}
+			continue
+		}
+		found = true
+		if trigger.Template.Name != "pipeline3-template" || trigger.Bindings[0].Ref != "pipeline3-pullrequest-binding" {
+			t.Errorf("label trigger uses %s and %s", trigger.Template.Name, trigger.Bindings[0].Ref)
+		}
+		if triggerHeader(trigger, routeLabelHeader) != "e2e" || triggerHeader(trigger, canaryRouteHeader) != "" {
+			t.Error("expected the label trigger to be routed e2e labelled pull requests and not canary events")
+		}
+		if actions := triggerHeader(trigger, "Wext-Incoming-Actions"); !strings.HasSuffix(actions, ","+labeledAction) {
+			t.Errorf("label trigger has actions %s", actions)
+		}
+		if name := triggerHeader(trigger, "Wext-Trigger-Name"); name != trigger.Name {
+			t.Errorf("label trigger has Wext-Trigger-Name %s", name)
+		}
+	}
+	if !found {
+		t.Error("label trigger was not created")
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	if !reflect.DeepEqual(hooks[0].LabelRoutes, hook.LabelRoutes) {
+		t.Errorf("labelroutes was %+v, expected %+v", hooks[0].LabelRoutes, hook.LabelRoutes)
+	}
+}
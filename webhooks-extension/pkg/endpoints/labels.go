@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"regexp"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Every resource the extension creates is labelled as managed by it. Those
+created for a webhook, its triggerbinding and any overrides template, are
+also labelled with the webhook, its repository and the owner and cost
+center given when it was created, so they can be found with a label
+selector, see docs/Labels.md. Triggers are entries in the eventlistener
+rather than resources, so can't be labelled. Label values are restricted
+so the owner and cost center are also kept, as given, in annotations.
+---------------------------------------*/
+
+const (
+	partOfLabel           = "app.kubernetes.io/part-of"
+	managedByLabel        = "app.kubernetes.io/managed-by"
+	extensionLabelValue   = "tekton-webhooks-extension"
+	webhookLabel          = "webhooks.tekton.dev/webhook"
+	webhookNamespaceLabel = "webhooks.tekton.dev/webhookNamespace"
+	gitServerLabel        = "webhooks.tekton.dev/gitServer"
+	gitOrgLabel           = "webhooks.tekton.dev/gitOrg"
+	gitRepoLabel          = "webhooks.tekton.dev/gitRepo"
+	ownerLabel            = "webhooks.tekton.dev/owner"
+	costCenterLabel       = "webhooks.tekton.dev/costCenter"
+	maxLabelValueLength   = 63
+)
+
+var invalidLabelValueChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// managedLabels are the labels of every resource the extension creates
+func managedLabels() map[string]string {
+	return map[string]string{
+		partOfLabel:    extensionLabelValue,
+		managedByLabel: extensionLabelValue,
+	}
+}
+
+// repoLabels are the labels of resources shared by the webhooks on a repository
+func (r Resource) repoLabels(repoURL string) map[string]string {
+	labels := managedLabels()
+	server, org, repo, err := r.getGitValues(repoURL)
+	if err != nil {
+		logging.Log.Errorf("error getting git values to label resources for %s: %s", repoURL, err)
+		return labels
+	}
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	labels[gitServerLabel] = labelValue(server)
+	labels[gitOrgLabel] = labelValue(org)
+	labels[gitRepoLabel] = labelValue(repo)
+	return labels
+}
+
+// webhookLabels are the labels of resources created for a single webhook
+func (r Resource) webhookLabels(webhook webhook) map[string]string {
+	labels := r.repoLabels(webhook.GitRepositoryURL)
+	labels[webhookLabel] = labelValue(webhook.Name)
+	labels[webhookNamespaceLabel] = labelValue(webhook.Namespace)
+	if webhook.Owner != "" {
+		labels[ownerLabel] = labelValue(webhook.Owner)
+	}
+	if webhook.CostCenter != "" {
+		labels[costCenterLabel] = labelValue(webhook.CostCenter)
+	}
+	return labels
+}
+
+// isWebhookResource reports whether a resource was created by the extension for a single webhook, rather than by
+// users or for a starter, whatever its name
+func isWebhookResource(meta metav1.ObjectMeta) bool {
+	return meta.Labels[managedByLabel] == extensionLabelValue && meta.Labels[webhookLabel] != ""
+}
+
+// webhookAnnotations keep the owner and cost center of a webhook as given
+func webhookAnnotations(webhook webhook) map[string]string {
+	annotations := map[string]string{}
+	if webhook.Owner != "" {
+		annotations[ownerLabel] = webhook.Owner
+	}
+	if webhook.CostCenter != "" {
+		annotations[costCenterLabel] = webhook.CostCenter
+	}
+	return annotations
+}
+
+// costCenterParams is the binding param recording the webhook's cost center, its owner is in expiryParams
+func costCenterParams(webhook webhook) []v1alpha1.Param {
+	if webhook.CostCenter == "" {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: "webhooks-tekton-cost-center", Value: webhook.CostCenter}}
+}
+
+// withLabels returns labels with extra added, neither being changed
+func withLabels(labels, extra map[string]string) map[string]string {
+	merged := map[string]string{}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	for key, value := range extra {
+		merged[key] = value
+	}
+	return merged
+}
+
+// labelValue makes s a valid label value, e.g. alice@example.com becomes alice-example.com
+func labelValue(s string) string {
+	value := invalidLabelValueChars.ReplaceAllString(s, "-")
+	if len(value) > maxLabelValueLength {
+		value = value[:maxLabelValueLength]
+	}
+	return strings.Trim(value, "-_.")
+}
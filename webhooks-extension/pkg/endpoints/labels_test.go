@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLabelValue(t *testing.T) {
+	tests := map[string]string{
+		"team-a":                "team-a",
+		"alice@example.com":     "alice-example.com",
+		"CC 1234/ops":           "CC-1234-ops",
+		"_leading.":             "leading",
+		strings.Repeat("a", 70): strings.Repeat("a", maxLabelValueLength),
+	}
+	for value, expected := range tests {
+		if got := labelValue(value); got != expected {
+			t.Errorf("labelValue(%s) was %s, expected %s", value, got, expected)
+		}
+	}
+}
+
+func TestWebhookLabels(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		Owner:            "alice@example.com",
+		CostCenter:       "CC 1234",
+	}
+	expected := map[string]string{
+		partOfLabel:           extensionLabelValue,
+		managedByLabel:        extensionLabelValue,
+		webhookLabel:          "hook",
+		webhookNamespaceLabel: installNs,
+		gitServerLabel:        "github.com",
+		gitOrgLabel:           "owner",
+		gitRepoLabel:          "repo",
+		ownerLabel:            "alice-example.com",
+		costCenterLabel:       "CC-1234",
+	}
+	labels := r.webhookLabels(hook)
+	if len(labels) != len(expected) {
+		t.Errorf("expected labels %v, got %v", expected, labels)
+	}
+	for key, value := range expected {
+		if labels[key] != value {
+			t.Errorf("label %s was %s, expected %s", key, labels[key], value)
+		}
+	}
+	if annotations := webhookAnnotations(hook); annotations[costCenterLabel] != "CC 1234" || annotations[ownerLabel] != "alice@example.com" {
+		t.Errorf("unexpected annotations %v", annotations)
+	}
+}
+
+func TestCreateBindingsLabelled(t *testing.T) {
+	r := dummyResource()
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		CostCenter:       "cc-42",
+	}
+	hookBinding, monitorBinding, err := r.createBindings(hook, "owner.repo-0", true)
+	if err != nil {
+		t.Fatalf("error creating bindings: %s", err)
+	}
+
+	binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(hookBinding, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting binding %s: %s", hookBinding, err)
+	}
+	if binding.Labels[webhookLabel] != "hook" || binding.Labels[costCenterLabel] != "cc-42" || binding.Labels[managedByLabel] != extensionLabelValue {
+		t.Errorf("unexpected labels on the webhook's binding: %v", binding.Labels)
+	}
+	found := false
+	for _, param := range binding.Spec.Params {
+		found = found || (param.Name == "webhooks-tekton-cost-center" && param.Value == "cc-42")
+	}
+	if !found {
+		t.Errorf("cost center param missing from the webhook's binding: %+v", binding.Spec.Params)
+	}
+
+	binding, err = r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(monitorBinding, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting binding %s: %s", monitorBinding, err)
+	}
+	if _, ok := binding.Labels[webhookLabel]; ok || binding.Labels[gitRepoLabel] != "repo" {
+		t.Errorf("unexpected labels on the monitor binding: %v", binding.Labels)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"strings"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+A webhook's mainbranchpipeline runs for pushes to the repository's default
+branch instead of the webhook's pipeline, e.g. to publish and deploy what's
+merged while pushes to other branches build and test. The default branch
+is the webhook's defaultbranch, see defaultbranch.go, without which the
+webhook can't be created. The pipeline is run through a
+<webhook>-<namespace>-push-main trigger using its template and push
+binding. All of the webhook's push triggers carry the branch as a header
+and the interceptor accepts each push on exactly one of them: the main
+trigger for a push to the branch, else the webhook's own (or canary, or
+file rule) trigger. Pull requests aren't routed. The pipeline is kept as a
+binding param.
+---------------------------------------*/
+
+const (
+	// The webhook's main branch, set on all of its push triggers
+	mainBranchHeader = "Wext-Main-Branch"
+	// Set on the trigger running the main branch pipeline
+	mainRouteHeader         = "Wext-Main-Route"
+	mainBranchTriggerSuffix = "-push-main"
+)
+
+// validateMainBranchPipeline checks that the main branch pipeline has a template and push binding
+func (r Resource) validateMainBranchPipeline(webhook webhook) error {
+	if webhook.MainPipeline == "" {
+		return nil
+	}
+	if webhook.MainPipeline == webhook.Pipeline {
+		return fmt.Errorf("mainbranchpipeline %s is the webhook's pipeline", webhook.MainPipeline)
+	}
+	installNs := r.Defaults.Namespace
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(webhook.MainPipeline+"-push-binding", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("mainbranchpipeline triggerbinding %s could not be found: %s", webhook.MainPipeline+"-push-binding", err)
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(webhook.MainPipeline+"-template", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("mainbranchpipeline triggertemplate %s could not be found: %s", webhook.MainPipeline+"-template", err)
+	}
+	return nil
+}
+
+// mainBranchParams is the binding param recording the main branch pipeline
+func mainBranchParams(webhook webhook) []v1alpha1.Param {
+	if webhook.MainPipeline == "" {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: "webhooks-tekton-main-branch-pipeline", Value: webhook.MainPipeline}}
+}
+
+// withMainBranch returns the webhook's triggers followed, if it has a main branch pipeline, by the trigger
+// running it, its push triggers carrying the branch to route on
+func withMainBranch(webhook webhook, triggers []v1alpha1.EventListenerTrigger) []v1alpha1.EventListenerTrigger {
+	if webhook.MainPipeline == "" {
+		return triggers
+	}
+	prefix := triggerPrefix(webhook)
+	branch := pipelinesv1alpha1.Param{Name: mainBranchHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.DefaultBranch}}
+	main := []v1alpha1.EventListenerTrigger{}
+	for i, trigger := range triggers {
+		if trigger.Name == prefix+"-push-event" {
+			// Every push to the main branch runs the main branch pipeline, whatever the canary split or files changed
+			routed := withoutHeaders(canaryTrigger(trigger, prefix+mainBranchTriggerSuffix, webhook.MainPipeline+"-push-binding", webhook.MainPipeline+"-template"),
+				canaryRouteHeader, canaryPercentageHeader, canaryLabelHeader, fileRulesHeader)
+			routed.Interceptors[0].Webhook.Header = append(routed.Interceptors[0].Webhook.Header, branch,
+				pipelinesv1alpha1.Param{Name: mainRouteHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "main"}})
+			main = append(main, routed)
+		}
+		if strings.HasPrefix(trigger.Name, prefix+"-push-") {
+			triggers[i].Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header, branch)
+		}
+	}
+	return append(triggers, main...)
+}
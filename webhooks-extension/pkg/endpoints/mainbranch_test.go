@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestValidateMainBranchPipeline(t *testing.T) {
+	r := dummyResource()
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	for pipeline, valid := range map[string]bool{"": true, "pipeline2": true, "pipeline1": false, "pipeline3": false} {
+		err := r.validateMainBranchPipeline(webhook{Name: "hook", Namespace: installNs, Pipeline: "pipeline1", MainPipeline: pipeline})
+		if (err == nil) != valid {
+			t.Errorf("mainbranchpipeline %q valid was %t, expected %t: %v", pipeline, err == nil, valid, err)
+		}
+	}
+}
+
+func TestCreateEventListenerWithMainBranch(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		Canary:           &canaryRoute{Pipeline: "pipeline2", Percentage: 10},
+		MainPipeline:     "pipeline3",
+		DefaultBranch:    "main",
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	createTriggerResources(webhook{Pipeline: "pipeline3"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	expected := map[string]string{
+		"hook-default-push-event":        "main",
+		"hook-default-push-canary":       "main",
+		"hook-default-push-main":         "main",
+		"hook-default-pullrequest-event": "",
+	}
+	for _, trigger := range el.Spec.Triggers {
+		branch, found := expected[trigger.Name]
+		if !found {
+			continue
+		}
+		delete(expected, trigger.Name)
+		if got := triggerHeader(trigger, mainBranchHeader); got != branch {
+			t.Errorf("trigger %s main branch was %q, expected %q", trigger.Name, got, branch)
+		}
+		if trigger.Name != "hook-default-push-main" {
+			continue
+		}
+		if trigger.Template.Name != "pipeline3-template" || trigger.Bindings[0].Ref != "pipeline3-push-binding" {
+			t.Errorf("main branch trigger uses %s and %s", trigger.Template.Name, trigger.Bindings[0].Ref)
+		}
+		if triggerHeader(trigger, mainRouteHeader) != "main" || triggerHeader(trigger, canaryRouteHeader) != "" {
+			t.Error("expected the main branch trigger to be routed main branch pushes and not canary events")
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("triggers %v were not created", expected)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	if hooks[0].MainPipeline != "pipeline3" || hooks[0].DefaultBranch != "main" {
+		t.Errorf("main branch pipeline was %q for %q", hooks[0].MainPipeline, hooks[0].DefaultBranch)
+	}
+}
+
+func TestReplayProviderDefaultBranch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/github/owner/repo.json"
+	provider := replayProvider{Resource: dummyResource(), Path: path}
+
+	if branch, err := provider.DefaultBranch(); err != nil || branch != "master" {
+		t.Errorf("expected master without a recording, got %q, %v", branch, err)
+	}
+	if err := saveRecording(path, recording{DefaultBranch: "main"}); err != nil {
+		t.Fatal(err)
+	}
+	if branch, err := provider.DefaultBranch(); err != nil || branch != "main" {
+		t.Errorf("expected the recorded main, got %q, %v", branch, err)
+	}
+}
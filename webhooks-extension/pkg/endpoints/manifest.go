@@ -0,0 +1,456 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+/*--------------------------------------
+A repository can describe its own webhooks in .tekton/webhooks.yaml on its
+default branch, a list of webhooks as POST /webhooks takes them without
+their gitrepositoryurl and accesstoken:
+
+	webhooks:
+	- name: build
+	  namespace: green
+	  pipeline: build-pipeline
+	- name: deploy
+	  pipeline: deploy-pipeline
+	  serviceaccount: deployer
+
+POST /webhooks/manifests, given the repository and an access token, reads
+the manifest and creates its webhooks, a webhook without a namespace going
+in the namespace given with the repository. The repository is recorded in
+the webhooks-extension-manifests configmap in the install namespace, and
+each time its manifest is synced:
+
+	- webhooks in the manifest that don't exist are created
+	- webhooks whose settings differ from the manifest's are re-created
+	- webhooks created from the manifest and since removed from it are deleted
+
+Webhooks created another way are left alone unless the manifest names them.
+POST /webhooks/manifests/sync syncs a recorded repository again, the
+interceptor calling it on pushes to the default branch that change the
+manifest. As a sync reads the manifest from the git server, not the caller,
+it needs no credentials.
+---------------------------------------*/
+
+const (
+	manifestPath = ".tekton/webhooks.yaml"
+	// Configmap in the install namespace recording the repositories whose manifests are synced
+	manifestsConfigMap = "webhooks-extension-manifests"
+)
+
+var manifestKeySanitizer = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// webhookManifest is the contents of a manifest
+type webhookManifest struct {
+	Webhooks []webhook `json:"webhooks"`
+}
+
+// manifestSource is a repository whose manifest is synced
+type manifestSource struct {
+	GitRepositoryURL string `json:"gitrepositoryurl"`
+	AccessTokenRef   string `json:"accesstoken"`
+	// Namespace of the manifest's webhooks that don't set one
+	Namespace string `json:"namespace"`
+	// The webhooks created from the manifest, as namespace/name
+	Webhooks []string  `json:"webhooks"`
+	SyncedAt time.Time `json:"syncedat,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// manifestResult is what a sync did to a webhook of the manifest
+type manifestResult struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// created, recreated, deleted or unchanged
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+type manifestSyncResponse struct {
+	GitRepositoryURL string           `json:"gitrepositoryurl"`
+	Results          []manifestResult `json:"results"`
+}
+
+// resultRecorder keeps the status and body a handler called by the extension itself responds with
+type resultRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *resultRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *resultRecorder) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *resultRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func manifestKey(repoURL string) string {
+	return manifestKeySanitizer.ReplaceAllString(canonicalRepoURL(repoURL), ".")
+}
+
+// getManifestSources returns the recorded repositories by key, and the configmap if it exists
+func (r Resource) getManifestSources() (map[string]manifestSource, *corev1.ConfigMap, error) {
+	sources := map[string]manifestSource{}
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(manifestsConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return sources, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading configmap %s: %s", manifestsConfigMap, err)
+	}
+	for key, value := range cm.Data {
+		source := manifestSource{}
+		if err := json.Unmarshal([]byte(value), &source); err != nil {
+			logging.Log.Errorf("ignoring %s in configmap %s: %s", key, manifestsConfigMap, err)
+			continue
+		}
+		sources[key] = source
+	}
+	return sources, cm, nil
+}
+
+// saveManifestSource records source, creating the configmap if it does not exist
+func (r Resource) saveManifestSource(source manifestSource) error {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	_, cm, err := r.getManifestSources()
+	if err != nil {
+		return err
+	}
+	configMaps := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace)
+	if cm == nil {
+		_, err = configMaps.Create(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: manifestsConfigMap, Namespace: r.Defaults.Namespace},
+			Data:       map[string]string{manifestKey(source.GitRepositoryURL): string(data)},
+		})
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[manifestKey(source.GitRepositoryURL)] = string(data)
+	_, err = configMaps.Update(cm)
+	return err
+}
+
+// readManifest reads and validates the manifest of source, filling in the repository, access token and namespace
+func (r Resource) readManifest(source manifestSource) ([]webhook, error) {
+	_, gitOwner, gitRepo, err := r.getGitValues(source.GitRepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := r.createGitProviderForWebhook(webhook{GitRepositoryURL: source.GitRepositoryURL, AccessTokenRef: source.AccessTokenRef}, gitOwner, gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	data, err := provider.GetFile(manifestPath)
+	if err == errFileNotFound {
+		return nil, fmt.Errorf("%s has no %s on its default branch", source.GitRepositoryURL, manifestPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s from %s: %s", manifestPath, source.GitRepositoryURL, err)
+	}
+	manifest := webhookManifest{}
+	if err := yaml.UnmarshalStrict(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", manifestPath, err)
+	}
+	seen := map[string]bool{}
+	for i := range manifest.Webhooks {
+		hook := &manifest.Webhooks[i]
+		if hook.Name == "" {
+			return nil, fmt.Errorf("invalid %s: webhook %d has no name", manifestPath, i)
+		}
+		if hook.GitRepositoryURL != "" || hook.AccessTokenRef != "" {
+			return nil, fmt.Errorf("invalid %s: webhook %s sets gitrepositoryurl or accesstoken, which are the manifest's own", manifestPath, hook.Name)
+		}
+		hook.GitRepositoryURL = source.GitRepositoryURL
+		hook.AccessTokenRef = source.AccessTokenRef
+		if hook.Namespace == "" {
+			hook.Namespace = source.Namespace
+		}
+		if seen[hook.Namespace+"/"+hook.Name] {
+			return nil, fmt.Errorf("invalid %s: webhook %s in namespace %s is listed twice", manifestPath, hook.Name, hook.Namespace)
+		}
+		seen[hook.Namespace+"/"+hook.Name] = true
+	}
+	return manifest.Webhooks, nil
+}
+
+// differsFromManifest is whether existing lacks any setting the manifest's entry sets
+func differsFromManifest(existing, entry webhook) bool {
+	var existingFields, entryFields map[string]interface{}
+	// The starter and namespace creation are only used to create the webhook, see starters.go and onboard.go
+	entry.Starter = ""
+	entry.CreateNamespaceIfMissing = false
+	existingJSON, _ := json.Marshal(existing)
+	entryJSON, _ := json.Marshal(entry)
+	json.Unmarshal(existingJSON, &existingFields)
+	json.Unmarshal(entryJSON, &entryFields)
+	for field, value := range entryFields {
+		if isZeroSetting(value) {
+			continue
+		}
+		if !reflect.DeepEqual(existingFields[field], value) {
+			return true
+		}
+	}
+	return false
+}
+
+func isZeroSetting(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case map[string]interface{}:
+		for _, field := range v {
+			if !isZeroSetting(field) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// createInternally creates hook for the caller of request as POST /webhooks does, returning the status it
+// responded with and why it wasn't created. The caller holds modifyingEventListenerLock.
+func (r Resource) createInternally(request *restful.Request, hook webhook) (int, error) {
+	recorder := &resultRecorder{header: http.Header{}}
+	response := restful.NewResponse(recorder)
+	response.SetRequestAccepts(restful.MIME_JSON)
+	r.createWebhookFrom(request, hook, response)
+	if recorder.status >= http.StatusBadRequest {
+		return recorder.status, errors.New(strings.TrimSpace(recorder.body.String()))
+	}
+	return recorder.status, nil
+}
+
+// syncManifest brings the webhooks of source's repository in line with its manifest for the caller of request,
+// recording the result, or returns the status to respond with and why it couldn't. The caller holds
+// modifyingEventListenerLock.
+func (r Resource) syncManifest(request *restful.Request, source manifestSource) ([]manifestResult, int, error) {
+	entries, err := r.readManifest(source)
+	if err != nil {
+		source.Error = err.Error()
+		if saveErr := r.saveManifestSource(source); saveErr != nil {
+			logging.Log.Errorf("error recording the manifest of %s: %s", source.GitRepositoryURL, saveErr)
+		}
+		return nil, http.StatusBadRequest, err
+	}
+	existing, err := r.getHooksForRepo(source.GitRepositoryURL)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	hooksOnRepo := len(existing)
+	byName := map[string]webhook{}
+	for _, hook := range existing {
+		byName[hook.Namespace+"/"+hook.Name] = hook
+	}
+
+	results := []manifestResult{}
+	managed := []string{}
+	listed := map[string]bool{}
+	for _, entry := range entries {
+		key := entry.Namespace + "/" + entry.Name
+		listed[key] = true
+		result := manifestResult{Name: entry.Name, Namespace: entry.Namespace, Action: "unchanged"}
+		current, exists := byName[key]
+		switch {
+		case !exists:
+			result.Action = "created"
+			if _, err := r.createInternally(request, entry); err != nil {
+				result.Error = err.Error()
+			} else {
+				exists = true
+				hooksOnRepo++
+			}
+		case differsFromManifest(current, entry):
+			result.Action = "recreated"
+			// Removed keeping the provider webhook, which the new webhook goes on using
+			if err := r.removeHook(current, hooksOnRepo+1, false); err != nil {
+				result.Error = err.Error()
+			} else if _, err := r.createInternally(request, entry); err != nil {
+				result.Error = err.Error()
+				exists = false
+				hooksOnRepo--
+			}
+		}
+		if exists {
+			managed = append(managed, key)
+		}
+		results = append(results, result)
+	}
+	for _, key := range source.Webhooks {
+		current, exists := byName[key]
+		if listed[key] || !exists {
+			continue
+		}
+		result := manifestResult{Name: current.Name, Namespace: current.Namespace, Action: "deleted"}
+		if err := r.removeHook(current, hooksOnRepo, false); err != nil {
+			result.Error = err.Error()
+			managed = append(managed, key)
+		} else {
+			hooksOnRepo--
+		}
+		results = append(results, result)
+	}
+
+	sort.Strings(managed)
+	source.Webhooks = managed
+	source.SyncedAt = time.Now().UTC()
+	source.Error = ""
+	for _, result := range results {
+		if result.Error != "" {
+			source.Error = fmt.Sprintf("webhook %s in namespace %s was not %s: %s", result.Name, result.Namespace, result.Action, result.Error)
+			break
+		}
+	}
+	if err := r.saveManifestSource(source); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error recording the manifest of %s: %s", source.GitRepositoryURL, err)
+	}
+	logging.Log.Infof("synced %s of %s: %+v", manifestPath, source.GitRepositoryURL, results)
+	return results, http.StatusOK, nil
+}
+
+// POST /webhooks/manifests
+func (r Resource) bootstrapManifest(request *restful.Request, response *restful.Response) {
+	source := manifestSource{}
+	if err := readEntity(request, &source); err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	source.GitRepositoryURL = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(source.GitRepositoryURL), "/"), ".git")
+	if source.GitRepositoryURL == "" || source.AccessTokenRef == "" || source.Namespace == "" {
+		err := errors.New("bad request information provided, gitrepositoryurl, accesstoken and namespace must be specified")
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+	sources, _, err := r.getManifestSources()
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	// Bootstrapping again keeps track of the webhooks created before
+	source.Webhooks = sources[manifestKey(source.GitRepositoryURL)].Webhooks
+	if source.Webhooks == nil {
+		source.Webhooks = []string{}
+	}
+	r.respondSync(request, source, response)
+}
+
+// POST /webhooks/manifests/sync
+func (r Resource) syncManifestRequest(request *restful.Request, response *restful.Response) {
+	body := struct {
+		GitRepositoryURL string `json:"gitrepositoryurl"`
+	}{}
+	if err := readEntity(request, &body); err != nil {
+		logging.Log.Errorf("error trying to read request entity as a manifest sync: %s.", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	if body.GitRepositoryURL == "" {
+		err := errors.New("bad request information provided, gitrepositoryurl must be specified")
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+	sources, _, err := r.getManifestSources()
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	source, found := sources[manifestKey(body.GitRepositoryURL)]
+	if !found {
+		err := fmt.Errorf("the manifest of %s is not synced, bootstrap it with POST /webhooks/manifests", body.GitRepositoryURL)
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusNotFound)
+		return
+	}
+	r.respondSync(request, source, response)
+}
+
+func (r Resource) respondSync(request *restful.Request, source manifestSource, response *restful.Response) {
+	results, status, err := r.syncManifest(request, source)
+	if err != nil {
+		logging.Log.Errorf("error syncing the manifest of %s: %s", source.GitRepositoryURL, err)
+		RespondError(response, err, status)
+		return
+	}
+	response.WriteEntity(manifestSyncResponse{GitRepositoryURL: source.GitRepositoryURL, Results: results})
+}
+
+// GET /webhooks/manifests
+func (r Resource) getManifests(request *restful.Request, response *restful.Response) {
+	sources, _, err := r.getManifestSources()
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	list := []manifestSource{}
+	for _, source := range sources {
+		list = append(list, source)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].GitRepositoryURL < list[j].GitRepositoryURL })
+	response.WriteEntity(list)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+)
+
+func setManifest(t *testing.T, manifest string) {
+	path := testRecordingPath(t, "github", "owner", "repo")
+	recorded, err := loadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded.Files = map[string]string{manifestPath: manifest}
+	if err := saveRecording(path, recorded); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func postManifest(r *Resource, path string, body interface{}) (int, manifestSyncResponse) {
+	b, _ := json.Marshal(body)
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/"+path, bytes.NewBuffer(b))
+	httpWriter := httptest.NewRecorder()
+	if path == "manifests" {
+		r.bootstrapManifest(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	} else {
+		r.syncManifestRequest(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	}
+	result := manifestSyncResponse{}
+	json.NewDecoder(httpWriter.Body).Decode(&result)
+	return httpWriter.Code, result
+}
+
+func hookNames(t *testing.T, r *Resource) []string {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, hook := range hooks {
+		names = append(names, hook.Name+":"+hook.Pipeline)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDiffersFromManifest(t *testing.T) {
+	existing := webhook{Name: "build", Namespace: installNs, Pipeline: "pipeline1", DockerRegistry: "registry.example.com", Owner: "alice"}
+	if differsFromManifest(existing, webhook{Name: "build", Namespace: installNs, Pipeline: "pipeline1"}) {
+		t.Error("expected settings the manifest doesn't set to be ignored")
+	}
+	if !differsFromManifest(existing, webhook{Name: "build", Namespace: installNs, Pipeline: "pipeline2"}) {
+		t.Error("expected a changed pipeline to differ")
+	}
+	if !differsFromManifest(existing, webhook{Name: "build", Namespace: installNs, Pipeline: "pipeline1", ServiceAccount: "deployer"}) {
+		t.Error("expected a setting the webhook lacks to differ")
+	}
+}
+
+func TestSyncManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("GIT_PROVIDER_MODE", "replay")
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", dir)
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+
+	r := dummyResource()
+	manual := webhook{
+		Name:             "manual",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline0",
+	}
+	for _, pipeline := range []string{"pipeline0", "pipeline1", "pipeline2", "pipeline3"} {
+		createTriggerResources(webhook{Pipeline: pipeline, AccessTokenRef: "token1"}, r)
+	}
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(manual, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	source := manifestSource{GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Namespace: installNs}
+
+	if status, _ := postManifest(r, "manifests", source); status != http.StatusBadRequest {
+		t.Errorf("expected bootstrapping a repository without a manifest to fail with a 400, got %d", status)
+	}
+	if status, _ := postManifest(r, "manifests/sync", map[string]string{"gitrepositoryurl": "https://github.com/owner/other"}); status != http.StatusNotFound {
+		t.Errorf("expected syncing a repository that wasn't bootstrapped to fail with a 404, got %d", status)
+	}
+
+	setManifest(t, "webhooks:\n- name: build\n  pipeline: pipeline1\n- name: deploy\n  pipeline: pipeline2\n")
+	status, result := postManifest(r, "manifests", source)
+	if status != http.StatusOK || len(result.Results) != 2 || result.Results[0].Action != "created" || result.Results[0].Error != "" ||
+		result.Results[1].Action != "created" || result.Results[1].Error != "" {
+		t.Fatalf("expected both webhooks to be created, got %d, %+v", status, result)
+	}
+	if names := hookNames(t, r); len(names) != 3 || names[0] != "build:pipeline1" || names[1] != "deploy:pipeline2" || names[2] != "manual:pipeline0" {
+		t.Errorf("unexpected webhooks after bootstrapping %v", names)
+	}
+
+	// build changes pipeline, deploy is removed, manual was never in the manifest
+	setManifest(t, "webhooks:\n- name: build\n  pipeline: pipeline3\n")
+	status, result = postManifest(r, "manifests/sync", map[string]string{"gitrepositoryurl": "https://github.com/owner/repo.git"})
+	if status != http.StatusOK || len(result.Results) != 2 || result.Results[0].Action != "recreated" || result.Results[1].Action != "deleted" {
+		t.Fatalf("expected build to be recreated and deploy deleted, got %d, %+v", status, result)
+	}
+	if names := hookNames(t, r); len(names) != 2 || names[0] != "build:pipeline3" || names[1] != "manual:pipeline0" {
+		t.Errorf("unexpected webhooks after syncing %v", names)
+	}
+	sources, _, _ := r.getManifestSources()
+	synced := sources[manifestKey(source.GitRepositoryURL)]
+	if len(synced.Webhooks) != 1 || synced.Webhooks[0] != installNs+"/build" || synced.Error != "" || synced.SyncedAt.IsZero() {
+		t.Errorf("unexpected recorded manifest %+v", synced)
+	}
+
+	setManifest(t, "webhooks:\n- name: build\n  pipeline: pipeline3\n  gitrepositoryurl: https://github.com/owner/other\n")
+	if status, _ := postManifest(r, "manifests/sync", map[string]string{"gitrepositoryurl": source.GitRepositoryURL}); status != http.StatusBadRequest {
+		t.Errorf("expected a manifest setting its repository to be refused, got %d", status)
+	}
+}
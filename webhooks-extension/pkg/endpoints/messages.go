@@ -0,0 +1,246 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/messages").To(r.getMessages))
+Errors the dashboard shows its users have a code, e.g. WEBHOOK_NOT_FOUND,
+and params, e.g. {"name": "hook", "namespace": "green"}. The response
+body is the English message as before, the code and params being sent in
+the Wext-Message-Code and Wext-Message-Params headers, so a UI can show
+the message and remediation of the catalog in its user's language. The
+catalog holds English and the webhooks-extension-messages configmap in
+the install namespace translations, a key per language:
+
+	fr: '{"WEBHOOK_NOT_FOUND": {"text": "Le webhook {name} ...", "remediation": "..."}}'
+
+Params are written {param} in a message.
+---------------------------------------*/
+
+const (
+	messagesConfigMap    = "webhooks-extension-messages"
+	messageCodeHeader    = "Wext-Message-Code"
+	messageParamsHeader  = "Wext-Message-Params"
+	defaultMessageLocale = "en"
+)
+
+type message struct {
+	Code        string `json:"code"`
+	Text        string `json:"text"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// messageCatalog holds the English messages by code
+var messageCatalog = map[string]message{
+	"NAMESPACE_REQUIRED": {
+		Text:        "bad request information provided, a namespace must be specified as a query parameter",
+		Remediation: "Add the webhook's namespace to the request, e.g. ?namespace=default",
+	},
+	"WEBHOOK_NOT_FOUND": {
+		Text:        "webhook {name} in namespace {namespace} not found",
+		Remediation: "Check the webhook's name and namespace, GET /webhooks lists the webhooks",
+	},
+	"WEBHOOK_PROTECTED": {
+		Text:        "webhook {name} in namespace {namespace} is protected, it is only deleted with force=true by an admin",
+		Remediation: "Check the webhook is the one to delete, then delete it as an admin with ?force=true",
+	},
+	"WEBHOOK_CREDENTIAL_FOUND": {
+		Text:        "{field} looks like it holds a credential ({kind}), webhook settings are readable by anyone who can read the install namespace",
+		Remediation: "Remove the credential from {field} and keep it in a secret, or set allowsecrets to true if it isn't one",
+	},
+	"WEBHOOK_NAMESPACE_REQUIRED": {
+		Text:        "a namespace for creating a webhook is required, but none was given",
+		Remediation: "Set the namespace the webhook's PipelineRuns are created in",
+	},
+	"WEBHOOK_NAME_TOO_LONG": {
+		Text:        "requested webhook name ({name}) must be less than 58 characters",
+		Remediation: "Choose a name of at most 57 characters",
+	},
+	"WEBHOOK_NAME_EXISTS": {
+		Text:        "Webhook already exists with the same name",
+		Remediation: "Choose another name, or delete the existing webhook first",
+	},
+	"TRIGGER_NAME_INVALID": {
+		Text:        "the webhook's triggers would be named {name}, which isn't a valid trigger name: {detail}",
+		Remediation: "Choose a webhook name of lowercase letters, digits and '-', or ask an administrator to fix TRIGGER_NAME_TEMPLATE",
+	},
+	"TRIGGER_NAME_EXISTS": {
+		Text:        "the eventlistener {eventlistener} already has a trigger named {trigger}",
+		Remediation: "Choose another webhook name, or ask an administrator to change TRIGGER_NAME_TEMPLATE",
+	},
+	"WEBHOOK_PIPELINE_EXISTS": {
+		Text:        "Webhook already exists for the specified Git repository, running the same pipeline in the same namespace",
+		Remediation: "Run another pipeline or namespace, or change the existing webhook",
+	},
+	"PULLTASK_MISMATCH": {
+		Text:        "PullTask mismatch. Webhooks on a repository must use the same PullTask existing webhooks use {existing} not {requested}.",
+		Remediation: "Use the pull task of the repository's other webhooks",
+	},
+	"REPOSITORY_URL_PROTOCOL": {
+		Text:        "the supplied GitRepositoryURL does not specify the protocol http:// or https://",
+		Remediation: "Give the repository's full URL, e.g. https://github.com/owner/repo",
+	},
+	"REPOSITORY_URL_FORMAT": {
+		Text:        "GitRepositoryURL format error",
+		Remediation: "Give the repository's full URL, e.g. https://github.com/owner/repo",
+	},
+	"PIPELINE_RESOURCES_MISSING": {
+		Text:        "Could not find the required trigger template or trigger bindings in namespace: {namespace}. Expected to find: {template}, {pushbinding} and {pullrequestbinding}",
+		Remediation: "Create the pipeline's TriggerTemplate and TriggerBindings in the install namespace, or use a starter",
+	},
+	"UNRECOGNIZED_FIELDS": {
+		Text:        "unrecognized fields: {fields}",
+		Remediation: "Correct or remove the fields, or send the request without Wext-Strict-Decoding: true",
+	},
+	// Provider errors, see providererrors.go
+	"GITHUB_HOOK_PERMISSION": {
+		Text:        "GitHub refused to {action} the webhooks of {repository} ({detail}), the access token in secret {secret} can't manage them",
+		Remediation: "Give the token the admin:repo_hook scope, and repo for a private repository, and make its user an admin of the repository",
+	},
+	"GITHUB_SSO_REQUIRED": {
+		Text:        "GitHub refused the access token in secret {secret} for {repository} ({detail}), the token isn't authorized for the organization's single sign-on, authorize it at {ssourl}",
+		Remediation: "Open the URL, or Configure SSO for the token in its GitHub settings, and authorize it for the organization",
+	},
+	"GITLAB_HOOK_PERMISSION": {
+		Text:        "GitLab refused to {action} the webhooks of {repository} ({detail}), the access token in secret {secret} can't manage them",
+		Remediation: "Give the token the api scope and its user the Maintainer role on the project",
+	},
+	"BITBUCKET_HOOK_PERMISSION": {
+		Text:        "Bitbucket refused to {action} the webhooks of {repository} ({detail}), the credentials in secret {secret} can't manage them",
+		Remediation: "Give the access token or app password the webhook scope, and repository:admin for its user on the repository",
+	},
+	"GITEA_HOOK_PERMISSION": {
+		Text:        "Gitea refused to {action} the webhooks of {repository} ({detail}), the credentials in secret {secret} can't manage them",
+		Remediation: "Make the token's user an admin of the repository, and give the token the write:repository scope on Gitea releases with token scopes",
+	},
+	"GITLAB_URL_BLOCKED": {
+		Text:        "GitLab refused the webhook of {repository} to {url}: {detail}",
+		Remediation: "Allow webhooks to the local network in GitLab's Admin Area, Settings, Network, Outbound requests, or use a callback URL GitLab may deliver to",
+	},
+	"GIT_TOKEN_REJECTED": {
+		Text:        "{provider} rejected the access token in secret {secret}: {detail}",
+		Remediation: "The token has expired or been revoked, update the secret with a new token",
+	},
+	"GIT_TOKEN_SCOPE_MISSING": {
+		Text:        "the access token in secret {secret} can't {action} of {repository}, {provider} needs it to have the {scope} scope and it has {detail}",
+		Remediation: "Add the scope to the token, or update the secret with a token that has it",
+	},
+	"GIT_RATE_LIMITED": {
+		Text:        "{provider} rate limited the requests for {repository}: {detail}",
+		Remediation: "Try again later, or use the token of a user with a higher rate limit",
+	},
+	"GIT_API_UNREACHABLE": {
+		Text:        "the {provider} API could not be reached: {detail}",
+		Remediation: "Check the repository's API URL, the cluster's egress and proxy settings, and for a self-signed certificate the git CA, see Security.md",
+	},
+}
+
+// messageError is an error with a catalog message, its English text being the error
+type messageError struct {
+	code   string
+	params map[string]string
+}
+
+func newMessageError(code string, params map[string]string) error {
+	return messageError{code: code, params: params}
+}
+
+func (e messageError) Error() string {
+	return renderMessage(messageCatalog[e.code].Text, e.params)
+}
+
+// renderMessage replaces the {param} placeholders of text
+func renderMessage(text string, params map[string]string) string {
+	for name, value := range params {
+		text = strings.Replace(text, "{"+name+"}", value, -1)
+	}
+	return text
+}
+
+// addMessageHeaders sends the code and params of a catalog message with its response
+func addMessageHeaders(response *restful.Response, err error) {
+	coded, ok := err.(messageError)
+	if !ok {
+		return
+	}
+	response.AddHeader(messageCodeHeader, coded.code)
+	if len(coded.params) > 0 {
+		paramsJSON, _ := json.Marshal(coded.params)
+		response.AddHeader(messageParamsHeader, string(paramsJSON))
+	}
+}
+
+// GET /webhooks/messages[?lang=fr]
+func (r Resource) getMessages(request *restful.Request, response *restful.Response) {
+	lang := request.QueryParameter("lang")
+	if lang == "" {
+		// e.g. fr-CA,fr;q=0.9,en;q=0.8
+		lang = strings.Split(strings.Split(request.HeaderParameter("Accept-Language"), ",")[0], ";")[0]
+	}
+	messages, err := r.getMessageCatalog(strings.TrimSpace(lang))
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	response.WriteEntity(messages)
+}
+
+// getMessageCatalog lists the catalog's messages, in the language where they are translated
+func (r Resource) getMessageCatalog(lang string) ([]message, error) {
+	translations := map[string]message{}
+	if lang != "" && lang != defaultMessageLocale {
+		cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(messagesConfigMap, metav1.GetOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil {
+			value, found := cm.Data[lang]
+			if !found {
+				// fr for fr-CA
+				value = cm.Data[strings.Split(lang, "-")[0]]
+			}
+			if value != "" {
+				if err := json.Unmarshal([]byte(value), &translations); err != nil {
+					logging.Log.Errorf("ignoring the %s messages of configmap %s, they must be JSON: %s", lang, messagesConfigMap, err)
+					translations = map[string]message{}
+				}
+			}
+		}
+	}
+	messages := []message{}
+	for code, english := range messageCatalog {
+		m := english
+		if translated, found := translations[code]; found && translated.Text != "" {
+			m = translated
+		}
+		m.Code = code
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Code < messages[j].Code })
+	return messages, nil
+}
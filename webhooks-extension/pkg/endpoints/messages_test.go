@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRespondErrorWithMessageCode(t *testing.T) {
+	httpWriter := httptest.NewRecorder()
+	RespondError(dummyRestfulResponse(httpWriter), newMessageError("WEBHOOK_NOT_FOUND", map[string]string{"name": "hook", "namespace": "green"}), http.StatusNotFound)
+	if body := httpWriter.Body.String(); body != "webhook hook in namespace green not found" {
+		t.Errorf("expected the English message as the body, got %s", body)
+	}
+	params := map[string]string{}
+	json.Unmarshal([]byte(httpWriter.Header().Get(messageParamsHeader)), &params)
+	if httpWriter.Header().Get(messageCodeHeader) != "WEBHOOK_NOT_FOUND" || params["name"] != "hook" || params["namespace"] != "green" {
+		t.Errorf("expected the code and params in the headers, got %v", httpWriter.Header())
+	}
+
+	httpWriter = httptest.NewRecorder()
+	RespondError(dummyRestfulResponse(httpWriter), errors.New("not found"), http.StatusNotFound)
+	if httpWriter.Header().Get(messageCodeHeader) != "" {
+		t.Errorf("expected no code for an error without one, got %v", httpWriter.Header())
+	}
+}
+
+func TestMessageCatalogPlaceholders(t *testing.T) {
+	placeholder := regexp.MustCompile(`\{[a-z]+\}`)
+	params := map[string]map[string]string{
+		"WEBHOOK_NOT_FOUND":          {"name": "hook", "namespace": "green"},
+		"WEBHOOK_PROTECTED":          {"name": "hook", "namespace": "green"},
+		"WEBHOOK_CREDENTIAL_FOUND":   {"field": "releasename", "kind": "GitHub token"},
+		"WEBHOOK_NAME_TOO_LONG":      {"name": "hook"},
+		"TRIGGER_NAME_INVALID":       {"name": "wh-green-hook-pullrequest-event", "detail": "must be no more than 63 characters"},
+		"TRIGGER_NAME_EXISTS":        {"trigger": "wh-green-hook-push-event", "eventlistener": "tekton-webhooks-eventlistener"},
+		"PULLTASK_MISMATCH":          {"existing": "monitor-task", "requested": "other-task"},
+		"PIPELINE_RESOURCES_MISSING": {"namespace": "tekton-pipelines", "template": "t", "pushbinding": "p", "pullrequestbinding": "pr"},
+		"UNRECOGNIZED_FIELDS":        {"fields": "pipelne"},
+	}
+	call := providerCall{provider: "GitHub", repository: "owner/repo", secret: "token", action: "create", callbackURL: "https://hooks.example.com"}
+	for code := range providerErrorStatuses {
+		params[code] = call.messageError(code, "detail").(messageError).params
+	}
+	params["GIT_TOKEN_SCOPE_MISSING"]["scope"] = "api"
+	params["GITHUB_SSO_REQUIRED"]["ssourl"] = "https://github.com/orgs/owner/sso"
+	for code, m := range messageCatalog {
+		if m.Text == "" || m.Remediation == "" {
+			t.Errorf("message %s needs a text and remediation", code)
+		}
+		if text := newMessageError(code, params[code]).Error(); placeholder.MatchString(text) {
+			t.Errorf("message %s has params left in %s", code, text)
+		}
+	}
+}
+
+func TestGetMessageCatalog(t *testing.T) {
+	r := dummyResource()
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: messagesConfigMap, Namespace: installNs},
+		Data: map[string]string{
+			"fr": `{"WEBHOOK_NOT_FOUND": {"text": "Le webhook {name} de l'espace {namespace} est introuvable"}}`,
+			"de": `not json`,
+		},
+	}
+	r.K8sClient.CoreV1().ConfigMaps(installNs).Create(cm)
+
+	tests := []struct {
+		lang, expected string
+	}{
+		{"", "webhook {name} in namespace {namespace} not found"},
+		{"fr", "Le webhook {name} de l'espace {namespace} est introuvable"},
+		{"fr-CA", "Le webhook {name} de l'espace {namespace} est introuvable"},
+		{"de", "webhook {name} in namespace {namespace} not found"},
+		{"ja", "webhook {name} in namespace {namespace} not found"},
+	}
+	for _, tt := range tests {
+		messages, err := r.getMessageCatalog(tt.lang)
+		if err != nil {
+			t.Fatalf("error getting the %s catalog: %s", tt.lang, err)
+		}
+		if len(messages) != len(messageCatalog) {
+			t.Errorf("expected %d messages in %s, got %d", len(messageCatalog), tt.lang, len(messages))
+		}
+		for _, m := range messages {
+			if m.Code == "WEBHOOK_NOT_FOUND" && m.Text != tt.expected {
+				t.Errorf("expected the %s message %q, got %q", tt.lang, tt.expected, m.Text)
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+/*--------------------------------------
+By default every pull request event runs the monitor task (see
+pulltasks.go), a TaskRun that waits for the event's PipelineRuns and
+reports on them. With MONITOR_CONTROLLER_ENABLED set to true the extension
+reports instead: no monitor trigger, binding or pull task is created for
+repositories, and every monitorControllerInterval the PipelineRuns the
+eventlistener created for webhooks' pull request triggers are checked. Each
+is reported as a commit status on its gitrevision when it starts and when
+it completes and, unless the webhook's monitormode is status, with a
+comment using the webhook's comments when it completes. Runs of webhooks in
+shadow mode aren't reported, see shadow.go. Comments need the pullRequest
+label, see docs/Labels.md. The state last reported is kept in an annotation
+on the PipelineRun, runs that completed before the extension started are
+left. Without a monitor binding a webhook's comments and monitormode are
+kept in its own binding.
+---------------------------------------*/
+
+const (
+	monitorControllerInterval = 15 * time.Second
+	// Annotation holding the state the monitor controller last reported for a PipelineRun
+	monitorReportedAnnotation = "webhooks.tekton.dev/monitorReported"
+	// Commit statuses are named Tekton/<namespace>/<pipeline>, as the monitor task names them
+	monitorStatusContext = "Tekton"
+	// Binding param holding a webhook's monitorSettings
+	monitorSettingsParam = "webhooks-tekton-monitor"
+)
+
+// monitorSettings are the settings of a webhook the monitor controller reports with
+type monitorSettings struct {
+	OnSuccessComment string `json:"onsuccesscomment,omitempty"`
+	OnFailureComment string `json:"onfailurecomment,omitempty"`
+	OnTimeoutComment string `json:"ontimeoutcomment,omitempty"`
+	MonitorMode      string `json:"monitormode,omitempty"`
+}
+
+// This is deliberately written as a function such that unittests can override
+// the git provider the monitor controller reports through
+var monitorGitProvider = func(r Resource, hook webhook) (GitProvider, error) {
+	_, org, repo, err := r.getGitValues(hook.GitRepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	return r.createGitProviderForWebhook(hook, org, repo)
+}
+
+// monitorControllerParams are the binding params keeping the webhook's monitorSettings, none
+// unless the monitor controller is enabled
+func (r Resource) monitorControllerParams(webhook webhook) []v1alpha1.Param {
+	if !r.Defaults.MonitorController {
+		return nil
+	}
+	settings, err := json.Marshal(monitorSettings{
+		OnSuccessComment: webhook.OnSuccessComment,
+		OnFailureComment: webhook.OnFailureComment,
+		OnTimeoutComment: webhook.OnTimeoutComment,
+		MonitorMode:      webhook.MonitorMode,
+	})
+	if err != nil {
+		logging.Log.Errorf("error writing the monitor settings of webhook %s: %s", webhook.Name, err)
+		return nil
+	}
+	return []v1alpha1.Param{{Name: monitorSettingsParam, Value: string(settings)}}
+}
+
+// MonitorPipelineRuns reports webhooks' pull request PipelineRuns, when the monitor controller is
+// enabled, until stopCh is closed
+func (r Resource) MonitorPipelineRuns(stopCh <-chan struct{}) {
+	if !r.Defaults.MonitorController {
+		return
+	}
+	started := time.Now()
+	ticker := time.NewTicker(monitorControllerInterval)
+	defer ticker.Stop()
+	for {
+		for _, profiled := range r.allProfiles() {
+			profiled.monitorPipelineRuns(started)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// monitorPipelineRuns reports the pull request PipelineRuns in webhooks' namespaces whose state has
+// changed, other than those completed before since
+func (r Resource) monitorPipelineRuns(since time.Time) {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error getting webhooks to monitor PipelineRuns: %s", err)
+		return
+	}
+	dashboardURL := ""
+	triggers := r.pullRequestTriggerWebhooks(hooks)
+	listed := map[string]bool{}
+	for _, hook := range hooks {
+		if listed[hook.Namespace] {
+			continue
+		}
+		listed[hook.Namespace] = true
+		pipelineRuns, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).List(metav1.ListOptions{
+			LabelSelector: eventListenerLabel + "=" + r.eventListenerName(),
+		})
+		if err != nil {
+			logging.Log.Errorf("error listing PipelineRuns in namespace %s to monitor: %s", hook.Namespace, err)
+			continue
+		}
+		for i := range pipelineRuns.Items {
+			pipelineRun := &pipelineRuns.Items[i]
+			owner, found := triggers[pipelineRun.Labels[triggerLabel]]
+			state := pipelineRunState(*pipelineRun)
+			if !found || owner.ShadowMode || pipelineRun.Annotations[monitorReportedAnnotation] == state {
+				continue
+			}
+			if pipelineRun.Status.CompletionTime != nil && pipelineRun.Status.CompletionTime.Time.Before(since) {
+				continue
+			}
+			if dashboardURL == "" {
+				dashboardURL = r.getDashboardURL(r.Defaults.Namespace)
+			}
+			if err := r.reportPipelineRun(owner, *pipelineRun, state, dashboardURL); err != nil {
+				logging.Log.Errorf("error reporting PipelineRun %s in namespace %s: %s", pipelineRun.Name, pipelineRun.Namespace, err)
+				continue
+			}
+			if pipelineRun.Annotations == nil {
+				pipelineRun.Annotations = map[string]string{}
+			}
+			pipelineRun.Annotations[monitorReportedAnnotation] = state
+			if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).Update(pipelineRun); err != nil {
+				logging.Log.Errorf("error recording the report of PipelineRun %s in namespace %s: %s", pipelineRun.Name, hook.Namespace, err)
+			}
+		}
+	}
+}
+
+// pipelineRunState is the commit status state of a PipelineRun: pending, success, failure or error if it timed out
+func pipelineRunState(pipelineRun pipelinesv1alpha1.PipelineRun) string {
+	condition := pipelineRun.Status.GetCondition(apis.ConditionSucceeded)
+	switch {
+	case condition == nil || condition.Status == corev1.ConditionUnknown:
+		return "pending"
+	case condition.Status == corev1.ConditionTrue:
+		return "success"
+	case condition.Reason == "PipelineRunTimeout":
+		return "error"
+	default:
+		return "failure"
+	}
+}
+
+// reportPipelineRun sets the commit status of the PipelineRun and, once it has completed, comments on its pull request
+func (r Resource) reportPipelineRun(hook webhook, pipelineRun pipelinesv1alpha1.PipelineRun, state, dashboardURL string) error {
+	provider, err := monitorGitProvider(r, hook)
+	if err != nil {
+		return err
+	}
+	if err := provider.CheckTokenScope(operationReport); err != nil {
+		return err
+	}
+	pipeline := pipelineRun.Spec.PipelineRef.Name
+	targetURL := r.pipelineRunLink(dashboardURL, pipelineRun.Namespace, pipelineRun.Name, pipeline)
+	descriptions := map[string]string{"pending": "is running", "success": "succeeded", "failure": "failed", "error": "timed out"}
+
+	if sha := pipelineRunRevision(pipelineRun); sha != "" {
+		status := commitStatus{
+			State:       state,
+			Context:     monitorStatusContext + "/" + pipelineRun.Namespace + "/" + pipeline,
+			Description: fmt.Sprintf("PipelineRun %s %s", pipelineRun.Name, descriptions[state]),
+			TargetURL:   targetURL,
+		}
+		if err := provider.SetCommitStatus(sha, status); err != nil {
+			return err
+		}
+	}
+
+	if state == "pending" || getMonitorMode(hook) == monitorModeStatus {
+		return nil
+	}
+	number, err := strconv.Atoi(pipelineRun.Labels["webhooks.tekton.dev/pullRequest"])
+	if err != nil {
+		logging.Log.Debugf("not commenting on PipelineRun %s, it has no pullRequest label", pipelineRun.Name)
+		return nil
+	}
+	comments := map[string]string{"success": hook.OnSuccessComment, "failure": hook.OnFailureComment, "error": hook.OnTimeoutComment}
+	defaults := map[string]string{"success": "Success", "failure": "Failed", "error": "Unknown"}
+	comment := comments[state]
+	if comment == "" {
+		comment = defaults[state]
+	}
+	body := ""
+	if isCommentTemplate(comment) {
+		data := commentData{
+			Repository:  hook.GitRepositoryURL,
+			PullRequest: number,
+			Namespace:   pipelineRun.Namespace,
+			Pipeline:    pipeline,
+			PipelineRun: pipelineRun.Name,
+			Link:        targetURL,
+			State:       state,
+		}
+		rendered, err := renderComment(state, comment, data)
+		if err != nil {
+			logging.Log.Errorf("error rendering the %s comment of webhook %s, commenting the default: %s", state, hook.Name, err)
+			comment = defaults[state]
+		}
+		body = rendered
+	}
+	if body == "" {
+		body = fmt.Sprintf("%s: PipelineRun [%s](%s) of pipeline %s", comment, pipelineRun.Name, targetURL, pipeline)
+	}
+	if url := previewURL(hook, number); state == "success" && url != "" {
+		body += fmt.Sprintf("\n\nPreview: %s", url)
+	}
+	return provider.CommentOnPullRequest(number, body)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+// reportingProvider records the statuses and comments the monitor controller reports
+type reportingProvider struct {
+	replayProvider
+	statuses *[]commitStatus
+	comments *[]string
+}
+
+func (p reportingProvider) SetCommitStatus(sha string, status commitStatus) error {
+	*p.statuses = append(*p.statuses, status)
+	return nil
+}
+
+func (p reportingProvider) CommentOnPullRequest(number int, body string) error {
+	*p.comments = append(*p.comments, body)
+	return nil
+}
+
+func TestPipelineRunState(t *testing.T) {
+	timedOut := statsPipelineRun("timedout", corev1.ConditionFalse, 10, time.Now())
+	timedOut.Status.SetCondition(&apis.Condition{Type: apis.ConditionSucceeded, Status: corev1.ConditionFalse, Reason: "PipelineRunTimeout"})
+	tests := []struct {
+		pipelineRun pipelinesv1alpha1.PipelineRun
+		expected    string
+	}{
+		{statsPipelineRun("running", corev1.ConditionUnknown, 0, time.Now()), "pending"},
+		{pipelinesv1alpha1.PipelineRun{}, "pending"},
+		{statsPipelineRun("succeeded", corev1.ConditionTrue, 10, time.Now()), "success"},
+		{statsPipelineRun("failed", corev1.ConditionFalse, 10, time.Now()), "failure"},
+		{timedOut, "error"},
+	}
+	for _, test := range tests {
+		if state := pipelineRunState(test.pipelineRun); state != test.expected {
+			t.Errorf("state of %s was %s, expected %s", test.pipelineRun.Name, state, test.expected)
+		}
+	}
+}
+
+func TestMonitorPipelineRuns(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.MonitorController = true
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+		OnSuccessComment: "Passed",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	for _, trigger := range el.Spec.Triggers {
+		if strings.HasPrefix(trigger.Name, "owner.repo-") {
+			t.Errorf("expected no monitor trigger with the monitor controller enabled, got %s", trigger.Name)
+		}
+	}
+
+	statuses, comments := []commitStatus{}, []string{}
+	defer func(original func(Resource, webhook) (GitProvider, error)) { monitorGitProvider = original }(monitorGitProvider)
+	monitorGitProvider = func(Resource, webhook) (GitProvider, error) {
+		return reportingProvider{statuses: &statuses, comments: &comments}, nil
+	}
+
+	since := time.Now()
+	run := func(name string, status corev1.ConditionStatus, completed time.Time, trigger string) *pipelinesv1alpha1.PipelineRun {
+		pipelineRun := statsPipelineRun(name, status, 10, completed)
+		pipelineRun.Namespace = installNs
+		pipelineRun.Labels[eventListenerLabel] = r.eventListenerName()
+		pipelineRun.Labels[triggerLabel] = trigger
+		pipelineRun.Labels["webhooks.tekton.dev/pullRequest"] = "5"
+		pipelineRun.Spec.Params = []pipelinesv1alpha1.Param{{Name: "gitrevision", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "abc123"}}}
+		created, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Create(&pipelineRun)
+		if err != nil {
+			t.Fatalf("error creating pipelinerun: %s", err)
+		}
+		return created
+	}
+	running := run("running", corev1.ConditionUnknown, since, "hook-"+installNs+"-pullrequest-event")
+	run("old", corev1.ConditionTrue, since.Add(-time.Hour), "hook-"+installNs+"-pullrequest-event")
+	run("push", corev1.ConditionUnknown, since, "hook-"+installNs+"-push-event")
+
+	r.monitorPipelineRuns(since)
+	r.monitorPipelineRuns(since)
+	if len(statuses) != 1 || statuses[0].State != "pending" || statuses[0].Context != "Tekton/"+installNs+"/pipeline" || len(comments) != 0 {
+		t.Fatalf("expected one pending status, got %+v and %+v", statuses, comments)
+	}
+
+	running, _ = r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Get(running.Name, metav1.GetOptions{})
+	running.Status.SetCondition(&apis.Condition{Type: apis.ConditionSucceeded, Status: corev1.ConditionTrue})
+	running.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Update(running)
+	r.monitorPipelineRuns(since)
+	if len(statuses) != 2 || statuses[1].State != "success" || len(comments) != 1 || !strings.HasPrefix(comments[0], "Passed: PipelineRun [running]") {
+		t.Errorf("expected a success status and comment, got %+v and %+v", statuses, comments)
+	}
+}
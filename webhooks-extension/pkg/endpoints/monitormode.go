@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+)
+
+// How the monitor reports PipelineRun results on a GitLab merge request: as a comment (the
+// default), as commit statuses linking to each PipelineRun in the dashboard, or both.
+// GitHub pull requests are always commented on.
+const (
+	monitorModeComment = "comment"
+	monitorModeStatus  = "status"
+	monitorModeBoth    = "both"
+)
+
+func validateMonitorMode(mode string) error {
+	switch mode {
+	case "", monitorModeComment, monitorModeStatus, monitorModeBoth:
+		return nil
+	}
+	return fmt.Errorf("monitormode %s is not valid, it must be one of %s, %s or %s", mode, monitorModeComment, monitorModeStatus, monitorModeBoth)
+}
+
+// Binding param keeping a webhook's monitor mode, the monitor binding being shared by the webhooks on a repository
+const monitorModeParam = "webhooks-tekton-monitor-mode"
+
+// monitorModeParams are the binding params recording the webhook's monitor mode, if it was given
+func monitorModeParams(webhook webhook) []v1alpha1.Param {
+	if webhook.MonitorMode == "" {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: monitorModeParam, Value: webhook.MonitorMode}}
+}
+
+// getMonitorMode returns the webhook's monitor mode, defaulting to comment
+func getMonitorMode(webhook webhook) string {
+	if webhook.MonitorMode == "" {
+		return monitorModeComment
+	}
+	return webhook.MonitorMode
+}
+
+// Whether the monitor adds a new comment to a pull request each time it reports (the default), or
+// keeps a single sticky comment, found by a hidden marker in its text, updated with the latest status table.
+const (
+	monitorCommentNew    = "new"
+	monitorCommentSticky = "sticky"
+)
+
+func validateMonitorComment(mode string) error {
+	switch mode {
+	case "", monitorCommentNew, monitorCommentSticky:
+		return nil
+	}
+	return fmt.Errorf("monitorcomment %s is not valid, it must be %s or %s", mode, monitorCommentNew, monitorCommentSticky)
+}
+
+// getMonitorComment returns the webhook's monitor comment mode, defaulting to new
+func getMonitorComment(webhook webhook) string {
+	if webhook.MonitorComment == "" {
+		return monitorCommentNew
+	}
+	return webhook.MonitorComment
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+)
+
+func TestValidateMonitorMode(t *testing.T) {
+	for _, mode := range []string{"", "comment", "status", "both"} {
+		if err := validateMonitorMode(mode); err != nil {
+			t.Errorf("monitor mode %q was invalid: %s", mode, err.Error())
+		}
+	}
+	if err := validateMonitorMode("statuses"); err == nil {
+		t.Error("monitor mode statuses was valid, expected an error")
+	}
+	if mode := getMonitorMode(webhook{}); mode != "comment" {
+		t.Errorf("default monitor mode was %s, expected comment", mode)
+	}
+}
+
+func TestMonitorModeKeptPerWebhook(t *testing.T) {
+	r := dummyResource()
+	first := webhook{Name: "first", Namespace: installNs, GitRepositoryURL: "https://gitlab.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1", MonitorMode: "status"}
+	second := webhook{Name: "second", Namespace: installNs, GitRepositoryURL: "https://gitlab.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline2", MonitorMode: "both"}
+	createTriggerResources(first, r)
+	createTriggerResources(second, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(first, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	if _, err := r.updateEventListener(el, second, "owner.repo-"); err != nil {
+		t.Fatalf("error adding webhook: %s", err)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		t.Fatalf("error getting webhooks: %s", err)
+	}
+	modes := map[string]string{}
+	for _, hook := range hooks {
+		modes[hook.Name] = hook.MonitorMode
+	}
+	if modes["first"] != "status" || modes["second"] != "both" {
+		t.Errorf("monitor modes were %v, expected each webhook's own", modes)
+	}
+}
+
+func TestValidateMonitorComment(t *testing.T) {
+	for _, mode := range []string{"", "new", "sticky"} {
+		if err := validateMonitorComment(mode); err != nil {
+			t.Errorf("monitor comment %q was invalid: %s", mode, err.Error())
+		}
+	}
+	if err := validateMonitorComment("update"); err == nil {
+		t.Error("monitor comment update was valid, expected an error")
+	}
+	if mode := getMonitorComment(webhook{}); mode != "new" {
+		t.Errorf("default monitor comment was %s, expected new", mode)
+	}
+}
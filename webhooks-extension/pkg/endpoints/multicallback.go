@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Some clusters are reachable on more than one hostname, e.g. a VPN host
+that an internal GitHub Enterprise can reach and a public one for
+github.com. WEBHOOK_ADDITIONAL_CALLBACK_URLS (or additionalcallbackurls in
+the config configmap, or a profile's additionalcallbackurls) lists callback
+URLs besides WEBHOOK_CALLBACK_URL. The ingress gets a host, and a TLS entry
+for those using https, for every callback; on OpenShift each additional
+callback gets its own route. A webhook's callbackurl chooses which callback
+its provider webhook is registered against, by default the main one. The
+provider webhook is shared by every webhook on a repository, so they must
+all choose the same callback.
+---------------------------------------*/
+
+// Binding param recording a webhook's callback, when it isn't the main one
+const callbackParam = "webhooks-tekton-callback-url"
+
+// parseCallbackURLs reads a comma separated list of callback URLs, ignoring those without a protocol
+func parseCallbackURLs(value string) []string {
+	callbacks := []string{}
+	for _, callback := range strings.Split(value, ",") {
+		callback = strings.TrimSuffix(strings.TrimSpace(callback), "/")
+		if callback == "" {
+			continue
+		}
+		if !strings.HasPrefix(callback, "http://") && !strings.HasPrefix(callback, "https://") {
+			logging.Log.Errorf("ignoring additional callback URL %s as it does not specify the protocol http:// or https://", callback)
+			continue
+		}
+		callbacks = append(callbacks, callback)
+	}
+	return callbacks
+}
+
+// callbackURLs are the main callback URL followed by the additional ones
+func (r Resource) callbackURLs() []string {
+	return append([]string{getCallbackURL(r)}, r.Defaults.AdditionalCallbackURLs...)
+}
+
+// callbackHost is the host, and port if any, of a callback URL
+func callbackHost(callbackURL string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(callbackURL, "http://"), "https://")
+}
+
+// hookCallbackURL is the callback URL the provider webhook of hook is registered against
+func hookCallbackURL(r Resource, hook webhook) string {
+	if hook.CallbackURL != "" {
+		return hook.CallbackURL
+	}
+	return getCallbackURL(r)
+}
+
+// validateHookCallback checks a webhook's callbackurl is one of the callback URLs, clearing it if it's the main one
+// so the webhook follows the main callback when it is migrated
+func (r Resource) validateHookCallback(webhook *webhook, hooksOnRepo []webhook) error {
+	webhook.CallbackURL = strings.TrimSuffix(webhook.CallbackURL, "/")
+	if webhook.CallbackURL == getCallbackURL(r) {
+		webhook.CallbackURL = ""
+	}
+	if webhook.CallbackURL != "" {
+		found := false
+		for _, callback := range r.Defaults.AdditionalCallbackURLs {
+			found = found || callback == webhook.CallbackURL
+		}
+		if !found {
+			return fmt.Errorf("callbackurl %s is not one of the callback URLs %s", webhook.CallbackURL, strings.Join(r.callbackURLs(), ", "))
+		}
+	}
+	for _, hook := range hooksOnRepo {
+		if hook.CallbackURL != webhook.CallbackURL {
+			return fmt.Errorf("the webhooks on %s are registered against %s, callbackurl must be the same",
+				webhook.GitRepositoryURL, hookCallbackURL(r, hook))
+		}
+	}
+	return nil
+}
+
+// callbackParams is the binding param recording the webhook's callback
+func callbackParams(webhook webhook) []v1alpha1.Param {
+	if webhook.CallbackURL == "" {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: callbackParam, Value: webhook.CallbackURL}}
+}
+
+// callbackCertSecretName is the TLS secret the extension creates for the i-th callback URL
+func (r Resource) callbackCertSecretName(i int) string {
+	if i == 0 {
+		return r.certSecretName()
+	}
+	return r.certSecretName() + "-" + strconv.Itoa(i)
+}
+
+// isCallbackCertSecret returns whether name is a TLS secret the extension creates for a callback URL
+func (r Resource) isCallbackCertSecret(name string) bool {
+	for i := range r.callbackURLs() {
+		if name == r.callbackCertSecretName(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// callbackRouteName is the OpenShift route of the i-th additional callback URL
+func (r Resource) callbackRouteName(i int) string {
+	return r.ingressName() + "-" + strconv.Itoa(i+1)
+}
+
+// createCallbackRoutes creates the routes of the additional callback URLs on OpenShift, leaving those that exist alone
+func (r Resource) createCallbackRoutes() error {
+	for i := range r.Defaults.AdditionalCallbackURLs {
+		if err := r.createCallbackRoute(i); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// createCallbackRoute creates the route of the i-th additional callback URL on OpenShift
+func (r Resource) createCallbackRoute(i int) error {
+	route := r.newOpenshiftRoute(r.callbackRouteName(i), listenerServiceName(r.eventListenerName()))
+	route.Spec.Host = callbackHost(r.Defaults.AdditionalCallbackURLs[i])
+	_, err := r.RoutesClient.RouteV1().Routes(r.Defaults.Namespace).Create(route)
+	return err
+}
+
+// deleteCallbackRoutes deletes the routes of the additional callback URLs on OpenShift
+func (r Resource) deleteCallbackRoutes() error {
+	for i := range r.Defaults.AdditionalCallbackURLs {
+		err := r.RoutesClient.RouteV1().Routes(r.Defaults.Namespace).Delete(r.callbackRouteName(i), &metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseCallbackURLs(t *testing.T) {
+	got := parseCallbackURLs(" https://vpn.example.com/, listener.example.com,,http://10.0.0.5:8080")
+	expected := []string{"https://vpn.example.com", "http://10.0.0.5:8080"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("callback URLs were %v, expected %v", got, expected)
+	}
+}
+
+func TestNewIngressWithAdditionalCallbacks(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.AdditionalCallbackURLs = []string{"http://vpn.example.com", "http://10.0.0.5:8080"}
+	ingress := r.newIngress(installNs, "http://public.example.com")
+	hosts := []string{}
+	for _, rule := range ingress.Spec.Rules {
+		hosts = append(hosts, rule.Host)
+	}
+	expected := []string{"public.example.com", "vpn.example.com", "10.0.0.5:8080"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("ingress hosts were %v, expected %v", hosts, expected)
+	}
+	if len(ingress.Spec.TLS) != 0 {
+		t.Errorf("expected no TLS for http callbacks, got %+v", ingress.Spec.TLS)
+	}
+}
+
+func TestValidateHookCallback(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.CallbackURL = "https://public.example.com"
+	r.Defaults.AdditionalCallbackURLs = []string{"https://vpn.example.com"}
+	tests := []struct {
+		name        string
+		callbackURL string
+		hooksOnRepo []webhook
+		expected    string
+		expectErr   bool
+	}{
+		{name: "default", callbackURL: "", expected: ""},
+		{name: "main callback", callbackURL: "https://public.example.com/", expected: ""},
+		{name: "additional callback", callbackURL: "https://vpn.example.com", expected: "https://vpn.example.com"},
+		{name: "unknown callback", callbackURL: "https://other.example.com", expectErr: true},
+		{name: "same as the repository's webhooks", callbackURL: "https://vpn.example.com",
+			hooksOnRepo: []webhook{{Name: "other", CallbackURL: "https://vpn.example.com"}}, expected: "https://vpn.example.com"},
+		{name: "different to the repository's webhooks", callbackURL: "https://vpn.example.com",
+			hooksOnRepo: []webhook{{Name: "other"}}, expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := webhook{Name: "hook", GitRepositoryURL: "https://github.com/owner/repo", CallbackURL: tt.callbackURL}
+			err := r.validateHookCallback(&hook, tt.hooksOnRepo)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if hook.CallbackURL != tt.expected {
+				t.Errorf("callbackurl was %q, expected %q", hook.CallbackURL, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWebhookCallbackURL(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.CallbackURL = "http://public.example.com"
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+		CallbackURL:      "http://vpn.example.com",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	if hooks[0].CallbackURL != "http://vpn.example.com" || hookCallbackURL(*r, hooks[0]) != "http://vpn.example.com" {
+		t.Errorf("callbackurl was %s, expected http://vpn.example.com", hooks[0].CallbackURL)
+	}
+	if got := hookCallbackURL(*r, webhook{}); got != "http://public.example.com" {
+		t.Errorf("default callback was %s, expected http://public.example.com", got)
+	}
+}
+
+func TestRepairInfrastructureAddsCallbackHosts(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.CallbackURL = "http://public.example.com"
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	if err := r.createDeleteIngress("create", installNs); err != nil {
+		t.Fatalf("error creating ingress: %s", err)
+	}
+
+	r.Defaults.AdditionalCallbackURLs = []string{"http://vpn.example.com"}
+	if repaired := r.repairInfrastructure(); !reflect.DeepEqual(repaired, []string{"host"}) {
+		t.Errorf("expected the host to be added, got %v", repaired)
+	}
+	ingress, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Get(r.ingressName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting ingress: %s", err)
+	}
+	if len(ingress.Spec.Rules) != 2 || ingress.Spec.Rules[1].Host != "vpn.example.com" {
+		t.Errorf("expected the vpn host on the ingress, got %+v", ingress.Spec.Rules)
+	}
+	if repaired := r.repairInfrastructure(); len(repaired) != 0 {
+		t.Errorf("expected nothing to be repaired, got %v", repaired)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+/*--------------------------------------
+Names of the resources the extension generates. The eventlistener name and
+the prefixes of generated triggerbindings, triggertemplates, variable set
+configmaps and captured payload secrets (wext-), the ingress and route
+(el-) and the TLS secret (cert-) are set with EVENTLISTENER_NAME, RESOURCE_NAME_PREFIX,
+INGRESS_NAME_PREFIX and CERT_NAME_PREFIX, so two installs of the extension,
+for different tenants, can share a namespace. The eventlistener's
+deployment and service are always el-<name> as Tekton Triggers names them.
+Names built from a webhook's name and namespace, or a repository's owner and
+name, are kept within Kubernetes' limits by boundedName: a name that would be
+too long is cut short and ends in a hash of the whole, so the same webhook
+or repository always gets the same name and is found by it again. The
+triggers of a webhook whose trigger names were shortened are named as in
+triggernames.go, the webhook's name being kept in its triggerbinding.
+---------------------------------------*/
+
+const (
+	defaultEventListenerName = "tekton-webhooks-eventlistener"
+	defaultResourcePrefix    = "wext-"
+	defaultIngressPrefix     = "el-"
+	defaultCertPrefix        = "cert-"
+	// Prefix Tekton Triggers gives an eventlistener's deployment and service
+	listenerServicePrefix = "el-"
+	// Follows the resource prefix in the names of variable set configmaps
+	variableSetPrefix = "variables-"
+	// Follows the resource prefix in the names of captured payload secrets, see capture.go
+	capturedPayloadPrefix = "payload-"
+	// Tekton Triggers labels PipelineRuns with the name of their trigger
+	maxTriggerNameLength = 63
+	// Kubernetes keeps this much of a GenerateName, adding 5 random characters
+	maxGenerateNameLength = 58
+	// Length of the hash ending shortened names
+	nameHashLength = 8
+	// Longest number generateMonitorTriggerName adds to a monitor trigger's prefix
+	maxMonitorNumberLength = 4
+)
+
+// setNameDefaults fills in the names not set in the environment
+func setNameDefaults(defaults *EnvDefaults) {
+	defaults.EventListenerName = getEnvOrDefault("EVENTLISTENER_NAME", defaultEventListenerName)
+	defaults.ResourcePrefix = getEnvOrDefault("RESOURCE_NAME_PREFIX", defaultResourcePrefix)
+	defaults.IngressPrefix = getEnvOrDefault("INGRESS_NAME_PREFIX", defaultIngressPrefix)
+	defaults.CertPrefix = getEnvOrDefault("CERT_NAME_PREFIX", defaultCertPrefix)
+}
+
+func getEnvOrDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (r Resource) eventListenerName() string {
+	if r.Defaults.EventListenerName == "" {
+		return defaultEventListenerName
+	}
+	return r.Defaults.EventListenerName
+}
+
+// standbyEventListenerName is the eventlistener serving deliveries while the main one is recreated
+func (r Resource) standbyEventListenerName() string {
+	return r.eventListenerName() + "-standby"
+}
+
+// resourcePrefix starts the names of generated triggerbindings, triggertemplates and configmaps
+func (r Resource) resourcePrefix() string {
+	if r.Defaults.ResourcePrefix == "" {
+		return defaultResourcePrefix
+	}
+	return r.Defaults.ResourcePrefix
+}
+
+// ingressName is the name of the ingress, or route on OpenShift, exposing the eventlistener
+func (r Resource) ingressName() string {
+	prefix := r.Defaults.IngressPrefix
+	if prefix == "" {
+		prefix = defaultIngressPrefix
+	}
+	return prefix + r.eventListenerName()
+}
+
+// certSecretName is the TLS secret created for the ingress
+func (r Resource) certSecretName() string {
+	prefix := r.Defaults.CertPrefix
+	if prefix == "" {
+		prefix = defaultCertPrefix
+	}
+	return prefix + r.eventListenerName()
+}
+
+// listenerServiceName is the service Tekton Triggers creates for the named eventlistener
+func listenerServiceName(eventListener string) string {
+	return listenerServicePrefix + eventListener
+}
+
+func (r Resource) variableSetConfigMapName(set string) string {
+	return r.resourcePrefix() + variableSetPrefix + set
+}
+
+// capturedPayloadSecretName is the secret the interceptor keeps the payload of a delivery to a trigger in
+func (r Resource) capturedPayloadSecretName(trigger, deliveryID string) string {
+	sum := sha256.Sum256([]byte(trigger + "/" + deliveryID))
+	return r.resourcePrefix() + capturedPayloadPrefix + hex.EncodeToString(sum[:])[:20]
+}
+
+// boundedName returns name if it's at most max characters, else name cut short to end in a hash of the whole
+func boundedName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return strings.TrimRight(name[:max-nameHashLength-1], "-_.") + "-" + hex.EncodeToString(sum[:])[:nameHashLength]
+}
+
+// bindingNamePrefix starts the generated names of triggerbindings for the named webhook or monitor trigger
+func bindingNamePrefix(prefix, name string) string {
+	return boundedName(prefix+name, maxGenerateNameLength-1) + "-"
+}
+
+// monitorTriggerPrefix starts the name of the monitor trigger for the repository owner/repo
+func monitorTriggerPrefix(owner, repo string) string {
+	return boundedName(owner+"."+repo, maxTriggerNameLength-maxMonitorNumberLength-1) + "-"
+}
+
+// isGeneratedBindingName reports whether a triggerbinding name was generated for the named webhook or monitor
+// trigger, for bindings that have gone so can't be told apart by their labels, see isWebhookResource
+func (r Resource) isGeneratedBindingName(ref, name string) bool {
+	return strings.HasPrefix(ref, bindingNamePrefix(r.resourcePrefix(), name))
+}
+
+// overridesTemplateName is the name of the triggertemplate generated for the overrides of a webhook
+func (r Resource) overridesTemplateName(name, namespace string) string {
+	return r.resourcePrefix() + name + "-" + namespace + "-template"
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultNames(t *testing.T) {
+	r := dummyResource()
+	names := []struct{ name, expected string }{
+		{r.eventListenerName(), "tekton-webhooks-eventlistener"},
+		{r.standbyEventListenerName(), "tekton-webhooks-eventlistener-standby"},
+		{r.ingressName(), "el-tekton-webhooks-eventlistener"},
+		{r.certSecretName(), "cert-tekton-webhooks-eventlistener"},
+		{r.variableSetConfigMapName("staging"), "wext-variables-staging"},
+		{listenerServiceName(r.eventListenerName()), "el-tekton-webhooks-eventlistener"},
+	}
+	for _, n := range names {
+		if n.name != n.expected {
+			t.Errorf("name was %s, expected %s", n.name, n.expected)
+		}
+	}
+}
+
+func TestConfiguredNames(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.EventListenerName = "team-a-listener"
+	r.Defaults.ResourcePrefix = "team-a-"
+	r.Defaults.IngressPrefix = "ing-"
+	r.Defaults.CertPrefix = "tls-"
+	names := []struct{ name, expected string }{
+		{r.ingressName(), "ing-team-a-listener"},
+		{r.certSecretName(), "tls-team-a-listener"},
+		{r.variableSetConfigMapName("staging"), "team-a-variables-staging"},
+		{listenerServiceName(r.eventListenerName()), "el-team-a-listener"},
+	}
+	for _, n := range names {
+		if n.name != n.expected {
+			t.Errorf("name was %s, expected %s", n.name, n.expected)
+		}
+	}
+	if r.overridesTemplateName("hook", "ns") != "team-a-hook-ns-template" {
+		t.Errorf("overrides template name was %s, expected team-a-hook-ns-template", r.overridesTemplateName("hook", "ns"))
+	}
+	if !r.isGeneratedBindingName("team-a-hook-x7kq2", "hook") || r.isGeneratedBindingName("wext-hook-x7kq2", "hook") {
+		t.Error("generated binding names not recognised by the configured prefix")
+	}
+
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", Pipeline: "pipeline1"}
+	hookBinding, _, err := r.createBindings(hook, "", false)
+	if err != nil {
+		t.Fatalf("error creating bindings: %s", err)
+	}
+	if hookBinding != "team-a-hook-" {
+		t.Errorf("binding was named %s, expected team-a-hook-", hookBinding)
+	}
+}
+
+func TestBoundedName(t *testing.T) {
+	if name := boundedName("hook-default", 20); name != "hook-default" {
+		t.Errorf("expected a short name to be kept, got %s", name)
+	}
+	long := strings.Repeat("a", 30) + "-" + strings.Repeat("b", 40)
+	name := boundedName(long, 40)
+	if len(name) > 40 || !strings.HasPrefix(name, strings.Repeat("a", 30)+"-") || name != boundedName(long, 40) {
+		t.Errorf("expected a stable name of at most 40 characters, got %s", name)
+	}
+	if other := boundedName(long+"c", 40); other == name {
+		t.Errorf("expected different long names to be shortened apart, got %s", other)
+	}
+	if prefix := monitorTriggerPrefix("owner", "repo"); prefix != "owner.repo-" {
+		t.Errorf("monitor trigger prefix was %s", prefix)
+	}
+	if prefix := monitorTriggerPrefix(strings.Repeat("o", 39), strings.Repeat("r", 100)); len(prefix)+maxMonitorNumberLength > maxTriggerNameLength {
+		t.Errorf("expected the monitor trigger prefix to be shortened, got %s", prefix)
+	}
+}
+
+func TestWebhookFoundByShortenedNames(t *testing.T) {
+	r := dummyResource()
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	hook := webhook{Name: strings.Repeat("h", 57), Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	if err := r.assignTriggerPrefix(&hook); err != nil || hook.TriggerPrefix == "" {
+		t.Fatalf("expected the trigger names to be shortened, got %q, %v", hook.TriggerPrefix, err)
+	}
+	createTriggerResources(hook, r)
+	el, err := r.createEventListener(hook, installNs, monitorTriggerPrefix("owner", "repo"))
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	for _, trigger := range el.Spec.Triggers {
+		if len(trigger.Name) > maxTriggerNameLength {
+			t.Errorf("trigger %s is too long", trigger.Name)
+		}
+		for _, binding := range trigger.Bindings {
+			if len(binding.Ref) > maxGenerateNameLength {
+				t.Errorf("binding %s is too long", binding.Ref)
+			}
+		}
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		t.Fatalf("error getting webhooks: %s", err)
+	}
+	if len(hooks) != 1 || hooks[0].Name != hook.Name || hooks[0].TriggerPrefix != hook.TriggerPrefix {
+		t.Errorf("expected the webhook to be found by its name, got %+v", hooks)
+	}
+}
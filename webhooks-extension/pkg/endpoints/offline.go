@@ -0,0 +1,451 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+GIT_PROVIDER_MODE lets the extension run without a git server, for demos
+and offline development. In record mode the real provider is used and what
+every call returned for a repository - its webhooks, files, directory
+listings, default branch and token scope checks, and the statuses and
+comments sent to it - is written to a file under GIT_PROVIDER_RECORDINGS_DIR.
+In replay mode no git server is contacted and no access token is read, every
+call is answered from and written to those files instead, starting with
+nothing for a repository without a recording.
+---------------------------------------*/
+
+const (
+	providerModeRecord = "record"
+	providerModeReplay = "replay"
+	// Used if GIT_PROVIDER_RECORDINGS_DIR isn't set
+	defaultRecordingsDir = "/tmp/webhooks-extension-recordings"
+)
+
+var recordingsLock = trackedMutex{name: "recordings"}
+
+// offlineWebhook is a provider webhook as recorded
+type offlineWebhook struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+}
+
+func (hook offlineWebhook) GetURL() string {
+	return hook.URL
+}
+
+func (hook offlineWebhook) GetID() int {
+	return hook.ID
+}
+
+type recording struct {
+	Hooks []offlineWebhook `json:"hooks"`
+	// Files read from the repository, by path
+	Files map[string]string `json:"files,omitempty"`
+	// Files listed in each directory of the repository, by directory
+	Dirs map[string][]string `json:"dirs,omitempty"`
+	// The repository's default branch, replayed as master if not recorded
+	DefaultBranch string `json:"defaultbranch,omitempty"`
+	// The error checking each token scope returned, by operation, "" if the token had the scope
+	TokenScopes map[string]string `json:"tokenscopes,omitempty"`
+	// Statuses set on commits and comments made on pull requests, in the order they were sent
+	Statuses []recordedStatus  `json:"statuses,omitempty"`
+	Comments []recordedComment `json:"comments,omitempty"`
+}
+
+type recordedStatus struct {
+	SHA         string `json:"sha"`
+	State       string `json:"state"`
+	Context     string `json:"context,omitempty"`
+	Description string `json:"description,omitempty"`
+	TargetURL   string `json:"targeturl,omitempty"`
+}
+
+type recordedComment struct {
+	PullRequest int    `json:"pullrequest"`
+	Body        string `json:"body"`
+}
+
+// recordingProvider records the webhooks of a repository after each call to the real provider
+type recordingProvider struct {
+	Live GitProvider
+	Path string
+}
+
+// replayProvider keeps the webhooks of a repository in its recording, without a git server
+type replayProvider struct {
+	Resource Resource
+	Path     string
+}
+
+func getProviderMode() string {
+	return strings.ToLower(os.Getenv("GIT_PROVIDER_MODE"))
+}
+
+// getRecordingPath returns the file provider's org/repo is recorded in, org and repo come from the
+// webhook's repository URL so they're rejected if they could name a file outside the recordings directory
+func getRecordingPath(provider, org, repo string) (string, error) {
+	for _, part := range []string{provider, org, repo} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return "", fmt.Errorf("%q can't be used in the path of a recording", part)
+		}
+	}
+	dir := os.Getenv("GIT_PROVIDER_RECORDINGS_DIR")
+	if dir == "" {
+		dir = defaultRecordingsDir
+	}
+	return filepath.Join(dir, provider, org, repo+".json"), nil
+}
+
+// withRecording wraps a live provider so its calls are recorded when in record mode
+func withRecording(live GitProvider, path string) GitProvider {
+	if getProviderMode() != providerModeRecord {
+		return live
+	}
+	return recordingProvider{Live: live, Path: path}
+}
+
+func loadRecording(path string) (recording, error) {
+	recorded := recording{Hooks: []offlineWebhook{}}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return recorded, nil
+		}
+		return recorded, err
+	}
+	err = json.Unmarshal(data, &recorded)
+	return recorded, err
+}
+
+func saveRecording(path string, recorded recording) error {
+	data, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// updateRecording applies update to the recording at path and saves it
+func updateRecording(path string, update func(*recording)) error {
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(path)
+	if err != nil {
+		return err
+	}
+	update(&recorded)
+	return saveRecording(path, recorded)
+}
+
+func newRecordedStatus(sha string, status commitStatus) recordedStatus {
+	return recordedStatus{SHA: sha, State: status.State, Context: status.Context, Description: status.Description, TargetURL: status.TargetURL}
+}
+
+// Replay ---------------------------------------------------------------------------------------------------------------
+
+func (p replayProvider) AddWebhook(hook webhook) error {
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(p.Path)
+	if err != nil {
+		return err
+	}
+	id := 1
+	for _, existing := range recorded.Hooks {
+		if existing.ID >= id {
+			id = existing.ID + 1
+		}
+	}
+	recorded.Hooks = append(recorded.Hooks, offlineWebhook{ID: id, URL: hookCallbackURL(p.Resource, hook)})
+	logging.Log.Debugf("replay: added webhook %d to %s", id, p.Path)
+	return saveRecording(p.Path, recorded)
+}
+
+func (p replayProvider) UpdateWebhook(existing GitWebhook, hook webhook, callbackURL string) error {
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(p.Path)
+	if err != nil {
+		return err
+	}
+	for i := range recorded.Hooks {
+		if recorded.Hooks[i].ID == existing.GetID() {
+			recorded.Hooks[i].URL = callbackURL
+		}
+	}
+	return saveRecording(p.Path, recorded)
+}
+
+func (p replayProvider) DeleteWebhook(hook GitWebhook) error {
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(p.Path)
+	if err != nil {
+		return err
+	}
+	hooks := []offlineWebhook{}
+	for _, existing := range recorded.Hooks {
+		if existing.ID != hook.GetID() {
+			hooks = append(hooks, existing)
+		}
+	}
+	recorded.Hooks = hooks
+	return saveRecording(p.Path, recorded)
+}
+
+func (p replayProvider) GetAllWebhooks() ([]GitWebhook, error) {
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]GitWebhook, len(recorded.Hooks))
+	for i, hook := range recorded.Hooks {
+		webhooks[i] = hook
+	}
+	return webhooks, nil
+}
+
+// Statuses and comments are added to the recording rather than sent
+func (p replayProvider) SetCommitStatus(sha string, status commitStatus) error {
+	logging.Log.Debugf("replay: recording status %s of commit %s in %s", status.State, sha, p.Path)
+	return updateRecording(p.Path, func(recorded *recording) {
+		recorded.Statuses = append(recorded.Statuses, newRecordedStatus(sha, status))
+	})
+}
+
+func (p replayProvider) CommentOnPullRequest(number int, body string) error {
+	logging.Log.Debugf("replay: recording comment on pull request %d in %s", number, p.Path)
+	return updateRecording(p.Path, func(recorded *recording) {
+		recorded.Comments = append(recorded.Comments, recordedComment{PullRequest: number, Body: body})
+	})
+}
+
+func (p replayProvider) GetFile(path string) ([]byte, error) {
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	content, found := recorded.Files[path]
+	if !found {
+		return nil, errFileNotFound
+	}
+	return []byte(content), nil
+}
+
+// CheckTokenScope replays the recorded check of operation, letting operations that weren't recorded through
+func (p replayProvider) CheckTokenScope(operation string) error {
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(p.Path)
+	if err != nil {
+		return err
+	}
+	if message := recorded.TokenScopes[operation]; message != "" {
+		return errors.New(message)
+	}
+	return nil
+}
+
+func (p replayProvider) DefaultBranch() (string, error) {
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(p.Path)
+	if err != nil || recorded.DefaultBranch == "" {
+		return "master", nil
+	}
+	return recorded.DefaultBranch, nil
+}
+
+// ListFiles replays the recorded listing of dir, or lists the recorded files in dir if it wasn't listed
+// in record mode
+func (p replayProvider) ListFiles(dir string) ([]string, error) {
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	if files, found := recorded.Dirs[dir]; found {
+		return files, nil
+	}
+	prefix := ""
+	if dir != "" {
+		prefix = strings.TrimSuffix(dir, "/") + "/"
+	}
+	files := []string{}
+	for path := range recorded.Files {
+		if strings.HasPrefix(path, prefix) && !strings.Contains(strings.TrimPrefix(path, prefix), "/") {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 && dir != "" {
+		return nil, errFileNotFound
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Record ---------------------------------------------------------------------------------------------------------------
+
+func (p recordingProvider) AddWebhook(hook webhook) error {
+	if err := p.Live.AddWebhook(hook); err != nil {
+		return err
+	}
+	return p.record()
+}
+
+func (p recordingProvider) UpdateWebhook(existing GitWebhook, hook webhook, callbackURL string) error {
+	if err := p.Live.UpdateWebhook(existing, hook, callbackURL); err != nil {
+		return err
+	}
+	return p.record()
+}
+
+func (p recordingProvider) DeleteWebhook(hook GitWebhook) error {
+	if err := p.Live.DeleteWebhook(hook); err != nil {
+		return err
+	}
+	return p.record()
+}
+
+func (p recordingProvider) GetAllWebhooks() ([]GitWebhook, error) {
+	webhooks, err := p.Live.GetAllWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+	recorded, err := loadRecording(p.Path)
+	if err != nil {
+		recorded = recording{}
+	}
+	recorded.Hooks = []offlineWebhook{}
+	for _, hook := range webhooks {
+		recorded.Hooks = append(recorded.Hooks, offlineWebhook{ID: hook.GetID(), URL: hook.GetURL()})
+	}
+	if err := saveRecording(p.Path, recorded); err != nil {
+		// Recording is best effort, the live call succeeded
+		logging.Log.Errorf("error recording webhooks to %s: %s", p.Path, err)
+	}
+	return webhooks, nil
+}
+
+func (p recordingProvider) SetCommitStatus(sha string, status commitStatus) error {
+	if err := p.Live.SetCommitStatus(sha, status); err != nil {
+		return err
+	}
+	p.bestEffort("status of commit "+sha, func(recorded *recording) {
+		recorded.Statuses = append(recorded.Statuses, newRecordedStatus(sha, status))
+	})
+	return nil
+}
+
+func (p recordingProvider) CommentOnPullRequest(number int, body string) error {
+	if err := p.Live.CommentOnPullRequest(number, body); err != nil {
+		return err
+	}
+	p.bestEffort(fmt.Sprintf("comment on pull request %d", number), func(recorded *recording) {
+		recorded.Comments = append(recorded.Comments, recordedComment{PullRequest: number, Body: body})
+	})
+	return nil
+}
+
+func (p recordingProvider) ListFiles(dir string) ([]string, error) {
+	files, err := p.Live.ListFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	p.bestEffort("listing of "+dir, func(recorded *recording) {
+		if recorded.Dirs == nil {
+			recorded.Dirs = map[string][]string{}
+		}
+		recorded.Dirs[dir] = files
+	})
+	return files, nil
+}
+
+// CheckTokenScope records failed checks as well as passed ones, a replayed token should lack the same scopes
+func (p recordingProvider) CheckTokenScope(operation string) error {
+	scopeErr := p.Live.CheckTokenScope(operation)
+	p.bestEffort("token scope check of "+operation, func(recorded *recording) {
+		if recorded.TokenScopes == nil {
+			recorded.TokenScopes = map[string]string{}
+		}
+		recorded.TokenScopes[operation] = ""
+		if scopeErr != nil {
+			recorded.TokenScopes[operation] = scopeErr.Error()
+		}
+	})
+	return scopeErr
+}
+
+func (p recordingProvider) DefaultBranch() (string, error) {
+	branch, err := p.Live.DefaultBranch()
+	if err != nil {
+		return "", err
+	}
+	p.bestEffort("the default branch", func(recorded *recording) {
+		recorded.DefaultBranch = branch
+	})
+	return branch, nil
+}
+
+func (p recordingProvider) GetFile(path string) ([]byte, error) {
+	content, err := p.Live.GetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p.bestEffort(path, func(recorded *recording) {
+		if recorded.Files == nil {
+			recorded.Files = map[string]string{}
+		}
+		recorded.Files[path] = string(content)
+	})
+	return content, nil
+}
+
+// bestEffort applies update to the recording, a failure is only logged as the live call succeeded
+func (p recordingProvider) bestEffort(what string, update func(*recording)) {
+	if err := updateRecording(p.Path, update); err != nil {
+		logging.Log.Errorf("error recording %s to %s: %s", what, p.Path, err)
+	}
+}
+
+// record saves the webhooks as they are after a change, the change itself has succeeded
+// so a failure to list the webhooks is only logged
+func (p recordingProvider) record() error {
+	if _, err := p.GetAllWebhooks(); err != nil {
+		logging.Log.Errorf("error recording webhooks to %s: %s", p.Path, err)
+	}
+	return nil
+}
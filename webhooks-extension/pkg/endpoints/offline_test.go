@@ -0,0 +1,212 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// testRecordingPath returns the path of a recording, failing the test if it can't be recorded
+func testRecordingPath(t *testing.T, provider, org, repo string) string {
+	path, err := getRecordingPath(provider, org, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGetRecordingPath(t *testing.T) {
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", "/recordings")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+	if path := testRecordingPath(t, "github", "owner", "repo"); path != "/recordings/github/owner/repo.json" {
+		t.Errorf("recording path was %s, expected /recordings/github/owner/repo.json", path)
+	}
+	for _, parts := range [][]string{{"github", "..", "repo"}, {"github", "owner", ".."}, {"github", "owner/sub", "repo"},
+		{"github", "owner", `..\repo`}, {"github", "", "repo"}} {
+		if path, err := getRecordingPath(parts[0], parts[1], parts[2]); err == nil {
+			t.Errorf("recording path for %v was %s, expected an error", parts, path)
+		}
+	}
+}
+
+func TestReplayProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("GIT_PROVIDER_MODE", "replay")
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", dir)
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+
+	r := dummyResource()
+	hook := webhook{GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "missing-secret"}
+
+	// No git server or access token secret is needed to add a webhook
+	if err := r.AddWebhook(hook, "owner", "repo"); err != nil {
+		t.Fatalf("unexpected error adding webhook: %s", err.Error())
+	}
+	if err := r.AddWebhook(hook, "owner", "repo"); err != nil {
+		t.Fatalf("unexpected error adding webhook again: %s", err.Error())
+	}
+	provider, err := r.createGitProviderForWebhook(hook, "owner", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := provider.GetAllWebhooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 1 || hooks[0].GetURL() != getCallbackURL(*r) || hooks[0].GetID() != 1 {
+		t.Fatalf("expected one webhook with ID 1 and URL %s, got %+v", getCallbackURL(*r), hooks)
+	}
+
+	if err := r.MigrateWebhook(hook, "owner", "repo", getCallbackURL(*r), "http://new.callback"); err != nil {
+		t.Fatalf("unexpected error migrating webhook: %s", err.Error())
+	}
+	hooks, _ = provider.GetAllWebhooks()
+	if len(hooks) != 1 || hooks[0].GetURL() != "http://new.callback" {
+		t.Fatalf("expected the webhook to be migrated, got %+v", hooks)
+	}
+
+	if err := provider.DeleteWebhook(hooks[0]); err != nil {
+		t.Fatal(err)
+	}
+	hooks, _ = provider.GetAllWebhooks()
+	if len(hooks) != 0 {
+		t.Fatalf("expected no webhooks after delete, got %+v", hooks)
+	}
+	if _, err := os.Stat(testRecordingPath(t, "github", "owner", "repo")); err != nil {
+		t.Errorf("expected a recording for owner/repo: %s", err.Error())
+	}
+}
+
+type fakeProvider struct {
+	hooks []GitWebhook
+}
+
+var errFakeScope = errors.New("token can't delete webhooks")
+
+func (p *fakeProvider) AddWebhook(hook webhook) error {
+	p.hooks = append(p.hooks, offlineWebhook{ID: 7, URL: "http://live.callback"})
+	return nil
+}
+
+func (p *fakeProvider) UpdateWebhook(existing GitWebhook, hook webhook, callbackURL string) error {
+	return nil
+}
+
+func (p *fakeProvider) DeleteWebhook(hook GitWebhook) error {
+	p.hooks = nil
+	return nil
+}
+
+func (p *fakeProvider) GetAllWebhooks() ([]GitWebhook, error) {
+	return p.hooks, nil
+}
+
+func (p *fakeProvider) SetCommitStatus(sha string, status commitStatus) error {
+	return nil
+}
+
+func (p *fakeProvider) CommentOnPullRequest(number int, body string) error {
+	return nil
+}
+
+func (p *fakeProvider) GetFile(path string) ([]byte, error) {
+	return []byte("content of " + path), nil
+}
+
+func (p *fakeProvider) ListFiles(dir string) ([]string, error) {
+	return []string{dir + "/pipeline.yaml"}, nil
+}
+
+func (p *fakeProvider) DefaultBranch() (string, error) {
+	return "main", nil
+}
+
+func (p *fakeProvider) CheckTokenScope(operation string) error {
+	if operation == "delete" {
+		return errFakeScope
+	}
+	return nil
+}
+
+func TestRecordingProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/github/owner/repo.json"
+
+	live := &fakeProvider{}
+	if provider := withRecording(live, path); provider != live {
+		t.Error("expected the live provider when not in record mode")
+	}
+
+	os.Setenv("GIT_PROVIDER_MODE", "record")
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	provider := withRecording(live, path)
+	if err := provider.AddWebhook(webhook{}); err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := loadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded.Hooks) != 1 || recorded.Hooks[0].ID != 7 || recorded.Hooks[0].URL != "http://live.callback" {
+		t.Errorf("expected the live webhook to be recorded, got %+v", recorded.Hooks)
+	}
+
+	provider.GetFile("Dockerfile")
+	provider.ListFiles(".tekton")
+	provider.DefaultBranch()
+	provider.CheckTokenScope("add")
+	if err := provider.CheckTokenScope("delete"); err != errFakeScope {
+		t.Errorf("expected the live token scope error, got %v", err)
+	}
+	provider.SetCommitStatus("abc123", commitStatus{State: "success", Context: "tekton"})
+	provider.CommentOnPullRequest(3, "/retest")
+
+	// Everything the live provider returned is replayed
+	replay := replayProvider{Resource: *dummyResource(), Path: path}
+	if content, err := replay.GetFile("Dockerfile"); err != nil || string(content) != "content of Dockerfile" {
+		t.Errorf("replayed file was %q, %v", content, err)
+	}
+	if files, err := replay.ListFiles(".tekton"); err != nil || len(files) != 1 || files[0] != ".tekton/pipeline.yaml" {
+		t.Errorf("replayed listing was %v, %v", files, err)
+	}
+	if branch, _ := replay.DefaultBranch(); branch != "main" {
+		t.Errorf("replayed default branch was %s, expected main", branch)
+	}
+	if err := replay.CheckTokenScope("add"); err != nil {
+		t.Errorf("replayed add scope check failed: %s", err)
+	}
+	if err := replay.CheckTokenScope("delete"); err == nil || err.Error() != errFakeScope.Error() {
+		t.Errorf("replayed delete scope check was %v, expected %v", err, errFakeScope)
+	}
+	replay.CommentOnPullRequest(4, "/test")
+	recorded, _ = loadRecording(path)
+	if len(recorded.Statuses) != 1 || recorded.Statuses[0].SHA != "abc123" || recorded.Statuses[0].State != "success" {
+		t.Errorf("expected the commit status to be recorded, got %+v", recorded.Statuses)
+	}
+	if len(recorded.Comments) != 2 || recorded.Comments[0].Body != "/retest" || recorded.Comments[1].PullRequest != 4 {
+		t.Errorf("expected the live and replayed comments to be recorded, got %+v", recorded.Comments)
+	}
+}
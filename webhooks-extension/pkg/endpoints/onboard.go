@@ -0,0 +1,345 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/onboard").To(r.onboardNamespace))
+---------------------------------------*/
+
+const (
+	// Service account created for PipelineRuns if the request doesn't name one
+	defaultPipelineServiceAccount = "tekton-webhooks-pipeline"
+	// RoleBinding letting the eventlistener create PipelineRuns in an onboarded namespace
+	eventListenerRoleBinding = "tekton-webhooks-extension-eventlistener"
+	// ClusterRole granted to the eventlistener, see base/200-clusterrole-eventListener.yaml
+	eventListenerClusterRole = "tekton-triggers-minimal"
+)
+
+type onboardRequest struct {
+	Namespace      string `json:"namespace"`
+	ServiceAccount string `json:"serviceaccount,omitempty"`
+	GitSecret      string `json:"gitsecret,omitempty"`
+	DockerSecret   string `json:"dockersecret,omitempty"`
+}
+
+type onboardResponse struct {
+	Namespace      string   `json:"namespace"`
+	ServiceAccount string   `json:"serviceaccount"`
+	Steps          []string `json:"steps"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// Prepares a namespace for webhooks to run PipelineRuns in, the steps in
+// docs/GettingStarted.md. The service account PipelineRuns use is created,
+// the git and docker secrets are linked to it and the eventlistener is bound
+// to its role in the namespace. Anything already in place is left as is, so
+// onboarding can be repeated, e.g. to link another secret. The caller must be
+// an admin allowed to do all of that in the namespace themselves, see authorizeOnboard.
+func (r Resource) onboardNamespace(request *restful.Request, response *restful.Response) {
+	onboard := onboardRequest{}
+	if err := readEntity(request, &onboard); err != nil {
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	if onboard.Namespace == "" {
+		RespondError(response, errors.New("namespace is required"), http.StatusBadRequest)
+		return
+	}
+	if onboard.ServiceAccount == "" {
+		onboard.ServiceAccount = defaultPipelineServiceAccount
+	}
+	if status, err := r.authorizeOnboard(request, onboard.Namespace); err != nil {
+		RespondError(response, err, status)
+		return
+	}
+	if !r.namespaceExists(onboard.Namespace, response) {
+		return
+	}
+
+	result := onboardResponse{Namespace: onboard.Namespace, ServiceAccount: onboard.ServiceAccount, Steps: []string{}}
+	step := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		logging.Log.Info(msg)
+		result.Steps = append(result.Steps, msg)
+	}
+
+	// Secrets must exist before anything is changed. The extension can't read secrets outside its own namespace
+	// unless it's been granted it, so a secret it may not read is linked unchecked.
+	secrets := []string{}
+	for _, secret := range []struct{ name, annotation string }{
+		{onboard.GitSecret, "tekton.dev/git-"},
+		{onboard.DockerSecret, "tekton.dev/docker-"},
+	} {
+		if secret.name == "" {
+			continue
+		}
+		found, err := r.K8sClient.CoreV1().Secrets(onboard.Namespace).Get(secret.name, metav1.GetOptions{})
+		if k8serrors.IsForbidden(err) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("secret %s could not be checked, the extension may not read secrets in namespace %s", secret.name, onboard.Namespace))
+		} else if err != nil {
+			msg := fmt.Sprintf("secret %s not found in namespace %s", secret.name, onboard.Namespace)
+			RespondErrorAndMessage(response, err, msg, http.StatusBadRequest)
+			return
+		} else if !hasAnnotationPrefix(found, secret.annotation) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("secret %s has no %s* annotation so Tekton won't use it", secret.name, secret.annotation))
+		}
+		secrets = append(secrets, secret.name)
+	}
+
+	sa, created, err := r.ensureServiceAccount(onboard.Namespace, onboard.ServiceAccount)
+	if err != nil {
+		RespondError(response, fmt.Errorf("error creating service account %s: %s", onboard.ServiceAccount, err), http.StatusInternalServerError)
+		return
+	}
+	if created {
+		step("created service account %s", onboard.ServiceAccount)
+	} else {
+		step("service account %s already exists", onboard.ServiceAccount)
+	}
+
+	linked := []string{}
+	for _, name := range secrets {
+		if !isSecretLinked(sa, name) {
+			sa.Secrets = append(sa.Secrets, corev1.ObjectReference{Name: name})
+			linked = append(linked, name)
+		}
+	}
+	if len(linked) > 0 {
+		if _, err := r.K8sClient.CoreV1().ServiceAccounts(onboard.Namespace).Update(sa); err != nil {
+			RespondError(response, fmt.Errorf("error linking secrets to service account %s: %s", onboard.ServiceAccount, err), http.StatusInternalServerError)
+			return
+		}
+		step("linked secrets %s to service account %s", strings.Join(linked, ", "), onboard.ServiceAccount)
+	}
+
+	created, err = r.ensureEventListenerRoleBinding(onboard.Namespace)
+	if err != nil {
+		RespondError(response, fmt.Errorf("error creating rolebinding %s: %s", eventListenerRoleBinding, err), http.StatusInternalServerError)
+		return
+	}
+	if created {
+		step("created rolebinding %s for service account %s", eventListenerRoleBinding, eventListenerServiceAccount)
+	} else {
+		step("rolebinding %s already exists", eventListenerRoleBinding)
+	}
+
+	// Verify by reading back what webhooks will rely on
+	if err := r.verifyOnboarded(onboard.Namespace, onboard.ServiceAccount, secrets); err != nil {
+		RespondError(response, fmt.Errorf("namespace %s was not onboarded: %s", onboard.Namespace, err), http.StatusInternalServerError)
+		return
+	}
+	step("verified namespace %s", onboard.Namespace)
+
+	response.WriteEntity(result)
+}
+
+// authorizeNamespacePowers returns the status to respond with and why if the caller of request may not have the
+// extension create service accounts, rolebindings and secrets outside the install namespace. The extension's
+// clusterrole grants those in every namespace, so only admins may use them. When impersonating callers the
+// extension doesn't use them, the API server checks each change as the caller instead.
+func (r Resource) authorizeNamespacePowers(request *restful.Request) (int, error) {
+	if impersonationEnabled() {
+		return http.StatusOK, nil
+	}
+	return r.authorizeAdmin(request)
+}
+
+// authorizeOnboard returns the status to respond with and why if the caller of request may not onboard namespace:
+// they must be an admin, see authorizeNamespacePowers, and allowed to create service accounts and rolebindings
+// there, and to bind the eventlistener's clusterrole, so onboarding grants nothing they couldn't grant themselves.
+// When impersonating callers the API server checks each change as the caller instead. Requests signed with an API
+// key are checked against its scopes.
+func (r Resource) authorizeOnboard(request *restful.Request, namespace string) (int, error) {
+	if keyID, signed := signedKey(request); signed {
+		if !signedScopes(request).allowsNamespace(namespace) {
+			return http.StatusForbidden, fmt.Errorf("API key %s may not onboard namespace %s, see its scopes in secret %s",
+				keyID, namespace, apiKeysSecret)
+		}
+		return r.authorizeNamespacePowers(request)
+	}
+	if impersonationEnabled() {
+		return http.StatusOK, nil
+	}
+	if status, err := r.authorizeAdmin(request); err != nil {
+		return status, err
+	}
+	user, status, err := r.reviewToken(request, "requests onboarding namespaces", scopeCreate)
+	if err != nil {
+		return status, err
+	}
+	for _, attributes := range []authorizationv1.ResourceAttributes{
+		{Namespace: namespace, Verb: "create", Resource: "serviceaccounts"},
+		{Namespace: namespace, Verb: "update", Resource: "serviceaccounts"},
+		{Namespace: namespace, Verb: "create", Group: "rbac.authorization.k8s.io", Resource: "rolebindings"},
+		{Namespace: namespace, Verb: "bind", Group: "rbac.authorization.k8s.io", Resource: "clusterroles", Name: eventListenerClusterRole},
+	} {
+		allowed, err := r.accessAllowed(user, attributes)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !allowed {
+			return http.StatusForbidden, fmt.Errorf("%s may not %s %s in namespace %s, which onboarding it needs",
+				user.Username, attributes.Verb, attributes.Resource, namespace)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// ensureServiceAccount returns the named service account, creating it if needed
+func (r Resource) ensureServiceAccount(namespace, name string) (*corev1.ServiceAccount, bool, error) {
+	sa, err := r.K8sClient.CoreV1().ServiceAccounts(namespace).Get(name, metav1.GetOptions{})
+	if err == nil {
+		return sa, false, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, false, err
+	}
+	sa = &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    managedLabels(),
+		},
+	}
+	sa, err = r.K8sClient.CoreV1().ServiceAccounts(namespace).Create(sa)
+	return sa, err == nil, err
+}
+
+// ensureEventListenerRoleBinding binds the eventlistener's service account to its role in namespace
+func (r Resource) ensureEventListenerRoleBinding(namespace string) (bool, error) {
+	_, err := r.K8sClient.RbacV1().RoleBindings(namespace).Get(eventListenerRoleBinding, metav1.GetOptions{})
+	if err == nil {
+		return false, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return false, err
+	}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventListenerRoleBinding,
+			Namespace: namespace,
+			Labels:    managedLabels(),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     eventListenerClusterRole,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      eventListenerServiceAccount,
+			Namespace: r.Defaults.Namespace,
+		}},
+	}
+	_, err = r.K8sClient.RbacV1().RoleBindings(namespace).Create(binding)
+	return err == nil, err
+}
+
+// ensureWebhookNamespace creates the webhook's namespace if it doesn't exist and the webhook has
+// createnamespaceifmissing, onboarding it as POST /webhooks/onboard does: it is labelled as managed
+// by the extension and with the webhook's owner and cost center, the webhook's service account is
+// created unless it uses the default one, and the eventlistener is bound to its role. It returns
+// whether the namespace was created. Only admins may have it done, see authorizeNamespacePowers.
+func (r Resource) ensureWebhookNamespace(webhook webhook) (bool, error) {
+	if !webhook.CreateNamespaceIfMissing {
+		return false, nil
+	}
+	_, err := r.K8sClient.CoreV1().Namespaces().Get(webhook.Namespace, metav1.GetOptions{})
+	if err == nil {
+		return false, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return false, err
+	}
+	labels := managedLabels()
+	if webhook.Owner != "" {
+		labels[ownerLabel] = labelValue(webhook.Owner)
+	}
+	if webhook.CostCenter != "" {
+		labels[costCenterLabel] = labelValue(webhook.CostCenter)
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: webhook.Namespace, Labels: labels}}
+	if _, err := r.K8sClient.CoreV1().Namespaces().Create(namespace); err != nil {
+		return false, fmt.Errorf("error creating namespace %s: %s", webhook.Namespace, err)
+	}
+	logging.Log.Infof("created namespace %s for webhook %s", webhook.Namespace, webhook.Name)
+
+	// Kubernetes creates the default service account in every namespace
+	if webhook.ServiceAccount != "" && webhook.ServiceAccount != "default" {
+		if _, _, err := r.ensureServiceAccount(webhook.Namespace, webhook.ServiceAccount); err != nil {
+			return true, fmt.Errorf("error creating service account %s: %s", webhook.ServiceAccount, err)
+		}
+	}
+	if _, err := r.ensureEventListenerRoleBinding(webhook.Namespace); err != nil {
+		return true, fmt.Errorf("error creating rolebinding %s: %s", eventListenerRoleBinding, err)
+	}
+	return true, nil
+}
+
+// verifyOnboarded checks the service account, its secrets and the eventlistener rolebinding are in place
+func (r Resource) verifyOnboarded(namespace, serviceAccount string, secrets []string) error {
+	sa, err := r.K8sClient.CoreV1().ServiceAccounts(namespace).Get(serviceAccount, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	for _, name := range secrets {
+		if !isSecretLinked(sa, name) {
+			return fmt.Errorf("secret %s is not linked to service account %s", name, serviceAccount)
+		}
+	}
+	binding, err := r.K8sClient.RbacV1().RoleBindings(namespace).Get(eventListenerRoleBinding, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	for _, subject := range binding.Subjects {
+		if subject.Kind == "ServiceAccount" && subject.Name == eventListenerServiceAccount && subject.Namespace == r.Defaults.Namespace {
+			return nil
+		}
+	}
+	return fmt.Errorf("rolebinding %s does not include service account %s", eventListenerRoleBinding, eventListenerServiceAccount)
+}
+
+func isSecretLinked(sa *corev1.ServiceAccount, secret string) bool {
+	for _, ref := range sa.Secrets {
+		if ref.Name == secret {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnnotationPrefix(secret *corev1.Secret, prefix string) bool {
+	for annotation := range secret.Annotations {
+		if strings.HasPrefix(annotation, prefix) {
+			return true
+		}
+	}
+	return false
+}
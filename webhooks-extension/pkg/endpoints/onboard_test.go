@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeOnboardReviews authenticates the tokens admin and user, and lets admin, not user, onboard any namespace
+func fakeOnboardReviews(r *Resource) {
+	fake := r.K8sClient.(*fakek8sclientset.Clientset)
+	fake.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		review.Status.Authenticated = review.Spec.Token == "admin" || review.Spec.Token == "user"
+		review.Status.User = authenticationv1.UserInfo{Username: review.Spec.Token}
+		return true, review, nil
+	})
+	fake.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "admin"
+		return true, review, nil
+	})
+}
+
+func onboardRequestFor(r *Resource, onboard onboardRequest) *httptest.ResponseRecorder {
+	return onboardRequestAs(r, onboard, "admin")
+}
+
+func onboardRequestAs(r *Resource, onboard onboardRequest, token string) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(onboard)
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/onboard", bytes.NewBuffer(jsonBody))
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	httpWriter := httptest.NewRecorder()
+	r.onboardNamespace(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	return httpWriter
+}
+
+func TestOnboardNamespace(t *testing.T) {
+	r := dummyResource()
+	fakeOnboardReviews(r)
+	r.K8sClient.CoreV1().Namespaces().Create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "green"}})
+	r.K8sClient.CoreV1().Secrets("green").Create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:        "git",
+		Annotations: map[string]string{"tekton.dev/git-0": "https://github.com"},
+	}})
+	r.K8sClient.CoreV1().Secrets("green").Create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "docker"}})
+
+	httpWriter := onboardRequestFor(r, onboardRequest{Namespace: "green", GitSecret: "git", DockerSecret: "docker"})
+	if httpWriter.Code != http.StatusOK {
+		t.Fatalf("onboarding returned %d, expected 200: %s", httpWriter.Code, httpWriter.Body.String())
+	}
+	result := onboardResponse{}
+	if err := json.NewDecoder(httpWriter.Body).Decode(&result); err != nil {
+		t.Fatalf("error reading onboard response: %s", err.Error())
+	}
+	if len(result.Warnings) != 1 {
+		t.Errorf("expected a warning for the docker secret without an annotation, got %v", result.Warnings)
+	}
+
+	sa, err := r.K8sClient.CoreV1().ServiceAccounts("green").Get(defaultPipelineServiceAccount, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("service account was not created: %s", err.Error())
+	}
+	if !isSecretLinked(sa, "git") || !isSecretLinked(sa, "docker") {
+		t.Errorf("secrets were not linked to the service account: %+v", sa.Secrets)
+	}
+	binding, err := r.K8sClient.RbacV1().RoleBindings("green").Get(eventListenerRoleBinding, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("rolebinding was not created: %s", err.Error())
+	}
+	if binding.RoleRef.Name != eventListenerClusterRole || binding.Subjects[0].Namespace != r.Defaults.Namespace {
+		t.Errorf("unexpected rolebinding %+v", binding)
+	}
+
+	// Onboarding again changes nothing
+	if code := onboardRequestFor(r, onboardRequest{Namespace: "green", GitSecret: "git"}).Code; code != http.StatusOK {
+		t.Errorf("onboarding again returned %d, expected 200", code)
+	}
+	sa, _ = r.K8sClient.CoreV1().ServiceAccounts("green").Get(defaultPipelineServiceAccount, metav1.GetOptions{})
+	if len(sa.Secrets) != 2 {
+		t.Errorf("expected 2 linked secrets after onboarding again, got %+v", sa.Secrets)
+	}
+}
+
+func TestOnboardNamespaceErrors(t *testing.T) {
+	r := dummyResource()
+	fakeOnboardReviews(r)
+	if code := onboardRequestFor(r, onboardRequest{}).Code; code != http.StatusBadRequest {
+		t.Errorf("onboarding without a namespace returned %d, expected 400", code)
+	}
+	if code := onboardRequestFor(r, onboardRequest{Namespace: "missing"}).Code; code != http.StatusBadRequest {
+		t.Errorf("onboarding a missing namespace returned %d, expected 400", code)
+	}
+	r.K8sClient.CoreV1().Namespaces().Create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "green"}})
+	if code := onboardRequestAs(r, onboardRequest{Namespace: "green"}, "").Code; code != http.StatusUnauthorized {
+		t.Errorf("onboarding without a token returned %d, expected 401", code)
+	}
+	if code := onboardRequestAs(r, onboardRequest{Namespace: "green"}, "user").Code; code != http.StatusForbidden {
+		t.Errorf("onboarding by a caller who may not create rolebindings returned %d, expected 403", code)
+	}
+	if _, err := r.K8sClient.RbacV1().RoleBindings("green").Get(eventListenerRoleBinding, metav1.GetOptions{}); err == nil {
+		t.Error("rolebinding was created for a caller who may not create rolebindings")
+	}
+	signed := dummyRestfulRequest(dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/onboard", nil), "")
+	signed.SetAttribute(signedKeyAttribute, "ci")
+	signed.SetAttribute(signedScopesAttribute, apiKeyScopes{Namespaces: []string{"blue"}})
+	if status, _ := r.authorizeOnboard(signed, "green"); status != http.StatusForbidden {
+		t.Errorf("onboarding with an API key scoped to another namespace returned %d, expected 403", status)
+	}
+	signed.SetAttribute(signedScopesAttribute, apiKeyScopes{Namespaces: []string{"green"}})
+	if status, _ := r.authorizeOnboard(signed, "green"); status != http.StatusForbidden {
+		t.Errorf("onboarding with an API key without the admin scope returned %d, expected 403", status)
+	}
+	if code := onboardRequestFor(r, onboardRequest{Namespace: "green", GitSecret: "missing"}).Code; code != http.StatusBadRequest {
+		t.Errorf("onboarding with a missing secret returned %d, expected 400", code)
+	}
+	if _, err := r.K8sClient.CoreV1().ServiceAccounts("green").Get(defaultPipelineServiceAccount, metav1.GetOptions{}); err == nil {
+		t.Error("service account was created although a secret was missing")
+	}
+}
+
+func TestEnsureWebhookNamespace(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: "team-a", ServiceAccount: "builder", Owner: "alice@example.com"}
+	if created, err := r.ensureWebhookNamespace(hook); created || err != nil {
+		t.Errorf("created a namespace without createnamespaceifmissing: %t, %v", created, err)
+	}
+	if _, err := r.K8sClient.CoreV1().Namespaces().Get("team-a", metav1.GetOptions{}); err == nil {
+		t.Error("namespace was created without createnamespaceifmissing")
+	}
+
+	hook.CreateNamespaceIfMissing = true
+	if created, err := r.ensureWebhookNamespace(hook); !created || err != nil {
+		t.Fatalf("expected the namespace to be created, got %t, %v", created, err)
+	}
+	ns, err := r.K8sClient.CoreV1().Namespaces().Get("team-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting namespace: %s", err)
+	}
+	if ns.Labels[managedByLabel] != extensionLabelValue || ns.Labels[ownerLabel] != "alice-example.com" {
+		t.Errorf("namespace has labels %v", ns.Labels)
+	}
+	if err := r.verifyOnboarded("team-a", "builder", nil); err != nil {
+		t.Errorf("namespace was not onboarded: %s", err)
+	}
+
+	if created, err := r.ensureWebhookNamespace(hook); created || err != nil {
+		t.Errorf("existing namespace was created again: %t, %v", created, err)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+A webhook's onclosepipeline runs when one of its pull requests is closed or
+merged, e.g. for post-merge jobs or tearing down what the webhook's
+pipeline set up. It's run through a <webhook>-<namespace>-pullrequest-closed
+trigger using the pipeline's template and pull request binding, accepting
+the closed action on GitHub and the closed and merged states on GitLab. As
+GitLab sends updates to merge requests that are already closed with the
+same state, the trigger carries Wext-Close-Event and the interceptor only
+accepts the close and merge actions on it. The interceptor adds whether the
+pull request was merged to every payload, which the webhook's binding
+passes as the webhooks-tekton-pull-request-merged param. Canaries,
+dependency, file and label routes and previews don't apply to it. The
+pipeline is kept as a binding param.
+---------------------------------------*/
+
+const (
+	closeEventHeader   = "Wext-Close-Event"
+	closeTriggerSuffix = "-pullrequest-closed"
+	// Pull request actions, on GitHub and GitLab, of a pull request being closed or merged
+	closedActions          = "closed,merged"
+	pullRequestMergedParam = "webhooks-tekton-pull-request-merged"
+)
+
+// validateOnClosePipeline checks that the on close pipeline has a template and pull request binding
+func (r Resource) validateOnClosePipeline(webhook webhook) error {
+	if webhook.OnClosePipeline == "" {
+		return nil
+	}
+	installNs := r.Defaults.Namespace
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(webhook.OnClosePipeline+"-pullrequest-binding", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("onclosepipeline triggerbinding %s could not be found: %s", webhook.OnClosePipeline+"-pullrequest-binding", err)
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(webhook.OnClosePipeline+"-template", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("onclosepipeline triggertemplate %s could not be found: %s", webhook.OnClosePipeline+"-template", err)
+	}
+	return nil
+}
+
+// onCloseParams are the binding params recording the on close pipeline and reading whether the pull request was
+// merged from the payload
+func onCloseParams(webhook webhook) []v1alpha1.Param {
+	if webhook.OnClosePipeline == "" {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{
+		{Name: "webhooks-tekton-on-close-pipeline", Value: webhook.OnClosePipeline},
+		{Name: pullRequestMergedParam, Value: "$(body." + pullRequestMergedParam + ")"},
+	}
+}
+
+// withOnClose returns the webhook's triggers followed, if it has an on close pipeline, by the trigger running it
+func withOnClose(webhook webhook, triggers []v1alpha1.EventListenerTrigger) []v1alpha1.EventListenerTrigger {
+	if webhook.OnClosePipeline == "" {
+		return triggers
+	}
+	prefix := triggerPrefix(webhook)
+	for _, trigger := range triggers {
+		if trigger.Name != prefix+"-pullrequest-event" {
+			continue
+		}
+		closed := withoutHeaders(canaryTrigger(trigger, prefix+closeTriggerSuffix, webhook.OnClosePipeline+"-pullrequest-binding", webhook.OnClosePipeline+"-template"),
+			canaryRouteHeader, canaryPercentageHeader, canaryLabelHeader, dependencyRouteHeader, dependencySendersHeader,
+			fileRulesHeader, routeLabelHeader, previewPrefixHeader, previewURLHeader, previewWebhookHeader, "Wext-Incoming-Actions")
+		closed.Interceptors[0].Webhook.Header = append(closed.Interceptors[0].Webhook.Header,
+			pipelinesv1alpha1.Param{Name: "Wext-Incoming-Actions", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: closedActions}},
+			pipelinesv1alpha1.Param{Name: closeEventHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "true"}})
+		return append(triggers, closed)
+	}
+	return triggers
+}
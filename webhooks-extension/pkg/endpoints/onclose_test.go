@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+)
+
+func TestValidateOnClosePipeline(t *testing.T) {
+	r := dummyResource()
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	for pipeline, valid := range map[string]bool{"": true, "pipeline2": true, "pipeline3": false} {
+		err := r.validateOnClosePipeline(webhook{Name: "hook", Namespace: installNs, Pipeline: "pipeline1", OnClosePipeline: pipeline})
+		if (err == nil) != valid {
+			t.Errorf("onclosepipeline %q valid was %t, expected %t: %v", pipeline, err == nil, valid, err)
+		}
+	}
+}
+
+func TestCreateEventListenerWithOnClosePipeline(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		Preview:          &previewEnvironment{},
+		OnClosePipeline:  "pipeline2",
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	found := false
+	for _, trigger := range el.Spec.Triggers {
+		if trigger.Name != "hook-default"+closeTriggerSuffix {
+			continue
+		}
+		found = true
+		if trigger.Template.Name != "pipeline2-template" || trigger.Bindings[0].Ref != "pipeline2-pullrequest-binding" {
+			t.Errorf("on close trigger uses %s and %s", trigger.Template.Name, trigger.Bindings[0].Ref)
+		}
+		if triggerHeader(trigger, "Wext-Incoming-Actions") != closedActions || triggerHeader(trigger, closeEventHeader) != "true" {
+			t.Error("expected the on close trigger to run for closed and merged pull requests")
+		}
+		if triggerHeader(trigger, previewPrefixHeader) != "" {
+			t.Error("expected the on close trigger not to open previews")
+		}
+		if name := triggerHeader(trigger, "Wext-Trigger-Name"); name != trigger.Name {
+			t.Errorf("on close trigger has Wext-Trigger-Name %s", name)
+		}
+	}
+	if !found {
+		t.Fatal("on close trigger was not created")
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	if hooks[0].OnClosePipeline != "pipeline2" {
+		t.Errorf("onclosepipeline was %q, expected pipeline2", hooks[0].OnClosePipeline)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+PipelineRun overrides let a webhook change the timeout, pod template and
+per-task service accounts of the PipelineRuns its pipeline's TriggerTemplate
+creates. Trigger params are substituted as strings, so objects such as node
+selectors can't be passed as params. Instead a copy of <pipeline>-template
+with the overrides applied is created for the webhook and its triggers use
+that, the overrides and pipeline name are kept as binding params.
+---------------------------------------*/
+
+// pipelineRunOverrides are settings applied to the PipelineRuns triggered by a webhook
+type pipelineRunOverrides struct {
+	Timeout      string              `json:"timeout,omitempty"`
+	NodeSelector map[string]string   `json:"nodeselector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	// Task name to the service account the task runs as
+	TaskServiceAccounts map[string]string `json:"taskserviceaccounts,omitempty"`
+}
+
+func validateOverrides(overrides *pipelineRunOverrides) error {
+	if overrides == nil {
+		return nil
+	}
+	if overrides.Timeout != "" {
+		if _, err := time.ParseDuration(overrides.Timeout); err != nil {
+			return fmt.Errorf("pipelinerunoverrides timeout %s is not a valid duration, e.g. 1h30m", overrides.Timeout)
+		}
+	}
+	return nil
+}
+
+// overridesParams are the binding params recording a webhook's overrides
+func overridesParams(webhook webhook) []v1alpha1.Param {
+	if webhook.Overrides == nil {
+		return []v1alpha1.Param{}
+	}
+	overridesJSON, err := json.Marshal(webhook.Overrides)
+	if err != nil {
+		logging.Log.Errorf("error marshalling pipelinerun overrides: %s", err)
+	}
+	params := []v1alpha1.Param{
+		{Name: "webhooks-tekton-pipeline", Value: webhook.Pipeline},
+		{Name: "webhooks-tekton-pipelinerun-overrides", Value: string(overridesJSON)},
+	}
+	if webhook.Overrides.Timeout != "" {
+		params = append(params, v1alpha1.Param{Name: "webhooks-tekton-timeout", Value: webhook.Overrides.Timeout})
+	}
+	return params
+}
+
+// getTemplateName returns the TriggerTemplate the webhook's triggers use, creating
+// the webhook's own copy of <pipeline>-template when it has overrides. Either way
+// its PipelineRuns are annotated with their provenance, see provenance.go.
+func (r Resource) getTemplateName(webhook webhook) (string, error) {
+	if webhook.Overrides == nil {
+		if err := r.ensureProvenanceAnnotations(webhook.Pipeline + "-template"); err != nil {
+			return "", err
+		}
+		return webhook.Pipeline + "-template", nil
+	}
+	installNs := r.Defaults.Namespace
+	template, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(webhook.Pipeline+"-template", metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	overridden := v1alpha1.TriggerTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        r.overridesTemplateName(webhook.Name, webhook.Namespace),
+			Namespace:   installNs,
+			Labels:      withLabels(template.Labels, r.webhookLabels(webhook)),
+			Annotations: webhookAnnotations(webhook),
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	for i, resourceTemplate := range overridden.Spec.ResourceTemplates {
+		raw, err := applyOverrides(resourceTemplate.Raw, webhook.Overrides)
+		if err == nil {
+			raw, err = addProvenanceAnnotations(raw)
+		}
+		if err == nil {
+			raw, err = addPullRequestLabels(raw)
+		}
+		if err != nil {
+			return "", fmt.Errorf("error applying overrides to %s: %s", template.Name, err)
+		}
+		overridden.Spec.ResourceTemplates[i].Raw = raw
+		overridden.Spec.ResourceTemplates[i].Object = nil
+	}
+
+	// Left behind if an earlier attempt at creating the webhook failed part way
+	err = r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Delete(overridden.Name, &metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return "", err
+	}
+	created, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Create(&overridden)
+	if err != nil {
+		return "", err
+	}
+	return created.Name, nil
+}
+
+// applyOverrides sets the overrides on a resource template if it is a PipelineRun
+func applyOverrides(raw []byte, overrides *pipelineRunOverrides) ([]byte, error) {
+	resource := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &resource); err != nil {
+		return nil, err
+	}
+	if resource["kind"] != "PipelineRun" {
+		return raw, nil
+	}
+	spec, _ := resource["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = make(map[string]interface{})
+		resource["spec"] = spec
+	}
+
+	if overrides.Timeout != "" {
+		spec["timeout"] = overrides.Timeout
+	}
+
+	if len(overrides.NodeSelector) > 0 || len(overrides.Tolerations) > 0 {
+		podTemplate, _ := spec["podTemplate"].(map[string]interface{})
+		if podTemplate == nil {
+			podTemplate = make(map[string]interface{})
+			spec["podTemplate"] = podTemplate
+		}
+		if len(overrides.NodeSelector) > 0 {
+			nodeSelector, _ := podTemplate["nodeSelector"].(map[string]interface{})
+			if nodeSelector == nil {
+				nodeSelector = make(map[string]interface{})
+				podTemplate["nodeSelector"] = nodeSelector
+			}
+			for key, value := range overrides.NodeSelector {
+				nodeSelector[key] = value
+			}
+		}
+		if len(overrides.Tolerations) > 0 {
+			tolerations, _ := podTemplate["tolerations"].([]interface{})
+			for _, toleration := range overrides.Tolerations {
+				tolerations = append(tolerations, toleration)
+			}
+			podTemplate["tolerations"] = tolerations
+		}
+	}
+
+	if len(overrides.TaskServiceAccounts) > 0 {
+		serviceAccountNames := []interface{}{}
+		existing, _ := spec["serviceAccountNames"].([]interface{})
+		for _, entry := range existing {
+			if named, ok := entry.(map[string]interface{}); ok {
+				if _, overridden := overrides.TaskServiceAccounts[fmt.Sprint(named["taskName"])]; overridden {
+					continue
+				}
+			}
+			serviceAccountNames = append(serviceAccountNames, entry)
+		}
+		for task, serviceAccount := range overrides.TaskServiceAccounts {
+			serviceAccountNames = append(serviceAccountNames, map[string]interface{}{
+				"taskName":           task,
+				"serviceAccountName": serviceAccount,
+			})
+		}
+		spec["serviceAccountNames"] = serviceAccountNames
+	}
+
+	return json.Marshal(resource)
+}
+
+// isOverridesTemplate reports whether a trigger's template was generated for a webhook's overrides, by its labels
+func (r Resource) isOverridesTemplate(templateName string) bool {
+	template, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).Get(templateName, metav1.GetOptions{})
+	return err == nil && isWebhookResource(template.ObjectMeta)
+}
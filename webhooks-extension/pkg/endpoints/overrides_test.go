@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const overridesPipelineRun = `{
+  "apiVersion": "tekton.dev/v1beta1",
+  "kind": "PipelineRun",
+  "metadata": {"generateName": "simple-pipeline-run-"},
+  "spec": {
+    "pipelineRef": {"name": "simple-pipeline"},
+    "serviceAccountNames": [
+      {"taskName": "build", "serviceAccountName": "builder"},
+      {"taskName": "deploy", "serviceAccountName": "deployer"}
+    ],
+    "podTemplate": {"nodeSelector": {"disktype": "ssd"}}
+  }
+}`
+
+func TestApplyOverrides(t *testing.T) {
+	overrides := &pipelineRunOverrides{
+		Timeout:             "2h",
+		NodeSelector:        map[string]string{"pool": "ci"},
+		Tolerations:         []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "ci", Effect: corev1.TaintEffectNoSchedule}},
+		TaskServiceAccounts: map[string]string{"deploy": "prod-deployer"},
+	}
+	raw, err := applyOverrides([]byte(overridesPipelineRun), overrides)
+	if err != nil {
+		t.Fatalf("error applying overrides: %s", err.Error())
+	}
+
+	result := struct {
+		Spec struct {
+			Timeout             string `json:"timeout"`
+			ServiceAccountNames []struct {
+				TaskName           string `json:"taskName"`
+				ServiceAccountName string `json:"serviceAccountName"`
+			} `json:"serviceAccountNames"`
+			PodTemplate struct {
+				NodeSelector map[string]string   `json:"nodeSelector"`
+				Tolerations  []corev1.Toleration `json:"tolerations"`
+			} `json:"podTemplate"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("error reading overridden pipelinerun: %s", err.Error())
+	}
+	if result.Spec.Timeout != "2h" {
+		t.Errorf("timeout was %s, expected 2h", result.Spec.Timeout)
+	}
+	if !reflect.DeepEqual(result.Spec.PodTemplate.NodeSelector, map[string]string{"disktype": "ssd", "pool": "ci"}) {
+		t.Errorf("node selector was %v", result.Spec.PodTemplate.NodeSelector)
+	}
+	if !reflect.DeepEqual(result.Spec.PodTemplate.Tolerations, overrides.Tolerations) {
+		t.Errorf("tolerations were %v, expected %v", result.Spec.PodTemplate.Tolerations, overrides.Tolerations)
+	}
+	serviceAccounts := make(map[string]string)
+	for _, named := range result.Spec.ServiceAccountNames {
+		serviceAccounts[named.TaskName] = named.ServiceAccountName
+	}
+	if !reflect.DeepEqual(serviceAccounts, map[string]string{"build": "builder", "deploy": "prod-deployer"}) {
+		t.Errorf("task service accounts were %v", serviceAccounts)
+	}
+}
+
+func TestApplyOverridesIgnoresOtherKinds(t *testing.T) {
+	resource := `{"apiVersion":"tekton.dev/v1alpha1","kind":"PipelineResource","spec":{"type":"git"}}`
+	raw, err := applyOverrides([]byte(resource), &pipelineRunOverrides{Timeout: "2h"})
+	if err != nil {
+		t.Fatalf("error applying overrides: %s", err.Error())
+	}
+	if string(raw) != resource {
+		t.Errorf("resource was changed to %s", string(raw))
+	}
+}
+
+func TestGetTemplateNameWithOverrides(t *testing.T) {
+	r := dummyResource()
+	template := v1alpha1.TriggerTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple-pipeline-template", Namespace: r.Defaults.Namespace},
+		Spec: v1alpha1.TriggerTemplateSpec{
+			ResourceTemplates: []v1alpha1.TriggerResourceTemplate{
+				{RawExtension: runtime.RawExtension{Raw: []byte(overridesPipelineRun)}},
+			},
+		},
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).Create(&template); err != nil {
+		t.Fatalf("error creating triggertemplate: %s", err.Error())
+	}
+
+	hook := webhook{Name: "hook", Namespace: "foo", Pipeline: "simple-pipeline"}
+	name, err := r.getTemplateName(hook)
+	if err != nil || name != "simple-pipeline-template" {
+		t.Errorf("template without overrides was %s (error %v), expected simple-pipeline-template", name, err)
+	}
+	// The pipeline's own template is annotated with provenance too
+	annotated, _ := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).Get(name, metav1.GetOptions{})
+	annotatedRun := struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}{}
+	json.Unmarshal(annotated.Spec.ResourceTemplates[0].Raw, &annotatedRun)
+	if value := annotatedRun.Metadata.Annotations["webhooks.tekton.dev/sender"]; value != "$(params.webhooks-tekton-sender)" {
+		t.Errorf("pipeline's template sender annotation was %q, expected the provenance param", value)
+	}
+
+	hook.Overrides = &pipelineRunOverrides{Timeout: "10m"}
+	name, err = r.getTemplateName(hook)
+	if err != nil {
+		t.Fatalf("error getting template name: %s", err.Error())
+	}
+	if name != "wext-hook-foo-template" {
+		t.Errorf("template with overrides was %s, expected wext-hook-foo-template", name)
+	}
+	created, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting generated template: %s", err.Error())
+	}
+	pipelineRun := make(map[string]interface{})
+	json.Unmarshal(created.Spec.ResourceTemplates[0].Raw, &pipelineRun)
+	if timeout := pipelineRun["spec"].(map[string]interface{})["timeout"]; timeout != "10m" {
+		t.Errorf("generated template timeout was %v, expected 10m", timeout)
+	}
+	if !r.isOverridesTemplate(name) || r.isOverridesTemplate("simple-pipeline-template") {
+		t.Error("overrides template not told apart from the pipeline's by its labels")
+	}
+
+	// A user's template named like a generated one isn't taken for one
+	template.Name = "wext-users-template"
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).Create(&template); err != nil {
+		t.Fatalf("error creating triggertemplate: %s", err.Error())
+	}
+	if r.isOverridesTemplate("wext-users-template") {
+		t.Error("user's template taken for an overrides template")
+	}
+}
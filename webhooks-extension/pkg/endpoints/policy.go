@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+If WEBHOOK_POLICY_URL is set, a webhook is only created if the policy at
+that URL allows it. The URL is an OPA data API document, e.g.
+http://opa.opa:8181/v1/data/webhooks/create, which is sent the proposed
+webhook as its input. The document may be a boolean, or an object with
+allow and a deny message or list of messages, which are returned to the
+caller. Creation fails closed if the policy can't be evaluated.
+---------------------------------------*/
+
+const policyTimeout = 10 * time.Second
+
+type policyInput struct {
+	Input webhook `json:"input"`
+}
+
+type policyDecision struct {
+	Allow   bool        `json:"allow"`
+	Deny    interface{} `json:"deny,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// policyError is returned when a policy denies a webhook, as opposed to failing to be evaluated
+type policyError struct {
+	message string
+}
+
+func (e policyError) Error() string {
+	return e.message
+}
+
+// evaluatePolicy returns a policyError if the configured policy denies creating the webhook
+func evaluatePolicy(hook webhook) error {
+	policyURL := os.Getenv("WEBHOOK_POLICY_URL")
+	if policyURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(policyInput{Input: hook})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: policyTimeout}
+	resp, err := client.Post(policyURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error evaluating policy at %s: %s", policyURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error evaluating policy at %s: status %d", policyURL, resp.StatusCode)
+	}
+	result := struct {
+		Result json.RawMessage `json:"result"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error reading policy decision from %s: %s", policyURL, err)
+	}
+	if len(result.Result) == 0 {
+		// OPA omits the result of an undefined document, a policy that doesn't allow denies
+		return policyError{"webhook denied by policy: no decision"}
+	}
+
+	decision := policyDecision{}
+	if err := json.Unmarshal(result.Result, &decision.Allow); err != nil {
+		if err := json.Unmarshal(result.Result, &decision); err != nil {
+			return fmt.Errorf("error reading policy decision from %s: %s", policyURL, err)
+		}
+	}
+	messages := decision.messages()
+	if decision.Allow && len(messages) == 0 {
+		logging.Log.Debugf("webhook %s allowed by policy", hook.Name)
+		return nil
+	}
+	if len(messages) == 0 {
+		return policyError{"webhook denied by policy"}
+	}
+	return policyError{"webhook denied by policy: " + strings.Join(messages, ", ")}
+}
+
+// messages are the deny messages of a decision, deny being a string or a list of strings as Rego rules often produce
+func (d policyDecision) messages() []string {
+	messages := []string{}
+	switch deny := d.Deny.(type) {
+	case string:
+		messages = append(messages, deny)
+	case []interface{}:
+		for _, message := range deny {
+			messages = append(messages, fmt.Sprint(message))
+		}
+	}
+	if d.Message != "" && !d.Allow {
+		messages = append(messages, d.Message)
+	}
+	return messages
+}
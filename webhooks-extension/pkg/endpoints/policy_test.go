@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvaluatePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision string
+		status   int
+		expected string
+		denied   bool
+	}{
+		{name: "allowed", decision: `{"result": true}`, status: http.StatusOK},
+		{name: "allowed object", decision: `{"result": {"allow": true}}`, status: http.StatusOK},
+		{name: "denied", decision: `{"result": false}`, status: http.StatusOK, expected: "webhook denied by policy", denied: true},
+		{name: "undefined", decision: `{}`, status: http.StatusOK, expected: "webhook denied by policy: no decision", denied: true},
+		{name: "deny messages", decision: `{"result": {"allow": false, "deny": ["namespace prod requires an approved pipeline"]}}`,
+			status: http.StatusOK, expected: "webhook denied by policy: namespace prod requires an approved pipeline", denied: true},
+		{name: "deny message", decision: `{"result": {"allow": false, "message": "no"}}`, status: http.StatusOK,
+			expected: "webhook denied by policy: no", denied: true},
+		{name: "unavailable", decision: ``, status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		var input policyInput
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			json.NewDecoder(req.Body).Decode(&input)
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, tt.decision)
+		}))
+		os.Setenv("WEBHOOK_POLICY_URL", server.URL)
+
+		err := evaluatePolicy(webhook{Name: "hook", Namespace: "prod", Pipeline: "deploy"})
+		server.Close()
+
+		if input.Input.Namespace != "prod" || input.Input.Pipeline != "deploy" {
+			t.Errorf("%s: the policy wasn't sent the webhook, got %+v", tt.name, input)
+		}
+		if tt.status != http.StatusOK {
+			if err == nil {
+				t.Errorf("%s: expected an error when the policy can't be evaluated", tt.name)
+			} else if _, denied := err.(policyError); denied {
+				t.Errorf("%s: expected an evaluation error, not a denial", tt.name)
+			}
+			continue
+		}
+		if tt.expected == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", tt.name, err)
+		}
+		if tt.expected != "" {
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("%s: expected error %q, got %v", tt.name, tt.expected, err)
+			}
+			if _, denied := err.(policyError); denied != tt.denied {
+				t.Errorf("%s: expected denied %t", tt.name, tt.denied)
+			}
+		}
+	}
+	os.Unsetenv("WEBHOOK_POLICY_URL")
+
+	if err := evaluatePolicy(webhook{Name: "hook"}); err != nil {
+		t.Errorf("expected no policy to allow the webhook, got %s", err)
+	}
+}
+
+func TestDeniedWebhookChangesNothing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"result": false}`)
+	}))
+	defer server.Close()
+	os.Setenv("WEBHOOK_POLICY_URL", server.URL)
+	defer os.Unsetenv("WEBHOOK_POLICY_URL")
+
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: "team-a", GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1",
+		Pipeline: "pipeline1", CreateNamespaceIfMissing: true}
+	createTriggerResources(hook, r)
+	b, _ := json.Marshal(hook)
+	request := dummyRestfulRequest(dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks", bytes.NewBuffer(b)), "")
+	request.SetAttribute(signedKeyAttribute, "ci")
+	request.SetAttribute(signedScopesAttribute, apiKeyScopes{Admin: true, Namespaces: []string{"*"}})
+	httpWriter := httptest.NewRecorder()
+	r.createWebhook(request, dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusForbidden {
+		t.Fatalf("creating a webhook the policy denies returned %d, expected 403", httpWriter.Code)
+	}
+	if _, err := r.K8sClient.CoreV1().Namespaces().Get("team-a", metav1.GetOptions{}); err == nil {
+		t.Error("the namespace of a denied webhook was created")
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/preflight").To(r.preflight))
+---------------------------------------*/
+
+type preflightCheck struct {
+	Name        string `json:"name"`
+	Passed      bool   `json:"passed"`
+	Message     string `json:"message,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+type preflightReport struct {
+	Namespace string           `json:"namespace"`
+	Passed    bool             `json:"passed"`
+	Checks    []preflightCheck `json:"checks"`
+}
+
+// A permission needed to create a webhook running PipelineRuns in a namespace
+type permission struct {
+	group, resource, verb, namespace string
+}
+
+func (p permission) String() string {
+	resource := p.resource
+	if p.group != "" {
+		resource = p.resource + "." + p.group
+	}
+	return fmt.Sprintf("%s %s in namespace %s", p.verb, resource, p.namespace)
+}
+
+// Checks, without changing anything, that the extension and the eventlistener
+// have the permissions and resources needed for a webhook running PipelineRuns
+// in the namespace, so that a broken install is found before a webhook half
+// creates or a delivery silently fails.
+func (r Resource) preflight(request *restful.Request, response *restful.Response) {
+	namespace := request.QueryParameter("namespace")
+	if namespace == "" {
+		RespondError(response, errors.New("namespace query parameter is required"), http.StatusBadRequest)
+		return
+	}
+	installNs := r.Defaults.Namespace
+	report := preflightReport{Namespace: namespace, Passed: true, Checks: []preflightCheck{}}
+	add := func(check preflightCheck) {
+		if !check.Passed {
+			report.Passed = false
+			logging.Log.Infof("preflight check failed for namespace %s: %s %s", namespace, check.Name, check.Message)
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	// Resources
+	if _, err := r.K8sClient.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{}); err != nil {
+		add(preflightCheck{Name: "namespace " + namespace + " exists", Message: err.Error(),
+			Remediation: fmt.Sprintf("create the namespace, e.g. kubectl create namespace %s", namespace)})
+	} else {
+		add(preflightCheck{Name: "namespace " + namespace + " exists", Passed: true})
+	}
+	name := fmt.Sprintf("service account %s exists in namespace %s", eventListenerServiceAccount, installNs)
+	if _, err := r.K8sClient.CoreV1().ServiceAccounts(installNs).Get(eventListenerServiceAccount, metav1.GetOptions{}); err != nil {
+		add(preflightCheck{Name: name, Message: err.Error(),
+			Remediation: "reinstall the webhooks extension, the service account is in base/200-serviceaccount-eventListener.yaml"})
+	} else {
+		add(preflightCheck{Name: name, Passed: true})
+	}
+
+	// Permissions of the extension
+	extension := os.Getenv("SERVICE_ACCOUNT")
+	if extension == "" {
+		extension = "tekton-webhooks-extension"
+	}
+	for _, p := range []permission{
+		{"triggers.tekton.dev", "triggerbindings", "create", installNs},
+		{"triggers.tekton.dev", "triggertemplates", "create", installNs},
+		{"triggers.tekton.dev", "eventlisteners", "create", installNs},
+		{"triggers.tekton.dev", "eventlisteners", "update", installNs},
+		r.listenerExposurePermission(),
+		{"", "secrets", "get", installNs},
+		{"", "configmaps", "create", installNs},
+		{"tekton.dev", "pipelines", "get", namespace},
+	} {
+		add(checkPermission("webhooks extension", p, func(attributes authorizationv1.ResourceAttributes) (bool, string, error) {
+			result, err := r.K8sClient.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+			})
+			if err != nil {
+				return false, "", err
+			}
+			return result.Status.Allowed, result.Status.Reason, nil
+		}, fmt.Sprintf("grant service account %s/%s permission to %s, see base/200-role.yaml and base/200-clusterrole.yaml", installNs, extension, p)))
+	}
+
+	// Permissions of the eventlistener, which creates the PipelineRuns
+	user := fmt.Sprintf("system:serviceaccount:%s:%s", installNs, eventListenerServiceAccount)
+	for _, p := range []permission{
+		{"tekton.dev", "pipelineruns", "create", namespace},
+		{"tekton.dev", "pipelineresources", "create", namespace},
+	} {
+		add(checkPermission("eventlistener", p, func(attributes authorizationv1.ResourceAttributes) (bool, string, error) {
+			result, err := r.K8sClient.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+				Spec: authorizationv1.SubjectAccessReviewSpec{ResourceAttributes: &attributes, User: user},
+			})
+			if err != nil {
+				return false, "", err
+			}
+			return result.Status.Allowed, result.Status.Reason, nil
+		}, fmt.Sprintf("bind service account %s in namespace %s to the %s clusterrole in namespace %s, e.g. with POST /webhooks/onboard",
+			eventListenerServiceAccount, installNs, eventListenerClusterRole, namespace)))
+	}
+
+	response.WriteEntity(report)
+}
+
+// listenerExposurePermission is the permission needed to expose the eventlistener, a route on OpenShift or an ingress
+func (r Resource) listenerExposurePermission() permission {
+	if r.Install.openShift() {
+		return permission{"route.openshift.io", "routes", "create", r.Defaults.Namespace}
+	}
+	return permission{"extensions", "ingresses", "create", r.Defaults.Namespace}
+}
+
+// checkPermission reviews a permission of who, hint being the remediation if it is missing
+func checkPermission(who string, p permission, review func(authorizationv1.ResourceAttributes) (bool, string, error), hint string) preflightCheck {
+	check := preflightCheck{Name: fmt.Sprintf("%s can %s", who, p)}
+	allowed, reason, err := review(authorizationv1.ResourceAttributes{
+		Namespace: p.namespace,
+		Verb:      p.verb,
+		Group:     p.group,
+		Resource:  p.resource,
+	})
+	if err != nil {
+		check.Message = fmt.Sprintf("error reviewing access: %s", err)
+		check.Remediation = "grant the webhooks extension create on selfsubjectaccessreviews and subjectaccessreviews, see base/200-clusterrole.yaml"
+		return check
+	}
+	if !allowed {
+		check.Message = reason
+		check.Remediation = hint
+		return check
+	}
+	check.Passed = true
+	return check
+}
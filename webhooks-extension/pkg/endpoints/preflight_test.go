@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPreflight(t *testing.T) {
+	r := dummyResource()
+	r.K8sClient.CoreV1().Namespaces().Create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "green"}})
+	r.K8sClient.CoreV1().ServiceAccounts(r.Defaults.Namespace).Create(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: eventListenerServiceAccount}})
+
+	// Everything is allowed except the eventlistener creating PipelineResources
+	fake := r.K8sClient.(*fakek8sclientset.Clientset)
+	fake.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		review.Status.Allowed = true
+		return true, review, nil
+	})
+	fake.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.ResourceAttributes.Resource != "pipelineresources"
+		return true, review, nil
+	})
+
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/preflight?namespace=green", nil)
+	httpWriter := httptest.NewRecorder()
+	r.preflight(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusOK {
+		t.Fatalf("preflight returned %d, expected 200", httpWriter.Code)
+	}
+	report := preflightReport{}
+	if err := json.NewDecoder(httpWriter.Body).Decode(&report); err != nil {
+		t.Fatalf("error reading preflight report: %s", err.Error())
+	}
+	if report.Passed {
+		t.Error("preflight passed, expected the pipelineresources check to fail")
+	}
+	failed := []preflightCheck{}
+	for _, check := range report.Checks {
+		if !check.Passed {
+			failed = append(failed, check)
+		}
+	}
+	if len(failed) != 1 || !strings.Contains(failed[0].Name, "pipelineresources") || failed[0].Remediation == "" {
+		t.Errorf("expected only the pipelineresources check to fail with a remediation, got %+v", failed)
+	}
+}
+
+func TestPreflightRequiresNamespace(t *testing.T) {
+	r := dummyResource()
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/preflight", nil)
+	httpWriter := httptest.NewRecorder()
+	r.preflight(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusBadRequest {
+		t.Errorf("preflight without a namespace returned %d, expected 400", httpWriter.Code)
+	}
+}
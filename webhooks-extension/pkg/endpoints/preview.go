@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/{name}/preview").To(r.profiled(Resource.previewWebhook)))
+Renders the resources, the PipelineRun and its PipelineResources, a
+delivery would create, to debug a binding or template that doesn't fit
+before real events arrive. The sample delivery goes through the validator
+as for POST /webhooks/{name}/simulate, the params of the first trigger that
+fires are resolved from its triggerbindings and its triggertemplate is
+rendered with them, as Tekton Triggers would. Template params with no
+binding take their default and $(uid) is rendered as "preview". Nothing
+is created.
+---------------------------------------*/
+
+const previewUID = "preview"
+
+// $(params.name) in a triggertemplate's resource templates
+var templateParamExpression = regexp.MustCompile(`\$\(params\.([^)]*)\)`)
+
+type previewResponse struct {
+	Trigger  string `json:"trigger"`
+	Template string `json:"template"`
+	// The values of the template's params
+	Params map[string]string `json:"params"`
+	// The rendered resources as YAML documents
+	YAML     string   `json:"yaml"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// POST /webhooks/{name}/preview?namespace=<namespace>
+func (r Resource) previewWebhook(request *restful.Request, response *restful.Response) {
+	sample, ok := r.readSimulation(request, response)
+	if !ok {
+		return
+	}
+	var fired *simulatedTrigger
+	var firedTrigger v1alpha1.EventListenerTrigger
+	reasons := []string{}
+	for _, trigger := range sample.triggers {
+		simulated, err := r.simulateTrigger(trigger, sample.header, sample.payload)
+		if err != nil {
+			logging.Log.Errorf("error simulating trigger %s: %s", trigger.Name, err)
+			RespondError(response, err, http.StatusInternalServerError)
+			return
+		}
+		if simulated.Fires {
+			fired, firedTrigger = &simulated, trigger
+			break
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %s", trigger.Name, simulated.Reason))
+	}
+	if fired == nil {
+		err := fmt.Errorf("the delivery fires none of the triggers of webhook %s in namespace %s (%s)", sample.name, sample.namespace, strings.Join(reasons, "; "))
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	template, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).Get(firedTrigger.Template.Name, metav1.GetOptions{})
+	if err != nil {
+		logging.Log.Errorf("error getting triggertemplate %s: %s", firedTrigger.Template.Name, err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	preview, err := renderTemplate(template, fired.Params)
+	if err != nil {
+		logging.Log.Errorf("error rendering triggertemplate %s: %s", template.Name, err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	preview.Trigger = fired.Trigger
+	preview.Warnings = append(fired.Warnings, preview.Warnings...)
+	response.WriteEntity(preview)
+}
+
+// renderTemplate renders the template's resources with the bound params
+func renderTemplate(template *v1alpha1.TriggerTemplate, bound map[string]string) (previewResponse, error) {
+	preview := previewResponse{Template: template.Name, Params: map[string]string{}}
+	// Read through JSON so the default can be a string or, from a Tekton Pipelines ParamSpec, an array
+	specJSON, err := json.Marshal(template.Spec.Params)
+	if err != nil {
+		return preview, err
+	}
+	params := []struct {
+		Name    string      `json:"name"`
+		Default interface{} `json:"default"`
+	}{}
+	if err := json.Unmarshal(specJSON, &params); err != nil {
+		return preview, err
+	}
+	for _, param := range params {
+		value, found := bound[param.Name]
+		switch {
+		case found:
+		case param.Default == nil:
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("template param %s has no binding or default", param.Name))
+		default:
+			if s, ok := param.Default.(string); ok {
+				value = s
+			} else {
+				defaultJSON, _ := json.Marshal(param.Default)
+				value = string(defaultJSON)
+			}
+		}
+		preview.Params[param.Name] = value
+	}
+
+	documents := []string{}
+	for i, resourceTemplate := range template.Spec.ResourceTemplates {
+		rendered := templateParamExpression.ReplaceAllStringFunc(string(resourceTemplate.Raw), func(expression string) string {
+			name := templateParamExpression.FindStringSubmatch(expression)[1]
+			value, found := preview.Params[name]
+			if !found {
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf("resource %d uses %s, which the template doesn't declare", i, expression))
+				return expression
+			}
+			// Escaped as the value goes in a JSON string
+			valueJSON, _ := json.Marshal(value)
+			return string(valueJSON[1 : len(valueJSON)-1])
+		})
+		rendered = strings.Replace(rendered, "$(uid)", previewUID, -1)
+		document, err := yaml.JSONToYAML([]byte(rendered))
+		if err != nil {
+			return preview, fmt.Errorf("resource %d isn't valid once rendered: %s", i, err)
+		}
+		documents = append(documents, string(document))
+	}
+	preview.YAML = strings.Join(documents, "---\n")
+	return preview, nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	restful "github.com/emicklei/go-restful"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const previewPipelineRun = `{
+  "apiVersion": "tekton.dev/v1alpha1",
+  "kind": "PipelineRun",
+  "metadata": {"name": "pipeline1-run-$(uid)", "namespace": "$(params.namespace)"},
+  "spec": {
+    "pipelineRef": {"name": "pipeline1"},
+    "params": [
+      {"name": "commit", "value": "$(params.commit)"},
+      {"name": "image", "value": "$(params.image)"},
+      {"name": "message", "value": "$(params.message)"}
+    ]
+  }
+}`
+
+func TestPreviewWebhook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("GIT_PROVIDER_MODE", "replay")
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", dir)
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+
+	r := dummyResource()
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	createTriggerResources(hook, r)
+	binding, _ := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("pipeline1-push-binding", metav1.GetOptions{})
+	binding.Spec.Params = []v1alpha1.Param{
+		{Name: "commit", Value: "$(body.head_commit.id)"},
+		{Name: "image", Value: "registry/$(body.repository.name):$(body.webhooks-tekton-image-tag)"},
+		{Name: "message", Value: "$(body.head_commit.message)"},
+	}
+	r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Update(binding)
+	template, _ := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get("pipeline1-template", metav1.GetOptions{})
+	json.Unmarshal([]byte(`[{"name":"commit"},{"name":"image"},{"name":"message"},{"name":"namespace","default":"builds"}]`), &template.Spec.Params)
+	template.Spec.ResourceTemplates = []v1alpha1.TriggerResourceTemplate{{RawExtension: runtime.RawExtension{Raw: []byte(previewPipelineRun)}}}
+	r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Update(template)
+	if response := createWebhook(hook, r); response.StatusCode() != http.StatusCreated {
+		t.Fatalf("creating the webhook returned %d", response.StatusCode())
+	}
+
+	server := fakeSimulationServices(r, make(chan http.Header, 1))
+	defer server.Close()
+	defer func(original func(string, string) string) { simulationServiceURL = original }(simulationServiceURL)
+	simulationServiceURL = func(service, namespace string) string {
+		return server.URL + "/" + service
+	}
+
+	ws := new(restful.WebService)
+	ws.Path("/webhooks").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	ws.Route(ws.POST("/{name}/preview").To(r.previewWebhook))
+	container := restful.NewContainer()
+	container.Add(ws)
+	serve := func(event string) (int, previewResponse) {
+		b, _ := json.Marshal(simulateRequest{
+			Headers: map[string]string{"X-GitHub-Event": event},
+			Payload: json.RawMessage(`{"head_commit":{"id":"abc123def","message":"Fix \"quoted\" bug"},"repository":{"name":"repo"}}`),
+		})
+		httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/hook/preview?namespace="+installNs, bytes.NewBuffer(b))
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		result := previewResponse{}
+		json.NewDecoder(httpWriter.Body).Decode(&result)
+		return httpWriter.Code, result
+	}
+
+	status, result := serve("push")
+	if status != http.StatusOK || result.Trigger != "hook-"+installNs+"-push-event" || result.Template != "pipeline1-template" {
+		t.Fatalf("expected the push trigger's template to be rendered, got %d, %+v", status, result)
+	}
+	if result.Params["namespace"] != "builds" || len(result.Warnings) != 0 {
+		t.Errorf("expected the namespace param to default without warnings, got %+v", result)
+	}
+	pipelineRun := struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+		Spec     struct {
+			Params []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"params"`
+		} `json:"spec"`
+	}{}
+	if err := yaml.Unmarshal([]byte(result.YAML), &pipelineRun); err != nil {
+		t.Fatalf("the preview wasn't YAML: %s\n%s", err, result.YAML)
+	}
+	if pipelineRun.Metadata.Name != "pipeline1-run-preview" || pipelineRun.Metadata.Namespace != "builds" {
+		t.Errorf("unexpected pipelinerun metadata %+v", pipelineRun.Metadata)
+	}
+	expected := map[string]string{"commit": "abc123def", "image": "registry/repo:abc123", "message": `Fix "quoted" bug`}
+	for _, param := range pipelineRun.Spec.Params {
+		if expected[param.Name] != param.Value {
+			t.Errorf("expected param %s to be %s, got %s", param.Name, expected[param.Name], param.Value)
+		}
+	}
+
+	if status, _ := serve("issues"); status != http.StatusBadRequest {
+		t.Errorf("expected a delivery firing no trigger to be refused, got %d", status)
+	}
+}
+
+func TestRenderTemplateWarnings(t *testing.T) {
+	template := &v1alpha1.TriggerTemplate{ObjectMeta: metav1.ObjectMeta{Name: "template"}}
+	json.Unmarshal([]byte(`[{"name":"commit"}]`), &template.Spec.Params)
+	template.Spec.ResourceTemplates = []v1alpha1.TriggerResourceTemplate{
+		{RawExtension: runtime.RawExtension{Raw: []byte(`{"kind":"PipelineRun","metadata":{"name":"$(params.commit)-$(params.branch)"}}`)}},
+	}
+	preview, err := renderTemplate(template, map[string]string{})
+	if err != nil {
+		t.Fatalf("error rendering the template: %s", err)
+	}
+	if len(preview.Warnings) != 2 || !strings.Contains(preview.Warnings[0], "commit") || !strings.Contains(preview.Warnings[1], "$(params.branch)") {
+		t.Errorf("expected warnings for the unbound and undeclared params, got %v", preview.Warnings)
+	}
+	if !strings.Contains(preview.YAML, "-$(params.branch)") {
+		t.Errorf("expected the undeclared param to be left, got %s", preview.YAML)
+	}
+}
@@ -0,0 +1,350 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+A webhook with preview environments deploys each pull request on its own,
+named <prefix>-<number>, e.g. pr-123. The interceptor adds the name and
+the preview's URL to pull request events' payloads, which the webhook's
+binding passes to the template as the webhooks-tekton-preview-name and
+webhooks-tekton-preview-url params, both empty for pushes, and creates a
+namespace of that name labelled webhooks.tekton.dev/preview with the
+webhook for the pipeline to deploy into. The monitor adds the URL to its
+comment when the run succeeds. When the pull request is closed or merged
+the webhook's <webhook>-<namespace>-preview-teardown trigger runs the
+teardown pipeline, if there is one, with the same params, the interceptor
+listing the preview in the webhooks-extension-closed-previews configmap.
+Every previewCleanupInterval the extension lists closed previews whose
+webhook has no teardown PipelineRun running, checking first that each is
+a preview namespace it created, labelled as managed by it, in the
+webhooks-extension-deletable-previews configmap. The extension may not
+delete namespaces, an operator deletes the namespaces listed there. The
+settings are kept as a binding param.
+---------------------------------------*/
+
+const (
+	// Set on all of the triggers of a webhook with preview environments
+	previewPrefixHeader  = "Wext-Preview-Prefix"
+	previewURLHeader     = "Wext-Preview-Url"
+	previewWebhookHeader = "Wext-Preview-Webhook"
+	// Set on the trigger closing previews, teardown when it runs the teardown pipeline, else close
+	previewTeardownHeader = "Wext-Preview-Teardown"
+	previewTeardownSuffix = "-preview-teardown"
+	defaultPreviewPrefix  = "pr"
+	// Set by the interceptor on preview namespaces, see cmd/interceptor/previews.go
+	previewLabel = "webhooks.tekton.dev/preview"
+	// Configmap in the install namespace the interceptor lists closed previews in, with when they were closed
+	closedPreviewsConfigMap = "webhooks-extension-closed-previews"
+	// Configmap in the install namespace the extension lists the closed previews whose teardown is done in, for an
+	// operator to delete their namespaces
+	deletablePreviewsConfigMap = "webhooks-extension-deletable-previews"
+
+	previewCleanupInterval = time.Minute
+	// How long a closed preview is kept for a teardown PipelineRun still running
+	previewTeardownTimeout = time.Hour
+)
+
+// Preview names are namespace names, <prefix>-<number>
+var previewPrefixPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// previewEnvironment deploys each pull request on its own
+type previewEnvironment struct {
+	// Previews are named <prefix>-<number>, pr by default
+	Prefix string `json:"prefix,omitempty"`
+	// URL of a preview, {name} being replaced by its name, e.g. https://{name}.preview.example.com
+	URL string `json:"url,omitempty"`
+	// Pipeline run when a pull request is closed or merged, with its own template and pull request binding
+	TeardownPipeline string `json:"teardownpipeline,omitempty"`
+}
+
+// previewPrefix returns the prefix of the names of the webhook's previews
+func previewPrefix(webhook webhook) string {
+	if webhook.Preview.Prefix == "" {
+		return defaultPreviewPrefix
+	}
+	return webhook.Preview.Prefix
+}
+
+// previewWebhook is the value of the preview label of the namespaces of the webhook's previews
+func previewWebhook(webhook webhook) string {
+	return labelValue(webhook.Name + "-" + webhook.Namespace)
+}
+
+// previewURL returns the URL of the preview of a pull request, empty if the webhook has no preview URL
+func previewURL(webhook webhook, number int) string {
+	if webhook.Preview == nil || webhook.Preview.URL == "" {
+		return ""
+	}
+	return strings.Replace(webhook.Preview.URL, "{name}", fmt.Sprintf("%s-%d", previewPrefix(webhook), number), -1)
+}
+
+// validatePreview checks the settings and that the teardown pipeline has a template and pull request binding
+func (r Resource) validatePreview(webhook webhook) error {
+	preview := webhook.Preview
+	if preview == nil {
+		return nil
+	}
+	// Leaving room for the pull request number in the 63 characters of a namespace name
+	if preview.Prefix != "" && (len(preview.Prefix) > 50 || !previewPrefixPattern.MatchString(preview.Prefix)) {
+		return fmt.Errorf("preview prefix %s is not a lower case name of up to 50 characters", preview.Prefix)
+	}
+	if preview.URL != "" {
+		if parsed, err := url.Parse(preview.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("preview url %s is not an http or https URL", preview.URL)
+		}
+	}
+	if preview.TeardownPipeline == "" {
+		return nil
+	}
+	installNs := r.Defaults.Namespace
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(preview.TeardownPipeline+"-pullrequest-binding", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("preview triggerbinding %s could not be found: %s", preview.TeardownPipeline+"-pullrequest-binding", err)
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(preview.TeardownPipeline+"-template", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("preview triggertemplate %s could not be found: %s", preview.TeardownPipeline+"-template", err)
+	}
+	return nil
+}
+
+// previewParams are the binding params reading the preview's name and URL from the payload, and recording the
+// webhook's preview settings
+func previewParams(webhook webhook) []v1alpha1.Param {
+	if webhook.Preview == nil {
+		return []v1alpha1.Param{}
+	}
+	previewJSON, err := json.Marshal(webhook.Preview)
+	if err != nil {
+		logging.Log.Errorf("error marshalling preview: %s", err)
+	}
+	return []v1alpha1.Param{
+		{Name: "webhooks-tekton-preview-name", Value: "$(body.webhooks-tekton-preview-name)"},
+		{Name: "webhooks-tekton-preview-url", Value: "$(body.webhooks-tekton-preview-url)"},
+		{Name: "webhooks-tekton-preview", Value: string(previewJSON)},
+	}
+}
+
+// withPreview adds the headers the interceptor names a webhook's previews by to one of its triggers
+func withPreview(trigger v1alpha1.EventListenerTrigger, webhook webhook) v1alpha1.EventListenerTrigger {
+	if webhook.Preview == nil {
+		return trigger
+	}
+	trigger.Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header,
+		pipelinesv1alpha1.Param{Name: previewPrefixHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: previewPrefix(webhook)}},
+		pipelinesv1alpha1.Param{Name: previewURLHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.Preview.URL}},
+		pipelinesv1alpha1.Param{Name: previewWebhookHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: previewWebhook(webhook)}})
+	return trigger
+}
+
+// withPreviewTeardown returns the webhook's triggers followed, if it has preview environments, by the trigger
+// closing a pull request's preview. It runs the teardown pipeline, and without one the interceptor only marks the
+// namespace closed and turns the event away.
+func withPreviewTeardown(webhook webhook, triggers []v1alpha1.EventListenerTrigger) []v1alpha1.EventListenerTrigger {
+	if webhook.Preview == nil {
+		return triggers
+	}
+	prefix := triggerPrefix(webhook)
+	for _, trigger := range triggers {
+		if trigger.Name != prefix+"-pullrequest-event" {
+			continue
+		}
+		pipeline, mode := webhook.Preview.TeardownPipeline, "teardown"
+		if pipeline == "" {
+			pipeline, mode = webhook.Pipeline, "close"
+		}
+		teardown := withoutHeaders(canaryTrigger(trigger, prefix+previewTeardownSuffix, pipeline+"-pullrequest-binding", pipeline+"-template"),
+			canaryRouteHeader, canaryPercentageHeader, canaryLabelHeader, dependencyRouteHeader, dependencySendersHeader,
+			fileRulesHeader, routeLabelHeader, "Wext-Incoming-Actions")
+		teardown.Interceptors[0].Webhook.Header = append(teardown.Interceptors[0].Webhook.Header,
+			pipelinesv1alpha1.Param{Name: "Wext-Incoming-Actions", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: closedActions}},
+			pipelinesv1alpha1.Param{Name: closeEventHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "true"}},
+			pipelinesv1alpha1.Param{Name: previewTeardownHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: mode}})
+		return append(triggers, teardown)
+	}
+	return triggers
+}
+
+// previewURLs returns the monitor's previewurls param, a JSON map of trigger prefix to the preview prefix
+// and URL of each of the webhooks with a preview URL
+func previewURLs(hooks []webhook) string {
+	urls := map[string]previewEnvironment{}
+	for _, hook := range hooks {
+		if hook.Preview != nil && hook.Preview.URL != "" {
+			urls[triggerPrefix(hook)] = previewEnvironment{Prefix: previewPrefix(hook), URL: hook.Preview.URL}
+		}
+	}
+	urlsJSON, err := json.Marshal(urls)
+	if err != nil {
+		logging.Log.Errorf("error marshalling preview URLs: %s", err)
+		return "{}"
+	}
+	return string(urlsJSON)
+}
+
+// syncMonitorPreviews sets the previewurls param of the repository's monitor binding from the webhooks on the
+// repository with preview environments
+func (r Resource) syncMonitorPreviews(repoURL, monitorTriggerNamePrefix string) error {
+	hooks, err := r.getHooksForRepo(repoURL)
+	if err != nil {
+		return err
+	}
+	return r.setMonitorBindingParam(repoURL, monitorTriggerNamePrefix, "previewurls", previewURLs(hooks))
+}
+
+// CleanUpPreviews lists the closed previews whose namespaces may be deleted until stopCh is closed
+func (r Resource) CleanUpPreviews(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(previewCleanupInterval)
+	defer ticker.Stop()
+	for {
+		r.cleanUpPreviews()
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanUpPreviews lists the closed previews whose webhook has no teardown PipelineRun running, or that were closed
+// more than previewTeardownTimeout ago, in the deletable previews configmap, for an operator to delete their
+// namespaces. Previews whose namespace is gone, or that were opened again, are forgotten.
+func (r Resource) cleanUpPreviews() {
+	configMaps := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace)
+	closedPreviews, err := configMaps.Get(closedPreviewsConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		closedPreviews, err = &corev1.ConfigMap{}, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("error reading configmap %s: %s", closedPreviewsConfigMap, err)
+		return
+	}
+	deletablePreviews, err := configMaps.Get(deletablePreviewsConfigMap, metav1.GetOptions{})
+	deletableFound := err == nil
+	if k8serrors.IsNotFound(err) {
+		deletablePreviews, err = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: deletablePreviewsConfigMap, Namespace: r.Defaults.Namespace}}, nil
+	}
+	if err != nil {
+		logging.Log.Errorf("error reading configmap %s: %s", deletablePreviewsConfigMap, err)
+		return
+	}
+	if len(closedPreviews.Data) == 0 && len(deletablePreviews.Data) == 0 {
+		return
+	}
+	// Preview namespaces are cluster wide, so are looked up against the webhooks of every profile
+	hooks := []webhook{}
+	for _, profiled := range r.allProfiles() {
+		profileHooks, err := profiled.getWebhooksFromEventListener()
+		if err != nil {
+			logging.Log.Errorf("error getting webhooks to clean up previews: %s", err)
+			return
+		}
+		hooks = append(hooks, profileHooks...)
+	}
+	forgotten := []string{}
+	listed := false
+	for name, closedAt := range closedPreviews.Data {
+		namespace, err := r.K8sClient.CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			forgotten = append(forgotten, name)
+			continue
+		}
+		if err != nil {
+			logging.Log.Errorf("error getting preview namespace %s: %s", name, err)
+			continue
+		}
+		if namespace.Labels[managedByLabel] != extensionLabelValue || namespace.Labels[previewLabel] == "" {
+			logging.Log.Errorf("forgetting namespace %s listed in configmap %s, it is not a preview namespace created by the extension",
+				name, closedPreviewsConfigMap)
+			forgotten = append(forgotten, name)
+			continue
+		}
+		if _, deletable := deletablePreviews.Data[name]; deletable || namespace.DeletionTimestamp != nil {
+			continue
+		}
+		if r.previewTeardownRunning(hooks, namespace.Labels[previewLabel]) {
+			if closedTime, err := time.Parse(time.RFC3339, closedAt); err == nil && time.Since(closedTime) < previewTeardownTimeout {
+				continue
+			}
+		}
+		if deletablePreviews.Data == nil {
+			deletablePreviews.Data = map[string]string{}
+		}
+		deletablePreviews.Data[name] = closedAt
+		listed = true
+		logging.Log.Infof("preview %s is closed and its namespace may be deleted, see configmap %s", name, deletablePreviewsConfigMap)
+	}
+	for _, name := range forgotten {
+		delete(closedPreviews.Data, name)
+	}
+	for name := range deletablePreviews.Data {
+		if _, closed := closedPreviews.Data[name]; !closed {
+			delete(deletablePreviews.Data, name)
+			listed = true
+		}
+	}
+	// The interceptor updating the configmap first leaves these to be forgotten next time
+	if len(forgotten) != 0 {
+		if _, err := configMaps.Update(closedPreviews); err != nil {
+			logging.Log.Errorf("error updating configmap %s: %s", closedPreviewsConfigMap, err)
+		}
+	}
+	if !listed {
+		return
+	}
+	if deletableFound {
+		_, err = configMaps.Update(deletablePreviews)
+	} else {
+		_, err = configMaps.Create(deletablePreviews)
+	}
+	if err != nil {
+		logging.Log.Errorf("error updating configmap %s: %s", deletablePreviewsConfigMap, err)
+	}
+}
+
+// previewTeardownRunning returns whether a teardown PipelineRun of the webhook a preview belongs to is running
+func (r Resource) previewTeardownRunning(hooks []webhook, preview string) bool {
+	for _, hook := range hooks {
+		if hook.Preview == nil || previewWebhook(hook) != preview {
+			continue
+		}
+		pipelineRuns, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).List(metav1.ListOptions{
+			LabelSelector: triggerLabel + "=" + triggerPrefix(hook) + previewTeardownSuffix,
+		})
+		if err != nil {
+			logging.Log.Errorf("error listing teardown PipelineRuns in namespace %s: %s", hook.Namespace, err)
+			return true
+		}
+		for _, pipelineRun := range pipelineRuns.Items {
+			if pipelineRunState(pipelineRun) == "pending" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidatePreview(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, Pipeline: "pipeline1"}
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+
+	valid := []*previewEnvironment{
+		nil,
+		{},
+		{Prefix: "preview", URL: "https://{name}.preview.example.com"},
+		{TeardownPipeline: "pipeline2"},
+	}
+	for _, preview := range valid {
+		hook.Preview = preview
+		if err := r.validatePreview(hook); err != nil {
+			t.Errorf("unexpected error for preview %+v: %s", preview, err)
+		}
+	}
+	invalid := []*previewEnvironment{
+		{Prefix: "Preview"},
+		{Prefix: "pr-"},
+		{URL: "ftp://{name}.example.com"},
+		{TeardownPipeline: "pipeline3"},
+	}
+	for _, preview := range invalid {
+		hook.Preview = preview
+		if err := r.validatePreview(hook); err == nil {
+			t.Errorf("expected an error for preview %+v", preview)
+		}
+	}
+}
+
+func TestCreateEventListenerWithPreview(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		Preview:          &previewEnvironment{URL: "https://{name}.preview.example.com", TeardownPipeline: "pipeline2"},
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	expected := map[string]bool{"hook-default-push-event": true, "hook-default-pullrequest-event": true, "hook-default-preview-teardown": true}
+	for _, trigger := range el.Spec.Triggers {
+		if !expected[trigger.Name] {
+			continue
+		}
+		delete(expected, trigger.Name)
+		if triggerHeader(trigger, previewPrefixHeader) != "pr" || triggerHeader(trigger, previewURLHeader) != hook.Preview.URL ||
+			triggerHeader(trigger, previewWebhookHeader) != "hook-default" {
+			t.Errorf("trigger %s is missing the preview headers", trigger.Name)
+		}
+		if trigger.Name != "hook-default-preview-teardown" {
+			if triggerHeader(trigger, previewTeardownHeader) != "" {
+				t.Errorf("trigger %s tears previews down", trigger.Name)
+			}
+			continue
+		}
+		if trigger.Template.Name != "pipeline2-template" || trigger.Bindings[0].Ref != "pipeline2-pullrequest-binding" {
+			t.Errorf("teardown trigger uses %s and %s", trigger.Template.Name, trigger.Bindings[0].Ref)
+		}
+		if triggerHeader(trigger, "Wext-Incoming-Actions") != closedActions || triggerHeader(trigger, previewTeardownHeader) != "teardown" {
+			t.Error("expected the teardown trigger to run the teardown pipeline for closed pull requests")
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("triggers %v were not created", expected)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	if !reflect.DeepEqual(hooks[0].Preview, hook.Preview) {
+		t.Errorf("preview was %+v, expected %+v", hooks[0].Preview, hook.Preview)
+	}
+	if url := previewURL(hooks[0], 123); url != "https://pr-123.preview.example.com" {
+		t.Errorf("preview url was %s", url)
+	}
+}
+
+func TestCleanUpPreviews(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		Preview:          &previewEnvironment{TeardownPipeline: "pipeline2"},
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	closedAt := time.Now().UTC().Format(time.RFC3339)
+	previewLabels := func(webhook string) map[string]string {
+		return map[string]string{previewLabel: webhook, managedByLabel: extensionLabelValue}
+	}
+	namespaces := []corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "pr-1", Labels: previewLabels("hook-default")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pr-2", Labels: previewLabels("hook-default")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pr-3", Labels: previewLabels("deleted-default")}},
+		// Labelled a preview, but not by the extension
+		{ObjectMeta: metav1.ObjectMeta{Name: "pr-4", Labels: map[string]string{previewLabel: "deleted-default"}}},
+	}
+	for _, namespace := range namespaces {
+		if _, err := r.K8sClient.CoreV1().Namespaces().Create(&namespace); err != nil {
+			t.Fatalf("error creating namespace: %s", err)
+		}
+	}
+	_, err := r.K8sClient.CoreV1().ConfigMaps(installNs).Create(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: closedPreviewsConfigMap, Namespace: installNs},
+		Data:       map[string]string{"pr-2": closedAt, "pr-3": closedAt, "pr-4": closedAt, "pr-5": closedAt},
+	})
+	if err != nil {
+		t.Fatalf("error creating configmap %s: %s", closedPreviewsConfigMap, err)
+	}
+	teardown := pipelinesv1alpha1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "teardown", Namespace: installNs,
+		Labels: map[string]string{triggerLabel: "hook-default" + previewTeardownSuffix}}}
+	if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Create(&teardown); err != nil {
+		t.Fatalf("error creating pipelinerun: %s", err)
+	}
+
+	// The teardown is still running for pr-2, and pr-3's webhook is gone
+	r.cleanUpPreviews()
+	for _, name := range []string{"pr-1", "pr-2", "pr-3", "pr-4"} {
+		if _, err := r.K8sClient.CoreV1().Namespaces().Get(name, metav1.GetOptions{}); err != nil {
+			t.Errorf("expected namespace %s to be kept: %s", name, err)
+		}
+	}
+	deletable := func() map[string]string {
+		deletablePreviews, err := r.K8sClient.CoreV1().ConfigMaps(installNs).Get(deletablePreviewsConfigMap, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("error reading configmap %s: %s", deletablePreviewsConfigMap, err)
+		}
+		return deletablePreviews.Data
+	}
+	if !reflect.DeepEqual(deletable(), map[string]string{"pr-3": closedAt}) {
+		t.Errorf("expected only pr-3 to be deletable, got %v", deletable())
+	}
+	closedPreviews, _ := r.K8sClient.CoreV1().ConfigMaps(installNs).Get(closedPreviewsConfigMap, metav1.GetOptions{})
+	if !reflect.DeepEqual(closedPreviews.Data, map[string]string{"pr-2": closedAt, "pr-3": closedAt}) {
+		t.Errorf("expected pr-2 and pr-3 to be left closed, got %v", closedPreviews.Data)
+	}
+
+	if err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Delete("teardown", &metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting pipelinerun: %s", err)
+	}
+	r.cleanUpPreviews()
+	if !reflect.DeepEqual(deletable(), map[string]string{"pr-2": closedAt, "pr-3": closedAt}) {
+		t.Errorf("expected pr-2 to be deletable once its teardown was done, got %v", deletable())
+	}
+
+	// An operator deleted pr-3, and pr-2 was opened again
+	if err := r.K8sClient.CoreV1().Namespaces().Delete("pr-3", &metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting namespace: %s", err)
+	}
+	closedPreviews, _ = r.K8sClient.CoreV1().ConfigMaps(installNs).Get(closedPreviewsConfigMap, metav1.GetOptions{})
+	delete(closedPreviews.Data, "pr-2")
+	if _, err := r.K8sClient.CoreV1().ConfigMaps(installNs).Update(closedPreviews); err != nil {
+		t.Fatalf("error updating configmap %s: %s", closedPreviewsConfigMap, err)
+	}
+	r.cleanUpPreviews()
+	if len(deletable()) != 0 {
+		t.Errorf("expected no deletable previews, got %v", deletable())
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Profiles let one deployment serve several environments, e.g. dev, staging
+and prod, each with its own callback URL and eventlistener. They are kept
+in the webhooks-extension-profiles configmap in the install namespace, a
+key per profile whose value is its settings as JSON. The webhook endpoints
+take a profile query parameter and act on that profile's eventlistener,
+without one they act on the extension's own. Credentials and variable sets
+are shared by every profile. This file implements the following endpoint
+from webhook.go:
+	ws.Route(ws.GET("/profiles").To(r.getAllProfiles))
+---------------------------------------*/
+
+const (
+	// Configmap in the install namespace holding the profiles
+	profilesConfigMap = "webhooks-extension-profiles"
+)
+
+// profile is the settings a profile changes, those not set are as without a profile
+type profile struct {
+	Name        string `json:"name,omitempty"`
+	CallbackURL string `json:"callbackurl"`
+	// Comma separated, see multicallback.go
+	AdditionalCallbackURLs string `json:"additionalcallbackurls,omitempty"`
+	EventListenerName      string `json:"eventlistenername,omitempty"`
+	IngressPrefix          string `json:"ingressprefix,omitempty"`
+	CertPrefix             string `json:"certprefix,omitempty"`
+}
+
+// profileError is returned for a profile that does not exist or can't be used
+type profileError struct {
+	message string
+	status  int
+}
+
+func (e profileError) Error() string {
+	return e.message
+}
+
+// getProfilesConfigMap returns the profiles configmap, an empty one if it does not exist
+func (r Resource) getProfilesConfigMap() (*corev1.ConfigMap, error) {
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(profilesConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: profilesConfigMap, Namespace: r.Defaults.Namespace}}, nil
+	}
+	return cm, err
+}
+
+func (r Resource) getProfiles() ([]profile, error) {
+	cm, err := r.getProfilesConfigMap()
+	if err != nil {
+		return nil, err
+	}
+	profiles := []profile{}
+	for name, value := range cm.Data {
+		p := profile{}
+		if err := json.Unmarshal([]byte(value), &p); err != nil {
+			logging.Log.Errorf("ignoring profile %s, error reading it: %s", name, err)
+			continue
+		}
+		p.Name = name
+		if p.EventListenerName == "" {
+			p.EventListenerName = r.eventListenerName() + "-" + name
+		}
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// forProfile returns the Resource used for requests to the named profile
+func (r Resource) forProfile(name string) (Resource, error) {
+	if r.Defaults.DeliveryBuffer {
+		return r, profileError{"profiles can't be used with delivery buffering", http.StatusBadRequest}
+	}
+	profiles, err := r.getProfiles()
+	if err != nil {
+		return r, profileError{fmt.Sprintf("error getting profiles: %s", err), http.StatusInternalServerError}
+	}
+	for _, p := range profiles {
+		if p.Name != name {
+			continue
+		}
+		if !strings.HasPrefix(p.CallbackURL, "http://") && !strings.HasPrefix(p.CallbackURL, "https://") {
+			return r, profileError{fmt.Sprintf("profile %s has no callbackurl with the protocol http:// or https://", name), http.StatusBadRequest}
+		}
+		profiled := r
+		profiled.Defaults.Profile = p.Name
+		profiled.Defaults.CallbackURL = strings.TrimSuffix(p.CallbackURL, "/")
+		profiled.Defaults.AdditionalCallbackURLs = parseCallbackURLs(p.AdditionalCallbackURLs)
+		profiled.Defaults.EventListenerName = p.EventListenerName
+		if p.IngressPrefix != "" {
+			profiled.Defaults.IngressPrefix = p.IngressPrefix
+		}
+		if p.CertPrefix != "" {
+			profiled.Defaults.CertPrefix = p.CertPrefix
+		}
+		return profiled, nil
+	}
+	return r, profileError{fmt.Sprintf("profile %s not found", name), http.StatusNotFound}
+}
+
+// allProfiles returns the extension's own Resource followed by one for each profile
+func (r Resource) allProfiles() []Resource {
+	resources := []Resource{r}
+	profiles, err := r.getProfiles()
+	if err != nil {
+		logging.Log.Errorf("error getting profiles: %s", err)
+		return resources
+	}
+	for _, p := range profiles {
+		if profiled, err := r.forProfile(p.Name); err == nil {
+			resources = append(resources, profiled)
+		}
+	}
+	return resources
+}
+
+// setProfileCallbackURL records a new callback URL for the profile r is for
+func (r Resource) setProfileCallbackURL(callbackURL string) error {
+	cm, err := r.getProfilesConfigMap()
+	if err != nil {
+		return err
+	}
+	p := profile{}
+	if err := json.Unmarshal([]byte(cm.Data[r.Defaults.Profile]), &p); err != nil {
+		return err
+	}
+	p.Name = ""
+	p.CallbackURL = callbackURL
+	value, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	cm.Data[r.Defaults.Profile] = string(value)
+	_, err = r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Update(cm)
+	return err
+}
+
+// profiled runs handler with the Resource for the profile named by the profile query parameter, acting as the
+// caller if impersonating, see impersonation.go
+func (r Resource) profiled(handler func(Resource, *restful.Request, *restful.Response)) restful.RouteFunction {
+	return func(request *restful.Request, response *restful.Response) {
+		profiled := r
+		if name := request.QueryParameter("profile"); name != "" {
+			var err error
+			profiled, err = r.forProfile(name)
+			if err != nil {
+				status := http.StatusInternalServerError
+				if perr, ok := err.(profileError); ok {
+					status = perr.status
+				}
+				RespondError(response, err, status)
+				return
+			}
+		}
+		profiled.asCaller(handler)(request, response)
+	}
+}
+
+func (r Resource) getAllProfiles(request *restful.Request, response *restful.Response) {
+	profiles, err := r.getProfiles()
+	if err != nil {
+		RespondError(response, fmt.Errorf("error getting profiles: %s", err), http.StatusInternalServerError)
+		return
+	}
+	response.WriteEntity(profiles)
+}
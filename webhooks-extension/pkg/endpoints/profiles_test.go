@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func createProfiles(r *Resource, t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: profilesConfigMap, Namespace: r.Defaults.Namespace},
+		Data: map[string]string{
+			"staging": `{"callbackurl": "https://staging.example.com/"}`,
+			"prod":    `{"callbackurl": "https://prod.example.com", "eventlistenername": "prod-listener"}`,
+			"broken":  `{"callbackurl": "prod.example.com"}`,
+		},
+	}
+	if _, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Create(cm); err != nil {
+		t.Fatalf("error creating profiles: %s", err)
+	}
+}
+
+func TestForProfile(t *testing.T) {
+	r := dummyResource()
+	createProfiles(r, t)
+	os.Setenv("WEBHOOK_CALLBACK_URL", "https://dev.example.com")
+	defer os.Unsetenv("WEBHOOK_CALLBACK_URL")
+
+	staging, err := r.forProfile("staging")
+	if err != nil {
+		t.Fatalf("error getting profile: %s", err)
+	}
+	if name := staging.eventListenerName(); name != "tekton-webhooks-eventlistener-staging" {
+		t.Errorf("eventlistener was %s, expected tekton-webhooks-eventlistener-staging", name)
+	}
+	if callback := getCallbackURL(staging); callback != "https://staging.example.com" {
+		t.Errorf("callback was %s, expected https://staging.example.com", callback)
+	}
+	if callback := getCallbackURL(*r); callback != "https://dev.example.com" {
+		t.Errorf("callback without a profile was %s, expected https://dev.example.com", callback)
+	}
+
+	prod, err := r.forProfile("prod")
+	if err != nil || prod.eventListenerName() != "prod-listener" || prod.ingressName() != "el-prod-listener" {
+		t.Errorf("unexpected prod profile %+v, error %v", prod.Defaults, err)
+	}
+
+	tests := map[string]int{"broken": http.StatusBadRequest, "missing": http.StatusNotFound}
+	for name, status := range tests {
+		_, err := r.forProfile(name)
+		if perr, ok := err.(profileError); !ok || perr.status != status {
+			t.Errorf("expected status %d for profile %s, got %v", status, name, err)
+		}
+	}
+}
+
+func TestProfiledHandler(t *testing.T) {
+	r := dummyResource()
+	createProfiles(r, t)
+
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8080/webhooks/defaults?profile=staging", nil)
+	req := dummyRestfulRequest(httpReq, "")
+	httpWriter := httptest.NewRecorder()
+	r.profiled(Resource.getDefaults)(req, dummyRestfulResponse(httpWriter))
+	defaults := EnvDefaults{}
+	if err := json.NewDecoder(httpWriter.Body).Decode(&defaults); err != nil {
+		t.Fatalf("error decoding defaults: %s", err)
+	}
+	if defaults.Profile != "staging" || defaults.EventListenerName != "tekton-webhooks-eventlistener-staging" {
+		t.Errorf("unexpected defaults for the staging profile: %+v", defaults)
+	}
+
+	httpReq = dummyHTTPRequest("GET", "http://wwww.dummy.com:8080/webhooks/defaults?profile=missing", nil)
+	req = dummyRestfulRequest(httpReq, "")
+	httpWriter = httptest.NewRecorder()
+	r.profiled(Resource.getDefaults)(req, dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing profile, got %d", httpWriter.Code)
+	}
+}
+
+func TestWebhooksSeparatedByProfile(t *testing.T) {
+	r := dummyResource()
+	createProfiles(r, t)
+	staging, err := r.forProfile("staging")
+	if err != nil {
+		t.Fatalf("error getting profile: %s", err)
+	}
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := staging.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	if el.Name != "tekton-webhooks-eventlistener-staging" {
+		t.Errorf("eventlistener was %s, expected tekton-webhooks-eventlistener-staging", el.Name)
+	}
+
+	if hooks, err := staging.getWebhooksFromEventListener(); err != nil || len(hooks) != 1 {
+		t.Errorf("expected the webhook in the staging profile, got %+v, %v", hooks, err)
+	}
+	if hooks, _ := r.getWebhooksFromEventListener(); len(hooks) != 0 {
+		t.Errorf("expected no webhooks without a profile, got %+v", hooks)
+	}
+	if resources := r.allProfiles(); len(resources) != 3 {
+		t.Errorf("expected the extension and two usable profiles, got %d", len(resources))
+	}
+}
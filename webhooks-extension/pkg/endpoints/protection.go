@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	restful "github.com/emicklei/go-restful"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+)
+
+/*--------------------------------------
+A webhook created with protected set to true, such as one deploying to
+production, can't be deleted by accident from the UI: DELETE
+/webhooks/{name} refuses it with the WEBHOOK_PROTECTED message unless the
+request has force=true and is from an admin (see admin.go), and DELETE
+/webhooks leaves it out of what it deletes unless given force=true.
+Expired webhooks are deleted all the same, their expiry being set on
+purpose (see expiry.go).
+---------------------------------------*/
+
+// Binding param recording that a webhook is protected
+const protectedParam = "webhooks-tekton-protected"
+
+// protectionParams are the binding params recording that a webhook is protected
+func protectionParams(webhook webhook) []v1alpha1.Param {
+	if !webhook.Protected {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: protectedParam, Value: "true"}}
+}
+
+// forceQuery returns the force query parameter of request
+func forceQuery(request *restful.Request) (bool, error) {
+	value := request.QueryParameter("force")
+	if value == "" {
+		return false, nil
+	}
+	force, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("bad request information provided, cannot handle force query (should be set to true or not provided)")
+	}
+	return force, nil
+}
+
+// protectedError is the error refusing to delete the protected webhook hook
+func protectedError(hook webhook) error {
+	return newMessageError("WEBHOOK_PROTECTED", map[string]string{"name": hook.Name, "namespace": hook.Namespace})
+}
+
+// authorizeDelete returns the status to respond with and why if request may not delete hook
+func (r Resource) authorizeDelete(request *restful.Request, hook webhook) (int, error) {
+	if !hook.Protected {
+		return http.StatusOK, nil
+	}
+	force, err := forceQuery(request)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if !force {
+		return http.StatusForbidden, protectedError(hook)
+	}
+	return r.authorizeAdmin(request)
+}
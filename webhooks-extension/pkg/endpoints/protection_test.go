@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAuthorizeDelete(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+	protected := webhook{Name: "prod", Namespace: installNs, Protected: true}
+
+	for _, test := range []struct {
+		hook         webhook
+		query, token string
+		status       int
+	}{
+		{webhook{Name: "dev", Namespace: installNs}, "", "", http.StatusOK},
+		{protected, "", "admin", http.StatusForbidden},
+		{protected, "&force=maybe", "admin", http.StatusBadRequest},
+		{protected, "&force=true", "", http.StatusUnauthorized},
+		{protected, "&force=true", "user", http.StatusForbidden},
+		{protected, "&force=true", "admin", http.StatusOK},
+	} {
+		httpReq := dummyHTTPRequest("DELETE", "http://wwww.dummy.com:8383/webhooks/"+test.hook.Name+"?namespace="+installNs+test.query, nil)
+		if test.token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		status, err := r.authorizeDelete(dummyRestfulRequest(httpReq, test.hook.Name), test.hook)
+		if status != test.status {
+			t.Errorf("deleting %s with %q as %q returned %d (%v), expected %d", test.hook.Name, test.query, test.token, status, err, test.status)
+		}
+	}
+}
+
+func TestDeleteWebhooksLeavesProtected(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1", Protected: true}
+	other := webhook{Name: "other", Namespace: installNs, GitRepositoryURL: hook.GitRepositoryURL, AccessTokenRef: "token1", Pipeline: "pipeline2"}
+	createTriggerResources(hook, r)
+	createTriggerResources(other, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	if _, err := r.updateEventListener(el, other, "owner.repo-"); err != nil {
+		t.Fatalf("error adding webhook: %s", err)
+	}
+
+	status, result := batchDelete(r, "pipeline=pipeline1", "admin")
+	if status != http.StatusOK || len(result.Results) != 1 || result.Results[0].Deleted || result.Results[0].Error == "" {
+		t.Fatalf("expected the protected webhook to be left with an error, got %d, %+v", status, result)
+	}
+	if hooks, err := r.getWebhooksFromEventListener(); err != nil || len(hooks) != 2 || !hooks[0].Protected {
+		t.Fatalf("expected both webhooks to be left, the first protected, got %+v, %v", hooks, err)
+	}
+
+	status, result = batchDelete(r, "pipeline=pipeline1&force=true", "admin")
+	if status != http.StatusOK || len(result.Results) != 1 || !result.Results[0].Deleted {
+		t.Fatalf("expected the protected webhook to be deleted when forced, got %d, %+v", status, result)
+	}
+}
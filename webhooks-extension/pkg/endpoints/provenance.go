@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+The interceptor adds a record of each delivery, optionally signed, to the
+payload under webhooks-tekton-provenance. Every webhook's binding passes
+the record's fields to the TriggerTemplate as params so that PipelineRuns
+can be annotated with the delivery they were triggered by, see
+docs/Provenance.md. The extension annotates the PipelineRuns of every
+template a webhook uses: those generated for a webhook's overrides when
+they are generated, and a pipeline's own <pipeline>-template, adding only
+the annotations it lacks, when a webhook is created for the pipeline.
+---------------------------------------*/
+
+// Annotation names and the param each is set from
+var provenanceAnnotations = []struct{ annotation, param, field string }{
+	{"webhooks.tekton.dev/delivery-id", "webhooks-tekton-delivery-id", "deliveryid"},
+	{"webhooks.tekton.dev/event-type", "webhooks-tekton-event-type", "event"},
+	{"webhooks.tekton.dev/sender", "webhooks-tekton-sender", "sender"},
+	{"webhooks.tekton.dev/payload-digest", "webhooks-tekton-payload-digest", "payloaddigest"},
+	{"webhooks.tekton.dev/trigger", "webhooks-tekton-trigger", "trigger"},
+	{"webhooks.tekton.dev/provenance-signature", "webhooks-tekton-provenance-signature", "signature"},
+}
+
+// provenanceParams are the binding params reading the provenance record from the payload
+func provenanceParams() []v1alpha1.Param {
+	params := []v1alpha1.Param{}
+	for _, p := range provenanceAnnotations {
+		params = append(params, v1alpha1.Param{Name: p.param, Value: "$(body.webhooks-tekton-provenance." + p.field + ")"})
+	}
+	return params
+}
+
+// addProvenanceAnnotations annotates a resource template with the provenance params if it is a PipelineRun
+func addProvenanceAnnotations(raw []byte) ([]byte, error) {
+	raw, _, err := withProvenanceAnnotations(raw)
+	return raw, err
+}
+
+// ensureProvenanceAnnotations adds the provenance annotations a TriggerTemplate's PipelineRuns lack, leaving those
+// already set. A template that doesn't exist yet is left for the webhook's validation to report.
+func (r Resource) ensureProvenanceAnnotations(templateName string) error {
+	templates := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace)
+	template, err := templates.Get(templateName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i, resourceTemplate := range template.Spec.ResourceTemplates {
+		raw, added, err := withProvenanceAnnotations(resourceTemplate.Raw)
+		if err != nil {
+			logging.Log.Errorf("error annotating a resource template of %s with provenance: %s", templateName, err)
+			continue
+		}
+		if added {
+			template.Spec.ResourceTemplates[i].Raw = raw
+			template.Spec.ResourceTemplates[i].Object = nil
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if _, err := templates.Update(template); err != nil {
+		return fmt.Errorf("error adding provenance annotations to %s: %s", templateName, err)
+	}
+	logging.Log.Infof("added provenance annotations to the PipelineRuns of %s", templateName)
+	return nil
+}
+
+// withProvenanceAnnotations annotates a resource template with the provenance params it lacks if it is a
+// PipelineRun, returning whether any were added
+func withProvenanceAnnotations(raw []byte) ([]byte, bool, error) {
+	resource := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &resource); err != nil {
+		return nil, false, err
+	}
+	if resource["kind"] != "PipelineRun" {
+		return raw, false, nil
+	}
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+		resource["metadata"] = metadata
+	}
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = make(map[string]interface{})
+		metadata["annotations"] = annotations
+	}
+	added := false
+	for _, p := range provenanceAnnotations {
+		if _, found := annotations[p.annotation]; !found {
+			annotations[p.annotation] = "$(params." + p.param + ")"
+			added = true
+		}
+	}
+	if !added {
+		return raw, false, nil
+	}
+	annotated, err := json.Marshal(resource)
+	return annotated, err == nil, err
+}
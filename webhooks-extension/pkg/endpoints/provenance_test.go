@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddProvenanceAnnotations(t *testing.T) {
+	raw, err := addProvenanceAnnotations([]byte(overridesPipelineRun))
+	if err != nil {
+		t.Fatalf("error adding provenance annotations: %s", err.Error())
+	}
+	result := struct {
+		Metadata struct {
+			GenerateName string            `json:"generateName"`
+			Annotations  map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("error reading annotated resource: %s", err.Error())
+	}
+	if result.Metadata.GenerateName != "simple-pipeline-run-" {
+		t.Errorf("generateName was changed to %s", result.Metadata.GenerateName)
+	}
+	if len(result.Metadata.Annotations) != len(provenanceAnnotations) {
+		t.Errorf("expected %d annotations, got %v", len(provenanceAnnotations), result.Metadata.Annotations)
+	}
+	if value := result.Metadata.Annotations["webhooks.tekton.dev/delivery-id"]; value != "$(params.webhooks-tekton-delivery-id)" {
+		t.Errorf("unexpected delivery-id annotation %s", value)
+	}
+
+	// Annotations already set are left, and nothing is added twice
+	set := `{"kind":"PipelineRun","metadata":{"annotations":{"webhooks.tekton.dev/sender":"$(params.user)"}}}`
+	raw, added, err := withProvenanceAnnotations([]byte(set))
+	if err != nil || !added {
+		t.Fatalf("expected annotations to be added, got %v (error %v)", added, err)
+	}
+	json.Unmarshal(raw, &result)
+	if value := result.Metadata.Annotations["webhooks.tekton.dev/sender"]; value != "$(params.user)" {
+		t.Errorf("sender annotation was changed to %s", value)
+	}
+	if _, added, _ := withProvenanceAnnotations(raw); added {
+		t.Error("annotations were added to a resource that had them all")
+	}
+
+	resource := `{"kind":"PipelineResource","metadata":{"name":"git"}}`
+	raw, err = addProvenanceAnnotations([]byte(resource))
+	if err != nil || string(raw) != resource {
+		t.Errorf("resource was changed to %s (error %v)", string(raw), err)
+	}
+}
+
+func TestProvenanceParams(t *testing.T) {
+	params := provenanceParams()
+	if len(params) != len(provenanceAnnotations) {
+		t.Fatalf("expected %d params, got %d", len(provenanceAnnotations), len(params))
+	}
+	if params[0].Name != "webhooks-tekton-delivery-id" || params[0].Value != "$(body.webhooks-tekton-provenance.deliveryid)" {
+		t.Errorf("unexpected param %+v", params[0])
+	}
+}
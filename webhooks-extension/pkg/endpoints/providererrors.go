@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	github "github.com/google/go-github/github"
+	"github.com/xanzy/go-gitlab"
+)
+
+/*--------------------------------------
+The errors of the GitHub, GitLab, Bitbucket and Gitea APIs rarely say what to do about them:
+GitHub answers 404 when the access token lacks the admin:repo_hook scope,
+and GitLab 422 when its settings block webhooks to the callback's address.
+GitHub organizations enforcing SAML single sign-on answer 403 to tokens
+that haven't been authorized for it, with the URL to authorize them at in
+the X-GitHub-SSO header.
+The provider clients translate such failures of their webhook calls into
+catalog messages (see messages.go), so callers get a message saying what to
+change and a code in the Wext-Message-Code header, and respond with the
+status of providerErrorStatuses. Other failures are returned unchanged.
+---------------------------------------*/
+
+// providerCall is the webhook call to a provider that failed, for its message
+type providerCall struct {
+	provider   string
+	repository string
+	secret     string
+	// list, create, update or delete
+	action      string
+	callbackURL string
+}
+
+// providerErrorStatuses is the status to respond with for each translated provider error
+var providerErrorStatuses = map[string]int{
+	"GITHUB_HOOK_PERMISSION":    http.StatusBadRequest,
+	"GITHUB_SSO_REQUIRED":       http.StatusBadRequest,
+	"GITLAB_HOOK_PERMISSION":    http.StatusBadRequest,
+	"GITLAB_URL_BLOCKED":        http.StatusBadRequest,
+	"BITBUCKET_HOOK_PERMISSION": http.StatusBadRequest,
+	"GITEA_HOOK_PERMISSION":     http.StatusBadRequest,
+	"GIT_TOKEN_REJECTED":        http.StatusBadRequest,
+	"GIT_TOKEN_SCOPE_MISSING":   http.StatusBadRequest,
+	"GIT_RATE_LIMITED":          http.StatusTooManyRequests,
+	"GIT_API_UNREACHABLE":       http.StatusBadGateway,
+}
+
+// providerErrorStatus is the status to respond to err with, fallback if it isn't a translated provider error
+func providerErrorStatus(err error, fallback int) int {
+	if coded, ok := err.(messageError); ok {
+		if status, found := providerErrorStatuses[coded.code]; found {
+			return status
+		}
+	}
+	return fallback
+}
+
+// translateGitHubError translates a failed call to the GitHub API
+func translateGitHubError(call providerCall, err error) error {
+	switch e := err.(type) {
+	case *github.RateLimitError:
+		return call.messageError("GIT_RATE_LIMITED", e.Message+", the limit resets at "+e.Rate.Reset.String())
+	case *github.AbuseRateLimitError:
+		return call.messageError("GIT_RATE_LIMITED", e.Message)
+	case *github.ErrorResponse:
+		if e.Response == nil {
+			return err
+		}
+		switch e.Response.StatusCode {
+		case http.StatusUnauthorized:
+			return call.messageError("GIT_TOKEN_REJECTED", e.Message)
+		case http.StatusForbidden, http.StatusNotFound:
+			if ssoErr := gitHubSSOError(call, e); ssoErr != nil {
+				return ssoErr
+			}
+			// GitHub hides repositories, and their hooks, from tokens that can't see them
+			return call.messageError("GITHUB_HOOK_PERMISSION", strconv.Itoa(e.Response.StatusCode)+" "+e.Message)
+		}
+	case *url.Error:
+		return call.messageError("GIT_API_UNREACHABLE", e.Error())
+	}
+	return err
+}
+
+// gitHubSSOError returns the GITHUB_SSO_REQUIRED error if GitHub refused the call as the organization enforces
+// SAML single sign-on the token isn't authorized for, nil otherwise
+func gitHubSSOError(call providerCall, e *github.ErrorResponse) error {
+	if e.Response == nil || e.Response.StatusCode != http.StatusForbidden {
+		return nil
+	}
+	// e.g. required; url=https://github.com/orgs/<org>/sso?authorization_request=<id>
+	sso := e.Response.Header.Get("X-GitHub-SSO")
+	if !strings.HasPrefix(sso, "required") && !strings.Contains(e.Message, "SAML") {
+		return nil
+	}
+	ssoURL := "https://github.com/settings/tokens"
+	if i := strings.Index(sso, "url="); i >= 0 {
+		ssoURL = strings.TrimSpace(sso[i+len("url="):])
+	}
+	err := call.messageError("GITHUB_SSO_REQUIRED", e.Message).(messageError)
+	err.params["ssourl"] = ssoURL
+	return err
+}
+
+// translateGitLabError translates a failed call to the GitLab API
+func translateGitLabError(call providerCall, err error) error {
+	switch e := err.(type) {
+	case *gitlab.ErrorResponse:
+		if e.Response == nil {
+			return err
+		}
+		switch e.Response.StatusCode {
+		case http.StatusUnauthorized:
+			return call.messageError("GIT_TOKEN_REJECTED", e.Message)
+		case http.StatusForbidden, http.StatusNotFound:
+			// GitLab answers 404 for projects the token's user can't see
+			return call.messageError("GITLAB_HOOK_PERMISSION", strconv.Itoa(e.Response.StatusCode)+" "+e.Message)
+		case http.StatusUnprocessableEntity:
+			if call.action == "create" || call.action == "update" {
+				return call.messageError("GITLAB_URL_BLOCKED", e.Message)
+			}
+		case http.StatusTooManyRequests:
+			return call.messageError("GIT_RATE_LIMITED", e.Message)
+		}
+	case *url.Error:
+		return call.messageError("GIT_API_UNREACHABLE", e.Error())
+	}
+	return err
+}
+
+// translateBitbucketError translates a failed call to the Bitbucket API
+func translateBitbucketError(call providerCall, err error) error {
+	switch e := err.(type) {
+	case *bitbucketError:
+		switch e.StatusCode {
+		case http.StatusUnauthorized:
+			return call.messageError("GIT_TOKEN_REJECTED", e.Message)
+		case http.StatusForbidden, http.StatusNotFound:
+			// Bitbucket answers 404 for private repositories the token can't see
+			return call.messageError("BITBUCKET_HOOK_PERMISSION", e.Error())
+		case http.StatusTooManyRequests:
+			return call.messageError("GIT_RATE_LIMITED", e.Message)
+		}
+	case *url.Error:
+		return call.messageError("GIT_API_UNREACHABLE", e.Error())
+	}
+	return err
+}
+
+// translateGiteaError translates a failed call to the Gitea or Gogs API
+func translateGiteaError(call providerCall, err error) error {
+	switch e := err.(type) {
+	case *giteaError:
+		switch e.StatusCode {
+		case http.StatusUnauthorized:
+			return call.messageError("GIT_TOKEN_REJECTED", e.Message)
+		case http.StatusForbidden, http.StatusNotFound:
+			// Gitea answers 404 for private repositories the token's user can't see
+			return call.messageError("GITEA_HOOK_PERMISSION", e.Error())
+		}
+	case *url.Error:
+		return call.messageError("GIT_API_UNREACHABLE", e.Error())
+	}
+	return err
+}
+
+func (c providerCall) messageError(code, detail string) error {
+	return newMessageError(code, map[string]string{
+		"provider":   c.provider,
+		"repository": c.repository,
+		"secret":     c.secret,
+		"action":     c.action,
+		"url":        c.callbackURL,
+		"detail":     detail,
+	})
+}
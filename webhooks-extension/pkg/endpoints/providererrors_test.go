@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	github "github.com/google/go-github/github"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestGitHubHookPermissionError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found", "documentation_url": "https://developer.github.com/v3/repos/hooks/#list-hooks"}`)
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	gh := GitHub{Client: client, Context: context.Background(), Org: "owner", Repo: "repo", Secret: "github-token", PageSize: 10}
+	_, err := gh.GetAllWebhooks()
+	coded, ok := err.(messageError)
+	if !ok || coded.code != "GITHUB_HOOK_PERMISSION" {
+		t.Fatalf("expected a GITHUB_HOOK_PERMISSION error, got %v", err)
+	}
+	expected := "GitHub refused to list the webhooks of owner/repo (404 Not Found), the access token in secret github-token can't manage them"
+	if err.Error() != expected {
+		t.Errorf("error was %q, expected %q", err, expected)
+	}
+	if status := providerErrorStatus(err, http.StatusInternalServerError); status != http.StatusBadRequest {
+		t.Errorf("status was %d, expected %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestGitHubSSOError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-GitHub-SSO", "required; url=https://github.com/orgs/owner/sso?authorization_request=AZSCKtL4U8yX")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource protected by organization SAML enforcement. You must grant your Personal Access token access to this organization."}`)
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	gh := GitHub{Client: client, Context: context.Background(), Org: "owner", Repo: "repo", Secret: "github-token", PageSize: 10}
+	_, err := gh.GetAllWebhooks()
+	coded, ok := err.(messageError)
+	if !ok || coded.code != "GITHUB_SSO_REQUIRED" {
+		t.Fatalf("expected a GITHUB_SSO_REQUIRED error, got %v", err)
+	}
+	if coded.params["ssourl"] != "https://github.com/orgs/owner/sso?authorization_request=AZSCKtL4U8yX" {
+		t.Errorf("unexpected SSO URL %s", coded.params["ssourl"])
+	}
+	if status := providerErrorStatus(err, http.StatusInternalServerError); status != http.StatusBadRequest {
+		t.Errorf("status was %d, expected %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestTranslateGitLabError(t *testing.T) {
+	call := providerCall{provider: "GitLab", repository: "owner/repo", secret: "gitlab-token", action: "create", callbackURL: "http://10.0.0.5"}
+	tests := []struct {
+		name   string
+		err    error
+		code   string
+		status int
+	}{
+		{name: "url blocked", err: &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnprocessableEntity}, Message: "{error: Invalid url given}"},
+			code: "GITLAB_URL_BLOCKED", status: http.StatusBadRequest},
+		{name: "not a maintainer", err: &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusForbidden}, Message: "403 Forbidden"},
+			code: "GITLAB_HOOK_PERMISSION", status: http.StatusBadRequest},
+		{name: "revoked token", err: &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnauthorized}, Message: "401 Unauthorized"},
+			code: "GIT_TOKEN_REJECTED", status: http.StatusBadRequest},
+		{name: "unreachable", err: &url.Error{Op: "Post", URL: "https://gitlab.example.com/api/v4/projects", Err: errors.New("connection refused")},
+			code: "GIT_API_UNREACHABLE", status: http.StatusBadGateway},
+		{name: "other", err: &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusInternalServerError}, Message: "500"},
+			status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := translateGitLabError(call, tt.err)
+			if coded, ok := err.(messageError); tt.code != "" && (!ok || coded.code != tt.code) {
+				t.Errorf("expected a %s error, got %v", tt.code, err)
+			}
+			if tt.code == "" && err != tt.err {
+				t.Errorf("expected the error to be unchanged, got %v", err)
+			}
+			if status := providerErrorStatus(err, http.StatusInternalServerError); status != tt.status {
+				t.Errorf("status was %d, expected %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestTranslateBitbucketError(t *testing.T) {
+	call := providerCall{provider: "Bitbucket", repository: "workspace/repo", secret: "bitbucket-token", action: "create", callbackURL: "http://10.0.0.5"}
+	tests := []struct {
+		name   string
+		err    error
+		code   string
+		status int
+	}{
+		{name: "no admin permission", err: &bitbucketError{StatusCode: http.StatusForbidden, Message: "Forbidden"},
+			code: "BITBUCKET_HOOK_PERMISSION", status: http.StatusBadRequest},
+		{name: "private repository", err: &bitbucketError{StatusCode: http.StatusNotFound, Message: "Repository not found"},
+			code: "BITBUCKET_HOOK_PERMISSION", status: http.StatusBadRequest},
+		{name: "revoked token", err: &bitbucketError{StatusCode: http.StatusUnauthorized, Message: "Unauthorized"},
+			code: "GIT_TOKEN_REJECTED", status: http.StatusBadRequest},
+		{name: "rate limited", err: &bitbucketError{StatusCode: http.StatusTooManyRequests, Message: "Rate limit exceeded"},
+			code: "GIT_RATE_LIMITED", status: http.StatusTooManyRequests},
+		{name: "other", err: &bitbucketError{StatusCode: http.StatusInternalServerError, Message: "Internal Server Error"},
+			status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := translateBitbucketError(call, tt.err)
+			if coded, ok := err.(messageError); tt.code != "" && (!ok || coded.code != tt.code) {
+				t.Errorf("expected a %s error, got %v", tt.code, err)
+			}
+			if tt.code == "" && err != tt.err {
+				t.Errorf("expected the error to be unchanged, got %v", err)
+			}
+			if status := providerErrorStatus(err, http.StatusInternalServerError); status != tt.status {
+				t.Errorf("status was %d, expected %d", status, tt.status)
+			}
+		})
+	}
+}
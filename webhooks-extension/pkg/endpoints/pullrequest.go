@@ -0,0 +1,70 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+)
+
+/*--------------------------------------
+The interceptor adds the number of the pull or merge request an event is for
+to the payload under webhooks-tekton-pull-request, empty for pushes. Every
+webhook's binding passes it to the TriggerTemplate as a param so that
+PipelineRuns can be labelled with the pull request they were run for, see
+docs/Labels.md. The monitor reports the latest PipelineRun of each pipeline
+labelled for a pull request in one status table, see docs/MultiplePipelines.md.
+Templates generated for a webhook's overrides are labelled by the extension.
+---------------------------------------*/
+
+const pullRequestParam = "webhooks-tekton-pull-request"
+
+// Labels identifying the pull request a PipelineRun was run for and the param each is set from
+var pullRequestLabels = []struct{ label, param string }{
+	{"webhooks.tekton.dev/gitServer", "webhooks-tekton-git-server"},
+	{"webhooks.tekton.dev/gitOrg", "webhooks-tekton-git-org"},
+	{"webhooks.tekton.dev/gitRepo", "webhooks-tekton-git-repo"},
+	{"webhooks.tekton.dev/pullRequest", pullRequestParam},
+}
+
+// pullRequestParams are the binding params reading the pull request number from the payload
+func pullRequestParams() []v1alpha1.Param {
+	return []v1alpha1.Param{{Name: pullRequestParam, Value: "$(body." + pullRequestParam + ")"}}
+}
+
+// addPullRequestLabels labels a resource template with the pull request params if it is a PipelineRun
+func addPullRequestLabels(raw []byte) ([]byte, error) {
+	resource := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &resource); err != nil {
+		return nil, err
+	}
+	if resource["kind"] != "PipelineRun" {
+		return raw, nil
+	}
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+		resource["metadata"] = metadata
+	}
+	labels, _ := metadata["labels"].(map[string]interface{})
+	if labels == nil {
+		labels = make(map[string]interface{})
+		metadata["labels"] = labels
+	}
+	for _, l := range pullRequestLabels {
+		labels[l.label] = "$(params." + l.param + ")"
+	}
+	return json.Marshal(resource)
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddPullRequestLabels(t *testing.T) {
+	raw, err := addPullRequestLabels([]byte(overridesPipelineRun))
+	if err != nil {
+		t.Fatalf("error adding pull request labels: %s", err.Error())
+	}
+	result := struct {
+		Metadata struct {
+			GenerateName string            `json:"generateName"`
+			Labels       map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("error reading labelled resource: %s", err.Error())
+	}
+	if result.Metadata.GenerateName != "simple-pipeline-run-" {
+		t.Errorf("generateName was changed to %s", result.Metadata.GenerateName)
+	}
+	if value := result.Metadata.Labels["webhooks.tekton.dev/pullRequest"]; value != "$(params.webhooks-tekton-pull-request)" {
+		t.Errorf("unexpected pullRequest label %s", value)
+	}
+	if value := result.Metadata.Labels["webhooks.tekton.dev/gitRepo"]; value != "$(params.webhooks-tekton-git-repo)" {
+		t.Errorf("unexpected gitRepo label %s", value)
+	}
+
+	resource := `{"kind":"PipelineResource","metadata":{"name":"git"}}`
+	raw, err = addPullRequestLabels([]byte(resource))
+	if err != nil || string(raw) != resource {
+		t.Errorf("resource was changed to %s (error %v)", string(raw), err)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+The pull task is what the monitor trigger of a repository runs, by default
+monitor-task with the triggerbinding for the repository's git provider.
+The pull task used for each provider when a webhook doesn't name one can be
+changed in the webhooks-extension-pulltasks configmap in the install
+namespace, a key per provider whose value is its pull task as JSON, e.g.
+	github: '{"task": "my-monitor", "binding": "my-monitor-github-binding"}'
+A binding or template not given is named <task>-binding and <task>-template.
+A webhook naming a pull task other than its provider's uses those names too.
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/pulltasks").To(r.getAllPullTasks))
+---------------------------------------*/
+
+const (
+	// Configmap in the install namespace holding the pull task for each provider
+	pullTasksConfigMap = "webhooks-extension-pulltasks"
+)
+
+// pullTask is the triggerbinding and triggertemplate the monitor trigger uses
+type pullTask struct {
+	Provider string `json:"provider,omitempty"`
+	Task     string `json:"task"`
+	Binding  string `json:"binding,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+// pullTaskStatus is a provider's pull task as returned by GET /webhooks/pulltasks
+type pullTaskStatus struct {
+	pullTask
+	BindingFound  bool `json:"bindingfound"`
+	TemplateFound bool `json:"templatefound"`
+}
+
+// defaultPullTasks are the pull tasks for each provider shipped in base/
+func defaultPullTasks() map[string]pullTask {
+	return map[string]pullTask{
+		"github":    {Provider: "github", Task: webhookextPullTask, Binding: webhookextPullTask + "-github-binding", Template: webhookextPullTask + "-template"},
+		"gitlab":    {Provider: "gitlab", Task: webhookextPullTask, Binding: webhookextPullTask + "-gitlab-binding", Template: webhookextPullTask + "-template"},
+		"bitbucket": {Provider: "bitbucket", Task: webhookextPullTask, Binding: webhookextPullTask + "-bitbucket-binding", Template: webhookextPullTask + "-template"},
+		"gitea":     {Provider: "gitea", Task: webhookextPullTask, Binding: webhookextPullTask + "-gitea-binding", Template: webhookextPullTask + "-template"},
+	}
+}
+
+// namedPullTask is the pull task with the given name, its binding and template named after it
+func namedPullTask(task string) pullTask {
+	return pullTask{Task: task, Binding: task + "-binding", Template: task + "-template"}
+}
+
+// getPullTasks returns the pull task for each provider, those not in the configmap as shipped
+func (r Resource) getPullTasks() (map[string]pullTask, error) {
+	tasks := defaultPullTasks()
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(pullTasksConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return tasks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for provider, value := range cm.Data {
+		task := pullTask{}
+		if err := json.Unmarshal([]byte(value), &task); err != nil || task.Task == "" {
+			logging.Log.Errorf("ignoring pull task for provider %s, it must be JSON with a task: %v", provider, err)
+			continue
+		}
+		named := namedPullTask(task.Task)
+		if task.Binding == "" {
+			task.Binding = named.Binding
+		}
+		if task.Template == "" {
+			task.Template = named.Template
+		}
+		task.Provider = provider
+		tasks[provider] = task
+	}
+	return tasks, nil
+}
+
+// pullTaskFor returns the pull task used for a repository by a webhook naming task, its
+// provider's pull task if task is empty or the same as the provider's
+func (r Resource) pullTaskFor(repoURL, task string) (pullTask, error) {
+	tasks, err := r.getPullTasks()
+	if err != nil {
+		return pullTask{}, err
+	}
+	registered := false
+	for _, t := range tasks {
+		registered = registered || t.Task == task
+	}
+	// A pull task no provider uses is found by name, whatever the provider
+	if task != "" && !registered {
+		return namedPullTask(task), nil
+	}
+	provider, _, err := utils.GetGitProviderAndAPIURL(repoURL)
+	if err != nil {
+		return pullTask{}, err
+	}
+	providerTask, ok := tasks[provider]
+	if !ok {
+		return pullTask{}, fmt.Errorf("no pull task is configured for git provider %s", provider)
+	}
+	if task == "" || task == providerTask.Task {
+		return providerTask, nil
+	}
+	return namedPullTask(task), nil
+}
+
+// defaultPullTask is the pull task of a repository's provider, monitor-task if it can't be found
+func (r Resource) defaultPullTask(repoURL string) string {
+	task, err := r.pullTaskFor(repoURL, "")
+	if err != nil {
+		return webhookextPullTask
+	}
+	return task.Task
+}
+
+// validatePullTask checks the triggerbinding and triggertemplate of the webhook's pull task exist
+func (r Resource) validatePullTask(webhook webhook) error {
+	task, err := r.pullTaskFor(webhook.GitRepositoryURL, webhook.PullTask)
+	if err != nil {
+		return err
+	}
+	_, bindingErr := r.TriggersClient.TriggersV1alpha1().TriggerBindings(r.Defaults.Namespace).Get(task.Binding, metav1.GetOptions{})
+	_, templateErr := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).Get(task.Template, metav1.GetOptions{})
+	if bindingErr != nil || templateErr != nil {
+		logging.Log.Errorf("pull task binding error: `%v`, template error: `%v`", bindingErr, templateErr)
+		return fmt.Errorf("Could not find the trigger template or trigger binding of pull task %s in namespace: %s. Expected to find: %s and %s",
+			task.Task, r.Defaults.Namespace, task.Template, task.Binding)
+	}
+	return nil
+}
+
+// GET /webhooks/pulltasks
+func (r Resource) getAllPullTasks(request *restful.Request, response *restful.Response) {
+	tasks, err := r.getPullTasks()
+	if err != nil {
+		RespondError(response, fmt.Errorf("error getting pull tasks: %s", err), http.StatusInternalServerError)
+		return
+	}
+	statuses := []pullTaskStatus{}
+	for _, task := range tasks {
+		status := pullTaskStatus{pullTask: task}
+		_, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(r.Defaults.Namespace).Get(task.Binding, metav1.GetOptions{})
+		status.BindingFound = err == nil
+		_, err = r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).Get(task.Template, metav1.GetOptions{})
+		status.TemplateFound = err == nil
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Provider < statuses[j].Provider })
+	response.WriteEntity(statuses)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func createPullTasks(r *Resource, t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: pullTasksConfigMap, Namespace: r.Defaults.Namespace},
+		Data: map[string]string{
+			"gitlab":  `{"task": "lab-monitor"}`,
+			"broken":  `{"binding": "no-task"}`,
+			"unknown": `not json`,
+		},
+	}
+	if _, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Create(cm); err != nil {
+		t.Fatalf("error creating pull tasks: %s", err)
+	}
+}
+
+func TestPullTaskFor(t *testing.T) {
+	r := dummyResource()
+	createPullTasks(r, t)
+	tests := []struct {
+		repoURL, task string
+		expected      pullTask
+	}{
+		{"https://github.com/owner/repo", "", pullTask{Provider: "github", Task: "monitor-task", Binding: "monitor-task-github-binding", Template: "monitor-task-template"}},
+		{"https://gitlab.com/owner/repo", "", pullTask{Provider: "gitlab", Task: "lab-monitor", Binding: "lab-monitor-binding", Template: "lab-monitor-template"}},
+		{"https://gitlab.com/owner/repo", "monitor-task", pullTask{Task: "monitor-task", Binding: "monitor-task-binding", Template: "monitor-task-template"}},
+		{"https://github.com/owner/repo", "lab-monitor", pullTask{Task: "lab-monitor", Binding: "lab-monitor-binding", Template: "lab-monitor-template"}},
+		{"https://hungry.dinosaur.com/owner/repo", "wibble", pullTask{Task: "wibble", Binding: "wibble-binding", Template: "wibble-template"}},
+	}
+	for _, test := range tests {
+		task, err := r.pullTaskFor(test.repoURL, test.task)
+		if err != nil || task != test.expected {
+			t.Errorf("pull task for %s, %s was %+v, %v, expected %+v", test.repoURL, test.task, task, err, test.expected)
+		}
+	}
+	if _, err := r.pullTaskFor("https://hungry.dinosaur.com/owner/repo", ""); err == nil {
+		t.Errorf("expected an error for a repository of an unknown provider")
+	}
+}
+
+func TestGetAllPullTasks(t *testing.T) {
+	r := dummyResource()
+	createTriggerResources(webhook{Pipeline: "pipeline"}, r)
+
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/pulltasks", nil)
+	httpWriter := httptest.NewRecorder()
+	r.getAllPullTasks(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	statuses := []pullTaskStatus{}
+	json.NewDecoder(httpWriter.Body).Decode(&statuses)
+	if httpWriter.Code != http.StatusOK || len(statuses) != 2 || statuses[0].Provider != "github" || statuses[1].Provider != "gitlab" {
+		t.Fatalf("unexpected pull tasks %d, %+v", httpWriter.Code, statuses)
+	}
+	for _, status := range statuses {
+		if !status.BindingFound || !status.TemplateFound {
+			t.Errorf("expected the binding and template of %+v to be found", status)
+		}
+	}
+}
+
+func TestCreateWebhookValidatesPullTask(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		PullTask:         "my-monitor",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+
+	if resp := createWebhook(hook, r); resp.StatusCode() != http.StatusBadRequest {
+		t.Errorf("creating a webhook with a missing pull task returned %d", resp.StatusCode())
+	}
+
+	r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Create(&v1alpha1.TriggerTemplate{ObjectMeta: metav1.ObjectMeta{Name: "my-monitor-template"}})
+	r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Create(&v1alpha1.TriggerBinding{ObjectMeta: metav1.ObjectMeta{Name: "my-monitor-binding"}})
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	monitor := el.Spec.Triggers[len(el.Spec.Triggers)-1]
+	if monitor.Template.Name != "my-monitor-template" || monitor.Bindings[0].Ref != "my-monitor-binding" {
+		t.Errorf("unexpected monitor trigger %+v", monitor)
+	}
+
+	other := hook
+	other.Name = "other"
+	other.Pipeline = "pipeline2"
+	createTriggerResources(other, r)
+	if resp := createWebhook(other, r); resp.StatusCode() != http.StatusCreated {
+		t.Errorf("creating a webhook with its pull task returned %d", resp.StatusCode())
+	}
+}
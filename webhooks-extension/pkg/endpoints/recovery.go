@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+RecoverFilter turns a panic in a handler into a 500 response rather than
+a dropped connection. The response body is JSON holding an incident ID,
+which is logged with the panic and its stack so an operator given the ID
+can find what went wrong, e.g.
+	{"message": "internal error", "incident": "3f2a9c01d4e5b687"}
+Recovered panics are counted in the webhooks_extension_handler_panics_total
+metric. The filter is added after AccessLogFilter, so recovered requests
+are logged with their 500 status.
+---------------------------------------*/
+
+// Panics recovered by RecoverFilter since the extension started
+var handlerPanics uint64
+
+type panicResponse struct {
+	Message  string `json:"message"`
+	Incident string `json:"incident"`
+}
+
+// RecoverFilter responds with an incident ID and HTTP code 500 when a handler panics
+func RecoverFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		atomic.AddUint64(&handlerPanics, 1)
+		incident := newIncidentID()
+		logging.Log.Errorw("recovered from a panic handling a request",
+			"incident", incident,
+			"method", request.Request.Method,
+			"path", request.Request.URL.Path,
+			"panic", fmt.Sprintf("%v", recovered),
+			"stack", string(debug.Stack()),
+		)
+		response.WriteHeaderAndJson(http.StatusInternalServerError, panicResponse{Message: "internal error", Incident: incident}, restful.MIME_JSON)
+	}()
+	chain.ProcessFilter(request, response)
+}
+
+// newIncidentID returns a random ID to match a response to the log of its panic
+func newIncidentID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// formatPanicMetrics writes the count of recovered panics in the Prometheus text format
+func formatPanicMetrics() []byte {
+	name := "webhooks_extension_handler_panics_total"
+	return []byte(fmt.Sprintf("# HELP %s Requests whose handler panicked.\n# TYPE %s counter\n%s %d\n", name, name, name, atomic.LoadUint64(&handlerPanics)))
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+func TestRecoverFilter(t *testing.T) {
+	container := restful.NewContainer()
+	container.Filter(RecoverFilter)
+	ws := new(restful.WebService)
+	ws.Path("/webhooks")
+	ws.Route(ws.GET("/panic").To(func(request *restful.Request, response *restful.Response) {
+		hooks := []webhook{}
+		response.WriteEntity(hooks[0])
+	}))
+	ws.Route(ws.GET("/fine").To(func(request *restful.Request, response *restful.Response) {
+		response.WriteHeader(http.StatusNoContent)
+	}))
+	container.Add(ws)
+
+	before := atomic.LoadUint64(&handlerPanics)
+	httpWriter := httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/panic", nil))
+	body := panicResponse{}
+	json.NewDecoder(httpWriter.Body).Decode(&body)
+	if httpWriter.Code != http.StatusInternalServerError || len(body.Incident) != 16 {
+		t.Errorf("expected a 500 with an incident ID, got %d, %+v", httpWriter.Code, body)
+	}
+	if atomic.LoadUint64(&handlerPanics) != before+1 {
+		t.Errorf("expected the panic to be counted")
+	}
+	if metrics := string(formatPanicMetrics()); !strings.Contains(metrics, fmt.Sprintf("webhooks_extension_handler_panics_total %d\n", before+1)) {
+		t.Errorf("unexpected panic metrics %s", metrics)
+	}
+
+	httpWriter = httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/fine", nil))
+	if httpWriter.Code != http.StatusNoContent || atomic.LoadUint64(&handlerPanics) != before+1 {
+		t.Errorf("expected a request that doesn't panic to pass through, got %d", httpWriter.Code)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Teams sharing a cluster push to different docker registries. The
+webhooks-extension-registries configmap in the install namespace holds the
+registry of webhooks in a namespace, keyed by the namespace's name, or by
+team.<team> for the namespaces labelled webhooks.tekton.dev/team=<team>:
+
+	payments-dev: registry.example.com/payments
+	team.search: registry.example.com:5000/search
+
+A webhook's docker registry is the one it was created with, else its
+namespace's, else its namespace's team's, else the global default of
+DOCKER_REGISTRY_LOCATION or the dockerregistry of the
+webhooks-extension-config configmap (see reload.go). Registries are a host
+with an optional port followed by optional lowercase path components, an
+http:// or https:// prefix being dropped. Entries that aren't valid are
+ignored and reported, with the rest, by GET /webhooks/defaults.
+---------------------------------------*/
+
+const (
+	// Configmap in the install namespace holding the registries of namespaces and teams
+	registriesConfigMap = "webhooks-extension-registries"
+	// Label on a namespace naming the team its registry is keyed by
+	teamLabel     = "webhooks.tekton.dev/team"
+	teamKeyPrefix = "team."
+)
+
+var registryPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?(:[0-9]+)?(/[a-z0-9]+([._-]+[a-z0-9]+)*)*$`)
+
+// registryDefault is an entry of the registries configmap
+type registryDefault struct {
+	// A namespace, or team.<team>
+	Key      string `json:"key"`
+	Registry string `json:"registry"`
+	Error    string `json:"error,omitempty"`
+}
+
+// parseRegistry returns registry without its protocol or trailing slash, or an error if it isn't a registry
+func parseRegistry(registry string) (string, error) {
+	parsed := strings.TrimSpace(registry)
+	parsed = strings.TrimPrefix(strings.TrimPrefix(parsed, "https://"), "http://")
+	parsed = strings.TrimSuffix(parsed, "/")
+	if !registryPattern.MatchString(parsed) {
+		return parsed, fmt.Errorf("docker registry %s must be a host with an optional port and lowercase path, e.g. registry.example.com:5000/team", registry)
+	}
+	return parsed, nil
+}
+
+// getRegistries returns the entries of the registries configmap sorted by key, none if it does not exist
+func (r Resource) getRegistries() ([]registryDefault, error) {
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(registriesConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return []registryDefault{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	registries := []registryDefault{}
+	for key, value := range cm.Data {
+		registry, err := parseRegistry(value)
+		entry := registryDefault{Key: key, Registry: registry}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		registries = append(registries, entry)
+	}
+	sort.Slice(registries, func(i, j int) bool { return registries[i].Key < registries[j].Key })
+	return registries, nil
+}
+
+// dockerRegistryFor returns the docker registry of webhooks in namespace that don't set one
+func (r Resource) dockerRegistryFor(namespace string) string {
+	if namespace == "" {
+		return r.dockerRegistryDefault()
+	}
+	registries, err := r.getRegistries()
+	if err != nil {
+		logging.Log.Errorf("error reading configmap %s, using the global docker registry: %s", registriesConfigMap, err)
+		return r.dockerRegistryDefault()
+	}
+	valid := map[string]string{}
+	for _, entry := range registries {
+		if entry.Error == "" {
+			valid[entry.Key] = entry.Registry
+		}
+	}
+	if len(valid) == 0 {
+		return r.dockerRegistryDefault()
+	}
+	if registry, found := valid[namespace]; found {
+		return registry
+	}
+	ns, err := r.K8sClient.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		logging.Log.Debugf("unable to read the team of namespace %s, using the global docker registry: %s", namespace, err)
+		return r.dockerRegistryDefault()
+	}
+	if team := ns.Labels[teamLabel]; team != "" {
+		if registry, found := valid[teamKeyPrefix+team]; found {
+			return registry
+		}
+	}
+	return r.dockerRegistryDefault()
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseRegistry(t *testing.T) {
+	valid := map[string]string{
+		"registry1":                     "registry1",
+		"https://registry.example.com/": "registry.example.com",
+		"default.docker.reg:8500/foo":   "default.docker.reg:8500/foo",
+		"localhost:5000/team/app-ci":    "localhost:5000/team/app-ci",
+	}
+	for registry, expected := range valid {
+		if parsed, err := parseRegistry(registry); err != nil || parsed != expected {
+			t.Errorf("parsed registry %s as %s, %v, expected %s", registry, parsed, err, expected)
+		}
+	}
+	for _, registry := range []string{"", "DOCKER_REPO", "registry.example.com/Team", "registry.example.com:port", "-registry"} {
+		if _, err := parseRegistry(registry); err == nil {
+			t.Errorf("expected registry %q not to be valid", registry)
+		}
+	}
+}
+
+func TestDockerRegistryFor(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.DockerRegistry = "global.example.com"
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: registriesConfigMap, Namespace: r.Defaults.Namespace},
+		Data: map[string]string{
+			"payments":    "https://registry.example.com/payments",
+			"team.search": "registry.example.com/search",
+			"team.broken": "Not A Registry",
+		},
+	}
+	r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Create(cm)
+	for name, team := range map[string]string{"search-dev": "search", "broken-dev": "broken", "other": ""} {
+		r.K8sClient.CoreV1().Namespaces().Create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{teamLabel: team}}})
+	}
+
+	for namespace, expected := range map[string]string{
+		"payments":   "registry.example.com/payments",
+		"search-dev": "registry.example.com/search",
+		"broken-dev": "global.example.com",
+		"other":      "global.example.com",
+		"missing":    "global.example.com",
+	} {
+		if registry := r.dockerRegistryFor(namespace); registry != expected {
+			t.Errorf("registry for namespace %s was %s, expected %s", namespace, registry, expected)
+		}
+	}
+
+	registries := r.defaultsResponse().Registries
+	if len(registries) != 3 || registries[0].Key != "payments" || registries[1].Error == "" || registries[2].Error != "" {
+		t.Errorf("unexpected registries %+v", registries)
+	}
+}
+
+func TestCreateWebhookInvalidRegistry(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		DockerRegistry:   "https://Registry With Spaces",
+	}
+	if resp := createWebhook(hook, r); resp.StatusCode() != http.StatusBadRequest {
+		t.Errorf("creating a webhook with an invalid docker registry returned %d", resp.StatusCode())
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Relay mode, enabled by setting WEBHOOK_RELAY_URL to a smee.io style channel,
+needs no inbound connectivity at all. Provider webhooks are registered
+against the channel, which the extension subscribes to as a stream of
+server-sent events, and each delivery on it, its headers and body, is
+forwarded to the eventlistener (or stored in the delivery buffer when
+buffering). No ingress or route is created while relaying. Any relay
+serving deliveries the way smee.io does, each event's data being a JSON
+object of the delivery's lowercased headers with its payload as body, can
+be used. Profiles aren't relayed.
+---------------------------------------*/
+
+const (
+	// Fields of a relayed event that aren't the delivery's headers
+	relayQueryField     = "query"
+	relayTimestampField = "timestamp"
+	relayBodyField      = "body"
+)
+
+var (
+	relayClient = &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}}
+
+	relayStateLock sync.Mutex
+	// The relay's connection, for GET /webhooks/infrastructure
+	relayState = relayStatus{}
+)
+
+// relayStatus is the connection to the relay channel
+type relayStatus struct {
+	URL         string       `json:"url"`
+	Connected   bool         `json:"connected"`
+	Relayed     int          `json:"relayed"`
+	LastRelayed *metav1.Time `json:"lastrelayed,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+func (r Resource) relayed() bool {
+	return r.Defaults.RelayURL != "" && r.Defaults.Profile == ""
+}
+
+// RelayDeliveries forwards the deliveries on the WEBHOOK_RELAY_URL channel to the eventlistener until stopCh is
+// closed, reconnecting whenever the stream ends
+func (r Resource) RelayDeliveries(stopCh <-chan struct{}) {
+	if !r.relayed() {
+		return
+	}
+	logging.Log.Infof("Relaying deliveries from %s", r.Defaults.RelayURL)
+	attempts := 0
+	for {
+		err := r.relayDeliveries(stopCh)
+		setRelayState(r.Defaults.RelayURL, false, err)
+		attempts = attempts + 1
+		if err == nil {
+			// The stream ended, as relays end them every so often
+			attempts = 0
+		} else {
+			logging.Log.Errorf("error reading relay channel %s: %s", r.Defaults.RelayURL, err)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(deliveryBackoff(attempts)):
+		}
+	}
+}
+
+// relayDeliveries reads the relay channel's stream until it ends
+func (r Resource) relayDeliveries(stopCh <-chan struct{}) error {
+	req, err := http.NewRequest(http.MethodGet, r.Defaults.RelayURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := relayClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("relay channel returned %s", resp.Status)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// Unblock the read below when stopping
+		select {
+		case <-stopCh:
+			resp.Body.Close()
+		case <-done:
+		}
+	}()
+	setRelayState(r.Defaults.RelayURL, true, nil)
+	return readRelayEvents(resp.Body, r.relayDelivery)
+}
+
+// readRelayEvents calls deliver with each delivery in a stream of server-sent events
+func readRelayEvents(stream io.Reader, deliver func(bufferedDelivery) error) error {
+	reader := bufio.NewReader(stream)
+	event, data := "", []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			// A blank line ends an event, those other than messages (e.g. ready or ping) aren't deliveries
+			if len(data) > 0 && (event == "" || event == "message") {
+				delivery, err := parseRelayedDelivery(strings.Join(data, "\n"))
+				if err != nil {
+					logging.Log.Errorf("ignoring unreadable relayed delivery: %s", err)
+				} else if err := deliver(delivery); err != nil {
+					logging.Log.Errorf("error forwarding relayed delivery %s: %s", delivery.ID, err)
+				}
+			}
+			event, data = "", []string{}
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+// parseRelayedDelivery reads the delivery in a relayed event's data: its lowercased headers and its payload as body
+func parseRelayedDelivery(data string) (bufferedDelivery, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return bufferedDelivery{}, err
+	}
+	body, ok := fields[relayBodyField]
+	if !ok {
+		return bufferedDelivery{}, fmt.Errorf("no body in relayed event")
+	}
+	header := http.Header{}
+	for name, value := range fields {
+		switch name {
+		case relayBodyField, relayQueryField, relayTimestampField, "host", "content-length", "connection":
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			header.Set(name, s)
+		}
+	}
+	now := time.Now()
+	// The payload's bytes as relayed, as signatures are checked against them
+	return bufferedDelivery{ID: deliveryID(header), Received: now, NextAttempt: now, Header: header, Body: body}, nil
+}
+
+// relayDelivery stores a relayed delivery in the delivery buffer when buffering, else forwards it to the eventlistener
+func (r Resource) relayDelivery(delivery bufferedDelivery) error {
+	recordDeliveryReceived(delivery.Received)
+	recordRelayed(delivery.Received)
+	if r.Defaults.DeliveryBuffer {
+		err := r.storeDelivery(delivery)
+		if err == nil {
+			logging.Log.Debugf("buffered relayed delivery %s", delivery.ID)
+			select {
+			case deliveryWakeup <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+		logging.Log.Warnf("unable to buffer relayed delivery %s, forwarding directly: %s", delivery.ID, err)
+	}
+	status, err := forwardDelivery(r.Defaults.Namespace, r.getDeliveryForwardService(), delivery)
+	if err != nil {
+		return err
+	}
+	logging.Log.Debugf("forwarded relayed delivery %s, status %d", delivery.ID, status)
+	return nil
+}
+
+func setRelayState(url string, connected bool, err error) {
+	relayStateLock.Lock()
+	defer relayStateLock.Unlock()
+	relayState.URL = url
+	relayState.Connected = connected
+	relayState.Error = ""
+	if err != nil {
+		relayState.Error = err.Error()
+	}
+}
+
+func recordRelayed(relayed time.Time) {
+	relayStateLock.Lock()
+	defer relayStateLock.Unlock()
+	relayState.Relayed = relayState.Relayed + 1
+	relayState.LastRelayed = &metav1.Time{Time: relayed}
+}
+
+// getRelayStatus is the connection to the relay channel, nil when not relaying
+func (r Resource) getRelayStatus() *relayStatus {
+	if !r.relayed() {
+		return nil
+	}
+	relayStateLock.Lock()
+	defer relayStateLock.Unlock()
+	status := relayState
+	status.URL = r.Defaults.RelayURL
+	return &status
+}
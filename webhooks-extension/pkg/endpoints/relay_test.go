@@ -0,0 +1,86 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const relayedStream = "event: ready\ndata: {}\n\n" +
+	"event: ping\ndata: {}\n\n" +
+	`data: {"host":"smee.io","x-github-event":"push","x-github-delivery":"72d3162e-cc78-11e3-81ab-4c9367dc0958",` +
+	`"x-hub-signature":"sha1=7d38cdd689735b008b3c702edd92eea23791c5f6","content-type":"application/json",` +
+	`"body":{"ref":"refs/heads/master","after":"6a8f0c2d"},"query":{},"timestamp":1590000000000}` + "\n\n"
+
+func TestReadRelayEvents(t *testing.T) {
+	deliveries := []bufferedDelivery{}
+	err := readRelayEvents(strings.NewReader(relayedStream), func(delivery bufferedDelivery) error {
+		deliveries = append(deliveries, delivery)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("expected one delivery, got %+v", deliveries)
+	}
+	delivery := deliveries[0]
+	if delivery.ID != "72d3162e-cc78-11e3-81ab-4c9367dc0958" {
+		t.Errorf("delivery id was %s", delivery.ID)
+	}
+	if delivery.Header.Get("X-GitHub-Event") != "push" || delivery.Header.Get("X-Hub-Signature") != "sha1=7d38cdd689735b008b3c702edd92eea23791c5f6" {
+		t.Errorf("unexpected headers %v", delivery.Header)
+	}
+	if delivery.Header.Get("Host") != "" || delivery.Header.Get("Timestamp") != "" {
+		t.Errorf("expected the relay's fields to be dropped, got %v", delivery.Header)
+	}
+	if string(delivery.Body) != `{"ref":"refs/heads/master","after":"6a8f0c2d"}` {
+		t.Errorf("body was %s", delivery.Body)
+	}
+}
+
+func TestRelayDeliveriesToBuffer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept") != "text/event-stream" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		fmt.Fprint(w, relayedStream)
+	}))
+	defer server.Close()
+
+	r := dummyResource()
+	r.Defaults.RelayURL = server.URL
+	r.Defaults.DeliveryBuffer = true
+	if err := r.relayDeliveries(make(chan struct{})); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	deliveries, _, err := r.loadDeliveryBuffer()
+	if err != nil {
+		t.Fatalf("error reading delivery buffer: %s", err)
+	}
+	if _, ok := deliveries["72d3162e-cc78-11e3-81ab-4c9367dc0958"]; !ok || len(deliveries) != 1 {
+		t.Errorf("expected the relayed delivery to be buffered, got %+v", deliveries)
+	}
+	if status := r.getRelayStatus(); status == nil || status.URL != server.URL || status.Relayed == 0 {
+		t.Errorf("unexpected relay status %+v", status)
+	}
+	if got := getCallbackURL(*r); got != server.URL {
+		t.Errorf("callback was %s, expected the relay channel %s", got, server.URL)
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sclientset "k8s.io/client-go/kubernetes"
+)
+
+/*--------------------------------------
+Settings in the webhooks-extension-config configmap in the install
+namespace override those of the deployment's environment, e.g.
+
+	dockerregistry: registry.example.com/ci
+	loglevel: info
+
+Every configReloadInterval the configmap is read again and these settings
+are applied without a restart:
+
+	dockerregistry      the docker registry of new webhooks that don't set one
+	onsuccesscomment    the comments of new webhooks that don't set them
+	onfailurecomment
+	ontimeoutcomment
+	loglevel            debug, info, warn or error
+
+Those below are read when the extension starts, as they change resources
+already created or the extension's background work. A change to one is
+listed in the pendingrestart of GET /webhooks/defaults until the extension
+is restarted:
+
+	callbackurl, deliverybuffer, monitorcontroller
+---------------------------------------*/
+
+const (
+	// Configmap in the install namespace holding settings overriding the environment
+	extensionConfigMap   = "webhooks-extension-config"
+	configReloadInterval = 30 * time.Second
+)
+
+// Settings applied at startup only, changes to them need a restart
+var restartSettings = []string{"callbackurl", "additionalcallbackurls", "deliverybuffer", "monitorcontroller"}
+
+// liveSettings are the configmap's settings applied without a restart
+type liveSettings struct {
+	DockerRegistry   string
+	OnSuccessComment string
+	OnFailureComment string
+	OnTimeoutComment string
+	LogLevel         string
+}
+
+var (
+	// Guards the settings below
+	liveConfigLock sync.RWMutex
+	liveConfig     liveSettings
+	// The configmap's restart settings when the extension started
+	startupConfig = map[string]string{}
+	// Restart settings changed since the extension started
+	pendingRestart = []string{}
+)
+
+// defaultsResponse is GET /webhooks/defaults' response, the defaults with the live settings applied
+type defaultsResponse struct {
+	EnvDefaults
+	OnSuccessComment string   `json:"onsuccesscomment,omitempty"`
+	OnFailureComment string   `json:"onfailurecomment,omitempty"`
+	OnTimeoutComment string   `json:"ontimeoutcomment,omitempty"`
+	LogLevel         string   `json:"loglevel"`
+	PendingRestart   []string `json:"pendingrestart"`
+	// The registries of namespaces and teams, see registries.go
+	Registries []registryDefault `json:"registries"`
+}
+
+// getConfigData returns the settings in the config configmap, none if it does not exist
+func getConfigData(k8sClient k8sclientset.Interface, namespace string) (map[string]string, error) {
+	cm, err := k8sClient.CoreV1().ConfigMaps(namespace).Get(extensionConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cm.Data == nil {
+		return map[string]string{}, nil
+	}
+	return cm.Data, nil
+}
+
+// setConfigMapDefaults applies the config configmap's settings over those of the environment
+func setConfigMapDefaults(k8sClient k8sclientset.Interface, defaults *EnvDefaults) {
+	data, err := getConfigData(k8sClient, defaults.Namespace)
+	if err != nil {
+		logging.Log.Errorf("error reading configmap %s, using the environment's settings: %s", extensionConfigMap, err)
+		return
+	}
+	if callbackURL := strings.TrimSpace(data["callbackurl"]); callbackURL != "" {
+		defaults.CallbackURL = callbackURL
+	}
+	if value, ok := data["additionalcallbackurls"]; ok {
+		defaults.AdditionalCallbackURLs = parseCallbackURLs(value)
+	}
+	if value, ok := data["deliverybuffer"]; ok {
+		defaults.DeliveryBuffer = strings.TrimSpace(value) == "true"
+	}
+	if value, ok := data["monitorcontroller"]; ok {
+		defaults.MonitorController = strings.TrimSpace(value) == "true"
+	}
+
+	liveConfigLock.Lock()
+	startupConfig = map[string]string{}
+	for _, setting := range restartSettings {
+		startupConfig[setting] = strings.TrimSpace(data[setting])
+	}
+	pendingRestart = []string{}
+	liveConfigLock.Unlock()
+	applyLiveSettings(data)
+}
+
+// applyLiveSettings records the live settings of the config configmap's data and sets the log level
+func applyLiveSettings(data map[string]string) {
+	settings := liveSettings{
+		DockerRegistry:   strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(data["dockerregistry"]), "https://"), "http://"),
+		OnSuccessComment: data["onsuccesscomment"],
+		OnFailureComment: data["onfailurecomment"],
+		OnTimeoutComment: data["ontimeoutcomment"],
+		LogLevel:         strings.ToLower(strings.TrimSpace(data["loglevel"])),
+	}
+	if settings.LogLevel == "" {
+		settings.LogLevel = "debug"
+	}
+	if err := logging.SetLevel(settings.LogLevel); err != nil {
+		logging.Log.Errorf("ignoring loglevel in configmap %s: %s", extensionConfigMap, err)
+		settings.LogLevel = logging.Level.String()
+	}
+
+	liveConfigLock.Lock()
+	defer liveConfigLock.Unlock()
+	if settings != liveConfig {
+		logging.Log.Infof("applied settings from configmap %s: %+v", extensionConfigMap, settings)
+	}
+	liveConfig = settings
+}
+
+// ReloadConfig applies changes to the config configmap every configReloadInterval until stopCh is closed
+func (r Resource) ReloadConfig(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			r.reloadConfig()
+		}
+	}
+}
+
+func (r Resource) reloadConfig() {
+	data, err := getConfigData(r.K8sClient, r.Defaults.Namespace)
+	if err != nil {
+		logging.Log.Errorf("error reloading configmap %s: %s", extensionConfigMap, err)
+		return
+	}
+	applyLiveSettings(data)
+
+	changed := []string{}
+	liveConfigLock.Lock()
+	for _, setting := range restartSettings {
+		if strings.TrimSpace(data[setting]) != startupConfig[setting] {
+			changed = append(changed, setting)
+		}
+	}
+	sort.Strings(changed)
+	if strings.Join(changed, ",") != strings.Join(pendingRestart, ",") && len(changed) > 0 {
+		logging.Log.Warnf("settings %s in configmap %s have changed and apply once the extension is restarted", strings.Join(changed, ", "), extensionConfigMap)
+	}
+	pendingRestart = changed
+	liveConfigLock.Unlock()
+}
+
+func getLiveSettings() liveSettings {
+	liveConfigLock.RLock()
+	defer liveConfigLock.RUnlock()
+	return liveConfig
+}
+
+// dockerRegistryDefault is the docker registry of webhooks that don't set one
+func (r Resource) dockerRegistryDefault() string {
+	if registry := getLiveSettings().DockerRegistry; registry != "" {
+		return registry
+	}
+	return r.Defaults.DockerRegistry
+}
+
+// setDefaultComments sets the comments a webhook doesn't set to those of the config configmap
+func setDefaultComments(hook *webhook) {
+	settings := getLiveSettings()
+	if hook.OnSuccessComment == "" {
+		hook.OnSuccessComment = settings.OnSuccessComment
+	}
+	if hook.OnFailureComment == "" {
+		hook.OnFailureComment = settings.OnFailureComment
+	}
+	if hook.OnTimeoutComment == "" {
+		hook.OnTimeoutComment = settings.OnTimeoutComment
+	}
+}
+
+func (r Resource) defaultsResponse() defaultsResponse {
+	settings := getLiveSettings()
+	defaults := r.Defaults
+	defaults.DockerRegistry = r.dockerRegistryDefault()
+	liveConfigLock.RLock()
+	pending := append([]string{}, pendingRestart...)
+	liveConfigLock.RUnlock()
+	registries, err := r.getRegistries()
+	if err != nil {
+		logging.Log.Errorf("error reading configmap %s: %s", registriesConfigMap, err)
+		registries = []registryDefault{}
+	}
+	return defaultsResponse{
+		EnvDefaults:      defaults,
+		OnSuccessComment: settings.OnSuccessComment,
+		OnFailureComment: settings.OnFailureComment,
+		OnTimeoutComment: settings.OnTimeoutComment,
+		LogLevel:         logging.Level.String(),
+		PendingRestart:   pending,
+		Registries:       registries,
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReloadConfig(t *testing.T) {
+	r := dummyResource()
+	defer func() {
+		setConfigMapDefaults(r.K8sClient, &EnvDefaults{Namespace: "missing"})
+	}()
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: extensionConfigMap, Namespace: r.Defaults.Namespace},
+		Data:       map[string]string{"callbackurl": "https://first.example.com", "dockerregistry": "https://registry.example.com/ci"},
+	}
+	if _, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Create(cm); err != nil {
+		t.Fatalf("error creating configmap: %s", err)
+	}
+
+	setConfigMapDefaults(r.K8sClient, &r.Defaults)
+	if r.Defaults.CallbackURL != "https://first.example.com" || r.dockerRegistryDefault() != "registry.example.com/ci" {
+		t.Errorf("expected the configmap's settings at startup, got %s and %s", r.Defaults.CallbackURL, r.dockerRegistryDefault())
+	}
+
+	cm.Data = map[string]string{"callbackurl": "https://second.example.com", "loglevel": "warn", "onsuccesscomment": "All good"}
+	r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Update(cm)
+	r.reloadConfig()
+	defaults := r.defaultsResponse()
+	if defaults.CallbackURL != "https://first.example.com" || !reflect.DeepEqual(defaults.PendingRestart, []string{"callbackurl"}) {
+		t.Errorf("expected the callback URL change to be pending a restart, got %s and %v", defaults.CallbackURL, defaults.PendingRestart)
+	}
+	if defaults.DockerRegistry != r.Defaults.DockerRegistry || defaults.LogLevel != "warn" || logging.Level.String() != "warn" {
+		t.Errorf("expected the docker registry and log level to change live, got %s and %s", defaults.DockerRegistry, defaults.LogLevel)
+	}
+	hook := webhook{OnFailureComment: "Broken"}
+	setDefaultComments(&hook)
+	if hook.OnSuccessComment != "All good" || hook.OnFailureComment != "Broken" || hook.OnTimeoutComment != "" {
+		t.Errorf("unexpected comments %+v", hook)
+	}
+
+	cm.Data["loglevel"] = "verbose"
+	r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Update(cm)
+	r.reloadConfig()
+	if logging.Level.String() != "warn" {
+		t.Errorf("expected an unknown log level to be ignored, got %s", logging.Level.String())
+	}
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/{name}/rename").To(r.profiled(Resource.renameWebhook)))
+Renames a webhook in place rather than it being deleted and created again.
+The webhook's triggerbinding, and triggertemplate if it has overrides, are
+copied under the new name and its triggers, canaries included, renamed and
+pointed at the copies in a single update of the eventlistener, the old
+copies then being removed. The provider webhook is left alone and as
+PipelineRuns are found by repository and pipeline, see stats.go, the
+webhook keeps its history.
+---------------------------------------*/
+
+type webhookRename struct {
+	Name string `json:"name"`
+}
+
+// POST /webhooks/{name}/rename?namespace=x
+func (r Resource) renameWebhook(request *restful.Request, response *restful.Response) {
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	name := request.PathParameter("name")
+	namespace := request.QueryParameter("namespace")
+	if namespace == "" {
+		RespondError(response, errors.New("namespace query parameter is required"), http.StatusBadRequest)
+		return
+	}
+	rename := webhookRename{}
+	if err := readEntity(request, &rename); err != nil {
+		logging.Log.Errorf("error trying to read request entity as webhook rename: %s.", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	if rename.Name == "" || len(rename.Name) > 57 {
+		err := fmt.Errorf("requested webhook name (%s) must be given and less than 58 characters", rename.Name)
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	var hook *webhook
+	for i := range hooks {
+		if hooks[i].Name == name && hooks[i].Namespace == namespace {
+			hook = &hooks[i]
+		}
+	}
+	if hook == nil {
+		RespondError(response, newMessageError("WEBHOOK_NOT_FOUND", map[string]string{"name": name, "namespace": namespace}), http.StatusNotFound)
+		return
+	}
+	for _, other := range hooks {
+		if sameRepo(other.GitRepositoryURL, hook.GitRepositoryURL) && other.Name == rename.Name {
+			RespondError(response, errors.New("Webhook already exists with the same name"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	renamed := *hook
+	renamed.Name = rename.Name
+	if err := r.assignTriggerPrefix(&renamed); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	if err := r.renameTriggers(*hook, renamed); err != nil {
+		logging.Log.Errorf("error renaming webhook %s in namespace %s to %s: %s", name, namespace, rename.Name, err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	if err := r.renameRecordedStats(*hook, renamed); err != nil {
+		logging.Log.Errorf("error moving the stats of webhook %s in namespace %s to %s: %s", name, namespace, rename.Name, err)
+	}
+	logging.Log.Infof("renamed webhook %s in namespace %s to %s", name, namespace, rename.Name)
+	response.WriteEntity(renamed)
+}
+
+// renameTriggers moves the triggers, triggerbinding and overrides triggertemplate of hook to renamed's name
+func (r Resource) renameTriggers(hook, renamed webhook) error {
+	installNs := r.Defaults.Namespace
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	oldPrefix := triggerPrefix(hook)
+	newPrefix := triggerPrefix(renamed)
+	// Old name to copy, a webhook's canary triggers sharing its binding and template
+	bindings, templates := map[string]string{}, map[string]string{}
+	cleanUp := func() {
+		for _, copied := range bindings {
+			r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Delete(copied, &metav1.DeleteOptions{})
+		}
+		for _, copied := range templates {
+			r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Delete(copied, &metav1.DeleteOptions{})
+		}
+	}
+
+	for i := range el.Spec.Triggers {
+		trigger := &el.Spec.Triggers[i]
+		suffix := ""
+		for _, s := range webhookTriggerSuffixes {
+			if trigger.Name == oldPrefix+s {
+				suffix = s
+			}
+		}
+		if suffix == "" {
+			continue
+		}
+		trigger.Name = newPrefix + suffix
+		for j, header := range trigger.Interceptors[0].Webhook.Header {
+			if header.Name == "Wext-Trigger-Name" {
+				trigger.Interceptors[0].Webhook.Header[j].Value.StringVal = trigger.Name
+			}
+		}
+		for _, binding := range trigger.Bindings {
+			if !strings.HasPrefix(binding.Ref, bindingNamePrefix(r.resourcePrefix(), hook.Name)) {
+				continue
+			}
+			if _, done := bindings[binding.Ref]; !done {
+				copied, err := r.copyBinding(binding.Ref, renamed)
+				if err != nil {
+					cleanUp()
+					return err
+				}
+				bindings[binding.Ref] = copied
+			}
+			binding.Ref = bindings[binding.Ref]
+		}
+		if trigger.Template.Name == r.resourcePrefix()+hook.Name+"-"+hook.Namespace+"-template" {
+			if _, done := templates[trigger.Template.Name]; !done {
+				copied, err := r.copyOverridesTemplate(trigger.Template.Name, renamed)
+				if err != nil {
+					cleanUp()
+					return err
+				}
+				templates[trigger.Template.Name] = copied
+			}
+			trigger.Template.Name = templates[trigger.Template.Name]
+		}
+	}
+
+	if _, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Update(el); err != nil {
+		cleanUp()
+		return fmt.Errorf("error updating eventlistener: %s", err)
+	}
+	for old := range bindings {
+		err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Delete(old, &metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			logging.Log.Errorf("error deleting triggerbinding %s, left behind by renaming webhook %s: %s", old, hook.Name, err)
+		}
+	}
+	for old := range templates {
+		err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Delete(old, &metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			logging.Log.Errorf("error deleting triggertemplate %s, left behind by renaming webhook %s: %s", old, hook.Name, err)
+		}
+	}
+	return nil
+}
+
+// copyBinding copies a webhook's triggerbinding to one named and labelled for renamed, returning its name
+func (r Resource) copyBinding(name string, renamed webhook) (string, error) {
+	installNs := r.Defaults.Namespace
+	binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error getting triggerbinding %s: %s", name, err)
+	}
+	copied := v1alpha1.TriggerBinding{
+		ObjectMeta: GetTriggerBindingObjectMeta(r.resourcePrefix(), renamed.Name),
+		Spec:       *binding.Spec.DeepCopy(),
+	}
+	// The name is kept in the binding of a webhook whose triggers are named from the template
+	params := []v1alpha1.Param{}
+	for _, param := range copied.Spec.Params {
+		if param.Name != webhookNameParam {
+			params = append(params, param)
+		}
+	}
+	copied.Spec.Params = append(params, triggerNameParams(renamed)...)
+	copied.Labels = withLabels(binding.Labels, map[string]string{webhookLabel: labelValue(renamed.Name)})
+	copied.Annotations = binding.Annotations
+	created, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Create(&copied)
+	if err != nil {
+		return "", fmt.Errorf("error copying triggerbinding %s: %s", name, err)
+	}
+	return created.Name, nil
+}
+
+// copyOverridesTemplate copies a webhook's overrides triggertemplate to the name used for renamed
+func (r Resource) copyOverridesTemplate(name string, renamed webhook) (string, error) {
+	installNs := r.Defaults.Namespace
+	template, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error getting triggertemplate %s: %s", name, err)
+	}
+	copied := v1alpha1.TriggerTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        r.overridesTemplateName(renamed.Name, renamed.Namespace),
+			Namespace:   installNs,
+			Labels:      withLabels(template.Labels, map[string]string{webhookLabel: labelValue(renamed.Name)}),
+			Annotations: template.Annotations,
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	created, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Create(&copied)
+	if err != nil {
+		return "", fmt.Errorf("error copying triggertemplate %s: %s", name, err)
+	}
+	return created.Name, nil
+}
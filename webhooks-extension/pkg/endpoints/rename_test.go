@@ -0,0 +1,95 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func renameWebhook(r *Resource, name, newName string) int {
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(webhookRename{Name: newName})
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/"+name+"/rename?namespace="+installNs, body)
+	httpWriter := httptest.NewRecorder()
+	resp := dummyRestfulResponse(httpWriter)
+	r.renameWebhook(dummyRestfulRequest(httpReq, name), resp)
+	return resp.StatusCode()
+}
+
+func TestRenameWebhook(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		ReleaseName:      "release1",
+		Canary:           &canaryRoute{Pipeline: "pipeline2", Percentage: 10},
+	}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2"}, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	for name, status := range map[string]int{"": http.StatusBadRequest, "hook": http.StatusBadRequest} {
+		if got := renameWebhook(r, "hook", name); got != status {
+			t.Errorf("renaming to %q returned %d, expected %d", name, got, status)
+		}
+	}
+	if status := renameWebhook(r, "missing", "renamed"); status != http.StatusNotFound {
+		t.Errorf("renaming a missing webhook returned %d", status)
+	}
+	if status := renameWebhook(r, "hook", "renamed"); status != http.StatusOK {
+		t.Fatalf("renaming returned %d", status)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook, got %+v, %v", hooks, err)
+	}
+	renamed := hooks[0]
+	if renamed.Name != "renamed" || renamed.Pipeline != hook.Pipeline || renamed.ReleaseName != hook.ReleaseName ||
+		renamed.GitRepositoryURL != hook.GitRepositoryURL || !reflect.DeepEqual(renamed.Canary, hook.Canary) {
+		t.Errorf("unexpected renamed webhook %+v", renamed)
+	}
+
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting eventlistener: %s", err)
+	}
+	expectedNames := []string{"renamed-default-push-event", "renamed-default-pullrequest-event", "renamed-default-push-canary", "renamed-default-pullrequest-canary"}
+	for i, name := range expectedNames {
+		trigger := el.Spec.Triggers[i]
+		if trigger.Name != name || triggerHeader(trigger, "Wext-Trigger-Name") != name || trigger.Bindings[1].Ref != "wext-renamed-" {
+			t.Errorf("trigger %d was not renamed to %s: %+v", i, name, trigger)
+		}
+	}
+	binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("wext-renamed-", metav1.GetOptions{})
+	if err != nil || binding.Labels[webhookLabel] != "renamed" {
+		t.Errorf("expected a triggerbinding labelled for the renamed webhook, got %+v, %v", binding, err)
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("wext-hook-", metav1.GetOptions{}); err == nil {
+		t.Error("the old triggerbinding was left behind")
+	}
+}
@@ -0,0 +1,343 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/{name}/repair").To(r.repairWebhook))
+---------------------------------------*/
+
+type repairReport struct {
+	Webhook   webhook  `json:"webhook"`
+	Repaired  []string `json:"repaired"`
+	Defaulted []string `json:"defaulted,omitempty"`
+	Missing   []string `json:"missing,omitempty"`
+}
+
+// Recreates the triggerbindings generated for a webhook that have gone missing,
+// the webhook being listed as broken, rather than it having to be deleted and
+// created again. Values held only by a missing binding are recovered from what
+// the webhook's triggers still hold, taken from the request body, or defaulted
+// and reported as such. A binding that came with the pipeline, or a value that
+// is needed and can't be found, is reported as missing and nothing is changed.
+func (r Resource) repairWebhook(request *restful.Request, response *restful.Response) {
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	name := request.PathParameter("name")
+	namespace := request.QueryParameter("namespace")
+	if namespace == "" {
+		RespondError(response, errors.New("namespace query parameter is required"), http.StatusBadRequest)
+		return
+	}
+	supplied := webhook{}
+	if request.Request.ContentLength != 0 {
+		if err := readEntity(request, &supplied); err != nil {
+			RespondError(response, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	installNs := r.Defaults.Namespace
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			RespondError(response, newMessageError("WEBHOOK_NOT_FOUND", map[string]string{"name": name, "namespace": namespace}), http.StatusNotFound)
+			return
+		}
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	// A webhook whose binding is missing may have been named from the trigger name template or not
+	var prefix string
+	hookTriggers := []int{}
+	for _, candidate := range []string{r.triggerPrefixOf(name, namespace), name + "-" + namespace} {
+		for i, trigger := range el.Spec.Triggers {
+			if trigger.Name == candidate+"-push-event" || trigger.Name == candidate+"-pullrequest-event" {
+				hookTriggers = append(hookTriggers, i)
+			}
+		}
+		if len(hookTriggers) > 0 {
+			prefix = candidate
+			break
+		}
+	}
+	if len(hookTriggers) == 0 {
+		RespondError(response, newMessageError("WEBHOOK_NOT_FOUND", map[string]string{"name": name, "namespace": namespace}), http.StatusNotFound)
+		return
+	}
+
+	report := repairReport{Repaired: []string{}}
+	hook := r.recoverWebhook(el.Spec.Triggers, hookTriggers, name, namespace, prefix)
+
+	// Find the missing bindings, only those generated for the webhook can be recreated
+	brokenRefs := map[string]bool{}
+	for _, i := range hookTriggers {
+		for _, binding := range el.Spec.Triggers[i].Bindings {
+			if r.bindingExists(binding.Ref) || brokenRefs[binding.Ref] {
+				continue
+			}
+			if r.isGeneratedBindingName(binding.Ref, name) {
+				brokenRefs[binding.Ref] = true
+			} else {
+				report.Missing = append(report.Missing, fmt.Sprintf("triggerbinding %s, recreate it from the pipeline's definitions", binding.Ref))
+			}
+		}
+	}
+	if len(brokenRefs) > 0 {
+		report.Defaulted = hook.fillFrom(supplied)
+		if hook.DockerRegistry == "" {
+			hook.DockerRegistry = r.dockerRegistryFor(hook.Namespace)
+		}
+	}
+	if hook.Pipeline == "" {
+		report.Missing = append(report.Missing, "pipeline, supply it in the request body")
+	}
+
+	monitor, monitorBroken := -1, ""
+	monitorBindingName, err := r.getMonitorBindingName(hook.GitRepositoryURL, hook.PullTask)
+	if err == nil {
+		if _, owner, repo, err := r.getGitValues(hook.GitRepositoryURL); err == nil {
+			if found, monitorName := r.doesMonitorExist(monitorTriggerPrefix(owner, repo), hook, el.Spec.Triggers); found {
+				for i, trigger := range el.Spec.Triggers {
+					if trigger.Name == monitorName {
+						monitor = i
+					}
+				}
+			}
+		}
+	}
+	if monitor >= 0 {
+		for _, binding := range el.Spec.Triggers[monitor].Bindings {
+			if r.bindingExists(binding.Ref) {
+				continue
+			}
+			if r.isGeneratedBindingName(binding.Ref, monitorBindingName) {
+				monitorBroken = binding.Ref
+			} else {
+				report.Missing = append(report.Missing, fmt.Sprintf("triggerbinding %s, reinstall the webhooks extension", binding.Ref))
+			}
+		}
+	}
+
+	report.Webhook = hook
+	if len(report.Missing) > 0 {
+		logging.Log.Infof("webhook %s in namespace %s can't be repaired: %v", name, namespace, report.Missing)
+		response.WriteHeaderAndEntity(http.StatusBadRequest, report)
+		return
+	}
+	// The recreated bindings name the variable set's variables
+	if status, err := r.checkVariableSet(hook.VariableSet); err != nil {
+		RespondError(response, err, status)
+		return
+	}
+
+	replaceRef := func(trigger *v1alpha1.EventListenerTrigger, oldRef, newRef string) {
+		for _, binding := range trigger.Bindings {
+			if binding.Ref == oldRef {
+				binding.Ref = newRef
+			}
+		}
+	}
+	if len(brokenRefs) > 0 {
+		hookBinding, _, err := r.createBindings(hook, "", false)
+		if err != nil {
+			RespondError(response, fmt.Errorf("error recreating triggerbinding for webhook %s: %s", name, err), http.StatusInternalServerError)
+			return
+		}
+		for ref := range brokenRefs {
+			// The webhook's canary triggers share its binding
+			for i := range el.Spec.Triggers {
+				replaceRef(&el.Spec.Triggers[i], ref, hookBinding)
+			}
+			report.Repaired = append(report.Repaired, fmt.Sprintf("recreated triggerbinding %s as %s", ref, hookBinding))
+		}
+	}
+	if monitorBroken != "" {
+		_, monitorParams, err := r.getParams(hook)
+		if err != nil {
+			RespondError(response, fmt.Errorf("error recreating monitor triggerbinding for webhook %s: %s", name, err), http.StatusInternalServerError)
+			return
+		}
+		binding := v1alpha1.TriggerBinding{
+			ObjectMeta: GetTriggerBindingObjectMeta(r.resourcePrefix(), monitorBindingName),
+			Spec:       v1alpha1.TriggerBindingSpec{Params: monitorParams},
+		}
+		binding.Labels = r.repoLabels(hook.GitRepositoryURL)
+		created, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Create(&binding)
+		if err != nil {
+			RespondError(response, fmt.Errorf("error recreating monitor triggerbinding for webhook %s: %s", name, err), http.StatusInternalServerError)
+			return
+		}
+		replaceRef(&el.Spec.Triggers[monitor], monitorBroken, created.Name)
+		report.Repaired = append(report.Repaired, fmt.Sprintf("recreated monitor triggerbinding %s as %s", monitorBroken, created.Name))
+	}
+
+	if len(report.Repaired) > 0 {
+		if _, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Update(el); err != nil {
+			RespondError(response, fmt.Errorf("error updating eventlistener with the recreated triggerbindings: %s", err), http.StatusInternalServerError)
+			return
+		}
+		logging.Log.Infof("repaired webhook %s in namespace %s: %v", name, namespace, report.Repaired)
+	}
+	response.WriteEntity(report)
+}
+
+// recoverWebhook puts together what a webhook's triggers still hold: the bindings
+// that exist, the interceptor headers and the template and monitor trigger names
+func (r Resource) recoverWebhook(triggers []v1alpha1.EventListenerTrigger, hookTriggers []int, name, namespace, prefix string) webhook {
+	hook := webhook{}
+	for _, i := range hookTriggers {
+		trigger := triggers[i]
+		suffix := strings.TrimPrefix(trigger.Name, prefix)
+		recovered := r.getHookFromTrigger(trigger, suffix)
+		recovered.Health = nil
+		hook.fillFrom(recovered)
+		for _, header := range trigger.Interceptors[0].Webhook.Header {
+			switch header.Name {
+			case variableSetHeader:
+				hook.VariableSet = header.Value.StringVal
+			case "Wext-Incoming-Actions":
+				hook.RequireApproval = strings.HasPrefix(header.Value.StringVal, approvedAction)
+			}
+		}
+		overridden := trigger.Template.Name == r.overridesTemplateName(name, namespace) || r.isOverridesTemplate(trigger.Template.Name)
+		if overridden && hook.Pipeline == strings.TrimSuffix(trigger.Template.Name, "-template") {
+			// Only the webhooks-tekton-pipeline param names the pipeline of a webhook with overrides
+			hook.Pipeline = ""
+		}
+	}
+	hook.Name = name
+	hook.Namespace = namespace
+	hook.TriggerPrefix = ""
+	if prefix != name+"-"+namespace {
+		hook.TriggerPrefix = prefix
+	}
+
+	if hook.PullTask == "" {
+		hook.PullTask = webhookextPullTask
+		if _, owner, repo, err := r.getGitValues(hook.GitRepositoryURL); err == nil {
+			if found, monitorName := r.doesMonitorExist(monitorTriggerPrefix(owner, repo), hook, triggers); found {
+				for _, trigger := range triggers {
+					if trigger.Name == monitorName {
+						hook.PullTask = strings.TrimSuffix(trigger.Template.Name, "-template")
+					}
+				}
+			}
+		}
+	}
+	return hook
+}
+
+// fillFrom sets the webhook's unset values that other sets, returning the
+// values held only by a webhook's triggerbinding that are still unset
+func (hook *webhook) fillFrom(other webhook) []string {
+	fill := func(value *string, from string) {
+		if *value == "" {
+			*value = from
+		}
+	}
+	fill(&hook.GitRepositoryURL, other.GitRepositoryURL)
+	fill(&hook.AccessTokenRef, other.AccessTokenRef)
+	fill(&hook.Pipeline, other.Pipeline)
+	fill(&hook.ServiceAccount, other.ServiceAccount)
+	fill(&hook.DockerRegistry, other.DockerRegistry)
+	fill(&hook.HelmSecret, other.HelmSecret)
+	fill(&hook.ReleaseName, other.ReleaseName)
+	fill(&hook.PullTask, other.PullTask)
+	fill(&hook.VariableSet, other.VariableSet)
+	fill(&hook.ExpiresAt, other.ExpiresAt)
+	fill(&hook.Owner, other.Owner)
+	fill(&hook.CostCenter, other.CostCenter)
+	fill(&hook.DeadLetterURL, other.DeadLetterURL)
+	fill(&hook.CallbackURL, other.CallbackURL)
+	if hook.RetryPolicy.MaxRetries == 0 {
+		hook.RetryPolicy = other.RetryPolicy
+	}
+	if hook.Overrides == nil {
+		hook.Overrides = other.Overrides
+	}
+	if hook.Senders == nil {
+		hook.Senders = other.Senders
+	}
+	if hook.Canary == nil {
+		hook.Canary = other.Canary
+	}
+	if hook.DependencyRoute == nil {
+		hook.DependencyRoute = other.DependencyRoute
+	}
+	if len(hook.LabelRoutes) == 0 {
+		hook.LabelRoutes = other.LabelRoutes
+	}
+	if len(hook.FileRules) == 0 {
+		hook.FileRules = other.FileRules
+	}
+	if hook.Preview == nil {
+		hook.Preview = other.Preview
+	}
+	if hook.OnClosePipeline == "" {
+		hook.OnClosePipeline = other.OnClosePipeline
+	}
+	if hook.MainPipeline == "" {
+		hook.MainPipeline = other.MainPipeline
+	}
+	if hook.DefaultBranch == "" {
+		hook.DefaultBranch = other.DefaultBranch
+	}
+	if hook.FollowUps == nil {
+		hook.FollowUps = other.FollowUps
+	}
+	if hook.Interceptors == nil {
+		hook.Interceptors = other.Interceptors
+	}
+	hook.RequireApproval = hook.RequireApproval || other.RequireApproval
+	hook.CapturePayloads = hook.CapturePayloads || other.CapturePayloads
+	hook.ShadowMode = hook.ShadowMode || other.ShadowMode
+	hook.Protected = hook.Protected || other.Protected
+	hook.AllowSecrets = hook.AllowSecrets || other.AllowSecrets
+
+	unset := []string{}
+	for field, value := range map[string]bool{
+		"serviceaccount": hook.ServiceAccount == "",
+		"dockerregistry": hook.DockerRegistry == "",
+		"helmsecret":     hook.HelmSecret == "",
+		"releasename":    hook.ReleaseName == "",
+		"retrypolicy":    hook.RetryPolicy.MaxRetries == 0,
+	} {
+		if value {
+			unset = append(unset, field)
+		}
+	}
+	sort.Strings(unset)
+	return unset
+}
+
+func (r Resource) bindingExists(name string) bool {
+	_, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(r.Defaults.Namespace).Get(name, metav1.GetOptions{})
+	return err == nil
+}
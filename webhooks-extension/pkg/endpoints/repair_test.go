@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func setupBrokenWebhook(t *testing.T, r *Resource, hook webhook, deleted ...string) {
+	createTriggerResources(hook, r)
+	r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Create(&v1alpha1.TriggerBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "monitor-task-github-binding"},
+	})
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	for _, name := range deleted {
+		if err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Delete(name, &metav1.DeleteOptions{}); err != nil {
+			t.Fatalf("error deleting triggerbinding %s: %s", name, err)
+		}
+	}
+}
+
+func repairWebhook(r *Resource, name string, supplied *webhook) (int, repairReport) {
+	body := &bytes.Buffer{}
+	if supplied != nil {
+		json.NewEncoder(body).Encode(supplied)
+	}
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/"+name+"/repair?namespace="+installNs, body)
+	req := dummyRestfulRequest(httpReq, name)
+	httpWriter := httptest.NewRecorder()
+	resp := dummyRestfulResponse(httpWriter)
+	r.repairWebhook(req, resp)
+	report := repairReport{}
+	json.NewDecoder(httpWriter.Body).Decode(&report)
+	return resp.StatusCode(), report
+}
+
+func TestRepairWebhook(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "broken",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+		ServiceAccount:   "builder",
+		ReleaseName:      "release1",
+	}
+	setupBrokenWebhook(t, r, hook, "wext-broken-", "wext-monitor-task-github-binding-")
+
+	status, report := repairWebhook(r, "broken", &webhook{ServiceAccount: "builder"})
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, status, report)
+	}
+	if len(report.Repaired) != 2 {
+		t.Errorf("expected the webhook and monitor triggerbindings to be repaired, got %v", report.Repaired)
+	}
+	expectedDefaulted := []string{"dockerregistry", "helmsecret", "releasename", "retrypolicy"}
+	if !reflect.DeepEqual(report.Defaulted, expectedDefaulted) {
+		t.Errorf("expected defaulted %v, got %v", expectedDefaulted, report.Defaulted)
+	}
+
+	binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("wext-broken-", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("triggerbinding wext-broken- was not recreated: %s", err)
+	}
+	params := map[string]string{}
+	for _, param := range binding.Spec.Params {
+		params[param.Name] = param.Value
+	}
+	if params["webhooks-tekton-service-account"] != "builder" || params["webhooks-tekton-target-namespace"] != installNs {
+		t.Errorf("unexpected params on the recreated triggerbinding: %v", params)
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("wext-monitor-task-github-binding-", metav1.GetOptions{}); err != nil {
+		t.Errorf("monitor triggerbinding was not recreated: %s", err)
+	}
+
+	hooks, err := r.getHooksForRepo(hook.GitRepositoryURL)
+	if err != nil || len(hooks) != 1 || hooks[0].Name != "broken" {
+		t.Errorf("expected the repaired webhook to be listed, got %+v, %v", hooks, err)
+	}
+}
+
+func TestRepairWebhookMissingPipelineBinding(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "broken",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline1",
+	}
+	setupBrokenWebhook(t, r, hook, "wext-broken-", "pipeline1-push-binding")
+
+	status, report := repairWebhook(r, "broken", nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, status)
+	}
+	expected := []string{"triggerbinding pipeline1-push-binding, recreate it from the pipeline's definitions"}
+	if !reflect.DeepEqual(report.Missing, expected) {
+		t.Errorf("expected missing %v, got %v", expected, report.Missing)
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("wext-broken-", metav1.GetOptions{}); err == nil {
+		t.Error("triggerbinding wext-broken- was recreated although the webhook can't be repaired")
+	}
+}
+
+func TestRepairWebhookNotFound(t *testing.T) {
+	r := dummyResource()
+	status, _ := repairWebhook(r, "missing", nil)
+	if status != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, status)
+	}
+}
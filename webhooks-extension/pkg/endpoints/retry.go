@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Retry policies are applied by the monitor task (base/400-monitor-task.yaml)
+when it sees a PipelineRun fail. The monitor is shared by all webhooks on a
+repository so the policy of each webhook is passed to it, keyed by
+<namespace>/<pipeline>, in the retrypolicies param of the monitor's binding.
+---------------------------------------*/
+
+const (
+	// Set by the monitor on a failed PipelineRun it has rerun
+	retriedAnnotation = "webhooks.tekton.dev/retried"
+	// Set by the monitor on a rerun, naming the PipelineRun that first failed
+	retryOfAnnotation = "webhooks.tekton.dev/retryOf"
+	// Set by the monitor on a rerun, counting from 1
+	retryAttemptAnnotation = "webhooks.tekton.dev/retryAttempt"
+	// Most reruns a webhook may ask for
+	maxRetryLimit = 5
+)
+
+// retryPolicy controls automatic reruns of a webhook's failed PipelineRuns
+type retryPolicy struct {
+	MaxRetries int `json:"maxretries"`
+	// Comma separated Succeeded condition reasons to retry on, any failure when empty
+	Reasons string `json:"reasons,omitempty"`
+}
+
+func validateRetryPolicy(policy retryPolicy) error {
+	if policy.MaxRetries < 0 || policy.MaxRetries > maxRetryLimit {
+		return fmt.Errorf("retrypolicy maxretries must be between 0 and %d", maxRetryLimit)
+	}
+	return nil
+}
+
+// retryParams are the binding params recording a webhook's retry policy
+func retryParams(policy retryPolicy) []v1alpha1.Param {
+	if policy.MaxRetries == 0 {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{
+		{Name: "webhooks-tekton-retry-max", Value: strconv.Itoa(policy.MaxRetries)},
+		{Name: "webhooks-tekton-retry-reasons", Value: policy.Reasons},
+	}
+}
+
+// syncMonitorRetryPolicies sets the retrypolicies param of the repository's monitor binding
+// from the retry policies of all the webhooks on the repository
+func (r Resource) syncMonitorRetryPolicies(repoURL, monitorTriggerNamePrefix string) error {
+	hooks, err := r.getHooksForRepo(repoURL)
+	if err != nil {
+		return err
+	}
+	policies := make(map[string]retryPolicy)
+	for _, hook := range hooks {
+		if hook.RetryPolicy.MaxRetries > 0 {
+			policies[hook.Namespace+"/"+hook.Pipeline] = hook.RetryPolicy
+		}
+	}
+	policiesJSON, err := json.Marshal(policies)
+	if err != nil {
+		return err
+	}
+	return r.setMonitorBindingParam(repoURL, monitorTriggerNamePrefix, "retrypolicies", string(policiesJSON))
+}
+
+// setMonitorBindingParam sets a param of the repository's monitor binding, doing nothing if the
+// repository has no monitor
+func (r Resource) setMonitorBindingParam(repoURL, monitorTriggerNamePrefix, name, value string) error {
+	installNs := r.Defaults.Namespace
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	exists, monitorName := r.doesMonitorExist(monitorTriggerNamePrefix, webhook{GitRepositoryURL: repoURL}, el.Spec.Triggers)
+	if !exists {
+		return nil
+	}
+
+	bindingName := ""
+	for _, trigger := range el.Spec.Triggers {
+		if trigger.Name == monitorName && len(trigger.Bindings) > 1 {
+			bindingName = trigger.Bindings[1].Ref
+		}
+	}
+	if bindingName == "" {
+		return fmt.Errorf("no params binding found on monitor trigger %s", monitorName)
+	}
+
+	return r.setBindingParam(bindingName, name, value)
+}
+
+// setBindingParam sets, replacing any it has, a param on one of the extension's triggerbindings
+func (r Resource) setBindingParam(bindingName, name, value string) error {
+	installNs := r.Defaults.Namespace
+	binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(bindingName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	params := []v1alpha1.Param{}
+	for _, param := range binding.Spec.Params {
+		if param.Name != name {
+			params = append(params, param)
+		}
+	}
+	binding.Spec.Params = append(params, v1alpha1.Param{Name: name, Value: value})
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Update(binding); err != nil {
+		return err
+	}
+	logging.Log.Debugf("binding %s param %s set to %s", bindingName, name, value)
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateRetryPolicy(t *testing.T) {
+	valid := []retryPolicy{{}, {MaxRetries: 1}, {MaxRetries: maxRetryLimit, Reasons: "Failed"}}
+	for _, policy := range valid {
+		if err := validateRetryPolicy(policy); err != nil {
+			t.Errorf("policy %+v was invalid: %s", policy, err.Error())
+		}
+	}
+	invalid := []retryPolicy{{MaxRetries: -1}, {MaxRetries: maxRetryLimit + 1}}
+	for _, policy := range invalid {
+		if err := validateRetryPolicy(policy); err == nil {
+			t.Errorf("policy %+v was valid, expected an error", policy)
+		}
+	}
+}
+
+func TestSyncMonitorRetryPolicies(t *testing.T) {
+	r := dummyResource()
+	installNs := r.Defaults.Namespace
+	repoURL := "https://github.com/owner/repo"
+
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        "foo",
+		GitRepositoryURL: repoURL,
+		Pipeline:         "pipeline",
+		RetryPolicy:      retryPolicy{MaxRetries: 2, Reasons: "PipelineRunTimeout"},
+	}
+	hookParams, _, err := r.getParams(hook)
+	if err != nil {
+		t.Fatalf("getParams: %s", err)
+	}
+	bindings := []v1alpha1.TriggerBinding{
+		{ObjectMeta: metav1.ObjectMeta{Name: "hook-binding"}, Spec: v1alpha1.TriggerBindingSpec{Params: hookParams}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pipeline-pullrequest-binding"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "monitor-params"}, Spec: v1alpha1.TriggerBindingSpec{
+			Params: []v1alpha1.Param{{Name: "commentsuccess", Value: "Success"}, {Name: "retrypolicies", Value: "{}"}},
+		}},
+	}
+	for _, binding := range bindings {
+		if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Create(&binding); err != nil {
+			t.Fatalf("error creating binding: %s", err.Error())
+		}
+	}
+	el := v1alpha1.EventListener{
+		ObjectMeta: metav1.ObjectMeta{Name: r.eventListenerName(), Namespace: installNs},
+		Spec: v1alpha1.EventListenerSpec{
+			Triggers: []v1alpha1.EventListenerTrigger{
+				r.newTrigger("hook-foo-pullrequest-event", "pipeline-pullrequest-binding", "pipeline-template", repoURL, "pull_request", "secret", "hook-binding"),
+				r.newTrigger("owner.repo-1234", "monitor-task-github-binding", "monitor-task-template", repoURL, "pull_request", "secret", "monitor-params"),
+			},
+		},
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Create(&el); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err.Error())
+	}
+
+	if err := r.syncMonitorRetryPolicies(repoURL, "owner.repo-"); err != nil {
+		t.Fatalf("error syncing retry policies: %s", err.Error())
+	}
+
+	binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("monitor-params", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting monitor binding: %s", err.Error())
+	}
+	expected := []v1alpha1.Param{
+		{Name: "commentsuccess", Value: "Success"},
+		{Name: "retrypolicies", Value: `{"foo/pipeline":{"maxretries":2,"reasons":"PipelineRunTimeout"}}`},
+	}
+	if len(binding.Spec.Params) != len(expected) {
+		t.Fatalf("monitor binding params were %+v, expected %+v", binding.Spec.Params, expected)
+	}
+	for i := range expected {
+		if binding.Spec.Params[i] != expected[i] {
+			t.Errorf("monitor binding param was %+v, expected %+v", binding.Spec.Params[i], expected[i])
+		}
+	}
+}
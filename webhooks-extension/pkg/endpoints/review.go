@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Pull request triggers run on these actions, matched by the interceptor
+against the action of the incoming event. Besides the pull request being
+opened or updated, a comment command (e.g. /retest) on a GitLab merge
+request or Bitbucket pull request is reported as the comment action, and a
+GitLab merge request gaining its required approvals or a Bitbucket pull
+request being approved as the approved action. A webhook that
+requires approval runs on approval and comment commands only, and the
+interceptor only lets either through once the pull request has the
+approvals the provider requires to merge it. Comment commands are only
+taken from those with write access to the repository.
+---------------------------------------*/
+
+const (
+	pushEvents        = "push, Push Hook, Tag Push Hook, repo:push"
+	pullRequestEvents = "pull_request, Merge Request Hook, Note Hook, pullrequest:created, pullrequest:updated, pullrequest:approved, pullrequest:fulfilled, pullrequest:rejected, pullrequest:comment_created"
+	openedActions     = "opened,reopened,synchronize"
+	commentAction     = "comment"
+	approvedAction    = "approved"
+)
+
+// pullRequestActions is the interceptor header holding the actions a webhook's pull request trigger runs on
+func pullRequestActions(webhook webhook) pipelinesv1alpha1.Param {
+	wanted := openedActions + "," + commentAction
+	if webhook.RequireApproval {
+		wanted = approvedAction + "," + commentAction
+	}
+	return pipelinesv1alpha1.Param{Name: "Wext-Incoming-Actions", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: wanted}}
+}
+
+// approvalParams are the binding params recording that a webhook requires approval
+func approvalParams(webhook webhook) []v1alpha1.Param {
+	if !webhook.RequireApproval {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: "webhooks-tekton-require-approval", Value: "true"}}
+}
+
+// monitorActions returns the actions the monitor of a repository runs on, those of any of its
+// webhooks, so that the monitor doesn't report missing PipelineRuns for events no webhook runs on
+func monitorActions(hooks []webhook) pipelinesv1alpha1.Param {
+	opened, approved := len(hooks) == 0, false
+	for _, hook := range hooks {
+		if hook.RequireApproval {
+			approved = true
+		} else {
+			opened = true
+		}
+	}
+	wanted := []string{}
+	if opened {
+		wanted = append(wanted, openedActions)
+	}
+	if approved {
+		wanted = append(wanted, approvedAction)
+	}
+	wanted = append(wanted, commentAction)
+	return pipelinesv1alpha1.Param{Name: "Wext-Incoming-Actions", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: strings.Join(wanted, ",")}}
+}
+
+// syncMonitorActions sets the actions and sender filters of the repository's monitor trigger from the webhooks on
+// the repository
+func (r Resource) syncMonitorActions(repoURL, monitorTriggerNamePrefix string) error {
+	installNs := r.Defaults.Namespace
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	exists, monitorName := r.doesMonitorExist(monitorTriggerNamePrefix, webhook{GitRepositoryURL: repoURL}, el.Spec.Triggers)
+	if !exists {
+		return nil
+	}
+	hooks, err := r.getHooksForRepo(repoURL)
+	if err != nil {
+		return err
+	}
+	actions := monitorActions(hooks)
+	wanted := append([]pipelinesv1alpha1.Param{actions}, monitorSenderHeaders(hooks)...)
+
+	for i, trigger := range el.Spec.Triggers {
+		if trigger.Name != monitorName {
+			continue
+		}
+		headers := []pipelinesv1alpha1.Param{}
+		for _, header := range trigger.Interceptors[0].Webhook.Header {
+			switch header.Name {
+			case actions.Name, allowedSendersHeader, deniedSendersHeader:
+				continue
+			}
+			headers = append(headers, header)
+		}
+		headers = append(headers, wanted...)
+		if reflect.DeepEqual(headers, trigger.Interceptors[0].Webhook.Header) {
+			return nil
+		}
+		el.Spec.Triggers[i].Interceptors[0].Webhook.Header = headers
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Update(el); err != nil {
+		return err
+	}
+	logging.Log.Debugf("monitor trigger %s actions set to %s", monitorName, actions.Value.StringVal)
+	return nil
+}
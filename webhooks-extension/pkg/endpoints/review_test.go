@@ -0,0 +1,44 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+)
+
+func TestPullRequestActions(t *testing.T) {
+	if actions := pullRequestActions(webhook{}).Value.StringVal; actions != "opened,reopened,synchronize,comment" {
+		t.Errorf("actions were %s, expected opened,reopened,synchronize,comment", actions)
+	}
+	if actions := pullRequestActions(webhook{RequireApproval: true}).Value.StringVal; actions != "approved,comment" {
+		t.Errorf("actions requiring approval were %s, expected approved,comment", actions)
+	}
+}
+
+func TestMonitorActions(t *testing.T) {
+	testcases := []struct {
+		hooks    []webhook
+		expected string
+	}{
+		{[]webhook{}, "opened,reopened,synchronize,comment"},
+		{[]webhook{{Name: "a"}}, "opened,reopened,synchronize,comment"},
+		{[]webhook{{Name: "a", RequireApproval: true}}, "approved,comment"},
+		{[]webhook{{Name: "a"}, {Name: "b", RequireApproval: true}}, "opened,reopened,synchronize,approved,comment"},
+	}
+	for _, tc := range testcases {
+		if actions := monitorActions(tc.hooks).Value.StringVal; actions != tc.expected {
+			t.Errorf("monitor actions for %+v were %s, expected %s", tc.hooks, actions, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/{name}/rollback").To(r.profiled(Resource.rollbackWebhook)))
+Restores a webhook as an earlier revision of its history (see history.go)
+left it. The webhook is deleted, keeping its provider webhook if the
+revision is on the same repository, and created again from the revision
+as POST /webhooks creates it, so the revision is validated as a new
+webhook would be. If it is refused the webhook is created again as it
+was. A deleted webhook can be rolled back too, the rollback being
+recorded by HistoryFilter as a new revision like any other change.
+---------------------------------------*/
+
+type rollbackResponse struct {
+	Revision int     `json:"revision"`
+	Webhook  webhook `json:"webhook"`
+	// Whether the webhook was already as the revision left it
+	Unchanged bool `json:"unchanged,omitempty"`
+}
+
+// POST /webhooks/{name}/rollback?namespace=<namespace>&revision=<revision>
+func (r Resource) rollbackWebhook(request *restful.Request, response *restful.Response) {
+	name, namespace, ok := webhookRef(request, response)
+	if !ok {
+		return
+	}
+	revision, err := strconv.Atoi(request.QueryParameter("revision"))
+	if err != nil {
+		err := errors.New("bad request information provided, a revision number must be specified as a query parameter")
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+	revisions, err := r.getRevisions(namespace, name)
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	var target *webhookRevision
+	for i := range revisions {
+		if revisions[i].Revision == revision {
+			target = &revisions[i]
+		}
+	}
+	if target == nil {
+		err := fmt.Errorf("revision %d of webhook %s in namespace %s is not kept", revision, name, namespace)
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusNotFound)
+		return
+	}
+	if target.Webhook == nil {
+		err := fmt.Errorf("revision %d deleted webhook %s in namespace %s, roll back to an earlier revision", revision, name, namespace)
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	restored := *target.Webhook
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	var current *webhook
+	for i := range hooks {
+		if hooks[i].Name == name && hooks[i].Namespace == namespace {
+			current = &hooks[i]
+		}
+	}
+	if current != nil && reflect.DeepEqual(*current, restored) {
+		response.WriteEntity(rollbackResponse{Revision: revision, Webhook: restored, Unchanged: true})
+		return
+	}
+
+	if current != nil {
+		onRepo, err := r.getHooksForRepo(current.GitRepositoryURL)
+		if err != nil {
+			logging.Log.Errorf("error: %s", err)
+			RespondError(response, err, http.StatusInternalServerError)
+			return
+		}
+		hooksOnRepo := len(onRepo)
+		if canonicalRepoURL(current.GitRepositoryURL) == canonicalRepoURL(restored.GitRepositoryURL) {
+			// Keeping the provider webhook, which the restored webhook goes on using
+			hooksOnRepo++
+		}
+		if err := r.removeHook(*current, hooksOnRepo, false); err != nil {
+			logging.Log.Errorf("error removing webhook %s in namespace %s to roll it back: %s", name, namespace, err)
+			RespondError(response, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	if status, err := r.createInternally(request, restored); err != nil {
+		logging.Log.Errorf("error rolling back webhook %s in namespace %s to revision %d: %s", name, namespace, revision, err)
+		if current != nil {
+			if _, restoreErr := r.createInternally(request, *current); restoreErr != nil {
+				logging.Log.Errorf("error restoring webhook %s in namespace %s after a failed rollback: %s", name, namespace, restoreErr)
+				err = fmt.Errorf("%s, and the webhook could not be restored: %s", err, restoreErr)
+			}
+		}
+		RespondError(response, fmt.Errorf("revision %d can't be restored: %s", revision, err), status)
+		return
+	}
+	logging.Log.Infof("rolled back webhook %s in namespace %s to revision %d", name, namespace, revision)
+	response.WriteEntity(rollbackResponse{Revision: revision, Webhook: restored})
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	restful "github.com/emicklei/go-restful"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRollbackWebhook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("GIT_PROVIDER_MODE", "replay")
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", dir)
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+
+	r := dummyResource()
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	createTriggerResources(hook, r)
+	createTriggerResources(webhook{Pipeline: "pipeline2", AccessTokenRef: "token1"}, r)
+
+	container := restful.NewContainer()
+	container.Filter(r.HistoryFilter)
+	ws := new(restful.WebService)
+	ws.Path("/webhooks").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	ws.Route(ws.POST("/").To(r.createWebhook))
+	ws.Route(ws.DELETE("/{name}").To(r.deleteWebhook))
+	ws.Route(ws.POST("/{name}/rollback").To(r.rollbackWebhook))
+	container.Add(ws)
+	serve := func(method, path string, body interface{}) (int, rollbackResponse) {
+		var b []byte
+		if body != nil {
+			b, _ = json.Marshal(body)
+		}
+		httpReq := dummyHTTPRequest(method, "http://wwww.dummy.com:8383"+path, bytes.NewBuffer(b))
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		result := rollbackResponse{}
+		json.NewDecoder(httpWriter.Body).Decode(&result)
+		return httpWriter.Code, result
+	}
+	pipelineOf := func() string {
+		hooks, _ := r.getWebhooksFromEventListener()
+		if len(hooks) != 1 {
+			return ""
+		}
+		return hooks[0].Pipeline
+	}
+
+	// Revisions 1 created with pipeline1, 2 deleted and 3 created with pipeline2
+	if status, _ := serve("POST", "/webhooks/", hook); status != http.StatusCreated {
+		t.Fatalf("creating the webhook returned %d", status)
+	}
+	if status, _ := serve("DELETE", "/webhooks/hook?namespace="+installNs+"&repository="+hook.GitRepositoryURL, nil); status != http.StatusNoContent {
+		t.Fatalf("deleting the webhook returned %d", status)
+	}
+	hook.Pipeline = "pipeline2"
+	if status, _ := serve("POST", "/webhooks/", hook); status != http.StatusCreated {
+		t.Fatalf("creating the webhook again returned %d", status)
+	}
+
+	status, result := serve("POST", "/webhooks/hook/rollback?namespace="+installNs+"&revision=1", nil)
+	if status != http.StatusOK || result.Webhook.Pipeline != "pipeline1" || pipelineOf() != "pipeline1" {
+		t.Errorf("expected the webhook to run pipeline1 again, got %d, %+v, %s", status, result, pipelineOf())
+	}
+	revisions, _ := r.getRevisions(installNs, "hook")
+	if len(revisions) != 4 || revisions[3].Action != "changed" || revisions[3].Request != "POST /webhooks/hook/rollback" {
+		t.Errorf("expected the rollback to be recorded as revision 4, got %+v", revisions)
+	}
+	if status, result := serve("POST", "/webhooks/hook/rollback?namespace="+installNs+"&revision=1", nil); status != http.StatusOK || !result.Unchanged {
+		t.Errorf("expected rolling back to the current settings to change nothing, got %d, %+v", status, result)
+	}
+
+	// Revision 3 can't be restored without pipeline2's triggertemplate, the webhook is kept as it was
+	r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Delete("pipeline2-template", &metav1.DeleteOptions{})
+	if status, _ := serve("POST", "/webhooks/hook/rollback?namespace="+installNs+"&revision=3", nil); status != http.StatusBadRequest || pipelineOf() != "pipeline1" {
+		t.Errorf("expected an invalid revision to be refused, keeping pipeline1, got %d, %s", status, pipelineOf())
+	}
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"namespace=" + installNs + "&revision=2", http.StatusBadRequest},
+		{"namespace=" + installNs + "&revision=9", http.StatusNotFound},
+		{"namespace=" + installNs, http.StatusBadRequest},
+		{"revision=1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status, _ := serve("POST", "/webhooks/hook/rollback?"+tt.query, nil); status != tt.status {
+			t.Errorf("rolling back with %s: expected %d, got %d", tt.query, tt.status, status)
+		}
+	}
+}
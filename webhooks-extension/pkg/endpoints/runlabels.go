@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"strings"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Deleting a webhook's PipelineRuns, its stats and activity, follow-ups and
+dead letters find the webhook's PipelineRuns by the gitServer, gitOrg and
+gitRepo labels, which the pipeline's TriggerTemplate may not set (see
+docs/Labels.md). So every runLabelCheckInterval the extension looks for
+PipelineRuns created by its eventlistener that are missing any of them and
+sets them from the webhook whose trigger created the run, named by the
+label Tekton Triggers adds. Labels a template sets are left as they are.
+Templates generated for a webhook's overrides set them too, see
+pullrequest.go.
+---------------------------------------*/
+
+const (
+	// Set by Tekton Triggers on the resources an eventlistener creates
+	eventListenerLabel = "triggers.tekton.dev/eventlistener"
+	triggerLabel       = "triggers.tekton.dev/trigger"
+
+	runLabelCheckInterval = 30 * time.Second
+)
+
+// webhookTriggerSuffixes end the names of a webhook's triggers after its trigger prefix, see triggernames.go
+var webhookTriggerSuffixes = append([]string{"-push-event", "-pullrequest-event", "-push-canary", "-pullrequest-canary", dependencyTriggerSuffix, previewTeardownSuffix, closeTriggerSuffix, mainBranchTriggerSuffix},
+	append(labelTriggerSuffixes(), fileTriggerSuffixes()...)...)
+
+// webhookTriggerNames are the names of the triggers a webhook may have, given its trigger prefix
+func webhookTriggerNames(triggerPrefix string) []string {
+	names := []string{}
+	for _, suffix := range webhookTriggerSuffixes {
+		names = append(names, triggerPrefix+suffix)
+	}
+	return names
+}
+
+// LabelPipelineRuns sets the missing repository labels of webhooks' PipelineRuns until stopCh is closed
+func (r Resource) LabelPipelineRuns(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(runLabelCheckInterval)
+	defer ticker.Stop()
+	for {
+		for _, profiled := range r.allProfiles() {
+			profiled.labelPipelineRuns()
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// labelPipelineRuns sets the missing repository labels of the PipelineRuns in webhooks' namespaces
+// created by the eventlistener
+func (r Resource) labelPipelineRuns() {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error getting webhooks to label PipelineRuns: %s", err)
+		return
+	}
+	listed := map[string]bool{}
+	for _, hook := range hooks {
+		if listed[hook.Namespace] {
+			continue
+		}
+		listed[hook.Namespace] = true
+		pipelineRuns, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).List(metav1.ListOptions{
+			LabelSelector: eventListenerLabel + "=" + r.eventListenerName(),
+		})
+		if err != nil {
+			logging.Log.Errorf("error listing PipelineRuns in namespace %s to label: %s", hook.Namespace, err)
+			continue
+		}
+		for i := range pipelineRuns.Items {
+			pipelineRun := &pipelineRuns.Items[i]
+			labelled := addMissingLabels(pipelineRun, r.triggerRepositoryLabels(hooks, pipelineRun.Labels[triggerLabel]))
+			if !markShadowRun(pipelineRun, hooks) && !labelled {
+				continue
+			}
+			if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).Update(pipelineRun); err != nil {
+				logging.Log.Errorf("error labelling PipelineRun %s in namespace %s: %s", pipelineRun.Name, hook.Namespace, err)
+			}
+		}
+	}
+}
+
+// triggerRepositoryLabels returns the repository labels of the webhook the named trigger belongs to,
+// nil if it isn't one of a webhook's triggers
+func (r Resource) triggerRepositoryLabels(hooks []webhook, trigger string) map[string]string {
+	for _, hook := range hooks {
+		for _, suffix := range webhookTriggerSuffixes {
+			if trigger != triggerPrefix(hook)+suffix {
+				continue
+			}
+			server, org, repo, err := r.getGitValues(hook.GitRepositoryURL)
+			if err != nil {
+				return nil
+			}
+			server = strings.TrimPrefix(server, "https://")
+			server = strings.TrimPrefix(server, "http://")
+			return map[string]string{
+				"webhooks.tekton.dev/gitServer": server,
+				"webhooks.tekton.dev/gitOrg":    org,
+				"webhooks.tekton.dev/gitRepo":   repo,
+			}
+		}
+	}
+	return nil
+}
+
+// addMissingLabels adds the labels the PipelineRun doesn't have, returning whether it added any
+func addMissingLabels(pipelineRun *pipelinesv1alpha1.PipelineRun, labels map[string]string) bool {
+	added := false
+	for key, value := range labels {
+		if _, found := pipelineRun.Labels[key]; found {
+			continue
+		}
+		if pipelineRun.Labels == nil {
+			pipelineRun.Labels = map[string]string{}
+		}
+		pipelineRun.Labels[key] = value
+		added = true
+	}
+	return added
+}
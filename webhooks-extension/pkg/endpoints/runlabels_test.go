@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLabelPipelineRuns(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/Owner/Repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	create := func(name, trigger string, labels map[string]string) {
+		pipelineRun := pipelinesv1alpha1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: installNs, Labels: labels}}
+		pipelineRun.Labels[eventListenerLabel] = r.eventListenerName()
+		pipelineRun.Labels[triggerLabel] = trigger
+		if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Create(&pipelineRun); err != nil {
+			t.Fatalf("error creating pipelinerun %s: %s", name, err)
+		}
+	}
+	create("unlabelled", "hook-"+installNs+"-pullrequest-event", map[string]string{})
+	create("labelled", "hook-"+installNs+"-push-event", map[string]string{"webhooks.tekton.dev/gitRepo": "custom"})
+	create("other", "owner.repo-"+installNs+"-monitor", map[string]string{})
+
+	r.labelPipelineRuns()
+
+	get := func(name string) map[string]string {
+		pipelineRun, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("error getting pipelinerun %s: %s", name, err)
+		}
+		return pipelineRun.Labels
+	}
+	if labels := get("unlabelled"); labels["webhooks.tekton.dev/gitServer"] != "github.com" ||
+		labels["webhooks.tekton.dev/gitOrg"] != "owner" || labels["webhooks.tekton.dev/gitRepo"] != "repo" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+	if labels := get("labelled"); labels["webhooks.tekton.dev/gitRepo"] != "custom" || labels["webhooks.tekton.dev/gitOrg"] != "owner" {
+		t.Errorf("expected the template's label to be kept and the missing ones added, got %v", labels)
+	}
+	if labels := get("other"); labels["webhooks.tekton.dev/gitRepo"] != "" {
+		t.Errorf("expected a PipelineRun of another trigger to be left alone, got %v", labels)
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/search").To(r.profiled(Resource.search)))
+Answers "what in this cluster touches repository X?". The query is matched,
+ignoring case, against the name, namespace, repository and pipeline of each
+webhook, the repository and commit of each delivery held in the delivery
+buffer (see delivery.go, deliveries are only held until forwarded) and the
+name, repository and gitrevision param of each PipelineRun of a webhook.
+At most maxSearchResults results are returned.
+---------------------------------------*/
+
+const maxSearchResults = 200
+
+type searchResult struct {
+	// webhook, delivery or pipelinerun
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Pipeline   string `json:"pipeline,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	// The fields the query matched
+	Matched []string `json:"matched"`
+}
+
+type searchResponse struct {
+	Query     string         `json:"query"`
+	Results   []searchResult `json:"results"`
+	Truncated bool           `json:"truncated,omitempty"`
+}
+
+// GET /webhooks/search?q=x
+func (r Resource) search(request *restful.Request, response *restful.Response) {
+	query := strings.TrimSpace(request.QueryParameter("q"))
+	if query == "" {
+		RespondError(response, errors.New("q query parameter is required"), http.StatusBadRequest)
+		return
+	}
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+
+	results := searchWebhooks(hooks, query)
+	results = append(results, r.searchDeliveries(query)...)
+	results = append(results, r.searchPipelineRuns(hooks, query)...)
+	result := searchResponse{Query: query, Results: results}
+	if len(results) > maxSearchResults {
+		result.Results = results[:maxSearchResults]
+		result.Truncated = true
+	}
+	response.WriteEntity(result)
+}
+
+// matchFields returns the names of the fields whose values contain query, ignoring case
+func matchFields(query string, fields ...string) []string {
+	query = strings.ToLower(query)
+	matched := []string{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] != "" && strings.Contains(strings.ToLower(fields[i+1]), query) {
+			matched = append(matched, fields[i])
+		}
+	}
+	return matched
+}
+
+func searchWebhooks(hooks []webhook, query string) []searchResult {
+	results := []searchResult{}
+	for _, hook := range hooks {
+		matched := matchFields(query, "name", hook.Name, "namespace", hook.Namespace, "repository", hook.GitRepositoryURL, "pipeline", hook.Pipeline)
+		if len(matched) == 0 {
+			continue
+		}
+		results = append(results, searchResult{
+			Type:       "webhook",
+			Name:       hook.Name,
+			Namespace:  hook.Namespace,
+			Repository: hook.GitRepositoryURL,
+			Pipeline:   hook.Pipeline,
+			Matched:    matched,
+		})
+	}
+	return results
+}
+
+func (r Resource) searchDeliveries(query string) []searchResult {
+	results := []searchResult{}
+	if !r.Defaults.DeliveryBuffer {
+		return results
+	}
+	deliveryBufferLock.Lock()
+	deliveries, _, err := r.loadDeliveryBuffer()
+	deliveryBufferLock.Unlock()
+	if err != nil {
+		logging.Log.Errorf("error loading buffered deliveries to search: %s", err)
+		return results
+	}
+	for id, delivery := range deliveries {
+		repo, commit := deliveryRepoAndCommit(delivery.Body)
+		matched := matchFields(query, "id", id, "repository", repo, "commit", commit)
+		if len(matched) == 0 {
+			continue
+		}
+		results = append(results, searchResult{Type: "delivery", Name: id, Repository: repo, Commit: commit, Matched: matched})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// deliveryRepoAndCommit reads the repository and commit from a GitHub or GitLab push or pull/merge request payload
+func deliveryRepoAndCommit(body []byte) (string, string) {
+	payload := struct {
+		After       string `json:"after"`
+		CheckoutSHA string `json:"checkout_sha"`
+		PullRequest struct {
+			Head struct {
+				SHA string `json:"sha"`
+			} `json:"head"`
+		} `json:"pull_request"`
+		ObjectAttributes struct {
+			LastCommit struct {
+				ID string `json:"id"`
+			} `json:"last_commit"`
+		} `json:"object_attributes"`
+		Repository struct {
+			HTMLURL string `json:"html_url"`
+		} `json:"repository"`
+		Project struct {
+			WebURL string `json:"web_url"`
+		} `json:"project"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", ""
+	}
+	repo := payload.Repository.HTMLURL
+	if repo == "" {
+		repo = payload.Project.WebURL
+	}
+	for _, commit := range []string{payload.PullRequest.Head.SHA, payload.ObjectAttributes.LastCommit.ID, payload.CheckoutSHA, payload.After} {
+		if commit != "" {
+			return repo, commit
+		}
+	}
+	return repo, ""
+}
+
+func (r Resource) searchPipelineRuns(hooks []webhook, query string) []searchResult {
+	results := []searchResult{}
+	namespaces := map[string]bool{}
+	for _, hook := range hooks {
+		if namespaces[hook.Namespace] {
+			continue
+		}
+		namespaces[hook.Namespace] = true
+		pipelineRuns, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			logging.Log.Errorf("error listing PipelineRuns in namespace %s to search: %s", hook.Namespace, err)
+			continue
+		}
+		for _, pipelineRun := range pipelineRuns.Items {
+			owner := ""
+			for _, other := range hooks {
+				if other.Namespace == hook.Namespace && isWebhookPipelineRun(pipelineRun, other.GitRepositoryURL, other.Pipeline) {
+					owner = other.GitRepositoryURL
+				}
+			}
+			if owner == "" {
+				continue
+			}
+			commit := pipelineRunRevision(pipelineRun)
+			matched := matchFields(query, "name", pipelineRun.Name, "repository", owner, "pipeline", pipelineRun.Spec.PipelineRef.Name, "commit", commit)
+			if len(matched) == 0 {
+				continue
+			}
+			results = append(results, searchResult{
+				Type:       "pipelinerun",
+				Name:       pipelineRun.Name,
+				Namespace:  pipelineRun.Namespace,
+				Repository: owner,
+				Pipeline:   pipelineRun.Spec.PipelineRef.Name,
+				Commit:     commit,
+				Matched:    matched,
+			})
+		}
+	}
+	return results
+}
+
+// pipelineRunRevision is the gitrevision param of a PipelineRun, see docs/Parameters.md
+func pipelineRunRevision(pipelineRun pipelinesv1alpha1.PipelineRun) string {
+	for _, param := range pipelineRun.Spec.Params {
+		if param.Name == "gitrevision" {
+			return param.Value.StringVal
+		}
+	}
+	return ""
+}
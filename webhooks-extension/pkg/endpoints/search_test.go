@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDeliveryRepoAndCommit(t *testing.T) {
+	tests := []struct {
+		body, repo, commit string
+	}{
+		{`{"after": "abc123", "repository": {"html_url": "https://github.com/owner/repo"}}`, "https://github.com/owner/repo", "abc123"},
+		{`{"pull_request": {"head": {"sha": "def456"}}, "repository": {"html_url": "https://github.com/owner/repo"}}`, "https://github.com/owner/repo", "def456"},
+		{`{"object_attributes": {"last_commit": {"id": "789abc"}}, "project": {"web_url": "https://gitlab.com/owner/repo"}}`, "https://gitlab.com/owner/repo", "789abc"},
+		{`not json`, "", ""},
+	}
+	for _, test := range tests {
+		if repo, commit := deliveryRepoAndCommit([]byte(test.body)); repo != test.repo || commit != test.commit {
+			t.Errorf("got %s, %s from %s", repo, commit, test.body)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	run := statsPipelineRun("pipeline-run-1", corev1.ConditionTrue, 10, time.Now())
+	run.Namespace = installNs
+	run.Spec.Params = []pipelinesv1alpha1.Param{{Name: "gitrevision", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "6a8f0c2d"}}}
+	if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Create(&run); err != nil {
+		t.Fatalf("error creating pipelinerun: %s", err)
+	}
+
+	search := func(query string) (int, searchResponse) {
+		httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/search?q="+query, nil)
+		httpWriter := httptest.NewRecorder()
+		r.search(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+		result := searchResponse{}
+		json.NewDecoder(httpWriter.Body).Decode(&result)
+		return httpWriter.Code, result
+	}
+
+	if status, _ := search(""); status != http.StatusBadRequest {
+		t.Errorf("search without a query returned %d", status)
+	}
+	status, result := search("OWNER/REPO")
+	if status != http.StatusOK || len(result.Results) != 2 {
+		t.Fatalf("expected the webhook and its pipelinerun, got %d, %+v", status, result)
+	}
+	if result.Results[0].Type != "webhook" || result.Results[1].Type != "pipelinerun" || result.Results[1].Commit != "6a8f0c2d" {
+		t.Errorf("unexpected results %+v", result.Results)
+	}
+	_, result = search("6a8f")
+	if len(result.Results) != 1 || !reflect.DeepEqual(result.Results[0].Matched, []string{"commit"}) {
+		t.Errorf("expected the pipelinerun to match on its commit, got %+v", result.Results)
+	}
+	if _, result = search("elsewhere"); len(result.Results) != 0 {
+		t.Errorf("expected no results, got %+v", result.Results)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+
+	"github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+)
+
+/*--------------------------------------
+A webhook's settings are stored as params of its triggerbinding, which
+anyone who can read the install namespace can read, so a personal access
+token pasted into a comment or a release name is as good as published.
+Creating a webhook whose free-text fields (its comments, release name,
+owner, cost center, preview and dead letter URLs, labels, pipelinerun
+overrides, follow-up results and interceptors) hold something that looks
+like a credential is refused with the WEBHOOK_CREDENTIAL_FOUND message,
+naming the field and the kind of credential but not the value. A webhook
+that really means it, e.g. with a long id that happens to look like a key,
+is created with allowsecrets set, which is kept with the webhook so it
+can be cloned and repaired.
+---------------------------------------*/
+
+const allowSecretsParam = "webhooks-tekton-allow-secrets"
+
+// credentialPatterns are the kinds of credential looked for, by what they look like
+var credentialPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b|\bgithub_pat_[A-Za-z0-9_]{22,}`)},
+	{"GitLab token", regexp.MustCompile(`\bgl(pat|dt|rt|ptt)-[A-Za-z0-9_-]{20,}`)},
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"password in a URL", regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`)},
+	{"bearer token", regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{20,}`)},
+	{"assigned secret", regexp.MustCompile(`(?i)\b(token|secret|password|passwd|api[_-]?key)["']?\s*[:=]\s*["']?[^\s"'{}]{8,}`)},
+}
+
+// credentialIn returns the kind of credential value looks like it holds, empty if none
+func credentialIn(value string) string {
+	for _, credential := range credentialPatterns {
+		if credential.pattern.MatchString(value) {
+			return credential.kind
+		}
+	}
+	return ""
+}
+
+// scannedFields returns the free-text fields of webhook by name, structured ones as JSON
+func scannedFields(webhook webhook) map[string]string {
+	fields := map[string]string{
+		"onsuccesscomment": webhook.OnSuccessComment,
+		"onfailurecomment": webhook.OnFailureComment,
+		"ontimeoutcomment": webhook.OnTimeoutComment,
+		"onmissingcomment": webhook.OnMissingComment,
+		"releasename":      webhook.ReleaseName,
+		"owner":            webhook.Owner,
+		"costcenter":       webhook.CostCenter,
+		"deadletterurl":    webhook.DeadLetterURL,
+	}
+	if webhook.Preview != nil {
+		fields["preview"] = webhook.Preview.Prefix + " " + webhook.Preview.URL
+	}
+	if webhook.Canary != nil {
+		fields["canary"] = webhook.Canary.Label
+	}
+	structured := map[string]interface{}{
+		"labelroutes": webhook.LabelRoutes,
+		"followups":   webhook.FollowUps,
+	}
+	if webhook.Overrides != nil {
+		structured["pipelinerunoverrides"] = webhook.Overrides
+	}
+	if webhook.Interceptors != nil {
+		structured["interceptors"] = webhook.Interceptors
+	}
+	for name, value := range structured {
+		if data, err := json.Marshal(value); err == nil {
+			fields[name] = string(data)
+		}
+	}
+	return fields
+}
+
+// validateNoCredentials returns the WEBHOOK_CREDENTIAL_FOUND error for the first field of webhook, by name, that
+// looks like it holds a credential, unless the webhook allows them
+func validateNoCredentials(webhook webhook) error {
+	if webhook.AllowSecrets {
+		return nil
+	}
+	fields := scannedFields(webhook)
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if kind := credentialIn(fields[name]); kind != "" {
+			return newMessageError("WEBHOOK_CREDENTIAL_FOUND", map[string]string{"field": name, "kind": kind})
+		}
+	}
+	return nil
+}
+
+// allowSecretsParams are the binding params recording that a webhook allows credential-like values
+func allowSecretsParams(webhook webhook) []v1alpha1.Param {
+	if !webhook.AllowSecrets {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: allowSecretsParam, Value: "true"}}
+}
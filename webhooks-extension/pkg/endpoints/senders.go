@@ -0,0 +1,129 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+)
+
+/*--------------------------------------
+A webhook's senders restrict the events it runs on to those sent by, or
+not sent by, particular accounts, e.g. to leave out dependabot's pull
+requests or to run a pipeline on them alone. Each entry is a user name,
+bots for any bot account, team:<org>/<team slug> for the members of a
+GitHub team or group:<group path> for the members of a GitLab group. The
+lists are set on the webhook's triggers as the Wext-Allowed-Senders and
+Wext-Denied-Senders headers and checked by the interceptor against the
+sender of each event, looking up team and group members with the webhook's
+access token. The repository's monitor trigger is given the same filters
+when every webhook on the repository has them, so the monitor doesn't
+report on pull requests no webhook runs for.
+---------------------------------------*/
+
+const (
+	allowedSendersHeader = "Wext-Allowed-Senders"
+	deniedSendersHeader  = "Wext-Denied-Senders"
+	// Most entries in each of a webhook's sender lists
+	maxSenderEntries = 50
+)
+
+// senderFilter restricts the senders whose events a webhook runs on
+type senderFilter struct {
+	// Only events from these senders run, any sender's when empty
+	Allow []string `json:"allow,omitempty"`
+	// Events from these senders never run
+	Deny []string `json:"deny,omitempty"`
+}
+
+func validateSenders(senders *senderFilter) error {
+	if senders == nil {
+		return nil
+	}
+	for name, entries := range map[string][]string{"allow": senders.Allow, "deny": senders.Deny} {
+		if len(entries) > maxSenderEntries {
+			return fmt.Errorf("senders %s may have at most %d entries", name, maxSenderEntries)
+		}
+		for _, entry := range entries {
+			switch {
+			case strings.TrimSpace(entry) == "" || strings.ContainsAny(entry, ", \t\n"):
+				return fmt.Errorf("senders %s entry %q must be a user name, bots, team:<org>/<team> or group:<path>", name, entry)
+			case strings.HasPrefix(entry, "team:") && len(strings.Split(strings.TrimPrefix(entry, "team:"), "/")) != 2:
+				return fmt.Errorf("senders %s entry %q must name a team as team:<org>/<team>", name, entry)
+			case entry == "group:":
+				return fmt.Errorf("senders %s entry %q must name a group as group:<path>", name, entry)
+			}
+		}
+	}
+	return nil
+}
+
+// senderHeaders are the interceptor headers holding the sender filters
+func senderHeaders(senders *senderFilter) []pipelinesv1alpha1.Param {
+	headers := []pipelinesv1alpha1.Param{}
+	if senders == nil {
+		return headers
+	}
+	if len(senders.Allow) > 0 {
+		headers = append(headers, pipelinesv1alpha1.Param{Name: allowedSendersHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: strings.Join(senders.Allow, ",")}})
+	}
+	if len(senders.Deny) > 0 {
+		headers = append(headers, pipelinesv1alpha1.Param{Name: deniedSendersHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: strings.Join(senders.Deny, ",")}})
+	}
+	return headers
+}
+
+// withSenders adds the headers of the webhook's sender filters, if it has any, to the trigger
+func withSenders(trigger v1alpha1.EventListenerTrigger, webhook webhook) v1alpha1.EventListenerTrigger {
+	trigger.Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header, senderHeaders(webhook.Senders)...)
+	return trigger
+}
+
+// getSendersFromTrigger reads a webhook's sender filters back from the headers of its trigger, nil if it has none
+func getSendersFromTrigger(t v1alpha1.EventListenerTrigger) *senderFilter {
+	if len(t.Interceptors) == 0 || t.Interceptors[0].Webhook == nil {
+		return nil
+	}
+	senders := &senderFilter{}
+	for _, header := range t.Interceptors[0].Webhook.Header {
+		switch header.Name {
+		case allowedSendersHeader:
+			senders.Allow = strings.Split(header.Value.StringVal, ",")
+		case deniedSendersHeader:
+			senders.Deny = strings.Split(header.Value.StringVal, ",")
+		}
+	}
+	if len(senders.Allow) == 0 && len(senders.Deny) == 0 {
+		return nil
+	}
+	return senders
+}
+
+// monitorSenderHeaders are the sender filter headers of a repository's monitor trigger: those of the webhooks on
+// the repository when they all have the same filters, else none so the monitor runs for any sender
+func monitorSenderHeaders(hooks []webhook) []pipelinesv1alpha1.Param {
+	if len(hooks) == 0 {
+		return []pipelinesv1alpha1.Param{}
+	}
+	for _, hook := range hooks[1:] {
+		if !reflect.DeepEqual(senderHeaders(hook.Senders), senderHeaders(hooks[0].Senders)) {
+			return []pipelinesv1alpha1.Param{}
+		}
+	}
+	return senderHeaders(hooks[0].Senders)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateSenders(t *testing.T) {
+	testcases := []struct {
+		senders *senderFilter
+		valid   bool
+	}{
+		{nil, true},
+		{&senderFilter{Deny: []string{"bots"}}, true},
+		{&senderFilter{Allow: []string{"dependabot[bot]", "team:owner/maintainers", "group:owner/devs"}}, true},
+		{&senderFilter{Allow: []string{""}}, false},
+		{&senderFilter{Deny: []string{"a,b"}}, false},
+		{&senderFilter{Allow: []string{"team:maintainers"}}, false},
+		{&senderFilter{Allow: []string{"group:"}}, false},
+	}
+	for _, tc := range testcases {
+		if err := validateSenders(tc.senders); (err == nil) != tc.valid {
+			t.Errorf("validating %+v returned %v, expected valid %t", tc.senders, err, tc.valid)
+		}
+	}
+}
+
+func TestSendersKeptOnTriggers(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+		Senders:          &senderFilter{Allow: []string{"team:owner/maintainers", "dependabot[bot]"}, Deny: []string{"bots"}},
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		t.Fatalf("error getting webhooks: %s", err)
+	}
+	if len(hooks) != 1 || !reflect.DeepEqual(hooks[0].Senders, hook.Senders) {
+		t.Fatalf("expected the webhook's senders %+v, got %+v", hook.Senders, hooks)
+	}
+	for _, trigger := range el.Spec.Triggers {
+		if triggerHeader(trigger, allowedSendersHeader) != "team:owner/maintainers,dependabot[bot]" || triggerHeader(trigger, deniedSendersHeader) != "bots" {
+			t.Errorf("expected trigger %s to have the webhook's sender filters", trigger.Name)
+		}
+	}
+}
+
+func TestMonitorSenderHeaders(t *testing.T) {
+	filtered := webhook{Name: "a", Senders: &senderFilter{Deny: []string{"bots"}}}
+	if headers := monitorSenderHeaders([]webhook{filtered, {Name: "b", Senders: &senderFilter{Deny: []string{"bots"}}}}); len(headers) != 1 || headers[0].Value.StringVal != "bots" {
+		t.Errorf("expected the monitor to deny bots when every webhook does, got %+v", headers)
+	}
+	if headers := monitorSenderHeaders([]webhook{filtered, {Name: "b"}}); len(headers) != 0 {
+		t.Errorf("expected no monitor sender filters when the webhooks' differ, got %+v", headers)
+	}
+}
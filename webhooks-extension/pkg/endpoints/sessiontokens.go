@@ -0,0 +1,300 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+So the web UI never holds a long-lived credential, POST
+/webhooks/session-token exchanges the caller's Kubernetes bearer token for
+an extension session token that expires after SESSION_TOKEN_TTL (default
+15m) or sooner if asked. A session token is sent as a bearer token like the
+Kubernetes one and is only accepted by the extension. It carries the
+caller's name and groups and its scopes:
+
+	create  create webhooks, clone them and onboard namespaces, as the
+	        group policy allows the caller's groups (see grouppolicy.go)
+	admin   call the admin endpoints, only granted to admins (see admin.go)
+
+A request needing a scope its session token lacks is refused.
+
+Session tokens are signed with the key in the webhooks-extension-session-key
+secret in the install namespace, created when first needed. Deleting the
+secret revokes every session token issued. Session tokens can't be
+exchanged for new ones.
+---------------------------------------*/
+
+const (
+	// Secret in the install namespace holding the key session tokens are signed with
+	sessionKeySecret = "webhooks-extension-session-key"
+	sessionKeyName   = "key"
+	// Prefix telling session tokens from Kubernetes bearer tokens
+	sessionTokenPrefix = "wext-"
+	// Request attribute holding the sessionClaims of a request with a valid session token
+	sessionClaimsAttribute = "webhooks.tekton.dev/session"
+	defaultSessionTokenTTL = 15 * time.Minute
+
+	scopeCreate = "create"
+	scopeAdmin  = "admin"
+)
+
+// sessionClaims are what a session token says about its holder
+type sessionClaims struct {
+	User      string    `json:"user"`
+	Groups    []string  `json:"groups,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresat"`
+}
+
+func (c sessionClaims) hasScope(scope string) bool {
+	for _, granted := range c.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type sessionTokenRequest struct {
+	// Defaults to create
+	Scopes []string `json:"scopes,omitempty"`
+	// Defaults to, and may not be longer than, SESSION_TOKEN_TTL
+	TTL string `json:"ttl,omitempty"`
+}
+
+type sessionTokenResponse struct {
+	Token string `json:"token"`
+	sessionClaims
+}
+
+// sessionTokenTTL is the longest a session token is valid for
+func sessionTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("SESSION_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultSessionTokenTTL
+}
+
+// getSessionKey returns the key session tokens are signed with, creating it if create is true and it does not exist
+func (r Resource) getSessionKey(create bool) ([]byte, error) {
+	secrets := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace)
+	secret, err := secrets.Get(sessionKeySecret, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) && !create {
+		return nil, fmt.Errorf("secret %s does not exist, session tokens were revoked", sessionKeySecret)
+	}
+	if k8serrors.IsNotFound(err) {
+		key := make([]byte, 32)
+		if _, err := cryptorand.Read(key); err != nil {
+			return nil, fmt.Errorf("error generating the session key: %s", err)
+		}
+		secret, err = secrets.Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: sessionKeySecret, Namespace: r.Defaults.Namespace},
+			Data:       map[string][]byte{sessionKeyName: key},
+		})
+		// Another replica created it first
+		if k8serrors.IsAlreadyExists(err) {
+			secret, err = secrets.Get(sessionKeySecret, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading secret %s: %s", sessionKeySecret, err)
+	}
+	if len(secret.Data[sessionKeyName]) == 0 {
+		return nil, fmt.Errorf("secret %s has no %s", sessionKeySecret, sessionKeyName)
+	}
+	return secret.Data[sessionKeyName], nil
+}
+
+func signSession(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// issueSessionToken returns a session token for claims
+func (r Resource) issueSessionToken(claims sessionClaims) (string, error) {
+	key, err := r.getSessionKey(true)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	return sessionTokenPrefix + encoding.EncodeToString(payload) + "." + encoding.EncodeToString(signSession(key, payload)), nil
+}
+
+// verifySessionToken returns the claims of a session token, or an error if it isn't valid or has expired
+func (r Resource) verifySessionToken(token string) (sessionClaims, error) {
+	claims := sessionClaims{}
+	parts := strings.Split(strings.TrimPrefix(token, sessionTokenPrefix), ".")
+	if len(parts) != 2 {
+		return claims, errors.New("malformed session token")
+	}
+	encoding := base64.RawURLEncoding
+	payload, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, errors.New("malformed session token")
+	}
+	signature, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, errors.New("malformed session token")
+	}
+	key, err := r.getSessionKey(false)
+	if err != nil {
+		return claims, err
+	}
+	if !hmac.Equal(signature, signSession(key, payload)) {
+		return claims, errors.New("the session token's signature does not match")
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, errors.New("malformed session token")
+	}
+	if time.Now().After(claims.ExpiresAt) {
+		return claims, fmt.Errorf("the session token expired at %s", claims.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return claims, nil
+}
+
+// bearerToken returns the bearer token in the Authorization header of request, if any
+func bearerToken(request *restful.Request) string {
+	header := request.HeaderParameter("Authorization")
+	token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	if token == header {
+		return ""
+	}
+	return token
+}
+
+// SessionTokenFilter verifies session tokens, refusing requests with one that isn't valid with a 401
+func (r Resource) SessionTokenFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	if err := r.acceptSessionToken(request); err != nil {
+		RespondError(response, err, http.StatusUnauthorized)
+		return
+	}
+	chain.ProcessFilter(request, response)
+}
+
+// acceptSessionToken verifies the session token of request if it has one, recording its claims on request, or
+// returns why it isn't valid
+func (r Resource) acceptSessionToken(request *restful.Request) error {
+	token := bearerToken(request)
+	if !strings.HasPrefix(token, sessionTokenPrefix) {
+		return nil
+	}
+	claims, err := r.verifySessionToken(token)
+	if err != nil {
+		logging.Log.Errorf("refusing session token for %s %s: %s", request.Request.Method, request.Request.URL.Path, err)
+		return err
+	}
+	request.SetAttribute(sessionClaimsAttribute, claims)
+	return nil
+}
+
+// sessionOf returns the claims of the session token of request, if it has one
+func sessionOf(request *restful.Request) (sessionClaims, bool) {
+	claims, found := request.Attribute(sessionClaimsAttribute).(sessionClaims)
+	return claims, found
+}
+
+// POST /webhooks/session-token
+func (r Resource) createSessionToken(request *restful.Request, response *restful.Response) {
+	if _, found := sessionOf(request); found {
+		err := errors.New("session tokens can't be exchanged, send a Kubernetes bearer token")
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusForbidden)
+		return
+	}
+	tokenRequest := sessionTokenRequest{}
+	if request.Request.ContentLength != 0 {
+		if err := readEntity(request, &tokenRequest); err != nil {
+			logging.Log.Errorf("error: %s", err)
+			RespondError(response, err, http.StatusBadRequest)
+			return
+		}
+	}
+	ttl := sessionTokenTTL()
+	if tokenRequest.TTL != "" {
+		requested, err := time.ParseDuration(tokenRequest.TTL)
+		if err != nil || requested <= 0 || requested > ttl {
+			err = fmt.Errorf("ttl %s must be a duration up to %s", tokenRequest.TTL, ttl)
+			logging.Log.Errorf("error: %s", err)
+			RespondError(response, err, http.StatusBadRequest)
+			return
+		}
+		ttl = requested
+	}
+	if len(tokenRequest.Scopes) == 0 {
+		tokenRequest.Scopes = []string{scopeCreate}
+	}
+
+	user, status, err := r.reviewToken(request, "session tokens")
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, status)
+		return
+	}
+	scopes := []string{}
+	for _, scope := range tokenRequest.Scopes {
+		switch scope {
+		case scopeCreate:
+		case scopeAdmin:
+			if status, err := r.authorizeAdmin(request); err != nil {
+				logging.Log.Errorf("error: %s", err)
+				RespondError(response, fmt.Errorf("scope %s can't be granted: %s", scopeAdmin, err), status)
+				return
+			}
+		default:
+			err := fmt.Errorf("unknown scope %s, must be %s or %s", scope, scopeCreate, scopeAdmin)
+			logging.Log.Errorf("error: %s", err)
+			RespondError(response, err, http.StatusBadRequest)
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	claims := sessionClaims{
+		User:      user.Username,
+		Groups:    user.Groups,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+	token, err := r.issueSessionToken(claims)
+	if err != nil {
+		logging.Log.Errorf("error issuing a session token: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	logging.Log.Infof("issued a session token for %s with scopes %s until %s", claims.User, strings.Join(scopes, ","), claims.ExpiresAt.Format(time.RFC3339))
+	response.WriteHeaderAndEntity(http.StatusCreated, sessionTokenResponse{Token: token, sessionClaims: claims})
+}
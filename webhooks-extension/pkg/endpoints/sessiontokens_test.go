@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func exchangeToken(r *Resource, token, body string) (int, sessionTokenResponse) {
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/session-token", bytes.NewBufferString(body))
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	httpWriter := httptest.NewRecorder()
+	r.createSessionToken(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	result := sessionTokenResponse{}
+	json.NewDecoder(httpWriter.Body).Decode(&result)
+	return httpWriter.Code, result
+}
+
+func TestCreateSessionToken(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+
+	status, result := exchangeToken(r, "admin", `{"scopes":["create","admin"],"ttl":"5m"}`)
+	if status != http.StatusCreated || !strings.HasPrefix(result.Token, sessionTokenPrefix) || result.User != "admin" {
+		t.Fatalf("expected a session token for admin, got %d, %+v", status, result)
+	}
+	if ttl := time.Until(result.ExpiresAt); ttl > 5*time.Minute || ttl < 4*time.Minute {
+		t.Errorf("expected the session token to expire in 5m, it expires at %s", result.ExpiresAt)
+	}
+	claims, err := r.verifySessionToken(result.Token)
+	if err != nil || !claims.hasScope(scopeAdmin) || !claims.hasScope(scopeCreate) {
+		t.Errorf("expected the session token to verify with both scopes, got %+v, %v", claims, err)
+	}
+
+	status, result = exchangeToken(r, "user", "")
+	if status != http.StatusCreated || len(result.Scopes) != 1 || result.Scopes[0] != scopeCreate {
+		t.Errorf("expected a session token with the create scope by default, got %d, %+v", status, result)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"admin scope for a user", "user", `{"scopes":["admin"]}`, http.StatusForbidden},
+		{"unknown scope", "admin", `{"scopes":["delete"]}`, http.StatusBadRequest},
+		{"ttl too long", "admin", `{"ttl":"2h"}`, http.StatusBadRequest},
+		{"no token", "", `{}`, http.StatusUnauthorized},
+		{"invalid token", "mallory", `{}`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if status, _ := exchangeToken(r, tt.token, tt.body); status != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.status, status)
+		}
+	}
+}
+
+func TestSessionTokenFilter(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+	container := restful.NewContainer()
+	container.Filter(r.SessionTokenFilter)
+	ws := new(restful.WebService)
+	ws.Path("/webhooks")
+	ws.Route(ws.DELETE("/").To(func(request *restful.Request, response *restful.Response) {
+		if status, err := r.authorizeAdmin(request); err != nil {
+			RespondError(response, err, status)
+			return
+		}
+		response.WriteHeader(http.StatusOK)
+	}))
+	ws.Route(ws.POST("/session-token").To(r.createSessionToken))
+	container.Add(ws)
+	serve := func(method, path, token string) int {
+		httpReq := dummyHTTPRequest(method, "http://wwww.dummy.com:8383"+path, nil)
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		return httpWriter.Code
+	}
+
+	_, admin := exchangeToken(r, "admin", `{"scopes":["admin"]}`)
+	_, create := exchangeToken(r, "admin", `{"scopes":["create"]}`)
+	if status := serve("DELETE", "/webhooks/", admin.Token); status != http.StatusOK {
+		t.Errorf("expected a session token with the admin scope to be an admin, got %d", status)
+	}
+	if status := serve("DELETE", "/webhooks/", create.Token); status != http.StatusForbidden {
+		t.Errorf("expected a session token without the admin scope to be refused, got %d", status)
+	}
+	if status := serve("POST", "/webhooks/session-token", admin.Token); status != http.StatusForbidden {
+		t.Errorf("expected exchanging a session token to be refused, got %d", status)
+	}
+
+	expired, _ := r.issueSessionToken(sessionClaims{User: "admin", Scopes: []string{scopeAdmin}, ExpiresAt: time.Now().Add(-time.Minute)})
+	tampered := sessionTokenPrefix + "A" + admin.Token[len(sessionTokenPrefix)+1:]
+	for name, token := range map[string]string{"expired": expired, "tampered": tampered} {
+		if status := serve("DELETE", "/webhooks/", token); status != http.StatusUnauthorized {
+			t.Errorf("expected an %s session token to be refused with a 401, got %d", name, status)
+		}
+	}
+
+	if err := r.K8sClient.CoreV1().Secrets(installNs).Delete(sessionKeySecret, &metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting secret %s: %s", sessionKeySecret, err)
+	}
+	if status := serve("DELETE", "/webhooks/", admin.Token); status != http.StatusUnauthorized {
+		t.Errorf("expected a session token to be revoked with its key, got %d", status)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"sort"
+	"strings"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+)
+
+/*--------------------------------------
+A webhook in shadow mode runs its pipeline on every event like any other,
+so a new pipeline can be tried against real traffic, but nothing is
+reported on pull requests for its runs. The monitor task is passed the
+names of the repository's shadow triggers in the shadowtriggers param of
+the monitor's binding and leaves out the runs they created, as the monitor
+controller does. Shadow runs are annotated webhooks.tekton.dev/shadow by
+the extension when it labels runs, see runlabels.go.
+---------------------------------------*/
+
+const (
+	// Set on the PipelineRuns of webhooks in shadow mode
+	shadowAnnotation = "webhooks.tekton.dev/shadow"
+	// Binding param recording that a webhook is in shadow mode
+	shadowParam = "webhooks-tekton-shadow"
+)
+
+// shadowParams are the binding params recording that a webhook is in shadow mode
+func shadowParams(webhook webhook) []v1alpha1.Param {
+	if !webhook.ShadowMode {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: shadowParam, Value: "true"}}
+}
+
+// shadowTriggers returns the comma separated names of the triggers of the webhooks in shadow mode
+func shadowTriggers(hooks []webhook) string {
+	names := []string{}
+	for _, hook := range hooks {
+		if !hook.ShadowMode {
+			continue
+		}
+		for _, suffix := range webhookTriggerSuffixes {
+			names = append(names, triggerPrefix(hook)+suffix)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// syncMonitorShadowTriggers sets the shadowtriggers param of the repository's monitor binding
+// from the webhooks on the repository in shadow mode
+func (r Resource) syncMonitorShadowTriggers(repoURL, monitorTriggerNamePrefix string) error {
+	hooks, err := r.getHooksForRepo(repoURL)
+	if err != nil {
+		return err
+	}
+	return r.setMonitorBindingParam(repoURL, monitorTriggerNamePrefix, "shadowtriggers", shadowTriggers(hooks))
+}
+
+// isShadowTrigger returns whether the named trigger is one of the triggers of a webhook in shadow mode
+func isShadowTrigger(hooks []webhook, trigger string) bool {
+	for _, name := range strings.Split(shadowTriggers(hooks), ",") {
+		if name != "" && name == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+// markShadowRun annotates a PipelineRun of a webhook in shadow mode as a shadow run, returning whether it did
+func markShadowRun(pipelineRun *pipelinesv1alpha1.PipelineRun, hooks []webhook) bool {
+	if !isShadowTrigger(hooks, pipelineRun.Labels[triggerLabel]) || pipelineRun.Annotations[shadowAnnotation] == "true" {
+		return false
+	}
+	if pipelineRun.Annotations == nil {
+		pipelineRun.Annotations = map[string]string{}
+	}
+	pipelineRun.Annotations[shadowAnnotation] = "true"
+	return true
+}
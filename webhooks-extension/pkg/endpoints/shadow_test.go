@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestShadowTriggers(t *testing.T) {
+	hooks := []webhook{
+		{Name: "live", Namespace: "foo"},
+		{Name: "dark", Namespace: "foo", ShadowMode: true},
+	}
+	expected := "dark-foo-pullrequest-canary,dark-foo-pullrequest-event,dark-foo-push-canary,dark-foo-push-event"
+	if got := shadowTriggers(hooks); got != expected {
+		t.Errorf("shadow triggers were %q, expected %q", got, expected)
+	}
+	if isShadowTrigger(hooks, "live-foo-pullrequest-event") || !isShadowTrigger(hooks, "dark-foo-pullrequest-event") {
+		t.Error("expected only the triggers of the webhook in shadow mode to be shadow triggers")
+	}
+	if got := shadowTriggers(hooks[:1]); got != "" {
+		t.Errorf("expected no shadow triggers, got %q", got)
+	}
+}
+
+func TestShadowModeKeptAndRunsAnnotated(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+		ShadowMode:       true,
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		t.Fatalf("error getting webhooks: %s", err)
+	}
+	if len(hooks) != 1 || !hooks[0].ShadowMode {
+		t.Fatalf("expected the webhook to be in shadow mode, got %+v", hooks)
+	}
+
+	pipelineRun := pipelinesv1alpha1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: installNs, Labels: map[string]string{
+		eventListenerLabel: r.eventListenerName(),
+		triggerLabel:       "hook-" + installNs + "-pullrequest-event",
+	}}}
+	if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Create(&pipelineRun); err != nil {
+		t.Fatalf("error creating pipelinerun: %s", err)
+	}
+	r.labelPipelineRuns()
+	got, err := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs).Get("run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting pipelinerun: %s", err)
+	}
+	if got.Annotations[shadowAnnotation] != "true" {
+		t.Errorf("expected the run to be annotated as a shadow run, got %v", got.Annotations)
+	}
+}
+
+func TestSyncMonitorShadowTriggers(t *testing.T) {
+	r := dummyResource()
+	installNs := r.Defaults.Namespace
+	repoURL := "https://github.com/owner/repo"
+
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        "foo",
+		GitRepositoryURL: repoURL,
+		Pipeline:         "pipeline",
+		ShadowMode:       true,
+	}
+	hookParams, _, err := r.getParams(hook)
+	if err != nil {
+		t.Fatalf("getParams: %s", err)
+	}
+	bindings := []v1alpha1.TriggerBinding{
+		{ObjectMeta: metav1.ObjectMeta{Name: "hook-binding"}, Spec: v1alpha1.TriggerBindingSpec{Params: hookParams}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pipeline-pullrequest-binding"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "monitor-params"}, Spec: v1alpha1.TriggerBindingSpec{
+			Params: []v1alpha1.Param{{Name: "commentsuccess", Value: "Success"}},
+		}},
+	}
+	for _, binding := range bindings {
+		if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Create(&binding); err != nil {
+			t.Fatalf("error creating binding: %s", err.Error())
+		}
+	}
+	el := v1alpha1.EventListener{
+		ObjectMeta: metav1.ObjectMeta{Name: r.eventListenerName(), Namespace: installNs},
+		Spec: v1alpha1.EventListenerSpec{
+			Triggers: []v1alpha1.EventListenerTrigger{
+				r.newTrigger("hook-foo-pullrequest-event", "pipeline-pullrequest-binding", "pipeline-template", repoURL, "pull_request", "secret", "hook-binding"),
+				r.newTrigger("owner.repo-1234", "monitor-task-github-binding", "monitor-task-template", repoURL, "pull_request", "secret", "monitor-params"),
+			},
+		},
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Create(&el); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err.Error())
+	}
+
+	if err := r.syncMonitorShadowTriggers(repoURL, "owner.repo-"); err != nil {
+		t.Fatalf("error syncing shadow triggers: %s", err.Error())
+	}
+
+	binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("monitor-params", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting monitor binding: %s", err.Error())
+	}
+	expected := v1alpha1.Param{Name: "shadowtriggers", Value: "hook-foo-pullrequest-canary,hook-foo-pullrequest-event,hook-foo-push-canary,hook-foo-push-event"}
+	if len(binding.Spec.Params) != 2 || binding.Spec.Params[1] != expected {
+		t.Errorf("monitor binding params were %+v, expected commentsuccess and %+v", binding.Spec.Params, expected)
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+Automation without cluster credentials, e.g. a CI system outside the
+cluster, can sign its requests with an API key instead of sending a bearer
+token. API keys are kept in the webhooks-extension-api-keys secret in the
+install namespace, a key per API key id whose value is the shared secret.
+A signed request has the headers
+
+	X-Webhooks-Key-Id:    the API key id
+	X-Webhooks-Timestamp: the time the request was signed, in seconds since the epoch
+	X-Webhooks-Signature: sha256=<hex HMAC-SHA256 of the request with the shared secret>
+
+where the request signed is the timestamp, method, path with its query
+string and body, each followed by a newline but the body. Requests signed
+more than maxSignatureAge ago, or in the future, are refused, as are
+requests with a signature that doesn't match. Each signature is accepted
+once: signatures seen are kept in the webhooks-extension-signatures
+configmap until they're too old to be accepted anyway, so a captured
+request can't be replayed, by any replica. A client repeating a request
+signs it again in a later second.
+
+What a key may do is kept next to it in the secret, under <id>.scopes,
+as JSON such as
+
+	{"admin": false, "namespaces": ["team-a", "team-b"]}
+
+where admin allows admin endpoints (see admin.go) and namespaces lists
+the namespaces the key may create and change webhooks in and, with admin,
+onboard, "*" being any. An empty list allows no namespace, and a key
+without scopes may only create and change webhooks in the install
+namespace. A signed request is logged with the caller
+apikey:<id>. Requests without the headers are served as before.
+---------------------------------------*/
+
+const (
+	// Secret in the install namespace holding the API keys
+	apiKeysSecret = "webhooks-extension-api-keys"
+	// How old a signed request may be
+	maxSignatureAge = 5 * time.Minute
+	// Configmap in the install namespace holding the signatures already accepted
+	signaturesConfigMap = "webhooks-extension-signatures"
+	// Request attribute holding the id of the API key a request was signed with
+	signedKeyAttribute = "webhooks.tekton.dev/apikey"
+	// Request attribute holding the scopes of the API key a request was signed with
+	signedScopesAttribute = "webhooks.tekton.dev/apikey-scopes"
+	// Suffix of the secret key holding an API key's scopes
+	apiKeyScopesSuffix = ".scopes"
+
+	keyIDHeader     = "X-Webhooks-Key-Id"
+	timestampHeader = "X-Webhooks-Timestamp"
+	signatureHeader = "X-Webhooks-Signature"
+)
+
+// signRequest returns the signature of a request with secret, as the X-Webhooks-Signature header holds it
+func signRequest(secret []byte, timestamp, method, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", timestamp, method, requestURI)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureFilter verifies the signature of requests signed with an API key, refusing them with a 401 if it isn't valid
+func (r Resource) SignatureFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	if err := r.acceptSignature(request); err != nil {
+		RespondError(response, err, http.StatusUnauthorized)
+		return
+	}
+	chain.ProcessFilter(request, response)
+}
+
+// acceptSignature verifies the signature of request if it's signed with an API key, recording the key and its
+// scopes on request, or returns why it isn't valid
+func (r Resource) acceptSignature(request *restful.Request) error {
+	keyID := request.HeaderParameter(keyIDHeader)
+	if keyID == "" && request.HeaderParameter(signatureHeader) == "" {
+		return nil
+	}
+	scopes, err := r.verifySignature(request)
+	if err != nil {
+		logging.Log.Errorf("refusing signed request %s %s: %s", request.Request.Method, request.Request.URL.Path, err)
+		return err
+	}
+	request.SetAttribute(signedKeyAttribute, keyID)
+	request.SetAttribute(signedScopesAttribute, scopes)
+	return nil
+}
+
+// apiKeyScopes is what an API key may do
+type apiKeyScopes struct {
+	Admin      bool     `json:"admin"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// allowsNamespace returns whether the key may create and change webhooks in and onboard namespace: "*" allows
+// every namespace, and no namespace is allowed if the key's namespaces are empty
+func (s apiKeyScopes) allowsNamespace(namespace string) bool {
+	for _, allowed := range s.Namespaces {
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature returns the scopes of the API key request was signed with, if the signature is valid and
+// wasn't accepted before
+func (r Resource) verifySignature(request *restful.Request) (apiKeyScopes, error) {
+	keyID := request.HeaderParameter(keyIDHeader)
+	signature := strings.ToLower(request.HeaderParameter(signatureHeader))
+	timestamp := request.HeaderParameter(timestampHeader)
+	if keyID == "" || signature == "" || timestamp == "" {
+		return apiKeyScopes{}, fmt.Errorf("signed requests need the %s, %s and %s headers", keyIDHeader, timestampHeader, signatureHeader)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return apiKeyScopes{}, fmt.Errorf("%s %s is not a number of seconds", timestampHeader, timestamp)
+	}
+	age := time.Since(time.Unix(seconds, 0))
+	if age > maxSignatureAge || age < -maxSignatureAge {
+		return apiKeyScopes{}, fmt.Errorf("the request was signed at %s, more than %s from now", time.Unix(seconds, 0).UTC().Format(time.RFC3339), maxSignatureAge)
+	}
+
+	secret, scopes, err := r.getAPIKey(keyID)
+	if err != nil {
+		return apiKeyScopes{}, err
+	}
+	var body []byte
+	if request.Request.Body != nil {
+		if body, err = ioutil.ReadAll(request.Request.Body); err != nil {
+			return apiKeyScopes{}, fmt.Errorf("error reading the request body: %s", err)
+		}
+		request.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	expected := signRequest(secret, timestamp, request.Request.Method, request.Request.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return apiKeyScopes{}, errors.New("the request signature does not match")
+	}
+
+	// A signature stops being accepted maxSignatureAge after it was signed, which is up to maxSignatureAge from now
+	cache := utils.ReplayCache{Client: r.K8sClient, Namespace: r.Defaults.Namespace, Name: signaturesConfigMap}
+	first, err := cache.Remember(keyID+"\n"+signature, 2*maxSignatureAge, time.Now())
+	if err != nil {
+		return apiKeyScopes{}, fmt.Errorf("error recording the request signature in configmap %s: %s", signaturesConfigMap, err)
+	}
+	if !first {
+		return apiKeyScopes{}, errors.New("the request signature was already used, sign the request again to repeat it")
+	}
+	return scopes, nil
+}
+
+// getAPIKey returns the shared secret and scopes of an API key
+func (r Resource) getAPIKey(keyID string) ([]byte, apiKeyScopes, error) {
+	if strings.HasSuffix(keyID, apiKeyScopesSuffix) {
+		return nil, apiKeyScopes{}, fmt.Errorf("API key %s not found", keyID)
+	}
+	secret, err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Get(apiKeysSecret, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, apiKeyScopes{}, fmt.Errorf("API key %s not found, secret %s does not exist", keyID, apiKeysSecret)
+	}
+	if err != nil {
+		return nil, apiKeyScopes{}, fmt.Errorf("error reading secret %s: %s", apiKeysSecret, err)
+	}
+	key, found := secret.Data[keyID]
+	if !found || len(key) == 0 {
+		return nil, apiKeyScopes{}, fmt.Errorf("API key %s not found", keyID)
+	}
+	scopes := apiKeyScopes{Namespaces: []string{r.Defaults.Namespace}}
+	if raw, found := secret.Data[keyID+apiKeyScopesSuffix]; found {
+		scopes = apiKeyScopes{}
+		if err := json.Unmarshal(raw, &scopes); err != nil {
+			return nil, apiKeyScopes{}, fmt.Errorf("the scopes of API key %s in secret %s are not valid: %s", keyID, apiKeysSecret, err)
+		}
+	}
+	return key, scopes, nil
+}
+
+// signedKey returns the id of the API key a request was signed with, if it was
+func signedKey(request *restful.Request) (string, bool) {
+	keyID, signed := request.Attribute(signedKeyAttribute).(string)
+	return keyID, signed && keyID != ""
+}
+
+// signedScopes returns the scopes of the API key a request was signed with, none if it wasn't signed
+func signedScopes(request *restful.Request) apiKeyScopes {
+	scopes, _ := request.Attribute(signedScopesAttribute).(apiKeyScopes)
+	return scopes
+}
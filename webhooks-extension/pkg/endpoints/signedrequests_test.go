@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// signedContainer serves POST /webhooks behind the SignatureFilter, recording the API key and body the handler saw
+func signedContainer(r *Resource, keyID, body *string, scopes *apiKeyScopes) *restful.Container {
+	container := restful.NewContainer()
+	container.Filter(r.SignatureFilter)
+	ws := new(restful.WebService)
+	ws.Path("/webhooks")
+	ws.Route(ws.POST("/").To(func(request *restful.Request, response *restful.Response) {
+		*keyID, _ = signedKey(request)
+		*scopes = signedScopes(request)
+		read, _ := ioutil.ReadAll(request.Request.Body)
+		*body = string(read)
+		response.WriteHeader(http.StatusCreated)
+	}))
+	container.Add(ws)
+	return container
+}
+
+func signedHTTPRequest(keyID, secret string, signedAt time.Time, body string) *http.Request {
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/?namespace=default", bytes.NewBufferString(body))
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	httpReq.Header.Set(keyIDHeader, keyID)
+	httpReq.Header.Set(timestampHeader, timestamp)
+	httpReq.Header.Set(signatureHeader, signRequest([]byte(secret), timestamp, "POST", "/webhooks/?namespace=default", []byte(body)))
+	return httpReq
+}
+
+func TestSignatureFilter(t *testing.T) {
+	r := dummyResource()
+	_, err := r.K8sClient.CoreV1().Secrets(installNs).Create(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: apiKeysSecret, Namespace: installNs},
+		Data: map[string][]byte{
+			"ci":            []byte("s3cret"),
+			"deploy":        []byte("an0ther"),
+			"deploy.scopes": []byte(`{"admin": true, "namespaces": ["team-a"]}`),
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating secret %s: %s", apiKeysSecret, err)
+	}
+	var keyID, body string
+	var scopes apiKeyScopes
+	container := signedContainer(r, &keyID, &body, &scopes)
+
+	signedAt := time.Now()
+	httpWriter := httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, signedHTTPRequest("ci", "s3cret", signedAt, `{"name":"hook"}`))
+	if httpWriter.Code != http.StatusCreated || keyID != "ci" || body != `{"name":"hook"}` {
+		t.Errorf("expected the signed request to reach the handler as ci with its body, got %d, %q, %q", httpWriter.Code, keyID, body)
+	}
+	if !reflect.DeepEqual(scopes, apiKeyScopes{Namespaces: []string{installNs}}) {
+		t.Errorf("expected a key without scopes to be limited to the install namespace, got %+v", scopes)
+	}
+
+	// The same request can't be sent twice
+	keyID = "unset"
+	httpWriter = httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, signedHTTPRequest("ci", "s3cret", signedAt, `{"name":"hook"}`))
+	if httpWriter.Code != http.StatusUnauthorized || keyID != "unset" {
+		t.Errorf("expected a replayed request to be refused with a 401, got %d", httpWriter.Code)
+	}
+
+	httpWriter = httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, signedHTTPRequest("deploy", "an0ther", time.Now(), `{"name":"hook"}`))
+	if httpWriter.Code != http.StatusCreated || !reflect.DeepEqual(scopes, apiKeyScopes{Admin: true, Namespaces: []string{"team-a"}}) {
+		t.Errorf("expected the deploy key's scopes, got %d, %+v", httpWriter.Code, scopes)
+	}
+
+	unsigned := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/", nil)
+	keyID = "unset"
+	httpWriter = httptest.NewRecorder()
+	container.ServeHTTP(httpWriter, unsigned)
+	if httpWriter.Code != http.StatusCreated || keyID != "" {
+		t.Errorf("expected an unsigned request to be served unsigned, got %d, %q", httpWriter.Code, keyID)
+	}
+
+	refused := map[string]*http.Request{
+		"wrong secret":  signedHTTPRequest("ci", "guess", time.Now(), `{"name":"hook"}`),
+		"unknown key":   signedHTTPRequest("other", "s3cret", time.Now(), `{"name":"hook"}`),
+		"scopes as key": signedHTTPRequest("deploy.scopes", `{"admin": true, "namespaces": ["team-a"]}`, time.Now(), `{"name":"hook"}`),
+		"old signature": signedHTTPRequest("ci", "s3cret", time.Now().Add(-maxSignatureAge-time.Minute), `{"name":"hook"}`),
+	}
+	tampered := signedHTTPRequest("ci", "s3cret", time.Now(), `{"name":"hook"}`)
+	tampered.Body = ioutil.NopCloser(bytes.NewBufferString(`{"name":"other"}`))
+	refused["tampered body"] = tampered
+	missing := signedHTTPRequest("ci", "s3cret", time.Now(), "")
+	missing.Header.Del(timestampHeader)
+	refused["missing timestamp"] = missing
+	for name, httpReq := range refused {
+		keyID = "unset"
+		httpWriter = httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		if httpWriter.Code != http.StatusUnauthorized || keyID != "unset" {
+			t.Errorf("%s: expected the request to be refused with a 401, got %d", name, httpWriter.Code)
+		}
+	}
+}
+
+func TestAuthorizeAdminSignedRequest(t *testing.T) {
+	r := dummyResource()
+	request := dummyRestfulRequest(dummyHTTPRequest("DELETE", "http://wwww.dummy.com:8383/webhooks?namespace=default", nil), "")
+	if status, _ := r.authorizeAdmin(request); status != http.StatusUnauthorized {
+		t.Errorf("expected a request without a token or signature to be refused, got %d", status)
+	}
+	request.SetAttribute(signedKeyAttribute, "ci")
+	request.SetAttribute(signedScopesAttribute, apiKeyScopes{Namespaces: []string{"*"}})
+	if status, _ := r.authorizeAdmin(request); status != http.StatusForbidden {
+		t.Errorf("expected a request signed with a key without the admin scope to be refused, got %d", status)
+	}
+	request.SetAttribute(signedScopesAttribute, apiKeyScopes{Admin: true})
+	if status, err := r.authorizeAdmin(request); status != http.StatusOK {
+		t.Errorf("expected a request signed with an admin key to be allowed, got %d: %s", status, err)
+	}
+}
@@ -0,0 +1,394 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	utils "github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/{name}/simulate").To(r.profiled(Resource.simulateWebhook)))
+Shows what a webhook would do with a delivery, e.g. to check its actions
+or canary before pointing a repository at it. The sample payload and
+headers are signed with the webhook's secret and sent to the validator
+once for each of the webhook's triggers, with the headers the trigger
+gives the validator, so they are checked exactly as a delivery would be:
+repository, event, actions, review approval, canary routing and whether
+the webhook is disabled. The Wext-Simulation header stops the validator
+publishing, syncing the manifest or reporting dead letters for them, and
+is signed with the key in the webhooks-extension-simulation-key secret so
+only the extension can set it. The
+params of a trigger that fires are resolved from its triggerbindings
+against the payload the validator returns.
+
+Nothing runs unless ?execute=true, which sends the sample to the
+eventlistener as a delivery. Wext-Simulated-Webhook has the validator turn
+it away from the triggers of other webhooks on the repository, so only
+this webhook's pipeline runs. The webhook's own interceptors, chained
+after the validator, are listed but only run when executing.
+---------------------------------------*/
+
+const (
+	simulationHeader       = "Wext-Simulation"
+	dryRunSimulation       = "dry-run"
+	simulatedWebhookHeader = "Wext-Simulated-Webhook"
+)
+
+// simulationServiceURL is where the simulation posts to a service, a var so tests can serve it
+var simulationServiceURL = func(service, namespace string) string {
+	return fmt.Sprintf("http://%s.%s.svc.cluster.local:8080", service, namespace)
+}
+
+// $(body.path.to.field) or $(header.Name) in a triggerbinding param
+var bindingExpression = regexp.MustCompile(`\$\((body|header)(\.[^)]*)?\)`)
+
+type simulateRequest struct {
+	Headers map[string]string `json:"headers"`
+	Payload json.RawMessage   `json:"payload"`
+}
+
+type simulatedTrigger struct {
+	Trigger string `json:"trigger"`
+	Fires   bool   `json:"fires"`
+	// The validator's response status and, for a trigger that doesn't fire, its reason
+	Status int    `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	// The params of the trigger's bindings, for a trigger that fires
+	Params map[string]string `json:"params,omitempty"`
+	// Interceptors chained after the validator, not run by the simulation
+	NotSimulated []string `json:"notsimulated,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+type simulateResponse struct {
+	Triggers []simulatedTrigger `json:"triggers"`
+	Executed bool               `json:"executed"`
+	// The eventlistener's response status when executed
+	ExecuteStatus int `json:"executestatus,omitempty"`
+}
+
+// simulation is a sample delivery signed for a webhook's triggers
+type simulation struct {
+	name      string
+	namespace string
+	prefix    string
+	header    http.Header
+	payload   []byte
+	triggers  []v1alpha1.EventListenerTrigger
+}
+
+// POST /webhooks/{name}/simulate?namespace=<namespace>[&execute=true]
+func (r Resource) simulateWebhook(request *restful.Request, response *restful.Response) {
+	sample, ok := r.readSimulation(request, response)
+	if !ok {
+		return
+	}
+	name, namespace, header := sample.name, sample.namespace, sample.header
+
+	result := simulateResponse{Triggers: []simulatedTrigger{}}
+	fires := false
+	for _, trigger := range sample.triggers {
+		simulated, err := r.simulateTrigger(trigger, header, sample.payload)
+		if err != nil {
+			logging.Log.Errorf("error simulating trigger %s: %s", trigger.Name, err)
+			RespondError(response, err, http.StatusInternalServerError)
+			return
+		}
+		fires = fires || simulated.Fires
+		result.Triggers = append(result.Triggers, simulated)
+	}
+
+	if fires && request.QueryParameter("execute") == "true" {
+		delivery := http.Header{}
+		for key, values := range header {
+			delivery[key] = values
+		}
+		delivery.Set(simulatedWebhookHeader, sample.prefix)
+		status, _, err := postToService(simulationServiceURL(r.getDeliveryForwardService(), r.Defaults.Namespace), delivery, sample.payload)
+		if err != nil {
+			logging.Log.Errorf("error executing the simulated delivery for webhook %s: %s", name, err)
+			RespondError(response, err, http.StatusInternalServerError)
+			return
+		}
+		logging.Log.Infof("executed a simulated delivery for webhook %s in namespace %s, the eventlistener responded %d", name, namespace, status)
+		result.Executed, result.ExecuteStatus = true, status
+	}
+	response.WriteEntity(result)
+}
+
+// readSimulation reads the sample delivery for the webhook and signs it, responding with an error if it can't
+func (r Resource) readSimulation(request *restful.Request, response *restful.Response) (simulation, bool) {
+	name, namespace, ok := webhookRef(request, response)
+	if !ok {
+		return simulation{}, false
+	}
+	sample := simulateRequest{}
+	if err := readEntity(request, &sample); err != nil {
+		logging.Log.Errorf("error trying to read request entity as a simulated delivery: %s.", err)
+		RespondError(response, err, http.StatusBadRequest)
+		return simulation{}, false
+	}
+	header := http.Header{}
+	for key, value := range sample.Headers {
+		header.Set(key, value)
+	}
+	if sampleEvent(header) == "" {
+		err := errors.New("bad request information provided, the headers must include X-GitHub-Event, X-Gitlab-Event, X-Event-Key, X-Gitea-Event or X-Gogs-Event")
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusBadRequest)
+		return simulation{}, false
+	}
+	if len(sample.Payload) == 0 {
+		sample.Payload = json.RawMessage("{}")
+	}
+	header.Set("Content-Type", "application/json")
+
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(r.Defaults.Namespace).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return simulation{}, false
+	}
+	prefix := r.triggerPrefixOf(name, namespace)
+	names := webhookTriggerNames(prefix)
+	triggers := []v1alpha1.EventListenerTrigger{}
+	for _, triggerName := range names {
+		for _, trigger := range el.Spec.Triggers {
+			if trigger.Name == triggerName {
+				triggers = append(triggers, trigger)
+			}
+		}
+	}
+	if len(triggers) == 0 {
+		err := newMessageError("WEBHOOK_NOT_FOUND", map[string]string{"name": name, "namespace": namespace})
+		logging.Log.Error(err)
+		RespondError(response, err, http.StatusNotFound)
+		return simulation{}, false
+	}
+	// Pushes without a ref run as pushes to the webhook's default branch
+	sample.Payload = withDefaultRef(header, sample.Payload, triggerDefaultBranch(triggers[0]))
+	if err := r.signSample(header, sample.Payload, triggers[0]); err != nil {
+		logging.Log.Errorf("error signing the simulated delivery for webhook %s: %s", name, err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return simulation{}, false
+	}
+	return simulation{name: name, namespace: namespace, prefix: prefix, header: header, payload: sample.Payload, triggers: triggers}, true
+}
+
+// signSample signs the payload with the secret of the webhook's trigger, as the git provider would,
+// unless the sample is already signed
+func (r Resource) signSample(header http.Header, payload []byte, trigger v1alpha1.EventListenerTrigger) error {
+	secretName := ""
+	if validator := validatorInterceptor(trigger); validator != nil {
+		for _, param := range validator.Header {
+			if param.Name == "Wext-Secret-Name" {
+				secretName = param.Value.StringVal
+			}
+		}
+	}
+	if secretName == "" {
+		return fmt.Errorf("trigger %s has no secret", trigger.Name)
+	}
+	secret, err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	token := secret.Data["secretToken"]
+	switch event := sampleEvent(header); {
+	case (event == "X-Gitea-Event" || event == "X-Gogs-Event") && header.Get(strings.TrimSuffix(event, "Event")+"Signature") == "":
+		mac := hmac.New(sha256.New, token)
+		mac.Write(payload)
+		header.Set(strings.TrimSuffix(event, "Event")+"Signature", hex.EncodeToString(mac.Sum(nil)))
+	case (event == "X-Github-Event" || event == "X-Event-Key") && header.Get("X-Hub-Signature") == "":
+		mac := hmac.New(sha1.New, token)
+		mac.Write(payload)
+		header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+	case event == "X-Gitlab-Event" && header.Get("X-Gitlab-Token") == "":
+		header.Set("X-Gitlab-Token", string(token))
+	}
+	return nil
+}
+
+// sampleEvent returns the header naming the event of a sample delivery as the validator reads it, Gitea and Gogs
+// first as they send X-GitHub-Event too, or "" if it has none
+func sampleEvent(header http.Header) string {
+	for _, name := range []string{"X-Gitea-Event", "X-Gogs-Event", "X-Github-Event", "X-Gitlab-Event", "X-Event-Key"} {
+		if header.Get(name) != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// simulateTrigger sends the sample to the validator as the trigger would and resolves the params of a trigger that fires
+func (r Resource) simulateTrigger(trigger v1alpha1.EventListenerTrigger, sampleHeader http.Header, payload []byte) (simulatedTrigger, error) {
+	simulated := simulatedTrigger{Trigger: trigger.Name}
+	validator := validatorInterceptor(trigger)
+	if validator == nil {
+		return simulated, fmt.Errorf("trigger %s doesn't start with the %s interceptor", trigger.Name, validatorServiceName)
+	}
+	for _, interceptor := range trigger.Interceptors[1:] {
+		switch {
+		case interceptor.Webhook != nil && interceptor.Webhook.ObjectRef != nil:
+			simulated.NotSimulated = append(simulated.NotSimulated, "webhook "+interceptor.Webhook.ObjectRef.Name)
+		case interceptor.CEL != nil:
+			simulated.NotSimulated = append(simulated.NotSimulated, "cel "+interceptor.CEL.Filter)
+		}
+	}
+
+	header := http.Header{}
+	for key, values := range sampleHeader {
+		header[key] = values
+	}
+	for _, param := range validator.Header {
+		header.Del(param.Name)
+		if len(param.Value.ArrayVal) > 0 {
+			for _, value := range param.Value.ArrayVal {
+				header.Add(param.Name, value)
+			}
+		} else {
+			header.Set(param.Name, param.Value.StringVal)
+		}
+	}
+	header.Set(simulationHeader, dryRunSimulation)
+	key, err := utils.GetSimulationKey(r.K8sClient, r.Defaults.Namespace, true)
+	if err != nil {
+		return simulated, err
+	}
+	utils.SignSimulation(header, key, payload, time.Now())
+	status, body, err := postToService(simulationServiceURL(validatorServiceName, r.Defaults.Namespace), header, payload)
+	if err != nil {
+		return simulated, err
+	}
+	simulated.Status = status
+	if status != http.StatusOK {
+		simulated.Reason = strings.TrimSpace(string(body))
+		return simulated, nil
+	}
+	simulated.Fires = true
+
+	var validated interface{}
+	if err := json.Unmarshal(body, &validated); err != nil {
+		return simulated, fmt.Errorf("the validator returned a payload that isn't JSON: %s", err)
+	}
+	simulated.Params = map[string]string{}
+	for _, ref := range trigger.Bindings {
+		binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(r.Defaults.Namespace).Get(ref.Ref, metav1.GetOptions{})
+		if err != nil {
+			simulated.Warnings = append(simulated.Warnings, fmt.Sprintf("error getting triggerbinding %s: %s", ref.Ref, err))
+			continue
+		}
+		for _, param := range binding.Spec.Params {
+			value, missing := resolveBindingParam(param.Value, validated, header)
+			simulated.Params[param.Name] = value
+			for _, expression := range missing {
+				simulated.Warnings = append(simulated.Warnings, fmt.Sprintf("param %s: %s is not in the delivery", param.Name, expression))
+			}
+		}
+	}
+	return simulated, nil
+}
+
+// validatorInterceptor is the trigger's built-in validator, always its first interceptor
+func validatorInterceptor(trigger v1alpha1.EventListenerTrigger) *v1alpha1.WebhookInterceptor {
+	if len(trigger.Interceptors) == 0 || trigger.Interceptors[0].Webhook == nil || trigger.Interceptors[0].Webhook.ObjectRef == nil ||
+		trigger.Interceptors[0].Webhook.ObjectRef.Name != validatorServiceName {
+		return nil
+	}
+	return trigger.Interceptors[0].Webhook
+}
+
+// resolveBindingParam replaces the $(body...) and $(header...) expressions of a triggerbinding param value,
+// as Tekton Triggers does, returning the expressions that are not in the delivery
+func resolveBindingParam(value string, body interface{}, header http.Header) (string, []string) {
+	missing := []string{}
+	resolved := bindingExpression.ReplaceAllStringFunc(value, func(expression string) string {
+		match := bindingExpression.FindStringSubmatch(expression)
+		path := strings.TrimPrefix(match[2], ".")
+		if match[1] == "header" {
+			if path == "" {
+				headerJSON, _ := json.Marshal(header)
+				return string(headerJSON)
+			}
+			if header.Get(path) == "" {
+				missing = append(missing, expression)
+			}
+			return header.Get(path)
+		}
+		field := body
+		if path != "" {
+			for _, key := range strings.Split(path, ".") {
+				switch node := field.(type) {
+				case map[string]interface{}:
+					field = node[key]
+				case []interface{}:
+					i, err := strconv.Atoi(key)
+					if err != nil || i < 0 || i >= len(node) {
+						field = nil
+					} else {
+						field = node[i]
+					}
+				default:
+					field = nil
+				}
+			}
+		}
+		if field == nil {
+			missing = append(missing, expression)
+			return ""
+		}
+		if s, ok := field.(string); ok {
+			return s
+		}
+		fieldJSON, _ := json.Marshal(field)
+		return string(fieldJSON)
+	})
+	return resolved, missing
+}
+
+// postToService posts the payload with the headers, returning the response's status and body
+func postToService(url string, header http.Header, payload []byte) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header = header
+	resp, err := deliveryClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
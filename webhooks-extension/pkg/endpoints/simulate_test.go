@@ -0,0 +1,233 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	utils "github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSimulateWebhook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("GIT_PROVIDER_MODE", "replay")
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", dir)
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+
+	r := dummyResource()
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	createTriggerResources(hook, r)
+	binding, _ := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("pipeline1-push-binding", metav1.GetOptions{})
+	binding.Spec.Params = []v1alpha1.Param{
+		{Name: "commit", Value: "$(body.head_commit.id)"},
+		{Name: "event", Value: "$(header.X-Github-Event)"},
+		{Name: "image", Value: "registry/$(body.repository.name):$(body.webhooks-tekton-image-tag)"},
+	}
+	r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Update(binding)
+	if response := createWebhook(hook, r); response.StatusCode() != http.StatusCreated {
+		t.Fatalf("creating the webhook returned %d", response.StatusCode())
+	}
+
+	executed := make(chan http.Header, 1)
+	server := fakeSimulationServices(r, executed)
+	defer server.Close()
+	defer func(original func(string, string) string) { simulationServiceURL = original }(simulationServiceURL)
+	simulationServiceURL = func(service, namespace string) string {
+		return server.URL + "/" + service
+	}
+
+	ws := new(restful.WebService)
+	ws.Path("/webhooks").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	ws.Route(ws.POST("/{name}/simulate").To(r.simulateWebhook))
+	container := restful.NewContainer()
+	container.Add(ws)
+	serve := func(query string, sample simulateRequest) (int, simulateResponse) {
+		b, _ := json.Marshal(sample)
+		httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/hook/simulate?"+query, bytes.NewBuffer(b))
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		result := simulateResponse{}
+		json.NewDecoder(httpWriter.Body).Decode(&result)
+		return httpWriter.Code, result
+	}
+	push := simulateRequest{
+		Headers: map[string]string{"X-GitHub-Event": "push"},
+		Payload: json.RawMessage(`{"head_commit":{"id":"abc123def"},"repository":{"name":"repo"}}`),
+	}
+
+	status, result := serve("namespace="+installNs, push)
+	if status != http.StatusOK || len(result.Triggers) != 2 || result.Executed {
+		t.Fatalf("expected both triggers simulated without executing, got %d, %+v", status, result)
+	}
+	pushTrigger, pullRequestTrigger := result.Triggers[0], result.Triggers[1]
+	expectedParams := map[string]string{"commit": "abc123def", "event": "push", "image": "registry/repo:abc123"}
+	for name, value := range expectedParams {
+		if pushTrigger.Params[name] != value {
+			t.Errorf("expected param %s to be %s, got %+v", name, value, pushTrigger.Params)
+		}
+	}
+	if !pushTrigger.Fires || pushTrigger.Trigger != "hook-"+installNs+"-push-event" || len(pushTrigger.Warnings) != 0 {
+		t.Errorf("expected the push trigger to fire, got %+v", pushTrigger)
+	}
+	if pullRequestTrigger.Fires || pullRequestTrigger.Status != http.StatusExpectationFailed || pullRequestTrigger.Reason != "Validation FAIL (event mismatch)" {
+		t.Errorf("expected the pull request trigger not to fire, got %+v", pullRequestTrigger)
+	}
+
+	status, result = serve("namespace="+installNs+"&execute=true", push)
+	if status != http.StatusOK || !result.Executed || result.ExecuteStatus != http.StatusOK {
+		t.Fatalf("expected the delivery to be executed, got %d, %+v", status, result)
+	}
+	if header := <-executed; header.Get(simulatedWebhookHeader) != "hook-"+installNs || header.Get(simulationHeader) != "" {
+		t.Errorf("expected the executed delivery to be for the webhook only, got %v", header)
+	}
+
+	tests := []struct {
+		query  string
+		sample simulateRequest
+		status int
+	}{
+		{"namespace=" + installNs, simulateRequest{Headers: map[string]string{"X-Custom": "push"}}, http.StatusBadRequest},
+		{"", push, http.StatusBadRequest},
+		{"namespace=other", push, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status, _ := serve(tt.query, tt.sample); status != tt.status {
+			t.Errorf("simulating with %s and %+v: expected %d, got %d", tt.query, tt.sample.Headers, tt.status, status)
+		}
+	}
+}
+
+// fakeSimulationServices serves a validator accepting signed dry run deliveries for the trigger's event and
+// adding webhooks-tekton-image-tag to the payload, and an eventlistener sending the deliveries it gets to executed
+func fakeSimulationServices(r *Resource, executed chan<- http.Header) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if strings.HasPrefix(req.URL.Path, "/"+listenerServiceName(r.eventListenerName())) {
+			executed <- req.Header
+			return
+		}
+		mac := hmac.New(sha1.New, []byte("secret"))
+		mac.Write(body)
+		if req.Header.Get("X-Hub-Signature") != "sha1="+hex.EncodeToString(mac.Sum(nil)) || req.Header.Get(simulationHeader) != dryRunSimulation {
+			http.Error(w, "unsigned", http.StatusBadRequest)
+			return
+		}
+		key, err := utils.GetSimulationKey(r.K8sClient, installNs, false)
+		if err != nil || utils.VerifySimulation(req.Header, key, body, time.Now()) != nil {
+			http.Error(w, "dry run not signed by the extension", http.StatusBadRequest)
+			return
+		}
+		if !strings.Contains(req.Header.Get("Wext-Incoming-Event"), req.Header.Get("X-Github-Event")+",") {
+			http.Error(w, "Validation FAIL (event mismatch)", http.StatusExpectationFailed)
+			return
+		}
+		w.Write(bytes.Replace(body, []byte("{"), []byte(`{"webhooks-tekton-image-tag":"abc123",`), 1))
+	}))
+}
+
+func TestSignSample(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("GIT_PROVIDER_MODE", "replay")
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", dir)
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+
+	r := dummyResource()
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	createTriggerResources(hook, r)
+	if response := createWebhook(hook, r); response.StatusCode() != http.StatusCreated {
+		t.Fatalf("creating the webhook returned %d", response.StatusCode())
+	}
+	el, _ := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	payload := []byte(`{"ref":"refs/heads/master"}`)
+	sha1Mac := hmac.New(sha1.New, []byte("secret"))
+	sha1Mac.Write(payload)
+	sha256Mac := hmac.New(sha256.New, []byte("secret"))
+	sha256Mac.Write(payload)
+
+	tests := []struct {
+		event     string
+		signature string
+		expected  string
+	}{
+		{"X-GitHub-Event", "X-Hub-Signature", "sha1=" + hex.EncodeToString(sha1Mac.Sum(nil))},
+		{"X-Event-Key", "X-Hub-Signature", "sha1=" + hex.EncodeToString(sha1Mac.Sum(nil))},
+		{"X-Gitea-Event", "X-Gitea-Signature", hex.EncodeToString(sha256Mac.Sum(nil))},
+		{"X-Gogs-Event", "X-Gogs-Signature", hex.EncodeToString(sha256Mac.Sum(nil))},
+		{"X-Gitlab-Event", "X-Gitlab-Token", "secret"},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set(tt.event, "push")
+		if err := r.signSample(header, payload, el.Spec.Triggers[0]); err != nil {
+			t.Fatalf("error signing a %s sample: %s", tt.event, err)
+		}
+		if header.Get(tt.signature) != tt.expected {
+			t.Errorf("signing a %s sample: expected %s %q, got %q", tt.event, tt.signature, tt.expected, header.Get(tt.signature))
+		}
+	}
+}
+
+func TestResolveBindingParam(t *testing.T) {
+	body := map[string]interface{}{}
+	json.Unmarshal([]byte(`{"ref":"refs/heads/master","commits":[{"id":"a1"}],"repository":{"private":false}}`), &body)
+	header := http.Header{"X-Github-Event": []string{"push"}}
+	tests := []struct {
+		value    string
+		expected string
+		missing  []string
+	}{
+		{"$(body.ref)", "refs/heads/master", []string{}},
+		{"$(body.commits.0.id)", "a1", []string{}},
+		{"$(body.repository.private)", "false", []string{}},
+		{"$(body.repository)", `{"private":false}`, []string{}},
+		{"$(header.X-Github-Event)-$(body.ref)", "push-refs/heads/master", []string{}},
+		{"literal", "literal", []string{}},
+		{"$(body.commits.3.id)", "", []string{"$(body.commits.3.id)"}},
+		{"$(header.X-Missing)", "", []string{"$(header.X-Missing)"}},
+	}
+	for _, tt := range tests {
+		resolved, missing := resolveBindingParam(tt.value, body, header)
+		if resolved != tt.expected || !reflect.DeepEqual(missing, tt.missing) {
+			t.Errorf("resolving %s: expected %q missing %v, got %q missing %v", tt.value, tt.expected, tt.missing, resolved, missing)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	triggersv1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+/*--------------------------------------
+A starter is a pipeline, its tasks and its triggertemplate and
+triggerbindings that a webhook can install when its namespace has no
+pipeline yet. Starters are listed in the webhooks-extension-starters
+configmap in the install namespace, a key per starter whose value is JSON
+naming the pipeline, the build files of the repositories it builds and
+the URLs of the YAML files defining it, e.g. tasks from the Tekton Catalog
+and the pipeline from an internal catalog:
+	maven: '{"pipeline": "maven-build", "buildfiles": ["pom.xml"], "urls": [
+	  "https://raw.githubusercontent.com/tektoncd/catalog/master/maven/maven.yaml",
+	  "https://catalog.example.com/starters/maven-build.yaml"]}'
+A webhook created with "starter": "maven" and no pipeline runs maven-build.
+"starter": "auto" picks the first starter, by name, whose build files the
+repository has, see discover.go. If the pipeline isn't in the webhook's
+namespace its Pipelines and Tasks are created there, and its
+TriggerTemplates and TriggerBindings in the install namespace, resources
+that already exist being left as they are. The starter's files are read
+while the webhook is validated, so its triggertemplate and triggerbindings
+count as there, and nothing is installed until the webhook is known to be
+valid and allowed.
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.GET("/starters").To(r.getAllStarters))
+---------------------------------------*/
+
+const (
+	// Configmap in the install namespace listing the starters
+	startersConfigMap = "webhooks-extension-starters"
+	// Starter chosen by the repository's build files
+	autoStarter    = "auto"
+	starterLabel   = "webhooks.tekton.dev/starter"
+	starterTimeout = 30 * time.Second
+)
+
+type starter struct {
+	Name       string   `json:"name"`
+	Pipeline   string   `json:"pipeline"`
+	BuildFiles []string `json:"buildfiles,omitempty"`
+	URLs       []string `json:"urls"`
+}
+
+// starterResources are the resources a starter's files define
+type starterResources struct {
+	pipelines []pipelinesv1alpha1.Pipeline
+	tasks     []pipelinesv1alpha1.Task
+	templates []triggersv1alpha1.TriggerTemplate
+	bindings  []triggersv1alpha1.TriggerBinding
+}
+
+// getStarters returns the starters by name, none if the configmap doesn't exist
+func (r Resource) getStarters() (map[string]starter, error) {
+	starters := map[string]starter{}
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(startersConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return starters, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range cm.Data {
+		s := starter{}
+		if err := json.Unmarshal([]byte(value), &s); err != nil || s.Pipeline == "" || len(s.URLs) == 0 {
+			logging.Log.Errorf("ignoring starter %s, it must be JSON with a pipeline and urls: %v", name, err)
+			continue
+		}
+		s.Name = name
+		starters[name] = s
+	}
+	return starters, nil
+}
+
+// startersFor returns the names of the starters building one of buildFiles
+func startersFor(starters map[string]starter, buildFiles []string) []string {
+	names := []string{}
+	for name, s := range starters {
+		if buildsAny(s, buildFiles) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func buildsAny(s starter, buildFiles []string) bool {
+	for _, wanted := range s.BuildFiles {
+		for _, file := range buildFiles {
+			if file == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// chooseStarter returns the starter named, or for auto the first by name building one of buildFiles
+func chooseStarter(starters map[string]starter, name string, buildFiles []string) (starter, error) {
+	if name != autoStarter {
+		s, found := starters[name]
+		if !found {
+			return starter{}, fmt.Errorf("starter %s is not in configmap %s", name, startersConfigMap)
+		}
+		return s, nil
+	}
+	if names := startersFor(starters, buildFiles); len(names) > 0 {
+		return starters[names[0]], nil
+	}
+	return starter{}, fmt.Errorf("no starter builds a repository with %v", buildFiles)
+}
+
+// resolveStarter chooses the webhook's starter, reading the repository's build files for auto,
+// and sets the webhook's pipeline to the starter's if it has none
+func (r Resource) resolveStarter(hook *webhook) (starter, error) {
+	starters, err := r.getStarters()
+	if err != nil {
+		return starter{}, err
+	}
+	buildFiles := []string{}
+	if hook.Starter == autoStarter {
+		_, gitOwner, gitRepo, err := r.getGitValues(hook.GitRepositoryURL)
+		if err != nil {
+			return starter{}, err
+		}
+		provider, err := r.createGitProviderForWebhook(*hook, gitOwner, gitRepo)
+		if err != nil {
+			return starter{}, err
+		}
+		discovered, err := discoverRepository(provider, map[string]string{})
+		if err != nil {
+			return starter{}, fmt.Errorf("error reading the build files of %s: %s", hook.GitRepositoryURL, err)
+		}
+		buildFiles = discovered.BuildFiles
+	}
+	s, err := chooseStarter(starters, hook.Starter, buildFiles)
+	if err != nil {
+		return starter{}, err
+	}
+	if hook.Pipeline == "" {
+		hook.Pipeline = s.Pipeline
+	}
+	if hook.Pipeline != s.Pipeline {
+		return starter{}, fmt.Errorf("starter %s installs pipeline %s, not %s", s.Name, s.Pipeline, hook.Pipeline)
+	}
+	return s, nil
+}
+
+// fetchStarter reads the resources the starter's files define
+func fetchStarter(s starter) (starterResources, error) {
+	resources := starterResources{}
+	client := http.Client{Timeout: starterTimeout}
+	for _, url := range s.URLs {
+		resp, err := client.Get(url)
+		if err != nil {
+			return resources, fmt.Errorf("error fetching %s: %s", url, err)
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return resources, fmt.Errorf("error fetching %s: %s", url, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return resources, fmt.Errorf("error fetching %s: status %d", url, resp.StatusCode)
+		}
+		if err := resources.parse(url, data); err != nil {
+			return resources, err
+		}
+	}
+	return resources, nil
+}
+
+// parse adds the resources of the YAML documents in data
+func (resources *starterResources) parse(url string, data []byte) error {
+	for _, document := range bytes.Split(data, []byte("\n---")) {
+		meta := metav1.TypeMeta{}
+		if err := yaml.Unmarshal(document, &meta); err != nil {
+			return fmt.Errorf("error parsing %s: %s", url, err)
+		}
+		var err error
+		switch {
+		case meta.Kind == "" && meta.APIVersion == "":
+			// An empty document
+		case meta.APIVersion == "tekton.dev/v1alpha1" && meta.Kind == "Pipeline":
+			pipeline := pipelinesv1alpha1.Pipeline{}
+			if err = yaml.Unmarshal(document, &pipeline); err == nil {
+				resources.pipelines = append(resources.pipelines, pipeline)
+			}
+		case meta.APIVersion == "tekton.dev/v1alpha1" && meta.Kind == "Task":
+			task := pipelinesv1alpha1.Task{}
+			if err = yaml.Unmarshal(document, &task); err == nil {
+				resources.tasks = append(resources.tasks, task)
+			}
+		case meta.APIVersion == "triggers.tekton.dev/v1alpha1" && meta.Kind == "TriggerTemplate":
+			template := triggersv1alpha1.TriggerTemplate{}
+			if err = yaml.Unmarshal(document, &template); err == nil {
+				resources.templates = append(resources.templates, template)
+			}
+		case meta.APIVersion == "triggers.tekton.dev/v1alpha1" && meta.Kind == "TriggerBinding":
+			binding := triggersv1alpha1.TriggerBinding{}
+			if err = yaml.Unmarshal(document, &binding); err == nil {
+				resources.bindings = append(resources.bindings, binding)
+			}
+		default:
+			return fmt.Errorf("%s defines a %s %s, a starter can only define tekton.dev/v1alpha1 Pipelines and Tasks "+
+				"and triggers.tekton.dev/v1alpha1 TriggerTemplates and TriggerBindings", url, meta.APIVersion, meta.Kind)
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %s", url, err)
+		}
+	}
+	return nil
+}
+
+// starterMeta is the metadata a starter's resource is created with
+func starterMeta(meta metav1.ObjectMeta, namespace, starterName string) metav1.ObjectMeta {
+	labels := map[string]string{starterLabel: starterName}
+	for k, v := range meta.Labels {
+		labels[k] = v
+	}
+	return metav1.ObjectMeta{Name: meta.Name, Namespace: namespace, Labels: labels, Annotations: meta.Annotations}
+}
+
+// planStarter returns the resources to install for the starter, nil if its pipeline is already in namespace
+func (r Resource) planStarter(s starter, namespace string) (*starterResources, error) {
+	_, err := r.TektonClient.TektonV1alpha1().Pipelines(namespace).Get(s.Pipeline, metav1.GetOptions{})
+	if err == nil {
+		logging.Log.Debugf("pipeline %s of starter %s is already in namespace %s", s.Pipeline, s.Name, namespace)
+		return nil, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	resources, err := fetchStarter(s)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, pipeline := range resources.pipelines {
+		found = found || pipeline.Name == s.Pipeline
+	}
+	if !found {
+		return nil, fmt.Errorf("the files of starter %s don't define pipeline %s", s.Name, s.Pipeline)
+	}
+	return &resources, nil
+}
+
+// definesTemplate is whether resources, if any, define the triggertemplate
+func (resources *starterResources) definesTemplate(name string) bool {
+	if resources == nil {
+		return false
+	}
+	for _, template := range resources.templates {
+		if template.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// definesBinding is whether resources, if any, define the triggerbinding
+func (resources *starterResources) definesBinding(name string) bool {
+	if resources == nil {
+		return false
+	}
+	for _, binding := range resources.bindings {
+		if binding.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// installStarter creates the resources planned for the starter in namespace, returning the names of the resources
+// created
+func (r Resource) installStarter(s starter, namespace string, resources starterResources) ([]string, error) {
+	installNs := r.Defaults.Namespace
+	created := []string{}
+	record := func(kind, name, ns string, err error) error {
+		if k8serrors.IsAlreadyExists(err) {
+			logging.Log.Debugf("%s %s of starter %s already exists in namespace %s", kind, name, s.Name, ns)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error creating %s %s of starter %s in namespace %s: %s", kind, name, s.Name, ns, err)
+		}
+		created = append(created, fmt.Sprintf("%s %s/%s", kind, ns, name))
+		return nil
+	}
+	for _, task := range resources.tasks {
+		task.ObjectMeta = starterMeta(task.ObjectMeta, namespace, s.Name)
+		_, err := r.TektonClient.TektonV1alpha1().Tasks(namespace).Create(&task)
+		if err := record("task", task.Name, namespace, err); err != nil {
+			return created, err
+		}
+	}
+	for _, template := range resources.templates {
+		template.ObjectMeta = starterMeta(template.ObjectMeta, installNs, s.Name)
+		_, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Create(&template)
+		if err := record("triggertemplate", template.Name, installNs, err); err != nil {
+			return created, err
+		}
+	}
+	for _, binding := range resources.bindings {
+		binding.ObjectMeta = starterMeta(binding.ObjectMeta, installNs, s.Name)
+		_, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Create(&binding)
+		if err := record("triggerbinding", binding.Name, installNs, err); err != nil {
+			return created, err
+		}
+	}
+	// The pipeline last, so that a webhook retried after a failure installs what is missing
+	for _, pipeline := range resources.pipelines {
+		pipeline.ObjectMeta = starterMeta(pipeline.ObjectMeta, namespace, s.Name)
+		_, err := r.TektonClient.TektonV1alpha1().Pipelines(namespace).Create(&pipeline)
+		if err := record("pipeline", pipeline.Name, namespace, err); err != nil {
+			return created, err
+		}
+	}
+	logging.Log.Infof("installed starter %s: %v", s.Name, created)
+	return created, nil
+}
+
+// GET /webhooks/starters
+func (r Resource) getAllStarters(request *restful.Request, response *restful.Response) {
+	starters, err := r.getStarters()
+	if err != nil {
+		logging.Log.Errorf("error: %s", err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	list := []starter{}
+	for _, s := range starters {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	response.WriteEntity(list)
+}
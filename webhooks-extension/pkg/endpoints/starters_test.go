@@ -0,0 +1,172 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const mavenStarter = `apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: maven
+---
+apiVersion: tekton.dev/v1alpha1
+kind: Pipeline
+metadata:
+  name: maven-build
+spec:
+  tasks:
+  - name: build
+    taskRef:
+      name: maven
+---
+apiVersion: triggers.tekton.dev/v1alpha1
+kind: TriggerTemplate
+metadata:
+  name: maven-build-template
+---
+apiVersion: triggers.tekton.dev/v1alpha1
+kind: TriggerBinding
+metadata:
+  name: maven-build-push-binding
+---
+apiVersion: triggers.tekton.dev/v1alpha1
+kind: TriggerBinding
+metadata:
+  name: maven-build-pullrequest-binding
+`
+
+func TestChooseStarter(t *testing.T) {
+	starters := map[string]starter{
+		"docker": {Name: "docker", Pipeline: "docker-build", BuildFiles: []string{"Dockerfile"}},
+		"maven":  {Name: "maven", Pipeline: "maven-build", BuildFiles: []string{"pom.xml"}},
+		"java":   {Name: "java", Pipeline: "java-build", BuildFiles: []string{"pom.xml", "build.gradle"}},
+	}
+	if s, err := chooseStarter(starters, autoStarter, []string{"README.md", "pom.xml"}); err != nil || s.Name != "java" {
+		t.Errorf("expected the first starter by name building pom.xml, got %+v, %v", s, err)
+	}
+	if s, err := chooseStarter(starters, "maven", nil); err != nil || s.Name != "maven" {
+		t.Errorf("expected the named starter, got %+v, %v", s, err)
+	}
+	if _, err := chooseStarter(starters, autoStarter, []string{"package.json"}); err == nil {
+		t.Error("expected no starter for package.json")
+	}
+	if _, err := chooseStarter(starters, "gradle", nil); err == nil {
+		t.Error("expected an unknown starter to be refused")
+	}
+}
+
+func TestStarterResourcesParse(t *testing.T) {
+	resources := starterResources{}
+	if err := resources.parse("maven.yaml", []byte(mavenStarter)); err != nil {
+		t.Fatal(err)
+	}
+	if len(resources.tasks) != 1 || len(resources.pipelines) != 1 || len(resources.templates) != 1 || len(resources.bindings) != 2 {
+		t.Errorf("unexpected resources %+v", resources)
+	}
+	if err := resources.parse("role.yaml", []byte("apiVersion: rbac.authorization.k8s.io/v1\nkind: Role\nmetadata:\n  name: admin\n")); err == nil {
+		t.Error("expected a starter defining a role to be refused")
+	}
+}
+
+func TestCreateWebhookInstallsStarter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("GIT_PROVIDER_MODE", "replay")
+	os.Setenv("GIT_PROVIDER_RECORDINGS_DIR", dir)
+	defer os.Unsetenv("GIT_PROVIDER_MODE")
+	defer os.Unsetenv("GIT_PROVIDER_RECORDINGS_DIR")
+
+	fetched := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fetched++
+		fmt.Fprint(w, mavenStarter)
+	}))
+	defer server.Close()
+
+	r := dummyResource()
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	createTriggerResources(webhook{Pipeline: "unused", AccessTokenRef: "token1"}, r)
+	r.K8sClient.CoreV1().ConfigMaps(installNs).Create(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: startersConfigMap, Namespace: installNs},
+		Data: map[string]string{
+			"maven":  fmt.Sprintf(`{"pipeline": "maven-build", "buildfiles": ["pom.xml"], "urls": ["%s/maven.yaml"]}`, server.URL),
+			"docker": `{"pipeline": "docker-build", "buildfiles": ["Dockerfile"], "urls": ["http://localhost:1/docker.yaml"]}`,
+		},
+	})
+	if err := saveRecording(testRecordingPath(t, "github", "owner", "repo"), recording{Files: map[string]string{"pom.xml": "<project/>"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/owner/repo",
+		AccessTokenRef:   "token1",
+		Starter:          autoStarter,
+	}
+	// Nothing is installed for a webhook that isn't valid
+	invalid := hook
+	invalid.MainPipeline = "missing"
+	if resp := createWebhook(invalid, r); resp.StatusCode() != http.StatusBadRequest {
+		t.Fatalf("creating a webhook with a missing mainbranchpipeline returned %d", resp.StatusCode())
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get("maven-build-template", metav1.GetOptions{}); err == nil {
+		t.Error("expected the starter not to be installed for an invalid webhook")
+	}
+	if _, err := r.TektonClient.TektonV1alpha1().Pipelines(installNs).Get("maven-build", metav1.GetOptions{}); err == nil {
+		t.Error("expected the starter's pipeline not to be installed for an invalid webhook")
+	}
+
+	if resp := createWebhook(hook, r); resp.StatusCode() != http.StatusCreated {
+		t.Fatalf("creating a webhook with a starter returned %d", resp.StatusCode())
+	}
+	pipeline, err := r.TektonClient.TektonV1alpha1().Pipelines(installNs).Get("maven-build", metav1.GetOptions{})
+	if err != nil || pipeline.Labels[starterLabel] != "maven" {
+		t.Errorf("expected pipeline maven-build to be installed by starter maven, got %+v, %v", pipeline, err)
+	}
+	if _, err := r.TektonClient.TektonV1alpha1().Tasks(installNs).Get("maven", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected task maven to be installed: %s", err)
+	}
+	hooks, _ := r.getWebhooksFromEventListener()
+	if len(hooks) != 1 || hooks[0].Pipeline != "maven-build" {
+		t.Errorf("expected the webhook to run maven-build, got %+v", hooks)
+	}
+
+	// The pipeline is in the namespace now, so it isn't installed again
+	hook.Name = "other"
+	hook.GitRepositoryURL = "https://github.com/owner/other"
+	hook.Starter = "maven"
+	if resp := createWebhook(hook, r); resp.StatusCode() != http.StatusCreated || fetched != 2 {
+		t.Errorf("creating a second webhook with the starter returned %d, fetching its files %d times", resp.StatusCode(), fetched)
+	}
+
+	hook.Name = "third"
+	hook.Pipeline = "unused"
+	if resp := createWebhook(hook, r); resp.StatusCode() != http.StatusBadRequest {
+		t.Errorf("creating a webhook whose pipeline isn't its starter's returned %d", resp.StatusCode())
+	}
+}
@@ -0,0 +1,539 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+/*--------------------------------------
+This file implements the following endpoints:
+	ws.Route(ws.GET("/{name}/stats").To(r.getWebhookStats))  (webhook.go)
+	GET /metrics                                            (RegisterMetricsWebService)
+Every statsRecordInterval the extension records the outcome and duration of
+each webhook's PipelineRuns that have completed, identified by the labels
+described in docs/Labels.md, in the <prefix>stats-<eventlistener> configmap,
+so runs still count once they are pruned. A run is annotated with the
+outcome recorded for it, which is recorded again if it changes: a failure
+the monitor reruns becomes retried, a success whose follow-ups start becomes
+followedup. Durations are kept as histogram buckets, from which the p50 and
+p95 durations are estimated. Running PipelineRuns are counted as of the
+last recording.
+---------------------------------------*/
+
+const (
+	// Set on a PipelineRun once its outcome is recorded in the stats, to the outcome
+	statsRecordedAnnotation = "webhooks.tekton.dev/statsRecorded"
+	// Follows the resource prefix in the name of the stats configmap
+	statsPrefix         = "stats-"
+	statsRecordInterval = 30 * time.Second
+
+	outcomeSucceeded  = "succeeded"
+	outcomeFailed     = "failed"
+	outcomeRetried    = "retried"
+	outcomeFollowedUp = "followedup"
+)
+
+// Upper bounds, in seconds, of the buckets PipelineRun durations are counted in, as well as +Inf
+var durationBuckets = []float64{30, 60, 120, 300, 600, 1200, 1800, 3600, 7200}
+
+// webhookStats summarises the PipelineRuns of a webhook
+type webhookStats struct {
+	Name        string        `json:"name"`
+	Namespace   string        `json:"namespace"`
+	Repository  string        `json:"gitrepositoryurl"`
+	Pipeline    string        `json:"pipeline"`
+	Total       int           `json:"total"`
+	Succeeded   int           `json:"succeeded"`
+	Failed      int           `json:"failed"`
+	Running     int           `json:"running"`
+	Retried     int           `json:"retried"`
+	Flaky       int           `json:"flaky"`
+	FollowedUp  int           `json:"followedup"`
+	SuccessRate float64       `json:"successrate"`
+	P50Duration float64       `json:"p50durationseconds"`
+	P95Duration float64       `json:"p95durationseconds"`
+	LastFailure *runReference `json:"lastfailure,omitempty"`
+	// The durations of completed PipelineRuns, for the Prometheus histogram
+	Durations durationHistogram `json:"-"`
+}
+
+type runReference struct {
+	PipelineRun    string      `json:"pipelinerun"`
+	CompletionTime metav1.Time `json:"completiontime"`
+	Reason         string      `json:"reason,omitempty"`
+	Message        string      `json:"message,omitempty"`
+}
+
+// recordedStats are the counts kept for a webhook in the stats configmap
+type recordedStats struct {
+	Succeeded   int               `json:"succeeded"`
+	Failed      int               `json:"failed"`
+	Running     int               `json:"running"`
+	Retried     int               `json:"retried"`
+	Flaky       int               `json:"flaky"`
+	FollowedUp  int               `json:"followedup"`
+	Durations   durationHistogram `json:"durations"`
+	LastFailure *runReference     `json:"lastfailure,omitempty"`
+}
+
+// durationHistogram counts durations in durationBuckets, each bucket counting those at most its bound
+type durationHistogram struct {
+	Buckets []int   `json:"buckets"`
+	Count   int     `json:"count"`
+	Sum     float64 `json:"sum"`
+}
+
+func (h *durationHistogram) observe(seconds float64) {
+	if len(h.Buckets) != len(durationBuckets) {
+		h.Buckets = make([]int, len(durationBuckets))
+	}
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.Buckets[i] = h.Buckets[i] + 1
+		}
+	}
+	h.Count = h.Count + 1
+	h.Sum = h.Sum + seconds
+}
+
+// quantile estimates the q quantile by interpolating within the bucket it falls in, as Prometheus'
+// histogram_quantile does. Durations beyond the last bucket are reported as its bound.
+func (h durationHistogram) quantile(q float64) float64 {
+	if h.Count == 0 || len(h.Buckets) != len(durationBuckets) {
+		return 0
+	}
+	rank := q * float64(h.Count)
+	lowerBound, lowerCount := 0.0, 0
+	for i, bound := range durationBuckets {
+		if float64(h.Buckets[i]) >= rank {
+			inBucket := h.Buckets[i] - lowerCount
+			if inBucket == 0 {
+				return bound
+			}
+			return lowerBound + (bound-lowerBound)*(rank-float64(lowerCount))/float64(inBucket)
+		}
+		lowerBound, lowerCount = bound, h.Buckets[i]
+	}
+	return durationBuckets[len(durationBuckets)-1]
+}
+
+// statsKey is the key of a webhook's stats in the stats configmap
+func statsKey(hook webhook) string {
+	return hook.Namespace + "." + hook.Name
+}
+
+// GET /webhooks/{name}/stats?namespace=<namespace>
+func (r Resource) getWebhookStats(request *restful.Request, response *restful.Response) {
+	name := request.PathParameter("name")
+	namespace := request.QueryParameter("namespace")
+	if namespace == "" {
+		theError := errors.New("bad request information provided, a namespace must be specified as a query parameter")
+		logging.Log.Error(theError)
+		RespondError(response, theError, http.StatusBadRequest)
+		return
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error trying to get webhooks: %s.", err.Error())
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	for _, hook := range hooks {
+		if hook.Name == name && hook.Namespace == namespace {
+			recorded, err := r.getRecordedStats()
+			if err != nil {
+				logging.Log.Errorf("error reading configmap %s: %s", r.statsConfigMapName(), err)
+				RespondError(response, err, http.StatusInternalServerError)
+				return
+			}
+			response.WriteEntity(summariseStats(hook, recorded[statsKey(hook)]))
+			return
+		}
+	}
+	err = fmt.Errorf("no webhook found with name %s associated with namespace %s", name, namespace)
+	logging.Log.Error(err)
+	RespondError(response, err, http.StatusNotFound)
+}
+
+// summariseStats works out the statistics of a webhook from its recorded counts
+func summariseStats(hook webhook, recorded recordedStats) webhookStats {
+	stats := webhookStats{
+		Name:        hook.Name,
+		Namespace:   hook.Namespace,
+		Repository:  hook.GitRepositoryURL,
+		Pipeline:    hook.Pipeline,
+		Total:       recorded.Succeeded + recorded.Failed + recorded.Retried + recorded.Running,
+		Succeeded:   recorded.Succeeded,
+		Failed:      recorded.Failed,
+		Running:     recorded.Running,
+		Retried:     recorded.Retried,
+		Flaky:       recorded.Flaky,
+		FollowedUp:  recorded.FollowedUp,
+		P50Duration: recorded.Durations.quantile(0.5),
+		P95Duration: recorded.Durations.quantile(0.95),
+		LastFailure: recorded.LastFailure,
+		Durations:   recorded.Durations,
+	}
+	if finished := stats.Succeeded + stats.Failed; finished > 0 {
+		stats.SuccessRate = float64(stats.Succeeded) / float64(finished)
+	}
+	return stats
+}
+
+func (r Resource) statsConfigMapName() string {
+	return r.resourcePrefix() + statsPrefix + r.eventListenerName()
+}
+
+// getRecordedStats returns the recorded stats of every webhook by statsKey, none if nothing has been recorded
+func (r Resource) getRecordedStats() (map[string]recordedStats, error) {
+	recorded := make(map[string]recordedStats)
+	cm, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(r.statsConfigMapName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return recorded, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range cm.Data {
+		stats := recordedStats{}
+		if err := json.Unmarshal([]byte(value), &stats); err != nil {
+			logging.Log.Errorf("ignoring the stats of %s in configmap %s: %s", key, r.statsConfigMapName(), err)
+			continue
+		}
+		recorded[key] = stats
+	}
+	return recorded, nil
+}
+
+// saveRecordedStats replaces the stats configmap's data with recorded, creating it if missing
+func (r Resource) saveRecordedStats(recorded map[string]recordedStats) error {
+	data := make(map[string]string)
+	for key, stats := range recorded {
+		value, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		data[key] = string(value)
+	}
+	configMaps := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace)
+	cm, err := configMaps.Get(r.statsConfigMapName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: r.statsConfigMapName(), Namespace: r.Defaults.Namespace, Labels: managedLabels()},
+			Data:       data,
+		}
+		_, err = configMaps.Create(cm)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	cm.Data = data
+	_, err = configMaps.Update(cm)
+	return err
+}
+
+// RecordPipelineRunStats records the outcomes of webhooks' completed PipelineRuns until stopCh is closed
+func (r Resource) RecordPipelineRunStats(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(statsRecordInterval)
+	defer ticker.Stop()
+	for {
+		for _, profiled := range r.allProfiles() {
+			profiled.recordPipelineRunStats()
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordPipelineRunStats adds the outcomes of webhooks' PipelineRuns not yet recorded, or whose outcome has
+// changed, to the stats configmap, then annotates the runs with them. Webhooks that no longer exist are dropped.
+func (r Resource) recordPipelineRunStats() {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error getting webhooks to record stats for: %s", err)
+		return
+	}
+	runsByNamespace := make(map[string][]pipelinesv1alpha1.PipelineRun)
+	for _, hook := range hooks {
+		if _, listed := runsByNamespace[hook.Namespace]; listed {
+			continue
+		}
+		pipelineRuns, err := r.TektonClient.TektonV1alpha1().PipelineRuns(hook.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			logging.Log.Errorf("error listing PipelineRuns in namespace %s to record stats: %s", hook.Namespace, err)
+			continue
+		}
+		runsByNamespace[hook.Namespace] = pipelineRuns.Items
+	}
+
+	// Held while the stats are updated so webhooks renamed or deleted meanwhile don't lose or keep theirs
+	modifyingEventListenerLock.Lock()
+	annotate, err := r.recordOutcomes(runsByNamespace)
+	modifyingEventListenerLock.Unlock()
+	if err != nil {
+		logging.Log.Errorf("error recording stats in configmap %s: %s", r.statsConfigMapName(), err)
+		return
+	}
+	for _, pipelineRun := range annotate {
+		if _, err := r.TektonClient.TektonV1alpha1().PipelineRuns(pipelineRun.Namespace).Update(pipelineRun); err != nil {
+			logging.Log.Errorf("error annotating PipelineRun %s in namespace %s with its recorded outcome: %s", pipelineRun.Name, pipelineRun.Namespace, err)
+		}
+	}
+}
+
+// recordOutcomes saves the stats of the current webhooks with the outcomes of their PipelineRuns in runsByNamespace,
+// returning the runs to annotate with their recorded outcome. Must be called holding modifyingEventListenerLock.
+func (r Resource) recordOutcomes(runsByNamespace map[string][]pipelinesv1alpha1.PipelineRun) ([]*pipelinesv1alpha1.PipelineRun, error) {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		return nil, err
+	}
+	previous, err := r.getRecordedStats()
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := make(map[string]recordedStats)
+	annotate := []*pipelinesv1alpha1.PipelineRun{}
+	for _, hook := range hooks {
+		stats := previous[statsKey(hook)]
+		runs, listed := runsByNamespace[hook.Namespace]
+		if !listed {
+			recorded[statsKey(hook)] = stats
+			continue
+		}
+		stats.Running = 0
+		for i := range runs {
+			pipelineRun := &runs[i]
+			if !isWebhookPipelineRun(*pipelineRun, hook.GitRepositoryURL, hook.Pipeline) {
+				continue
+			}
+			outcome := pipelineRunOutcome(*pipelineRun)
+			if outcome == "" {
+				stats.Running = stats.Running + 1
+				continue
+			}
+			if recordOutcome(&stats, *pipelineRun, pipelineRun.Annotations[statsRecordedAnnotation], outcome) {
+				if pipelineRun.Annotations == nil {
+					pipelineRun.Annotations = map[string]string{}
+				}
+				pipelineRun.Annotations[statsRecordedAnnotation] = outcome
+				annotate = append(annotate, pipelineRun)
+			}
+		}
+		recorded[statsKey(hook)] = stats
+	}
+
+	// Saved before annotating, a run is counted twice rather than missed if the extension stops in between
+	return annotate, r.saveRecordedStats(recorded)
+}
+
+// renameRecordedStats moves the stats of hook to renamed. Must be called holding modifyingEventListenerLock.
+func (r Resource) renameRecordedStats(hook, renamed webhook) error {
+	recorded, err := r.getRecordedStats()
+	if err != nil {
+		return err
+	}
+	stats, found := recorded[statsKey(hook)]
+	if !found {
+		return nil
+	}
+	delete(recorded, statsKey(hook))
+	recorded[statsKey(renamed)] = stats
+	return r.saveRecordedStats(recorded)
+}
+
+// pipelineRunOutcome is the outcome of a completed PipelineRun, empty while it runs
+func pipelineRunOutcome(pipelineRun pipelinesv1alpha1.PipelineRun) string {
+	condition := pipelineRun.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status == corev1.ConditionUnknown {
+		return ""
+	}
+	if condition.Status == corev1.ConditionTrue {
+		if pipelineRun.Annotations[followUpsAnnotation] != "" {
+			return outcomeFollowedUp
+		}
+		return outcomeSucceeded
+	}
+	// Failures rerun by a retry policy are not counted as failures
+	if pipelineRun.Annotations[retriedAnnotation] == "true" {
+		return outcomeRetried
+	}
+	return outcomeFailed
+}
+
+// recordOutcome adds the outcome of a completed PipelineRun to stats, or moves it from the outcome recorded
+// before, returning whether anything changed
+func recordOutcome(stats *recordedStats, pipelineRun pipelinesv1alpha1.PipelineRun, before, outcome string) bool {
+	if before == outcome {
+		return false
+	}
+	switch {
+	case before == outcomeFailed && outcome == outcomeRetried:
+		stats.Failed = stats.Failed - 1
+		stats.Retried = stats.Retried + 1
+		return true
+	case before == outcomeSucceeded && outcome == outcomeFollowedUp:
+		stats.FollowedUp = stats.FollowedUp + 1
+		return true
+	case before != "":
+		// Outcomes don't change otherwise, leave what was recorded
+		return false
+	}
+
+	switch outcome {
+	case outcomeSucceeded, outcomeFollowedUp:
+		stats.Succeeded = stats.Succeeded + 1
+		if outcome == outcomeFollowedUp {
+			stats.FollowedUp = stats.FollowedUp + 1
+		}
+		if pipelineRun.Annotations[retryOfAnnotation] != "" {
+			stats.Flaky = stats.Flaky + 1
+		}
+	case outcomeRetried:
+		stats.Retried = stats.Retried + 1
+	case outcomeFailed:
+		stats.Failed = stats.Failed + 1
+	}
+	if pipelineRun.Status.StartTime == nil || pipelineRun.Status.CompletionTime == nil {
+		return true
+	}
+	completed := *pipelineRun.Status.CompletionTime
+	stats.Durations.observe(completed.Sub(pipelineRun.Status.StartTime.Time).Seconds())
+	if outcome == outcomeFailed && (stats.LastFailure == nil || stats.LastFailure.CompletionTime.Before(&completed)) {
+		condition := pipelineRun.Status.GetCondition(apis.ConditionSucceeded)
+		stats.LastFailure = &runReference{
+			PipelineRun:    pipelineRun.Name,
+			CompletionTime: completed,
+			Reason:         condition.Reason,
+			Message:        condition.Message,
+		}
+	}
+	return true
+}
+
+// getMetrics writes the statistics of every webhook in the Prometheus text format
+func (r Resource) getMetrics(request *restful.Request, response *restful.Response) {
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		logging.Log.Errorf("error trying to get webhooks: %s.", err.Error())
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	recorded, err := r.getRecordedStats()
+	if err != nil {
+		logging.Log.Errorf("error reading configmap %s: %s", r.statsConfigMapName(), err)
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+
+	allStats := []webhookStats{}
+	for _, hook := range hooks {
+		allStats = append(allStats, summariseStats(hook, recorded[statsKey(hook)]))
+	}
+
+	response.AddHeader("Content-Type", "text/plain; version=0.0.4")
+	response.Write(append(append(formatMetrics(allStats), formatPanicMetrics()...), formatInfraRepairMetrics()...))
+}
+
+func formatMetrics(allStats []webhookStats) []byte {
+	var buf bytes.Buffer
+	metric := func(name, kind, help string, value func(webhookStats) []string) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, stats := range allStats {
+			for _, line := range value(stats) {
+				fmt.Fprintf(&buf, "%s\n", line)
+			}
+		}
+	}
+	labels := func(stats webhookStats, extra ...string) string {
+		pairs := []string{
+			fmt.Sprintf("webhook=%q", stats.Name),
+			fmt.Sprintf("namespace=%q", stats.Namespace),
+			fmt.Sprintf("repository=%q", stats.Repository),
+			fmt.Sprintf("pipeline=%q", stats.Pipeline),
+		}
+		return "{" + strings.Join(append(pairs, extra...), ",") + "}"
+	}
+
+	name := "webhooks_extension_pipelineruns_total"
+	metric(name, "counter", "Completed PipelineRuns triggered by the webhook, by status.", func(s webhookStats) []string {
+		return []string{
+			fmt.Sprintf("%s%s %d", name, labels(s, `status="succeeded"`), s.Succeeded),
+			fmt.Sprintf("%s%s %d", name, labels(s, `status="failed"`), s.Failed),
+			fmt.Sprintf("%s%s %d", name, labels(s, `status="retried"`), s.Retried),
+		}
+	})
+	metric("webhooks_extension_pipelineruns_running", "gauge", "PipelineRuns triggered by the webhook that are running.", func(s webhookStats) []string {
+		return []string{fmt.Sprintf("webhooks_extension_pipelineruns_running%s %d", labels(s), s.Running)}
+	})
+	metric("webhooks_extension_pipelinerun_flaky_total", "counter", "Succeeded PipelineRuns of the webhook that were reruns of a failure.", func(s webhookStats) []string {
+		return []string{fmt.Sprintf("webhooks_extension_pipelinerun_flaky_total%s %d", labels(s), s.Flaky)}
+	})
+	metric("webhooks_extension_pipelinerun_success_ratio", "gauge", "Fraction of the webhook's completed PipelineRuns that succeeded.", func(s webhookStats) []string {
+		return []string{fmt.Sprintf("webhooks_extension_pipelinerun_success_ratio%s %g", labels(s), s.SuccessRate)}
+	})
+	name = "webhooks_extension_pipelinerun_duration_seconds"
+	metric(name, "histogram", "Duration of the webhook's completed PipelineRuns.", func(s webhookStats) []string {
+		lines := []string{}
+		for i, bound := range durationBuckets {
+			count := 0
+			if i < len(s.Durations.Buckets) {
+				count = s.Durations.Buckets[i]
+			}
+			lines = append(lines, fmt.Sprintf("%s_bucket%s %d", name, labels(s, fmt.Sprintf("le=%q", strconv.FormatFloat(bound, 'g', -1, 64))), count))
+		}
+		return append(lines,
+			fmt.Sprintf("%s_bucket%s %d", name, labels(s, `le="+Inf"`), s.Durations.Count),
+			fmt.Sprintf("%s_sum%s %g", name, labels(s), s.Durations.Sum),
+			fmt.Sprintf("%s_count%s %d", name, labels(s), s.Durations.Count))
+	})
+	metric("webhooks_extension_last_failure_timestamp_seconds", "gauge", "Completion time of the webhook's most recent failed PipelineRun.", func(s webhookStats) []string {
+		if s.LastFailure == nil {
+			return nil
+		}
+		return []string{fmt.Sprintf("webhooks_extension_last_failure_timestamp_seconds%s %d", labels(s), s.LastFailure.CompletionTime.Unix())}
+	})
+	return buf.Bytes()
+}
+
+// RegisterMetricsWebService registers the Prometheus metrics web service
+func (r Resource) RegisterMetricsWebService(container *restful.Container) {
+	ws := new(restful.WebService)
+	ws.Path("/metrics")
+	ws.Route(ws.GET("").To(r.getMetrics))
+
+	container.Add(ws)
+}
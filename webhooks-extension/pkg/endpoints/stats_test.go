@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+func statsPipelineRun(name string, status corev1.ConditionStatus, seconds int, completed time.Time) pipelinesv1alpha1.PipelineRun {
+	pipelineRun := pipelinesv1alpha1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: installNs,
+			Labels: map[string]string{
+				"webhooks.tekton.dev/gitServer": "github.com",
+				"webhooks.tekton.dev/gitOrg":    "owner",
+				"webhooks.tekton.dev/gitRepo":   "repo",
+			},
+		},
+		Spec: pipelinesv1alpha1.PipelineRunSpec{
+			PipelineRef: &pipelinesv1alpha1.PipelineRef{Name: "pipeline"},
+		},
+	}
+	pipelineRun.Status.SetCondition(&apis.Condition{
+		Type:   apis.ConditionSucceeded,
+		Status: status,
+		Reason: "Reason" + name,
+	})
+	if status != corev1.ConditionUnknown {
+		pipelineRun.Status.StartTime = &metav1.Time{Time: completed.Add(-time.Duration(seconds) * time.Second)}
+		pipelineRun.Status.CompletionTime = &metav1.Time{Time: completed}
+	}
+	return pipelineRun
+}
+
+func TestRecordPipelineRunStats(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline"}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	if _, err := r.createEventListener(hook, installNs, "owner.repo-"); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	runs := []pipelinesv1alpha1.PipelineRun{
+		statsPipelineRun("run1", corev1.ConditionTrue, 10, now.Add(-4*time.Hour)),
+		statsPipelineRun("run2", corev1.ConditionFalse, 20, now.Add(-3*time.Hour)),
+		statsPipelineRun("run3", corev1.ConditionTrue, 30, now.Add(-2*time.Hour)),
+		statsPipelineRun("run4", corev1.ConditionFalse, 40, now.Add(-1*time.Hour)),
+		statsPipelineRun("run5", corev1.ConditionUnknown, 0, now),
+	}
+	retried := statsPipelineRun("run6", corev1.ConditionFalse, 50, now.Add(-2*time.Hour))
+	retried.Annotations = map[string]string{retriedAnnotation: "true"}
+	rerun := statsPipelineRun("run7", corev1.ConditionTrue, 10, now.Add(-1*time.Hour))
+	rerun.Annotations = map[string]string{retryOfAnnotation: "run6", retryAttemptAnnotation: "1"}
+	runs = append(runs, retried, rerun)
+	runs[0].Annotations = map[string]string{followUpsAnnotation: "deploy-run-x7kq2"}
+	other := statsPipelineRun("other", corev1.ConditionTrue, 10, now)
+	other.Spec.PipelineRef.Name = "another-pipeline"
+	runs = append(runs, other)
+	pipelineRuns := r.TektonClient.TektonV1alpha1().PipelineRuns(installNs)
+	for _, run := range runs {
+		if _, err := pipelineRuns.Create(&run); err != nil {
+			t.Fatalf("error creating pipelinerun: %s", err.Error())
+		}
+	}
+
+	r.recordPipelineRunStats()
+	recorded, err := r.getRecordedStats()
+	if err != nil {
+		t.Fatalf("error reading stats: %s", err.Error())
+	}
+	stats := summariseStats(hook, recorded[statsKey(hook)])
+	if stats.Total != 7 || stats.Succeeded != 3 || stats.Failed != 2 || stats.Running != 1 || stats.Retried != 1 || stats.Flaky != 1 || stats.FollowedUp != 1 {
+		t.Errorf("unexpected counts %+v", stats)
+	}
+	if stats.SuccessRate != 0.6 {
+		t.Errorf("success rate was %g, expected 0.6", stats.SuccessRate)
+	}
+	if stats.P50Duration != 22.5 || stats.P95Duration != 55.5 {
+		t.Errorf("durations were p50 %g p95 %g, expected 22.5 and 55.5", stats.P50Duration, stats.P95Duration)
+	}
+	if stats.LastFailure == nil || stats.LastFailure.PipelineRun != "run4" || stats.LastFailure.Reason != "Reasonrun4" {
+		t.Errorf("last failure was %+v, expected run4", stats.LastFailure)
+	}
+	if run, err := pipelineRuns.Get("run1", metav1.GetOptions{}); err != nil || run.Annotations[statsRecordedAnnotation] != outcomeFollowedUp {
+		t.Errorf("run1 not annotated with its outcome: %+v, %v", run, err)
+	}
+
+	// Pruned runs stay counted, a failure rerun since is moved to retried and a success followed up since is counted
+	if err := pipelineRuns.Delete("run1", &metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting pipelinerun: %s", err.Error())
+	}
+	run2, _ := pipelineRuns.Get("run2", metav1.GetOptions{})
+	run2.Annotations[retriedAnnotation] = "true"
+	pipelineRuns.Update(run2)
+	run3, _ := pipelineRuns.Get("run3", metav1.GetOptions{})
+	run3.Annotations[followUpsAnnotation] = "deploy-run-b8wz4"
+	pipelineRuns.Update(run3)
+
+	r.recordPipelineRunStats()
+	recorded, err = r.getRecordedStats()
+	if err != nil {
+		t.Fatalf("error reading stats: %s", err.Error())
+	}
+	stats = summariseStats(hook, recorded[statsKey(hook)])
+	if stats.Succeeded != 3 || stats.Failed != 1 || stats.Retried != 2 || stats.FollowedUp != 2 || stats.Durations.Count != 6 {
+		t.Errorf("unexpected counts after recording again %+v", stats)
+	}
+
+	metrics := string(formatMetrics([]webhookStats{stats}))
+	for _, expected := range []string{
+		`webhooks_extension_pipelineruns_total{webhook="hook",namespace="` + installNs + `",repository="https://github.com/owner/repo",pipeline="pipeline",status="failed"} 1`,
+		`# TYPE webhooks_extension_pipelinerun_duration_seconds histogram`,
+		`webhooks_extension_pipelinerun_duration_seconds_bucket{webhook="hook",namespace="` + installNs + `",repository="https://github.com/owner/repo",pipeline="pipeline",le="30"} 4`,
+		`webhooks_extension_pipelinerun_duration_seconds_count{webhook="hook",namespace="` + installNs + `",repository="https://github.com/owner/repo",pipeline="pipeline"} 6`,
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("metrics did not contain %s, metrics were:\n%s", expected, metrics)
+		}
+	}
+}
+
+func TestDurationHistogramQuantile(t *testing.T) {
+	histogram := durationHistogram{}
+	if q := histogram.quantile(0.95); q != 0 {
+		t.Errorf("p95 of nothing was %g, expected 0", q)
+	}
+	for _, seconds := range []float64{10, 20, 40, 50, 100000} {
+		histogram.observe(seconds)
+	}
+	if q := histogram.quantile(0.5); q != 37.5 {
+		t.Errorf("p50 was %g, expected 37.5", q)
+	}
+	if q := histogram.quantile(0.95); q != durationBuckets[len(durationBuckets)-1] {
+		t.Errorf("p95 was %g, expected the largest bucket", q)
+	}
+}
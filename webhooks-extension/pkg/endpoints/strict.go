@@ -0,0 +1,151 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+)
+
+/*--------------------------------------
+Request bodies are read leniently by default, as encoding/json reads them:
+fields that aren't known are dropped and field names match whatever their
+case, so a typo such as "servceaccount" is silently ignored. A request with
+the Wext-Strict-Decoding: true header is read strictly, every field that
+isn't known, or is a legacy spelling differing in case such as
+"serviceAccount", being listed in a 400 response. STRICT_DECODING=true on
+the extension deployment makes strict the default, old clients opting out
+with Wext-Strict-Decoding: false.
+---------------------------------------*/
+
+const strictDecodingHeader = "Wext-Strict-Decoding"
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// readEntity reads the request body into entity, strictly if the request or install asks for it
+func readEntity(request *restful.Request, entity interface{}) error {
+	if !strictDecoding(request) {
+		return request.ReadEntity(entity)
+	}
+	body, err := ioutil.ReadAll(request.Request.Body)
+	if err != nil {
+		return err
+	}
+	request.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if fields := unrecognizedFields(body, reflect.TypeOf(entity), ""); len(fields) > 0 {
+		return newMessageError("UNRECOGNIZED_FIELDS", map[string]string{"fields": strings.Join(fields, ", ")})
+	}
+	return request.ReadEntity(entity)
+}
+
+func strictDecoding(request *restful.Request) bool {
+	if value := request.HeaderParameter(strictDecodingHeader); value != "" {
+		return strings.ToLower(value) == "true"
+	}
+	return strings.ToLower(os.Getenv("STRICT_DECODING")) == "true"
+}
+
+// unrecognizedFields lists the fields of the JSON that don't exactly name a field of t, prefixed by their path.
+// Values that aren't objects or arrays where t expects them are left for decoding to refuse.
+func unrecognizedFields(data []byte, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+	unrecognized := []string{}
+	switch t.Kind() {
+	case reflect.Struct:
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil
+		}
+		fields := jsonFields(t)
+		keys := []string{}
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			field, found := fields[key]
+			if !found {
+				unrecognized = append(unrecognized, path+key)
+				continue
+			}
+			unrecognized = append(unrecognized, unrecognizedFields(object[key], field, path+key+".")...)
+		}
+	case reflect.Slice, reflect.Array:
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil
+		}
+		for i, item := range items {
+			unrecognized = append(unrecognized, unrecognizedFields(item, t.Elem(), fmt.Sprintf("%s[%d].", strings.TrimSuffix(path, "."), i))...)
+		}
+	case reflect.Map:
+		values := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil
+		}
+		for key, value := range values {
+			unrecognized = append(unrecognized, unrecognizedFields(value, t.Elem(), path+key+".")...)
+		}
+		sort.Strings(unrecognized)
+	}
+	return unrecognized
+}
+
+// jsonFields maps the JSON names of a struct's fields, including those of embedded structs, to their types
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for embeddedName, embeddedType := range jsonFields(embedded) {
+					if _, shadowed := fields[embeddedName]; !shadowed {
+						fields[embeddedName] = embeddedType
+					}
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
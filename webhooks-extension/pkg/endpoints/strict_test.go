@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnrecognizedFields(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected []string
+	}{
+		{`{"name":"hook","serviceaccount":"builder","retrypolicy":{"maxretries":2}}`, []string{}},
+		{`{"name":"hook","servceaccount":"builder","serviceAccount":"builder"}`, []string{"servceaccount", "serviceAccount"}},
+		{`{"retrypolicy":{"maxretrys":2},"canary":{"pipeline":"p","percent":5}}`, []string{"canary.percent", "retrypolicy.maxretrys"}},
+		{`{"interceptors":[{"cel":{"filter":"true"}},{"cel":{"filtre":"true"}}]}`, []string{"interceptors[1].cel.filtre"}},
+		{`{"pipelinerunoverrides":{"nodeselector":{"pool":"ci"},"timout":"1h"}}`, []string{"pipelinerunoverrides.timout"}},
+		// Values of the wrong type are for decoding to refuse
+		{`{"retrypolicy":"often"}`, []string{}},
+	}
+	for _, tt := range tests {
+		fields := unrecognizedFields([]byte(tt.body), reflect.TypeOf(&webhook{}), "")
+		if !reflect.DeepEqual(fields, tt.expected) {
+			t.Errorf("unrecognized fields of %s were %v, expected %v", tt.body, fields, tt.expected)
+		}
+	}
+}
+
+func TestReadEntityStrictly(t *testing.T) {
+	body := `{"name":"hook","namespace":"ns","servceaccount":"builder"}`
+	read := func(header string) (webhook, error) {
+		httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks", strings.NewReader(body))
+		if header != "" {
+			httpReq.Header.Set(strictDecodingHeader, header)
+		}
+		hook := webhook{}
+		err := readEntity(dummyRestfulRequest(httpReq, ""), &hook)
+		return hook, err
+	}
+
+	if hook, err := read(""); err != nil || hook.Name != "hook" || hook.ServiceAccount != "" {
+		t.Errorf("expected the typo to be dropped by default, got %+v, %v", hook, err)
+	}
+	if _, err := read("true"); err == nil || err.Error() != "unrecognized fields: servceaccount" {
+		t.Errorf("expected the typo to be refused, got %v", err)
+	}
+
+	os.Setenv("STRICT_DECODING", "true")
+	defer os.Unsetenv("STRICT_DECODING")
+	if _, err := read(""); err == nil {
+		t.Error("expected STRICT_DECODING to make strict the default")
+	}
+	if hook, err := read("false"); err != nil || hook.Namespace != "ns" {
+		t.Errorf("expected a client to opt out of strict decoding, got %+v, %v", hook, err)
+	}
+}
+
+func TestCreateWebhookStrictly(t *testing.T) {
+	r := dummyResource()
+	httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks", strings.NewReader(`{"name":"hook","pipelne":"pipeline1"}`))
+	httpReq.Header.Set(strictDecodingHeader, "true")
+	httpWriter := httptest.NewRecorder()
+	r.createWebhook(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	if httpWriter.Code != http.StatusBadRequest || !strings.Contains(httpWriter.Body.String(), "unrecognized fields: pipelne") {
+		t.Errorf("expected a 400 listing the unrecognized field, got %d, %s", httpWriter.Code, httpWriter.Body.String())
+	}
+}
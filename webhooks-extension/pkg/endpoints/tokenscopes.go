@@ -0,0 +1,167 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"strings"
+
+	github "github.com/google/go-github/github"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+A token without the scope an operation needs fails part way through it,
+often with a 404 that doesn't say why. Before managing a repository's
+webhooks, or reporting on its pull requests, the provider clients ask the
+provider which scopes the access token has (GitHub's and Bitbucket's
+X-OAuth-Scopes header, GitLab's personal access token API) and fail with the
+GIT_TOKEN_SCOPE_MISSING message naming the scope missing. Tokens whose
+scopes can't be read, such as GitHub App tokens, those of GitLab releases
+without the API and Gitea's, are let through, the operation's own errors being
+translated as before (see providererrors.go). GitHub tokens with the scopes
+are then tried against the repository, so that a token not yet authorized for
+its organization's SAML single sign-on fails with GITHUB_SSO_REQUIRED and the
+URL to authorize it at before any webhook is created.
+---------------------------------------*/
+
+// Operations tokens are checked for, in the words of the GIT_TOKEN_SCOPE_MISSING message
+const (
+	operationHooks  = "manage the webhooks"
+	operationReport = "report on the pull requests"
+)
+
+// gitHubScopes are the scopes, any of which will do, GitHub tokens need for each operation
+var gitHubScopes = map[string][]string{
+	operationHooks:  {"admin:repo_hook", "write:repo_hook"},
+	operationReport: {"repo", "public_repo"},
+}
+
+// gitLabScopes are the scopes, any of which will do, GitLab tokens need for each operation
+var gitLabScopes = map[string][]string{
+	operationHooks:  {"api"},
+	operationReport: {"api"},
+}
+
+// bitbucketScopes are the scopes, any of which will do, Bitbucket credentials need for each operation
+var bitbucketScopes = map[string][]string{
+	operationHooks:  {"webhook"},
+	operationReport: {"pullrequest", "pullrequest:write"},
+}
+
+// checkTokenScopes returns the GIT_TOKEN_SCOPE_MISSING error if granted has none of needed
+func checkTokenScopes(call providerCall, granted, needed []string) error {
+	for _, scope := range granted {
+		for _, need := range needed {
+			if scope == need {
+				return nil
+			}
+		}
+	}
+	has := strings.Join(granted, ", ")
+	if has == "" {
+		has = "none"
+	}
+	err := call.messageError("GIT_TOKEN_SCOPE_MISSING", has).(messageError)
+	err.params["scope"] = strings.Join(needed, " or ")
+	return err
+}
+
+// CheckTokenScope returns why the access token can't do operation, nil if it can or its scopes can't be read
+func (gh GitHub) CheckTokenScope(operation string) error {
+	// The rate limit doesn't count against the rate limit
+	_, resp, err := gh.Client.RateLimits(gh.Context)
+	if err != nil || resp == nil {
+		logging.Log.Debugf("not checking the scopes of the token in secret %s: %v", gh.Secret, err)
+		return nil
+	}
+	header, found := resp.Header[http.CanonicalHeaderKey("X-OAuth-Scopes")]
+	if !found {
+		// Not an OAuth or personal access token
+		return nil
+	}
+	granted := []string{}
+	for _, scope := range strings.Split(strings.Join(header, ","), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			granted = append(granted, scope)
+		}
+	}
+	call := providerCall{provider: "GitHub", repository: gh.Org + "/" + gh.Repo, secret: gh.Secret, action: operation}
+	if err := checkTokenScopes(call, granted, gitHubScopes[operation]); err != nil {
+		return err
+	}
+	return gh.checkSSOAuthorized(call, operation)
+}
+
+// checkSSOAuthorized returns the GITHUB_SSO_REQUIRED error if the repository's organization enforces SAML single
+// sign-on the token isn't authorized for, trying the call operation makes first. Other failures are left to the
+// operation.
+func (gh GitHub) checkSSOAuthorized(call providerCall, operation string) error {
+	var err error
+	if operation == operationHooks {
+		_, _, err = gh.Client.Repositories.ListHooks(gh.Context, gh.Org, gh.Repo, &github.ListOptions{PerPage: 1})
+	} else {
+		_, _, err = gh.Client.Repositories.Get(gh.Context, gh.Org, gh.Repo)
+	}
+	if e, ok := err.(*github.ErrorResponse); ok {
+		if ssoErr := gitHubSSOError(call, e); ssoErr != nil {
+			return ssoErr
+		}
+	}
+	return nil
+}
+
+// CheckTokenScope returns why the access token can't do operation, nil if it can or its scopes can't be read
+func (gl GitLab) CheckTokenScope(operation string) error {
+	req, err := gl.Client.NewRequest(http.MethodGet, "personal_access_tokens/self", nil, nil)
+	if err != nil {
+		return nil
+	}
+	token := struct {
+		Scopes []string `json:"scopes"`
+	}{}
+	if _, err := gl.Client.Do(req, &token); err != nil {
+		// GitLab releases before 15.5, and OAuth tokens, can't say
+		logging.Log.Debugf("not checking the scopes of the token in secret %s: %s", gl.Secret, err)
+		return nil
+	}
+	call := providerCall{provider: "GitLab", repository: gl.ProjectID, secret: gl.Secret, action: operation}
+	return checkTokenScopes(call, token.Scopes, gitLabScopes[operation])
+}
+
+// CheckTokenScope returns why the credentials can't do operation, nil if they can or their scopes can't be read
+func (bb Bitbucket) CheckTokenScope(operation string) error {
+	resp, err := bb.do(http.MethodGet, bb.repoPath(""), nil, nil)
+	if err != nil || resp == nil {
+		logging.Log.Debugf("not checking the scopes of the credentials in secret %s: %v", bb.Secret, err)
+		return nil
+	}
+	header, found := resp.Header[http.CanonicalHeaderKey("X-OAuth-Scopes")]
+	if !found {
+		return nil
+	}
+	granted := []string{}
+	for _, scope := range strings.Split(strings.Join(header, ","), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			granted = append(granted, scope)
+		}
+	}
+	call := providerCall{provider: "Bitbucket", repository: bb.Workspace + "/" + bb.Repo, secret: bb.Secret, action: operation}
+	return checkTokenScopes(call, granted, bitbucketScopes[operation])
+}
+
+// CheckTokenScope lets the token through, as neither Gitea nor Gogs say which scopes a token has
+func (gt Gitea) CheckTokenScope(operation string) error {
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	github "github.com/google/go-github/github"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestGitHubCheckTokenScope(t *testing.T) {
+	scopes := "repo, read:org"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scopes != "" {
+			w.Header().Set("X-OAuth-Scopes", scopes)
+		}
+		fmt.Fprint(w, `{"resources": {"core": {"limit": 5000, "remaining": 4999}}}`)
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	gh := GitHub{Client: client, Context: context.Background(), Org: "owner", Repo: "repo", Secret: "github-token", PageSize: 10}
+
+	if err := gh.CheckTokenScope(operationReport); err != nil {
+		t.Errorf("expected a repo token to be able to report, got %s", err)
+	}
+	err := gh.CheckTokenScope(operationHooks)
+	if coded, ok := err.(messageError); !ok || coded.code != "GIT_TOKEN_SCOPE_MISSING" {
+		t.Fatalf("expected a GIT_TOKEN_SCOPE_MISSING error, got %v", err)
+	}
+	expected := "the access token in secret github-token can't manage the webhooks of owner/repo, GitHub needs it to have the admin:repo_hook or write:repo_hook scope and it has repo, read:org"
+	if err.Error() != expected {
+		t.Errorf("error was %q, expected %q", err, expected)
+	}
+
+	// Tokens that aren't OAuth or personal access tokens have no scopes to check
+	scopes = ""
+	if err := gh.CheckTokenScope(operationHooks); err != nil {
+		t.Errorf("expected a token without scopes to be let through, got %s", err)
+	}
+}
+
+func TestGitHubCheckTokenScopeSSO(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-OAuth-Scopes", "repo, admin:repo_hook")
+		if r.URL.Path == "/rate_limit" {
+			fmt.Fprint(w, `{"resources": {"core": {"limit": 5000, "remaining": 4999}}}`)
+			return
+		}
+		w.Header().Set("X-GitHub-SSO", "required; url=https://github.com/orgs/owner/sso?authorization_request=AZSCKtL4U8yX")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource protected by organization SAML enforcement. You must grant your Personal Access token access to this organization."}`)
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	gh := GitHub{Client: client, Context: context.Background(), Org: "owner", Repo: "repo", Secret: "github-token", PageSize: 10}
+	for _, operation := range []string{operationHooks, operationReport} {
+		err := gh.CheckTokenScope(operation)
+		if coded, ok := err.(messageError); !ok || coded.code != "GITHUB_SSO_REQUIRED" || coded.params["ssourl"] == "" {
+			t.Errorf("expected a GITHUB_SSO_REQUIRED error to %s, got %v", operation, err)
+		}
+	}
+}
+
+func TestGitLabCheckTokenScope(t *testing.T) {
+	found := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !found || r.URL.Path != "/api/v4/personal_access_tokens/self" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "404 Not Found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": 1, "name": "ci", "scopes": ["read_api", "read_repository"]}`)
+	}))
+	defer server.Close()
+
+	client := gitlab.NewClient(nil, "token")
+	client.SetBaseURL(server.URL + "/api/v4")
+	gl := GitLab{Client: client, ProjectID: "owner/repo", Secret: "gitlab-token", PageSize: 10}
+
+	err := gl.CheckTokenScope(operationReport)
+	if coded, ok := err.(messageError); !ok || coded.code != "GIT_TOKEN_SCOPE_MISSING" || coded.params["scope"] != "api" {
+		t.Fatalf("expected a GIT_TOKEN_SCOPE_MISSING error for the api scope, got %v", err)
+	}
+
+	// GitLab releases without the API can't say
+	found = false
+	if err := gl.CheckTokenScope(operationHooks); err != nil {
+		t.Errorf("expected the token to be let through, got %s", err)
+	}
+}
+
+func TestBitbucketCheckTokenScope(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-OAuth-Scopes", "repository, pullrequest")
+		fmt.Fprint(w, `{"mainbranch": {"name": "main"}}`)
+	}))
+	defer server.Close()
+
+	bb := Bitbucket{Client: server.Client(), APIURL: server.URL, Workspace: "workspace", Repo: "repo", Secret: "bitbucket-token", PageSize: 10}
+	if err := bb.CheckTokenScope(operationReport); err != nil {
+		t.Errorf("expected a pullrequest token to be able to report, got %s", err)
+	}
+	err := bb.CheckTokenScope(operationHooks)
+	if coded, ok := err.(messageError); !ok || coded.code != "GIT_TOKEN_SCOPE_MISSING" || coded.params["scope"] != "webhook" {
+		t.Errorf("expected a GIT_TOKEN_SCOPE_MISSING error for the webhook scope, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	"github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+/*--------------------------------------
+A webhook's triggers are named <name>-<namespace> followed by a suffix
+saying what the trigger runs, e.g. -push-event. TRIGGER_NAME_TEMPLATE
+replaces <name>-<namespace> for webhooks created from then on, e.g.
+wh-{{.Namespace}}-{{.Name}}, so an organization's naming conventions can be
+kept and the triggers kept apart from those it already has on the
+eventlistener. The template must use both {{.Name}} and {{.Namespace}} and
+nothing else. Trigger names longer than 63 characters, as Tekton Triggers
+labels PipelineRuns with them, are shortened with a hash, see names.go, and
+a webhook whose trigger names wouldn't be DNS-1123 labels isn't created.
+Nor is one whose trigger names are already on the eventlistener.
+The name of a webhook whose triggers are named from a template or shortened
+is kept in its triggerbinding, and the webhook has the triggerprefix its
+triggers were named with, so webhooks created before the template changed
+are still found by their own trigger names.
+---------------------------------------*/
+
+const (
+	// Stands for the trigger names of webhooks created without a template
+	defaultTriggerNameTemplate = "{{.Name}}-{{.Namespace}}"
+	// Binding param holding the name of a webhook whose triggers are named from the template
+	webhookNameParam = "webhooks-tekton-webhook-name"
+)
+
+// setTriggerNameDefaults sets the trigger name template from the environment, ignoring one that isn't valid
+func setTriggerNameDefaults(defaults *EnvDefaults) {
+	template := strings.TrimSpace(os.Getenv("TRIGGER_NAME_TEMPLATE"))
+	if err := validateTriggerNameTemplate(template); err != nil {
+		logging.Log.Errorf("ignoring TRIGGER_NAME_TEMPLATE: %s", err)
+		return
+	}
+	defaults.TriggerNameTemplate = template
+}
+
+func validateTriggerNameTemplate(template string) error {
+	if template == "" || template == defaultTriggerNameTemplate {
+		return nil
+	}
+	if !strings.Contains(template, "{{.Name}}") || !strings.Contains(template, "{{.Namespace}}") {
+		return fmt.Errorf("trigger name template %s must use {{.Name}} and {{.Namespace}}, so each webhook's triggers are named apart", template)
+	}
+	rendered := renderTriggerPrefix(template, "name", "namespace")
+	if strings.Contains(rendered, "{{") {
+		return fmt.Errorf("trigger name template %s may only use {{.Name}} and {{.Namespace}}", template)
+	}
+	if errs := validation.IsDNS1123Label(rendered); len(errs) > 0 {
+		return fmt.Errorf("trigger name template %s doesn't make DNS-1123 labels: %s", template, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func renderTriggerPrefix(template, name, namespace string) string {
+	return strings.NewReplacer("{{.Name}}", name, "{{.Namespace}}", namespace).Replace(template)
+}
+
+// triggerPrefix starts the names of the webhook's triggers
+func triggerPrefix(hook webhook) string {
+	if hook.TriggerPrefix != "" {
+		return hook.TriggerPrefix
+	}
+	return hook.Name + "-" + hook.Namespace
+}
+
+// triggerPrefixOf returns the trigger prefix of the named webhook, the trigger name template's if it isn't found
+func (r Resource) triggerPrefixOf(name, namespace string) string {
+	if hooks, err := r.getWebhooksFromEventListener(); err == nil {
+		for _, hook := range hooks {
+			if hook.Name == name && hook.Namespace == namespace {
+				return triggerPrefix(hook)
+			}
+		}
+	}
+	hook := webhook{Name: name, Namespace: namespace}
+	if err := r.assignTriggerPrefix(&hook); err != nil {
+		return name + "-" + namespace
+	}
+	return triggerPrefix(hook)
+}
+
+// assignTriggerPrefix names the triggers of hook, about to be created or renamed, from the trigger name template,
+// shortening names that would be too long
+func (r Resource) assignTriggerPrefix(hook *webhook) error {
+	hook.TriggerPrefix = ""
+	template := r.Defaults.TriggerNameTemplate
+	if template == "" {
+		template = defaultTriggerNameTemplate
+	}
+	longest := ""
+	for _, suffix := range webhookTriggerSuffixes {
+		if len(suffix) > len(longest) {
+			longest = suffix
+		}
+	}
+	prefix := boundedName(renderTriggerPrefix(template, hook.Name, hook.Namespace), maxTriggerNameLength-len(longest))
+	if errs := validation.IsDNS1123Label(prefix + longest); len(errs) > 0 && template != defaultTriggerNameTemplate {
+		return newMessageError("TRIGGER_NAME_INVALID", map[string]string{"name": prefix + longest, "detail": strings.Join(errs, ", ")})
+	}
+	if prefix != hook.Name+"-"+hook.Namespace {
+		hook.TriggerPrefix = prefix
+	}
+	return nil
+}
+
+// validateTriggerNamesFree returns the TRIGGER_NAME_EXISTS error if the eventlistener already has one of hook's
+// trigger names
+func (r Resource) validateTriggerNamesFree(hook webhook) error {
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(r.Defaults.Namespace).Get(r.eventListenerName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, name := range webhookTriggerNames(triggerPrefix(hook)) {
+		names[name] = true
+	}
+	for _, trigger := range el.Spec.Triggers {
+		if names[trigger.Name] {
+			return newMessageError("TRIGGER_NAME_EXISTS", map[string]string{"trigger": trigger.Name, "eventlistener": r.eventListenerName()})
+		}
+	}
+	return nil
+}
+
+// triggerNameParams are the binding params keeping the name of a webhook whose triggers are named from the template
+func triggerNameParams(hook webhook) []v1alpha1.Param {
+	if hook.TriggerPrefix == "" {
+		return []v1alpha1.Param{}
+	}
+	return []v1alpha1.Param{{Name: webhookNameParam, Value: hook.Name}}
+}
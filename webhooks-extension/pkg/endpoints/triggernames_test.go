@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTriggerNameTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		valid    bool
+	}{
+		{template: "", valid: true},
+		{template: defaultTriggerNameTemplate, valid: true},
+		{template: "wh-{{.Namespace}}-{{.Name}}", valid: true},
+		{template: "wh-{{.Name}}", valid: false},
+		{template: "{{.Name}}-{{.Namespace}}-{{.Repository}}", valid: false},
+		{template: "WH_{{.Name}}-{{.Namespace}}", valid: false},
+	}
+	for _, tt := range tests {
+		if err := validateTriggerNameTemplate(tt.template); (err == nil) != tt.valid {
+			t.Errorf("template %s was valid %t, expected %t: %v", tt.template, err == nil, tt.valid, err)
+		}
+	}
+}
+
+func TestAssignTriggerPrefix(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs}
+	if err := r.assignTriggerPrefix(&hook); err != nil || hook.TriggerPrefix != "" || triggerPrefix(hook) != "hook-"+installNs {
+		t.Errorf("expected the default trigger names, got %q, %v", hook.TriggerPrefix, err)
+	}
+
+	r.Defaults.TriggerNameTemplate = "wh-{{.Namespace}}-{{.Name}}"
+	if err := r.assignTriggerPrefix(&hook); err != nil || triggerPrefix(hook) != "wh-"+installNs+"-hook" {
+		t.Errorf("expected the template's trigger names, got %q, %v", hook.TriggerPrefix, err)
+	}
+	params := triggerNameParams(hook)
+	if len(params) != 1 || params[0].Name != webhookNameParam || params[0].Value != "hook" {
+		t.Errorf("expected the name to be kept in the binding, got %v", params)
+	}
+
+	long := webhook{Name: strings.Repeat("a", 57), Namespace: installNs}
+	if err := r.assignTriggerPrefix(&long); err != nil {
+		t.Fatalf("error naming triggers: %s", err)
+	}
+	for _, name := range webhookTriggerNames(triggerPrefix(long)) {
+		if len(name) > maxTriggerNameLength {
+			t.Errorf("expected the trigger names to be shortened, got %s", name)
+		}
+	}
+	again := webhook{Name: long.Name, Namespace: installNs}
+	r.assignTriggerPrefix(&again)
+	if again.TriggerPrefix != long.TriggerPrefix {
+		t.Errorf("expected the same trigger names, got %s and %s", again.TriggerPrefix, long.TriggerPrefix)
+	}
+
+	invalid := webhook{Name: "Hook", Namespace: installNs}
+	err := r.assignTriggerPrefix(&invalid)
+	if coded, ok := err.(messageError); !ok || coded.code != "TRIGGER_NAME_INVALID" {
+		t.Errorf("expected the invalid trigger names to be refused, got %v", err)
+	}
+}
+
+func TestWebhookFoundByTemplatedTriggerNames(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.TriggerNameTemplate = "wh-{{.Namespace}}-{{.Name}}"
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	if err := r.assignTriggerPrefix(&hook); err != nil {
+		t.Fatalf("error naming triggers: %s", err)
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+	names := map[string]bool{}
+	for _, trigger := range el.Spec.Triggers {
+		names[trigger.Name] = true
+	}
+	if !names["wh-"+installNs+"-hook-push-event"] || names["hook-"+installNs+"-push-event"] {
+		t.Errorf("expected the triggers to be named from the template, got %v", names)
+	}
+
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		t.Fatalf("error getting webhooks: %s", err)
+	}
+	if len(hooks) != 1 || hooks[0].Name != "hook" || hooks[0].TriggerPrefix != "wh-"+installNs+"-hook" {
+		t.Fatalf("expected the webhook to be found by its name, got %+v", hooks)
+	}
+	if prefix := r.triggerPrefixOf("hook", installNs); prefix != "wh-"+installNs+"-hook" {
+		t.Errorf("trigger prefix was %s", prefix)
+	}
+
+	err = r.validateTriggerNamesFree(webhook{Name: "hook", Namespace: installNs, TriggerPrefix: "wh-" + installNs + "-hook"})
+	if coded, ok := err.(messageError); !ok || coded.code != "TRIGGER_NAME_EXISTS" {
+		t.Errorf("expected the trigger names to be taken, got %v", err)
+	}
+	if err := r.validateTriggerNamesFree(webhook{Name: "other", Namespace: installNs}); err != nil {
+		t.Errorf("expected the trigger names to be free, got %s", err)
+	}
+}
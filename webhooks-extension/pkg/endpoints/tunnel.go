@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+Clusters on a laptop, such as kind or minikube, have no address a git
+provider can deliver to. A tunnel agent (ngrok, inlets or similar) run as a
+sidecar of the extension gives the eventlistener a public URL, and with
+WEBHOOK_TUNNEL set the extension asks the agent for that URL every 30
+seconds and migrates the callback to it whenever it changes, as POST
+/webhooks/migrate-callback would, so provider webhooks follow the tunnel
+across restarts of the agent. WEBHOOK_TUNNEL names how the agent is asked,
+see tunnelProviders, at WEBHOOK_TUNNEL_API. See docs/Tunnels.md.
+---------------------------------------*/
+
+const (
+	tunnelCheckInterval = 30 * time.Second
+	tunnelAPITimeout    = 5 * time.Second
+)
+
+// tunnelProvider asks a tunnel agent's API for the tunnel's public URL
+type tunnelProvider struct {
+	// Used if WEBHOOK_TUNNEL_API isn't set
+	defaultAPI string
+	publicURL  func(client *http.Client, api string) (string, error)
+}
+
+// tunnelProviders are the tunnel agents the extension can follow, by the WEBHOOK_TUNNEL naming them. Any agent that
+// can serve its public URL over HTTP, e.g. from a script, can be followed with "url".
+var tunnelProviders = map[string]tunnelProvider{
+	"ngrok": {defaultAPI: "http://localhost:4040/api/tunnels", publicURL: ngrokPublicURL},
+	"url":   {publicURL: plainPublicURL},
+}
+
+// ngrokTunnels is the part of the ngrok agent's GET /api/tunnels response read
+type ngrokTunnels struct {
+	Tunnels []struct {
+		PublicURL string `json:"public_url"`
+	} `json:"tunnels"`
+}
+
+// ngrokPublicURL is the public URL of the ngrok agent's tunnel, preferring https
+func ngrokPublicURL(client *http.Client, api string) (string, error) {
+	body, err := getTunnelAPI(client, api)
+	if err != nil {
+		return "", err
+	}
+	tunnels := ngrokTunnels{}
+	if err := json.Unmarshal(body, &tunnels); err != nil {
+		return "", fmt.Errorf("error reading the ngrok agent's tunnels: %s", err)
+	}
+	publicURL := ""
+	for _, tunnel := range tunnels.Tunnels {
+		if publicURL == "" || strings.HasPrefix(tunnel.PublicURL, "https://") {
+			publicURL = tunnel.PublicURL
+		}
+	}
+	if publicURL == "" {
+		return "", errors.New("the ngrok agent has no tunnels")
+	}
+	return publicURL, nil
+}
+
+// plainPublicURL is the body of the response to a GET of api
+func plainPublicURL(client *http.Client, api string) (string, error) {
+	body, err := getTunnelAPI(client, api)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func getTunnelAPI(client *http.Client, api string) ([]byte, error) {
+	resp, err := client.Get(api)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tunnel API %s returned %s", api, resp.Status)
+	}
+	return body, nil
+}
+
+// FollowTunnel migrates the callback to the public URL of the WEBHOOK_TUNNEL tunnel whenever it changes, until stopCh
+// is closed
+func (r Resource) FollowTunnel(stopCh <-chan struct{}) {
+	name := os.Getenv("WEBHOOK_TUNNEL")
+	if name == "" {
+		return
+	}
+	if r.relayed() {
+		logging.Log.Errorf("not following WEBHOOK_TUNNEL %s, deliveries are relayed from WEBHOOK_RELAY_URL", name)
+		return
+	}
+	provider, ok := tunnelProviders[name]
+	if !ok {
+		logging.Log.Errorf("not following WEBHOOK_TUNNEL %s, it isn't a known tunnel", name)
+		return
+	}
+	api := os.Getenv("WEBHOOK_TUNNEL_API")
+	if api == "" {
+		api = provider.defaultAPI
+	}
+	logging.Log.Infof("Following the public URL of the %s tunnel at %s", name, api)
+	client := &http.Client{Timeout: tunnelAPITimeout}
+	ticker := time.NewTicker(tunnelCheckInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.followTunnel(provider, client, api); err != nil {
+			logging.Log.Errorf("error following the %s tunnel: %s", name, err)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// followTunnel migrates the callback to the tunnel's public URL if it has changed, returning whether it had
+func (r Resource) followTunnel(provider tunnelProvider, client *http.Client, api string) (bool, error) {
+	publicURL, err := provider.publicURL(client, api)
+	if err != nil {
+		return false, err
+	}
+	publicURL = strings.TrimSuffix(publicURL, "/")
+	if !strings.HasPrefix(publicURL, "http://") && !strings.HasPrefix(publicURL, "https://") {
+		return false, fmt.Errorf("public URL %q does not specify the protocol http:// or https://", publicURL)
+	}
+
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+	if publicURL == getCallbackURL(r) {
+		return false, nil
+	}
+	logging.Log.Infof("Tunnel public URL is now %s, migrating the callback to it", publicURL)
+	result, err := r.migrateCallbackTo(publicURL)
+	if err != nil {
+		return false, err
+	}
+	for _, migration := range result.Results {
+		if !migration.Migrated {
+			logging.Log.Errorf("the webhook of %s still delivers to %s: %s", migration.Repository, result.PreviousCallbackURL, migration.Error)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNgrokPublicURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"tunnels": [{"public_url": "http://1a2b.ngrok.io", "proto": "http"}, {"public_url": "https://1a2b.ngrok.io", "proto": "https"}]}`)
+	}))
+	defer server.Close()
+
+	publicURL, err := ngrokPublicURL(server.Client(), server.URL)
+	if err != nil || publicURL != "https://1a2b.ngrok.io" {
+		t.Errorf("public URL was %s, %v, expected https://1a2b.ngrok.io", publicURL, err)
+	}
+}
+
+func TestFollowTunnel(t *testing.T) {
+	publicURL := "http://1a2b.ngrok.io"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(w, publicURL)
+	}))
+	defer server.Close()
+	defer os.Unsetenv("WEBHOOK_CALLBACK_URL")
+
+	r := dummyResource()
+	r.Defaults.CallbackURL = "http://listener.127.0.0.1.nip.io"
+	if err := r.createDeleteIngress("create", installNs); err != nil {
+		t.Fatalf("error creating ingress: %s", err)
+	}
+
+	followed, err := r.followTunnel(tunnelProviders["url"], server.Client(), server.URL)
+	if err != nil || !followed {
+		t.Fatalf("expected the callback to follow the tunnel, got %v, %v", followed, err)
+	}
+	if got := getCallbackURL(*r); got != publicURL {
+		t.Errorf("callback was %s, expected %s", got, publicURL)
+	}
+	ingress, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Get(r.ingressName(), metav1.GetOptions{})
+	if err != nil || ingress.Spec.Rules[0].Host != "1a2b.ngrok.io" {
+		t.Errorf("expected the ingress to be moved to the tunnel's host, got %+v, %v", ingress, err)
+	}
+
+	// Unchanged
+	if followed, err := r.followTunnel(tunnelProviders["url"], server.Client(), server.URL); err != nil || followed {
+		t.Errorf("expected nothing to change, got %v, %v", followed, err)
+	}
+
+	publicURL = "not a URL"
+	if _, err := r.followTunnel(tunnelProviders["url"], server.Client(), server.URL); err == nil {
+		t.Errorf("expected an error for a public URL without a protocol")
+	}
+}
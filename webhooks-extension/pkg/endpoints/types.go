@@ -15,6 +15,7 @@ package endpoints
 
 import (
 	"os"
+	"strings"
 
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
 	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
@@ -31,6 +32,10 @@ type Resource struct {
 	TriggersClient triggersclientset.Interface
 	RoutesClient   routeclientset.Interface
 	Defaults       EnvDefaults
+	// How the extension is installed, see installconfig.go
+	Install InstallConfig
+	// The config the clientsets were built with, see impersonation.go
+	config *rest.Config
 }
 
 // NewResource returns a new Resource instantiated with its clientsets
@@ -42,6 +47,49 @@ func NewResource() (Resource, error) {
 		return Resource{}, err
 	}
 
+	r, err := Resource{}.withClients(config)
+	if err != nil {
+		return Resource{}, err
+	}
+
+	defaults := EnvDefaults{
+		Namespace:         os.Getenv("INSTALLED_NAMESPACE"),
+		DockerRegistry:    os.Getenv("DOCKER_REGISTRY_LOCATION"),
+		CallbackURL:       os.Getenv("WEBHOOK_CALLBACK_URL"),
+		DeliveryBuffer:    os.Getenv("DELIVERY_BUFFERING_ENABLED") == "true",
+		MonitorController: os.Getenv("MONITOR_CONTROLLER_ENABLED") == "true",
+	}
+	defaults.AdditionalCallbackURLs = parseCallbackURLs(os.Getenv("WEBHOOK_ADDITIONAL_CALLBACK_URLS"))
+	defaults.RelayURL = strings.TrimSuffix(os.Getenv("WEBHOOK_RELAY_URL"), "/")
+	if defaults.Namespace == "" {
+		// If no namespace provided, use "default"
+		defaults.Namespace = "default"
+	}
+	setConfigMapDefaults(r.K8sClient, &defaults)
+	// getCallbackURL reads WEBHOOK_CALLBACK_URL, which the configmap's callbackurl, saved when the callback is
+	// migrated, overrides
+	if defaults.CallbackURL != "" {
+		os.Setenv("WEBHOOK_CALLBACK_URL", defaults.CallbackURL)
+	}
+	setNameDefaults(&defaults)
+	setTriggerNameDefaults(&defaults)
+	setDashboardLinkDefaults(&defaults)
+	setGitAPIDefaults(&defaults)
+	setCertPinDefaults(&defaults)
+
+	install, err := loadInstallConfig(r.K8sClient, defaults.Namespace, defaults.CallbackURL)
+	if err != nil {
+		logging.Log.Errorf("error loading the install configuration: %s.", err.Error())
+		return Resource{}, err
+	}
+
+	r.Defaults = defaults
+	r.Install = install
+	return r, nil
+}
+
+// withClients returns r with clientsets built with config
+func (r Resource) withClients(config *rest.Config) (Resource, error) {
 	// Setup tektoncd client
 	tektonClient, err := tektoncdclientset.NewForConfig(config)
 	if err != nil {
@@ -70,42 +118,65 @@ func NewResource() (Resource, error) {
 		return Resource{}, err
 	}
 
-	defaults := EnvDefaults{
-		Namespace:      os.Getenv("INSTALLED_NAMESPACE"),
-		DockerRegistry: os.Getenv("DOCKER_REGISTRY_LOCATION"),
-		CallbackURL:    os.Getenv("WEBHOOK_CALLBACK_URL"),
-	}
-	if defaults.Namespace == "" {
-		// If no namespace provided, use "default"
-		defaults.Namespace = "default"
-	}
-
-	r := Resource{
-		K8sClient:      k8sClient,
-		TektonClient:   tektonClient,
-		TriggersClient: triggersClient,
-		RoutesClient:   routesClient,
-		Defaults:       defaults,
-	}
+	r.TektonClient = tektonClient
+	r.K8sClient = k8sClient
+	r.TriggersClient = triggersClient
+	r.RoutesClient = routesClient
+	r.config = config
 	return r, nil
 }
 
 // Webhook stores the webhook information
 type webhook struct {
-	Name             string `json:"name"`
-	Namespace        string `json:"namespace"`
-	ServiceAccount   string `json:"serviceaccount,omitempty"`
-	GitRepositoryURL string `json:"gitrepositoryurl"`
-	AccessTokenRef   string `json:"accesstoken"`
-	Pipeline         string `json:"pipeline"`
-	DockerRegistry   string `json:"dockerregistry,omitempty"`
-	HelmSecret       string `json:"helmsecret,omitempty"`
-	ReleaseName      string `json:"releasename,omitempty"`
-	PullTask         string `json:"pulltask,omitempty"`
-	OnSuccessComment string `json:"onsuccesscomment,omitempty"`
-	OnFailureComment string `json:"onfailurecomment,omitempty"`
-	OnTimeoutComment string `json:"ontimeoutcomment,omitempty"`
-	OnMissingComment string `json:"onmissingcomment,omitempty"`
+	Name             string                `json:"name"`
+	Namespace        string                `json:"namespace"`
+	ServiceAccount   string                `json:"serviceaccount,omitempty"`
+	GitRepositoryURL string                `json:"gitrepositoryurl"`
+	AccessTokenRef   string                `json:"accesstoken"`
+	Pipeline         string                `json:"pipeline"`
+	DockerRegistry   string                `json:"dockerregistry,omitempty"`
+	HelmSecret       string                `json:"helmsecret,omitempty"`
+	ReleaseName      string                `json:"releasename,omitempty"`
+	PullTask         string                `json:"pulltask,omitempty"`
+	OnSuccessComment string                `json:"onsuccesscomment,omitempty"`
+	OnFailureComment string                `json:"onfailurecomment,omitempty"`
+	OnTimeoutComment string                `json:"ontimeoutcomment,omitempty"`
+	OnMissingComment string                `json:"onmissingcomment,omitempty"`
+	MonitorMode      string                `json:"monitormode,omitempty"`
+	MonitorComment   string                `json:"monitorcomment,omitempty"`
+	FailureLogLines  *int                  `json:"failureloglines,omitempty"`
+	RetryPolicy      retryPolicy           `json:"retrypolicy"`
+	Overrides        *pipelineRunOverrides `json:"pipelinerunoverrides,omitempty"`
+	VariableSet      string                `json:"variableset,omitempty"`
+	RequireApproval  bool                  `json:"requireapproval,omitempty"`
+	Interceptors     *extraInterceptors    `json:"interceptors,omitempty"`
+	Canary           *canaryRoute          `json:"canary,omitempty"`
+	DependencyRoute  *dependencyRoute      `json:"dependencyupdates,omitempty"`
+	LabelRoutes      []labelRoute          `json:"labelroutes,omitempty"`
+	FileRules        []fileRule            `json:"filerules,omitempty"`
+	Preview          *previewEnvironment   `json:"preview,omitempty"`
+	OnClosePipeline  string                `json:"onclosepipeline,omitempty"`
+	MainPipeline     string                `json:"mainbranchpipeline,omitempty"`
+	DefaultBranch    string                `json:"defaultbranch,omitempty"`
+	CallbackURL      string                `json:"callbackurl,omitempty"`
+	FollowUps        *followUps            `json:"followups,omitempty"`
+	DeadLetterURL    string                `json:"deadletterurl,omitempty"`
+	CapturePayloads  bool                  `json:"capturepayloads,omitempty"`
+	ShadowMode       bool                  `json:"shadowmode,omitempty"`
+	Senders          *senderFilter         `json:"senders,omitempty"`
+	ExpiresAt        string                `json:"expiresat,omitempty"`
+	Owner            string                `json:"owner,omitempty"`
+	CostCenter       string                `json:"costcenter,omitempty"`
+	Protected        bool                  `json:"protected,omitempty"`
+	AllowSecrets     bool                  `json:"allowsecrets,omitempty"`
+	// Set when the webhook's triggers aren't named <name>-<namespace>, see triggernames.go
+	TriggerPrefix string `json:"triggerprefix,omitempty"`
+	// Only read when creating a webhook, see starters.go and ensureWebhookNamespace in onboard.go
+	Starter                  string              `json:"starter,omitempty"`
+	CreateNamespaceIfMissing bool                `json:"createnamespaceifmissing,omitempty"`
+	Health                   *webhookHealth      `json:"health,omitempty"`
+	Incomplete               *incompleteCreation `json:"incomplete,omitempty"`
+	Activity                 *webhookActivity    `json:"activity,omitempty"`
 }
 
 // ConfigMapName ... the name of the ConfigMap to create
@@ -115,4 +186,29 @@ type EnvDefaults struct {
 	Namespace      string `json:"namespace"`
 	DockerRegistry string `json:"dockerregistry"`
 	CallbackURL    string `json:"endpointurl"`
+	// Other callback URLs webhooks may be registered against, see multicallback.go
+	AdditionalCallbackURLs []string `json:"additionalcallbackurls,omitempty"`
+	// Channel deliveries are relayed from instead of the eventlistener being exposed, see relay.go
+	RelayURL       string `json:"relayurl,omitempty"`
+	DeliveryBuffer bool   `json:"deliverybuffer"`
+	// Report on pull requests from the extension instead of the monitor task, see monitorcontroller.go
+	MonitorController bool `json:"monitorcontroller"`
+	// Link to PipelineRuns in comments and statuses, see dashboardlink.go
+	DashboardLinkTemplate string `json:"dashboardlinktemplate,omitempty"`
+	// Names of generated resources, see names.go
+	EventListenerName string `json:"eventlistenername"`
+	ResourcePrefix    string `json:"resourceprefix"`
+	IngressPrefix     string `json:"ingressprefix"`
+	CertPrefix        string `json:"certprefix"`
+	// Names of webhooks' triggers, see triggernames.go
+	TriggerNameTemplate string `json:"triggernametemplate,omitempty"`
+	// Git provider API clients, see gitapi.go
+	GitHubAPI    gitAPISettings `json:"githubapi"`
+	GitLabAPI    gitAPISettings `json:"gitlabapi"`
+	BitbucketAPI gitAPISettings `json:"bitbucketapi"`
+	GiteaAPI     gitAPISettings `json:"giteaapi"`
+	// Git server hosts to the pins of their certificates, see certpins.go
+	GitCertPins map[string][]string `json:"gitcertpins,omitempty"`
+	// Set when serving a request for a profile, see profiles.go
+	Profile string `json:"profile,omitempty"`
 }
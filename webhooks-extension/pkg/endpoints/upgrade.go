@@ -0,0 +1,260 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*--------------------------------------
+This file implements the following endpoint from webhook.go:
+	ws.Route(ws.POST("/upgrade-listener").To(r.upgradeListener))
+---------------------------------------*/
+
+const (
+	// Seconds to wait for an eventlistener deployment to become ready
+	upgradeReadyAttempts = 120
+)
+
+type listenerUpgradeResponse struct {
+	EventListener string   `json:"eventlistener"`
+	Steps         []string `json:"steps"`
+}
+
+// Set while an upgrade is running, a second one is refused
+var listenerUpgradeRunning int32
+
+// Recreates the eventlistener without dropping deliveries. A standby with the
+// upgraded spec, see upgradeEventListenerSpec, is created and traffic switched
+// to it once ready, the eventlistener is then recreated under its usual name
+// (picking up the current Triggers version and the upgraded spec) and traffic
+// switched back before the standby is removed. modifyingEventListenerLock is
+// only held while changing resources, not while waiting for an eventlistener
+// to become ready, so webhooks can be created and deleted meanwhile. Those
+// changed while the standby serves deliveries only take effect once traffic
+// is switched back. It rewrites the eventlistener every webhook relies on, so only admins may call it.
+func (r Resource) upgradeListener(request *restful.Request, response *restful.Response) {
+	if status, err := r.authorizeAdmin(request); err != nil {
+		logging.Log.Error(err)
+		RespondError(response, err, status)
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&listenerUpgradeRunning, 0, 1) {
+		RespondError(response, errors.New("an eventlistener upgrade is already running"), http.StatusConflict)
+		return
+	}
+	defer atomic.StoreInt32(&listenerUpgradeRunning, 0)
+
+	installNs := r.Defaults.Namespace
+	result := listenerUpgradeResponse{EventListener: r.eventListenerName(), Steps: []string{}}
+	step := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		logging.Log.Info(msg)
+		result.Steps = append(result.Steps, msg)
+	}
+
+	// Bring up the standby
+	modifyingEventListenerLock.Lock()
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		modifyingEventListenerLock.Unlock()
+		if k8serrors.IsNotFound(err) {
+			RespondError(response, errors.New("no eventlistener exists to upgrade, one is created with the first webhook"), http.StatusNotFound)
+			return
+		}
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+	_, err = r.createEventListenerCopy(el, r.standbyEventListenerName())
+	modifyingEventListenerLock.Unlock()
+	if err != nil {
+		msg := fmt.Sprintf("error creating standby eventlistener %s: %s", r.standbyEventListenerName(), err)
+		RespondError(response, errors.New(msg), http.StatusInternalServerError)
+		return
+	}
+	step("created standby eventlistener %s", r.standbyEventListenerName())
+	if !r.waitForEventListener(installNs, r.standbyEventListenerName(), upgradeReadyAttempts) {
+		r.deleteEventListenerByName(r.standbyEventListenerName())
+		msg := fmt.Sprintf("standby eventlistener %s did not become ready, upgrade abandoned", r.standbyEventListenerName())
+		RespondError(response, errors.New(msg), http.StatusInternalServerError)
+		return
+	}
+
+	// Move traffic onto the standby and recreate the eventlistener under its usual name, from its spec as it is now
+	// as webhooks may have changed it while the standby started
+	modifyingEventListenerLock.Lock()
+	if err := r.switchListenerBackend(listenerServiceName(r.standbyEventListenerName())); err != nil {
+		modifyingEventListenerLock.Unlock()
+		r.deleteEventListenerByName(r.standbyEventListenerName())
+		msg := fmt.Sprintf("error switching deliveries to standby eventlistener, upgrade abandoned: %s", err)
+		RespondError(response, errors.New(msg), http.StatusInternalServerError)
+		return
+	}
+	step("deliveries switched to %s", r.standbyEventListenerName())
+	err = r.recreateEventListener()
+	modifyingEventListenerLock.Unlock()
+	if err != nil {
+		msg := fmt.Sprintf("error recreating eventlistener %s, deliveries are still served by %s: %s", r.eventListenerName(), r.standbyEventListenerName(), err)
+		RespondError(response, errors.New(msg), http.StatusInternalServerError)
+		return
+	}
+	step("recreated eventlistener %s", r.eventListenerName())
+	if !r.waitForEventListener(installNs, r.eventListenerName(), upgradeReadyAttempts) {
+		msg := fmt.Sprintf("recreated eventlistener %s did not become ready, deliveries are still served by %s", r.eventListenerName(), r.standbyEventListenerName())
+		RespondError(response, errors.New(msg), http.StatusInternalServerError)
+		return
+	}
+
+	// Move traffic back and drop the standby
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+	if err := r.switchListenerBackend(listenerServiceName(r.eventListenerName())); err != nil {
+		msg := fmt.Sprintf("error switching deliveries back to %s, deliveries are still served by %s: %s", r.eventListenerName(), r.standbyEventListenerName(), err)
+		RespondError(response, errors.New(msg), http.StatusInternalServerError)
+		return
+	}
+	step("deliveries switched to %s", r.eventListenerName())
+	if err := r.deleteEventListenerByName(r.standbyEventListenerName()); err != nil {
+		step("failed to delete standby eventlistener %s, it can be removed manually: %s", r.standbyEventListenerName(), err)
+	} else {
+		step("deleted standby eventlistener %s", r.standbyEventListenerName())
+	}
+
+	response.WriteEntity(result)
+}
+
+// recreateEventListener deletes the eventlistener and creates it again with its spec upgraded. The caller holds
+// modifyingEventListenerLock.
+func (r Resource) recreateEventListener() error {
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(r.Defaults.Namespace).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err := r.deleteEventListenerByName(r.eventListenerName()); err != nil {
+		return err
+	}
+	_, err = r.createEventListenerCopy(el, r.eventListenerName())
+	return err
+}
+
+// createEventListenerCopy creates an eventlistener with the given name and the upgraded spec of source
+func (r Resource) createEventListenerCopy(source *v1alpha1.EventListener, name string) (*v1alpha1.EventListener, error) {
+	labels := managedLabels()
+	for key, value := range source.Labels {
+		labels[key] = value
+	}
+	eventListener := v1alpha1.EventListener{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: source.Namespace,
+			Labels:    labels,
+		},
+		Spec: r.upgradeEventListenerSpec(source.Spec),
+	}
+	return r.TriggersClient.TriggersV1alpha1().EventListeners(source.Namespace).Create(&eventListener)
+}
+
+// upgradeEventListenerSpec returns spec as the extension now creates it: run as the eventlistener service account,
+// with the validator interceptor of each trigger referencing the validator service in the install namespace, and
+// bindings and templates with the API version new triggers have. Interceptors users chained on, see interceptors.go,
+// are kept as they are.
+func (r Resource) upgradeEventListenerSpec(spec v1alpha1.EventListenerSpec) v1alpha1.EventListenerSpec {
+	upgraded := *spec.DeepCopy()
+	upgraded.ServiceAccountName = eventListenerServiceAccount
+	for i := range upgraded.Triggers {
+		trigger := &upgraded.Triggers[i]
+		for _, binding := range trigger.Bindings {
+			if binding != nil && binding.APIVersion == "" {
+				binding.APIVersion = "v1alpha1"
+			}
+		}
+		if trigger.Template.APIVersion == "" {
+			trigger.Template.APIVersion = "v1alpha1"
+		}
+		for _, interceptor := range trigger.Interceptors {
+			if interceptor == nil || interceptor.Webhook == nil || interceptor.Webhook.ObjectRef == nil {
+				continue
+			}
+			if interceptor.Webhook.ObjectRef.Name != validatorServiceName {
+				continue
+			}
+			interceptor.Webhook.ObjectRef.APIVersion = "v1"
+			interceptor.Webhook.ObjectRef.Kind = "Service"
+			interceptor.Webhook.ObjectRef.Namespace = r.Defaults.Namespace
+		}
+	}
+	return upgraded
+}
+
+// deleteEventListenerByName deletes the named eventlistener, waiting for it to go
+// so that one of the same name can be created straight afterwards
+func (r Resource) deleteEventListenerByName(name string) error {
+	installNs := r.Defaults.Namespace
+	err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	for i := 0; i < upgradeReadyAttempts; i = i + 1 {
+		_, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		time.Sleep(1 * time.Second)
+	}
+	return fmt.Errorf("eventlistener %s was not removed in time", name)
+}
+
+// switchListenerBackend points the ingress, or route on OpenShift, at the given eventlistener service
+func (r Resource) switchListenerBackend(serviceName string) error {
+	// When buffering the ingress/route stays on the extension, only the forwarding target moves
+	if r.Defaults.DeliveryBuffer {
+		setDeliveryForwardService(serviceName)
+		return nil
+	}
+	installNs := r.Defaults.Namespace
+	if r.Install.openShift() {
+		route, err := r.RoutesClient.RouteV1().Routes(installNs).Get(r.ingressName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		route.Spec.To.Name = serviceName
+		_, err = r.RoutesClient.RouteV1().Routes(installNs).Update(route)
+		return err
+	}
+
+	ingress, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Get(r.ingressName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range ingress.Spec.Rules {
+		if ingress.Spec.Rules[i].HTTP == nil {
+			continue
+		}
+		for j := range ingress.Spec.Rules[i].HTTP.Paths {
+			ingress.Spec.Rules[i].HTTP.Paths[j].Backend.ServiceName = serviceName
+		}
+	}
+	_, err = r.K8sClient.ExtensionsV1beta1().Ingresses(installNs).Update(ingress)
+	return err
+}
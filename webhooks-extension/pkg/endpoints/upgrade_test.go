@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSwitchListenerBackend(t *testing.T) {
+	r := dummyResource()
+	r.Defaults.CallbackURL = "http://wibble.com"
+	if err := r.createDeleteIngress("create", r.Defaults.Namespace); err != nil {
+		t.Fatalf("error creating ingress: %s", err.Error())
+	}
+
+	if err := r.switchListenerBackend("el-" + r.standbyEventListenerName()); err != nil {
+		t.Errorf("error switching ingress backend: %s", err.Error())
+	}
+
+	ingress, err := r.K8sClient.ExtensionsV1beta1().Ingresses(r.Defaults.Namespace).Get(r.ingressName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting ingress: %s", err.Error())
+	}
+	backend := ingress.Spec.Rules[0].HTTP.Paths[0].Backend.ServiceName
+	if backend != "el-tekton-webhooks-eventlistener-standby" {
+		t.Errorf("ingress backend was %s, expected el-tekton-webhooks-eventlistener-standby", backend)
+	}
+}
+
+func TestCreateEventListenerCopy(t *testing.T) {
+	r := dummyResource()
+	source := &v1alpha1.EventListener{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.eventListenerName(),
+			Namespace: r.Defaults.Namespace,
+		},
+		Spec: v1alpha1.EventListenerSpec{
+			ServiceAccountName: "old-sa",
+			Triggers:           []v1alpha1.EventListenerTrigger{r.newTrigger("foo", "foo", "foo", "https://foo.com/foo/bar", "foo", "foo", "foo")},
+		},
+	}
+
+	el, err := r.createEventListenerCopy(source, r.standbyEventListenerName())
+	if err != nil {
+		t.Fatalf("error copying eventlistener: %s", err.Error())
+	}
+	if el.Name != r.standbyEventListenerName() {
+		t.Errorf("eventlistener name was %s, expected %s", el.Name, r.standbyEventListenerName())
+	}
+	if el.Spec.ServiceAccountName != eventListenerServiceAccount {
+		t.Errorf("eventlistener service account was %s, expected %s", el.Spec.ServiceAccountName, eventListenerServiceAccount)
+	}
+	if len(el.Spec.Triggers) != 1 || el.Spec.Triggers[0].Name != "foo" {
+		t.Errorf("eventlistener triggers were not copied: %+v", el.Spec.Triggers)
+	}
+}
+
+func TestUpgradeEventListenerSpec(t *testing.T) {
+	r := dummyResource()
+	trigger := r.newTrigger("foo", "foo", "foo", "https://foo.com/foo/bar", "foo", "foo", "foo")
+	trigger.Bindings[0].APIVersion = ""
+	trigger.Template.APIVersion = ""
+	trigger.Interceptors[0].Webhook.ObjectRef.Namespace = "old-namespace"
+	userInterceptor := &v1alpha1.EventInterceptor{
+		Webhook: &v1alpha1.WebhookInterceptor{
+			ObjectRef: &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Name: "mine", Namespace: "old-namespace"},
+		},
+	}
+	trigger.Interceptors = append(trigger.Interceptors, userInterceptor)
+	spec := v1alpha1.EventListenerSpec{ServiceAccountName: "old-sa", Triggers: []v1alpha1.EventListenerTrigger{trigger}}
+
+	upgraded := r.upgradeEventListenerSpec(spec)
+	if upgraded.ServiceAccountName != eventListenerServiceAccount {
+		t.Errorf("eventlistener service account was %s, expected %s", upgraded.ServiceAccountName, eventListenerServiceAccount)
+	}
+	upgradedTrigger := upgraded.Triggers[0]
+	if upgradedTrigger.Bindings[0].APIVersion != "v1alpha1" || upgradedTrigger.Template.APIVersion != "v1alpha1" {
+		t.Errorf("expected v1alpha1 bindings and template, got %+v and %+v", upgradedTrigger.Bindings[0], upgradedTrigger.Template)
+	}
+	if namespace := upgradedTrigger.Interceptors[0].Webhook.ObjectRef.Namespace; namespace != r.Defaults.Namespace {
+		t.Errorf("validator interceptor namespace was %s, expected %s", namespace, r.Defaults.Namespace)
+	}
+	if namespace := upgradedTrigger.Interceptors[1].Webhook.ObjectRef.Namespace; namespace != "old-namespace" {
+		t.Errorf("user interceptor namespace was %s, expected it unchanged", namespace)
+	}
+	if trigger.Interceptors[0].Webhook.ObjectRef.Namespace != "old-namespace" {
+		t.Error("expected the source spec to be left unchanged")
+	}
+}
+
+func TestUpgradeListenerNeedsAdmin(t *testing.T) {
+	r := dummyResource()
+	fakeAdminReviews(r)
+	for token, expected := range map[string]int{"": http.StatusUnauthorized, "user": http.StatusForbidden} {
+		httpReq := dummyHTTPRequest("POST", "http://wwww.dummy.com:8383/webhooks/upgrade-listener", nil)
+		if token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+		httpWriter := httptest.NewRecorder()
+		r.upgradeListener(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+		if httpWriter.Code != expected {
+			t.Errorf("upgrading the eventlistener with token %q returned %d, expected %d", token, httpWriter.Code, expected)
+		}
+	}
+}
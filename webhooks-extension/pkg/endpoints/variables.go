@@ -0,0 +1,370 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	"github.com/tektoncd/experimental/webhooks-extension/pkg/utils"
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// A variable set is a named group of key/value params, e.g. the registry and endpoints of an
+// environment, kept in a ConfigMap in the install namespace, or in a Secret if the set is secret so
+// its values can hold credentials. A webhook using a set is given a TriggerTemplate param per
+// variable, read from the ConfigMap or Secret by the interceptor at trigger time.
+type variableSet struct {
+	Name      string            `json:"name"`
+	Secret    bool              `json:"secret,omitempty"`
+	Variables map[string]string `json:"variables"`
+}
+
+/*--------------------------------------
+This file implements the following endpoints from webhook.go:
+	ws.Route(ws.POST("/variablesets").To(r.createVariableSet))
+	ws.Route(ws.GET("/variablesets").To(r.getAllVariableSets))
+	ws.Route(ws.PUT("/variablesets/{name}").To(r.updateVariableSet))
+	ws.Route(ws.DELETE("/variablesets/{name}").To(r.deleteVariableSet))
+---------------------------------------*/
+
+const (
+	variableSetLabel = "webhooks.tekton.dev/variable-set"
+	// Header telling the interceptor which variable set to add to the payload
+	variableSetHeader = "Wext-Variable-Set"
+)
+
+// Returned in place of the values of a secret variable set, and keeps a value as it was when updating one
+const redactedVariable = "[REDACTED]"
+
+// Variables become param names so are kept to characters valid in a param name
+var variableNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+func (r Resource) createVariableSet(request *restful.Request, response *restful.Response) {
+	set := variableSet{}
+	if err := getQueryEntity(&set, request, response); err != nil {
+		logging.Log.Errorf("Error processing query entity: %s", err.Error())
+		return
+	}
+	if err := validateVariableSet(set); err != nil {
+		utils.RespondMessageAndLogError(response, err, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := r.getVariableSet(set.Name); err == nil {
+		errorMessage := fmt.Sprintf("error creating variable set %s: it already exists", set.Name)
+		utils.RespondErrorMessage(response, errorMessage, http.StatusBadRequest)
+		return
+	}
+	var err error
+	if set.Secret {
+		_, err = r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Create(r.variableSetToSecret(set))
+	} else {
+		_, err = r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Create(r.variableSetToConfigMap(set))
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if k8serrors.IsAlreadyExists(err) {
+			status = http.StatusBadRequest
+		}
+		errorMessage := fmt.Sprintf("error creating variable set %s: %s", set.Name, err.Error())
+		utils.RespondMessageAndLogError(response, err, errorMessage, status)
+		return
+	}
+	writeResponseLocation(request, response, set.Name)
+}
+
+func (r Resource) getAllVariableSets(request *restful.Request, response *restful.Response) {
+	configMaps, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).List(metav1.ListOptions{LabelSelector: variableSetLabel})
+	if err != nil {
+		errorMessage := fmt.Sprintf("error getting variable sets: %s.", err.Error())
+		utils.RespondMessageAndLogError(response, err, errorMessage, http.StatusInternalServerError)
+		return
+	}
+	secrets, err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).List(metav1.ListOptions{LabelSelector: variableSetLabel})
+	if err != nil {
+		errorMessage := fmt.Sprintf("error getting variable sets: %s.", err.Error())
+		utils.RespondMessageAndLogError(response, err, errorMessage, http.StatusInternalServerError)
+		return
+	}
+	sets := []variableSet{}
+	for _, configMap := range configMaps.Items {
+		sets = append(sets, configMapToVariableSet(configMap))
+	}
+	// The values of secret sets are never returned
+	for _, secret := range secrets.Items {
+		set := secretToVariableSet(secret)
+		for name := range set.Variables {
+			set.Variables[name] = redactedVariable
+		}
+		sets = append(sets, set)
+	}
+	response.WriteEntity(sets)
+}
+
+// Replaces the variables of a set, updating the params of the webhooks using it if variables were added or removed
+func (r Resource) updateVariableSet(request *restful.Request, response *restful.Response) {
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	set := variableSet{}
+	if err := getQueryEntity(&set, request, response); err != nil {
+		logging.Log.Errorf("Error processing query entity: %s", err.Error())
+		return
+	}
+	set.Name = request.PathParameter("name")
+	if err := validateVariableSet(set); err != nil {
+		utils.RespondMessageAndLogError(response, err, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := r.getVariableSet(set.Name)
+	if err != nil {
+		errorMessage := fmt.Sprintf("error getting variable set %s.", set.Name)
+		utils.RespondMessageAndLogError(response, err, errorMessage, http.StatusNotFound)
+		return
+	}
+	// A set stays secret or not as it was created
+	set.Secret = existing.Secret
+	if set.Secret {
+		for name, value := range set.Variables {
+			if value == redactedVariable {
+				set.Variables[name] = existing.Variables[name]
+			}
+		}
+		_, err = r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Update(r.variableSetToSecret(set))
+	} else {
+		_, err = r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Update(r.variableSetToConfigMap(set))
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("error updating variable set %s: %s", set.Name, err.Error())
+		utils.RespondMessageAndLogError(response, err, errorMessage, http.StatusInternalServerError)
+		return
+	}
+
+	if err := r.syncVariableSetParams(set); err != nil {
+		errorMessage := fmt.Sprintf("variable set %s was updated but updating the webhooks using it failed: %s", set.Name, err.Error())
+		utils.RespondMessageAndLogError(response, err, errorMessage, http.StatusInternalServerError)
+		return
+	}
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func (r Resource) deleteVariableSet(request *restful.Request, response *restful.Response) {
+	modifyingEventListenerLock.Lock()
+	defer modifyingEventListenerLock.Unlock()
+
+	name := request.PathParameter("name")
+	hooks, err := r.getWebhooksFromEventListener()
+	if err != nil {
+		utils.RespondMessageAndLogError(response, err, "error getting webhooks.", http.StatusInternalServerError)
+		return
+	}
+	for _, hook := range hooks {
+		if hook.VariableSet == name {
+			errorMessage := fmt.Sprintf("variable set %s is in use by webhook %s in namespace %s.", name, hook.Name, hook.Namespace)
+			utils.RespondErrorMessage(response, errorMessage, http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Delete(r.variableSetConfigMapName(name), &metav1.DeleteOptions{})
+	if k8serrors.IsNotFound(err) {
+		err = r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Delete(r.variableSetConfigMapName(name), &metav1.DeleteOptions{})
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if k8serrors.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		errorMessage := fmt.Sprintf("error deleting variable set %s.", name)
+		utils.RespondMessageAndLogError(response, err, errorMessage, status)
+		return
+	}
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func validateVariableSet(set variableSet) error {
+	if set.Name == "" {
+		return fmt.Errorf("error: Name must be specified")
+	}
+	for name := range set.Variables {
+		if !variableNamePattern.MatchString(name) || strings.HasPrefix(name, "webhooks-tekton-") {
+			return fmt.Errorf("error: variable name %s must start with a letter or underscore, contain only letters, digits, '-' and '_', and not start with webhooks-tekton-", name)
+		}
+	}
+	return nil
+}
+
+func (r Resource) variableSetToConfigMap(set variableSet) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.variableSetConfigMapName(set.Name),
+			Namespace: r.Defaults.Namespace,
+			Labels:    withLabels(managedLabels(), map[string]string{variableSetLabel: set.Name}),
+		},
+		Data: set.Variables,
+	}
+}
+
+func (r Resource) variableSetToSecret(set variableSet) *corev1.Secret {
+	data := make(map[string][]byte)
+	for name, value := range set.Variables {
+		data[name] = []byte(value)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.variableSetConfigMapName(set.Name),
+			Namespace: r.Defaults.Namespace,
+			Labels:    withLabels(managedLabels(), map[string]string{variableSetLabel: set.Name}),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+}
+
+func secretToVariableSet(secret corev1.Secret) variableSet {
+	set := variableSet{
+		Name:      secret.Labels[variableSetLabel],
+		Secret:    true,
+		Variables: map[string]string{},
+	}
+	for name, value := range secret.Data {
+		set.Variables[name] = string(value)
+	}
+	return set
+}
+
+func configMapToVariableSet(configMap corev1.ConfigMap) variableSet {
+	set := variableSet{
+		Name:      configMap.Labels[variableSetLabel],
+		Variables: configMap.Data,
+	}
+	if set.Variables == nil {
+		set.Variables = map[string]string{}
+	}
+	return set
+}
+
+// getVariableSet returns the named variable set with its values, secret or not, or an error if there is none
+func (r Resource) getVariableSet(name string) (variableSet, error) {
+	configMap, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(r.variableSetConfigMapName(name), metav1.GetOptions{})
+	if err == nil {
+		return configMapToVariableSet(*configMap), nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return variableSet{}, err
+	}
+	secret, err := r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Get(r.variableSetConfigMapName(name), metav1.GetOptions{})
+	if err != nil {
+		return variableSet{}, err
+	}
+	return secretToVariableSet(*secret), nil
+}
+
+// checkVariableSet returns why a webhook can't use the variable set name, if it can't, and the
+// status to respond with: 400 if there's no such set, 500 if it couldn't be read
+func (r Resource) checkVariableSet(name string) (int, error) {
+	if name == "" {
+		return http.StatusOK, nil
+	}
+	_, err := r.getVariableSet(name)
+	switch {
+	case k8serrors.IsNotFound(err):
+		return http.StatusBadRequest, fmt.Errorf("variable set %s could not be found: %s", name, err)
+	case err != nil:
+		return http.StatusInternalServerError, fmt.Errorf("error getting variable set %s: %s", name, err)
+	}
+	return http.StatusOK, nil
+}
+
+// variableParams are the binding params for a webhook using set, one per variable taking
+// its value from the payload where the interceptor puts it, plus the name of the set
+func variableParams(set variableSet) []v1alpha1.Param {
+	params := []v1alpha1.Param{{Name: "webhooks-tekton-variable-set", Value: set.Name}}
+	names := []string{}
+	for name := range set.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params = append(params, v1alpha1.Param{Name: name, Value: "$(body.webhooks-tekton-variables." + name + ")"})
+	}
+	return params
+}
+
+// withVariableSet adds the header naming the webhook's variable set to a trigger's interceptor
+func withVariableSet(trigger v1alpha1.EventListenerTrigger, webhook webhook) v1alpha1.EventListenerTrigger {
+	if webhook.VariableSet != "" {
+		trigger.Interceptors[0].Webhook.Header = append(trigger.Interceptors[0].Webhook.Header,
+			pipelinesv1alpha1.Param{Name: variableSetHeader, Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.VariableSet}})
+	}
+	return trigger
+}
+
+// syncVariableSetParams replaces the variable params in the bindings of every webhook using set
+func (r Resource) syncVariableSetParams(set variableSet) error {
+	installNs := r.Defaults.Namespace
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	synced := make(map[string]bool)
+	for _, trigger := range el.Spec.Triggers {
+		if len(trigger.Bindings) < 2 || synced[trigger.Bindings[1].Ref] {
+			continue
+		}
+		usesSet := false
+		for _, header := range trigger.Interceptors[0].Webhook.Header {
+			if header.Name == variableSetHeader && header.Value.StringVal == set.Name {
+				usesSet = true
+			}
+		}
+		if !usesSet {
+			continue
+		}
+
+		bindingName := trigger.Bindings[1].Ref
+		binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(bindingName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		params := []v1alpha1.Param{}
+		for _, param := range binding.Spec.Params {
+			if strings.HasPrefix(param.Name, "webhooks-tekton-") {
+				params = append(params, param)
+			}
+		}
+		binding.Spec.Params = append(params, variableParams(set)[1:]...)
+		if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Update(binding); err != nil {
+			return err
+		}
+		synced[bindingName] = true
+		logging.Log.Debugf("updated variables of binding %s from variable set %s", bindingName, set.Name)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakek8sclientset "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func variableSetRequest(r *Resource, method, name string, set variableSet) int {
+	jsonBody, _ := json.Marshal(set)
+	httpReq := dummyHTTPRequest(method, "http://wwww.dummy.com:8383/webhooks/variablesets", bytes.NewBuffer(jsonBody))
+	req := dummyRestfulRequest(httpReq, name)
+	httpWriter := httptest.NewRecorder()
+	resp := dummyRestfulResponse(httpWriter)
+	switch method {
+	case "POST":
+		r.createVariableSet(req, resp)
+	case "PUT":
+		r.updateVariableSet(req, resp)
+	case "DELETE":
+		r.deleteVariableSet(req, resp)
+	}
+	return httpWriter.Code
+}
+
+func TestCreateAndGetVariableSets(t *testing.T) {
+	r := dummyResource()
+	staging := variableSet{Name: "staging", Variables: map[string]string{"registry": "staging.example.com"}}
+	if code := variableSetRequest(r, "POST", "", staging); code != http.StatusCreated {
+		t.Errorf("creating variable set returned %d, expected 201", code)
+	}
+	if code := variableSetRequest(r, "POST", "", staging); code != http.StatusBadRequest {
+		t.Errorf("creating duplicate variable set returned %d, expected 400", code)
+	}
+	invalid := variableSet{Name: "bad", Variables: map[string]string{"webhooks-tekton-git-org": "org"}}
+	if code := variableSetRequest(r, "POST", "", invalid); code != http.StatusBadRequest {
+		t.Errorf("creating variable set with reserved name returned %d, expected 400", code)
+	}
+
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/variablesets", nil)
+	httpWriter := httptest.NewRecorder()
+	r.getAllVariableSets(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	result := []variableSet{}
+	if err := json.NewDecoder(httpWriter.Body).Decode(&result); err != nil {
+		t.Fatalf("error reading variable sets: %s", err.Error())
+	}
+	if !reflect.DeepEqual(result, []variableSet{staging}) {
+		t.Errorf("variable sets were %+v, expected %+v", result, []variableSet{staging})
+	}
+}
+
+func TestSecretVariableSets(t *testing.T) {
+	r := dummyResource()
+	production := variableSet{Name: "production", Secret: true, Variables: map[string]string{"apitoken": "s3cret", "registry": "example.com"}}
+	if code := variableSetRequest(r, "POST", "", production); code != http.StatusCreated {
+		t.Errorf("creating secret variable set returned %d, expected 201", code)
+	}
+	if _, err := r.K8sClient.CoreV1().ConfigMaps(r.Defaults.Namespace).Get(r.variableSetConfigMapName("production"), metav1.GetOptions{}); err == nil {
+		t.Error("secret variable set kept in a configmap")
+	}
+
+	httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383/webhooks/variablesets", nil)
+	httpWriter := httptest.NewRecorder()
+	r.getAllVariableSets(dummyRestfulRequest(httpReq, ""), dummyRestfulResponse(httpWriter))
+	if strings.Contains(httpWriter.Body.String(), "s3cret") {
+		t.Errorf("secret values returned: %s", httpWriter.Body.String())
+	}
+	result := []variableSet{}
+	json.NewDecoder(httpWriter.Body).Decode(&result)
+	if len(result) != 1 || !result[0].Secret || result[0].Variables["apitoken"] != redactedVariable {
+		t.Errorf("variable sets were %+v, expected the secret set redacted", result)
+	}
+
+	// Values left redacted are kept
+	updated := variableSet{Variables: map[string]string{"apitoken": redactedVariable, "registry": "registry.example.com"}}
+	if code := variableSetRequest(r, "PUT", "production", updated); code != http.StatusNoContent {
+		t.Fatalf("updating secret variable set returned %d, expected 204", code)
+	}
+	set, err := r.getVariableSet("production")
+	if err != nil || !set.Secret || set.Variables["apitoken"] != "s3cret" || set.Variables["registry"] != "registry.example.com" {
+		t.Errorf("secret variable set was %+v, %v", set, err)
+	}
+
+	if code := variableSetRequest(r, "DELETE", "production", variableSet{}); code != http.StatusNoContent {
+		t.Errorf("deleting secret variable set returned %d, expected 204", code)
+	}
+}
+
+func TestUpdateVariableSetUpdatesWebhooks(t *testing.T) {
+	r := dummyResource()
+	installNs := r.Defaults.Namespace
+	repoURL := "https://github.com/owner/repo"
+	variableSetRequest(r, "POST", "", variableSet{Name: "staging", Variables: map[string]string{"registry": "staging.example.com"}})
+
+	hook := webhook{Name: "hook", Namespace: "foo", GitRepositoryURL: repoURL, Pipeline: "pipeline", VariableSet: "staging"}
+	hookParams, _, err := r.getParams(hook)
+	if err != nil {
+		t.Fatalf("getParams: %s", err)
+	}
+	bindings := []v1alpha1.TriggerBinding{
+		{ObjectMeta: metav1.ObjectMeta{Name: "hook-binding"}, Spec: v1alpha1.TriggerBindingSpec{Params: hookParams}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pipeline-push-binding"}},
+	}
+	for _, binding := range bindings {
+		if _, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Create(&binding); err != nil {
+			t.Fatalf("error creating binding: %s", err.Error())
+		}
+	}
+	trigger := withVariableSet(r.newTrigger("hook-foo-push-event", "pipeline-push-binding", "pipeline-template", repoURL, "push", "secret", "hook-binding"), hook)
+	el := v1alpha1.EventListener{
+		ObjectMeta: metav1.ObjectMeta{Name: r.eventListenerName(), Namespace: installNs},
+		Spec:       v1alpha1.EventListenerSpec{Triggers: []v1alpha1.EventListenerTrigger{trigger}},
+	}
+	if _, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Create(&el); err != nil {
+		t.Fatalf("error creating eventlistener: %s", err.Error())
+	}
+
+	updated := variableSet{Variables: map[string]string{"apiendpoint": "https://api.staging.example.com", "registry": "staging.example.com"}}
+	if code := variableSetRequest(r, "PUT", "staging", updated); code != http.StatusNoContent {
+		t.Fatalf("updating variable set returned %d, expected 204", code)
+	}
+	binding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get("hook-binding", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting hook binding: %s", err.Error())
+	}
+	variables := make(map[string]string)
+	for _, param := range binding.Spec.Params {
+		if param.Name == "webhooks-tekton-variable-set" || !strings.HasPrefix(param.Name, "webhooks-tekton-") {
+			variables[param.Name] = param.Value
+		}
+	}
+	expected := map[string]string{
+		"webhooks-tekton-variable-set": "staging",
+		"apiendpoint":                  "$(body.webhooks-tekton-variables.apiendpoint)",
+		"registry":                     "$(body.webhooks-tekton-variables.registry)",
+	}
+	if !reflect.DeepEqual(variables, expected) {
+		t.Errorf("hook binding variable params were %v, expected %v", variables, expected)
+	}
+
+	if code := variableSetRequest(r, "DELETE", "staging", variableSet{}); code != http.StatusBadRequest {
+		t.Errorf("deleting variable set in use returned %d, expected 400", code)
+	}
+}
+
+func TestMissingVariableSet(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: "foo", GitRepositoryURL: "https://github.com/owner/repo", Pipeline: "pipeline", VariableSet: "missing"}
+	if _, _, err := r.getParams(hook); err == nil {
+		t.Error("getParams didn't return an error for a variable set that doesn't exist")
+	}
+	if status, err := r.checkVariableSet("missing"); err == nil || status != http.StatusBadRequest {
+		t.Errorf("checking a variable set that doesn't exist returned %d, %v, expected 400", status, err)
+	}
+
+	fake := r.K8sClient.(*fakek8sclientset.Clientset)
+	fake.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("unavailable")
+	})
+	if status, err := r.checkVariableSet("missing"); err == nil || status != http.StatusInternalServerError {
+		t.Errorf("checking a variable set that can't be read returned %d, %v, expected 500", status, err)
+	}
+}
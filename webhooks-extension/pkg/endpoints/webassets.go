@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+)
+
+/*--------------------------------------
+The web bundle is served from /web/ by RegisterWeb. Each file is also
+served under the hash of its content, /web/<hash>/extension.33e1ae7b.js,
+with a year long immutable Cache-Control, and /web/index.json maps every
+file to its hashed path:
+
+	{"files": {"extension.33e1ae7b.js": "web/9f86d081884c7d65/extension.33e1ae7b.js"},
+	 "bundle": "web/9f86d081884c7d65/extension.33e1ae7b.js"}
+
+A browser loading the bundle by its hashed path after an upgrade either
+gets the new bundle or, for a hash no longer served, a 404, never a stale
+bundle against the newer API. Unhashed paths, index.json included, must be
+revalidated on each use. Files are hashed when the extension starts.
+---------------------------------------*/
+
+const (
+	webAssetsIndex    = "index.json"
+	webAssetHashChars = 16
+	immutableCaching  = "public, max-age=31536000, immutable"
+	revalidateCaching = "no-cache"
+)
+
+var webAssetHashPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// webAssets serves the files of a directory under their own and hashed paths
+type webAssets struct {
+	dir    string
+	files  http.Handler
+	hashes map[string]string
+}
+
+type webAssetsIndexResponse struct {
+	Files  map[string]string `json:"files"`
+	Bundle string            `json:"bundle,omitempty"`
+}
+
+// newWebAssets hashes the files of dir to serve them
+func newWebAssets(dir string) *webAssets {
+	assets := &webAssets{dir: dir, files: http.FileServer(http.Dir(dir)), hashes: map[string]string{}}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		hash, err := webAssetHash(file)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		assets.hashes[filepath.ToSlash(name)] = hash
+		return nil
+	})
+	if err != nil {
+		logging.Log.Errorf("error hashing the web resources in %s, they are only served by their own paths: %s", dir, err)
+	}
+	return assets
+}
+
+// webResourcesDir is the directory RegisterWeb serves the web bundle from, empty if there is none
+func (r Resource) webResourcesDir() string {
+	if _, err := os.Stat(r.Install.WebResourcesDir); err == nil {
+		return r.Install.WebResourcesDir
+	}
+	return os.Getenv("KO_DATA_PATH")
+}
+
+// webAssetHash is the start of the SHA-256 hash of a file's content
+func webAssetHash(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:webAssetHashChars], nil
+}
+
+// hashedPath is the path, relative to the extension, of a file under its hash
+func hashedPath(name, hash string) string {
+	return "web/" + hash + "/" + name
+}
+
+// ServeHTTP serves a request for a path under /web/, the prefix having been stripped
+func (a *webAssets) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+	if name == webAssetsIndex {
+		w.Header().Set("Cache-Control", revalidateCaching)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.index())
+		return
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && webAssetHashPattern.MatchString(parts[0]) {
+		if a.hashes[parts[1]] != parts[0] {
+			// A file that has changed since, or was never served
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Cache-Control", immutableCaching)
+		req.URL.Path = "/" + parts[1]
+		a.files.ServeHTTP(w, req)
+		return
+	}
+	w.Header().Set("Cache-Control", revalidateCaching)
+	a.files.ServeHTTP(w, req)
+}
+
+// index maps each file to its hashed path, and names the newest UI bundle
+func (a *webAssets) index() webAssetsIndexResponse {
+	index := webAssetsIndexResponse{Files: map[string]string{}}
+	for name, hash := range a.hashes {
+		index.Files[name] = hashedPath(name, hash)
+	}
+	if bundle := newestBundle(a.dir); bundle != "" {
+		if hash, found := a.hashes[bundle]; found {
+			index.Bundle = hashedPath(bundle, hash)
+		}
+	}
+	return index
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebAssets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatalf("error creating web resources directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "extension.0a1b2c3d.js"), []byte("console.log('webhooks')"), 0644)
+	server := httptest.NewServer(http.StripPrefix("/web/", newWebAssets(dir)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/web/index.json")
+	if err != nil {
+		t.Fatalf("error getting the index: %s", err)
+	}
+	index := webAssetsIndexResponse{}
+	json.NewDecoder(resp.Body).Decode(&index)
+	resp.Body.Close()
+	hash, _ := webAssetHash(filepath.Join(dir, "extension.0a1b2c3d.js"))
+	expected := "web/" + hash + "/extension.0a1b2c3d.js"
+	if index.Files["extension.0a1b2c3d.js"] != expected || index.Bundle != expected {
+		t.Fatalf("unexpected index %+v", index)
+	}
+	if resp.Header.Get("Cache-Control") != revalidateCaching {
+		t.Errorf("index Cache-Control was %s", resp.Header.Get("Cache-Control"))
+	}
+
+	tests := []struct {
+		path    string
+		status  int
+		caching string
+	}{
+		{path: "/" + expected, status: http.StatusOK, caching: immutableCaching},
+		{path: "/web/extension.0a1b2c3d.js", status: http.StatusOK, caching: revalidateCaching},
+		// Hash of a bundle no longer served
+		{path: "/web/0123456789abcdef/extension.0a1b2c3d.js", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatalf("error getting %s: %s", test.path, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.path, test.status, resp.StatusCode)
+			continue
+		}
+		if test.status == http.StatusOK && (string(body) != "console.log('webhooks')" || resp.Header.Get("Cache-Control") != test.caching) {
+			t.Errorf("%s: served %s with Cache-Control %s", test.path, string(body), resp.Header.Get("Cache-Control"))
+		}
+	}
+}
@@ -44,21 +44,19 @@ import (
 
 	"net/http"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
 var (
-	modifyingEventListenerLock sync.Mutex
-	actions                    = pipelinesv1alpha1.Param{Name: "Wext-Incoming-Actions", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "opened,reopened,synchronize"}}
+	modifyingEventListenerLock = trackedMutex{name: "eventlistener"}
 )
 
 const (
-	eventListenerName  = "tekton-webhooks-eventlistener"
-	routeName          = "el-" + eventListenerName
-	webhookextPullTask = "monitor-task"
+	eventListenerServiceAccount = "tekton-webhooks-extension-eventlistener"
+	webhookextPullTask          = "monitor-task"
 )
 
 /*
@@ -67,12 +65,19 @@ const (
 */
 func (r Resource) createEventListener(webhook webhook, namespace, monitorTriggerNamePrefix string) (*v1alpha1.EventListener, error) {
 
-	monitorBindingName, err := r.getMonitorBindingName(webhook.GitRepositoryURL, webhook.PullTask)
+	monitorTask, err := r.pullTaskFor(webhook.GitRepositoryURL, webhook.PullTask)
 	if err != nil {
 		return nil, err
 	}
+	monitorBindingName := monitorTask.Binding
 
-	hookExtBinding, monitorExtBinding, err := r.createBindings(webhook, monitorBindingName, true)
+	templateName, err := r.getTemplateName(webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	// The monitor controller reports on pull requests instead of a monitor trigger, see monitorcontroller.go
+	hookExtBinding, monitorExtBinding, err := r.createBindings(webhook, monitorBindingName, !r.Defaults.MonitorController)
 	if err != nil {
 		bindings := []string{hookExtBinding, monitorExtBinding}
 		for _, binding := range bindings {
@@ -80,49 +85,59 @@ func (r Resource) createEventListener(webhook webhook, namespace, monitorTrigger
 				r.TriggersClient.TriggersV1alpha1().TriggerBindings(namespace).Delete(binding, &metav1.DeleteOptions{})
 			}
 		}
+		if r.isOverridesTemplate(templateName) {
+			r.TriggersClient.TriggersV1alpha1().TriggerTemplates(namespace).Delete(templateName, &metav1.DeleteOptions{})
+		}
 		return nil, err
 	}
 
-	pushTrigger := r.newTrigger(webhook.Name+"-"+webhook.Namespace+"-push-event",
+	pushTrigger := r.newTrigger(triggerPrefix(webhook)+"-push-event",
 		webhook.Pipeline+"-push-binding",
-		webhook.Pipeline+"-template",
+		templateName,
 		webhook.GitRepositoryURL,
-		"push, Push Hook, Tag Push Hook",
+		pushEvents,
 		webhook.AccessTokenRef,
 		hookExtBinding)
 
-	pullRequestTrigger := r.newTrigger(webhook.Name+"-"+webhook.Namespace+"-pullrequest-event",
+	pullRequestTrigger := r.newTrigger(triggerPrefix(webhook)+"-pullrequest-event",
 		webhook.Pipeline+"-pullrequest-binding",
-		webhook.Pipeline+"-template",
+		templateName,
 		webhook.GitRepositoryURL,
-		"pull_request, Merge Request Hook",
+		pullRequestEvents,
 		webhook.AccessTokenRef,
 		hookExtBinding)
 
-	// slightly dodgy code here as I take the first Interceptor,
-	// but we dont currently let users add extra interceptors
-	// note that this [0] pattern happens in multiple places
-	pullRequestTrigger.Interceptors[0].Webhook.Header = append(pullRequestTrigger.Interceptors[0].Webhook.Header, actions)
+	// The built-in interceptor is always the first, a webhook's own
+	// interceptors are chained after it by withInterceptors, so the
+	// [0] pattern used in multiple places always finds ours
+	pullRequestTrigger.Interceptors[0].Webhook.Header = append(pullRequestTrigger.Interceptors[0].Webhook.Header, pullRequestActions(webhook))
+	pushTrigger = withDefaultBranch(withPreview(withInterceptors(withSenders(withCapture(withDeadLetter(withVariableSet(pushTrigger, webhook), webhook), webhook), webhook), webhook), webhook), webhook)
+	pullRequestTrigger = withDefaultBranch(withPreview(withInterceptors(withSenders(withCapture(withDeadLetter(withVariableSet(pullRequestTrigger, webhook), webhook), webhook), webhook), webhook), webhook), webhook)
 
 	monitorTriggerName := r.generateMonitorTriggerName(monitorTriggerNamePrefix, []v1alpha1.EventListenerTrigger{})
 	monitorTrigger := r.newTrigger(monitorTriggerName,
 		monitorBindingName,
-		webhook.PullTask+"-template",
+		monitorTask.Template,
 		webhook.GitRepositoryURL,
-		"pull_request, Merge Request Hook",
+		pullRequestEvents,
 		webhook.AccessTokenRef,
 		monitorExtBinding)
-	monitorTrigger.Interceptors[0].Webhook.Header = append(monitorTrigger.Interceptors[0].Webhook.Header, actions)
+	monitorTrigger.Interceptors[0].Webhook.Header = append(monitorTrigger.Interceptors[0].Webhook.Header, monitorActions([]webhook{webhook}))
+	monitorTrigger.Interceptors[0].Webhook.Header = append(monitorTrigger.Interceptors[0].Webhook.Header, monitorSenderHeaders([]webhook{webhook})...)
 
-	triggers := []v1alpha1.EventListenerTrigger{pushTrigger, pullRequestTrigger, monitorTrigger}
+	triggers := withPreviewTeardown(webhook, withOnClose(webhook, withLabelRoutes(webhook, withMainBranch(webhook, withFileRules(webhook, withDependencyUpdates(webhook, withCanary(webhook, pushTrigger, pullRequestTrigger)))))))
+	if !r.Defaults.MonitorController {
+		triggers = append(triggers, monitorTrigger)
+	}
 
 	eventListener := v1alpha1.EventListener{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      eventListenerName,
+			Name:      r.eventListenerName(),
 			Namespace: namespace,
+			Labels:    managedLabels(),
 		},
 		Spec: v1alpha1.EventListenerSpec{
-			ServiceAccountName: "tekton-webhooks-extension-eventlistener",
+			ServiceAccountName: eventListenerServiceAccount,
 			Triggers:           triggers,
 		},
 	}
@@ -136,16 +151,22 @@ func (r Resource) createEventListener(webhook webhook, namespace, monitorTrigger
 func (r Resource) updateEventListener(eventListener *v1alpha1.EventListener, webhook webhook, monitorTriggerNamePrefix string) (*v1alpha1.EventListener, error) {
 
 	createMonitorBinding := false
-	monitorBindingName, err := r.getMonitorBindingName(webhook.GitRepositoryURL, webhook.PullTask)
+	monitorTask, err := r.pullTaskFor(webhook.GitRepositoryURL, webhook.PullTask)
 	if err != nil {
 		return nil, err
 	}
+	monitorBindingName := monitorTask.Binding
 
 	existingMonitorFound, _ := r.doesMonitorExist(monitorTriggerNamePrefix, webhook, eventListener.Spec.Triggers)
-	if !existingMonitorFound {
+	if !existingMonitorFound && !r.Defaults.MonitorController {
 		createMonitorBinding = true
 	}
 
+	templateName, err := r.getTemplateName(webhook)
+	if err != nil {
+		return nil, err
+	}
+
 	hookExtBinding, monitorExtBinding, err := r.createBindings(webhook, monitorBindingName, createMonitorBinding)
 	if err != nil {
 		bindings := []string{hookExtBinding, monitorExtBinding}
@@ -154,39 +175,44 @@ func (r Resource) updateEventListener(eventListener *v1alpha1.EventListener, web
 				r.TriggersClient.TriggersV1alpha1().TriggerBindings(r.Defaults.Namespace).Delete(binding, &metav1.DeleteOptions{})
 			}
 		}
+		if r.isOverridesTemplate(templateName) {
+			r.TriggersClient.TriggersV1alpha1().TriggerTemplates(r.Defaults.Namespace).Delete(templateName, &metav1.DeleteOptions{})
+		}
 		return nil, err
 	}
 
-	newPushTrigger := r.newTrigger(webhook.Name+"-"+webhook.Namespace+"-push-event",
+	newPushTrigger := r.newTrigger(triggerPrefix(webhook)+"-push-event",
 		webhook.Pipeline+"-push-binding",
-		webhook.Pipeline+"-template",
+		templateName,
 		webhook.GitRepositoryURL,
-		"push, Push Hook, Tag Push Hook",
+		pushEvents,
 		webhook.AccessTokenRef,
 		hookExtBinding)
 
-	newPullRequestTrigger := r.newTrigger(webhook.Name+"-"+webhook.Namespace+"-pullrequest-event",
+	newPullRequestTrigger := r.newTrigger(triggerPrefix(webhook)+"-pullrequest-event",
 		webhook.Pipeline+"-pullrequest-binding",
-		webhook.Pipeline+"-template",
+		templateName,
 		webhook.GitRepositoryURL,
-		"pull_request, Merge Request Hook",
+		pullRequestEvents,
 		webhook.AccessTokenRef,
 		hookExtBinding)
-	newPullRequestTrigger.Interceptors[0].Webhook.Header = append(newPullRequestTrigger.Interceptors[0].Webhook.Header, actions)
+	newPullRequestTrigger.Interceptors[0].Webhook.Header = append(newPullRequestTrigger.Interceptors[0].Webhook.Header, pullRequestActions(webhook))
+	newPushTrigger = withDefaultBranch(withPreview(withInterceptors(withSenders(withCapture(withDeadLetter(withVariableSet(newPushTrigger, webhook), webhook), webhook), webhook), webhook), webhook), webhook)
+	newPullRequestTrigger = withDefaultBranch(withPreview(withInterceptors(withSenders(withCapture(withDeadLetter(withVariableSet(newPullRequestTrigger, webhook), webhook), webhook), webhook), webhook), webhook), webhook)
 
-	eventListener.Spec.Triggers = append(eventListener.Spec.Triggers, newPushTrigger)
-	eventListener.Spec.Triggers = append(eventListener.Spec.Triggers, newPullRequestTrigger)
+	eventListener.Spec.Triggers = append(eventListener.Spec.Triggers, withPreviewTeardown(webhook, withOnClose(webhook, withLabelRoutes(webhook, withMainBranch(webhook, withFileRules(webhook, withDependencyUpdates(webhook, withCanary(webhook, newPushTrigger, newPullRequestTrigger)))))))...)
 
-	if !existingMonitorFound {
+	if createMonitorBinding {
 		monitorTriggerName := r.generateMonitorTriggerName(monitorTriggerNamePrefix, eventListener.Spec.Triggers)
 		newMonitor := r.newTrigger(monitorTriggerName,
 			monitorBindingName,
-			webhook.PullTask+"-template",
+			monitorTask.Template,
 			webhook.GitRepositoryURL,
-			"pull_request, Merge Request Hook",
+			pullRequestEvents,
 			webhook.AccessTokenRef,
 			monitorExtBinding)
-		newMonitor.Interceptors[0].Webhook.Header = append(newMonitor.Interceptors[0].Webhook.Header, actions)
+		newMonitor.Interceptors[0].Webhook.Header = append(newMonitor.Interceptors[0].Webhook.Header, monitorActions([]webhook{webhook}))
+		newMonitor.Interceptors[0].Webhook.Header = append(newMonitor.Interceptors[0].Webhook.Header, monitorSenderHeaders([]webhook{webhook})...)
 
 		eventListener.Spec.Triggers = append(eventListener.Spec.Triggers, newMonitor)
 	}
@@ -194,19 +220,29 @@ func (r Resource) updateEventListener(eventListener *v1alpha1.EventListener, web
 	return r.TriggersClient.TriggersV1alpha1().EventListeners(eventListener.Namespace).Update(eventListener)
 }
 
+// canonicalRepoURL returns a repository URL in the form repositories are compared in, as the
+// interceptor does: lower case, without the scheme, a trailing slash or .git
+func canonicalRepoURL(url string) string {
+	url = strings.ToLower(strings.TrimSpace(url))
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.TrimPrefix(url, "http://")
+	url = strings.TrimSuffix(url, "/")
+	return strings.TrimSuffix(url, ".git")
+}
+
+// sameRepo is whether two repository URLs are for the same repository
+func sameRepo(url1, url2 string) bool {
+	return canonicalRepoURL(url1) == canonicalRepoURL(url2)
+}
+
 func (r Resource) compareGitRepoNames(url1, url2 string) (bool, error) {
-	serverName1, ownerName1, repoName1, err1 := r.getGitValues(url1)
-	serverName2, ownerName2, repoName2, err2 := r.getGitValues(url2)
-	if err1 != nil {
-		return false, err1
-	}
-	if err2 != nil {
-		return false, err2
+	if _, _, _, err := r.getGitValues(url1); err != nil {
+		return false, err
 	}
-	if serverName1 == serverName2 && ownerName1 == ownerName2 && repoName1 == repoName2 {
-		return true, nil
+	if _, _, _, err := r.getGitValues(url2); err != nil {
+		return false, err
 	}
-	return false, nil
+	return sameRepo(url1, url2), nil
 }
 
 func (r Resource) generateMonitorTriggerName(prefix string, existingTriggers []v1alpha1.EventListenerTrigger) string {
@@ -259,22 +295,14 @@ func (r Resource) doesMonitorExist(monitorTriggerNamePrefix string, webhook webh
 	return existingMonitorFound, monitorName
 }
 
+// getMonitorBindingName returns the triggerbinding of the pull task, see pulltasks.go
 func (r Resource) getMonitorBindingName(repoURL, monitorTask string) (string, error) {
 	logging.Log.Debugf("monitor task name is: %s", monitorTask)
-	if monitorTask == "" {
-		monitorTask = "monitor-task"
-		logging.Log.Debugf("no monitor task specified, assuming name is %s", monitorTask)
-	}
-
-	monitorBindingName := monitorTask + "-binding"
-	if monitorTask == webhookextPullTask {
-		provider, _, err := utils.GetGitProviderAndAPIURL(repoURL)
-		if err != nil {
-			return "", err
-		}
-		monitorBindingName = monitorTask + "-" + provider + "-binding"
+	task, err := r.pullTaskFor(repoURL, monitorTask)
+	if err != nil {
+		return "", err
 	}
-	return monitorBindingName, nil
+	return task.Binding, nil
 }
 
 func (r Resource) newTrigger(name, bindingName, templateName, repoURL, event, secretName, extraBindingName string) v1alpha1.EventListenerTrigger {
@@ -305,7 +333,7 @@ func (r Resource) newTrigger(name, bindingName, templateName, repoURL, event, se
 					ObjectRef: &corev1.ObjectReference{
 						APIVersion: "v1",
 						Kind:       "Service",
-						Name:       "tekton-webhooks-extension-validator",
+						Name:       validatorServiceName,
 						Namespace:  r.Defaults.Namespace,
 					},
 				},
@@ -314,7 +342,7 @@ func (r Resource) newTrigger(name, bindingName, templateName, repoURL, event, se
 	}
 }
 
-func (r Resource) getParams(webhook webhook) (webhookParams, monitorParams []v1alpha1.Param) {
+func (r Resource) getParams(webhook webhook) (webhookParams, monitorParams []v1alpha1.Param, err error) {
 	saName := webhook.ServiceAccount
 	requestedReleaseName := webhook.ReleaseName
 	if saName == "" {
@@ -336,11 +364,9 @@ func (r Resource) getParams(webhook webhook) (webhookParams, monitorParams []v1a
 		logging.Log.Infof("Release name based on repository name: %s", releaseName)
 	}
 
-	sslVerify := true
-	ssl := os.Getenv("SSL_VERIFICATION_ENABLED")
-	if strings.ToLower(ssl) == "false" {
-		logging.Log.Warn("SSL_VERIFICATION_ENABLED SET TO FALSE")
-		sslVerify = false
+	sslVerify := r.Install.sslVerification()
+	if !sslVerify {
+		logging.Log.Warn("SSL verification is disabled")
 	}
 
 	provider, apiURL, err := utils.GetGitProviderAndAPIURL(webhook.GitRepositoryURL)
@@ -366,21 +392,54 @@ func (r Resource) getParams(webhook webhook) (webhookParams, monitorParams []v1a
 	if webhook.HelmSecret != "" {
 		hookParams = append(hookParams, v1alpha1.Param{Name: "webhooks-tekton-helm-secret", Value: webhook.HelmSecret})
 	}
+	hookParams = append(hookParams, provenanceParams()...)
+	hookParams = append(hookParams, pullRequestParams()...)
+	hookParams = append(hookParams, r.monitorControllerParams(webhook)...)
+	hookParams = append(hookParams, monitorModeParams(webhook)...)
+	hookParams = append(hookParams, retryParams(webhook.RetryPolicy)...)
+	hookParams = append(hookParams, overridesParams(webhook)...)
+	hookParams = append(hookParams, approvalParams(webhook)...)
+	hookParams = append(hookParams, shadowParams(webhook)...)
+	hookParams = append(hookParams, protectionParams(webhook)...)
+	hookParams = append(hookParams, allowSecretsParams(webhook)...)
+	hookParams = append(hookParams, triggerNameParams(webhook)...)
+	hookParams = append(hookParams, expiryParams(webhook)...)
+	hookParams = append(hookParams, costCenterParams(webhook)...)
+	hookParams = append(hookParams, canaryParams(webhook)...)
+	hookParams = append(hookParams, dependencyParams(webhook)...)
+	hookParams = append(hookParams, labelRouteParams(webhook)...)
+	hookParams = append(hookParams, fileRuleParams(webhook)...)
+	hookParams = append(hookParams, previewParams(webhook)...)
+	hookParams = append(hookParams, onCloseParams(webhook)...)
+	hookParams = append(hookParams, mainBranchParams(webhook)...)
+	hookParams = append(hookParams, defaultBranchParams(webhook)...)
+	hookParams = append(hookParams, callbackParams(webhook)...)
+	hookParams = append(hookParams, followUpParams(webhook)...)
+	hookParams = append(hookParams, r.credentialParams(webhook)...)
+	if webhook.VariableSet != "" {
+		set, err := r.getVariableSet(webhook.VariableSet)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting variable set %s: %s", webhook.VariableSet, err)
+		}
+		set.Name = webhook.VariableSet
+		hookParams = append(hookParams, variableParams(set)...)
+	}
 
+	// The monitor task can't render comment templates, see commenttemplates.go
 	onSuccessComment := webhook.OnSuccessComment
-	if onSuccessComment == "" {
+	if onSuccessComment == "" || isCommentTemplate(onSuccessComment) {
 		onSuccessComment = "Success"
 	}
 	onFailureComment := webhook.OnFailureComment
-	if onFailureComment == "" {
+	if onFailureComment == "" || isCommentTemplate(onFailureComment) {
 		onFailureComment = "Failed"
 	}
 	onTimeoutComment := webhook.OnTimeoutComment
-	if onTimeoutComment == "" {
+	if onTimeoutComment == "" || isCommentTemplate(onTimeoutComment) {
 		onTimeoutComment = "Unknown"
 	}
 	onMissingComment := webhook.OnMissingComment
-	if onMissingComment == "" {
+	if onMissingComment == "" || isCommentTemplate(onMissingComment) {
 		onMissingComment = "Missing"
 	}
 
@@ -390,32 +449,41 @@ func (r Resource) getParams(webhook webhook) (webhookParams, monitorParams []v1a
 		{Name: "commenttimeout", Value: onTimeoutComment},
 		{Name: "commentmissing", Value: onMissingComment},
 		{Name: "gitsecretname", Value: webhook.AccessTokenRef},
-		{Name: "gitsecretkeyname", Value: "accessToken"},
+		{Name: "gitsecretkeyname", Value: r.monitorSecretKey(webhook)},
 		{Name: "dashboardurl", Value: r.getDashboardURL(r.Defaults.Namespace)},
+		{Name: "dashboardlinktemplate", Value: r.Defaults.DashboardLinkTemplate},
 		{Name: "insecure-skip-tls-verify", Value: strconv.FormatBool(!sslVerify)},
 		{Name: "provider", Value: provider},
 		{Name: "apiurl", Value: apiURL},
+		{Name: "monitormode", Value: getMonitorMode(webhook)},
+		{Name: "monitorcomment", Value: getMonitorComment(webhook)},
+		{Name: "failureloglines", Value: getFailureLogLines(webhook)},
 	}
 
-	return hookParams, prMonitorParams
+	return hookParams, prMonitorParams, nil
 }
 
 // This is deliberately written as a function such that unittests can override
 // and set the name of artifacts for creation due to limitation of k8s GenerateName
-var GetTriggerBindingObjectMeta = func(name string) metav1.ObjectMeta {
+var GetTriggerBindingObjectMeta = func(prefix, name string) metav1.ObjectMeta {
 	return metav1.ObjectMeta{
-		GenerateName: "wext-" + name + "-",
+		GenerateName: bindingNamePrefix(prefix, name),
 	}
 }
 
 func (r Resource) createBindings(webhook webhook, monitorTriggerName string, createMonitorBinding bool) (webhookParamsBinding, monitorParamsBinding string, err error) {
-	hookParams, prMonitorParams := r.getParams(webhook)
+	hookParams, prMonitorParams, err := r.getParams(webhook)
+	if err != nil {
+		return "", "", err
+	}
 	hookBinding := v1alpha1.TriggerBinding{
-		ObjectMeta: GetTriggerBindingObjectMeta(webhook.Name),
+		ObjectMeta: GetTriggerBindingObjectMeta(r.resourcePrefix(), webhook.Name),
 		Spec: v1alpha1.TriggerBindingSpec{
 			Params: hookParams,
 		},
 	}
+	hookBinding.Labels = r.webhookLabels(webhook)
+	hookBinding.Annotations = webhookAnnotations(webhook)
 	actualHookBinding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(r.Defaults.Namespace).Create(&hookBinding)
 	if err != nil {
 		logging.Log.Errorf("failed to create binding %+v, with error %s", hookBinding, err.Error())
@@ -424,11 +492,12 @@ func (r Resource) createBindings(webhook webhook, monitorTriggerName string, cre
 
 	if createMonitorBinding {
 		monitorBinding := v1alpha1.TriggerBinding{
-			ObjectMeta: GetTriggerBindingObjectMeta(monitorTriggerName),
+			ObjectMeta: GetTriggerBindingObjectMeta(r.resourcePrefix(), monitorTriggerName),
 			Spec: v1alpha1.TriggerBindingSpec{
 				Params: prMonitorParams,
 			},
 		}
+		monitorBinding.Labels = r.repoLabels(webhook.GitRepositoryURL)
 
 		actualMonitorBinding, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(r.Defaults.Namespace).Create(&monitorBinding)
 		if err != nil {
@@ -480,7 +549,10 @@ func (r Resource) getDashboardURL(installNs string) string {
 	}
 
 	bodyJSON := []element{}
-	json.NewDecoder(resp.Body).Decode(&bodyJSON)
+	if err := json.NewDecoder(resp.Body).Decode(&bodyJSON); err != nil || len(bodyJSON) == 0 {
+		logging.Log.Errorf("the endpoints REST endpoint returned no endpoints, error: %v", err)
+		return url
+	}
 	return bodyJSON[0].URL
 }
 
@@ -525,36 +597,128 @@ func (r Resource) createWebhook(request *restful.Request, response *restful.Resp
 	defer modifyingEventListenerLock.Unlock()
 
 	logging.Log.Infof("Webhook creation request received with request: %+v.", request)
-	installNs := r.Defaults.Namespace
 
 	webhook := webhook{}
-	if err := request.ReadEntity(&webhook); err != nil {
+	if err := readEntity(request, &webhook); err != nil {
 		logging.Log.Errorf("error trying to read request entity as webhook: %s.", err)
 		RespondError(response, err, http.StatusBadRequest)
 		return
 	}
+	r.createWebhookFrom(request, webhook, response)
+}
+
+// createWebhookFrom validates and creates webhook for the caller of request, responding as POST /webhooks does.
+// The caller holds modifyingEventListenerLock.
+func (r Resource) createWebhookFrom(request *restful.Request, webhook webhook, response *restful.Response) {
+	installNs := r.Defaults.Namespace
 
 	// Sanitize GitRepositoryURL
-	webhook.GitRepositoryURL = strings.TrimSuffix(webhook.GitRepositoryURL, ".git")
+	webhook.GitRepositoryURL = strings.TrimSuffix(strings.TrimSuffix(webhook.GitRepositoryURL, "/"), ".git")
 
 	if webhook.PullTask == "" {
-		webhook.PullTask = webhookextPullTask
+		webhook.PullTask = r.defaultPullTask(webhook.GitRepositoryURL)
 	}
+	setDefaultComments(&webhook)
 
 	if webhook.Name != "" {
 		if len(webhook.Name) > 57 {
-			tooLongMessage := fmt.Sprintf("requested webhook name (%s) must be less than 58 characters", webhook.Name)
-			err := errors.New(tooLongMessage)
+			err := newMessageError("WEBHOOK_NAME_TOO_LONG", map[string]string{"name": webhook.Name})
 			logging.Log.Errorf("error: %s", err.Error())
 			RespondError(response, err, http.StatusBadRequest)
 			return
 		}
 	}
 
-	dockerRegDefault := r.Defaults.DockerRegistry
+	if err := validateOverrides(webhook.Overrides); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateExpiresAt(webhook.ExpiresAt); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateInterceptors(webhook.Interceptors); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateDeadLetterURL(webhook.DeadLetterURL); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateFollowUps(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSenders(webhook.Senders); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateRetryPolicy(webhook.RetryPolicy); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateMonitorMode(webhook.MonitorMode); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateMonitorComment(webhook.MonitorComment); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateFailureLogLines(webhook.FailureLogLines); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateCommentTemplates(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validateNoCredentials(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if status, err := r.checkVariableSet(webhook.VariableSet); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, status)
+		return
+	}
+
+	// The namespace's registry if the webhook doesn't set one, see registries.go
+	dockerRegDefault := r.dockerRegistryFor(webhook.Namespace)
 	// remove prefixes if any
 	webhook.DockerRegistry = strings.TrimPrefix(webhook.DockerRegistry, "https://")
 	webhook.DockerRegistry = strings.TrimPrefix(webhook.DockerRegistry, "http://")
+	if webhook.DockerRegistry != "" {
+		if _, err := parseRegistry(webhook.DockerRegistry); err != nil {
+			logging.Log.Errorf("error: %s", err.Error())
+			RespondError(response, err, http.StatusBadRequest)
+			return
+		}
+	}
 	if webhook.DockerRegistry == "" && dockerRegDefault != "" {
 		webhook.DockerRegistry = dockerRegDefault
 	}
@@ -562,14 +726,14 @@ func (r Resource) createWebhook(request *restful.Request, response *restful.Resp
 
 	namespace := webhook.Namespace
 	if namespace == "" {
-		err := errors.New("a namespace for creating a webhook is required, but none was given")
+		err := newMessageError("WEBHOOK_NAMESPACE_REQUIRED", nil)
 		logging.Log.Errorf("error: %s.", err.Error())
 		RespondError(response, err, http.StatusBadRequest)
 		return
 	}
 
 	if !strings.HasPrefix(webhook.GitRepositoryURL, "http") {
-		err := errors.New("the supplied GitRepositoryURL does not specify the protocol http:// or https://")
+		err := newMessageError("REPOSITORY_URL_PROTOCOL", nil)
 		logging.Log.Errorf("error: %s", err.Error())
 		RespondError(response, err, http.StatusBadRequest)
 		return
@@ -578,45 +742,209 @@ func (r Resource) createWebhook(request *restful.Request, response *restful.Resp
 	pieces := strings.Split(webhook.GitRepositoryURL, "/")
 	if len(pieces) < 4 {
 		logging.Log.Errorf("error creating webhook: GitRepositoryURL format error (%+v).", webhook.GitRepositoryURL)
-		RespondError(response, errors.New("GitRepositoryURL format error"), http.StatusBadRequest)
+		RespondError(response, newMessageError("REPOSITORY_URL_FORMAT", nil), http.StatusBadRequest)
 		return
 	}
 
+	var toInstall *starter
+	if webhook.Starter != "" {
+		resolved, err := r.resolveStarter(&webhook)
+		if err != nil {
+			logging.Log.Errorf("error: %s", err.Error())
+			RespondError(response, err, http.StatusBadRequest)
+			return
+		}
+		toInstall = &resolved
+	}
+
 	hooks, err := r.getHooksForRepo(webhook.GitRepositoryURL)
 	if len(hooks) > 0 {
 		for _, hook := range hooks {
 
 			if hook.Name == webhook.Name {
 				logging.Log.Errorf("error creating webhook: A webhook already exists with this name: %s", webhook.Name)
-				RespondError(response, errors.New("Webhook already exists with the same name"), http.StatusBadRequest)
+				RespondError(response, newMessageError("WEBHOOK_NAME_EXISTS", nil), http.StatusBadRequest)
 				return
 			}
 			if hook.Pipeline == webhook.Pipeline && hook.Namespace == webhook.Namespace {
 				logging.Log.Errorf("error creating webhook: A webhook already exists for GitRepositoryURL %+v, running pipeline %s in namespace %s.", webhook.GitRepositoryURL, webhook.Pipeline, webhook.Namespace)
-				RespondError(response, errors.New("Webhook already exists for the specified Git repository, running the same pipeline in the same namespace"), http.StatusBadRequest)
+				RespondError(response, newMessageError("WEBHOOK_PIPELINE_EXISTS", nil), http.StatusBadRequest)
 				return
 			}
 			if hook.PullTask != webhook.PullTask {
-				msg := fmt.Sprintf("PullTask mismatch. Webhooks on a repository must use the same PullTask existing webhooks use %s not %s.", hook.PullTask, webhook.PullTask)
-				logging.Log.Errorf("error creating webhook: " + msg)
-				RespondError(response, errors.New(msg), http.StatusBadRequest)
+				err := newMessageError("PULLTASK_MISMATCH", map[string]string{"existing": hook.PullTask, "requested": webhook.PullTask})
+				logging.Log.Errorf("error creating webhook: %s", err)
+				RespondError(response, err, http.StatusBadRequest)
 				return
 			}
 		}
 	}
 
+	if err := r.validateHookCallback(&webhook, hooks); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.assignTriggerPrefix(&webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+	if err := r.validateTriggerNamesFree(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		if _, ok := err.(messageError); ok {
+			RespondError(response, err, http.StatusBadRequest)
+		} else {
+			RespondError(response, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if webhook.CreateNamespaceIfMissing {
+		if status, err := r.authorizeNamespacePowers(request); err != nil {
+			logging.Log.Errorf("error: %s", err.Error())
+			RespondError(response, err, status)
+			return
+		}
+	}
+
+	// What the starter would install counts as there, it's only installed once the webhook is valid and allowed
+	var planned *starterResources
+	if toInstall != nil {
+		if planned, err = r.planStarter(*toInstall, webhook.Namespace); err != nil {
+			logging.Log.Errorf("error: %s", err.Error())
+			RespondError(response, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
 	_, templateErr := r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Get(webhook.Pipeline+"-template", metav1.GetOptions{})
+	if planned.definesTemplate(webhook.Pipeline + "-template") {
+		templateErr = nil
+	}
 	_, pushErr := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(webhook.Pipeline+"-push-binding", metav1.GetOptions{})
+	if planned.definesBinding(webhook.Pipeline + "-push-binding") {
+		pushErr = nil
+	}
 	_, pullrequestErr := r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Get(webhook.Pipeline+"-pullrequest-binding", metav1.GetOptions{})
+	if planned.definesBinding(webhook.Pipeline + "-pullrequest-binding") {
+		pullrequestErr = nil
+	}
 	if templateErr != nil || pushErr != nil || pullrequestErr != nil {
-		msg := fmt.Sprintf("Could not find the required trigger template or trigger bindings in namespace: %s. Expected to find: %s, %s and %s", installNs, webhook.Pipeline+"-template", webhook.Pipeline+"-push-binding", webhook.Pipeline+"-pullrequest-binding")
-		logging.Log.Errorf("%s", msg)
+		err := newMessageError("PIPELINE_RESOURCES_MISSING", map[string]string{"namespace": installNs, "template": webhook.Pipeline + "-template",
+			"pushbinding": webhook.Pipeline + "-push-binding", "pullrequestbinding": webhook.Pipeline + "-pullrequest-binding"})
+		logging.Log.Errorf("%s", err)
 		logging.Log.Errorf("template error: `%s`, pushbinding error: `%s`, pullrequest error: `%s`", templateErr, pushErr, pullrequestErr)
-		RespondError(response, errors.New(msg), http.StatusBadRequest)
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if !r.Defaults.MonitorController {
+		if err := r.validatePullTask(webhook); err != nil {
+			logging.Log.Errorf("error: %s", err.Error())
+			RespondError(response, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := r.validateDependencyRoute(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.validateMainBranchPipeline(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	// The repository's other webhooks already know its default branch
+	for _, hook := range hooks {
+		if webhook.DefaultBranch == "" {
+			webhook.DefaultBranch = hook.DefaultBranch
+		}
+	}
+	if webhook.DefaultBranch == "" {
+		branch, err := defaultBranchOf(r, webhook)
+		switch {
+		case err != nil && webhook.MainPipeline != "":
+			msg := fmt.Sprintf("error finding the default branch of %s for mainbranchpipeline: %s", webhook.GitRepositoryURL, err)
+			logging.Log.Errorf("%s", msg)
+			RespondError(response, errors.New(msg), http.StatusInternalServerError)
+			return
+		case err != nil:
+			// Found again when an event shows the branch, see defaultbranch.go
+			logging.Log.Errorf("error finding the default branch of %s: %s", webhook.GitRepositoryURL, err)
+		default:
+			webhook.DefaultBranch = branch
+		}
+	}
+
+	if err := r.validateOnClosePipeline(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.validatePreview(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.validateFileRules(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.validateLabelRoutes(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.validateCanary(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	// The policy decides before anything is changed for the webhook
+	if err := evaluatePolicy(webhook); err != nil {
+		logging.Log.Errorf("error creating webhook %s: %s", webhook.Name, err.Error())
+		if _, denied := err.(policyError); denied {
+			RespondError(response, err, http.StatusForbidden)
+		} else {
+			RespondError(response, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Only once the webhook is known to be valid and allowed, its namespace, starter and credential are prepared
+	if _, err := r.ensureWebhookNamespace(webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, http.StatusInternalServerError)
+		return
+	}
+
+	if planned != nil {
+		if _, err := r.installStarter(*toInstall, webhook.Namespace, *planned); err != nil {
+			logging.Log.Errorf("error: %s", err.Error())
+			RespondError(response, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if status, err := r.prepareBasicAuth(request, webhook); err != nil {
+		logging.Log.Errorf("error: %s", err.Error())
+		RespondError(response, err, status)
 		return
 	}
 
-	eventListener, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(eventListenerName, metav1.GetOptions{})
+	eventListener, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
 	if err != nil && !k8serrors.IsNotFound(err) {
 		msg := fmt.Sprintf("unable to create webhook due to error listing Tekton eventlistener: %s", err)
 		logging.Log.Errorf("%s", msg)
@@ -632,7 +960,7 @@ func (r Resource) createWebhook(request *restful.Request, response *restful.Resp
 	}
 	sanitisedURL := gitServer + "/" + gitOwner + "/" + gitRepo
 	// Single monitor trigger for all triggers on a repo - thus name to use for monitor is
-	monitorTriggerNamePrefix := gitOwner + "." + gitRepo + "-"
+	monitorTriggerNamePrefix := monitorTriggerPrefix(gitOwner, gitRepo)
 
 	if eventListener != nil && eventListener.Name != "" {
 		_, err := r.updateEventListener(eventListener, webhook, monitorTriggerNamePrefix)
@@ -652,62 +980,30 @@ func (r Resource) createWebhook(request *restful.Request, response *restful.Resp
 			return
 		}
 
-		_, varexists := os.LookupEnv("PLATFORM")
-		if !varexists {
-			err = r.createDeleteIngress("create", installNs)
-			if err != nil {
-				msg := fmt.Sprintf("error creating webhook due to error creating ingress. Error was: %s", err)
-				logging.Log.Errorf("%s", msg)
-				logging.Log.Debugf("Deleting eventlistener as failed creating Ingress")
-				err2 := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Delete(eventListenerName, &metav1.DeleteOptions{})
-				if err2 != nil {
-					updatedMsg := fmt.Sprintf("error creating webhook due to error creating ingress. Also failed to cleanup and delete eventlistener. Errors were: %s and %s", err, err2)
-					RespondError(response, errors.New(updatedMsg), http.StatusInternalServerError)
-					return
-				}
-				RespondError(response, errors.New(msg), http.StatusInternalServerError)
-				return
-			} else {
-				logging.Log.Debug("ingress creation succeeded")
-			}
-		} else {
-			if err := r.createOpenshiftRoute(routeName); err != nil {
-				logging.Log.Debug("Failed to create Route, deleting EventListener...")
-				err2 := r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Delete(eventListenerName, &metav1.DeleteOptions{})
-				if err2 != nil {
-					updatedMsg := fmt.Sprintf("Error creating webhook due to error creating route. Also failed to cleanup and delete eventlistener. Errors were: %s and %s", err, err2)
-					RespondError(response, errors.New(updatedMsg), http.StatusInternalServerError)
-					return
-				}
-				RespondError(response, err, http.StatusInternalServerError)
-				return
+		// Left as far as it got if this fails, see journal.go
+		if err := r.exposeEventListener(); err != nil {
+			steps := []string{stepExposure}
+			if len(hooks) == 0 {
+				steps = append(steps, stepProviderWebhook)
 			}
+			r.journalIncomplete(webhook, steps, err)
+			msg := fmt.Sprintf("error creating webhook due to error exposing the eventlistener, POST /webhooks/%s/complete retries the rest. Error was: %s", webhook.Name, err)
+			logging.Log.Errorf("%s", msg)
+			RespondError(response, errors.New(msg), http.StatusInternalServerError)
+			return
 		}
-
 	}
 
 	if len(hooks) == 0 {
 		// // Give the eventlistener a chance to be up and running or webhook ping
 		// // will get a 503 and might confuse people (although resend will work)
-		for i := 0; i < 30; i = i + 1 {
-			a, _ := r.K8sClient.AppsV1beta1().Deployments(installNs).Get(routeName, metav1.GetOptions{})
-			replicas := a.Status.ReadyReplicas
-			if replicas > 0 {
-				break
-			}
-			time.Sleep(1 * time.Second)
-		}
+		r.waitForEventListener(installNs, r.eventListenerName(), 30)
 
-		// Create webhook
+		// Create webhook, the webhook being left as far as it got if this fails, see journal.go
 		err = r.AddWebhook(webhook, gitOwner, gitRepo)
 		if err != nil {
-			err2 := r.deleteFromEventListener(webhook.Name+"-"+webhook.Namespace, installNs, monitorTriggerNamePrefix, webhook)
-			if err2 != nil {
-				updatedMsg := fmt.Sprintf("error creating webhook. Also failed to cleanup and delete entry from eventlistener. Errors were: %s and %s", err, err2)
-				RespondError(response, errors.New(updatedMsg), http.StatusInternalServerError)
-				return
-			}
-			RespondError(response, err, http.StatusInternalServerError)
+			r.journalIncomplete(webhook, []string{stepProviderWebhook}, err)
+			RespondError(response, err, providerErrorStatus(err, http.StatusInternalServerError))
 			return
 		}
 		logging.Log.Debug("webhook creation succeeded")
@@ -715,67 +1011,68 @@ func (r Resource) createWebhook(request *restful.Request, response *restful.Resp
 		logging.Log.Debugf("webhook already exists for repository %s - not creating new hook in GitHub", sanitisedURL)
 	}
 
+	r.syncMonitor(webhook.GitRepositoryURL, monitorTriggerNamePrefix)
+	// A webhook of the same name may have been left incomplete before being deleted
+	r.clearJournal(webhook.Namespace, webhook.Name)
+
 	response.WriteHeader(http.StatusCreated)
 }
 
-func (r Resource) createDeleteIngress(mode, installNS string) error {
-	if mode == "create" {
-		// Unlike webhook creation, the ingress does not need a protocol specified
-		callback := strings.TrimPrefix(r.Defaults.CallbackURL, "http://")
-		callback = strings.TrimPrefix(callback, "https://")
-
-		ingress := &v1beta1.Ingress{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "el-" + eventListenerName,
-				Namespace: installNS,
-			},
-			Spec: v1beta1.IngressSpec{
-				Rules: []v1beta1.IngressRule{
-					{
-						Host: callback,
-						IngressRuleValue: v1beta1.IngressRuleValue{
-							HTTP: &v1beta1.HTTPIngressRuleValue{
-								Paths: []v1beta1.HTTPIngressPath{
-									{
-										Backend: v1beta1.IngressBackend{
-											ServiceName: "el-" + eventListenerName,
-											ServicePort: intstr.IntOrString{
-												Type:   intstr.Int,
-												IntVal: 8080,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
+// exposeEventListener creates the ingress, or routes on OpenShift, exposing a new eventlistener, nothing being
+// exposed when deliveries are relayed
+func (r Resource) exposeEventListener() error {
+	if r.relayed() {
+		logging.Log.Debug("deliveries are relayed, not exposing the eventlistener")
+		return nil
+	}
+	if !r.Install.openShift() {
+		if err := r.createDeleteIngress("create", r.Defaults.Namespace); err != nil {
+			return err
 		}
-		// Check if TLS should be added
-		if strings.Index(r.Defaults.CallbackURL, "https://") == 0 {
-			certSecret, exists := os.LookupEnv("WEBHOOK_TLS_CERTIFICATE")
-			if !exists {
-				certSecret = "cert-" + eventListenerName
-			}
-			// check if the secret exists
-			_, err := r.K8sClient.CoreV1().Secrets(installNS).Get(certSecret, metav1.GetOptions{})
-			if err != nil {
-				// create certificate
-				certSecret = r.createCertificate(certSecret, installNS, callback)
-			}
-			if certSecret != "" {
-				// add TLS in the IngressSpec
-				ingressTLS := v1beta1.IngressTLS{
-					Hosts:      []string{callback},
-					SecretName: certSecret,
-				}
-				ingress.Spec.TLS = append(ingress.Spec.TLS, ingressTLS)
-			} else {
-				logging.Log.Error("Failed enabling TLS")
+		logging.Log.Debug("ingress creation succeeded")
+		return nil
+	}
+	if err := r.createCallbackRoutes(); err != nil {
+		return err
+	}
+	return r.createOpenshiftRoute(r.ingressName(), listenerServiceName(r.eventListenerName()))
+}
+
+// syncMonitor passes the settings of the repository's webhooks to its monitor
+func (r Resource) syncMonitor(repoURL, monitorTriggerNamePrefix string) {
+	if err := r.syncMonitorRetryPolicies(repoURL, monitorTriggerNamePrefix); err != nil {
+		logging.Log.Errorf("error passing retry policies to the monitor for repository %s: %s", repoURL, err)
+	}
+	if err := r.syncMonitorActions(repoURL, monitorTriggerNamePrefix); err != nil {
+		logging.Log.Errorf("error setting the monitor actions for repository %s: %s", repoURL, err)
+	}
+	if err := r.syncMonitorShadowTriggers(repoURL, monitorTriggerNamePrefix); err != nil {
+		logging.Log.Errorf("error passing shadow triggers to the monitor for repository %s: %s", repoURL, err)
+	}
+	if err := r.syncMonitorPreviews(repoURL, monitorTriggerNamePrefix); err != nil {
+		logging.Log.Errorf("error passing preview URLs to the monitor for repository %s: %s", repoURL, err)
+	}
+}
+
+// waitForEventListener polls (once a second, up to attempts times) for the named
+// eventlistener to be ready, see eventListenerReady, returning whether it became ready
+func (r Resource) waitForEventListener(installNS, name string, attempts int) bool {
+	for i := 0; i < attempts; i = i + 1 {
+		el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNS).Get(name, metav1.GetOptions{})
+		if err == nil {
+			if ready, _ := r.eventListenerReady(el); ready {
+				return true
 			}
 		}
+		time.Sleep(1 * time.Second)
+	}
+	logging.Log.Debugf("eventlistener %s not ready after %d attempts", name, attempts)
+	return false
+}
 
+func (r Resource) createDeleteIngress(mode, installNS string) error {
+	if mode == "create" {
+		ingress := r.newIngress(installNS, getCallbackURL(r))
 		ingress, err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNS).Create(ingress)
 		if err != nil {
 			return err
@@ -783,7 +1080,7 @@ func (r Resource) createDeleteIngress(mode, installNS string) error {
 		logging.Log.Debug("Ingress has been created")
 		return nil
 	} else if mode == "delete" {
-		err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNS).Delete("el-"+eventListenerName, &metav1.DeleteOptions{})
+		err := r.K8sClient.ExtensionsV1beta1().Ingresses(installNS).Delete(r.ingressName(), &metav1.DeleteOptions{})
 		if err != nil {
 			return err
 		}
@@ -795,7 +1092,118 @@ func (r Resource) createDeleteIngress(mode, installNS string) error {
 	}
 }
 
+// newIngress builds the ingress exposing the eventlistener on the host of callbackURL, and those of the additional
+// callback URLs, adding TLS (creating a certificate if needed) for each callback using https
+func (r Resource) newIngress(installNS, callbackURL string) *v1beta1.Ingress {
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.ingressName(),
+			Namespace: installNS,
+			Labels:    managedLabels(),
+		},
+	}
+	for i, url := range append([]string{callbackURL}, r.Defaults.AdditionalCallbackURLs...) {
+		// Unlike webhook creation, the ingress does not need a protocol specified
+		callback := callbackHost(url)
+		ingress.Spec.Rules = append(ingress.Spec.Rules, v1beta1.IngressRule{
+			Host: callback,
+			IngressRuleValue: v1beta1.IngressRuleValue{
+				HTTP: &v1beta1.HTTPIngressRuleValue{
+					Paths: []v1beta1.HTTPIngressPath{
+						{
+							Backend: r.listenerIngressBackend(),
+						},
+					},
+				},
+			},
+		})
+		// Check if TLS should be added
+		if strings.Index(url, "https://") != 0 {
+			continue
+		}
+		certSecret := r.Install.WebhookTLSCertificate
+		if certSecret == "" {
+			certSecret = r.callbackCertSecretName(i)
+		}
+		// check if the secret exists
+		_, err := r.K8sClient.CoreV1().Secrets(installNS).Get(certSecret, metav1.GetOptions{})
+		if err != nil {
+			// create certificate
+			certSecret = r.createCertificate(certSecret, installNS, callback)
+		}
+		if certSecret != "" {
+			// add TLS in the IngressSpec
+			ingressTLS := v1beta1.IngressTLS{
+				Hosts:      []string{callback},
+				SecretName: certSecret,
+			}
+			ingress.Spec.TLS = append(ingress.Spec.TLS, ingressTLS)
+		} else {
+			logging.Log.Errorf("Failed enabling TLS for %s", callback)
+		}
+	}
+	return ingress
+}
+
+// listenerIngressBackend is the eventlistener service, or the extension's deliveries port when buffering
+func (r Resource) listenerIngressBackend() v1beta1.IngressBackend {
+	if r.Defaults.DeliveryBuffer {
+		return v1beta1.IngressBackend{
+			ServiceName: extensionServiceName,
+			ServicePort: intstr.IntOrString{
+				Type:   intstr.Int,
+				IntVal: deliveriesPort,
+			},
+		}
+	}
+	return v1beta1.IngressBackend{
+		ServiceName: listenerServiceName(r.eventListenerName()),
+		ServicePort: intstr.IntOrString{
+			Type:   intstr.Int,
+			IntVal: 8080,
+		},
+	}
+}
+
 // Removes from Eventlistener, removes the webhook
+// removeHook deletes a webhook's triggers, and the provider webhook if it is the only webhook
+// of hooksOnRepo on its repository. The caller holds modifyingEventListenerLock.
+func (r Resource) removeHook(hook webhook, hooksOnRepo int, deletePipelineRuns bool) error {
+	repo := hook.GitRepositoryURL
+	_, gitOwner, gitRepo, err := r.getGitValues(repo)
+	if err != nil {
+		return fmt.Errorf("error getting git values for repo %s", repo)
+	}
+	// Single monitor trigger for all triggers on a repo - thus name to use for monitor is
+	monitorTriggerNamePrefix := monitorTriggerPrefix(gitOwner, gitRepo)
+
+	if hooksOnRepo == 1 {
+		logging.Log.Debug("No other pipelines triggered by this GitHub webhook, deleting webhook")
+		// Delete webhook
+		logging.Log.Debugf("Removing hook %s, owner: %s, repo: %s", hook, gitOwner, gitRepo)
+		err := r.RemoveWebhook(hook, gitOwner, gitRepo)
+		if err != nil {
+			logging.Log.Errorf("error removing webhook: %s", err)
+			return err
+		}
+		logging.Log.Debug("Webhook deletion succeeded")
+	}
+	if deletePipelineRuns {
+		r.deletePipelineRuns(repo, hook.Namespace, hook.Pipeline)
+	}
+	eventListenerEntryPrefix := triggerPrefix(hook)
+	err = r.deleteFromEventListener(eventListenerEntryPrefix, r.Defaults.Namespace, monitorTriggerNamePrefix, hook)
+	if err != nil {
+		logging.Log.Error(err)
+		return errors.New("error deleting webhook from eventlistener")
+	}
+	if hooksOnRepo > 1 {
+		r.syncMonitor(repo, monitorTriggerNamePrefix)
+	}
+	r.clearJournal(hook.Namespace, hook.Name)
+	return nil
+}
+
 func (r Resource) deleteWebhook(request *restful.Request, response *restful.Response) {
 	modifyingEventListenerLock.Lock()
 	defer modifyingEventListenerLock.Unlock()
@@ -842,44 +1250,26 @@ func (r Resource) deleteWebhook(request *restful.Request, response *restful.Resp
 		return
 	}
 
-	_, gitOwner, gitRepo, err := r.getGitValues(repo)
-	if err != nil {
+	if _, _, _, err := r.getGitValues(repo); err != nil {
 		err := fmt.Errorf("error getting git values for repo %s", repo)
 		logging.Log.Error(err)
 		RespondError(response, err, http.StatusInternalServerError)
 		return
 	}
-	// Single monitor trigger for all triggers on a repo - thus name to use for monitor is
-	monitorTriggerNamePrefix := gitOwner + "." + gitRepo + "-"
 
 	found := false
 	for _, hook := range webhooks {
 		if hook.Name == name && hook.Namespace == namespace {
 			found = true
-			if len(webhooks) == 1 {
-				logging.Log.Debug("No other pipelines triggered by this GitHub webhook, deleting webhook")
-				// Delete webhook
-				logging.Log.Debugf("Removing hook %s, owner: %s, repo: %s", hook, gitOwner, gitRepo)
-				err := r.RemoveWebhook(hook, gitOwner, gitRepo)
-				if err != nil {
-					logging.Log.Errorf("error removing webhook: %s", err)
-					RespondError(response, err, http.StatusInternalServerError)
-					return
-				}
-				logging.Log.Debug("Webhook deletion succeeded")
-			}
-			if toDeletePipelineRuns {
-				r.deletePipelineRuns(repo, namespace, hook.Pipeline)
-			}
-			eventListenerEntryPrefix := name + "-" + namespace
-			err = r.deleteFromEventListener(eventListenerEntryPrefix, r.Defaults.Namespace, monitorTriggerNamePrefix, hook)
-			if err != nil {
+			if status, err := r.authorizeDelete(request, hook); err != nil {
 				logging.Log.Error(err)
-				theError := errors.New("error deleting webhook from eventlistener")
-				RespondError(response, theError, http.StatusInternalServerError)
+				RespondError(response, err, status)
+				return
+			}
+			if err := r.removeHook(hook, len(webhooks), toDeletePipelineRuns); err != nil {
+				RespondError(response, err, providerErrorStatus(err, http.StatusInternalServerError))
 				return
 			}
-
 			response.WriteHeader(204)
 		}
 	}
@@ -967,6 +1357,7 @@ func (r Resource) createCertificate(secretName, installNS, callback string) stri
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      secretName,
 			Namespace: installNS,
+			Labels:    managedLabels(),
 		},
 		Type: "kubernetes.io/tls",
 		Data: map[string][]byte{
@@ -983,23 +1374,26 @@ func (r Resource) createCertificate(secretName, installNS, callback string) stri
 	}
 }
 
-func (r Resource) deleteFromEventListener(name, installNS, monitorTriggerNamePrefix string, webhook webhook) error {
-	logging.Log.Debugf("Deleting triggers for %s from the eventlistener", name)
-	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNS).Get(eventListenerName, metav1.GetOptions{})
-	if err != nil {
-		return err
-	}
+// eventListenerDeletion is what deleting a webhook's triggers from the eventlistener removes
+type eventListenerDeletion struct {
+	// The triggers left, the eventlistener being deleted if there are none
+	remaining      []v1alpha1.EventListenerTrigger
+	triggers       []string
+	bindings       map[string]string
+	templates      map[string]string
+	monitorRemoved bool
+}
 
+// planEventListenerDeletion works out what deleting the triggers of webhook, whose names start name, from el removes
+func (r Resource) planEventListenerDeletion(el *v1alpha1.EventListener, name, monitorTriggerNamePrefix string, webhook webhook) (eventListenerDeletion, error) {
 	monitorBindingName, err := r.getMonitorBindingName(webhook.GitRepositoryURL, webhook.PullTask)
 	if err != nil {
-		return err
+		return eventListenerDeletion{}, err
 	}
 
-	toRemove := []string{name + "-push-event", name + "-pullrequest-event"}
+	toRemove := webhookTriggerNames(name)
 	// store bindings to remove in this map as dupes won't be added
-	bindingsToRemove := make(map[string]string)
-
-	var newTriggers []v1alpha1.EventListenerTrigger
+	deletion := eventListenerDeletion{bindings: map[string]string{}, templates: map[string]string{}}
 	currentTriggers := el.Spec.Triggers
 
 	var monitorTrigger v1alpha1.EventListenerTrigger
@@ -1013,7 +1407,7 @@ func (r Resource) deleteFromEventListener(name, installNS, monitorTriggerNamePre
 		if existingMonitorFound && t.Name == monitorTriggerName {
 			monitorTrigger = t
 			for _, binding := range t.Bindings {
-				if strings.HasPrefix(binding.Name, "wext-"+monitorBindingName+"-") {
+				if strings.HasPrefix(binding.Name, r.resourcePrefix()+monitorBindingName+"-") {
 					actualMonitorBindingName = binding.Name
 				}
 			}
@@ -1022,7 +1416,7 @@ func (r Resource) deleteFromEventListener(name, installNS, monitorTriggerNamePre
 			// do by checking the Wext-Repository-Url on the trigger's interceptor param
 			interceptorParams := t.Interceptors[0].Webhook.Header
 			for _, p := range interceptorParams {
-				if p.Name == "Wext-Repository-Url" && p.Value.StringVal == webhook.GitRepositoryURL {
+				if p.Name == "Wext-Repository-Url" && sameRepo(p.Value.StringVal, webhook.GitRepositoryURL) {
 					triggersOnRepo++
 				}
 			}
@@ -1031,36 +1425,60 @@ func (r Resource) deleteFromEventListener(name, installNS, monitorTriggerNamePre
 				if triggerName == t.Name {
 					triggersDeleted++
 					found = true
+					deletion.triggers = append(deletion.triggers, t.Name)
+					if r.isOverridesTemplate(t.Template.Name) {
+						deletion.templates[t.Template.Name] = t.Template.Name
+					}
 					for _, binding := range t.Bindings {
-						if strings.HasPrefix(binding.Name, "wext-"+webhook.Name+"-") {
-							bindingsToRemove[binding.Name] = binding.Name
+						if strings.HasPrefix(binding.Name, bindingNamePrefix(r.resourcePrefix(), webhook.Name)) {
+							deletion.bindings[binding.Name] = binding.Name
 						}
 					}
 					break
 				}
 			}
 			if !found {
-				newTriggers = append(newTriggers, t)
+				deletion.remaining = append(deletion.remaining, t)
 			}
 		}
 	}
 
-	if triggersOnRepo > triggersDeleted {
+	// There is no monitor entry for repositories added while the monitor controller is enabled
+	if !existingMonitorFound {
+		logging.Log.Debugf("no monitor found for repository %s", webhook.GitRepositoryURL)
+	} else if triggersOnRepo > triggersDeleted {
 		// Leave the monitor entry
-		newTriggers = append(newTriggers, monitorTrigger)
+		deletion.remaining = append(deletion.remaining, monitorTrigger)
 	} else {
 		// OK to delete monitor binding as monitor getting deleted
-		bindingsToRemove[actualMonitorBindingName] = actualMonitorBindingName
+		deletion.bindings[actualMonitorBindingName] = actualMonitorBindingName
+		deletion.triggers = append(deletion.triggers, monitorTriggerName)
+		deletion.monitorRemoved = true
+	}
+	return deletion, nil
+}
+
+func (r Resource) deleteFromEventListener(name, installNS, monitorTriggerNamePrefix string, webhook webhook) error {
+	logging.Log.Debugf("Deleting triggers for %s from the eventlistener", name)
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(installNS).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		return err
 	}
 
-	if len(newTriggers) == 0 {
+	deletion, err := r.planEventListenerDeletion(el, name, monitorTriggerNamePrefix, webhook)
+	if err != nil {
+		return err
+	}
+
+	if len(deletion.remaining) == 0 {
 		err = r.TriggersClient.TriggersV1alpha1().EventListeners(installNS).Delete(el.Name, &metav1.DeleteOptions{})
 		if err != nil {
 			return err
 		}
 
-		_, varExists := os.LookupEnv("PLATFORM")
-		if !varExists {
+		if r.relayed() {
+			logging.Log.Debug("deliveries are relayed, no ingress or route to delete")
+		} else if !r.Install.openShift() {
 			err = r.createDeleteIngress("delete", installNS)
 			if err != nil {
 				logging.Log.Errorf("error deleting ingress: %s", err)
@@ -1069,7 +1487,11 @@ func (r Resource) deleteFromEventListener(name, installNS, monitorTriggerNamePre
 				logging.Log.Debug("Ingress deleted")
 			}
 		} else {
-			if err := r.deleteOpenshiftRoute(routeName); err != nil {
+			err := r.deleteCallbackRoutes()
+			if err == nil {
+				err = r.deleteOpenshiftRoute(r.ingressName())
+			}
+			if err != nil {
 				msg := fmt.Sprintf("error deleting webhook due to error deleting route. Error was: %s", err)
 				logging.Log.Errorf("%s", msg)
 				return err
@@ -1077,7 +1499,7 @@ func (r Resource) deleteFromEventListener(name, installNS, monitorTriggerNamePre
 			logging.Log.Debug("route deletion succeeded")
 		}
 	} else {
-		el.Spec.Triggers = newTriggers
+		el.Spec.Triggers = deletion.remaining
 		logging.Log.Debugf("Update eventlistener: %+v", el.Spec.Triggers)
 		_, err = r.TriggersClient.TriggersV1alpha1().EventListeners(installNS).Update(el)
 		if err != nil {
@@ -1086,13 +1508,20 @@ func (r Resource) deleteFromEventListener(name, installNS, monitorTriggerNamePre
 		}
 	}
 
-	for binding := range bindingsToRemove {
+	for binding := range deletion.bindings {
 		err = r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNS).Delete(binding, &metav1.DeleteOptions{})
 		if err != nil {
 			logging.Log.Errorf("error deleting triggerbinding: %s", binding)
 			logging.Log.Errorf("error: %s", err)
 		}
 	}
+	for template := range deletion.templates {
+		err = r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNS).Delete(template, &metav1.DeleteOptions{})
+		if err != nil {
+			logging.Log.Errorf("error deleting triggertemplate: %s", template)
+			logging.Log.Errorf("error: %s", err)
+		}
+	}
 	return err
 }
 
@@ -1104,10 +1533,13 @@ func (r Resource) getAllWebhooks(request *restful.Request, response *restful.Res
 		RespondError(response, err, http.StatusInternalServerError)
 		return
 	}
-	response.WriteEntity(webhooks)
+	response.WriteEntity(r.withJournal(r.withActivity(r.withHealth(webhooks), time.Now())))
 }
 
 func (r Resource) getHooksForRepo(gitURL string) ([]webhook, error) {
+	if index, found := r.indexedWebhooks(); found {
+		return append([]webhook{}, index.byRepo[canonicalRepoURL(gitURL)]...), nil
+	}
 	hooksForRepo := []webhook{}
 	allHooks, err := r.getWebhooksFromEventListener()
 	if err != nil {
@@ -1115,7 +1547,7 @@ func (r Resource) getHooksForRepo(gitURL string) ([]webhook, error) {
 	}
 
 	for _, hook := range allHooks {
-		if hook.GitRepositoryURL == gitURL {
+		if sameRepo(hook.GitRepositoryURL, gitURL) {
 			hooksForRepo = append(hooksForRepo, hook)
 		}
 	}
@@ -1123,9 +1555,18 @@ func (r Resource) getHooksForRepo(gitURL string) ([]webhook, error) {
 	return hooksForRepo, nil
 }
 
+// getWebhooksFromEventListener returns the webhooks of r's eventlistener, from its index if it has one
 func (r Resource) getWebhooksFromEventListener() ([]webhook, error) {
+	if index, found := r.indexedWebhooks(); found {
+		return append([]webhook{}, index.hooks...), nil
+	}
+	return r.listWebhooks()
+}
+
+// listWebhooks reads the webhooks of r's eventlistener from its triggers and their triggerbindings
+func (r Resource) listWebhooks() ([]webhook, error) {
 	logging.Log.Debugf("Getting webhooks from eventlistener")
-	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(r.Defaults.Namespace).Get(eventListenerName, metav1.GetOptions{})
+	el, err := r.TriggersClient.TriggersV1alpha1().EventListeners(r.Defaults.Namespace).Get(r.eventListenerName(), metav1.GetOptions{})
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			return []webhook{}, nil
@@ -1152,11 +1593,32 @@ func (r Resource) getWebhooksFromEventListener() ([]webhook, error) {
 
 func (r Resource) getHookFromTrigger(t v1alpha1.EventListenerTrigger, suffix string) webhook {
 	var releaseName, namespace, serviceaccount, pulltask, dockerreg, helmsecret, repo, gitSecret string
+	var retry retryPolicy
+	var pipeline string
+	var overrides *pipelineRunOverrides
+	var variableSet string
+	var requireApproval, shadowMode, protected, allowSecrets bool
+	var hookName string
+	var expiresAt, owner, costCenter string
+	var canary *canaryRoute
+	var dependencyRoute *dependencyRoute
+	var labelRoutes []labelRoute
+	var fileRules []fileRule
+	var preview *previewEnvironment
+	var onClosePipeline string
+	var mainPipeline, defaultBranch string
+	var callbackURL string
+	var next *followUps
+	var deadLetterURL string
+	var capturePayloads bool
+	var monitor monitorSettings
+	var monitorMode string
 	for _, binding := range t.Bindings {
 		b, err := r.TriggersClient.TriggersV1alpha1().TriggerBindings(r.Defaults.Namespace).Get(binding.Ref, metav1.GetOptions{})
 		if err != nil {
 			logging.Log.Errorf("Error retrieving webhook information in full - could not find required TriggerBinding %s", binding.Ref)
 			t.Name = "Broken webhook! Resources not found"
+			continue
 		}
 		for _, param := range b.Spec.Params {
 			switch param.Name {
@@ -1173,22 +1635,103 @@ func (r Resource) getHookFromTrigger(t v1alpha1.EventListenerTrigger, suffix str
 				dockerreg = param.Value
 			case "webhooks-tekton-helm-secret":
 				helmsecret = param.Value
+			case "webhooks-tekton-retry-max":
+				retry.MaxRetries, _ = strconv.Atoi(param.Value)
+			case "webhooks-tekton-retry-reasons":
+				retry.Reasons = param.Value
+			case "webhooks-tekton-pipeline":
+				pipeline = param.Value
+			case "webhooks-tekton-pipelinerun-overrides":
+				overrides = &pipelineRunOverrides{}
+				if err := json.Unmarshal([]byte(param.Value), overrides); err != nil {
+					logging.Log.Errorf("Error reading pipelinerun overrides from TriggerBinding %s: %s", binding.Ref, err)
+				}
+			case "webhooks-tekton-variable-set":
+				variableSet = param.Value
+			case "webhooks-tekton-require-approval":
+				requireApproval = param.Value == "true"
+			case shadowParam:
+				shadowMode = param.Value == "true"
+			case protectedParam:
+				protected = param.Value == "true"
+			case allowSecretsParam:
+				allowSecrets = param.Value == "true"
+			case webhookNameParam:
+				hookName = param.Value
+			case "webhooks-tekton-expires-at":
+				expiresAt = param.Value
+			case "webhooks-tekton-owner":
+				owner = param.Value
+			case "webhooks-tekton-cost-center":
+				costCenter = param.Value
+			case "webhooks-tekton-canary":
+				canary = &canaryRoute{}
+				if err := json.Unmarshal([]byte(param.Value), canary); err != nil {
+					logging.Log.Errorf("Error reading canary from TriggerBinding %s: %s", binding.Ref, err)
+				}
+			case "webhooks-tekton-dependency-updates":
+				dependencyRoute = &dependencyRoute{}
+				if err := json.Unmarshal([]byte(param.Value), dependencyRoute); err != nil {
+					logging.Log.Errorf("Error reading dependencyupdates from TriggerBinding %s: %s", binding.Ref, err)
+				}
+			case "webhooks-tekton-main-branch-pipeline":
+				mainPipeline = param.Value
+			case defaultBranchParam:
+				defaultBranch = param.Value
+			case callbackParam:
+				callbackURL = param.Value
+			case "webhooks-tekton-on-close-pipeline":
+				onClosePipeline = param.Value
+			case "webhooks-tekton-preview":
+				if err := json.Unmarshal([]byte(param.Value), &preview); err != nil {
+					logging.Log.Errorf("Error reading preview from TriggerBinding %s: %s", binding.Ref, err)
+				}
+			case "webhooks-tekton-file-rules":
+				if err := json.Unmarshal([]byte(param.Value), &fileRules); err != nil {
+					logging.Log.Errorf("Error reading filerules from TriggerBinding %s: %s", binding.Ref, err)
+				}
+			case "webhooks-tekton-label-routes":
+				if err := json.Unmarshal([]byte(param.Value), &labelRoutes); err != nil {
+					logging.Log.Errorf("Error reading labelroutes from TriggerBinding %s: %s", binding.Ref, err)
+				}
+			case monitorModeParam:
+				monitorMode = param.Value
+			case monitorSettingsParam:
+				if err := json.Unmarshal([]byte(param.Value), &monitor); err != nil {
+					logging.Log.Errorf("Error reading monitor settings from TriggerBinding %s: %s", binding.Ref, err)
+				}
+			case "webhooks-tekton-followups":
+				next = &followUps{}
+				if err := json.Unmarshal([]byte(param.Value), next); err != nil {
+					logging.Log.Errorf("Error reading followups from TriggerBinding %s: %s", binding.Ref, err)
+				}
 			}
 		}
 	}
 
 	// Interceptors now have a type (we are using Webhook), and there can
-	// be multiple, as we only currently allow our interceptor we simply
-	// take the first
+	// be multiple, ours is always the first and any the webhook added
+	// follow it, see getInterceptorsFromTrigger
 	for _, header := range t.Interceptors[0].Webhook.Header {
 		switch header.Name {
 		case "Wext-Repository-Url":
 			repo = header.Value.StringVal
 		case "Wext-Secret-Name":
 			gitSecret = header.Value.StringVal
+		case deadLetterHeader:
+			deadLetterURL = header.Value.StringVal
+		case captureHeader:
+			capturePayloads = header.Value.StringVal == "true"
 		}
 	}
 
+	if pipeline == "" {
+		pipeline = strings.TrimSuffix(t.Template.Name, "-template")
+	}
+	if monitorMode == "" {
+		monitorMode = monitor.MonitorMode
+	}
+
 	if namespace == "" {
 		// For the broken webhook case - namespace and repo url is required for a successful delete
 		namespace = r.Defaults.Namespace
@@ -1198,7 +1741,7 @@ func (r Resource) getHookFromTrigger(t v1alpha1.EventListenerTrigger, suffix str
 	triggerAsHook := webhook{
 		Name:             strings.TrimSuffix(t.Name, "-"+namespace+suffix),
 		Namespace:        namespace,
-		Pipeline:         strings.TrimSuffix(t.Template.Name, "-template"),
+		Pipeline:         pipeline,
 		GitRepositoryURL: repo,
 		HelmSecret:       helmsecret,
 		PullTask:         pulltask,
@@ -1206,6 +1749,41 @@ func (r Resource) getHookFromTrigger(t v1alpha1.EventListenerTrigger, suffix str
 		ServiceAccount:   serviceaccount,
 		ReleaseName:      releaseName,
 		AccessTokenRef:   gitSecret,
+		RetryPolicy:      retry,
+		Overrides:        overrides,
+		VariableSet:      variableSet,
+		RequireApproval:  requireApproval,
+		Interceptors:     getInterceptorsFromTrigger(t),
+		Senders:          getSendersFromTrigger(t),
+		ExpiresAt:        expiresAt,
+		Owner:            owner,
+		CostCenter:       costCenter,
+		Canary:           canary,
+		DependencyRoute:  dependencyRoute,
+		LabelRoutes:      labelRoutes,
+		FileRules:        fileRules,
+		Preview:          preview,
+		OnClosePipeline:  onClosePipeline,
+		MainPipeline:     mainPipeline,
+		DefaultBranch:    defaultBranch,
+		CallbackURL:      callbackURL,
+		FollowUps:        next,
+		DeadLetterURL:    deadLetterURL,
+		CapturePayloads:  capturePayloads,
+		ShadowMode:       shadowMode,
+		Protected:        protected,
+		AllowSecrets:     allowSecrets,
+		OnSuccessComment: monitor.OnSuccessComment,
+		OnFailureComment: monitor.OnFailureComment,
+		OnTimeoutComment: monitor.OnTimeoutComment,
+		MonitorMode:      monitorMode,
+	}
+	if hookName != "" {
+		// Named from the trigger name template, see triggernames.go
+		triggerAsHook.Name = hookName
+		if prefix := strings.TrimSuffix(t.Name, suffix); prefix != hookName+"-"+namespace {
+			triggerAsHook.TriggerPrefix = prefix
+		}
 	}
 
 	return triggerAsHook
@@ -1213,7 +1791,7 @@ func (r Resource) getHookFromTrigger(t v1alpha1.EventListenerTrigger, suffix str
 
 func containedInArray(array []webhook, hook webhook) bool {
 	for _, item := range array {
-		if item == hook {
+		if reflect.DeepEqual(item, hook) {
 			return true
 		}
 	}
@@ -1232,25 +1810,14 @@ func (r Resource) deletePipelineRuns(gitRepoURL, namespace, pipeline string) err
 
 	found := false
 	for _, pipelineRun := range allPipelineRuns.Items {
-		if pipelineRun.Spec.PipelineRef.Name == pipeline {
-			labels := pipelineRun.Labels
-			serverURL := labels["webhooks.tekton.dev/gitServer"]
-			orgName := labels["webhooks.tekton.dev/gitOrg"]
-			repoName := labels["webhooks.tekton.dev/gitRepo"]
-			foundRepoURL := fmt.Sprintf("https://%s/%s/%s", serverURL, orgName, repoName)
-
-			gitRepoURL = strings.ToLower(strings.TrimSuffix(gitRepoURL, ".git"))
-			foundRepoURL = strings.ToLower(strings.TrimSuffix(foundRepoURL, ".git"))
-
-			if foundRepoURL == gitRepoURL {
-				found = true
-				err := r.TektonClient.TektonV1alpha1().PipelineRuns(namespace).Delete(pipelineRun.Name, &metav1.DeleteOptions{})
-				if err != nil {
-					logging.Log.Errorf("failed to delete %s, error: %s", pipelineRun.Name, err.Error())
-					return err
-				}
-				logging.Log.Infof("Deleted PipelineRun %s", pipelineRun.Name)
+		if isWebhookPipelineRun(pipelineRun, gitRepoURL, pipeline) {
+			found = true
+			err := r.TektonClient.TektonV1alpha1().PipelineRuns(namespace).Delete(pipelineRun.Name, &metav1.DeleteOptions{})
+			if err != nil {
+				logging.Log.Errorf("failed to delete %s, error: %s", pipelineRun.Name, err.Error())
+				return err
 			}
+			logging.Log.Infof("Deleted PipelineRun %s", pipelineRun.Name)
 		}
 	}
 	if !found {
@@ -1259,9 +1826,27 @@ func (r Resource) deletePipelineRuns(gitRepoURL, namespace, pipeline string) err
 	return nil
 }
 
+// isWebhookPipelineRun reports whether a PipelineRun is of the given pipeline and, going by
+// its webhooks.tekton.dev labels (see docs/Labels.md), was triggered from gitRepoURL
+func isWebhookPipelineRun(pipelineRun pipelinesv1alpha1.PipelineRun, gitRepoURL, pipeline string) bool {
+	if pipelineRun.Spec.PipelineRef == nil || pipelineRun.Spec.PipelineRef.Name != pipeline {
+		return false
+	}
+	labels := pipelineRun.Labels
+	serverURL := labels["webhooks.tekton.dev/gitServer"]
+	orgName := labels["webhooks.tekton.dev/gitOrg"]
+	repoName := labels["webhooks.tekton.dev/gitRepo"]
+	return sameRepo(fmt.Sprintf("https://%s/%s/%s", serverURL, orgName, repoName), gitRepoURL)
+}
+
 func (r Resource) getDefaults(request *restful.Request, response *restful.Response) {
-	logging.Log.Debugf("getDefaults returning: %v", r.Defaults)
-	response.WriteEntity(r.Defaults)
+	defaults := r.defaultsResponse()
+	// The registry of webhooks in a namespace, see registries.go
+	if namespace := request.QueryParameter("namespace"); namespace != "" {
+		defaults.DockerRegistry = r.dockerRegistryFor(namespace)
+	}
+	logging.Log.Debugf("getDefaults returning: %v", defaults)
+	response.WriteEntity(defaults)
 }
 
 // RespondError ...
@@ -1269,6 +1854,7 @@ func RespondError(response *restful.Response, err error, statusCode int) {
 	logging.Log.Errorf("Error for RespondError: %s.", err.Error())
 	logging.Log.Errorf("Response is %v.", *response)
 	response.AddHeader("Content-Type", "text/plain")
+	addMessageHeaders(response, err)
 	response.WriteError(statusCode, err)
 }
 
@@ -1293,16 +1879,55 @@ func (r Resource) RegisterExtensionWebService(container *restful.Container) {
 	ws.
 		Path("/webhooks").
 		Consumes(restful.MIME_JSON, restful.MIME_JSON).
-		Produces(restful.MIME_JSON, restful.MIME_JSON)
-
-	ws.Route(ws.POST("/").To(r.createWebhook))
-	ws.Route(ws.GET("/").To(r.getAllWebhooks))
-	ws.Route(ws.GET("/defaults").To(r.getDefaults))
-	ws.Route(ws.DELETE("/{name}").To(r.deleteWebhook))
-
-	ws.Route(ws.POST("/credentials").To(r.createCredential))
+		Produces(restful.MIME_JSON, mimeYAML)
+
+	// The webhook endpoints take a profile query parameter, see profiles.go. Those changing resources act as the
+	// caller if IMPERSONATE_CALLERS is set, see impersonation.go
+	ws.Route(ws.POST("/").Filter(r.GroupPolicyFilter).To(r.profiled(Resource.createWebhook)))
+	ws.Route(ws.GET("/").To(r.profiled(Resource.getAllWebhooks)))
+	ws.Route(ws.GET("/defaults").To(r.profiled(Resource.getDefaults)))
+	ws.Route(ws.GET("/defaults/effective").To(r.profiled(Resource.getEffectiveConfig)))
+	ws.Route(ws.GET("/search").To(r.profiled(Resource.search)))
+	ws.Route(ws.GET("/profiles").To(r.getAllProfiles))
+	ws.Route(ws.GET("/pulltasks").To(r.getAllPullTasks))
+	ws.Route(ws.GET("/starters").To(r.getAllStarters))
+	ws.Route(ws.GET("/messages").To(r.getMessages))
+	ws.Route(ws.GET("/extension").To(r.getExtensionMetadata))
+	ws.Route(ws.GET("/debug/state").To(r.getDebugState))
+	ws.Route(ws.DELETE("/").Filter(r.GroupPolicyFilter).To(r.profiled(Resource.deleteWebhooks)))
+	ws.Route(ws.DELETE("/{name}").Filter(r.GroupPolicyFilter).To(r.profiled(Resource.deleteWebhook)))
+	ws.Route(ws.GET("/{name}/delete-preview").To(r.profiled(Resource.previewDelete)))
+	ws.Route(ws.GET("/{name}/stats").To(r.profiled(Resource.getWebhookStats)))
+	ws.Route(ws.GET("/{name}/history").To(r.profiled(Resource.getWebhookHistory)))
+	ws.Route(ws.GET("/{name}/history/diff").To(r.profiled(Resource.diffWebhookHistory)))
+	ws.Route(ws.POST("/{name}/rollback").Filter(r.GroupPolicyFilter).To(r.profiled(Resource.rollbackWebhook)))
+	ws.Route(ws.POST("/{name}/simulate").Filter(r.GroupPolicyFilter).To(r.profiled(Resource.simulateWebhook)))
+	ws.Route(ws.POST("/{name}/preview").To(r.profiled(Resource.previewWebhook)))
+	ws.Route(ws.GET("/{name}/deliveries/{id}/payload").To(r.profiled(Resource.getDeliveryPayload)))
+	ws.Route(ws.POST("/{name}/repair").Filter(r.GroupPolicyFilter).To(r.profiled(Resource.repairWebhook)))
+	ws.Route(ws.POST("/{name}/complete").Filter(r.GroupPolicyFilter).To(r.profiled(Resource.completeWebhook)))
+	ws.Route(ws.POST("/{name}/rename").Filter(r.GroupPolicyFilter).To(r.profiled(Resource.renameWebhook)))
+	ws.Route(ws.POST("/{name}/clone").Filter(r.CloneGroupPolicyFilter).To(r.profiled(Resource.cloneWebhook)))
+	ws.Route(ws.POST("/migrate-callback").Filter(r.SharedGroupPolicyFilter).To(r.profiled(Resource.migrateCallback)))
+	ws.Route(ws.POST("/upgrade-listener").Filter(r.SharedGroupPolicyFilter).To(r.profiled(Resource.upgradeListener)))
+	ws.Route(ws.POST("/onboard").Filter(r.GroupPolicyFilter).To(r.asCaller(Resource.onboardNamespace)))
+	ws.Route(ws.POST("/session-token").To(r.createSessionToken))
+	ws.Route(ws.GET("/manifests").To(r.getManifests))
+	ws.Route(ws.POST("/manifests").Filter(r.GroupPolicyFilter).To(r.asCaller(Resource.bootstrapManifest)))
+	ws.Route(ws.POST("/manifests/sync").Filter(r.SharedGroupPolicyFilter).To(r.asCaller(Resource.syncManifestRequest)))
+	ws.Route(ws.POST("/defaultbranch/refresh").Filter(r.SharedGroupPolicyFilter).To(r.asCaller(Resource.refreshDefaultBranchRequest)))
+	ws.Route(ws.GET("/preflight").To(r.profiled(Resource.preflight)))
+	ws.Route(ws.GET("/infrastructure").To(r.getInfrastructure))
+	ws.Route(ws.GET("/discover").To(r.profiled(Resource.discover)))
+
+	ws.Route(ws.POST("/credentials").Filter(r.SharedGroupPolicyFilter).To(r.asCaller(Resource.createCredential)))
 	ws.Route(ws.GET("/credentials").To(r.getAllCredentials))
-	ws.Route(ws.DELETE("/credentials/{name}").To(r.deleteCredential))
+	ws.Route(ws.DELETE("/credentials/{name}").Filter(r.SharedGroupPolicyFilter).To(r.asCaller(Resource.deleteCredential)))
+
+	ws.Route(ws.POST("/variablesets").Filter(r.SharedGroupPolicyFilter).To(r.asCaller(Resource.createVariableSet)))
+	ws.Route(ws.GET("/variablesets").To(r.getAllVariableSets))
+	ws.Route(ws.PUT("/variablesets/{name}").Filter(r.SharedGroupPolicyFilter).To(r.asCaller(Resource.updateVariableSet)))
+	ws.Route(ws.DELETE("/variablesets/{name}").Filter(r.SharedGroupPolicyFilter).To(r.asCaller(Resource.deleteVariableSet)))
 
 	container.Add(ws)
 }
@@ -1310,36 +1935,42 @@ func (r Resource) RegisterExtensionWebService(container *restful.Container) {
 // RegisterWeb registers extension web bundle on the container
 func (r Resource) RegisterWeb(container *restful.Container) {
 	var handler http.Handler
-	webResourcesDir := os.Getenv("WEB_RESOURCES_DIR")
+	webResourcesDir := r.Install.WebResourcesDir
 	koDataPath := os.Getenv("KO_DATA_PATH")
 	_, err := os.Stat(webResourcesDir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			if koDataPath != "" {
-				logging.Log.Warnf("WEB_RESOURCES_DIR %s not found, serving static content from KO_DATA_PATH instead.", webResourcesDir)
-				handler = http.FileServer(http.Dir(koDataPath))
+				logging.Log.Warnf("web resources directory %s not found, serving static content from KO_DATA_PATH instead.", webResourcesDir)
+				handler = newWebAssets(koDataPath)
 			} else {
-				logging.Log.Errorf("WEB_RESOURCES_DIR %s not found and KO_DATA_PATH not found, static resource (UI) problems to be expected.", webResourcesDir)
+				logging.Log.Errorf("web resources directory %s not found and KO_DATA_PATH not found, static resource (UI) problems to be expected.", webResourcesDir)
 			}
 		} else {
-			logging.Log.Errorf("error returned while checking for WEB_RESOURCES_DIR %s", webResourcesDir)
+			logging.Log.Errorf("error returned while checking for web resources directory %s", webResourcesDir)
 		}
 	} else {
-		logging.Log.Infof("Serving static files from WEB_RESOURCES_DIR: %s", webResourcesDir)
-		handler = http.FileServer(http.Dir(webResourcesDir))
+		logging.Log.Infof("Serving static files from web resources directory: %s", webResourcesDir)
+		handler = newWebAssets(webResourcesDir)
 	}
 	container.Handle("/web/", http.StripPrefix("/web/", handler))
 }
 
 // createOpenshiftRoute attempts to create an Openshift Route on the service.
-// The Route has the same name as the service
-func (r Resource) createOpenshiftRoute(serviceName string) error {
+func (r Resource) createOpenshiftRoute(routeName, serviceName string) error {
+	_, err := r.RoutesClient.RouteV1().Routes(r.Defaults.Namespace).Create(r.newOpenshiftRoute(routeName, serviceName))
+	return err
+}
+
+// newOpenshiftRoute builds a route on the service, the router choosing its host
+func (r Resource) newOpenshiftRoute(routeName, serviceName string) *routesv1.Route {
 	annotations := make(map[string]string)
 	annotations["haproxy.router.openshift.io/timeout"] = "2m"
 
 	route := &routesv1.Route{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        serviceName,
+			Name:        routeName,
+			Labels:      managedLabels(),
 			Annotations: annotations,
 		},
 		Spec: routesv1.RouteSpec{
@@ -1353,8 +1984,13 @@ func (r Resource) createOpenshiftRoute(serviceName string) error {
 			},
 		},
 	}
-	_, err := r.RoutesClient.RouteV1().Routes(r.Defaults.Namespace).Create(route)
-	return err
+	if r.Defaults.DeliveryBuffer {
+		route.Spec.To.Name = extensionServiceName
+		route.Spec.Port = &routesv1.RoutePort{
+			TargetPort: intstr.FromString(deliveriesPortName),
+		}
+	}
+	return route
 }
 
 // deleteOpenshiftRoute attempts to delete an Openshift Route
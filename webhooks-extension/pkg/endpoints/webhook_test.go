@@ -25,6 +25,7 @@ import (
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
 	"strings"
 
@@ -213,6 +214,8 @@ func TestGetParams(t *testing.T) {
 				AccessTokenRef:   "token3",
 				Pipeline:         "pipeline3",
 				ServiceAccount:   "my-sa",
+				MonitorMode:      "status",
+				MonitorComment:   "sticky",
 			},
 			expectedProvider: "gitlab",
 			expectedAPIURL:   "https://gitlab.company.com/api/v4",
@@ -229,12 +232,29 @@ func TestGetParams(t *testing.T) {
 			expectedProvider: "github",
 			expectedAPIURL:   "https://github.company.com/api/v3/",
 		},
+		{
+			Webhook: webhook{
+				Name:             "name6",
+				Namespace:        "foo2",
+				GitRepositoryURL: "https://git.company.com/owner/repo3",
+				AccessTokenRef:   "token3",
+				Pipeline:         "pipeline3",
+				ServiceAccount:   "my-sa",
+			},
+			expectedProvider: "github",
+			expectedAPIURL:   "https://git.company.com/api/v3/",
+		},
 	}
 
 	r := dummyResource()
 	os.Setenv("SSL_VERIFICATION_ENABLED", "true")
+	os.Setenv("GITHUB_ENTERPRISE_HOSTS", "git.company.com")
+	defer os.Unsetenv("GITHUB_ENTERPRISE_HOSTS")
 	for _, tt := range testcases {
-		hookParams, monitorParams := r.getParams(tt.Webhook)
+		hookParams, monitorParams, err := r.getParams(tt.Webhook)
+		if err != nil {
+			t.Fatalf("getParams: %s", err)
+		}
 		expectedHookParams, expectedMonitorParams := getExpectedParams(tt.Webhook, r, tt.expectedProvider, tt.expectedAPIURL)
 		if !reflect.DeepEqual(hookParams, expectedHookParams) {
 			t.Error("The webhook params returned from r.getParams were not as expected")
@@ -287,6 +307,16 @@ func TestCompareRepos(t *testing.T) {
 			url2:          "http://gitLAB.com/FoO/bar",
 			expectedMatch: true,
 		},
+		{
+			url1:          "https://github.com/foo/bar/",
+			url2:          "https://github.com/foo/bar.git",
+			expectedMatch: true,
+		},
+		{
+			url1:          "https://github.com/foo/bar-baz",
+			url2:          "https://github.com/foo/bar",
+			expectedMatch: false,
+		},
 	}
 	r := dummyResource()
 	for _, tt := range testcases {
@@ -300,6 +330,71 @@ func TestCompareRepos(t *testing.T) {
 	}
 }
 
+func TestCanonicalRepoURL(t *testing.T) {
+	for url, expected := range map[string]string{
+		"https://github.com/foo/bar":       "github.com/foo/bar",
+		"https://GitHub.com/Foo/Bar.git":   "github.com/foo/bar",
+		"http://github.com/foo/bar/":       "github.com/foo/bar",
+		"https://github.com/foo/bar.git/":  "github.com/foo/bar",
+		" https://gitlab.com/foo/sub/bar ": "gitlab.com/foo/sub/bar",
+	} {
+		if canonical := canonicalRepoURL(url); canonical != expected {
+			t.Errorf("canonical URL of %q was %s, expected %s", url, canonical, expected)
+		}
+	}
+}
+
+func TestRepoMatchingIgnoresCaseAndSuffixes(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{
+		Name:             "hook",
+		Namespace:        installNs,
+		GitRepositoryURL: "https://github.com/Owner/Repo",
+		AccessTokenRef:   "token1",
+		Pipeline:         "pipeline",
+	}
+	createTriggerResources(hook, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	hooks, err := r.getHooksForRepo("https://github.com/owner/repo.git/")
+	if err != nil || len(hooks) != 1 {
+		t.Errorf("expected the webhook for a differently written URL, got %+v, %v", hooks, err)
+	}
+	if run := statsPipelineRun("run", corev1.ConditionTrue, 10, time.Now()); !isWebhookPipelineRun(run, "HTTPS://GitHub.com/OWNER/repo.git", "pipeline") {
+		t.Error("expected the PipelineRun to match a differently written URL")
+	}
+
+	// The monitor trigger is shared with a webhook whose URL differs only by case, so is kept
+	other := hook
+	other.Name = "other"
+	other.Pipeline = "pipeline2"
+	other.GitRepositoryURL = "https://github.com/owner/repo"
+	createTriggerResources(other, r)
+	if _, err := r.updateEventListener(el, other, "owner.repo-"); err != nil {
+		t.Fatalf("error updating eventlistener: %s", err)
+	}
+	if err := r.deleteFromEventListener(other.Name+"-"+other.Namespace, installNs, "owner.repo-", other); err != nil {
+		t.Fatalf("error deleting from the eventlistener: %s", err)
+	}
+	el, err = r.TriggersClient.TriggersV1alpha1().EventListeners(installNs).Get(r.eventListenerName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting eventlistener: %s", err)
+	}
+	monitors := 0
+	for _, trigger := range el.Spec.Triggers {
+		if strings.HasPrefix(trigger.Name, "owner.repo-") {
+			monitors++
+		}
+	}
+	if len(el.Spec.Triggers) != 3 || monitors != 1 {
+		t.Errorf("expected the first webhook's triggers and the monitor to be kept, got %+v", el.Spec.Triggers)
+	}
+}
+
 func TestGenerateMonitorTriggerName(t *testing.T) {
 	r := dummyResource()
 	var triggers []v1alpha1.EventListenerTrigger
@@ -396,6 +491,16 @@ func TestGetMonitorBindingName(t *testing.T) {
 			monitorTask:         "monitor-task",
 			expectedBindingName: "monitor-task-gitlab-binding",
 		},
+		{
+			repoURL:             "https://bitbucket.org/wibble/fish",
+			monitorTask:         "monitor-task",
+			expectedBindingName: "monitor-task-bitbucket-binding",
+		},
+		{
+			repoURL:             "https://gitea.example.com/wibble/fish",
+			monitorTask:         "monitor-task",
+			expectedBindingName: "monitor-task-gitea-binding",
+		},
 		{
 			repoURL:       "",
 			monitorTask:   "monitor-task",
@@ -840,6 +945,11 @@ func getExpectedParams(hook webhook, r *Resource, expectedProvider, expectedAPIU
 	if hook.HelmSecret != "" {
 		expectedHookParams = append(expectedHookParams, v1alpha1.Param{Name: "webhooks-tekton-helm-secret", Value: hook.HelmSecret})
 	}
+	expectedHookParams = append(expectedHookParams, provenanceParams()...)
+	expectedHookParams = append(expectedHookParams, pullRequestParams()...)
+	if hook.MonitorMode != "" {
+		expectedHookParams = append(expectedHookParams, v1alpha1.Param{Name: "webhooks-tekton-monitor-mode", Value: hook.MonitorMode})
+	}
 
 	expectedMonitorParams = []v1alpha1.Param{}
 	if hook.OnSuccessComment != "" {
@@ -865,9 +975,25 @@ func getExpectedParams(hook webhook, r *Resource, expectedProvider, expectedAPIU
 	expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "gitsecretname", Value: hook.AccessTokenRef})
 	expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "gitsecretkeyname", Value: "accessToken"})
 	expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "dashboardurl", Value: r.getDashboardURL(r.Defaults.Namespace)})
+	expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "dashboardlinktemplate", Value: r.Defaults.DashboardLinkTemplate})
 	expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "insecure-skip-tls-verify", Value: insecureAsString})
 	expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "provider", Value: expectedProvider})
 	expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "apiurl", Value: expectedAPIURL})
+	if hook.MonitorMode != "" {
+		expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "monitormode", Value: hook.MonitorMode})
+	} else {
+		expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "monitormode", Value: "comment"})
+	}
+	if hook.MonitorComment != "" {
+		expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "monitorcomment", Value: hook.MonitorComment})
+	} else {
+		expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "monitorcomment", Value: "new"})
+	}
+	if hook.FailureLogLines != nil {
+		expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "failureloglines", Value: strconv.Itoa(*hook.FailureLogLines)})
+	} else {
+		expectedMonitorParams = append(expectedMonitorParams, v1alpha1.Param{Name: "failureloglines", Value: "20"})
+	}
 
 	return
 }
@@ -913,7 +1039,7 @@ func (r Resource) getExpectedPushAndPullRequestTriggersForWebhook(webhook webhoo
 						Header: []pipelinesv1alpha1.Param{
 							{Name: "Wext-Trigger-Name", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.Name + "-" + webhook.Namespace + "-push-event"}},
 							{Name: "Wext-Repository-Url", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.GitRepositoryURL}},
-							{Name: "Wext-Incoming-Event", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "push, Push Hook, Tag Push Hook"}},
+							{Name: "Wext-Incoming-Event", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "push, Push Hook, Tag Push Hook, repo:push"}},
 							{Name: "Wext-Secret-Name", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.AccessTokenRef}}},
 						ObjectRef: &corev1.ObjectReference{
 							APIVersion: "v1",
@@ -949,9 +1075,9 @@ func (r Resource) getExpectedPushAndPullRequestTriggersForWebhook(webhook webhoo
 						Header: []pipelinesv1alpha1.Param{
 							{Name: "Wext-Trigger-Name", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.Name + "-" + webhook.Namespace + "-pullrequest-event"}},
 							{Name: "Wext-Repository-Url", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.GitRepositoryURL}},
-							{Name: "Wext-Incoming-Event", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "pull_request, Merge Request Hook"}},
+							{Name: "Wext-Incoming-Event", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "pull_request, Merge Request Hook, Note Hook, pullrequest:created, pullrequest:updated, pullrequest:approved, pullrequest:fulfilled, pullrequest:rejected, pullrequest:comment_created"}},
 							{Name: "Wext-Secret-Name", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: webhook.AccessTokenRef}},
-							{Name: "Wext-Incoming-Actions", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "opened,reopened,synchronize"}}},
+							{Name: "Wext-Incoming-Actions", Value: pipelinesv1alpha1.ArrayOrString{Type: pipelinesv1alpha1.ParamTypeString, StringVal: "opened,reopened,synchronize,comment"}}},
 						ObjectRef: &corev1.ObjectReference{
 							APIVersion: "v1",
 							Kind:       "Service",
@@ -982,9 +1108,9 @@ func getEnvDefaults(r *Resource, t *testing.T) EnvDefaults {
 	return defaults
 }
 
-func FakeGetTriggerBindingObjectMeta(name string) metav1.ObjectMeta {
+func FakeGetTriggerBindingObjectMeta(prefix, name string) metav1.ObjectMeta {
 	return metav1.ObjectMeta{
-		Name: "wext-" + name + "-",
+		Name: bindingNamePrefix(prefix, name),
 	}
 }
 
@@ -1019,6 +1145,12 @@ func testGetAllWebhooks(expectedWebhooks []webhook, r *Resource, t *testing.T) {
 
 	fmt.Printf("%+v", actualWebhooks)
 
+	// Health and activity are tested in health_test.go and activity_test.go
+	for i := range actualWebhooks {
+		actualWebhooks[i].Health = nil
+		actualWebhooks[i].Activity = nil
+	}
+
 	if len(expectedWebhooks) != len(actualWebhooks) {
 		t.Errorf("Incorrect length of result, expected %d, but was %d", len(expectedWebhooks), len(actualWebhooks))
 		return
@@ -1093,6 +1225,12 @@ func createTriggerResources(hook webhook, r *Resource) {
 		fmt.Printf("Error creating fake secret %s", secret.Name)
 	}
 
+	// The pull task shipped in base/, created by the first call on a Resource
+	for _, task := range defaultPullTasks() {
+		r.TriggersClient.TriggersV1alpha1().TriggerTemplates(installNs).Create(&v1alpha1.TriggerTemplate{ObjectMeta: metav1.ObjectMeta{Name: task.Template, Namespace: installNs}})
+		r.TriggersClient.TriggersV1alpha1().TriggerBindings(installNs).Create(&v1alpha1.TriggerBinding{ObjectMeta: metav1.ObjectMeta{Name: task.Binding, Namespace: installNs}})
+	}
+
 	return
 
 }
@@ -1180,7 +1318,7 @@ func Test_createOAuth2Client(t *testing.T) {
 	// Create client
 	accessToken := "foo"
 	ctx := context.Background()
-	client := utils.CreateOAuth2Client(ctx, accessToken, true)
+	client := utils.CreateOAuth2Client(ctx, accessToken, utils.GitTLSConfig(true))
 	// Test
 	responseText := "my response"
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1223,6 +1361,7 @@ func Test_createOpenshiftRoute(t *testing.T) {
 					Name: "route",
 					// Namepace in the dummy resource
 					Namespace:   "default",
+					Labels:      managedLabels(),
 					Annotations: map[string]string{"haproxy.router.openshift.io/timeout": "2m"},
 				},
 				Spec: routesv1.RouteSpec{
@@ -1243,7 +1382,7 @@ func Test_createOpenshiftRoute(t *testing.T) {
 		t.Run(tests[i].name, func(t *testing.T) {
 			r := dummyResource()
 			var hasErr bool
-			if err := r.createOpenshiftRoute(tests[i].serviceName); err != nil {
+			if err := r.createOpenshiftRoute(tests[i].serviceName, tests[i].serviceName); err != nil {
 				hasErr = true
 			}
 			if diff := cmp.Diff(tests[i].hasErr, hasErr); diff != "" {
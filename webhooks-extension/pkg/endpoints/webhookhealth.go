@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"fmt"
+	"time"
+
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// webhookHealth reports whether what a webhook refers to still exists, as its
+// triggers only hold names that can go stale, e.g. when a credential is deleted
+type webhookHealth struct {
+	Healthy  bool     `json:"healthy"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// healthChecker looks up the resources webhooks refer to, remembering each
+// lookup as webhooks on the same repository or namespace share them
+type healthChecker struct {
+	r       Resource
+	checked map[string]error
+}
+
+// withHealth sets the health of each webhook
+func (r Resource) withHealth(hooks []webhook) []webhook {
+	checker := &healthChecker{r: r, checked: map[string]error{}}
+	for i := range hooks {
+		hooks[i].Health = checker.check(hooks[i])
+	}
+	return hooks
+}
+
+// check returns the health of the webhook, a problem for each of its credential,
+// service account and pipeline that no longer exists or can't be read
+func (c *healthChecker) check(hook webhook) *webhookHealth {
+	health := &webhookHealth{Healthy: true}
+	problem := func(kind, namespace, name string, err error) {
+		if err == nil {
+			return
+		}
+		health.Healthy = false
+		if k8serrors.IsNotFound(err) {
+			health.Problems = append(health.Problems, fmt.Sprintf("%s %s not found in namespace %s", kind, name, namespace))
+		} else {
+			health.Problems = append(health.Problems, fmt.Sprintf("error getting %s %s in namespace %s: %s", kind, name, namespace, err))
+		}
+	}
+
+	installNs := c.r.Defaults.Namespace
+	problem("credential", installNs, hook.AccessTokenRef, c.lookup("secret", installNs, hook.AccessTokenRef, func() error {
+		_, err := c.r.K8sClient.CoreV1().Secrets(installNs).Get(hook.AccessTokenRef, metav1.GetOptions{})
+		return err
+	}))
+	if hook.ServiceAccount != "" {
+		problem("service account", hook.Namespace, hook.ServiceAccount, c.lookup("serviceaccount", hook.Namespace, hook.ServiceAccount, func() error {
+			_, err := c.r.K8sClient.CoreV1().ServiceAccounts(hook.Namespace).Get(hook.ServiceAccount, metav1.GetOptions{})
+			return err
+		}))
+	}
+	problem("pipeline", hook.Namespace, hook.Pipeline, c.lookup("pipeline", hook.Namespace, hook.Pipeline, func() error {
+		_, err := c.r.TektonClient.TektonV1alpha1().Pipelines(hook.Namespace).Get(hook.Pipeline, metav1.GetOptions{})
+		return err
+	}))
+
+	if hook.ExpiresAt != "" {
+		if expiry, err := time.Parse(time.RFC3339, hook.ExpiresAt); err == nil && !time.Now().Before(expiry) {
+			health.Healthy = false
+			health.Problems = append(health.Problems, fmt.Sprintf("expired at %s, deliveries are rejected until it is deleted", hook.ExpiresAt))
+		}
+	}
+
+	if !health.Healthy {
+		logging.Log.Debugf("webhook %s in namespace %s is unhealthy: %v", hook.Name, hook.Namespace, health.Problems)
+	}
+	return health
+}
+
+func (c *healthChecker) lookup(kind, namespace, name string, get func() error) error {
+	key := kind + "/" + namespace + "/" + name
+	if err, ok := c.checked[key]; ok {
+		return err
+	}
+	err := get()
+	c.checked[key] = err
+	return err
+}
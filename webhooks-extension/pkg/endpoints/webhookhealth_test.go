@@ -0,0 +1,46 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+
+	pipelinesv1alpha1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWithHealth(t *testing.T) {
+	r := dummyResource()
+	r.K8sClient.CoreV1().Secrets(r.Defaults.Namespace).Create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "token"}})
+	r.K8sClient.CoreV1().ServiceAccounts("green").Create(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "builder"}})
+	r.TektonClient.TektonV1alpha1().Pipelines("green").Create(&pipelinesv1alpha1.Pipeline{ObjectMeta: metav1.ObjectMeta{Name: "build"}})
+
+	hooks := r.withHealth([]webhook{
+		{Name: "healthy", Namespace: "green", AccessTokenRef: "token", ServiceAccount: "builder", Pipeline: "build"},
+		{Name: "stale", Namespace: "green", AccessTokenRef: "deleted", ServiceAccount: "gone", Pipeline: "build"},
+	})
+
+	if !reflect.DeepEqual(hooks[0].Health, &webhookHealth{Healthy: true}) {
+		t.Errorf("expected webhook healthy to be healthy, got %+v", hooks[0].Health)
+	}
+	expected := &webhookHealth{Healthy: false, Problems: []string{
+		"credential deleted not found in namespace default",
+		"service account gone not found in namespace green",
+	}}
+	if !reflect.DeepEqual(hooks[1].Health, expected) {
+		t.Errorf("expected webhook stale health %+v, got %+v", expected, hooks[1].Health)
+	}
+}
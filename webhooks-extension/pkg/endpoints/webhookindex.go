@@ -0,0 +1,197 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"strings"
+	"sync"
+
+	restful "github.com/emicklei/go-restful"
+	logging "github.com/tektoncd/experimental/webhooks-extension/pkg/logging"
+	"github.com/tektoncd/triggers/pkg/apis/triggers/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+/*--------------------------------------
+Reading the webhooks means getting the eventlistener and the triggerbinding
+of each of its triggers, so on installs with hundreds of webhooks finding a
+repository's webhooks, checking for a duplicate or matching a PipelineRun
+to its webhook was a scan of hundreds of resources every time. IndexWebhooks
+builds an index of each profile's webhooks, by canonical repository URL and
+by pull request trigger, at startup, and rebuilds it whenever an informer
+sees an eventlistener or triggerbinding in the install namespace change.
+WebhookIndexFilter also rebuilds it once a request changing resources has
+been handled, so the request's own changes are read back straight away.
+getWebhooksFromEventListener, getHooksForRepo and the monitor controller use
+the index of r's eventlistener when there is one, and list as before
+otherwise.
+---------------------------------------*/
+
+// webhookIndex is the webhooks of an eventlistener when it was last built, never modified once built
+type webhookIndex struct {
+	hooks  []webhook
+	byRepo map[string][]webhook
+	// Pull request trigger names to their webhook
+	byTrigger map[string]webhook
+}
+
+var (
+	// Indexes by the install namespace and eventlistener name they're of
+	webhookIndexes     = map[string]*webhookIndex{}
+	webhookIndexing    bool
+	webhookIndexesLock sync.RWMutex
+	// Held building indexes, so one built from older resources doesn't replace a newer one
+	webhookIndexBuildLock sync.Mutex
+)
+
+func (r Resource) webhookIndexKey() string {
+	return r.Defaults.Namespace + "/" + r.eventListenerName()
+}
+
+// indexedWebhooks returns the index of r's eventlistener, false if it isn't indexed
+func (r Resource) indexedWebhooks() (*webhookIndex, bool) {
+	webhookIndexesLock.RLock()
+	defer webhookIndexesLock.RUnlock()
+	index, found := webhookIndexes[r.webhookIndexKey()]
+	return index, found
+}
+
+// buildWebhookIndex lists the webhooks of r's eventlistener into an index
+func (r Resource) buildWebhookIndex() (*webhookIndex, error) {
+	hooks, err := r.listWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	index := &webhookIndex{hooks: hooks, byRepo: map[string][]webhook{}, byTrigger: pullRequestTriggers(hooks)}
+	for _, hook := range hooks {
+		repo := canonicalRepoURL(hook.GitRepositoryURL)
+		index.byRepo[repo] = append(index.byRepo[repo], hook)
+	}
+	return index, nil
+}
+
+// rebuildWebhookIndexes rebuilds the index of each profile's eventlistener, keeping the old index of one that fails
+func (r Resource) rebuildWebhookIndexes() {
+	webhookIndexBuildLock.Lock()
+	defer webhookIndexBuildLock.Unlock()
+	for _, profiled := range r.allProfiles() {
+		index, err := profiled.buildWebhookIndex()
+		if err != nil {
+			logging.Log.Errorf("error indexing the webhooks of eventlistener %s: %s", profiled.eventListenerName(), err)
+			continue
+		}
+		webhookIndexesLock.Lock()
+		if webhookIndexing {
+			webhookIndexes[profiled.webhookIndexKey()] = index
+		}
+		webhookIndexesLock.Unlock()
+	}
+}
+
+// IndexWebhooks keeps an index of each profile's webhooks, rebuilt when the eventlisteners or
+// triggerbindings of the install namespace change, until stopCh is closed
+func (r Resource) IndexWebhooks(stopCh <-chan struct{}) {
+	namespace := r.Defaults.Namespace
+	changed := make(chan struct{}, 1)
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { signalWebhookChange(changed) },
+		UpdateFunc: func(interface{}, interface{}) { signalWebhookChange(changed) },
+		DeleteFunc: func(interface{}) { signalWebhookChange(changed) },
+	}
+	_, eventListeners := cache.NewInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return r.TriggersClient.TriggersV1alpha1().EventListeners(namespace).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return r.TriggersClient.TriggersV1alpha1().EventListeners(namespace).Watch(options)
+		},
+	}, &v1alpha1.EventListener{}, 0, handler)
+	_, triggerBindings := cache.NewInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return r.TriggersClient.TriggersV1alpha1().TriggerBindings(namespace).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return r.TriggersClient.TriggersV1alpha1().TriggerBindings(namespace).Watch(options)
+		},
+	}, &v1alpha1.TriggerBinding{}, 0, handler)
+	go eventListeners.Run(stopCh)
+	go triggerBindings.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, eventListeners.HasSynced, triggerBindings.HasSynced) {
+		return
+	}
+
+	webhookIndexesLock.Lock()
+	webhookIndexing = true
+	webhookIndexesLock.Unlock()
+	defer func() {
+		webhookIndexesLock.Lock()
+		webhookIndexing = false
+		webhookIndexes = map[string]*webhookIndex{}
+		webhookIndexesLock.Unlock()
+	}()
+	r.rebuildWebhookIndexes()
+	logging.Log.Infof("indexed the webhooks of namespace %s", namespace)
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-changed:
+			r.rebuildWebhookIndexes()
+		}
+	}
+}
+
+// signalWebhookChange signals a change to rebuild the indexes for, once however many arrive while they're rebuilt
+func signalWebhookChange(changed chan struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
+
+// WebhookIndexFilter rebuilds the webhook indexes once a request changing resources is handled
+func (r Resource) WebhookIndexFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	chain.ProcessFilter(request, response)
+	webhookIndexesLock.RLock()
+	indexing := webhookIndexing
+	webhookIndexesLock.RUnlock()
+	if indexing && changesResources(request) {
+		r.rebuildWebhookIndexes()
+	}
+}
+
+// pullRequestTriggers maps the names of the pull request triggers of hooks to their webhook
+func pullRequestTriggers(hooks []webhook) map[string]webhook {
+	triggers := map[string]webhook{}
+	for _, hook := range hooks {
+		for _, suffix := range webhookTriggerSuffixes {
+			if strings.HasPrefix(suffix, "-pullrequest-") {
+				triggers[triggerPrefix(hook)+suffix] = hook
+			}
+		}
+	}
+	return triggers
+}
+
+// pullRequestTriggerWebhooks maps the names of the pull request triggers of hooks, the webhooks of r's
+// eventlistener, to their webhook
+func (r Resource) pullRequestTriggerWebhooks(hooks []webhook) map[string]webhook {
+	if index, found := r.indexedWebhooks(); found {
+		return index.byTrigger
+	}
+	return pullRequestTriggers(hooks)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"testing"
+	"time"
+)
+
+// waitFor polls condition until it holds or a few seconds have passed
+func waitFor(condition func() bool) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIndexWebhooks(t *testing.T) {
+	r := dummyResource()
+	hook := webhook{Name: "hook", Namespace: installNs, GitRepositoryURL: "https://github.com/owner/repo", AccessTokenRef: "token1", Pipeline: "pipeline1"}
+	other := webhook{Name: "other", Namespace: installNs, GitRepositoryURL: "https://github.com/Owner/Repo.git", AccessTokenRef: "token1", Pipeline: "pipeline2"}
+	createTriggerResources(hook, r)
+	createTriggerResources(other, r)
+	GetTriggerBindingObjectMeta = FakeGetTriggerBindingObjectMeta
+	el, err := r.createEventListener(hook, installNs, "owner.repo-")
+	if err != nil {
+		t.Fatalf("error creating eventlistener: %s", err)
+	}
+
+	stopCh := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		r.IndexWebhooks(stopCh)
+		close(stopped)
+	}()
+	if !waitFor(func() bool { _, found := r.indexedWebhooks(); return found }) {
+		close(stopCh)
+		t.Fatal("expected the webhooks to be indexed")
+	}
+
+	if _, err := r.updateEventListener(el, other, "owner.repo-"); err != nil {
+		t.Fatalf("error adding webhook: %s", err)
+	}
+	if !waitFor(func() bool { hooks, _ := r.getHooksForRepo("https://github.com/owner/repo"); return len(hooks) == 2 }) {
+		t.Error("expected the index to have both webhooks of the repository once the eventlistener changed")
+	}
+	index, _ := r.indexedWebhooks()
+	if owner, found := r.pullRequestTriggerWebhooks(nil)["other-"+installNs+"-pullrequest-event"]; !found || owner.Name != "other" || len(index.hooks) != 2 {
+		t.Errorf("expected the index to map the other webhook's pull request trigger to it, got %+v", index.byTrigger)
+	}
+
+	close(stopCh)
+	<-stopped
+	if _, found := r.indexedWebhooks(); found {
+		t.Error("expected the index to be dropped once indexing stopped")
+	}
+	if hooks, err := r.getHooksForRepo("https://github.com/owner/repo"); err != nil || len(hooks) != 2 {
+		t.Errorf("expected the webhooks to be listed without the index, got %+v, %v", hooks, err)
+	}
+}
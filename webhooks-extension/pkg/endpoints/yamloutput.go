@@ -0,0 +1,59 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"io/ioutil"
+
+	restful "github.com/emicklei/go-restful"
+	"sigs.k8s.io/yaml"
+)
+
+/*--------------------------------------
+The webhook endpoints respond with YAML to a request with an
+Accept: application/yaml header, e.g. to redirect GET /webhooks straight
+into a manifest. The YAML has the fields of the JSON response, being
+converted from it. Request bodies are still JSON and errors plain text.
+---------------------------------------*/
+
+const mimeYAML = "application/yaml"
+
+func init() {
+	restful.RegisterEntityAccessor(mimeYAML, yamlEntityAccessor{})
+}
+
+type yamlEntityAccessor struct{}
+
+func (yamlEntityAccessor) Read(request *restful.Request, entityPointer interface{}) error {
+	body, err := ioutil.ReadAll(request.Request.Body)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(body, entityPointer)
+}
+
+func (yamlEntityAccessor) Write(response *restful.Response, status int, entity interface{}) error {
+	if entity == nil {
+		response.WriteHeader(status)
+		return nil
+	}
+	data, err := yaml.Marshal(entity)
+	if err != nil {
+		return err
+	}
+	response.Header().Set("Content-Type", mimeYAML)
+	response.WriteHeader(status)
+	_, err = response.Write(data)
+	return err
+}
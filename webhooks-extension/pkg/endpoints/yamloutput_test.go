@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	restful "github.com/emicklei/go-restful"
+	"sigs.k8s.io/yaml"
+)
+
+func TestYAMLOutput(t *testing.T) {
+	r := dummyResource()
+	container := restful.NewContainer()
+	r.RegisterExtensionWebService(container)
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		httpReq := dummyHTTPRequest("GET", "http://wwww.dummy.com:8383"+path, nil)
+		if accept != "" {
+			httpReq.Header.Set("Accept", accept)
+		}
+		httpWriter := httptest.NewRecorder()
+		container.ServeHTTP(httpWriter, httpReq)
+		return httpWriter
+	}
+
+	yamlResponse := get("/webhooks/messages", mimeYAML)
+	if yamlResponse.Code != http.StatusOK || yamlResponse.Header().Get("Content-Type") != mimeYAML {
+		t.Fatalf("expected a YAML response, got %d %s", yamlResponse.Code, yamlResponse.Header().Get("Content-Type"))
+	}
+	if strings.HasPrefix(strings.TrimSpace(yamlResponse.Body.String()), "[") {
+		t.Errorf("expected YAML rather than JSON, got %s", yamlResponse.Body.String())
+	}
+	fromYAML := []message{}
+	if err := yaml.Unmarshal(yamlResponse.Body.Bytes(), &fromYAML); err != nil {
+		t.Fatalf("error reading the YAML response: %s", err)
+	}
+
+	jsonResponse := get("/webhooks/messages", "")
+	fromJSON := []message{}
+	if err := json.Unmarshal(jsonResponse.Body.Bytes(), &fromJSON); err != nil {
+		t.Fatalf("expected JSON without an Accept header: %s", err)
+	}
+	if len(fromYAML) == 0 || len(fromYAML) != len(fromJSON) || fromYAML[0] != fromJSON[0] {
+		t.Errorf("expected the YAML to hold the JSON's fields, got %+v and %+v", fromYAML, fromJSON)
+	}
+
+	if response := get("/webhooks/defaults", "application/yaml, application/json;q=0.9"); !strings.Contains(response.Body.String(), "namespace: ") {
+		t.Errorf("expected the defaults as YAML, got %s", response.Body.String())
+	}
+}
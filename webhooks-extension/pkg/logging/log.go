@@ -15,14 +15,30 @@ package logging
 
 import (
 	"fmt"
+	"os"
+
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
+// Level is the level Log logs at, debug until changed with SetLevel
+var Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+
 // Log is our logger for use elsewhere
 var Log = loggerInit()
 
+// loggerInit builds the logger zap.NewExample does, at Level
 func loggerInit() *zap.SugaredLogger {
-	Logger := zap.NewExample().Sugar()
+	encoderConfig := zapcore.EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), os.Stdout, Level)
+	Logger := zap.New(core).Sugar()
 	defer Logger.Sync()
 	if Logger == nil {
 		fmt.Print("expected a non-nil logger")
@@ -30,3 +46,13 @@ func loggerInit() *zap.SugaredLogger {
 	Logger.Info("constructed a logger")
 	return Logger
 }
+
+// SetLevel changes the level Log logs at to one of debug, info, warn or error
+func SetLevel(level string) error {
+	var parsed zapcore.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %s", level)
+	}
+	Level.SetLevel(parsed)
+	return nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sclient "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Most keys a replay cache keeps, no more are remembered until some expire
+	maxReplayCacheEntries = 10000
+	// Times remembering a key is tried when other replicas update the cache at the same time
+	replayCacheAttempts = 5
+)
+
+// ReplayCache remembers keys for a while in a ConfigMap, so that every replica of a component, and the component
+// after a restart, knows the keys the others saw. Each key is kept as its SHA-256 with the time it's remembered
+// until, in seconds since the epoch.
+type ReplayCache struct {
+	Client    k8sclient.Interface
+	Namespace string
+	Name      string
+}
+
+func replayCacheKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func rememberedAt(until string, now time.Time) bool {
+	seconds, err := strconv.ParseInt(until, 10, 64)
+	return err == nil && now.Before(time.Unix(seconds, 0))
+}
+
+// Remember remembers key for window from now, returning false if it already was remembered. Checking and
+// remembering at once, only one of the callers remembering a key at the same time gets true. While the cache is
+// full an error is returned rather than forgetting keys still remembered.
+func (c ReplayCache) Remember(key string, window time.Duration, now time.Time) (bool, error) {
+	hashed := replayCacheKey(key)
+	configMaps := c.Client.CoreV1().ConfigMaps(c.Namespace)
+	for attempt := 1; ; attempt++ {
+		cm, err := configMaps.Get(c.Name, metav1.GetOptions{})
+		found := err == nil
+		if k8serrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: c.Name, Namespace: c.Namespace}}
+		} else if err != nil {
+			return false, err
+		}
+		if rememberedAt(cm.Data[hashed], now) {
+			return false, nil
+		}
+		cm.Data = forgetExpired(cm.Data, now)
+		if len(cm.Data) >= maxReplayCacheEntries {
+			return false, fmt.Errorf("configmap %s already remembers %d keys, the most it keeps", c.Name, maxReplayCacheEntries)
+		}
+		cm.Data[hashed] = strconv.FormatInt(now.Add(window).Unix(), 10)
+		if found {
+			_, err = configMaps.Update(cm)
+		} else {
+			_, err = configMaps.Create(cm)
+		}
+		if err == nil {
+			return true, nil
+		}
+		// Another replica changed the cache first, try again with its changes
+		if (!k8serrors.IsConflict(err) && !k8serrors.IsAlreadyExists(err)) || attempt == replayCacheAttempts {
+			return false, err
+		}
+	}
+}
+
+// Forget forgets key, so that it can be remembered again
+func (c ReplayCache) Forget(key string) error {
+	hashed := replayCacheKey(key)
+	configMaps := c.Client.CoreV1().ConfigMaps(c.Namespace)
+	for attempt := 1; ; attempt++ {
+		cm, err := configMaps.Get(c.Name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, found := cm.Data[hashed]; !found {
+			return nil
+		}
+		delete(cm.Data, hashed)
+		if _, err = configMaps.Update(cm); err == nil {
+			return nil
+		}
+		// Another replica changed the cache first, try again with its changes
+		if !k8serrors.IsConflict(err) || attempt == replayCacheAttempts {
+			return err
+		}
+	}
+}
+
+// forgetExpired drops the keys no longer remembered at now
+func forgetExpired(data map[string]string, now time.Time) map[string]string {
+	kept := map[string]string{}
+	for key, until := range data {
+		if rememberedAt(until, now) {
+			kept[key] = until
+		}
+	}
+	return kept
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The Tekton Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+		http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sclient "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Secret in the install namespace holding the key the extension signs dry-run simulated deliveries with, so the
+	// validator only skips its side effects for deliveries the extension simulated
+	SimulationKeySecret = "webhooks-extension-simulation-key"
+	simulationKeyName   = "key"
+	// When the extension signed a dry-run simulated delivery, in seconds since the epoch, and the hex HMAC-SHA256 of
+	// the timestamp, a dot and the payload
+	SimulationTimestampHeader = "Wext-Simulation-Timestamp"
+	SimulationSignatureHeader = "Wext-Simulation-Signature"
+	// Longest a dry-run simulated delivery is accepted for after it's signed, either way for clock skew
+	maxSimulationAge = 5 * time.Minute
+)
+
+// GetSimulationKey returns the key dry-run simulated deliveries are signed with, creating it if create is true and
+// it does not exist
+func GetSimulationKey(client k8sclient.Interface, namespace string, create bool) ([]byte, error) {
+	secrets := client.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(SimulationKeySecret, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) && create {
+		key := make([]byte, 32)
+		if _, err := cryptorand.Read(key); err != nil {
+			return nil, fmt.Errorf("error generating the simulation key: %s", err)
+		}
+		secret, err = secrets.Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: SimulationKeySecret, Namespace: namespace},
+			Data:       map[string][]byte{simulationKeyName: key},
+		})
+		// Another replica created it first
+		if k8serrors.IsAlreadyExists(err) {
+			secret, err = secrets.Get(SimulationKeySecret, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading secret %s: %s", SimulationKeySecret, err)
+	}
+	if len(secret.Data[simulationKeyName]) == 0 {
+		return nil, fmt.Errorf("secret %s has no %s", SimulationKeySecret, simulationKeyName)
+	}
+	return secret.Data[simulationKeyName], nil
+}
+
+func simulationSignature(key []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignSimulation sets the headers signing payload as a dry-run simulated delivery at now
+func SignSimulation(header http.Header, key, payload []byte, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	header.Set(SimulationTimestampHeader, timestamp)
+	header.Set(SimulationSignatureHeader, simulationSignature(key, timestamp, payload))
+}
+
+// VerifySimulation returns why header doesn't sign payload as a dry-run simulated delivery at now, if it doesn't
+func VerifySimulation(header http.Header, key, payload []byte, now time.Time) error {
+	timestamp := header.Get(SimulationTimestampHeader)
+	signature, err := hex.DecodeString(header.Get(SimulationSignatureHeader))
+	if timestamp == "" || err != nil || len(signature) == 0 {
+		return errors.New("the simulation is not signed by the extension")
+	}
+	expected, _ := hex.DecodeString(simulationSignature(key, timestamp, payload))
+	if !hmac.Equal(signature, expected) {
+		return errors.New("the simulation's signature does not match")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid simulation timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxSimulationAge || age < -maxSimulationAge {
+		return fmt.Errorf("the simulation was signed %s from now, more than %s", age.Round(time.Second), maxSimulationAge)
+	}
+	return nil
+}
@@ -16,18 +16,25 @@ package utils
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	restful "github.com/emicklei/go-restful"
 	logging "github.com/tektoncd/dashboard/pkg/logging"
 	"golang.org/x/oauth2"
+	"io/ioutil"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sclient "k8s.io/client-go/kubernetes"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 )
 
+// GitCACertPath is where the optional webhooks-extension-git-ca secret's ca.crt is mounted, a CA
+// to trust for git servers with certificates from a private CA such as GitHub Enterprise Server
+const GitCACertPath = "/etc/webhooks-extension/git-ca/ca.crt"
+
 // RespondError - logs and writes an error response with a desired status code
 func RespondError(response *restful.Response, err error, statusCode int) {
 	logging.Log.Error("Error: ", strings.Replace(err.Error(), "/", "", -1))
@@ -51,19 +58,44 @@ func RespondMessageAndLogError(response *restful.Response, err error, message st
 }
 
 // createOAuth2Client returns an HTTP client with oauth2 authentication using the provided accessToken
-func CreateOAuth2Client(ctx context.Context, accessToken string, sslVerify bool) *http.Client {
+func CreateOAuth2Client(ctx context.Context, accessToken string, tlsConfig *tls.Config) *http.Client {
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken})
 	client := &http.Client{
 		Transport: &oauth2.Transport{
 			Source: ts,
 			Base: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: !sslVerify},
+				TLSClientConfig: tlsConfig,
 			},
 		},
 	}
 	return client
 }
 
+// GitTLSConfig returns the TLS config for calls to git servers, trusting the CA at GitCACertPath
+// as well as the system CAs if the CA has been mounted
+func GitTLSConfig(sslVerify bool) *tls.Config {
+	config := &tls.Config{InsecureSkipVerify: !sslVerify}
+	if !sslVerify {
+		return config
+	}
+	caCert, err := ioutil.ReadFile(GitCACertPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Log.Errorf("error reading git CA certificate %s: %s", GitCACertPath, err)
+		}
+		return config
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caCert) {
+		logging.Log.Errorf("no certificates found in git CA certificate %s", GitCACertPath)
+	}
+	config.RootCAs = pool
+	return config
+}
+
 func GetClientAllowsSelfSigned() *http.Client {
 	transport := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
@@ -72,6 +104,85 @@ func GetClientAllowsSelfSigned() *http.Client {
 	return client
 }
 
+// GitCredentials are the credentials stored in a webhooks extension credential secret, an access
+// token ("accessToken") and/or a username and password ("username" and "password") for git
+// servers that require basic authentication
+type GitCredentials struct {
+	AccessToken string
+	Username    string
+	Password    string
+}
+
+// GetGitCredentials returns the credentials stored in the named secret
+func GetGitCredentials(kubeClient k8sclient.Interface, namespace, name string) (GitCredentials, error) {
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return GitCredentials{}, err
+	}
+	return GitCredentials{
+		AccessToken: string(secret.Data["accessToken"]),
+		Username:    string(secret.Data["username"]),
+		Password:    string(secret.Data["password"]),
+	}, nil
+}
+
+// CreateBasicAuthClient returns an HTTP client authenticating with the provided username and password
+func CreateBasicAuthClient(username, password string, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &basicAuthTransport{
+			Username: username,
+			Password: password,
+			Base:     &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+}
+
+// CreateTokenAuthClient returns an HTTP client sending the provided accessToken as "Authorization: token", the
+// scheme Gitea and Gogs both accept
+func CreateTokenAuthClient(accessToken string, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &tokenAuthTransport{
+			AccessToken: accessToken,
+			Base:        &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+}
+
+type tokenAuthTransport struct {
+	AccessToken string
+	Base        http.RoundTripper
+}
+
+func (t *tokenAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request they are given
+	authenticated := new(http.Request)
+	*authenticated = *req
+	authenticated.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		authenticated.Header[k] = append([]string(nil), v...)
+	}
+	authenticated.Header.Set("Authorization", "token "+t.AccessToken)
+	return t.Base.RoundTrip(authenticated)
+}
+
+type basicAuthTransport struct {
+	Username string
+	Password string
+	Base     http.RoundTripper
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request they are given
+	authenticated := new(http.Request)
+	*authenticated = *req
+	authenticated.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		authenticated.Header[k] = append([]string(nil), v...)
+	}
+	authenticated.SetBasicAuth(t.Username, t.Password)
+	return t.Base.RoundTrip(authenticated)
+}
+
 // getWebhookSecretTokens returns the "secretToken" and "accessToken" stored in the Secret
 // with the name specified by the parameter, and in the namespace specified by r.Defaults.Namespace.
 func GetWebhookSecretTokens(kubeClient k8sclient.Interface, namespace, name string) (accessToken string, secretToken string, err error) {
@@ -103,16 +214,52 @@ func GetGitProviderAndAPIURL(inputURL string) (string, string, error) {
 		apiURL := "https://api.github.com/"
 		return "github", apiURL, nil
 	// GHE
-	case strings.Contains(gitURL.Host, "github"):
+	case IsGitHubHost(gitURL.Host):
 		apiURL := gitURL.Scheme + "://" + gitURL.Host + "/api/v3/"
 		return "github", apiURL, nil
 	// GITLAB
 	case strings.Contains(gitURL.Host, "gitlab"):
 		apiURL := gitURL.Scheme + "://" + gitURL.Host + "/api/v4"
 		return "gitlab", apiURL, nil
+	// BITBUCKET CLOUD
+	case strings.EqualFold(gitURL.Host, "bitbucket.org"):
+		apiURL := "https://api.bitbucket.org/2.0/"
+		return "bitbucket", apiURL, nil
+	// GITEA AND GOGS
+	case IsGiteaHost(gitURL.Host):
+		apiURL := gitURL.Scheme + "://" + gitURL.Host + "/api/v1/"
+		return "gitea", apiURL, nil
 	default:
 		msg := fmt.Sprintf("Git Provider for project URL: %s not recognized", gitURL)
 		return "", "", errors.New(msg)
 	}
 
 }
+
+// IsGiteaHost returns whether host is a Gitea or Gogs server, either with "gitea" or "gogs" in its name or listed
+// in GITEA_HOSTS, a comma separated list of hosts
+func IsGiteaHost(host string) bool {
+	if strings.Contains(host, "gitea") || strings.Contains(host, "gogs") {
+		return true
+	}
+	for _, giteaHost := range strings.Split(os.Getenv("GITEA_HOSTS"), ",") {
+		if giteaHost = strings.TrimSpace(giteaHost); giteaHost != "" && strings.EqualFold(giteaHost, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGitHubHost returns whether host is a GitHub server, either with "github" in its name or listed in
+// GITHUB_ENTERPRISE_HOSTS, a comma separated list of GitHub Enterprise Server hosts
+func IsGitHubHost(host string) bool {
+	if strings.Contains(host, "github") {
+		return true
+	}
+	for _, gheHost := range strings.Split(os.Getenv("GITHUB_ENTERPRISE_HOSTS"), ",") {
+		if gheHost = strings.TrimSpace(gheHost); gheHost != "" && strings.EqualFold(gheHost, host) {
+			return true
+		}
+	}
+	return false
+}